@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/pkg/client"
+)
+
+// workloadQuery is one statement of a workload file.
+type workloadQuery struct {
+	Name string
+	SQL  string
+}
+
+// parseWorkload reads statements terminated by a semicolon at the end of a line. A
+// "-- name: label" comment names the statement that follows; unnamed statements are
+// numbered.
+func parseWorkload(r io.Reader) ([]workloadQuery, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+	var (
+		queries   []workloadQuery
+		name      string
+		statement strings.Builder
+	)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if statement.Len() == 0 {
+			if label, ok := strings.CutPrefix(trimmed, "-- name:"); ok {
+				name = strings.TrimSpace(label)
+				continue
+			}
+			if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+				continue
+			}
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if name == "" {
+				name = fmt.Sprintf("query%d", len(queries)+1)
+			}
+			queries = append(queries, workloadQuery{Name: name, SQL: statement.String()})
+			name = ""
+			statement.Reset()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(statement.String()) != "" {
+		return nil, fmt.Errorf("statement %d is not terminated by a semicolon", len(queries)+1)
+	}
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("workload contains no statements")
+	}
+	return queries, nil
+}
+
+// latencyStats summarises the latencies of one query or of the whole run.
+type latencyStats struct {
+	Name   string  `json:"name"`
+	Count  int     `json:"count"`
+	Errors int     `json:"errors"`
+	MeanMs float64 `json:"meanMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P90Ms  float64 `json:"p90Ms"`
+	P95Ms  float64 `json:"p95Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+type benchReport struct {
+	Concurrency int            `json:"concurrency"`
+	Iterations  int            `json:"iterations"`
+	WallTimeMs  float64        `json:"wallTimeMs"`
+	Throughput  float64        `json:"queriesPerSecond"`
+	Total       latencyStats   `json:"total"`
+	Queries     []latencyStats `json:"queries"`
+	FirstErrors []string       `json:"firstErrors,omitempty"`
+}
+
+// maxReportedErrors bounds the distinct error messages kept in the report.
+const maxReportedErrors = 5
+
+// percentile returns the nearest-rank percentile of sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func summarise(name string, samples []time.Duration, errors int) latencyStats {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	stats := latencyStats{Name: name, Count: len(samples), Errors: errors}
+	if len(sorted) == 0 {
+		return stats
+	}
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	stats.MeanMs = ms(total / time.Duration(len(sorted)))
+	stats.P50Ms = ms(percentile(sorted, 50))
+	stats.P90Ms = ms(percentile(sorted, 90))
+	stats.P95Ms = ms(percentile(sorted, 95))
+	stats.P99Ms = ms(percentile(sorted, 99))
+	stats.MaxMs = ms(sorted[len(sorted)-1])
+	return stats
+}
+
+type benchSample struct {
+	query   int
+	latency time.Duration
+	err     error
+}
+
+func runBench(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: core bench --dsn DSN --workload FILE [flags]")
+		fmt.Fprintln(stderr, "The workload holds statements ending with ';'; a '-- name: label' line names the next one.")
+		fs.PrintDefaults()
+	}
+
+	var opts queryOptions
+	var (
+		workloadPath string
+		concurrency  int
+		iterations   int
+		warmup       int
+	)
+	addConnectionFlags(fs, &opts)
+	fs.StringVar(&workloadPath, "workload", "", "Workload file")
+	fs.IntVar(&concurrency, "concurrency", 4, "Number of concurrent workers, each with its own engine")
+	fs.IntVar(&iterations, "iterations", 10, "Times every worker replays the workload")
+	fs.IntVar(&warmup, "warmup", 1, "Unmeasured replays per worker before measuring")
+	fs.StringVar(&opts.mode, "mode", modeClassic, "Execution mode: auto, classic or stream")
+	fs.IntVar(&opts.maxRows, "max-rows", 0, "Row limit in classic mode (0 uses the engine default)")
+	fs.StringVar(&opts.format, "format", formatTable, "Report format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	switch {
+	case opts.dsn == "":
+		fmt.Fprintln(stderr, "core bench: --dsn is required")
+		return 2
+	case workloadPath == "":
+		fmt.Fprintln(stderr, "core bench: --workload is required")
+		return 2
+	case concurrency < 1 || iterations < 1 || warmup < 0:
+		fmt.Fprintln(stderr, "core bench: --concurrency and --iterations must be positive")
+		return 2
+	case opts.format != formatTable && opts.format != formatJSON:
+		fmt.Fprintf(stderr, "core bench: unsupported report format %q (want table or json)\n", opts.format)
+		return 2
+	}
+
+	file, err := os.Open(workloadPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "core bench: %v\n", err)
+		return 1
+	}
+	queries, err := parseWorkload(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(stderr, "core bench: %s: %v\n", workloadPath, err)
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	report, err := bench(ctx, opts, queries, concurrency, iterations, warmup)
+	if err != nil {
+		fmt.Fprintf(stderr, "core bench: %v\n", err)
+		return 1
+	}
+
+	if opts.format == formatJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			fmt.Fprintf(stderr, "core bench: %v\n", err)
+			return 1
+		}
+	} else if err := printBenchReport(stdout, report); err != nil {
+		fmt.Fprintf(stderr, "core bench: %v\n", err)
+		return 1
+	}
+	if report.Total.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// bench replays the workload from concurrency workers. Every worker drives its own
+// in-process engine because the engine serves one request at a time.
+func bench(ctx context.Context, opts queryOptions, queries []workloadQuery, concurrency, iterations, warmup int) (*benchReport, error) {
+	engines := make([]*client.Client, concurrency)
+	for i := range engines {
+		c, stop, err := startEngine()
+		if err != nil {
+			return nil, err
+		}
+		defer stop()
+		engines[i] = c
+	}
+
+	run := func(ctx context.Context, c *client.Client, query workloadQuery) error {
+		o := opts
+		o.sql = query.SQL
+		_, err := runStatement(ctx, c, o, discardPrinter{})
+		return err
+	}
+
+	// Warm up connections and server caches outside the measurement.
+	var wg sync.WaitGroup
+	for _, c := range engines {
+		wg.Add(1)
+		go func(c *client.Client) {
+			defer wg.Done()
+			for i := 0; i < warmup; i++ {
+				for _, query := range queries {
+					_ = run(ctx, c, query)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	samples := make(chan benchSample, concurrency*len(queries))
+	start := time.Now()
+	for _, c := range engines {
+		wg.Add(1)
+		go func(c *client.Client) {
+			defer wg.Done()
+			for i := 0; i < iterations && ctx.Err() == nil; i++ {
+				for q, query := range queries {
+					began := time.Now()
+					err := run(ctx, c, query)
+					samples <- benchSample{query: q, latency: time.Since(began), err: err}
+				}
+			}
+		}(c)
+	}
+	go func() {
+		wg.Wait()
+		close(samples)
+	}()
+
+	perQuery := make([][]time.Duration, len(queries))
+	errorsPerQuery := make([]int, len(queries))
+	var all []time.Duration
+	report := &benchReport{Concurrency: concurrency, Iterations: iterations}
+	for sample := range samples {
+		if sample.err != nil {
+			errorsPerQuery[sample.query]++
+			message := fmt.Sprintf("%s: %v", queries[sample.query].Name, sample.err)
+			if len(report.FirstErrors) < maxReportedErrors && !slices.Contains(report.FirstErrors, message) {
+				report.FirstErrors = append(report.FirstErrors, message)
+			}
+			continue
+		}
+		perQuery[sample.query] = append(perQuery[sample.query], sample.latency)
+		all = append(all, sample.latency)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	wall := time.Since(start)
+
+	totalErrors := 0
+	for q, query := range queries {
+		report.Queries = append(report.Queries, summarise(query.Name, perQuery[q], errorsPerQuery[q]))
+		totalErrors += errorsPerQuery[q]
+	}
+	report.Total = summarise("total", all, totalErrors)
+	report.WallTimeMs = float64(wall.Microseconds()) / 1000
+	if wall > 0 {
+		report.Throughput = float64(len(all)) / wall.Seconds()
+	}
+	return report, nil
+}
+
+func printBenchReport(w io.Writer, report *benchReport) error {
+	printer := &tablePrinter{w: w}
+	names := []string{"query", "count", "errors", "mean ms", "p50 ms", "p90 ms", "p95 ms", "p99 ms", "max ms"}
+	columns := make([]client.Column, len(names))
+	for i, name := range names {
+		columns[i] = client.Column{Name: name}
+	}
+	row := func(s latencyStats) []any {
+		return []any{s.Name, s.Count, s.Errors,
+			fmt.Sprintf("%.2f", s.MeanMs), fmt.Sprintf("%.2f", s.P50Ms), fmt.Sprintf("%.2f", s.P90Ms),
+			fmt.Sprintf("%.2f", s.P95Ms), fmt.Sprintf("%.2f", s.P99Ms), fmt.Sprintf("%.2f", s.MaxMs)}
+	}
+	rows := make([][]any, 0, len(report.Queries)+1)
+	for _, s := range report.Queries {
+		rows = append(rows, row(s))
+	}
+	rows = append(rows, row(report.Total))
+
+	if err := printer.begin(columns); err != nil {
+		return err
+	}
+	if err := printer.rows(rows); err != nil {
+		return err
+	}
+	if err := printer.end(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "\n%d workers x %d iterations in %.1f ms: %.1f queries/s\n",
+		report.Concurrency, report.Iterations, report.WallTimeMs, report.Throughput); err != nil {
+		return err
+	}
+	for _, line := range report.FirstErrors {
+		if _, err := fmt.Fprintf(w, "error: %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discardPrinter drops rows so benchmarks measure the engine rather than the terminal.
+type discardPrinter struct{}
+
+func (discardPrinter) begin([]client.Column) error { return nil }
+func (discardPrinter) rows([][]any) error          { return nil }
+func (discardPrinter) end() error                  { return nil }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWorkload(t *testing.T) {
+	queries, err := parseWorkload(strings.NewReader(`
+-- warm cache
+-- name: lookup
+select *
+  from users where id = 1;
+
+select 2;
+`))
+	if err != nil {
+		t.Fatalf("parseWorkload returned error: %v", err)
+	}
+	if len(queries) != 2 || queries[0].Name != "lookup" || queries[1].Name != "query2" {
+		t.Fatalf("unexpected queries %+v", queries)
+	}
+	if queries[0].SQL != "select *\n  from users where id = 1;\n" {
+		t.Fatalf("unexpected SQL %q", queries[0].SQL)
+	}
+
+	if _, err := parseWorkload(strings.NewReader("select 1")); err == nil {
+		t.Fatal("expected an unterminated statement to fail")
+	}
+	if _, err := parseWorkload(strings.NewReader("-- nothing\n")); err == nil {
+		t.Fatal("expected an empty workload to fail")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := percentile(samples, p); got != want {
+			t.Errorf("p%.0f: expected %v, got %v", p, want, got)
+		}
+	}
+}
+
+func TestRunBenchReportsPerQueryStats(t *testing.T) {
+	dir := t.TempDir()
+	workload := filepath.Join(dir, "workload.sql")
+	if err := os.WriteFile(workload, []byte("-- name: one\nselect 1;\n-- name: broken\nselect * from missing;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runBench([]string{
+		"--driver", "sqlite", "--dsn", filepath.Join(dir, "bench.db"), "--workload", workload,
+		"--concurrency", "2", "--iterations", "3", "--format", "json",
+	}, nil, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("expected exit code 1 for failed queries, got %d: %s", code, stderr.String())
+	}
+
+	var report benchReport
+	if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report %s: %v", stdout.String(), err)
+	}
+	if len(report.Queries) != 2 || report.Queries[0].Count != 6 || report.Queries[1].Errors != 6 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Total.Count != 6 || report.Throughput <= 0 || len(report.FirstErrors) != 1 {
+		t.Fatalf("unexpected totals %+v", report)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+
+	"github.com/fluxgrid/core/internal/handlers"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tempstore"
+	"github.com/fluxgrid/core/pkg/client"
+	"github.com/rs/zerolog"
+)
+
+// startEngine runs the handlers in process and returns a client connected to them over
+// pipes, so subcommands go through the same timeouts and streaming code as the extension.
+// The returned function stops the engine.
+func startEngine() (*client.Client, func(), error) {
+	logger := logging.Configure()
+	// Routine engine logs would interleave with command output on the terminal.
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+
+	temp, err := tempstore.Open(tempstore.Options{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server := rpc.NewServer(logger)
+	handlers.Register(server, handlers.Config{Temp: temp})
+
+	toServer, fromClient := io.Pipe()
+	toClient, fromServer := io.Pipe()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		if err := server.Serve(toServer, fromServer); err != nil {
+			logger.Error().Err(err).Msg("engine stopped with error")
+		}
+		fromServer.Close()
+	}()
+
+	c := client.New(toClient, fromClient, fromClient)
+	stop := func() {
+		c.Close()
+		<-stopped
+		if err := temp.Close(); err != nil {
+			logger.Warn().Err(err).Msg("failed to clean up temp storage")
+		}
+	}
+	return c, stop, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fluxgrid/core/internal/gateway"
+	"github.com/fluxgrid/core/internal/grpcapi"
+	"github.com/fluxgrid/core/internal/handlers"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// apiToken generates the token the HTTP and gRPC APIs accept. It is written to tokenFile,
+// readable only by the user, or printed to stderr when there is no file to write it to.
+func apiToken(tokenFile string) (string, error) {
+	token, err := gateway.NewToken()
+	if err != nil {
+		return "", err
+	}
+	if tokenFile == "" {
+		fmt.Fprintf(os.Stderr, "API token: %s\n", token)
+		return token, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(tokenFile), 0o700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0o600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// runAPIKey prints a new API key and the digest to list for it in the --api-keys file.
+func runAPIKey(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("apikey", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: core apikey")
+		fmt.Fprintln(stderr, "Prints a new API key, to give to a tenant, and its keySha256 digest, for the --api-keys file.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	key, err := gateway.NewToken()
+	if err != nil {
+		fmt.Fprintf(stderr, "core apikey: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "key:       %s\nkeySha256: %s\n", key, handlers.HashAPIKey(key))
+	return 0
+}
+
+// startGateway serves the methods of server over HTTP on addr.
+func startGateway(logger zerolog.Logger, server *rpc.Server, addr string, auth rpc.Authenticator) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	httpServer := &http.Server{
+		Handler:           gateway.New(server, auth, handlers.Version),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("HTTP API stopped")
+		}
+	}()
+	logger.Info().Str("address", listener.Addr().String()).Msg("HTTP API listening")
+	return httpServer, nil
+}
+
+// startGRPC serves the methods of server over gRPC on addr, with server reflection so that
+// tools such as grpcurl can list the service.
+func startGRPC(logger zerolog.Logger, server *rpc.Server, addr string, auth rpc.Authenticator) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	grpcServer := grpc.NewServer()
+	grpcapi.Register(grpcServer, server, auth)
+	reflection.Register(grpcServer)
+	go func() {
+		if err := grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			logger.Error().Err(err).Msg("gRPC API stopped")
+		}
+	}()
+	logger.Info().Str("address", listener.Addr().String()).Msg("gRPC API listening")
+	return grpcServer, nil
+}
@@ -1,30 +1,258 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
+	"github.com/fluxgrid/core/internal/faults"
 	"github.com/fluxgrid/core/internal/handlers"
 	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/ratelimit"
+	"github.com/fluxgrid/core/internal/replay"
+	"github.com/fluxgrid/core/internal/rewrite"
 	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tempstore"
+	"google.golang.org/grpc"
 )
 
+// subcommand runs a standalone mode of the binary and returns the process exit code.
+type subcommand func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+var subcommands = map[string]subcommand{
+	"query":  runQuery,
+	"repl":   runRepl,
+	"bench":  runBench,
+	"apikey": runAPIKey,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+	serve()
+}
+
+// serve runs the JSON-RPC engine for the extension.
+func serve() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n       %s query|repl|bench|apikey [flags]\n\nflags:\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
 	useStdio := flag.Bool("stdio", true, "Serve JSON-RPC over stdio")
+	stateDir := flag.String("state-dir", defaultStateDir(), "Directory for persistent engine state (empty disables persistence)")
+	tempDir := flag.String("temp-dir", "", "Directory for temporary files (defaults to the system temp directory)")
+	tempQuotaMB := flag.Int64("temp-quota-mb", 10240, "Maximum size of temporary files in MiB (0 disables the limit)")
+	maxMessageMB := flag.Int("max-message-mb", rpc.DefaultMaxMessageSize>>20, "Maximum size of one incoming JSON-RPC message in MiB")
+	outboundQueue := flag.Int("outbound-queue", rpc.DefaultOutboundCapacity, "Maximum number of messages waiting to be written to the client")
+	maxConcurrent := flag.Int("max-concurrent-requests", rpc.DefaultMaxConcurrency, "Maximum number of requests of one client that run at once; the others wait their turn (1 runs them one after another)")
+	sessionRateLimit := flag.String("session-rate-limit", "", "Per-client rate limits, e.g. query.execute=10/s:20,schema.list=30/m")
+	profileRateLimit := flag.String("profile-rate-limit", "", "Per-database rate limits shared by all clients, same syntax as --session-rate-limit")
+	requireHandles := flag.Bool("require-connection-handles", false, "Accept DSNs only in connection.open; other methods must pass the returned handle")
+	queryTags := flag.Bool("query-tags", true, "Prefix executed statements with a comment naming the user, client and request")
+	maxRSSMB := flag.Uint64("max-rss-mb", 0, "Resident memory in MiB above which heavy requests are refused after freeing caches (0 disables the limit)")
+	maxResultMB := flag.Int64("max-result-mb", 64, "Estimated size in MiB above which classic query results are cut short and flagged oversized (0 disables the limit)")
+	historyPlansMB := flag.Int64("history-plans-mb", 0, "Capture the execution plan of each query.execute statement into history with EXPLAIN, keeping up to this many MiB of plans per workspace (0 disables capturing)")
+	aliasesPath := flag.String("connection-aliases", "", "JSON file mapping alias names to {\"driver\", \"dsn\"} connections clients can use by name")
+	rewritePath := flag.String("rewrite-rules", "", "JSON file listing rewrite rules applied to statements before they run (limit, renameTable, tenantFilter, regex)")
+	maskingPath := flag.String("masking-policy", "", "JSON file of masking rules applied to the results of connection aliases tagged \"restricted\"")
+	maxStreams := flag.Int("max-streams", 0, "Maximum number of streaming queries running at once across all clients (0 disables the limit)")
+	httpAddr := flag.String("http", "", "Also serve the methods as an HTTP API on this address, e.g. 127.0.0.1:8750 (empty disables it)")
+	grpcAddr := flag.String("grpc", "", "Also serve the methods as a gRPC API on this address, e.g. 127.0.0.1:8751 (empty disables it)")
+	httpTokenFile := flag.String("http-token-file", "", "File the generated bearer token of the HTTP and gRPC APIs is written to (defaults to http-token in the state directory)")
+	replayPath := flag.String("record-replay", "", "Record the results of query.execute statements into this fixture file for the replay driver (empty disables recording)")
+	apiKeysPath := flag.String("api-keys", "", "JSON file of tenants and the digests of their API keys; the HTTP and gRPC APIs then accept those keys instead of a generated token")
 	flag.Parse()
 
 	logger := logging.Configure()
 
+	temp, err := tempstore.Open(tempstore.Options{Dir: *tempDir, MaxBytes: *tempQuotaMB << 20})
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to prepare temp storage")
+	}
+
+	var limits handlers.RateLimits
+	if limits.Session, err = ratelimit.ParseRules(*sessionRateLimit); err != nil {
+		logger.Fatal().Err(err).Msg("invalid --session-rate-limit")
+	}
+	if limits.Profile, err = ratelimit.ParseRules(*profileRateLimit); err != nil {
+		logger.Fatal().Err(err).Msg("invalid --profile-rate-limit")
+	}
+
+	// Configuration imported with state.import stands in for flags that are not set.
+	if *aliasesPath == "" {
+		*aliasesPath = handlers.ImportedConfig(*stateDir, handlers.ImportedAliasesFile)
+	}
+	if *rewritePath == "" {
+		*rewritePath = handlers.ImportedConfig(*stateDir, handlers.ImportedRewriteFile)
+	}
+	if *maskingPath == "" {
+		*maskingPath = handlers.ImportedConfig(*stateDir, handlers.ImportedMaskingFile)
+	}
+
+	var aliases map[string]handlers.ConnectionAlias
+	if *aliasesPath != "" {
+		if aliases, err = handlers.LoadConnectionAliases(*aliasesPath); err != nil {
+			logger.Fatal().Err(err).Msg("invalid --connection-aliases")
+		}
+	}
+
+	var rewriter *rewrite.Rewriter
+	if *rewritePath != "" {
+		if rewriter, err = rewrite.Load(*rewritePath); err != nil {
+			logger.Fatal().Err(err).Msg("invalid --rewrite-rules")
+		}
+	}
+
+	var maskingPolicy *masking.Policy
+	if *maskingPath != "" {
+		if maskingPolicy, err = masking.Load(*maskingPath); err != nil {
+			logger.Fatal().Err(err).Msg("invalid --masking-policy")
+		}
+	}
+	for name, alias := range aliases {
+		if alias.Restricted() && maskingPolicy == nil {
+			logger.Fatal().Str("alias", name).Msg("restricted connection aliases require --masking-policy")
+		}
+	}
+
+	var tenants map[string]handlers.Tenant
+	if *apiKeysPath != "" {
+		if tenants, err = handlers.LoadTenants(*apiKeysPath, aliases); err != nil {
+			logger.Fatal().Err(err).Msg("invalid --api-keys")
+		}
+	}
+	for name, tenant := range tenants {
+		for alias, connection := range tenant.Connections {
+			if connection.Restricted() && maskingPolicy == nil {
+				logger.Fatal().Str("tenant", name).Str("alias", alias).Msg("restricted connection aliases require --masking-policy")
+			}
+		}
+	}
+
+	var replayRecorder *replay.Recorder
+	if *replayPath != "" {
+		if replayRecorder, err = replay.NewRecorder(*replayPath); err != nil {
+			logger.Fatal().Err(err).Msg("invalid --record-replay")
+		}
+	}
+
+	faultPlan, err := faults.Parse(os.Getenv(faults.EnvVar))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid " + faults.EnvVar)
+	}
+	if faultPlan.Enabled() {
+		logger.Warn().Str("faults", faultPlan.String()).Msg("injecting stream faults")
+	}
+
+	maxResultBytes := *maxResultMB << 20
+	if maxResultBytes == 0 {
+		maxResultBytes = -1
+	}
+
 	server := rpc.NewServer(logger)
-	handlers.Register(server)
+	server.SetMaxMessageSize(*maxMessageMB << 20)
+	server.SetOutboundCapacity(*outboundQueue)
+	server.SetMaxConcurrency(*maxConcurrent)
+	handlers.Register(server, handlers.Config{
+		StateDir:                 *stateDir,
+		Temp:                     temp,
+		RateLimits:               limits,
+		RequireConnectionHandles: *requireHandles,
+		DisableQueryTags:         !*queryTags,
+		MaxResultBytes:           maxResultBytes,
+		HistoryPlanBytes:         *historyPlansMB << 20,
+		Resources:                pressure.Limits{MaxRSS: *maxRSSMB << 20, MaxStreams: *maxStreams},
+		ConnectionAliases:        aliases,
+		Rewriter:                 rewriter,
+		Masking:                  maskingPolicy,
+		Tenants:                  tenants,
+		ReplayRecorder:           replayRecorder,
+		Faults:                   faultPlan,
+	})
+
+	var (
+		httpServer *http.Server
+		grpcServer *grpc.Server
+	)
+	if *httpAddr != "" || *grpcAddr != "" {
+		// With tenants the APIs serve them only; otherwise one generated token gives the
+		// access of the core's own clients.
+		auth := handlers.TenantAuthenticator(tenants)
+		if tenants == nil {
+			tokenFile := *httpTokenFile
+			if tokenFile == "" && *stateDir != "" {
+				tokenFile = filepath.Join(*stateDir, "http-token")
+			}
+			token, err := apiToken(tokenFile)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("failed to write the API token")
+			}
+			auth = rpc.TokenAuthenticator(token)
+		}
+		if *httpAddr != "" {
+			if httpServer, err = startGateway(logger, server, *httpAddr, auth); err != nil {
+				logger.Fatal().Err(err).Msg("failed to start the HTTP API")
+			}
+		}
+		if *grpcAddr != "" {
+			if grpcServer, err = startGRPC(logger, server, *grpcAddr, auth); err != nil {
+				logger.Fatal().Err(err).Msg("failed to start the gRPC API")
+			}
+		}
+	}
 
 	if *useStdio {
-		if err := server.Serve(os.Stdin, os.Stdout); err != nil {
+		err := server.Serve(os.Stdin, os.Stdout)
+		if httpServer != nil {
+			_ = httpServer.Close()
+		}
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+		if cerr := temp.Close(); cerr != nil {
+			logger.Warn().Err(cerr).Msg("failed to clean up temp storage")
+		}
+		if err != nil {
 			logger.Fatal().Err(err).Msg("server stopped with error")
 		}
 		return
 	}
 
-	logger.Fatal().Msg("only --stdio mode is currently supported")
+	if httpServer != nil || grpcServer != nil {
+		// Without stdio the APIs serve until the process is told to stop.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		<-ctx.Done()
+		stop()
+		if httpServer != nil {
+			_ = httpServer.Shutdown(context.Background())
+		}
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		if err := temp.Close(); err != nil {
+			logger.Warn().Err(err).Msg("failed to clean up temp storage")
+		}
+		return
+	}
+
+	logger.Fatal().Msg("enable --stdio, --http or --grpc")
 }
 
+func defaultStateDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fluxgrid")
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/pkg/client"
+)
+
+// Output formats accepted by --format.
+const (
+	formatTable = "table"
+	formatCSV   = "csv"
+	formatJSON  = "json"
+)
+
+// rowPrinter writes a result as it arrives: begin once with the columns, rows for every
+// batch, then end.
+type rowPrinter interface {
+	begin(columns []client.Column) error
+	rows(rows [][]any) error
+	end() error
+}
+
+func newPrinter(format string, w io.Writer) (rowPrinter, error) {
+	switch format {
+	case formatTable:
+		return &tablePrinter{w: w}, nil
+	case formatCSV:
+		return &csvPrinter{w: csv.NewWriter(w)}, nil
+	case formatJSON:
+		return &jsonPrinter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q (want table, csv or json)", format)
+	}
+}
+
+type csvPrinter struct {
+	w *csv.Writer
+}
+
+func (p *csvPrinter) begin(columns []client.Column) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return p.w.Write(names)
+}
+
+func (p *csvPrinter) rows(rows [][]any) error {
+	for _, row := range rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = resultset.CellText(value)
+		}
+		if err := p.w.Write(record); err != nil {
+			return err
+		}
+	}
+	p.w.Flush()
+	return p.w.Error()
+}
+
+func (p *csvPrinter) end() error {
+	p.w.Flush()
+	return p.w.Error()
+}
+
+// jsonPrinter streams an array of objects, keeping keys in column order.
+type jsonPrinter struct {
+	w     io.Writer
+	keys  []string
+	count int
+}
+
+func (p *jsonPrinter) begin(columns []client.Column) error {
+	p.keys = make([]string, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		p.keys[i] = string(key)
+	}
+	_, err := io.WriteString(p.w, "[")
+	return err
+}
+
+func (p *jsonPrinter) rows(rows [][]any) error {
+	var b strings.Builder
+	for _, row := range rows {
+		if p.count > 0 {
+			b.WriteString(",")
+		}
+		p.count++
+		b.WriteString("\n  {")
+		for i, value := range row {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			if i < len(p.keys) {
+				b.WriteString(p.keys[i])
+			}
+			b.WriteString(": ")
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				encoded, _ = json.Marshal(resultset.CellText(value))
+			}
+			b.Write(encoded)
+		}
+		b.WriteString("}")
+	}
+	_, err := io.WriteString(p.w, b.String())
+	return err
+}
+
+func (p *jsonPrinter) end() error {
+	closing := "]\n"
+	if p.count > 0 {
+		closing = "\n]\n"
+	}
+	_, err := io.WriteString(p.w, closing)
+	return err
+}
+
+// tablePrinter renders an aligned text table. Column widths depend on every row, so rows
+// are buffered until end.
+type tablePrinter struct {
+	w      io.Writer
+	header []string
+	cells  [][]string
+}
+
+func (p *tablePrinter) begin(columns []client.Column) error {
+	p.header = make([]string, len(columns))
+	for i, col := range columns {
+		p.header[i] = col.Name
+	}
+	return nil
+}
+
+func (p *tablePrinter) rows(rows [][]any) error {
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, value := range row {
+			if value == nil {
+				cells[i] = "NULL"
+				continue
+			}
+			// Keep one table line per row.
+			cells[i] = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\t", `\t`).Replace(resultset.CellText(value))
+		}
+		p.cells = append(p.cells, cells)
+	}
+	return nil
+}
+
+func (p *tablePrinter) end() error {
+	if len(p.header) == 0 {
+		return nil
+	}
+	widths := make([]int, len(p.header))
+	for i, name := range p.header {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for _, row := range p.cells {
+		for i, cell := range row {
+			if i < len(widths) {
+				widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+			}
+		}
+	}
+
+	var b strings.Builder
+	writeLine := func(cells []string) {
+		for i, width := range widths {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			b.WriteString(cell)
+			if i < len(widths)-1 {
+				b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(cell)))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	writeLine(p.header)
+	for i, width := range widths {
+		if i > 0 {
+			b.WriteString("-+-")
+		}
+		b.WriteString(strings.Repeat("-", width))
+	}
+	b.WriteString("\n")
+	for _, row := range p.cells {
+		writeLine(row)
+	}
+	p.cells = nil
+
+	_, err := io.WriteString(p.w, b.String())
+	return err
+}
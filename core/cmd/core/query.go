@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/fluxgrid/core/pkg/client"
+)
+
+// Execution modes accepted by --mode. Auto streams on drivers that support it.
+const (
+	modeAuto    = "auto"
+	modeClassic = "classic"
+	modeStream  = "stream"
+)
+
+type queryOptions struct {
+	driver  string
+	dsn     string
+	sql     string
+	format  string
+	mode    string
+	timeout int
+	maxRows int
+}
+
+// addConnectionFlags registers the flags shared by the subcommands that open a connection.
+func addConnectionFlags(fs *flag.FlagSet, opts *queryOptions) {
+	fs.StringVar(&opts.driver, "driver", "postgres", "Database driver: postgres, mysql or sqlite")
+	fs.StringVar(&opts.dsn, "dsn", os.Getenv("FLUXGRID_DSN"), "Connection string (defaults to $FLUXGRID_DSN)")
+	fs.IntVar(&opts.timeout, "timeout", 30, "Statement timeout in seconds")
+}
+
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: core query --dsn DSN [--sql SQL | --file PATH] [flags]")
+		fmt.Fprintln(stderr, "Reads the statement from stdin when neither --sql nor --file is given.")
+		fs.PrintDefaults()
+	}
+
+	var opts queryOptions
+	var file string
+	addConnectionFlags(fs, &opts)
+	fs.StringVar(&opts.sql, "sql", "", "Statement to execute")
+	fs.StringVar(&file, "file", "", "Read the statement from a file")
+	fs.StringVar(&opts.format, "format", formatTable, "Output format: table, csv or json")
+	fs.StringVar(&opts.mode, "mode", modeAuto, "Execution mode: auto, classic or stream")
+	fs.IntVar(&opts.maxRows, "max-rows", 0, "Row limit in classic mode (0 uses the engine default)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if opts.dsn == "" {
+		fmt.Fprintln(stderr, "core query: --dsn is required")
+		return 2
+	}
+	if opts.sql == "" {
+		var (
+			data []byte
+			err  error
+		)
+		if file != "" {
+			data, err = os.ReadFile(file)
+		} else {
+			data, err = io.ReadAll(stdin)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "core query: %v\n", err)
+			return 1
+		}
+		opts.sql = string(data)
+	}
+	if strings.TrimSpace(opts.sql) == "" {
+		fmt.Fprintln(stderr, "core query: no statement given")
+		return 2
+	}
+
+	printer, err := newPrinter(opts.format, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "core query: %v\n", err)
+		return 2
+	}
+
+	c, stop, err := startEngine()
+	if err != nil {
+		fmt.Fprintf(stderr, "core query: %v\n", err)
+		return 1
+	}
+	defer stop()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	summary, err := runStatement(ctx, c, opts, printer)
+	if err != nil {
+		fmt.Fprintf(stderr, "core query: %v\n", err)
+		return 1
+	}
+	if opts.format == formatTable {
+		fmt.Fprintln(stderr, summary.text(true))
+	}
+	return 0
+}
+
+// statementSummary describes a finished statement.
+type statementSummary struct {
+	rows      int
+	returned  bool // the statement returned a result set
+	elapsedMs float64
+}
+
+// text renders the summary, for example "(3 rows, 12.4 ms)" or "OK".
+func (s statementSummary) text(timing bool) string {
+	if !s.returned {
+		if timing {
+			return fmt.Sprintf("OK (%.1f ms)", s.elapsedMs)
+		}
+		return "OK"
+	}
+	noun := "rows"
+	if s.rows == 1 {
+		noun = "row"
+	}
+	if timing {
+		return fmt.Sprintf("(%d %s, %.1f ms)", s.rows, noun, s.elapsedMs)
+	}
+	return fmt.Sprintf("(%d %s)", s.rows, noun)
+}
+
+// runStatement executes one statement and writes its rows to printer.
+func runStatement(ctx context.Context, c *client.Client, opts queryOptions, printer rowPrinter) (statementSummary, error) {
+	params := client.ExecuteParams{
+		Connection: client.Connection{Driver: opts.driver, DSN: opts.dsn},
+		SQL:        opts.sql,
+		Options: client.ExecuteOptions{
+			TimeoutSeconds: opts.timeout,
+			MaxRows:        opts.maxRows,
+		},
+	}
+
+	stream := false
+	switch opts.mode {
+	case modeAuto:
+		stream = opts.driver == "postgres"
+	case modeStream:
+		stream = true
+	case modeClassic:
+	default:
+		return statementSummary{}, fmt.Errorf("unsupported mode %q (want auto, classic or stream)", opts.mode)
+	}
+
+	if !stream {
+		result, err := c.Execute(ctx, params)
+		if err != nil {
+			return statementSummary{}, err
+		}
+		summary := statementSummary{rows: len(result.Rows), returned: len(result.Columns) > 0, elapsedMs: result.ExecutionTimeMs}
+		if !summary.returned {
+			return summary, nil
+		}
+		if err := printer.begin(result.Columns); err != nil {
+			return statementSummary{}, err
+		}
+		if err := printer.rows(result.Rows); err != nil {
+			return statementSummary{}, err
+		}
+		if err := printer.end(); err != nil {
+			return statementSummary{}, err
+		}
+		return summary, nil
+	}
+
+	s, err := c.Stream(ctx, params)
+	if err != nil {
+		return statementSummary{}, err
+	}
+	defer s.Close()
+
+	if err := printer.begin(s.Columns); err != nil {
+		return statementSummary{}, err
+	}
+	rows := 0
+	for {
+		chunk, err := s.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return statementSummary{}, err
+		}
+		rows += len(chunk.Rows)
+		if err := printer.rows(chunk.Rows); err != nil {
+			return statementSummary{}, err
+		}
+	}
+	if err := printer.end(); err != nil {
+		return statementSummary{}, err
+	}
+	summary := statementSummary{rows: rows, returned: len(s.Columns) > 0}
+	if stats := s.Stats(); stats != nil {
+		summary.elapsedMs = stats.ExecutionTimeMs
+	}
+	return summary, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/pkg/client"
+)
+
+func TestPrinters(t *testing.T) {
+	columns := []client.Column{{Name: "id"}, {Name: "note"}}
+	rows := [][]any{{float64(1), "a\nb"}, {float64(22), nil}}
+
+	cases := map[string]string{
+		formatTable: "id | note\n---+-----\n1  | a\\nb\n22 | NULL\n",
+		formatCSV:   "id,note\n1,\"a\nb\"\n22,\n",
+		formatJSON:  "[\n  {\"id\": 1, \"note\": \"a\\nb\"},\n  {\"id\": 22, \"note\": null}\n]\n",
+	}
+	for format, want := range cases {
+		var out bytes.Buffer
+		printer, err := newPrinter(format, &out)
+		if err != nil {
+			t.Fatalf("%s: newPrinter returned error: %v", format, err)
+		}
+		// Rows arrive in two batches, as they do when streaming.
+		if err := printer.begin(columns); err != nil {
+			t.Fatal(err)
+		}
+		if err := printer.rows(rows[:1]); err != nil {
+			t.Fatal(err)
+		}
+		if err := printer.rows(rows[1:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := printer.end(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("%s: expected %q, got %q", format, want, out.String())
+		}
+	}
+
+	if _, err := newPrinter("xml", &bytes.Buffer{}); err == nil {
+		t.Fatal("expected unsupported format to fail")
+	}
+}
+
+func TestRunQueryAgainstSQLite(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "query.db")
+	var stdout, stderr bytes.Buffer
+
+	code := runQuery([]string{"--driver", "sqlite", "--dsn", dsn, "--format", "csv"},
+		strings.NewReader("select 1 as a, 'x' as b"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "a,b\n1,x\n" {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = runQuery([]string{"--driver", "sqlite", "--dsn", dsn, "--sql", "select * from missing"}, nil, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "no such table") {
+		t.Fatalf("expected query error, got %d: %s", code, stderr.String())
+	}
+}
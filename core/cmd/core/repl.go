@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/fluxgrid/core/pkg/client"
+)
+
+const replHelp = `Statements end with a semicolon and may span several lines.
+  \d             list tables and views
+  \d NAME        describe a table or view (NAME or SCHEMA.NAME)
+  \dn            list schemas
+  \format FMT    switch the output format (table, csv, json)
+  \timing [on|off]  toggle execution time display
+  \?             show this help
+  \q             quit
+`
+
+// repl is the state of an interactive session.
+type repl struct {
+	client *client.Client
+	opts   queryOptions
+	timing bool
+	stdout io.Writer
+	stderr io.Writer
+	// interrupts delivers Ctrl-C; it cancels the running statement instead of exiting.
+	interrupts chan os.Signal
+}
+
+func runRepl(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("repl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: core repl --dsn DSN [flags]")
+		fs.PrintDefaults()
+	}
+
+	var opts queryOptions
+	addConnectionFlags(fs, &opts)
+	fs.StringVar(&opts.format, "format", formatTable, "Output format: table, csv or json")
+	fs.StringVar(&opts.mode, "mode", modeAuto, "Execution mode: auto, classic or stream")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.dsn == "" {
+		fmt.Fprintln(stderr, "core repl: --dsn is required")
+		return 2
+	}
+	if _, err := newPrinter(opts.format, io.Discard); err != nil {
+		fmt.Fprintf(stderr, "core repl: %v\n", err)
+		return 2
+	}
+
+	c, stop, err := startEngine()
+	if err != nil {
+		fmt.Fprintf(stderr, "core repl: %v\n", err)
+		return 1
+	}
+	defer stop()
+
+	r := &repl{
+		client:     c,
+		opts:       opts,
+		stdout:     stdout,
+		stderr:     stderr,
+		interrupts: make(chan os.Signal, 1),
+	}
+	signal.Notify(r.interrupts, os.Interrupt)
+	defer signal.Stop(r.interrupts)
+
+	fmt.Fprintf(stdout, "Connected with %s. Type \\? for help.\n", opts.driver)
+	r.loop(bufio.NewScanner(stdin))
+	return 0
+}
+
+func (r *repl) loop(scanner *bufio.Scanner) {
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+
+	var statement strings.Builder
+	for {
+		prompt := "fluxgrid=> "
+		if statement.Len() > 0 {
+			prompt = "fluxgrid-> "
+		}
+		fmt.Fprint(r.stdout, prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(r.stdout)
+			return
+		}
+		line := scanner.Text()
+
+		if statement.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, `\`) {
+				if !r.command(trimmed) {
+					return
+				}
+				continue
+			}
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(strings.TrimSpace(line), ";") {
+			r.execute(statement.String())
+			statement.Reset()
+		}
+	}
+}
+
+// command runs a backslash command and reports whether the session continues.
+func (r *repl) command(line string) bool {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case `\q`:
+		return false
+	case `\?`:
+		fmt.Fprint(r.stdout, replHelp)
+	case `\timing`:
+		switch {
+		case len(args) == 0:
+			r.timing = !r.timing
+		case args[0] == "on":
+			r.timing = true
+		case args[0] == "off":
+			r.timing = false
+		default:
+			fmt.Fprintln(r.stderr, `\timing: expected on or off`)
+			return true
+		}
+		state := "off"
+		if r.timing {
+			state = "on"
+		}
+		fmt.Fprintf(r.stdout, "Timing is %s.\n", state)
+	case `\format`:
+		if len(args) != 1 {
+			fmt.Fprintf(r.stdout, "Output format is %s.\n", r.opts.format)
+			return true
+		}
+		if _, err := newPrinter(args[0], io.Discard); err != nil {
+			fmt.Fprintf(r.stderr, `\format: %v`+"\n", err)
+			return true
+		}
+		r.opts.format = args[0]
+		fmt.Fprintf(r.stdout, "Output format is %s.\n", r.opts.format)
+	case `\d`, `\dt`:
+		if len(args) == 0 {
+			r.listTables()
+		} else {
+			r.describe(args[0])
+		}
+	case `\dn`:
+		r.listSchemas()
+	default:
+		fmt.Fprintf(r.stderr, "invalid command %s; try \\?\n", name)
+	}
+	return true
+}
+
+// withInterrupt runs fn with a context that Ctrl-C cancels.
+func (r *repl) withInterrupt(fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Drop an interrupt left over from the prompt.
+	select {
+	case <-r.interrupts:
+	default:
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.interrupts:
+			cancel()
+		case <-done:
+		}
+	}()
+	return fn(ctx)
+}
+
+func (r *repl) execute(sql string) {
+	printer, _ := newPrinter(r.opts.format, r.stdout)
+	opts := r.opts
+	opts.sql = sql
+
+	var summary statementSummary
+	err := r.withInterrupt(func(ctx context.Context) error {
+		var err error
+		summary, err = runStatement(ctx, r.client, opts, printer)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(r.stderr, "ERROR: %v\n", err)
+		return
+	}
+	if r.opts.format == formatTable || r.timing {
+		fmt.Fprintln(r.stdout, summary.text(r.timing))
+	}
+}
+
+func (r *repl) schemas(search string) ([]client.Schema, bool) {
+	var schemas []client.Schema
+	err := r.withInterrupt(func(ctx context.Context) error {
+		var err error
+		conn := client.Connection{Driver: r.opts.driver, DSN: r.opts.dsn}
+		schemas, err = r.client.ListSchemas(ctx, conn, search)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(r.stderr, "ERROR: %v\n", err)
+		return nil, false
+	}
+	return schemas, true
+}
+
+// printRows writes a small metadata listing in the current output format.
+func (r *repl) printRows(names []string, rows [][]any) {
+	printer, _ := newPrinter(r.opts.format, r.stdout)
+	columns := make([]client.Column, len(names))
+	for i, name := range names {
+		columns[i] = client.Column{Name: name}
+	}
+	err := printer.begin(columns)
+	if err == nil {
+		err = printer.rows(rows)
+	}
+	if err == nil {
+		err = printer.end()
+	}
+	if err != nil {
+		fmt.Fprintf(r.stderr, "ERROR: %v\n", err)
+	}
+}
+
+func (r *repl) listSchemas() {
+	schemas, ok := r.schemas("")
+	if !ok {
+		return
+	}
+	rows := make([][]any, len(schemas))
+	for i, s := range schemas {
+		rows[i] = []any{s.Name, len(s.Tables)}
+	}
+	r.printRows([]string{"schema", "tables"}, rows)
+}
+
+func (r *repl) listTables() {
+	schemas, ok := r.schemas("")
+	if !ok {
+		return
+	}
+	var rows [][]any
+	for _, s := range schemas {
+		for _, table := range s.Tables {
+			rows = append(rows, []any{s.Name, table.Name, table.Type})
+		}
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(r.stdout, "Did not find any relations.")
+		return
+	}
+	r.printRows([]string{"schema", "name", "type"}, rows)
+}
+
+func (r *repl) describe(name string) {
+	schemaName, tableName, qualified := strings.Cut(name, ".")
+	if !qualified {
+		schemaName, tableName = "", name
+	}
+	schemas, ok := r.schemas(tableName)
+	if !ok {
+		return
+	}
+
+	for _, s := range schemas {
+		if qualified && s.Name != schemaName {
+			continue
+		}
+		for _, table := range s.Tables {
+			if table.Name != tableName {
+				continue
+			}
+			fmt.Fprintf(r.stdout, "%s %s.%s\n", table.Type, s.Name, table.Name)
+			rows := make([][]any, len(table.Columns))
+			for i, col := range table.Columns {
+				nullable := "null"
+				if col.NotNull {
+					nullable = "not null"
+				}
+				rows[i] = []any{col.Name, col.DataType, nullable}
+			}
+			r.printRows([]string{"column", "type", "nullable"}, rows)
+			return
+		}
+	}
+	fmt.Fprintf(r.stdout, "Did not find any relation named %q.\n", name)
+}
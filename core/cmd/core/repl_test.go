@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplRunsMultiLineStatementsAndCommands(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "repl.db")
+	script := strings.Join([]string{
+		"select 1 as a,",
+		"  'x' as b;",
+		`\format csv`,
+		`\timing off`,
+		"select 2 as c;",
+		`\bogus`,
+		`\q`,
+		"select 'never run';",
+	}, "\n")
+
+	var stdout, stderr bytes.Buffer
+	code := runRepl([]string{"--driver", "sqlite", "--dsn", dsn}, strings.NewReader(script), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+
+	out := stdout.String()
+	for _, want := range []string{"fluxgrid-> a | b\n", "1 | x\n(1 row)\n", "Output format is csv.", "c\n2\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "never run") {
+		t.Errorf("expected \\q to end the session, got:\n%s", out)
+	}
+	if !strings.Contains(stderr.String(), `invalid command \bogus`) {
+		t.Errorf("expected unknown command error, got %q", stderr.String())
+	}
+}
@@ -0,0 +1,168 @@
+// Package advisor suggests Postgres indexes from the plans of statements. It looks for
+// sequential scans whose filters, or whose join keys, an index could serve, and proposes
+// one candidate index for each. Candidates are heuristics: callers weigh them against the
+// existing indexes and, where hypopg is installed, against the plans the statements get
+// with the index in place.
+package advisor
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/explain"
+)
+
+// maxIndexColumns bounds the columns of a candidate index.
+const maxIndexColumns = 3
+
+// Reasons a candidate is proposed for.
+const (
+	ReasonFilter  = "filter"
+	ReasonJoinKey = "joinKey"
+)
+
+// Candidate is an index that may help a statement.
+type Candidate struct {
+	// Table is the relation as the plan names it, without its schema.
+	Table string `json:"table"`
+	// Columns are unquoted column names, equality columns first and at most one range
+	// column last.
+	Columns []string `json:"columns"`
+	Reason  string   `json:"reason"`
+	// Condition is the filter or join condition the index would serve.
+	Condition string `json:"condition"`
+	// CostPercent is the share of the statement's estimated cost spent in the scan the
+	// index would replace: the most the index could save.
+	CostPercent float64 `json:"costPercent"`
+}
+
+var (
+	ident      = `(?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_$]*)`
+	literal    = regexp.MustCompile(`'(?:[^']|'')*'`)
+	comparison = regexp.MustCompile(`(?:^|[(\s])(?:(` + ident + `)\.)?(` + ident + `)\s*(<>|=|<=|>=|<|>|IS NULL\b)`)
+	joinKey    = regexp.MustCompile(`(` + ident + `)\.(` + ident + `)\s*=\s*(` + ident + `)\.(` + ident + `)`)
+)
+
+// joinConditions are the node properties holding join keys.
+var joinConditions = []string{"Hash Cond", "Merge Cond", "Join Filter"}
+
+// Candidates returns the indexes that could replace the sequential scans of a plan.
+func Candidates(a *explain.Analysis) []Candidate {
+	if a == nil || a.Root == nil {
+		return nil
+	}
+	var nodes []*explain.Node
+	var walk func(n *explain.Node)
+	walk = func(n *explain.Node) {
+		nodes = append(nodes, n)
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(a.Root)
+	scans := make(map[string]*explain.Node)
+	for _, n := range nodes {
+		if n.NodeType == "Seq Scan" && n.Relation != "" {
+			scans[n.Relation] = n
+			if n.Alias != "" {
+				scans[n.Alias] = n
+			}
+		}
+	}
+
+	var candidates []Candidate
+	for _, n := range nodes {
+		if n.NodeType == "Seq Scan" && n.Relation != "" {
+			if filter, ok := n.Details["Filter"].(string); ok {
+				if columns := filterColumns(filter, n); len(columns) > 0 {
+					candidates = append(candidates, Candidate{
+						Table:       n.Relation,
+						Columns:     columns,
+						Reason:      ReasonFilter,
+						Condition:   filter,
+						CostPercent: n.ExclusiveCostPercent,
+					})
+				}
+			}
+		}
+		for _, key := range joinConditions {
+			condition, ok := n.Details[key].(string)
+			if !ok {
+				continue
+			}
+			for _, m := range joinKey.FindAllStringSubmatch(literal.ReplaceAllString(condition, "''"), -1) {
+				for _, side := range [][2]string{{m[1], m[2]}, {m[3], m[4]}} {
+					scan, ok := scans[unquote(side[0])]
+					if !ok {
+						continue
+					}
+					candidates = append(candidates, Candidate{
+						Table:       scan.Relation,
+						Columns:     []string{unquote(side[1])},
+						Reason:      ReasonJoinKey,
+						Condition:   condition,
+						CostPercent: scan.ExclusiveCostPercent,
+					})
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// filterColumns returns the columns of scan compared in filter, equality columns first
+// and then the first range column. Columns qualified with another relation belong to an
+// outer query and are left out.
+func filterColumns(filter string, scan *explain.Node) []string {
+	var equal, ranged []string
+	for _, m := range comparison.FindAllStringSubmatch(literal.ReplaceAllString(filter, "''"), -1) {
+		if qualifier := unquote(m[1]); qualifier != "" && qualifier != scan.Relation && qualifier != scan.Alias {
+			continue
+		}
+		column := unquote(m[2])
+		switch m[3] {
+		case "<>":
+			// Inequality is rarely selective enough for an index.
+		case "=", "IS NULL":
+			if !slices.Contains(equal, column) {
+				equal = append(equal, column)
+			}
+		default:
+			ranged = append(ranged, column)
+		}
+	}
+	columns := equal
+	for _, column := range ranged {
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+			break
+		}
+	}
+	if len(columns) > maxIndexColumns {
+		columns = columns[:maxIndexColumns]
+	}
+	return columns
+}
+
+// Covers reports whether an index on indexColumns serves a candidate on columns: the
+// index starts with the candidate's columns, in any order.
+func Covers(indexColumns, columns []string) bool {
+	if len(indexColumns) < len(columns) {
+		return false
+	}
+	for _, column := range indexColumns[:len(columns)] {
+		if !slices.Contains(columns, column) {
+			return false
+		}
+	}
+	return true
+}
+
+// unquote returns the name a possibly quoted identifier stands for.
+func unquote(name string) string {
+	if len(name) >= 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
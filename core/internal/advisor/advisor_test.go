@@ -0,0 +1,63 @@
+package advisor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/explain"
+)
+
+const joinPlan = `[{"Plan": {
+  "Node Type": "Hash Join", "Join Type": "Inner", "Total Cost": 500, "Plan Rows": 10,
+  "Hash Cond": "(o.customer_id = c.id)",
+  "Plans": [
+    {"Node Type": "Seq Scan", "Parent Relationship": "Outer", "Relation Name": "orders", "Alias": "o",
+     "Total Cost": 400, "Plan Rows": 10,
+     "Filter": "((status = 'a = b'::text) AND (created_at > now()) AND (o.region IS NULL) AND (note <> ''::text) AND (x.other = 1))"},
+    {"Node Type": "Hash", "Parent Relationship": "Inner", "Total Cost": 50, "Plan Rows": 100,
+     "Plans": [
+       {"Node Type": "Index Scan", "Parent Relationship": "Outer", "Relation Name": "customers", "Alias": "c",
+        "Index Name": "customers_pkey", "Total Cost": 50, "Plan Rows": 100}
+     ]}
+  ]
+}}]`
+
+func TestCandidatesFromFiltersAndJoinKeys(t *testing.T) {
+	a, err := explain.Analyze(json.RawMessage(joinPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Candidates(a)
+	want := []Candidate{
+		// Only the sequentially scanned side of the join gets a candidate.
+		{Table: "orders", Columns: []string{"customer_id"}, Reason: ReasonJoinKey, Condition: "(o.customer_id = c.id)", CostPercent: 80},
+		{
+			Table:       "orders",
+			Columns:     []string{"status", "region", "created_at"},
+			Reason:      ReasonFilter,
+			Condition:   "((status = 'a = b'::text) AND (created_at > now()) AND (o.region IS NULL) AND (note <> ''::text) AND (x.other = 1))",
+			CostPercent: 80,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("candidates = %+v", got)
+	}
+}
+
+func TestCovers(t *testing.T) {
+	for _, tc := range []struct {
+		index, columns []string
+		want           bool
+	}{
+		{[]string{"status", "region"}, []string{"region", "status"}, true},
+		{[]string{"status", "region", "id"}, []string{"status"}, true},
+		{[]string{"region", "status"}, []string{"status"}, false},
+		{[]string{"status"}, []string{"status", "region"}, false},
+		{[]string{""}, []string{"status"}, false},
+	} {
+		if got := Covers(tc.index, tc.columns); got != tc.want {
+			t.Errorf("Covers(%v, %v) = %v", tc.index, tc.columns, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package charset turns text that database/sql drivers return as bytes into UTF-8, decoding
+// legacy character sets such as MySQL's latin1 or sjis.
+package charset
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Raw is the pseudo charset that leaves bytes undecoded, rendering them as hex.
+const Raw = "raw"
+
+// mysqlCharsets maps MySQL character set names to their encodings. MySQL's latin1 is
+// Windows-1252 rather than ISO-8859-1.
+var mysqlCharsets = map[string]encoding.Encoding{
+	"latin1":   charmap.Windows1252,
+	"latin2":   charmap.ISO8859_2,
+	"latin5":   charmap.ISO8859_9,
+	"latin7":   charmap.ISO8859_13,
+	"cp1250":   charmap.Windows1250,
+	"cp1251":   charmap.Windows1251,
+	"cp1256":   charmap.Windows1256,
+	"cp1257":   charmap.Windows1257,
+	"cp850":    charmap.CodePage850,
+	"cp852":    charmap.CodePage852,
+	"cp866":    charmap.CodePage866,
+	"greek":    charmap.ISO8859_7,
+	"hebrew":   charmap.ISO8859_8,
+	"koi8r":    charmap.KOI8R,
+	"koi8u":    charmap.KOI8U,
+	"macroman": charmap.Macintosh,
+	"sjis":     japanese.ShiftJIS,
+	"cp932":    japanese.ShiftJIS,
+	"ujis":     japanese.EUCJP,
+	"eucjpms":  japanese.EUCJP,
+	"euckr":    korean.EUCKR,
+	"gb2312":   simplifiedchinese.GBK,
+	"gbk":      simplifiedchinese.GBK,
+	"gb18030":  simplifiedchinese.GB18030,
+	"big5":     traditionalchinese.Big5,
+}
+
+var utf8Charsets = map[string]bool{"utf8": true, "utf8mb3": true, "utf8mb4": true, "utf-8": true, "ascii": true}
+
+// Decoder decodes the text of one character set.
+type Decoder struct {
+	Name string
+	enc  encoding.Encoding
+	raw  bool
+}
+
+// Lookup returns the decoder for a MySQL character set name or a WHATWG encoding label.
+func Lookup(name string) (Decoder, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case key == Raw:
+		return Decoder{Name: Raw, raw: true}, nil
+	case utf8Charsets[key]:
+		return Decoder{Name: "utf8"}, nil
+	}
+	if enc, ok := mysqlCharsets[key]; ok {
+		return Decoder{Name: key, enc: enc}, nil
+	}
+	enc, err := htmlindex.Get(key)
+	if err != nil {
+		return Decoder{}, fmt.Errorf("unknown character set %q", name)
+	}
+	if enc == encoding.Nop || enc == encoding.Replacement {
+		return Decoder{}, fmt.Errorf("unsupported character set %q", name)
+	}
+	if canonical, err := htmlindex.Name(enc); err == nil && canonical == "utf-8" {
+		return Decoder{Name: "utf8"}, nil
+	}
+	return Decoder{Name: key, enc: enc}, nil
+}
+
+// UTF8 reports whether the decoder expects UTF-8, which it leaves as it is.
+func (d Decoder) UTF8() bool {
+	return d.enc == nil && !d.raw
+}
+
+// Decode returns b as UTF-8 text. Lossy reports bytes that had no character in the
+// charset and were replaced with U+FFFD. A raw decoder renders b as hex.
+func (d Decoder) Decode(b []byte) (text string, lossy bool) {
+	switch {
+	case d.raw:
+		return Hex(b), false
+	case d.enc == nil:
+		if utf8.Valid(b) {
+			return string(b), false
+		}
+		return strings.ToValidUTF8(string(b), "\uFFFD"), true
+	}
+	decoded, err := d.enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return strings.ToValidUTF8(string(b), "\uFFFD"), true
+	}
+	return string(decoded), strings.ContainsRune(string(decoded), utf8.RuneError)
+}
+
+// Hex renders bytes the way Postgres prints bytea.
+func Hex(b []byte) string {
+	return `\x` + hex.EncodeToString(b)
+}
@@ -0,0 +1,43 @@
+package charset
+
+import "testing"
+
+func TestDecodeLegacyCharsets(t *testing.T) {
+	cases := []struct {
+		charset string
+		in      []byte
+		want    string
+		lossy   bool
+	}{
+		{"latin1", []byte("caf\xe9 \x80"), "café €", false},
+		{"LATIN1", []byte("na\xefve"), "naïve", false},
+		{"sjis", []byte("\x93\xfa\x96\x7b"), "日本", false},
+		{"euc-jp", []byte("\xc6\xfc\xcb\xdc"), "日本", false},
+		{"koi8r", []byte("\xd0\xd2\xc9\xd7\xc5\xd4"), "привет", false},
+		{"utf8mb4", []byte("ok"), "ok", false},
+		{"utf8mb4", []byte("bad \xff"), "bad \uFFFD", true},
+		{"sjis", []byte("\x93"), "\uFFFD", true},
+		{"raw", []byte("\x00\xff"), `\x00ff`, false},
+	}
+	for _, tc := range cases {
+		decoder, err := Lookup(tc.charset)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.charset, err)
+		}
+		got, lossy := decoder.Decode(tc.in)
+		if got != tc.want || lossy != tc.lossy {
+			t.Errorf("%s %q: got %q lossy=%v, want %q lossy=%v", tc.charset, tc.in, got, lossy, tc.want, tc.lossy)
+		}
+	}
+}
+
+func TestLookupRejectsUnknownCharsets(t *testing.T) {
+	for _, name := range []string{"klingon", "replacement"} {
+		if _, err := Lookup(name); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if d, err := Lookup("UTF-8"); err != nil || !d.UTF8() {
+		t.Errorf("UTF-8: got %+v, %v", d, err)
+	}
+}
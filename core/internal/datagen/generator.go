@@ -0,0 +1,322 @@
+package datagen
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ColumnSpec describes a target column and the constraints generated values must honour.
+type ColumnSpec struct {
+	Name       string   `json:"name"`
+	DataType   string   `json:"dataType"`
+	BaseType   string   `json:"baseType"`
+	NotNull    bool     `json:"notNull"`
+	HasDefault bool     `json:"hasDefault"`
+	Unique     bool     `json:"unique"`
+	MaxLength  int      `json:"maxLength,omitempty"`
+	EnumValues []string `json:"enumValues,omitempty"`
+	// Reference holds the referenced column when the column is part of a single-column foreign key.
+	Reference *Reference `json:"reference,omitempty"`
+	// UniqueStart is the first value used for unique integer columns, typically MAX(column)+1.
+	UniqueStart int64 `json:"-"`
+}
+
+// Reference identifies the parent column of a foreign key together with sampled parent values.
+type Reference struct {
+	Schema string   `json:"schema"`
+	Table  string   `json:"table"`
+	Column string   `json:"column"`
+	Values []string `json:"-"`
+}
+
+// Generator produces pseudo-realistic rows. Generators created with the same seed yield identical output.
+type Generator struct {
+	rng             *rand.Rand
+	nullProbability float64
+	epoch           time.Time
+}
+
+// NewGenerator constructs a generator. nullProbability controls how often nullable columns receive NULL.
+func NewGenerator(seed int64, nullProbability float64) *Generator {
+	if nullProbability < 0 {
+		nullProbability = 0
+	}
+	if nullProbability > 1 {
+		nullProbability = 1
+	}
+	return &Generator{
+		rng:             rand.New(rand.NewSource(seed)),
+		nullProbability: nullProbability,
+		epoch:           time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// Insertable returns the columns that should receive generated values; columns backed by a
+// default, identity, or generated expression are left to the database.
+func Insertable(columns []ColumnSpec) []ColumnSpec {
+	out := make([]ColumnSpec, 0, len(columns))
+	for _, col := range columns {
+		if col.HasDefault {
+			continue
+		}
+		out = append(out, col)
+	}
+	return out
+}
+
+// Rows generates count rows for the provided columns. Row values are ordered like columns.
+func (g *Generator) Rows(columns []ColumnSpec, count int) ([][]any, error) {
+	for _, col := range columns {
+		if col.Reference != nil && len(col.Reference.Values) == 0 && col.NotNull {
+			return nil, fmt.Errorf(
+				"column %s references %s.%s which has no rows",
+				col.Name, col.Reference.Schema, col.Reference.Table,
+			)
+		}
+	}
+
+	rows := make([][]any, count)
+	for i := range rows {
+		row := make([]any, len(columns))
+		for j, col := range columns {
+			row[j] = g.Value(col, i)
+		}
+		rows[i] = row
+	}
+	return rows, nil
+}
+
+// Value generates a single value for the column. seq is the zero-based row number and is used to
+// keep unique columns collision free.
+func (g *Generator) Value(col ColumnSpec, seq int) any {
+	if !col.NotNull && !col.Unique && g.rng.Float64() < g.nullProbability {
+		return nil
+	}
+
+	if col.Reference != nil {
+		if len(col.Reference.Values) == 0 {
+			return nil
+		}
+		return col.Reference.Values[g.rng.Intn(len(col.Reference.Values))]
+	}
+
+	if len(col.EnumValues) > 0 {
+		return col.EnumValues[g.rng.Intn(len(col.EnumValues))]
+	}
+
+	switch baseType(col) {
+	case "int2":
+		if col.Unique {
+			return col.UniqueStart + int64(seq)
+		}
+		return int64(g.rng.Intn(1000))
+	case "int4", "int8", "integer", "int", "bigint", "smallint", "mediumint", "tinyint":
+		if col.Unique {
+			return col.UniqueStart + int64(seq)
+		}
+		return g.integerFor(col.Name)
+	case "numeric", "decimal", "money":
+		return float64(g.rng.Intn(1000000)) / 100
+	case "float4", "float8", "real", "double", "float":
+		return g.rng.Float64() * 1000
+	case "bool", "boolean":
+		return g.rng.Intn(2) == 1
+	case "date":
+		return g.timestamp().Format("2006-01-02")
+	case "timestamp", "timestamptz", "datetime":
+		return g.timestamp()
+	case "time", "timetz":
+		return fmt.Sprintf("%02d:%02d:%02d", g.rng.Intn(24), g.rng.Intn(60), g.rng.Intn(60))
+	case "uuid":
+		return g.uuid()
+	case "json", "jsonb":
+		return fmt.Sprintf(`{"id":%d,"label":%q}`, seq+1, g.pick(nouns))
+	case "bytea", "blob":
+		buf := make([]byte, 8)
+		g.rng.Read(buf)
+		return buf
+	default:
+		return g.text(col, seq)
+	}
+}
+
+func baseType(col ColumnSpec) string {
+	if col.BaseType != "" {
+		return strings.ToLower(col.BaseType)
+	}
+	dataType := strings.ToLower(col.DataType)
+	if idx := strings.IndexAny(dataType, "( "); idx >= 0 {
+		dataType = dataType[:idx]
+	}
+	return dataType
+}
+
+// integerFor picks a range from the words of the column name, so that "page_views" or
+// "account_id" are not taken for an age or a count.
+func (g *Generator) integerFor(name string) int64 {
+	words := nameWords(name)
+	switch {
+	case hasWord(words, "age"):
+		return int64(18 + g.rng.Intn(60))
+	case hasWord(words, "year"):
+		return int64(1990 + g.rng.Intn(35))
+	case hasWord(words, "qty", "quantity", "count"):
+		return int64(1 + g.rng.Intn(50))
+	default:
+		return int64(g.rng.Intn(100000))
+	}
+}
+
+// nameWords splits a column name into its lower-case words, separated by underscores or
+// other punctuation, or by a change of case as in "userEmail" or "HTTPStatus".
+func nameWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				words = append(words, string(word))
+				word = word[:0]
+			}
+		}
+		word = append(word, unicode.ToLower(r))
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+func hasWord(words []string, candidates ...string) bool {
+	for _, word := range words {
+		if slices.Contains(candidates, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Generator) timestamp() time.Time {
+	offset := time.Duration(g.rng.Int63n(int64(5 * 365 * 24 * time.Hour)))
+	return g.epoch.Add(offset).Truncate(time.Second)
+}
+
+func (g *Generator) uuid() string {
+	var b [16]byte
+	g.rng.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (g *Generator) pick(words []string) string {
+	return words[g.rng.Intn(len(words))]
+}
+
+// text picks a kind of value from the words of the column name, so that "userEmail" and
+// "user_email" get the same values and "capacity" is not taken for a city.
+func (g *Generator) text(col ColumnSpec, seq int) string {
+	words := nameWords(col.Name)
+	named := hasWord(words, "name")
+	first, last := g.pick(firstNames), g.pick(lastNames)
+
+	var value string
+	switch {
+	case hasWord(words, "email"):
+		local := strings.ToLower(first + "." + last)
+		if col.Unique {
+			local += strconv.Itoa(seq + 1)
+		}
+		return truncate(local+"@"+g.pick(domains), col.MaxLength)
+	case hasWord(words, "firstname") || named && hasWord(words, "first"):
+		value = first
+	case hasWord(words, "lastname", "surname") || named && hasWord(words, "last"):
+		value = last
+	case hasWord(words, "username", "login") || named && hasWord(words, "user"):
+		value = strings.ToLower(first[:1] + last)
+	case slices.Equal(words, []string{"name"}), hasWord(words, "fullname") || named && hasWord(words, "full"):
+		value = first + " " + last
+	case hasWord(words, "phone", "telephone", "mobile"):
+		value = fmt.Sprintf("+1-555-%03d-%04d", g.rng.Intn(1000), g.rng.Intn(10000))
+	case hasWord(words, "city"):
+		value = g.pick(cities)
+	case hasWord(words, "country"):
+		value = g.pick(countries)
+	case hasWord(words, "address", "street"):
+		value = fmt.Sprintf("%d %s St", 1+g.rng.Intn(9999), g.pick(lastNames))
+	case hasWord(words, "zip", "zipcode", "postal", "postcode"):
+		value = fmt.Sprintf("%05d", g.rng.Intn(100000))
+	case hasWord(words, "company", "organization"):
+		value = g.pick(lastNames) + " " + g.pick(companySuffixes)
+	case hasWord(words, "url", "website"):
+		value = "https://www." + g.pick(domains) + "/" + strings.ToLower(g.pick(nouns))
+	case hasWord(words, "description", "comment", "comments", "note", "notes", "body"):
+		value = g.sentence(8)
+	case hasWord(words, "title", "subject"):
+		value = g.sentence(3)
+	case hasWord(words, "status"):
+		value = g.pick(statuses)
+	default:
+		value = g.pick(nouns)
+	}
+
+	if col.Unique {
+		suffix := "-" + strconv.Itoa(seq+1)
+		if col.MaxLength > 0 && len(value)+len(suffix) > col.MaxLength {
+			value = truncate(value, col.MaxLength-len(suffix))
+		}
+		return value + suffix
+	}
+	return truncate(value, col.MaxLength)
+}
+
+func (g *Generator) sentence(words int) string {
+	parts := make([]string, words)
+	for i := range parts {
+		parts[i] = strings.ToLower(g.pick(nouns))
+	}
+	parts[0] = strings.ToUpper(parts[0][:1]) + parts[0][1:]
+	return strings.Join(parts, " ") + "."
+}
+
+func truncate(value string, maxLength int) string {
+	if maxLength <= 0 || len(value) <= maxLength {
+		return value
+	}
+	return value[:maxLength]
+}
+
+var (
+	firstNames = []string{
+		"Alice", "Bob", "Carol", "David", "Emma", "Frank", "Grace", "Hiro", "Isabel", "James",
+		"Kenji", "Laura", "Miguel", "Nora", "Oliver", "Priya", "Quinn", "Rosa", "Sam", "Yuki",
+	}
+	lastNames = []string{
+		"Anderson", "Brown", "Chen", "Davis", "Garcia", "Hernandez", "Ito", "Johnson", "Kim", "Lee",
+		"Martin", "Nakamura", "Patel", "Rossi", "Smith", "Suzuki", "Taylor", "Walker", "Wilson", "Young",
+	}
+	domains         = []string{"example.com", "example.org", "example.net", "mail.test"}
+	cities          = []string{"Tokyo", "Osaka", "Berlin", "Paris", "London", "Toronto", "Austin", "Sydney", "Seoul", "Madrid"}
+	countries       = []string{"Japan", "Germany", "France", "United Kingdom", "Canada", "United States", "Australia", "Korea", "Spain"}
+	companySuffixes = []string{"Inc", "LLC", "Group", "Labs", "Systems", "Holdings"}
+	statuses        = []string{"active", "inactive", "pending", "archived"}
+	nouns           = []string{
+		"Apple", "Bridge", "Cloud", "Delta", "Engine", "Forest", "Garden", "Harbor", "Island", "Journey",
+		"Kernel", "Lantern", "Meadow", "Nebula", "Orbit", "Pixel", "Quartz", "River", "Signal", "Tower",
+	}
+)
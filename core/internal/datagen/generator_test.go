@@ -0,0 +1,164 @@
+package datagen
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGeneratorDeterministicWithSeed(t *testing.T) {
+	columns := []ColumnSpec{
+		{Name: "email", DataType: "text", BaseType: "text", NotNull: true},
+		{Name: "age", DataType: "integer", BaseType: "int4"},
+		{Name: "created_at", DataType: "timestamp with time zone", BaseType: "timestamptz", NotNull: true},
+	}
+
+	first, err := NewGenerator(42, 0.2).Rows(columns, 25)
+	if err != nil {
+		t.Fatalf("Rows returned error: %v", err)
+	}
+	second, err := NewGenerator(42, 0.2).Rows(columns, 25)
+	if err != nil {
+		t.Fatalf("Rows returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Fatal("expected identical rows for identical seeds")
+	}
+}
+
+func TestGeneratorRespectsConstraints(t *testing.T) {
+	columns := []ColumnSpec{
+		{Name: "id", DataType: "bigint", BaseType: "int8", NotNull: true, Unique: true, UniqueStart: 10},
+		{Name: "email", DataType: "character varying(40)", BaseType: "varchar", NotNull: true, Unique: true, MaxLength: 40},
+		{Name: "code", DataType: "character varying(5)", BaseType: "varchar", NotNull: true, MaxLength: 5},
+		{Name: "mood", DataType: "mood", BaseType: "mood", NotNull: true, EnumValues: []string{"happy", "sad"}},
+		{
+			Name: "customer_id", DataType: "integer", BaseType: "int4", NotNull: true,
+			Reference: &Reference{Schema: "public", Table: "customers", Column: "id", Values: []string{"7", "8"}},
+		},
+	}
+
+	rows, err := NewGenerator(1, 1).Rows(columns, 50)
+	if err != nil {
+		t.Fatalf("Rows returned error: %v", err)
+	}
+
+	emails := make(map[string]bool)
+	for i, row := range rows {
+		if row[0] != int64(10+i) {
+			t.Fatalf("expected sequential unique id %d, got %#v", 10+i, row[0])
+		}
+		email := row[1].(string)
+		if emails[email] {
+			t.Fatalf("duplicate email %q", email)
+		}
+		emails[email] = true
+		if !strings.Contains(email, "@") || len(email) > 40 {
+			t.Fatalf("unexpected email %q", email)
+		}
+		if code := row[2].(string); len(code) > 5 {
+			t.Fatalf("expected code to be truncated to 5 chars, got %q", code)
+		}
+		if mood := row[3]; mood != "happy" && mood != "sad" {
+			t.Fatalf("unexpected enum value %#v", mood)
+		}
+		if ref := row[4]; ref != "7" && ref != "8" {
+			t.Fatalf("unexpected foreign key value %#v", ref)
+		}
+	}
+}
+
+func TestGeneratorMatchesWholeWordsOfNames(t *testing.T) {
+	ranges := map[string][2]int64{
+		"age":          {18, 77},
+		"user_age":     {18, 77},
+		"userAge":      {18, 77},
+		"birth_year":   {1990, 2024},
+		"BirthYear":    {1990, 2024},
+		"item_count":   {1, 50},
+		"itemCount":    {1, 50},
+		"order-qty":    {1, 50},
+		"account_id":   {0, 99999},
+		"accountID":    {0, 99999},
+		"discount":     {0, 99999},
+		"page_views":   {0, 99999},
+		"pageViews":    {0, 99999},
+		"percentage":   {0, 99999},
+		"yearly_limit": {0, 99999},
+		"createdAt":    {0, 99999},
+	}
+	g := NewGenerator(7, 0)
+	for name, bounds := range ranges {
+		var largest int64
+		for i := 0; i < 200; i++ {
+			value := g.integerFor(name)
+			if value < bounds[0] || value > bounds[1] {
+				t.Fatalf("%s: %d is outside [%d, %d]", name, value, bounds[0], bounds[1])
+			}
+			largest = max(largest, value)
+		}
+		// Names without a known word get the default range, wider than any of the others.
+		if bounds[1] == 99999 && largest <= 2024 {
+			t.Fatalf("%s: got a narrow range, up to %d", name, largest)
+		}
+	}
+}
+
+func TestGeneratorPicksTextByWordsOfNames(t *testing.T) {
+	for name, want := range map[string][]string{
+		"user_email":  {"user", "email"},
+		"userEmail":   {"user", "email"},
+		"HTTPStatus":  {"http", "status"},
+		"accountID":   {"account", "id"},
+		"address2Zip": {"address2", "zip"},
+	} {
+		if got := nameWords(name); !slices.Equal(got, want) {
+			t.Fatalf("nameWords(%q) = %q, want %q", name, got, want)
+		}
+	}
+
+	g := NewGenerator(7, 0)
+	for name, check := range map[string]func(string) bool{
+		"user_email":   func(v string) bool { return strings.Contains(v, "@") },
+		"userEmail":    func(v string) bool { return strings.Contains(v, "@") },
+		"first_name":   func(v string) bool { return slices.Contains(firstNames, v) },
+		"firstName":    func(v string) bool { return slices.Contains(firstNames, v) },
+		"LastName":     func(v string) bool { return slices.Contains(lastNames, v) },
+		"phoneNumber":  func(v string) bool { return strings.HasPrefix(v, "+1-555-") },
+		"order_status": func(v string) bool { return slices.Contains(statuses, v) },
+		"orderStatus":  func(v string) bool { return slices.Contains(statuses, v) },
+		"capacity":     func(v string) bool { return slices.Contains(nouns, v) },
+		"renamed":      func(v string) bool { return slices.Contains(nouns, v) },
+	} {
+		if value := g.text(ColumnSpec{Name: name}, 0); !check(value) {
+			t.Fatalf("%s: unexpected value %q", name, value)
+		}
+	}
+}
+
+func TestGeneratorMissingParentRows(t *testing.T) {
+	columns := []ColumnSpec{
+		{
+			Name: "customer_id", DataType: "integer", BaseType: "int4", NotNull: true,
+			Reference: &Reference{Schema: "public", Table: "customers", Column: "id"},
+		},
+	}
+
+	if _, err := NewGenerator(1, 0).Rows(columns, 1); err == nil {
+		t.Fatal("expected error when referenced table is empty")
+	}
+}
+
+func TestInsertableSkipsDefaults(t *testing.T) {
+	columns := []ColumnSpec{
+		{Name: "id", HasDefault: true},
+		{Name: "name"},
+	}
+
+	insertable := Insertable(columns)
+	if len(insertable) != 1 || insertable[0].Name != "name" {
+		t.Fatalf("unexpected insertable columns %+v", insertable)
+	}
+}
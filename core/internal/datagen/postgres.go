@@ -0,0 +1,273 @@
+package datagen
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// referenceSampleSize bounds the number of parent keys loaded per foreign key.
+const referenceSampleSize = 1000
+
+// postgresService implements data generation backed by pg_catalog metadata.
+type postgresService struct{}
+
+// NewPostgresService constructs a generator service for PostgreSQL.
+func NewPostgresService() Service {
+	return &postgresService{}
+}
+
+const columnsQuery = `
+SELECT DISTINCT ON (a.attnum)
+  a.attname AS column_name,
+  pg_catalog.format_type(a.atttypid, a.atttypmod) AS data_type,
+  t.typname AS base_type,
+  a.attnotnull AS not_null,
+  (a.atthasdef OR a.attidentity <> '' OR a.attgenerated <> '') AS has_default,
+  EXISTS (
+    SELECT 1 FROM pg_catalog.pg_index i
+    WHERE i.indrelid = c.oid AND i.indisunique AND i.indnatts = 1 AND i.indkey[0] = a.attnum
+  ) AS is_unique,
+  CASE WHEN t.typname IN ('varchar', 'bpchar') AND a.atttypmod > 4 THEN a.atttypmod - 4 ELSE 0 END AS max_length,
+  ARRAY(
+    SELECT e.enumlabel::text FROM pg_catalog.pg_enum e
+    WHERE e.enumtypid = a.atttypid ORDER BY e.enumsortorder
+  ) AS enum_values,
+  fn.nspname AS ref_schema,
+  fc.relname AS ref_table,
+  fa.attname AS ref_column
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+LEFT JOIN pg_catalog.pg_constraint fk
+  ON fk.conrelid = c.oid
+  AND fk.contype = 'f'
+  AND array_length(fk.conkey, 1) = 1
+  AND fk.conkey[1] = a.attnum
+LEFT JOIN pg_catalog.pg_class fc ON fc.oid = fk.confrelid
+LEFT JOIN pg_catalog.pg_namespace fn ON fn.oid = fc.relnamespace
+LEFT JOIN pg_catalog.pg_attribute fa ON fa.attrelid = fk.confrelid AND fa.attnum = fk.confkey[1]
+WHERE n.nspname = $1
+  AND c.relname = $2
+  AND c.relkind IN ('r', 'p')
+  AND a.attnum > 0
+  AND NOT a.attisdropped
+ORDER BY a.attnum;
+`
+
+func (postgresService) Columns(ctx context.Context, conn Conn, table TableRef) ([]ColumnSpec, error) {
+	rows, err := conn.Query(ctx, columnsQuery, table.Schema, table.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []ColumnSpec
+	for rows.Next() {
+		var (
+			col        ColumnSpec
+			enumValues []string
+			refSchema  pgtype.Text
+			refTable   pgtype.Text
+			refColumn  pgtype.Text
+			maxLength  int32
+		)
+		if err := rows.Scan(
+			&col.Name, &col.DataType, &col.BaseType, &col.NotNull, &col.HasDefault, &col.Unique,
+			&maxLength, &enumValues, &refSchema, &refTable, &refColumn,
+		); err != nil {
+			return nil, err
+		}
+		col.MaxLength = int(maxLength)
+		col.EnumValues = enumValues
+		if refTable.Valid && refColumn.Valid {
+			col.Reference = &Reference{
+				Schema: refSchema.String,
+				Table:  refTable.String,
+				Column: refColumn.String,
+			}
+		}
+		columns = append(columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(columns) == 0 {
+		return nil, ErrTableNotFound
+	}
+
+	for i := range columns {
+		col := &columns[i]
+		if col.HasDefault {
+			continue
+		}
+		if col.Reference != nil {
+			values, err := sampleReference(ctx, conn, *col.Reference)
+			if err != nil {
+				return nil, fmt.Errorf("load references for %s: %w", col.Name, err)
+			}
+			col.Reference.Values = values
+			continue
+		}
+		if col.Unique && isIntegerType(col.BaseType) {
+			start, err := nextUniqueInteger(ctx, conn, table, col.Name)
+			if err != nil {
+				return nil, fmt.Errorf("load max value for %s: %w", col.Name, err)
+			}
+			col.UniqueStart = start
+		}
+	}
+
+	return columns, nil
+}
+
+func sampleReference(ctx context.Context, conn Conn, ref Reference) ([]string, error) {
+	column := pgx.Identifier{ref.Column}.Sanitize()
+	sql := fmt.Sprintf(
+		"SELECT DISTINCT %s::text FROM %s WHERE %s IS NOT NULL LIMIT %d",
+		column, pgx.Identifier{ref.Schema, ref.Table}.Sanitize(), column, referenceSampleSize,
+	)
+	rows, err := conn.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+func nextUniqueInteger(ctx context.Context, conn Conn, table TableRef, column string) (int64, error) {
+	sql := fmt.Sprintf(
+		"SELECT COALESCE(MAX(%s), 0)::bigint + 1 FROM %s",
+		pgx.Identifier{column}.Sanitize(), pgx.Identifier{table.Schema, table.Name}.Sanitize(),
+	)
+	rows, err := conn.Query(ctx, sql)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var next int64 = 1
+	if rows.Next() {
+		if err := rows.Scan(&next); err != nil {
+			return 0, err
+		}
+	}
+	return next, rows.Err()
+}
+
+func isIntegerType(typeName string) bool {
+	switch typeName {
+	case "int2", "int4", "int8":
+		return true
+	default:
+		return false
+	}
+}
+
+// Insert writes the rows inside a single transaction using multi-row INSERT statements. Values are
+// bound as text and cast to the column type so enums, domains, and arrays accept them unchanged.
+func (postgresService) Insert(ctx context.Context, conn Conn, req InsertRequest) (int64, error) {
+	if len(req.Columns) == 0 || len(req.Rows) == 0 {
+		return 0, nil
+	}
+
+	batchSize := req.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	// PostgreSQL limits a statement to 65535 bind parameters.
+	if maxBatch := 65535 / len(req.Columns); batchSize > maxBatch {
+		batchSize = maxBatch
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.Background()) //nolint:errcheck
+
+	names := make([]string, len(req.Columns))
+	for i, col := range req.Columns {
+		names[i] = pgx.Identifier{col.Name}.Sanitize()
+	}
+	prefix := fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES ",
+		pgx.Identifier{req.Table.Schema, req.Table.Name}.Sanitize(), strings.Join(names, ", "),
+	)
+
+	var inserted int64
+	for start := 0; start < len(req.Rows); start += batchSize {
+		end := start + batchSize
+		if end > len(req.Rows) {
+			end = len(req.Rows)
+		}
+
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		args := make([]any, 0, (end-start)*len(req.Columns))
+		for i, row := range req.Rows[start:end] {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteByte('(')
+			for j, value := range row {
+				if j > 0 {
+					sb.WriteString(", ")
+				}
+				args = append(args, textValue(value))
+				fmt.Fprintf(&sb, "$%d::text::%s", len(args), req.Columns[j].DataType)
+			}
+			sb.WriteByte(')')
+		}
+
+		tag, err := tx.Exec(ctx, sb.String(), args...)
+		if err != nil {
+			return 0, err
+		}
+		inserted += tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+func textValue(value any) any {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
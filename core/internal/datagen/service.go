@@ -0,0 +1,44 @@
+package datagen
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Conn models the subset of pgx connection behaviour used by the generator service.
+type Conn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// TableRef identifies the table that receives generated rows.
+type TableRef struct {
+	Schema string
+	Name   string
+}
+
+// InsertRequest carries generated rows to be written to the target table.
+type InsertRequest struct {
+	Table     TableRef
+	Columns   []ColumnSpec
+	Rows      [][]any
+	BatchSize int
+}
+
+// Service describes the database operations needed to generate data.
+type Service interface {
+	Columns(ctx context.Context, conn Conn, table TableRef) ([]ColumnSpec, error)
+	Insert(ctx context.Context, conn Conn, req InsertRequest) (int64, error)
+}
+
+var (
+	// ErrTableNotFound signals that the target table does not exist.
+	ErrTableNotFound = errors.New("table not found")
+)
+
+// Ensure interfaces compile.
+var _ Service = (*postgresService)(nil)
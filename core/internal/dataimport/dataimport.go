@@ -0,0 +1,302 @@
+// Package dataimport reads pasted CSV or JSON into rows ready to insert into a table,
+// inferring a kind for every column from the values it holds.
+package dataimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Column kinds, from the narrowest. A column takes the narrowest kind all of its values
+// fit; columns holding nothing but nulls are text.
+const (
+	KindBoolean = "boolean"
+	KindInteger = "integer"
+	KindReal    = "real"
+	KindText    = "text"
+)
+
+// Options control how data is read.
+type Options struct {
+	// NoHeader reads the first CSV record as data; columns are then named column1,
+	// column2 and so on.
+	NoHeader bool
+	// Delimiter separates CSV fields; it defaults to a comma.
+	Delimiter string
+}
+
+// Table is the data read, with values converted to the kind of their column.
+type Table struct {
+	Columns []string
+	Kinds   []string
+	Rows    [][]any
+}
+
+// Parse reads CSV, or JSON holding an array of objects.
+func Parse(format string, data []byte, opts Options) (Table, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data, opts)
+	case FormatJSON:
+		return parseJSON(data)
+	default:
+		return Table{}, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func parseCSV(data []byte, opts Options) (Table, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	if opts.Delimiter != "" {
+		r, size := utf8.DecodeRuneInString(opts.Delimiter)
+		if size != len(opts.Delimiter) {
+			return Table{}, fmt.Errorf("the delimiter must be one character: %q", opts.Delimiter)
+		}
+		reader.Comma = r
+	}
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Table{}, err
+	}
+	if len(records) == 0 {
+		return Table{}, errors.New("no data")
+	}
+	var columns []string
+	if opts.NoHeader {
+		for i := range records[0] {
+			columns = append(columns, "column"+strconv.Itoa(i+1))
+		}
+	} else {
+		columns, records = uniqueNames(records[0]), records[1:]
+	}
+	raw := make([][]any, len(records))
+	for i, record := range records {
+		if len(record) != len(columns) {
+			return Table{}, fmt.Errorf("record %d has %d fields, expected %d", i+1, len(record), len(columns))
+		}
+		row := make([]any, len(record))
+		for j, field := range record {
+			// Empty fields are nulls, as CSV has no other way to write one.
+			if field != "" {
+				row[j] = field
+			}
+		}
+		raw[i] = row
+	}
+	return typed(columns, raw, true), nil
+}
+
+func parseJSON(data []byte) (Table, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var objects []map[string]any
+	if err := decoder.Decode(&objects); err != nil {
+		return Table{}, fmt.Errorf("expected an array of objects: %w", err)
+	}
+	if len(objects) == 0 {
+		return Table{}, errors.New("no data")
+	}
+	// Columns are the keys in the order they first appear, which needs the raw text as
+	// maps do not keep it.
+	columns, err := keysInOrder(data)
+	if err != nil {
+		return Table{}, err
+	}
+	raw := make([][]any, len(objects))
+	for i, object := range objects {
+		row := make([]any, len(columns))
+		for j, column := range columns {
+			switch v := object[column].(type) {
+			case nil:
+			case map[string]any, []any:
+				encoded, _ := json.Marshal(v)
+				row[j] = string(encoded)
+			default:
+				row[j] = v
+			}
+		}
+		raw[i] = row
+	}
+	return typed(columns, raw, false), nil
+}
+
+func keysInOrder(data []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var columns []string
+	seen := map[string]bool{}
+	depth := 0
+	expectKey := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return columns, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{', '[':
+				depth++
+				expectKey = t == '{' && depth == 2
+			case '}', ']':
+				// A nested value closed inside a row object is followed by a key.
+				depth--
+				expectKey = depth == 2
+			}
+			continue
+		case string:
+			if expectKey {
+				if !seen[t] {
+					seen[t] = true
+					columns = append(columns, t)
+				}
+				expectKey = false
+				continue
+			}
+		}
+		// After a value at object level the next token is a key again.
+		expectKey = depth == 2
+	}
+}
+
+func uniqueNames(names []string) []string {
+	out := make([]string, len(names))
+	seen := map[string]int{}
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = "column" + strconv.Itoa(i+1)
+		}
+		if n := seen[name]; n > 0 {
+			seen[name] = n + 1
+			name += "_" + strconv.Itoa(n+1)
+		} else {
+			seen[name] = 1
+		}
+		out[i] = name
+	}
+	return out
+}
+
+// typed infers the kind of each column and converts its values to it. Strings are read
+// as numbers or booleans only when fromText is set, as in CSV, which has no other types.
+func typed(columns []string, rows [][]any, fromText bool) Table {
+	kinds := make([]string, len(columns))
+	for j := range columns {
+		kind := ""
+		for _, row := range rows {
+			if row[j] != nil {
+				kind = wider(kind, kindOf(row[j], fromText))
+			}
+		}
+		if kind == "" {
+			kind = KindText
+		}
+		kinds[j] = kind
+		for _, row := range rows {
+			if row[j] != nil {
+				row[j] = convert(row[j], kind)
+			}
+		}
+	}
+	return Table{Columns: columns, Kinds: kinds, Rows: rows}
+}
+
+func kindOf(value any, fromText bool) string {
+	switch v := value.(type) {
+	case bool:
+		return KindBoolean
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return KindInteger
+		}
+		return KindReal
+	case string:
+		switch {
+		case !fromText:
+		case v == "true" || v == "false" || v == "TRUE" || v == "FALSE":
+			return KindBoolean
+		case isInteger(v):
+			return KindInteger
+		case isReal(v):
+			return KindReal
+		}
+	}
+	return KindText
+}
+
+// leadingZero reports numbers such as 02134, which are codes rather than numbers.
+func leadingZero(s string) bool {
+	digits := strings.TrimPrefix(s, "-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] != '.'
+}
+
+func isInteger(s string) bool {
+	_, err := strconv.ParseInt(s, 10, 64)
+	return err == nil && !leadingZero(s)
+}
+
+func isReal(s string) bool {
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) && !strings.ContainsAny(s, "xXpP_") && !leadingZero(s)
+}
+
+// wider returns the narrowest kind holding values of both kinds.
+func wider(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case (a == KindInteger && b == KindReal) || (a == KindReal && b == KindInteger):
+		return KindReal
+	default:
+		return KindText
+	}
+}
+
+func convert(value any, kind string) any {
+	switch v := value.(type) {
+	case json.Number:
+		switch kind {
+		case KindInteger:
+			n, _ := v.Int64()
+			return n
+		case KindReal:
+			f, _ := v.Float64()
+			return f
+		}
+		return v.String()
+	case string:
+		switch kind {
+		case KindBoolean:
+			return strings.EqualFold(v, "true")
+		case KindInteger:
+			n, _ := strconv.ParseInt(v, 10, 64)
+			return n
+		case KindReal:
+			f, _ := strconv.ParseFloat(v, 64)
+			return f
+		}
+		return v
+	case bool:
+		if kind == KindText {
+			return strconv.FormatBool(v)
+		}
+	}
+	return value
+}
@@ -0,0 +1,55 @@
+package dataimport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCSVInfersKinds(t *testing.T) {
+	table, err := Parse(FormatCSV, []byte("\ufeffid;price;zip;active;note;id\n1;2.5;02134;true;;x\n2;3;10001;FALSE;hi;y\n"), Options{Delimiter: ";"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.Columns, []string{"id", "price", "zip", "active", "note", "id_2"}) {
+		t.Errorf("columns = %v", table.Columns)
+	}
+	if !reflect.DeepEqual(table.Kinds, []string{KindInteger, KindReal, KindText, KindBoolean, KindText, KindText}) {
+		t.Errorf("kinds = %v", table.Kinds)
+	}
+	if want := []any{int64(1), 2.5, "02134", true, nil, "x"}; !reflect.DeepEqual(table.Rows[0], want) {
+		t.Errorf("row = %#v", table.Rows[0])
+	}
+	if want := []any{int64(2), 3.0, "10001", false, "hi", "y"}; !reflect.DeepEqual(table.Rows[1], want) {
+		t.Errorf("row = %#v", table.Rows[1])
+	}
+
+	table, err = Parse(FormatCSV, []byte("a,b\n"), Options{NoHeader: true})
+	if err != nil || !reflect.DeepEqual(table.Columns, []string{"column1", "column2"}) || len(table.Rows) != 1 {
+		t.Errorf("got %+v, %v", table, err)
+	}
+	if _, err := Parse(FormatCSV, []byte("a,b\n1\n"), Options{}); err == nil {
+		t.Error("expected a short record to be refused")
+	}
+}
+
+func TestParseJSONKeepsKeyOrder(t *testing.T) {
+	table, err := Parse(FormatJSON, []byte(`[
+		{"name": "ann", "tags": {"a": [1, 2]}, "age": 31},
+		{"age": 40.5, "name": "bob", "zip": "02134", "ok": true}
+	]`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.Columns, []string{"name", "tags", "age", "zip", "ok"}) {
+		t.Errorf("columns = %v", table.Columns)
+	}
+	if !reflect.DeepEqual(table.Kinds, []string{KindText, KindText, KindReal, KindText, KindBoolean}) {
+		t.Errorf("kinds = %v", table.Kinds)
+	}
+	if want := []any{"ann", `{"a":[1,2]}`, 31.0, nil, nil}; !reflect.DeepEqual(table.Rows[0], want) {
+		t.Errorf("row = %#v", table.Rows[0])
+	}
+	if _, err := Parse(FormatJSON, []byte(`{"a": 1}`), Options{}); err == nil {
+		t.Error("expected an object to be refused")
+	}
+}
@@ -0,0 +1,283 @@
+// Package dbtest starts throwaway Postgres and MySQL servers in Docker from go test, so
+// that integration tests run the handlers against each real driver without a compose
+// file. It talks to the Docker engine's HTTP API directly. Tests skip when no engine
+// answers or with -short, and FLUXGRID_PG_DSN or FLUXGRID_MYSQL_DSN point them at an
+// existing server instead of a container.
+package dbtest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultDockerHost = "unix:///var/run/docker.sock"
+	// startTimeout bounds pulling an image and waiting for its server to accept
+	// connections.
+	startTimeout = 3 * time.Minute
+	// label marks the containers this package starts.
+	label = "fluxgrid.dbtest"
+)
+
+// Server is a database tests can connect to.
+type Server struct {
+	Driver string
+	DSN    string
+}
+
+type image struct {
+	driver, name, tag string
+	port              string
+	env               []string
+	args              []string
+	// envDSN names the variable holding the DSN of an existing server.
+	envDSN string
+	dsn    func(host, port string) string
+	ping   func(ctx context.Context, dsn string) error
+}
+
+var (
+	postgresImage = image{
+		driver: "postgres",
+		name:   "postgres",
+		tag:    "15",
+		port:   "5432/tcp",
+		env:    []string{"POSTGRES_DB=fluxgrid", "POSTGRES_USER=fluxgrid", "POSTGRES_PASSWORD=fluxgrid"},
+		envDSN: "FLUXGRID_PG_DSN",
+		dsn: func(host, port string) string {
+			return fmt.Sprintf("postgres://fluxgrid:fluxgrid@%s/fluxgrid?sslmode=disable", net.JoinHostPort(host, port))
+		},
+		ping: func(ctx context.Context, dsn string) error {
+			conn, err := pgx.Connect(ctx, dsn)
+			if err != nil {
+				return err
+			}
+			defer conn.Close(context.Background())
+			return conn.Ping(ctx)
+		},
+	}
+	mysqlImage = image{
+		driver: "mysql",
+		name:   "mysql",
+		tag:    "8.0",
+		port:   "3306/tcp",
+		env:    []string{"MYSQL_ROOT_PASSWORD=fluxgrid", "MYSQL_DATABASE=fluxgrid", "MYSQL_USER=fluxgrid", "MYSQL_PASSWORD=fluxgrid"},
+		args:   []string{"--default-authentication-plugin=mysql_native_password"},
+		envDSN: "FLUXGRID_MYSQL_DSN",
+		dsn: func(host, port string) string {
+			return fmt.Sprintf("fluxgrid:fluxgrid@tcp(%s)/fluxgrid?parseTime=true", net.JoinHostPort(host, port))
+		},
+		ping: func(ctx context.Context, dsn string) error {
+			db, err := sql.Open("mysql", dsn)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return db.PingContext(ctx)
+		},
+	}
+)
+
+// Postgres returns a Postgres 15 server, removed when the test ends.
+func Postgres(t testing.TB) Server {
+	return start(t, postgresImage)
+}
+
+// MySQL returns a MySQL 8.0 server, removed when the test ends.
+func MySQL(t testing.TB) Server {
+	return start(t, mysqlImage)
+}
+
+func start(t testing.TB, img image) Server {
+	t.Helper()
+	if dsn := os.Getenv(img.envDSN); dsn != "" {
+		return Server{Driver: img.driver, DSN: dsn}
+	}
+	if testing.Short() {
+		t.Skipf("skipping %s container in short mode", img.driver)
+	}
+	engine, err := newEngine(os.Getenv("DOCKER_HOST"))
+	if err != nil {
+		t.Skipf("Docker is not available: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startTimeout)
+	defer cancel()
+	if err := engine.do(ctx, http.MethodGet, "/_ping", nil, nil); err != nil {
+		t.Skipf("Docker is not available: %v", err)
+	}
+
+	if err := engine.pull(ctx, img.name, img.tag); err != nil {
+		t.Fatalf("pull %s:%s: %v", img.name, img.tag, err)
+	}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err = engine.do(ctx, http.MethodPost, "/containers/create", map[string]any{
+		"Image":        img.name + ":" + img.tag,
+		"Env":          img.env,
+		"Cmd":          img.args,
+		"Labels":       map[string]string{label: t.Name()},
+		"ExposedPorts": map[string]any{img.port: struct{}{}},
+		"HostConfig": map[string]any{
+			"PortBindings": map[string]any{img.port: []map[string]string{{"HostIp": "127.0.0.1", "HostPort": ""}}},
+		},
+	}, &created)
+	if err != nil {
+		t.Fatalf("create %s container: %v", img.driver, err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := engine.do(ctx, http.MethodDelete, "/containers/"+created.ID+"?force=1&v=1", nil, nil); err != nil {
+			t.Logf("remove %s container %s: %v", img.driver, created.ID, err)
+		}
+	})
+	if err := engine.do(ctx, http.MethodPost, "/containers/"+created.ID+"/start", nil, nil); err != nil {
+		t.Fatalf("start %s container: %v", img.driver, err)
+	}
+
+	var inspect struct {
+		NetworkSettings struct {
+			Ports map[string][]struct {
+				HostIP   string `json:"HostIp"`
+				HostPort string `json:"HostPort"`
+			} `json:"Ports"`
+		} `json:"NetworkSettings"`
+	}
+	if err := engine.do(ctx, http.MethodGet, "/containers/"+created.ID+"/json", nil, &inspect); err != nil {
+		t.Fatalf("inspect %s container: %v", img.driver, err)
+	}
+	bindings := inspect.NetworkSettings.Ports[img.port]
+	if len(bindings) == 0 {
+		t.Fatalf("%s container publishes no port for %s", img.driver, img.port)
+	}
+	dsn := img.dsn("127.0.0.1", bindings[0].HostPort)
+
+	// The images initialize their data directory before listening on TCP, so the first
+	// successful ping means the server is ready.
+	for {
+		pingCtx, cancelPing := context.WithTimeout(ctx, 5*time.Second)
+		err := img.ping(pingCtx, dsn)
+		cancelPing()
+		if err == nil {
+			return Server{Driver: img.driver, DSN: dsn}
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("%s container did not accept connections: %v", img.driver, err)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// engine talks to a Docker engine's HTTP API.
+type engine struct {
+	client *http.Client
+	base   string
+}
+
+// newEngine connects to host, a unix:// socket or tcp:// address as in DOCKER_HOST.
+func newEngine(host string) (*engine, error) {
+	if host == "" {
+		host = defaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &engine{client: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &engine{client: &http.Client{}, base: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q", host)
+	}
+}
+
+// do sends body as JSON and decodes the response into out when it is not nil.
+func (e *engine) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotModified {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("docker %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// pull fetches an image unless the engine already has it.
+func (e *engine) pull(ctx context.Context, name, tag string) error {
+	if err := e.do(ctx, http.MethodGet, "/images/"+name+":"+tag+"/json", nil, nil); err == nil {
+		return nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.base+"/images/create?fromImage="+url.QueryEscape(name)+"&tag="+url.QueryEscape(tag), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	// Progress arrives as JSON lines until the pull ends; failures are reported in them.
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &progress) == nil && progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+	}
+	return scanner.Err()
+}
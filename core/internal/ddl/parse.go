@@ -0,0 +1,390 @@
+package ddl
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Actions reported for affected objects.
+const (
+	ActionCreate = "create"
+	ActionAlter  = "alter"
+	ActionDrop   = "drop"
+	ActionRename = "rename"
+)
+
+// Object is a database object changed by a DDL statement.
+type Object struct {
+	Action string `json:"action"`
+	// Kind is the object type in lower case, for example table, view, index or
+	// materialized view.
+	Kind   string `json:"kind"`
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+	// NewName is set for renames.
+	NewName string `json:"newName,omitempty"`
+	// Table is the table an index or trigger belongs to, when the statement names it.
+	Table string `json:"table,omitempty"`
+}
+
+// objectKinds lists the kinds recognised after CREATE, ALTER and DROP. Multi-word kinds
+// come first so they win over their last word.
+var objectKinds = [][]string{
+	{"materialized", "view"},
+	{"foreign", "table"},
+	{"table"},
+	{"view"},
+	{"index"},
+	{"sequence"},
+	{"schema"},
+	{"function"},
+	{"procedure"},
+	{"type"},
+	{"trigger"},
+	{"extension"},
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// is reports whether the token is the given keyword (case-insensitive, unquoted).
+func (t token) is(keyword string) bool {
+	return !t.quoted && strings.EqualFold(t.text, keyword)
+}
+
+// Parse extracts the objects created, altered, renamed or dropped by the statements in sql.
+// It understands the common PostgreSQL, MySQL and SQLite forms and ignores statements it does
+// not recognise, so the result is a best-effort hint rather than a complete analysis.
+func Parse(sql string) []Object {
+	var objects []Object
+	for _, stmt := range splitStatements(tokenize(sql)) {
+		objects = append(objects, parseStatement(stmt)...)
+	}
+	return objects
+}
+
+func parseStatement(toks []token) []Object {
+	if len(toks) < 2 {
+		return nil
+	}
+	p := &parser{toks: toks}
+
+	switch {
+	case p.accept("create"):
+		return p.parseCreate()
+	case p.accept("alter"):
+		return p.parseAlter()
+	case p.accept("drop"):
+		return p.parseDrop()
+	default:
+		return nil
+	}
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.toks) {
+		return token{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *parser) accept(keywords ...string) bool {
+	if p.pos+len(keywords) > len(p.toks) {
+		return false
+	}
+	for i, keyword := range keywords {
+		if !p.toks[p.pos+i].is(keyword) {
+			return false
+		}
+	}
+	p.pos += len(keywords)
+	return true
+}
+
+func (p *parser) kind() string {
+	for _, words := range objectKinds {
+		if p.accept(words...) {
+			return strings.Join(words, " ")
+		}
+	}
+	return ""
+}
+
+// name reads an optionally qualified identifier and returns its schema and object name.
+func (p *parser) name() (string, string, bool) {
+	var parts []string
+	for {
+		tok := p.peek()
+		if tok.text == "" || (!tok.quoted && !isIdentifier(tok.text)) {
+			break
+		}
+		parts = append(parts, tok.text)
+		p.pos++
+		if p.peek().text != "." || p.peek().quoted {
+			break
+		}
+		p.pos++
+	}
+	switch len(parts) {
+	case 0:
+		return "", "", false
+	case 1:
+		return "", parts[0], true
+	default:
+		return parts[len(parts)-2], parts[len(parts)-1], true
+	}
+}
+
+func (p *parser) parseCreate() []Object {
+	p.accept("or", "replace")
+	for p.accept("temporary") || p.accept("temp") || p.accept("unlogged") || p.accept("unique") ||
+		p.accept("global") || p.accept("local") || p.accept("recursive") {
+	}
+
+	kind := p.kind()
+	if kind == "" {
+		return nil
+	}
+	p.accept("concurrently")
+	p.accept("if", "not", "exists")
+
+	if kind == "index" && p.peek().is("on") {
+		// Unnamed index: only the table is known.
+		p.pos++
+		p.accept("only")
+		schema, table, ok := p.name()
+		if !ok {
+			return nil
+		}
+		return []Object{{Action: ActionAlter, Kind: "table", Schema: schema, Name: table}}
+	}
+
+	schema, name, ok := p.name()
+	if !ok {
+		return nil
+	}
+	obj := Object{Action: ActionCreate, Kind: kind, Schema: schema, Name: name}
+	if kind == "index" || kind == "trigger" {
+		obj.Table = p.onTable()
+	}
+	return []Object{obj}
+}
+
+// onTable scans forward to "ON [ONLY] table" and returns the table name.
+func (p *parser) onTable() string {
+	for ; p.pos < len(p.toks); p.pos++ {
+		if p.peek().is("on") {
+			p.pos++
+			p.accept("only")
+			_, table, _ := p.name()
+			return table
+		}
+	}
+	return ""
+}
+
+func (p *parser) parseAlter() []Object {
+	kind := p.kind()
+	if kind == "" {
+		return nil
+	}
+	p.accept("if", "exists")
+	p.accept("only")
+
+	schema, name, ok := p.name()
+	if !ok {
+		return nil
+	}
+	obj := Object{Action: ActionAlter, Kind: kind, Schema: schema, Name: name}
+
+	// ALTER ... RENAME TO new_name; column renames stay plain alters.
+	for ; p.pos < len(p.toks); p.pos++ {
+		if p.accept("rename", "to") {
+			if _, newName, ok := p.name(); ok {
+				obj.Action = ActionRename
+				obj.NewName = newName
+			}
+			break
+		}
+	}
+	return []Object{obj}
+}
+
+func (p *parser) parseDrop() []Object {
+	kind := p.kind()
+	if kind == "" {
+		return nil
+	}
+	p.accept("concurrently")
+	p.accept("if", "exists")
+
+	var objects []Object
+	for {
+		schema, name, ok := p.name()
+		if !ok {
+			break
+		}
+		objects = append(objects, Object{Action: ActionDrop, Kind: kind, Schema: schema, Name: name})
+		if p.peek().text == "(" {
+			// DROP FUNCTION f(int): skip the argument list.
+			p.skipParens()
+		}
+		if kind == "trigger" || kind == "index" {
+			if table := p.onTable(); table != "" {
+				objects[len(objects)-1].Table = table
+			}
+		}
+		if p.peek().text != "," {
+			break
+		}
+		p.pos++
+	}
+	return objects
+}
+
+func (p *parser) skipParens() {
+	depth := 0
+	for ; p.pos < len(p.toks); p.pos++ {
+		switch p.peek().text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				p.pos++
+				return
+			}
+		}
+	}
+}
+
+func isIdentifier(text string) bool {
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$' {
+			return false
+		}
+	}
+	return text != ""
+}
+
+func splitStatements(toks []token) [][]token {
+	var (
+		statements [][]token
+		current    []token
+	)
+	for _, tok := range toks {
+		if tok.text == ";" && !tok.quoted {
+			if len(current) > 0 {
+				statements = append(statements, current)
+			}
+			current = nil
+			continue
+		}
+		current = append(current, tok)
+	}
+	if len(current) > 0 {
+		statements = append(statements, current)
+	}
+	return statements
+}
+
+// tokenize splits sql into words, quoted identifiers and punctuation. Comments and string
+// literals (including dollar-quoted bodies) are dropped.
+func tokenize(sql string) []token {
+	var toks []token
+	runes := []rune(sql)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := indexRunes(runes, i+2, []rune("*/"))
+			if end < 0 {
+				return toks
+			}
+			i = end + 2
+		case r == '\'':
+			if i = skipQuoted(runes, i, '\''); i < 0 {
+				return toks
+			}
+		case r == '"' || r == '`':
+			end := skipQuoted(runes, i, r)
+			if end < 0 {
+				return toks
+			}
+			text := string(runes[i+1 : end-1])
+			text = strings.ReplaceAll(text, string([]rune{r, r}), string(r))
+			toks = append(toks, token{text: text, quoted: true})
+			i = end
+		case r == '$' && dollarTag(runes, i) != "":
+			tag := []rune(dollarTag(runes, i))
+			end := indexRunes(runes, i+len(tag), tag)
+			if end < 0 {
+				return toks
+			}
+			i = end + len(tag)
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			toks = append(toks, token{text: string(runes[start:i])})
+		default:
+			toks = append(toks, token{text: string(r)})
+			i++
+		}
+	}
+	return toks
+}
+
+// indexRunes returns the index of the first occurrence of pattern at or after from, or -1.
+func indexRunes(runes []rune, from int, pattern []rune) int {
+	for i := from; i+len(pattern) <= len(runes); i++ {
+		if string(runes[i:i+len(pattern)]) == string(pattern) {
+			return i
+		}
+	}
+	return -1
+}
+
+// skipQuoted returns the index just past the closing quote, treating doubled quotes as
+// escapes, or -1 when the quote is never closed.
+func skipQuoted(runes []rune, start int, quote rune) int {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] != quote {
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return -1
+}
+
+// dollarTag returns the $tag$ opening a dollar-quoted string at start, or "".
+func dollarTag(runes []rune, start int) string {
+	for i := start + 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '$':
+			return string(runes[start : i+1])
+		case unicode.IsLetter(runes[i]) || runes[i] == '_' || (i > start+1 && unicode.IsDigit(runes[i])):
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -0,0 +1,101 @@
+package ddl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		sql  string
+		want []Object
+	}{
+		{
+			sql:  `CREATE TABLE IF NOT EXISTS app.users (id int, note text DEFAULT 'drop table x;')`,
+			want: []Object{{Action: ActionCreate, Kind: "table", Schema: "app", Name: "users"}},
+		},
+		{
+			sql:  `create or replace materialized view "Sales Report" as select 1`,
+			want: []Object{{Action: ActionCreate, Kind: "materialized view", Name: "Sales Report"}},
+		},
+		{
+			sql:  `CREATE UNIQUE INDEX CONCURRENTLY users_email_idx ON ONLY public.users (email)`,
+			want: []Object{{Action: ActionCreate, Kind: "index", Name: "users_email_idx", Table: "users"}},
+		},
+		{
+			sql:  `CREATE INDEX ON orders (created_at)`,
+			want: []Object{{Action: ActionAlter, Kind: "table", Name: "orders"}},
+		},
+		{
+			sql: `-- rename
+ALTER TABLE IF EXISTS ONLY users RENAME TO customers; ALTER TABLE orders RENAME COLUMN a TO b`,
+			want: []Object{
+				{Action: ActionRename, Kind: "table", Name: "users", NewName: "customers"},
+				{Action: ActionAlter, Kind: "table", Name: "orders"},
+			},
+		},
+		{
+			sql: `DROP TABLE IF EXISTS a, s.b CASCADE; /* comment; */ DROP FUNCTION f(int, text)`,
+			want: []Object{
+				{Action: ActionDrop, Kind: "table", Name: "a"},
+				{Action: ActionDrop, Kind: "table", Schema: "s", Name: "b"},
+				{Action: ActionDrop, Kind: "function", Name: "f"},
+			},
+		},
+		{
+			sql:  "CREATE FUNCTION f() RETURNS void AS $body$ DROP TABLE t; $body$ LANGUAGE sql",
+			want: []Object{{Action: ActionCreate, Kind: "function", Name: "f"}},
+		},
+		{
+			sql:  "DROP TRIGGER audit ON `shop`.`orders`",
+			want: []Object{{Action: ActionDrop, Kind: "trigger", Name: "audit", Table: "orders"}},
+		},
+		{sql: `SELECT * FROM users; INSERT INTO t VALUES (1)`},
+		{sql: `CREATE TABLE "unterminated`},
+	}
+
+	for _, tc := range cases {
+		if got := Parse(tc.sql); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tc.sql, got, tc.want)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	cases := map[string]bool{
+		`SELECT * FROM users WHERE note = 'delete me'`:                     true,
+		`with recent as (select 1) select * from recent; SHOW search_path`: true,
+		`EXPLAIN SELECT 1`:              true,
+		`SELECT "update" FROM t`:        true,
+		`EXPLAIN ANALYZE DELETE FROM t`: false,
+		`WITH gone AS (DELETE FROM t RETURNING *) SELECT * FROM gone`: false,
+		`SELECT * INTO copy_of_t FROM t`:                              false,
+		`SELECT * FROM t FOR UPDATE`:                                  false,
+		`SELECT nextval('s')`:                                         false,
+		`SELECT 1; UPDATE t SET x = 1`:                                false,
+		`BEGIN`:                                                       false,
+		`-- nothing`:                                                  false,
+	}
+	for sql, want := range cases {
+		if got := ReadOnly(sql); got != want {
+			t.Errorf("ReadOnly(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
+
+func TestExplainable(t *testing.T) {
+	cases := map[string]bool{
+		`SELECT * FROM users;`:                 true,
+		`with x as (select 1) select * from x`: true,
+		`UPDATE t SET x = 1`:                   true,
+		`SELECT 1; SELECT 2`:                   false,
+		`CREATE TABLE t (id int)`:              false,
+		`EXPLAIN SELECT 1`:                     false,
+		`-- nothing`:                           false,
+	}
+	for sql, want := range cases {
+		if got := Explainable(sql); got != want {
+			t.Errorf("Explainable(%q) = %v, want %v", sql, got, want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ddl
+
+// readOnlyLeads are the statements that only read, when nothing in them writes.
+var readOnlyLeads = []string{"select", "with", "values", "table", "show", "explain"}
+
+// writeKeywords mark a reading statement that writes or locks anyway: data-modifying
+// CTEs, SELECT INTO, row locks, EXPLAIN ANALYZE of a write, and the sequence functions.
+var writeKeywords = []string{
+	"insert", "update", "delete", "merge", "into", "share", "analyze", "analyse",
+	"nextval", "setval", "lock", "call", "copy",
+}
+
+// ReadOnly reports whether every statement in sql only reads, so that it can run on a
+// read replica. Like Parse it is a best-effort check; it errs towards false.
+func ReadOnly(sql string) bool {
+	statements := splitStatements(tokenize(sql))
+	if len(statements) == 0 {
+		return false
+	}
+	for _, toks := range statements {
+		if !isAny(toks[0], readOnlyLeads) {
+			return false
+		}
+		for _, tok := range toks {
+			if isAny(tok, writeKeywords) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// explainableLeads are the statements EXPLAIN plans on the supported databases.
+var explainableLeads = []string{"select", "with", "values", "table", "insert", "update", "delete", "replace", "merge"}
+
+// Explainable reports whether sql is a single statement EXPLAIN can plan, so that its plan
+// can be read without running it.
+func Explainable(sql string) bool {
+	statements := splitStatements(tokenize(sql))
+	return len(statements) == 1 && isAny(statements[0][0], explainableLeads)
+}
+
+func isAny(tok token, keywords []string) bool {
+	for _, keyword := range keywords {
+		if tok.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package ddl
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Conn models the subset of pgx connection behaviour used for catalog lookups.
+type Conn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+const relationSchemaQuery = `
+SELECT n.nspname
+FROM pg_catalog.pg_class c
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE c.oid = to_regclass(quote_ident($1))`
+
+var relationKinds = map[string]bool{
+	"table":             true,
+	"foreign table":     true,
+	"view":              true,
+	"materialized view": true,
+	"index":             true,
+	"sequence":          true,
+}
+
+// ResolvePostgres fills in the schema of unqualified objects using the PostgreSQL catalog.
+// Relations that still exist are looked up through the search path; dropped objects and
+// non-relations fall back to current_schema(). Schemas and extensions are left as is.
+func ResolvePostgres(ctx context.Context, conn Conn, objects []Object) error {
+	var current string
+	for i := range objects {
+		obj := &objects[i]
+		if obj.Schema != "" || obj.Kind == "schema" || obj.Kind == "extension" {
+			continue
+		}
+
+		if relationKinds[obj.Kind] && obj.Action != ActionDrop {
+			name := obj.Name
+			if obj.NewName != "" {
+				name = obj.NewName
+			}
+			schema, err := queryString(ctx, conn, relationSchemaQuery, name)
+			if err != nil {
+				return err
+			}
+			if schema != "" {
+				obj.Schema = schema
+				continue
+			}
+		}
+
+		if current == "" {
+			schema, err := queryString(ctx, conn, "SELECT current_schema()")
+			if err != nil {
+				return err
+			}
+			current = schema
+		}
+		obj.Schema = current
+	}
+	return nil
+}
+
+// queryString returns the first column of the first row, or "" when there is no row or the
+// value is NULL.
+func queryString(ctx context.Context, conn Conn, sql string, args ...any) (string, error) {
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var value *string
+	if rows.Next() {
+		if err := rows.Scan(&value); err != nil {
+			return "", err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", nil
+	}
+	return *value, nil
+}
@@ -0,0 +1,25 @@
+// Package discover finds databases a developer can connect to without typing their
+// connection details: containers running on the local Docker engine, and servers
+// answering on well-known ports.
+package discover
+
+// Candidate is a connection ready to pass to connect.test.
+type Candidate struct {
+	// Source says how the candidate was found, such as "docker".
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	User   string `json:"user,omitempty"`
+	// Database is empty when the server's default applies.
+	Database string `json:"database,omitempty"`
+	// PasswordKnown is false when the password could not be inferred, for instance because
+	// the container reads it from a file. The DSN then has no password.
+	PasswordKnown bool `json:"passwordKnown"`
+	// Version is the server version, when the server announces it before login.
+	Version string `json:"version,omitempty"`
+	// Notes explain guesses the client should show the user.
+	Notes []string `json:"notes,omitempty"`
+}
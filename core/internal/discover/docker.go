@@ -0,0 +1,289 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultDockerHost is used when DOCKER_HOST is not set.
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerImages maps the official images to the driver and port they serve.
+var dockerImages = map[string]struct {
+	driver string
+	port   int
+}{
+	"postgres": {"postgres", 5432},
+	"mysql":    {"mysql", 3306},
+	"mariadb":  {"mysql", 3306},
+}
+
+// Docker talks to a Docker engine's HTTP API.
+type Docker struct {
+	client *http.Client
+	base   string
+}
+
+// NewDocker connects to host, a unix:// socket or tcp:// address as in DOCKER_HOST. An
+// empty host uses DOCKER_HOST or DefaultDockerHost.
+func NewDocker(host string) (*Docker, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultDockerHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker host %q: %w", host, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &Docker{client: &http.Client{Transport: transport}, base: "http://docker"}, nil
+	case "tcp", "http":
+		return &Docker{client: &http.Client{}, base: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported Docker host %q", host)
+	}
+}
+
+type dockerContainer struct {
+	ID     string   `json:"Id"`
+	Names  []string `json:"Names"`
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`
+	Ports  []dockerPort
+	Labels map[string]string `json:"Labels"`
+}
+
+type dockerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+type dockerInspect struct {
+	Config struct {
+		Image string   `json:"Image"`
+		Env   []string `json:"Env"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+func (d *Docker) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.base+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("docker %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Candidates lists running database containers with the connections they accept.
+func (d *Docker) Candidates(ctx context.Context) ([]Candidate, error) {
+	var containers []dockerContainer
+	if err := d.get(ctx, "/containers/json", &containers); err != nil {
+		return nil, err
+	}
+	candidates := []Candidate{}
+	for _, c := range containers {
+		kind, ok := dockerImages[imageName(c.Image)]
+		if !ok || (c.State != "" && c.State != "running") {
+			continue
+		}
+		var inspect dockerInspect
+		if err := d.get(ctx, "/containers/"+url.PathEscape(c.ID)+"/json", &inspect); err != nil {
+			return nil, err
+		}
+		candidate := Candidate{
+			Source: "docker",
+			Name:   containerName(c),
+			Driver: kind.driver,
+		}
+		candidate.Host, candidate.Port = containerAddress(c, inspect, kind.port, &candidate)
+		pass := credentials(kind.driver, imageName(c.Image), envMap(inspect.Config.Env), &candidate)
+		candidate.DSN = buildDSN(candidate, pass)
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// imageName strips the registry, the library/ namespace, the tag and the digest.
+func imageName(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	parts := strings.Split(image, "/")
+	if len(parts) > 1 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		parts = parts[1:]
+	}
+	if len(parts) == 2 && parts[0] == "library" {
+		parts = parts[1:]
+	}
+	return strings.Join(parts, "/")
+}
+
+func containerName(c dockerContainer) string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
+
+// containerAddress prefers a port published on the host. Without one it falls back to the
+// container's own address, which is only reachable where the engine runs natively.
+func containerAddress(c dockerContainer, inspect dockerInspect, port int, candidate *Candidate) (string, int) {
+	for _, p := range c.Ports {
+		if p.PrivatePort != port || p.PublicPort == 0 || (p.Type != "" && p.Type != "tcp") {
+			continue
+		}
+		host := p.IP
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "localhost"
+		}
+		return host, p.PublicPort
+	}
+	for _, network := range inspect.NetworkSettings.Networks {
+		if network.IPAddress != "" {
+			candidate.Notes = append(candidate.Notes, "port is not published; using the container address")
+			return network.IPAddress, port
+		}
+	}
+	candidate.Notes = append(candidate.Notes, "port is not published")
+	return "localhost", port
+}
+
+func envMap(env []string) map[string]string {
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// credentials infers the user, password and database from the variables the official
+// images read, and returns the password.
+func credentials(driver, image string, env map[string]string, c *Candidate) string {
+	lookup := func(names ...string) (string, bool) {
+		for _, name := range names {
+			if v, ok := env[name]; ok {
+				return v, true
+			}
+		}
+		return "", false
+	}
+	filed := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := env[name+"_FILE"]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if driver == "postgres" {
+		c.User, _ = lookup("POSTGRES_USER")
+		if c.User == "" {
+			c.User = "postgres"
+		}
+		pass, ok := lookup("POSTGRES_PASSWORD")
+		c.PasswordKnown = ok || env["POSTGRES_HOST_AUTH_METHOD"] == "trust"
+		if filed("POSTGRES_PASSWORD") {
+			c.Notes = append(c.Notes, "password is read from a file")
+		}
+		c.Database, _ = lookup("POSTGRES_DB")
+		if c.Database == "" {
+			c.Database = c.User
+		}
+		return pass
+	}
+
+	prefixes := []string{"MYSQL"}
+	if image == "mariadb" {
+		prefixes = []string{"MARIADB", "MYSQL"}
+	}
+	names := func(suffix string) []string {
+		out := make([]string, len(prefixes))
+		for i, p := range prefixes {
+			out[i] = p + "_" + suffix
+		}
+		return out
+	}
+	c.Database, _ = lookup(names("DATABASE")...)
+	if user, ok := lookup(names("USER")...); ok && user != "" {
+		c.User = user
+		pass, ok := lookup(names("PASSWORD")...)
+		c.PasswordKnown = ok
+		if filed(names("PASSWORD")...) {
+			c.Notes = append(c.Notes, "password is read from a file")
+		}
+		return pass
+	}
+	c.User = "root"
+	if pass, ok := lookup(names("ROOT_PASSWORD")...); ok {
+		c.PasswordKnown = true
+		return pass
+	}
+	if v, ok := lookup(names("ALLOW_EMPTY_PASSWORD")...); ok && v != "" && v != "no" {
+		c.PasswordKnown = true
+	} else if v, _ := lookup(names("RANDOM_ROOT_PASSWORD")...); v != "" {
+		c.Notes = append(c.Notes, "root password was generated; see the container log")
+	} else if filed(names("ROOT_PASSWORD")...) {
+		c.Notes = append(c.Notes, "password is read from a file")
+	}
+	return ""
+}
+
+func buildDSN(c Candidate, pass string) string {
+	hostPort := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	if c.Driver == "postgres" {
+		u := url.URL{Scheme: "postgres", Host: hostPort, Path: "/" + c.Database, RawQuery: "sslmode=disable"}
+		if pass != "" {
+			u.User = url.UserPassword(c.User, pass)
+		} else {
+			u.User = url.User(c.User)
+		}
+		return u.String()
+	}
+	creds := c.User
+	if pass != "" {
+		creds += ":" + pass
+	}
+	return creds + "@tcp(" + hostPort + ")/" + c.Database
+}
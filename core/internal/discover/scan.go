@@ -0,0 +1,221 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScanPorts are the usual Postgres and MySQL ports, including the ones the
+// project's docker-compose publishes.
+var DefaultScanPorts = []int{5432, 5433, 55432, 3306, 3307, 53306}
+
+// MaxScanHosts bounds how many addresses one scan may probe.
+const MaxScanHosts = 1024
+
+const (
+	defaultProbeTimeout     = 500 * time.Millisecond
+	defaultScanConcurrency  = 64
+	sslRequestCode          = 80877103
+	mysqlProtocolVersion    = 10
+	maxMySQLHandshakeLength = 1 << 12
+)
+
+// ScanOptions choose what a scan probes.
+type ScanOptions struct {
+	// CIDR adds a network, such as 192.168.1.0/24, to localhost.
+	CIDR string
+	// Ports to probe on every host; empty uses DefaultScanPorts.
+	Ports []int
+	// Timeout bounds each probe.
+	Timeout     time.Duration
+	Concurrency int
+}
+
+// ScanHosts returns the addresses a scan of cidr covers, after localhost. Network and
+// broadcast addresses of IPv4 networks are skipped.
+func ScanHosts(cidr string) ([]string, error) {
+	hosts := []string{"localhost"}
+	if cidr == "" {
+		return hosts, nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %q: %w", cidr, err)
+	}
+	prefix = prefix.Masked()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 10 {
+		return nil, fmt.Errorf("network %s has more than %d addresses", prefix, MaxScanHosts)
+	}
+	skipEnds := prefix.Addr().Is4() && hostBits >= 2
+	last := 1<<hostBits - 1
+	addr := prefix.Addr()
+	for i := 0; i <= last; i++ {
+		if !(skipEnds && (i == 0 || i == last)) {
+			hosts = append(hosts, addr.String())
+		}
+		addr = addr.Next()
+	}
+	return hosts, nil
+}
+
+// Scan probes every port on every host and returns the servers that answered as Postgres
+// or MySQL. Their DSNs carry no credentials.
+func Scan(ctx context.Context, opts ScanOptions) ([]Candidate, error) {
+	hosts, err := ScanHosts(opts.CIDR)
+	if err != nil {
+		return nil, err
+	}
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = DefaultScanPorts
+	}
+	for _, port := range ports {
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %d", port)
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultProbeTimeout
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultScanConcurrency
+	}
+
+	var (
+		mu         sync.Mutex
+		candidates = []Candidate{}
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, opts.Concurrency)
+	)
+	for _, host := range hosts {
+		for _, port := range ports {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return nil, ctx.Err()
+			}
+			wg.Add(1)
+			go func(host string, port int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if c, ok := probe(ctx, host, port, opts.Timeout); ok {
+					mu.Lock()
+					candidates = append(candidates, c)
+					mu.Unlock()
+				}
+			}(host, port)
+		}
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	order := make(map[string]int, len(hosts))
+	for i, host := range hosts {
+		order[host] = i
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Host != b.Host {
+			return order[a.Host] < order[b.Host]
+		}
+		return a.Port < b.Port
+	})
+	return candidates, nil
+}
+
+// probe identifies the server on host:port. MySQL greets first with its version; Postgres
+// stays silent until asked and answers an SSL request with a single byte.
+func probe(ctx context.Context, host string, port int, timeout time.Duration) (Candidate, bool) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Candidate{}, false
+	}
+	defer conn.Close()
+
+	candidate := Candidate{Source: "scan", Host: host, Port: port}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err == nil {
+		version, ok := readMySQLHandshake(conn, header)
+		if !ok {
+			return Candidate{}, false
+		}
+		candidate.Driver, candidate.Version = "mysql", version
+		candidate.Name = "MySQL on " + addr
+		if strings.Contains(strings.ToLower(version), "mariadb") {
+			candidate.Name = "MariaDB on " + addr
+		}
+		candidate.DSN = "@tcp(" + addr + ")/"
+		candidate.Notes = []string{"user and password are required"}
+		return candidate, true
+	} else if !isTimeout(err) {
+		return Candidate{}, false
+	}
+
+	var request [8]byte
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], sslRequestCode)
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(request[:]); err != nil {
+		return Candidate{}, false
+	}
+	var reply [1]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil || (reply[0] != 'S' && reply[0] != 'N') {
+		return Candidate{}, false
+	}
+	candidate.Driver = "postgres"
+	candidate.Name = "PostgreSQL on " + addr
+	u := url.URL{Scheme: "postgres", Host: addr, Path: "/postgres"}
+	if reply[0] == 'N' {
+		u.RawQuery = "sslmode=disable"
+	} else {
+		candidate.Notes = append(candidate.Notes, "server accepts SSL")
+	}
+	candidate.DSN = u.String()
+	candidate.Notes = append(candidate.Notes, "user and password are required")
+	return candidate, true
+}
+
+// readMySQLHandshake reads the initial handshake packet whose header was already read and
+// returns the server version it announces.
+func readMySQLHandshake(conn net.Conn, header [4]byte) (string, bool) {
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if header[3] != 0 || length < 2 || length > maxMySQLHandshakeLength {
+		return "", false
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return "", false
+	}
+	if body[0] != mysqlProtocolVersion {
+		return "", false
+	}
+	end := bytes.IndexByte(body[1:], 0)
+	if end < 0 {
+		return "", false
+	}
+	return string(body[1 : 1+end]), true
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,83 @@
+package discover
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// listen serves every connection on a loopback port with handle and returns the port.
+func listen(t *testing.T, handle func(net.Conn)) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestScanIdentifiesServers(t *testing.T) {
+	mysql := listen(t, func(conn net.Conn) {
+		version := "10.11.6-MariaDB"
+		body := append([]byte{mysqlProtocolVersion}, version...)
+		body = append(body, 0, 1, 2, 3)
+		conn.Write(append([]byte{byte(len(body)), 0, 0, 0}, body...))
+		time.Sleep(100 * time.Millisecond)
+	})
+	postgres := listen(t, func(conn net.Conn) {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err == nil {
+			conn.Write([]byte{'N'})
+		}
+	})
+	silent := listen(t, func(conn net.Conn) { io.Copy(io.Discard, conn) })
+
+	candidates, err := Scan(context.Background(), ScanOptions{
+		Ports:   []int{postgres, mysql, silent},
+		Timeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	found := map[string]Candidate{}
+	for _, c := range candidates {
+		found[c.Driver] = c
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected two servers, got %+v", candidates)
+	}
+	if c := found["mysql"]; c.Version != "10.11.6-MariaDB" || c.Port != mysql {
+		t.Fatalf("unexpected mysql candidate %+v", c)
+	}
+	if c := found["postgres"]; c.Port != postgres || c.DSN == "" {
+		t.Fatalf("unexpected postgres candidate %+v", c)
+	}
+}
+
+func TestScanHosts(t *testing.T) {
+	hosts, err := ScanHosts("192.168.1.0/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 3 || hosts[0] != "localhost" || hosts[1] != "192.168.1.1" || hosts[2] != "192.168.1.2" {
+		t.Fatalf("unexpected hosts %v", hosts)
+	}
+	if _, err := ScanHosts("10.0.0.0/16"); err == nil {
+		t.Fatal("expected a large network to be refused")
+	}
+}
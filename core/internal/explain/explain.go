@@ -0,0 +1,399 @@
+// Package explain prepares Postgres execution plans for display. It reads the JSON form of
+// EXPLAIN, with or without ANALYZE and BUFFERS, and works out what the raw plan only
+// implies: totals over loops, the time and cost each node spends itself rather than in
+// its children, how far row estimates were off, and which nodes deserve attention.
+package explain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// misestimateFactor is how far actual rows may be from the estimate, either way,
+	// before a node is highlighted.
+	misestimateFactor = 10
+	// diskReadBlocks is how many blocks a node must read from outside the buffer cache,
+	// more than it finds in it, before it is highlighted.
+	diskReadBlocks = 1000
+	// filterDiscardFactor is how many rows a filter may discard for each row it keeps
+	// before a node is highlighted.
+	filterDiscardFactor = 10
+)
+
+// Highlights marking nodes that deserve attention.
+const (
+	// HighlightSlowest marks the node spending the most time itself.
+	HighlightSlowest = "slowest"
+	// HighlightCostliest marks the node with the highest cost of its own.
+	HighlightCostliest = "costliest"
+	// HighlightLargest marks the node producing the most rows.
+	HighlightLargest = "largest"
+	// HighlightMisestimate marks nodes whose actual rows are misestimateFactor times over
+	// or under the estimate.
+	HighlightMisestimate = "misestimate"
+	// HighlightDiskSort marks sorts that spilled to disk.
+	HighlightDiskSort = "diskSort"
+	// HighlightTempFiles marks nodes that read or wrote temporary files.
+	HighlightTempFiles = "tempFiles"
+	// HighlightDiskReads marks nodes that mostly read blocks from outside the buffer cache.
+	HighlightDiskReads = "diskReads"
+	// HighlightFilterDiscards marks nodes whose filter discards most of the rows read.
+	HighlightFilterDiscards = "filterDiscards"
+)
+
+// Analysis is an annotated plan.
+type Analysis struct {
+	// Analyzed is set when the plan was produced by EXPLAIN ANALYZE, so that it holds
+	// actual rows and times.
+	Analyzed        bool     `json:"analyzed"`
+	PlanningTimeMs  *float64 `json:"planningTimeMs,omitempty"`
+	ExecutionTimeMs *float64 `json:"executionTimeMs,omitempty"`
+	TotalCost       float64  `json:"totalCost"`
+	// Nodes counts the nodes of the tree.
+	Nodes int   `json:"nodes"`
+	Root  *Node `json:"root"`
+}
+
+// Node is a plan node with derived metrics. Rows, times and buffers are totals over all
+// loops of the node; "exclusive" values leave out those of the node's children.
+type Node struct {
+	// ID numbers the nodes depth first from 1, for UIs to refer to them.
+	ID                 int    `json:"id"`
+	NodeType           string `json:"nodeType"`
+	Label              string `json:"label"`
+	Relation           string `json:"relation,omitempty"`
+	Alias              string `json:"alias,omitempty"`
+	Index              string `json:"index,omitempty"`
+	JoinType           string `json:"joinType,omitempty"`
+	ParentRelationship string `json:"parentRelationship,omitempty"`
+
+	Cost                 float64 `json:"cost"`
+	ExclusiveCost        float64 `json:"exclusiveCost"`
+	ExclusiveCostPercent float64 `json:"exclusiveCostPercent"`
+	EstimatedRows        float64 `json:"estimatedRows"`
+
+	ActualRows *float64 `json:"actualRows,omitempty"`
+	Loops      *float64 `json:"loops,omitempty"`
+	// RowsFactor is how many times actual rows were over (RowsDirection "under", the
+	// planner underestimated) or under ("over") the estimate.
+	RowsFactor           *float64 `json:"rowsFactor,omitempty"`
+	RowsDirection        string   `json:"rowsDirection,omitempty"`
+	TimeMs               *float64 `json:"timeMs,omitempty"`
+	ExclusiveTimeMs      *float64 `json:"exclusiveTimeMs,omitempty"`
+	ExclusiveTimePercent *float64 `json:"exclusiveTimePercent,omitempty"`
+
+	Buffers          *Buffers `json:"buffers,omitempty"`
+	ExclusiveBuffers *Buffers `json:"exclusiveBuffers,omitempty"`
+
+	Highlights []string `json:"highlights,omitempty"`
+	// Details holds the other properties of the node as EXPLAIN gave them, such as
+	// filters, join conditions and sort keys.
+	Details  map[string]any `json:"details,omitempty"`
+	Children []*Node        `json:"children,omitempty"`
+
+	removedByFilter float64
+	spilledSort     bool
+}
+
+// Buffers counts the blocks a node used, as reported with EXPLAIN (BUFFERS).
+type Buffers struct {
+	SharedHit     float64 `json:"sharedHit"`
+	SharedRead    float64 `json:"sharedRead"`
+	SharedDirtied float64 `json:"sharedDirtied"`
+	SharedWritten float64 `json:"sharedWritten"`
+	LocalHit      float64 `json:"localHit"`
+	LocalRead     float64 `json:"localRead"`
+	TempRead      float64 `json:"tempRead"`
+	TempWritten   float64 `json:"tempWritten"`
+}
+
+// ErrNotAPlan is returned for JSON that is not a Postgres plan.
+var ErrNotAPlan = errors.New("not a Postgres JSON plan; run EXPLAIN (FORMAT JSON)")
+
+// consumed are the node properties turned into Node fields, left out of Details.
+var consumed = map[string]bool{
+	"Node Type": true, "Relation Name": true, "Alias": true, "Index Name": true,
+	"Join Type": true, "Parent Relationship": true, "Plans": true,
+	"Startup Cost": true, "Total Cost": true, "Plan Rows": true,
+	"Actual Startup Time": true, "Actual Total Time": true, "Actual Rows": true, "Actual Loops": true,
+	"Shared Hit Blocks": true, "Shared Read Blocks": true, "Shared Dirtied Blocks": true, "Shared Written Blocks": true,
+	"Local Hit Blocks": true, "Local Read Blocks": true, "Local Dirtied Blocks": true, "Local Written Blocks": true,
+	"Temp Read Blocks": true, "Temp Written Blocks": true,
+}
+
+// Analyze annotates a plan in the JSON form of EXPLAIN: the array it returns, its single
+// element, or a JSON string holding either.
+func Analyze(plan json.RawMessage) (*Analysis, error) {
+	plan = bytes.TrimSpace(plan)
+	var text string
+	if json.Unmarshal(plan, &text) == nil {
+		plan = json.RawMessage(text)
+	}
+	var top map[string]any
+	var list []map[string]any
+	if err := json.Unmarshal(plan, &list); err == nil {
+		if len(list) != 1 {
+			return nil, ErrNotAPlan
+		}
+		top = list[0]
+	} else if err := json.Unmarshal(plan, &top); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotAPlan, err)
+	}
+	rootNode, ok := top["Plan"].(map[string]any)
+	if !ok {
+		return nil, ErrNotAPlan
+	}
+
+	a := &Analysis{}
+	if v, ok := number(top, "Planning Time"); ok {
+		a.PlanningTimeMs = &v
+	}
+	if v, ok := number(top, "Execution Time"); ok {
+		a.ExecutionTimeMs = &v
+	}
+	_, a.Analyzed = number(rootNode, "Actual Loops")
+	var nodes []*Node
+	root, err := build(rootNode, 1, &nodes)
+	if err != nil {
+		return nil, err
+	}
+	a.Root, a.Nodes, a.TotalCost = root, len(nodes), root.Cost
+	annotate(a, nodes)
+	return a, nil
+}
+
+// build converts a plan node and its children. Nodes below a Gather run in parallel
+// workers; their loops count every process, so their times are divided by the number of
+// processes to stay comparable with the wall-clock time of the other nodes.
+func build(raw map[string]any, processes float64, nodes *[]*Node) (*Node, error) {
+	n := &Node{
+		ID:                 len(*nodes) + 1,
+		NodeType:           text(raw, "Node Type"),
+		Relation:           text(raw, "Relation Name"),
+		Alias:              text(raw, "Alias"),
+		Index:              text(raw, "Index Name"),
+		JoinType:           text(raw, "Join Type"),
+		ParentRelationship: text(raw, "Parent Relationship"),
+	}
+	if n.NodeType == "" {
+		return nil, ErrNotAPlan
+	}
+	*nodes = append(*nodes, n)
+	n.Label = label(n)
+	n.Cost, _ = number(raw, "Total Cost")
+	planRows, _ := number(raw, "Plan Rows")
+	loops, analyzed := number(raw, "Actual Loops")
+	n.EstimatedRows = planRows * math.Max(loops, 1)
+	if analyzed {
+		rows, _ := number(raw, "Actual Rows")
+		total, _ := number(raw, "Actual Total Time")
+		actual := rows * loops
+		time := round(total * loops / processes)
+		n.ActualRows, n.Loops, n.TimeMs = &actual, &loops, &time
+		if removed, ok := number(raw, "Rows Removed by Filter"); ok {
+			n.removedByFilter = removed * loops
+		}
+	}
+	if buffers, ok := readBuffers(raw); ok {
+		n.Buffers = buffers
+	}
+	n.spilledSort = text(raw, "Sort Space Type") == "Disk"
+	for key, value := range raw {
+		if consumed[key] {
+			continue
+		}
+		if n.Details == nil {
+			n.Details = make(map[string]any)
+		}
+		n.Details[key] = value
+	}
+
+	childProcesses := processes
+	if workers, ok := number(raw, "Workers Launched"); ok && strings.HasPrefix(n.NodeType, "Gather") {
+		childProcesses = workers + 1
+	}
+	children, _ := raw["Plans"].([]any)
+	for _, child := range children {
+		childRaw, ok := child.(map[string]any)
+		if !ok {
+			return nil, ErrNotAPlan
+		}
+		c, err := build(childRaw, childProcesses, nodes)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, c)
+	}
+	return n, nil
+}
+
+// annotate works out the exclusive metrics and highlights of every node.
+func annotate(a *Analysis, nodes []*Node) {
+	var totalTime float64
+	if a.Root.TimeMs != nil {
+		totalTime = *a.Root.TimeMs
+	}
+	var slowest, costliest, largest *Node
+	for _, n := range nodes {
+		n.ExclusiveCost = n.Cost
+		var childTime float64
+		var childBuffers Buffers
+		for _, c := range n.Children {
+			n.ExclusiveCost -= c.Cost
+			if c.TimeMs != nil {
+				childTime += *c.TimeMs
+			}
+			if c.Buffers != nil {
+				childBuffers.add(c.Buffers, 1)
+			}
+		}
+		n.ExclusiveCost = round(math.Max(n.ExclusiveCost, 0))
+		if a.TotalCost > 0 {
+			n.ExclusiveCostPercent = round(100 * n.ExclusiveCost / a.TotalCost)
+		}
+		if n.TimeMs != nil {
+			exclusive := round(math.Max(*n.TimeMs-childTime, 0))
+			n.ExclusiveTimeMs = &exclusive
+			if totalTime > 0 {
+				percent := round(100 * exclusive / totalTime)
+				n.ExclusiveTimePercent = &percent
+			}
+		}
+		if n.Buffers != nil {
+			exclusive := *n.Buffers
+			exclusive.add(&childBuffers, -1)
+			n.ExclusiveBuffers = &exclusive
+		}
+
+		if n.ActualRows != nil {
+			actual, estimated := math.Max(*n.ActualRows, 1), math.Max(n.EstimatedRows, 1)
+			factor, direction := actual/estimated, "under"
+			if estimated > actual {
+				factor, direction = estimated/actual, "over"
+			}
+			if factor > 1 {
+				factor = round(factor)
+				n.RowsFactor, n.RowsDirection = &factor, direction
+			}
+			if factor >= misestimateFactor {
+				n.Highlights = append(n.Highlights, HighlightMisestimate)
+			}
+			if n.removedByFilter >= filterDiscardFactor*actual {
+				n.Highlights = append(n.Highlights, HighlightFilterDiscards)
+			}
+		}
+		if n.spilledSort {
+			n.Highlights = append(n.Highlights, HighlightDiskSort)
+		}
+		if b := n.ExclusiveBuffers; b != nil {
+			if b.TempRead > 0 || b.TempWritten > 0 {
+				n.Highlights = append(n.Highlights, HighlightTempFiles)
+			}
+			if b.SharedRead >= diskReadBlocks && b.SharedRead > b.SharedHit {
+				n.Highlights = append(n.Highlights, HighlightDiskReads)
+			}
+		}
+
+		if n.ExclusiveTimeMs != nil && (slowest == nil || *n.ExclusiveTimeMs > *slowest.ExclusiveTimeMs) {
+			slowest = n
+		}
+		if costliest == nil || n.ExclusiveCost > costliest.ExclusiveCost {
+			costliest = n
+		}
+		if largest == nil || rowsOf(n) > rowsOf(largest) {
+			largest = n
+		}
+	}
+	if slowest != nil {
+		slowest.Highlights = append(slowest.Highlights, HighlightSlowest)
+	}
+	costliest.Highlights = append(costliest.Highlights, HighlightCostliest)
+	largest.Highlights = append(largest.Highlights, HighlightLargest)
+	for _, n := range nodes {
+		sort.Strings(n.Highlights)
+	}
+}
+
+// rowsOf returns the actual rows of n, or its estimate before ANALYZE.
+func rowsOf(n *Node) float64 {
+	if n.ActualRows != nil {
+		return *n.ActualRows
+	}
+	return n.EstimatedRows
+}
+
+// label names a node the way EXPLAIN's text form does, e.g. "Index Scan using
+// orders_pkey on orders o".
+func label(n *Node) string {
+	var b strings.Builder
+	b.WriteString(n.NodeType)
+	if n.JoinType != "" && n.JoinType != "Inner" {
+		b.WriteString(" (" + n.JoinType + ")")
+	}
+	if n.Index != "" {
+		b.WriteString(" using " + n.Index)
+	}
+	if n.Relation != "" {
+		b.WriteString(" on " + n.Relation)
+		if n.Alias != "" && n.Alias != n.Relation {
+			b.WriteString(" " + n.Alias)
+		}
+	}
+	return b.String()
+}
+
+func readBuffers(raw map[string]any) (*Buffers, bool) {
+	var (
+		b     Buffers
+		found bool
+	)
+	for key, field := range map[string]*float64{
+		"Shared Hit Blocks":     &b.SharedHit,
+		"Shared Read Blocks":    &b.SharedRead,
+		"Shared Dirtied Blocks": &b.SharedDirtied,
+		"Shared Written Blocks": &b.SharedWritten,
+		"Local Hit Blocks":      &b.LocalHit,
+		"Local Read Blocks":     &b.LocalRead,
+		"Temp Read Blocks":      &b.TempRead,
+		"Temp Written Blocks":   &b.TempWritten,
+	} {
+		if v, ok := number(raw, key); ok {
+			*field, found = v, true
+		}
+	}
+	return &b, found
+}
+
+// add adds other, times sign, to b. Exclusive counts never go below zero.
+func (b *Buffers) add(other *Buffers, sign float64) {
+	sum := func(a, c float64) float64 { return math.Max(a+sign*c, 0) }
+	b.SharedHit = sum(b.SharedHit, other.SharedHit)
+	b.SharedRead = sum(b.SharedRead, other.SharedRead)
+	b.SharedDirtied = sum(b.SharedDirtied, other.SharedDirtied)
+	b.SharedWritten = sum(b.SharedWritten, other.SharedWritten)
+	b.LocalHit = sum(b.LocalHit, other.LocalHit)
+	b.LocalRead = sum(b.LocalRead, other.LocalRead)
+	b.TempRead = sum(b.TempRead, other.TempRead)
+	b.TempWritten = sum(b.TempWritten, other.TempWritten)
+}
+
+func number(raw map[string]any, key string) (float64, bool) {
+	v, ok := raw[key].(float64)
+	return v, ok
+}
+
+func text(raw map[string]any, key string) string {
+	v, _ := raw[key].(string)
+	return v
+}
+
+// round keeps three decimals, enough for display.
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,94 @@
+package explain
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+const analyzedPlan = `[{
+  "Plan": {
+    "Node Type": "Sort", "Startup Cost": 1200, "Total Cost": 1250, "Plan Rows": 100, "Plan Width": 8,
+    "Actual Startup Time": 90, "Actual Total Time": 100, "Actual Rows": 5000, "Actual Loops": 1,
+    "Sort Key": ["o.created_at"], "Sort Method": "external merge", "Sort Space Used": 2048, "Sort Space Type": "Disk",
+    "Shared Hit Blocks": 100, "Shared Read Blocks": 3000, "Temp Read Blocks": 250, "Temp Written Blocks": 250,
+    "Plans": [{
+      "Node Type": "Gather", "Parent Relationship": "Outer", "Startup Cost": 0, "Total Cost": 1000, "Plan Rows": 100,
+      "Actual Startup Time": 1, "Actual Total Time": 60, "Actual Rows": 5000, "Actual Loops": 1,
+      "Workers Planned": 2, "Workers Launched": 2,
+      "Shared Hit Blocks": 100, "Shared Read Blocks": 3000,
+      "Plans": [{
+        "Node Type": "Seq Scan", "Parent Relationship": "Outer", "Relation Name": "orders", "Alias": "o",
+        "Startup Cost": 0, "Total Cost": 900, "Plan Rows": 40,
+        "Actual Startup Time": 0.5, "Actual Total Time": 45, "Actual Rows": 1666, "Actual Loops": 3,
+        "Filter": "(status = 'open'::text)", "Rows Removed by Filter": 60000,
+        "Shared Hit Blocks": 100, "Shared Read Blocks": 3000
+      }]
+    }]
+  },
+  "Planning Time": 0.2,
+  "Execution Time": 101.5
+}]`
+
+func TestAnalyzeAnnotatesAnAnalyzedPlan(t *testing.T) {
+	a, err := Analyze(json.RawMessage(analyzedPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Analyzed || a.Nodes != 3 || a.TotalCost != 1250 || a.ExecutionTimeMs == nil || *a.ExecutionTimeMs != 101.5 {
+		t.Fatalf("analysis = %+v", a)
+	}
+	sort, gather := a.Root, a.Root.Children[0]
+	scan := gather.Children[0]
+	if scan.ID != 3 || scan.Label != "Seq Scan on orders o" || scan.Details["Filter"] != "(status = 'open'::text)" {
+		t.Fatalf("scan = %+v", scan)
+	}
+	// The scan ran in three processes: its time is per process, its rows the total.
+	if *scan.TimeMs != 45 || *scan.ActualRows != 4998 || scan.EstimatedRows != 120 {
+		t.Fatalf("scan time %v, rows %v, estimated %v", *scan.TimeMs, *scan.ActualRows, scan.EstimatedRows)
+	}
+	if *gather.ExclusiveTimeMs != 15 || *sort.ExclusiveTimeMs != 40 || *sort.ExclusiveTimePercent != 40 {
+		t.Fatalf("exclusive times: gather %v, sort %v (%v%%)", *gather.ExclusiveTimeMs, *sort.ExclusiveTimeMs, *sort.ExclusiveTimePercent)
+	}
+	if sort.ExclusiveCost != 250 || gather.ExclusiveCost != 100 || scan.ExclusiveCostPercent != 72 {
+		t.Fatalf("exclusive costs: sort %v, gather %v, scan %v%%", sort.ExclusiveCost, gather.ExclusiveCost, scan.ExclusiveCostPercent)
+	}
+	if *scan.RowsFactor != 41.65 || scan.RowsDirection != "under" {
+		t.Fatalf("scan estimate = %v %s", *scan.RowsFactor, scan.RowsDirection)
+	}
+	if sort.ExclusiveBuffers.SharedRead != 0 || sort.ExclusiveBuffers.TempWritten != 250 || scan.ExclusiveBuffers.SharedRead != 3000 {
+		t.Fatalf("exclusive buffers: sort %+v, scan %+v", sort.ExclusiveBuffers, scan.ExclusiveBuffers)
+	}
+
+	for node, want := range map[*Node][]string{
+		sort:   {HighlightDiskSort, HighlightLargest, HighlightMisestimate, HighlightTempFiles},
+		gather: {HighlightMisestimate},
+		scan:   {HighlightCostliest, HighlightDiskReads, HighlightFilterDiscards, HighlightMisestimate, HighlightSlowest},
+	} {
+		if !slices.Equal(node.Highlights, want) {
+			t.Errorf("%s highlights = %v, want %v", node.Label, node.Highlights, want)
+		}
+	}
+}
+
+func TestAnalyzeReadsPlansWithoutActuals(t *testing.T) {
+	// EXPLAIN's JSON may also arrive as a string, as some drivers return json columns.
+	plan, _ := json.Marshal(`[{"Plan":{"Node Type":"Index Scan","Index Name":"orders_pkey","Relation Name":"orders","Alias":"orders","Total Cost":8.3,"Plan Rows":1}}]`)
+	a, err := Analyze(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Analyzed || a.Root.TimeMs != nil || a.Root.RowsFactor != nil || a.Root.Label != "Index Scan using orders_pkey on orders" {
+		t.Fatalf("root = %+v", a.Root)
+	}
+	if !slices.Equal(a.Root.Highlights, []string{HighlightCostliest, HighlightLargest}) {
+		t.Fatalf("highlights = %v", a.Root.Highlights)
+	}
+
+	for _, bad := range []string{`[]`, `{"query_block":{}}`, `[{"Plan":{"Total Cost":1}}]`, `not json`} {
+		if _, err := Analyze(json.RawMessage(bad)); !errors.Is(err, ErrNotAPlan) {
+			t.Errorf("Analyze(%s) = %v", bad, err)
+		}
+	}
+}
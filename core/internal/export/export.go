@@ -0,0 +1,333 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// Options configures an export run.
+type Options struct {
+	// Format is one of csv, json, ndjson, parquet.
+	Format string `json:"format"`
+	// IncludeHeader controls the csv header line; it defaults to true.
+	IncludeHeader *bool `json:"includeHeader"`
+	// Compression selects the parquet page codec: snappy (default), zstd, or none.
+	Compression string `json:"compression"`
+	// RowGroupRows and RowGroupBytes bound parquet row groups; a group is written once
+	// either limit is reached.
+	RowGroupRows  int `json:"rowGroupRows"`
+	RowGroupBytes int `json:"rowGroupBytes"`
+	// AliasDuplicates renames repeated column names (see resultset.DisambiguateNames) so
+	// formats keyed by name, such as json objects, do not silently drop columns.
+	AliasDuplicates bool `json:"aliasDuplicates"`
+	// SpecialFloats is how JSON formats write NaN and infinite values: "tagged" (the
+	// default) as {"$float": "NaN"}, or "null". Text formats spell them out.
+	SpecialFloats string `json:"specialFloats"`
+	InferOptions
+	// Progress, when set, is called every progressEvery rows and once more after the last row.
+	Progress func(Stats) `json:"-"`
+}
+
+const progressEvery = 1000
+
+// Stats summarizes a finished export.
+type Stats struct {
+	Rows    int          `json:"rows"`
+	Bytes   int64        `json:"bytes"`
+	Columns []ColumnType `json:"columns"`
+	// CoercionFailures counts cells that did not fit the inferred type and were written as text.
+	CoercionFailures int `json:"coercionFailures"`
+}
+
+// Writer encodes typed rows into an export format.
+type Writer interface {
+	Begin(columns []ColumnType) error
+	WriteRow(values []any) error
+	Close() error
+}
+
+// WriterFactory constructs a Writer for a format.
+type WriterFactory func(w io.Writer, opts Options) Writer
+
+var writers = map[string]WriterFactory{
+	"csv":     newCSVWriter,
+	"json":    newJSONWriter,
+	"ndjson":  newNDJSONWriter,
+	"parquet": newParquetWriter,
+}
+
+// Validate checks the options before any rows are produced.
+func (o Options) Validate() error {
+	if _, ok := writers[o.Format]; !ok {
+		return fmt.Errorf("unsupported export format %q", o.Format)
+	}
+	if o.Format == "parquet" {
+		if _, ok := parquetCodecs[o.Compression]; !ok {
+			return fmt.Errorf("unsupported parquet compression %q", o.Compression)
+		}
+	}
+	if !resultset.ValidSpecialFloats(o.SpecialFloats) {
+		return fmt.Errorf("unsupported specialFloats mode %q", o.SpecialFloats)
+	}
+	if o.RowGroupRows < 0 || o.RowGroupBytes < 0 {
+		return fmt.Errorf("row group limits must not be negative")
+	}
+	for name, t := range o.Overrides {
+		if !ValidType(t) {
+			return fmt.Errorf("unsupported type %q for column %s", t, name)
+		}
+	}
+	return nil
+}
+
+// Run infers column types for the set and writes every row to dst in the requested format.
+// The context is checked between rows so long exports can be cancelled.
+func Run(ctx context.Context, set resultset.Set, dst io.Writer, opts Options) (Stats, error) {
+	factory, ok := writers[opts.Format]
+	if !ok {
+		return Stats{}, fmt.Errorf("unsupported export format %q", opts.Format)
+	}
+
+	if opts.AliasDuplicates {
+		set.Columns = resultset.DisambiguateNames(set.Columns)
+	}
+	columns, err := InferColumnTypes(set.Columns, set.Rows, opts.InferOptions)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	counter := &countingWriter{w: dst}
+	writer := factory(counter, opts)
+	stats := Stats{Columns: columns}
+
+	if err := writer.Begin(columns); err != nil {
+		return stats, err
+	}
+
+	values := make([]any, len(columns))
+	for _, row := range set.Rows {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		for i, ct := range columns {
+			var cell any
+			if i < len(row) {
+				cell = row[i]
+			}
+			value, err := Coerce(cell, ct)
+			if err != nil {
+				stats.CoercionFailures++
+				value, _ = Coerce(cell, ColumnType{Type: TypeString})
+			}
+			values[i] = value
+		}
+		if err := writer.WriteRow(values); err != nil {
+			return stats, err
+		}
+		stats.Rows++
+		if opts.Progress != nil && stats.Rows%progressEvery == 0 {
+			stats.Bytes = counter.n
+			opts.Progress(stats)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return stats, err
+	}
+	stats.Bytes = counter.n
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+	return stats, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// textValue renders a coerced value for text formats.
+func textValue(value any, ct ColumnType) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if ct.Type == TypeDate {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339Nano)
+	case float64:
+		if special, ok := resultset.SpecialFloatOf(v); ok {
+			return special.Value
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case resultset.SpecialFloat:
+		return v.Value
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// jsonValue renders a coerced value for JSON formats, keeping decimals exact. NaN and
+// infinite values are tagged or nulled according to specialFloats.
+func jsonValue(value any, ct ColumnType, specialFloats string) any {
+	if f, ok := value.(float64); ok {
+		if special, ok := resultset.SpecialFloatOf(f); ok {
+			value = special
+		}
+	}
+	switch v := value.(type) {
+	case resultset.SpecialFloat:
+		if specialFloats == resultset.SpecialFloatsNull {
+			return nil
+		}
+		return v
+	case time.Time:
+		return textValue(v, ct)
+	case string:
+		switch ct.Type {
+		case TypeDecimal:
+			return json.Number(v)
+		case TypeJSON:
+			if json.Valid([]byte(v)) {
+				return json.RawMessage(v)
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	header  bool
+	columns []ColumnType
+	record  []string
+}
+
+func newCSVWriter(w io.Writer, opts Options) Writer {
+	return &csvWriter{
+		w:      csv.NewWriter(w),
+		header: opts.IncludeHeader == nil || *opts.IncludeHeader,
+	}
+}
+
+func (c *csvWriter) Begin(columns []ColumnType) error {
+	c.columns = columns
+	c.record = make([]string, len(columns))
+	if !c.header {
+		return nil
+	}
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+	return c.w.Write(names)
+}
+
+func (c *csvWriter) WriteRow(values []any) error {
+	for i, value := range values {
+		c.record[i] = textValue(value, c.columns[i])
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// objectWriter writes rows as JSON objects, keeping keys in column order.
+type objectWriter struct {
+	w             io.Writer
+	columns       []ColumnType
+	keys          [][]byte
+	array         bool
+	rows          int
+	specialFloats string
+}
+
+func newJSONWriter(w io.Writer, opts Options) Writer {
+	return &objectWriter{w: w, array: true, specialFloats: opts.SpecialFloats}
+}
+
+func newNDJSONWriter(w io.Writer, opts Options) Writer {
+	return &objectWriter{w: w, specialFloats: opts.SpecialFloats}
+}
+
+func (o *objectWriter) Begin(columns []ColumnType) error {
+	o.columns = columns
+	o.keys = make([][]byte, len(columns))
+	for i, col := range columns {
+		key, err := json.Marshal(col.Name)
+		if err != nil {
+			return err
+		}
+		o.keys[i] = key
+	}
+	if o.array {
+		_, err := io.WriteString(o.w, "[")
+		return err
+	}
+	return nil
+}
+
+func (o *objectWriter) WriteRow(values []any) error {
+	buf := make([]byte, 0, 256)
+	if o.array {
+		if o.rows > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, "\n  "...)
+	}
+	buf = append(buf, '{')
+	for i, value := range values {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, o.keys[i]...)
+		buf = append(buf, ':')
+		encoded, err := json.Marshal(jsonValue(value, o.columns[i], o.specialFloats))
+		if err != nil {
+			encoded, _ = json.Marshal(textValue(value, o.columns[i]))
+		}
+		buf = append(buf, encoded...)
+	}
+	buf = append(buf, '}')
+	if !o.array {
+		buf = append(buf, '\n')
+	}
+	o.rows++
+	_, err := o.w.Write(buf)
+	return err
+}
+
+func (o *objectWriter) Close() error {
+	if !o.array {
+		return nil
+	}
+	closing := "]\n"
+	if o.rows > 0 {
+		closing = "\n]\n"
+	}
+	_, err := io.WriteString(o.w, closing)
+	return err
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/pgvalue"
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func exportSet() resultset.Set {
+	return resultset.Set{
+		Columns: []resultset.Column{
+			{Name: "id", DataType: "23"},
+			{Name: "amount", DataType: "1700"},
+			{Name: "created", DataType: "25"},
+		},
+		Rows: [][]any{
+			{int64(1), "10.50", "2024-05-01"},
+			{int64(2), nil, "2024-05-02"},
+		},
+	}
+}
+
+func TestRunCSV(t *testing.T) {
+	var buf bytes.Buffer
+	stats, err := Run(context.Background(), exportSet(), &buf, Options{Format: "csv"})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	want := "id,amount,created\n1,10.50,2024-05-01\n2,,2024-05-02\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected csv:\n%q\nwant\n%q", buf.String(), want)
+	}
+	if stats.Rows != 2 || stats.Bytes != int64(len(want)) {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Columns[2].Type != TypeDate {
+		t.Fatalf("expected created to be sniffed as date, got %+v", stats.Columns[2])
+	}
+}
+
+func TestRunJSONKeepsDecimalsExact(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := Run(context.Background(), exportSet(), &buf, Options{Format: "json"}); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	want := "[\n  {\"id\":1,\"amount\":10.50,\"created\":\"2024-05-01\"},\n  {\"id\":2,\"amount\":null,\"created\":\"2024-05-02\"}\n]\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected json:\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestRunNDJSONCountsCoercionFailures(t *testing.T) {
+	set := resultset.Set{
+		Columns: []resultset.Column{{Name: "n"}},
+		Rows:    [][]any{{"1"}, {"two"}, {time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+
+	var buf bytes.Buffer
+	stats, err := Run(context.Background(), set, &buf, Options{
+		Format:       "ndjson",
+		InferOptions: InferOptions{Overrides: map[string]LogicalType{"n": TypeInteger}},
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	want := "{\"n\":1}\n{\"n\":\"two\"}\n{\"n\":\"2024-01-01T00:00:00Z\"}\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected ndjson:\n%s\nwant\n%s", buf.String(), want)
+	}
+	if stats.CoercionFailures != 2 {
+		t.Fatalf("expected two coercion failures, got %d", stats.CoercionFailures)
+	}
+}
+
+func TestRunUnsupportedFormat(t *testing.T) {
+	if _, err := Run(context.Background(), exportSet(), &bytes.Buffer{}, Options{Format: "xml"}); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+func TestRunAliasesDuplicateColumns(t *testing.T) {
+	set := resultset.Set{
+		Columns: []resultset.Column{
+			{Name: "id", Origin: &resultset.ColumnOrigin{Table: "users", Column: "id"}},
+			{Name: "id", Origin: &resultset.ColumnOrigin{Table: "orders", Column: "id"}},
+		},
+		Rows: [][]any{{int64(1), int64(7)}},
+	}
+
+	var buf bytes.Buffer
+	if _, err := Run(context.Background(), set, &buf, Options{Format: "ndjson", AliasDuplicates: true}); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if want := "{\"users.id\":1,\"orders.id\":7}\n"; buf.String() != want {
+		t.Fatalf("unexpected ndjson %q, want %q", buf.String(), want)
+	}
+}
+
+func TestRunWritesSpecialFloats(t *testing.T) {
+	set := resultset.Set{
+		Columns: []resultset.Column{{Name: "ratio", DataType: "701"}},
+		Rows: [][]any{
+			{1.5},
+			{resultset.SpecialFloat{Value: "NaN"}},
+			{math.Inf(-1)},
+		},
+	}
+	cases := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Format: "ndjson"}, `{"ratio":1.5}` + "\n" + `{"ratio":{"$float":"NaN"}}` + "\n" + `{"ratio":{"$float":"-Infinity"}}` + "\n"},
+		{Options{Format: "ndjson", SpecialFloats: resultset.SpecialFloatsNull}, `{"ratio":1.5}` + "\n" + `{"ratio":null}` + "\n" + `{"ratio":null}` + "\n"},
+		{Options{Format: "csv"}, "ratio\n1.5\nNaN\n-Infinity\n"},
+	}
+	for _, tc := range cases {
+		var buf bytes.Buffer
+		stats, err := Run(context.Background(), set, &buf, tc.opts)
+		if err != nil {
+			t.Fatalf("%+v: %v", tc.opts, err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("%+v: got\n%s\nwant\n%s", tc.opts, buf.String(), tc.want)
+		}
+		if stats.Columns[0].Type != TypeFloat || stats.CoercionFailures != 0 {
+			t.Errorf("%+v: unexpected stats %+v", tc.opts, stats)
+		}
+	}
+	if err := (Options{Format: "json", SpecialFloats: "string"}).Validate(); err == nil {
+		t.Error("expected an unknown specialFloats mode to be refused")
+	}
+}
+
+func TestRunWritesStructuredPostgresTypes(t *testing.T) {
+	set := resultset.Set{
+		Columns: []resultset.Column{
+			{Name: "price", DataType: "790"},
+			{Name: "wait", DataType: "1186"},
+			{Name: "flags", DataType: "1562"},
+			{Name: "during", DataType: "3904"},
+		},
+		Rows: [][]any{
+			{json.Number("-1234.56"), "P1DT2H", "0101", pgvalue.Range{Lower: int32(1), Upper: int32(10), Bounds: "[)"}},
+		},
+	}
+	var buf bytes.Buffer
+	stats, err := Run(context.Background(), set, &buf, Options{Format: "ndjson"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"price":-1234.56,"wait":"P1DT2H","flags":"0101","during":{"lower":1,"upper":10,"bounds":"[)"}}` + "\n"
+	if buf.String() != want || stats.CoercionFailures != 0 {
+		t.Fatalf("got %s (%+v), want %s", buf.String(), stats, want)
+	}
+}
@@ -0,0 +1,506 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultRowGroupRows  = 131072
+	defaultRowGroupBytes = 64 << 20
+
+	parquetMagic     = "PAR1"
+	parquetCreatedBy = "fluxgrid-core"
+
+	// Decimals are stored as 16-byte FIXED_LEN_BYTE_ARRAY so values beyond the sampled
+	// precision still fit; the declared precision is therefore always the maximum.
+	parquetDecimalPrecision = 38
+	parquetDecimalBytes     = 16
+)
+
+// Parquet physical types.
+const (
+	parquetBoolean    int32 = 0
+	parquetInt32      int32 = 1
+	parquetInt64      int32 = 2
+	parquetInt96      int32 = 3
+	parquetFloat      int32 = 4
+	parquetDouble     int32 = 5
+	parquetByteArray  int32 = 6
+	parquetFixedBytes int32 = 7
+)
+
+// Parquet converted types, written alongside logical types for older readers.
+const (
+	convertedUTF8            int32 = 0
+	convertedEnum            int32 = 4
+	convertedDecimal         int32 = 5
+	convertedDate            int32 = 6
+	convertedTimestampMillis int32 = 9
+	convertedTimestampMicros int32 = 10
+	convertedInt64           int32 = 18
+	convertedJSON            int32 = 19
+)
+
+const (
+	encodingPlain int32 = 0
+	encodingRLE   int32 = 3
+)
+
+// parquetCodecs maps the compression option to a Parquet CompressionCodec.
+var parquetCodecs = map[string]int32{
+	"":             1,
+	"snappy":       1,
+	"none":         0,
+	"uncompressed": 0,
+	"zstd":         6,
+}
+
+var maxDecimal = new(big.Int).Exp(big.NewInt(10), big.NewInt(parquetDecimalPrecision), nil)
+
+type parquetColumn struct {
+	ct       ColumnType
+	physical int32
+	// levels holds one definition level per buffered row: 1 when present, 0 for NULL.
+	levels []byte
+	// values holds PLAIN-encoded non-null values; booleans are kept one per byte and
+	// bit-packed when the page is written.
+	values []byte
+}
+
+type parquetChunk struct {
+	offset       int64
+	values       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+}
+
+// parquetWriter writes a single-level schema with every column OPTIONAL. Each column chunk
+// holds one PLAIN-encoded v1 data page. Cells that failed coercion reach the writer as text;
+// since a Parquet column cannot mix types they are written as NULL.
+type parquetWriter struct {
+	w        io.Writer
+	offset   int64
+	codec    int32
+	zstd     *zstd.Encoder
+	maxRows  int
+	maxBytes int
+
+	columns  []*parquetColumn
+	rows     int
+	buffered int
+	groups   []parquetRowGroup
+	total    int64
+}
+
+func newParquetWriter(w io.Writer, opts Options) Writer {
+	p := &parquetWriter{
+		w:        w,
+		codec:    -1,
+		maxRows:  opts.RowGroupRows,
+		maxBytes: opts.RowGroupBytes,
+	}
+	if codec, ok := parquetCodecs[opts.Compression]; ok {
+		p.codec = codec
+	}
+	if p.maxRows <= 0 {
+		p.maxRows = defaultRowGroupRows
+	}
+	if p.maxBytes <= 0 {
+		p.maxBytes = defaultRowGroupBytes
+	}
+	return p
+}
+
+func (p *parquetWriter) Begin(columns []ColumnType) error {
+	if p.codec < 0 {
+		return fmt.Errorf("unsupported parquet compression")
+	}
+	if p.codec == 6 {
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return err
+		}
+		p.zstd = encoder
+	}
+
+	p.columns = make([]*parquetColumn, len(columns))
+	for i, ct := range columns {
+		p.columns[i] = &parquetColumn{ct: ct, physical: parquetPhysical(ct.Type)}
+	}
+	return p.write([]byte(parquetMagic))
+}
+
+func parquetPhysical(t LogicalType) int32 {
+	switch t {
+	case TypeInteger, TypeTimestamp:
+		return parquetInt64
+	case TypeDate:
+		return parquetInt32
+	case TypeFloat:
+		return parquetDouble
+	case TypeBoolean:
+		return parquetBoolean
+	case TypeDecimal:
+		return parquetFixedBytes
+	default:
+		return parquetByteArray
+	}
+}
+
+func (p *parquetWriter) WriteRow(values []any) error {
+	for i, col := range p.columns {
+		before := len(col.values)
+		if values[i] != nil && col.append(values[i]) {
+			col.levels = append(col.levels, 1)
+		} else {
+			col.values = col.values[:before]
+			col.levels = append(col.levels, 0)
+		}
+		p.buffered += len(col.values) - before + 1
+	}
+	p.rows++
+
+	if p.rows >= p.maxRows || p.buffered >= p.maxBytes {
+		return p.flushRowGroup()
+	}
+	return nil
+}
+
+// append PLAIN-encodes a coerced value and reports whether it matched the column type.
+func (c *parquetColumn) append(value any) bool {
+	switch c.ct.Type {
+	case TypeInteger:
+		v, ok := value.(int64)
+		if ok {
+			c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v))
+		}
+		return ok
+	case TypeTimestamp:
+		v, ok := value.(time.Time)
+		if ok {
+			c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v.UnixMicro()))
+		}
+		return ok
+	case TypeDate:
+		v, ok := value.(time.Time)
+		if ok {
+			seconds := v.Unix()
+			days := seconds / 86400
+			if seconds%86400 < 0 {
+				days--
+			}
+			c.values = binary.LittleEndian.AppendUint32(c.values, uint32(int32(days)))
+		}
+		return ok
+	case TypeFloat:
+		v, ok := value.(float64)
+		if ok {
+			c.values = binary.LittleEndian.AppendUint64(c.values, math.Float64bits(v))
+		}
+		return ok
+	case TypeBoolean:
+		v, ok := value.(bool)
+		if ok {
+			bit := byte(0)
+			if v {
+				bit = 1
+			}
+			c.values = append(c.values, bit)
+		}
+		return ok
+	case TypeDecimal:
+		text, ok := value.(string)
+		if !ok {
+			return false
+		}
+		unscaled, ok := decimalBytes(text, c.ct.Scale)
+		if ok {
+			c.values = append(c.values, unscaled...)
+		}
+		return ok
+	default:
+		var data []byte
+		switch v := value.(type) {
+		case string:
+			data = []byte(v)
+		case []byte:
+			data = v
+		default:
+			return false
+		}
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(data)))
+		c.values = append(c.values, data...)
+		return true
+	}
+}
+
+// decimalBytes scales a decimal string to an unscaled integer, rounding half away from zero,
+// and returns it as a 16-byte big-endian two's complement value.
+func decimalBytes(text string, scale int) ([]byte, bool) {
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return nil, false
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Abs(m).Lsh(m, 1).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	if q.CmpAbs(maxDecimal) >= 0 {
+		return nil, false
+	}
+	if q.Sign() < 0 {
+		q.Add(q, new(big.Int).Lsh(big.NewInt(1), parquetDecimalBytes*8))
+	}
+	return q.FillBytes(make([]byte, parquetDecimalBytes)), true
+}
+
+func (p *parquetWriter) flushRowGroup() error {
+	if p.rows == 0 {
+		return nil
+	}
+
+	group := parquetRowGroup{rows: int64(p.rows), chunks: make([]parquetChunk, len(p.columns))}
+	for i, col := range p.columns {
+		chunk, err := p.writePage(col, p.rows)
+		if err != nil {
+			return err
+		}
+		group.chunks[i] = chunk
+		col.levels = col.levels[:0]
+		col.values = col.values[:0]
+	}
+
+	p.groups = append(p.groups, group)
+	p.total += int64(p.rows)
+	p.rows = 0
+	p.buffered = 0
+	return nil
+}
+
+func (p *parquetWriter) writePage(col *parquetColumn, rows int) (parquetChunk, error) {
+	levels := encodeLevels(col.levels)
+	page := make([]byte, 0, 4+len(levels)+len(col.values))
+	page = binary.LittleEndian.AppendUint32(page, uint32(len(levels)))
+	page = append(page, levels...)
+	if col.physical == parquetBoolean {
+		page = append(page, packBits(col.values)...)
+	} else {
+		page = append(page, col.values...)
+	}
+
+	body, err := p.compress(page)
+	if err != nil {
+		return parquetChunk{}, err
+	}
+
+	var header compactWriter
+	header.i32(1, 0) // DATA_PAGE
+	header.i32(2, int32(len(page)))
+	header.i32(3, int32(len(body)))
+	header.beginStruct(5)
+	header.i32(1, int32(rows))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.endStruct()
+	header.stop()
+
+	chunk := parquetChunk{
+		offset:       p.offset,
+		values:       int64(rows),
+		uncompressed: int64(len(header.buf) + len(page)),
+		compressed:   int64(len(header.buf) + len(body)),
+	}
+	if err := p.write(header.buf); err != nil {
+		return chunk, err
+	}
+	return chunk, p.write(body)
+}
+
+func (p *parquetWriter) compress(page []byte) ([]byte, error) {
+	switch p.codec {
+	case 0:
+		return page, nil
+	case 1:
+		return snappy.Encode(nil, page), nil
+	case 6:
+		return p.zstd.EncodeAll(page, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported parquet codec %d", p.codec)
+	}
+}
+
+// encodeLevels writes definition levels with the RLE/bit-packing hybrid, using RLE runs only.
+func encodeLevels(levels []byte) []byte {
+	var out []byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, levels[i])
+		i = j
+	}
+	return out
+}
+
+// packBits packs one-byte booleans LSB first, as PLAIN encoding requires.
+func packBits(bits []byte) []byte {
+	out := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit != 0 {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	if p.zstd != nil {
+		defer p.zstd.Close()
+	}
+	if err := p.flushRowGroup(); err != nil {
+		return err
+	}
+
+	footer := p.footer()
+	if err := p.write(footer); err != nil {
+		return err
+	}
+	trailer := binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))
+	return p.write(append(trailer, parquetMagic...))
+}
+
+// footer encodes the FileMetaData struct.
+func (p *parquetWriter) footer() []byte {
+	var c compactWriter
+	c.i32(1, 1)
+
+	c.list(2, thriftStruct, len(p.columns)+1)
+	c.beginElement()
+	c.string(4, "schema")
+	c.i32(5, int32(len(p.columns)))
+	c.endStruct()
+	for _, col := range p.columns {
+		c.beginElement()
+		writeSchemaElement(&c, col)
+		c.endStruct()
+	}
+
+	c.i64(3, p.total)
+
+	c.list(4, thriftStruct, len(p.groups))
+	for _, group := range p.groups {
+		c.beginElement()
+		var uncompressed, compressed int64
+		c.list(1, thriftStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			uncompressed += chunk.uncompressed
+			compressed += chunk.compressed
+			c.beginElement()
+			c.i64(2, chunk.offset)
+			c.beginStruct(3)
+			c.i32(1, p.columns[i].physical)
+			c.list(2, thriftI32, 2)
+			c.appendI32(encodingPlain)
+			c.appendI32(encodingRLE)
+			c.list(3, thriftBinary, 1)
+			c.appendString(p.columns[i].ct.Name)
+			c.i32(4, p.codec)
+			c.i64(5, chunk.values)
+			c.i64(6, chunk.uncompressed)
+			c.i64(7, chunk.compressed)
+			c.i64(9, chunk.offset)
+			c.endStruct()
+			c.endStruct()
+		}
+		c.i64(2, uncompressed)
+		c.i64(3, group.rows)
+		c.i64(5, group.chunks[0].offset)
+		c.i64(6, compressed)
+		c.endStruct()
+	}
+
+	c.string(6, parquetCreatedBy)
+	c.stop()
+	return c.buf
+}
+
+// writeSchemaElement encodes a leaf SchemaElement, including both the converted type and
+// the logical type annotation.
+func writeSchemaElement(c *compactWriter, col *parquetColumn) {
+	c.i32(1, col.physical)
+	if col.physical == parquetFixedBytes {
+		c.i32(2, parquetDecimalBytes)
+	}
+	c.i32(3, 1) // OPTIONAL
+	c.string(4, col.ct.Name)
+
+	switch col.ct.Type {
+	case TypeInteger:
+		c.i32(6, convertedInt64)
+		c.beginStruct(10)
+		c.beginStruct(10)
+		c.i8(1, 64)
+		c.bool(2, true)
+		c.endStruct()
+		c.endStruct()
+	case TypeDecimal:
+		c.i32(6, convertedDecimal)
+		c.i32(7, int32(col.ct.Scale))
+		c.i32(8, parquetDecimalPrecision)
+		c.beginStruct(10)
+		c.beginStruct(5)
+		c.i32(1, int32(col.ct.Scale))
+		c.i32(2, parquetDecimalPrecision)
+		c.endStruct()
+		c.endStruct()
+	case TypeDate:
+		c.i32(6, convertedDate)
+		c.beginStruct(10)
+		c.emptyStruct(6)
+		c.endStruct()
+	case TypeTimestamp:
+		c.i32(6, convertedTimestampMicros)
+		c.beginStruct(10)
+		c.beginStruct(8)
+		c.bool(1, true)
+		c.beginStruct(2)
+		c.emptyStruct(2) // MICROS
+		c.endStruct()
+		c.endStruct()
+		c.endStruct()
+	case TypeJSON:
+		c.i32(6, convertedJSON)
+		c.beginStruct(10)
+		c.emptyStruct(12)
+		c.endStruct()
+	case TypeString, TypeUUID:
+		c.i32(6, convertedUTF8)
+		c.beginStruct(10)
+		c.emptyStruct(1)
+		c.endStruct()
+	}
+}
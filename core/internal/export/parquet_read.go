@@ -0,0 +1,552 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Parquet page types and the encodings read besides PLAIN and RLE.
+const (
+	pageData       int64 = 0
+	pageDictionary int64 = 2
+	pageDataV2     int64 = 3
+
+	encodingPlainDictionary int64 = 2
+	encodingRLEDictionary   int64 = 8
+)
+
+// maxParquetCells bounds the cells a file read with ReadParquet may hold. Run-length
+// encoding lets a small file claim any number of NULLs.
+const maxParquetCells = 1 << 26
+
+// maxParquetPageBytes bounds the decompressed size of a page.
+const maxParquetPageBytes = 1 << 30
+
+var errParquetCorrupt = errors.New("corrupt parquet file")
+
+// parquetCodecNames names the codecs ReadParquet cannot decompress.
+var parquetCodecNames = map[int64]string{3: "LZO", 4: "Brotli", 5: "LZ4", 7: "LZ4_RAW"}
+
+// parquetLeaf is a column of a flat Parquet schema and how its values are read.
+type parquetLeaf struct {
+	ct       ColumnType
+	physical int32
+	// width is the length of FIXED_LEN_BYTE_ARRAY values.
+	width    int
+	optional bool
+	// convert turns a physical value into the value of the column's type.
+	convert func(value any) any
+}
+
+// ReadParquet reads the columns and rows of a Parquet file with a flat schema, as export
+// writes and most tools write for tables. Values are int64, float64, bool, string, []byte
+// or time.Time according to the column type; decimals are strings, so that they keep
+// their precision. Nested columns, the DELTA and BYTE_STREAM_SPLIT encodings and codecs
+// other than Snappy, gzip and zstd are refused.
+func ReadParquet(data []byte) ([]ColumnType, [][]any, error) {
+	if len(data) < 12 || string(data[:4]) != parquetMagic || string(data[len(data)-4:]) != parquetMagic {
+		return nil, nil, errors.New("not a parquet file")
+	}
+	size := int64(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if size > int64(len(data)-12) {
+		return nil, nil, errParquetCorrupt
+	}
+	r := &compactReader{buf: data[len(data)-8-int(size) : len(data)-8]}
+	meta := r.readStruct()
+	if r.err != nil {
+		return nil, nil, errParquetCorrupt
+	}
+	leaves, err := parquetLeaves(fieldList(meta, 2))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxParquetPageBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer decoder.Close()
+
+	var rows [][]any
+	for _, group := range fieldList(meta, 4) {
+		group, _ := group.(map[int16]any)
+		count := fieldInt(group, 3)
+		chunks := fieldList(group, 1)
+		if len(chunks) != len(leaves) || count < 0 {
+			return nil, nil, errParquetCorrupt
+		}
+		if (int64(len(rows))+count)*int64(max(len(leaves), 1)) > maxParquetCells {
+			return nil, nil, fmt.Errorf("the file holds more than %d cells", maxParquetCells)
+		}
+		start := len(rows)
+		for range count {
+			rows = append(rows, make([]any, len(leaves)))
+		}
+		for i, chunk := range chunks {
+			chunk, _ := chunk.(map[int16]any)
+			values, err := leaves[i].readChunk(data, chunk, int(count), decoder)
+			if err != nil {
+				return nil, nil, fmt.Errorf("column %s: %w", leaves[i].ct.Name, err)
+			}
+			for j, value := range values {
+				rows[start+j][i] = value
+			}
+		}
+	}
+
+	columns := make([]ColumnType, len(leaves))
+	for i, leaf := range leaves {
+		columns[i] = leaf.ct
+	}
+	return columns, rows, nil
+}
+
+// parquetLeaves reads the columns of a flat schema, whose root holds every column.
+func parquetLeaves(schema []any) ([]parquetLeaf, error) {
+	if len(schema) == 0 {
+		return nil, errParquetCorrupt
+	}
+	leaves := make([]parquetLeaf, 0, len(schema)-1)
+	for _, element := range schema[1:] {
+		element, _ := element.(map[int16]any)
+		name := fieldString(element, 4)
+		if fieldInt(element, 5) > 0 || fieldInt(element, 3) == 2 {
+			return nil, fmt.Errorf("column %s is nested; only flat schemas can be read", name)
+		}
+		leaf := parquetLeaf{
+			ct:       ColumnType{Name: name, Source: "file", Nullable: fieldInt(element, 3) == 1},
+			physical: int32(fieldInt(element, 1)),
+			width:    int(fieldInt(element, 2)),
+			optional: fieldInt(element, 3) == 1,
+		}
+		if err := leaf.annotate(element); err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, leaf)
+	}
+	return leaves, nil
+}
+
+// annotate picks the type of the column from its physical type and its logical type, or
+// the converted type older writers use instead.
+func (l *parquetLeaf) annotate(element map[int16]any) error {
+	if l.physical == parquetFixedBytes && l.width <= 0 {
+		return fmt.Errorf("column %s has no length", l.ct.Name)
+	}
+	logical := fieldStruct(element, 10)
+	converted, hasConverted := element[6].(int64)
+	is := func(logicalID int16, convertedIDs ...int32) bool {
+		if _, ok := logical[logicalID]; ok {
+			return true
+		}
+		for _, id := range convertedIDs {
+			if hasConverted && converted == int64(id) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case is(5, convertedDecimal):
+		scale := int(fieldInt(element, 7))
+		if decimal := fieldStruct(logical, 5); decimal != nil {
+			scale = int(fieldInt(decimal, 1))
+		}
+		l.ct.Type, l.ct.Scale, l.ct.Precision = TypeDecimal, scale, int(fieldInt(element, 8))
+		l.convert = func(value any) any { return decimalText(unscaled(value), scale) }
+		return nil
+	case l.physical == parquetInt32 && is(6, convertedDate):
+		l.ct.Type = TypeDate
+		l.convert = func(value any) any { return time.Unix(value.(int64)*86400, 0).UTC() }
+		return nil
+	case l.physical == parquetInt64 && is(8, convertedTimestampMillis, convertedTimestampMicros):
+		unit := time.Millisecond
+		if hasConverted && converted == int64(convertedTimestampMicros) {
+			unit = time.Microsecond
+		}
+		if units := fieldStruct(fieldStruct(logical, 8), 2); units != nil {
+			switch {
+			case units[2] != nil:
+				unit = time.Microsecond
+			case units[3] != nil:
+				unit = time.Nanosecond
+			}
+		}
+		l.ct.Type = TypeTimestamp
+		l.convert = func(value any) any { return time.Unix(0, value.(int64)*int64(unit)).UTC() }
+		return nil
+	}
+
+	switch l.physical {
+	case parquetBoolean:
+		l.ct.Type = TypeBoolean
+	case parquetInt32, parquetInt64:
+		l.ct.Type = TypeInteger
+	case parquetInt96:
+		// Impala and Spark write timestamps as nanoseconds of the day and a Julian day.
+		l.ct.Type = TypeTimestamp
+		l.convert = func(value any) any {
+			b := value.([]byte)
+			days := int64(binary.LittleEndian.Uint32(b[8:])) - 2440588
+			return time.Unix(days*86400, int64(binary.LittleEndian.Uint64(b))).UTC()
+		}
+	case parquetFloat, parquetDouble:
+		l.ct.Type = TypeFloat
+	case parquetByteArray, parquetFixedBytes:
+		switch {
+		case is(1, convertedUTF8, convertedEnum) || is(4):
+			l.ct.Type = TypeString
+			l.convert = func(value any) any { return string(value.([]byte)) }
+		case is(12, convertedJSON):
+			l.ct.Type = TypeJSON
+			l.convert = func(value any) any { return string(value.([]byte)) }
+		case l.width == 16 && is(14):
+			l.ct.Type = TypeUUID
+			l.convert = func(value any) any {
+				b := value.([]byte)
+				return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+			}
+		default:
+			l.ct.Type = TypeBinary
+		}
+	default:
+		return fmt.Errorf("column %s has unknown physical type %d", l.ct.Name, l.physical)
+	}
+	return nil
+}
+
+// readChunk reads the values of a column chunk, with nil for NULLs.
+func (l *parquetLeaf) readChunk(data []byte, chunk map[int16]any, rows int, decoder *zstd.Decoder) ([]any, error) {
+	meta := fieldStruct(chunk, 3)
+	if meta == nil {
+		return nil, errors.New("the column chunk is in another file")
+	}
+	codec := fieldInt(meta, 4)
+	if name, ok := parquetCodecNames[codec]; ok {
+		return nil, fmt.Errorf("%s compression is not supported", name)
+	}
+	offset := fieldInt(meta, 9)
+	if dictionary, ok := meta[11].(int64); ok && dictionary > 0 && dictionary < offset {
+		offset = dictionary
+	}
+
+	var dictionary []any
+	values := make([]any, 0, rows)
+	for len(values) < rows {
+		if offset < 0 || offset >= int64(len(data)) {
+			return nil, errParquetCorrupt
+		}
+		r := &compactReader{buf: data, pos: int(offset)}
+		header := r.readStruct()
+		body := r.bytes(int(fieldInt(header, 3)))
+		if r.err != nil {
+			return nil, errParquetCorrupt
+		}
+		offset = int64(r.pos)
+		size := fieldInt(header, 2)
+
+		switch fieldInt(header, 1) {
+		case pageDictionary:
+			page, err := decompress(codec, body, size, decoder)
+			if err != nil {
+				return nil, err
+			}
+			if dictionary, err = l.plain(page, int(fieldInt(fieldStruct(header, 7), 1))); err != nil {
+				return nil, err
+			}
+		case pageData:
+			page, err := decompress(codec, body, size, decoder)
+			if err != nil {
+				return nil, err
+			}
+			h := fieldStruct(header, 5)
+			count := int(fieldInt(h, 1))
+			var levels []int
+			if l.optional {
+				if len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+					return nil, errParquetCorrupt
+				}
+				n := int(binary.LittleEndian.Uint32(page))
+				if levels, err = readHybrid(page[4:4+n], 1, count); err != nil {
+					return nil, err
+				}
+				page = page[4+n:]
+			}
+			if values, err = l.appendValues(values, levels, page, fieldInt(h, 2), dictionary, count); err != nil {
+				return nil, err
+			}
+		case pageDataV2:
+			h := fieldStruct(header, 8)
+			count := int(fieldInt(h, 1))
+			defined, repeated := fieldInt(h, 5), fieldInt(h, 6)
+			if repeated != 0 || defined < 0 || defined > int64(len(body)) {
+				return nil, errParquetCorrupt
+			}
+			var levels []int
+			var err error
+			if l.optional {
+				if levels, err = readHybrid(body[:defined], 1, count); err != nil {
+					return nil, err
+				}
+			}
+			page := body[defined:]
+			if compressed, ok := h[7].(bool); !ok || compressed {
+				if page, err = decompress(codec, page, size-defined, decoder); err != nil {
+					return nil, err
+				}
+			}
+			if values, err = l.appendValues(values, levels, page, fieldInt(h, 4), dictionary, count); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(values) != rows {
+		return nil, errParquetCorrupt
+	}
+	return values, nil
+}
+
+// appendValues decodes the values of a data page and appends count cells to values: a
+// value for every definition level of 1, or for every cell of a required column, and nil
+// for the others.
+func (l *parquetLeaf) appendValues(values []any, levels []int, page []byte, encoding int64, dictionary []any, count int) ([]any, error) {
+	present := count
+	if levels != nil {
+		present = 0
+		for _, level := range levels {
+			present += level
+		}
+	}
+
+	var decoded []any
+	var err error
+	switch encoding {
+	case int64(encodingPlain):
+		decoded, err = l.plain(page, present)
+	case encodingPlainDictionary, encodingRLEDictionary:
+		if dictionary == nil || len(page) == 0 {
+			return nil, errParquetCorrupt
+		}
+		indexes, err := readHybrid(page[1:], int(page[0]), present)
+		if err != nil {
+			return nil, err
+		}
+		decoded = make([]any, len(indexes))
+		for i, index := range indexes {
+			if index >= len(dictionary) {
+				return nil, errParquetCorrupt
+			}
+			decoded[i] = dictionary[index]
+		}
+	case int64(encodingRLE):
+		if l.physical != parquetBoolean || len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+			return nil, errParquetCorrupt
+		}
+		bits, err := readHybrid(page[4:4+binary.LittleEndian.Uint32(page)], 1, present)
+		if err != nil {
+			return nil, err
+		}
+		decoded = make([]any, len(bits))
+		for i, bit := range bits {
+			decoded[i] = bit == 1
+		}
+	default:
+		return nil, fmt.Errorf("encoding %d is not supported", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if levels == nil {
+		return append(values, decoded...), nil
+	}
+	next := 0
+	for _, level := range levels {
+		if level == 1 {
+			values = append(values, decoded[next])
+			next++
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values, nil
+}
+
+// plain decodes count PLAIN-encoded values and converts them to the column's type.
+func (l *parquetLeaf) plain(page []byte, count int) ([]any, error) {
+	size := map[int32]int{parquetInt32: 4, parquetInt64: 8, parquetInt96: 12, parquetFloat: 4, parquetDouble: 8, parquetFixedBytes: l.width}[l.physical]
+	switch {
+	case count < 0:
+		return nil, errParquetCorrupt
+	case l.physical == parquetBoolean && (count+7)/8 > len(page):
+		return nil, errParquetCorrupt
+	case l.physical == parquetByteArray && count > len(page)/4:
+		return nil, errParquetCorrupt
+	case size > 0 && count > len(page)/size:
+		return nil, errParquetCorrupt
+	}
+
+	values := make([]any, count)
+	for i := range values {
+		var value any
+		switch l.physical {
+		case parquetBoolean:
+			value = page[i/8]>>(i%8)&1 == 1
+		case parquetInt32:
+			value = int64(int32(binary.LittleEndian.Uint32(page[i*4:])))
+		case parquetInt64:
+			value = int64(binary.LittleEndian.Uint64(page[i*8:]))
+		case parquetFloat:
+			value = float64(math.Float32frombits(binary.LittleEndian.Uint32(page[i*4:])))
+		case parquetDouble:
+			value = math.Float64frombits(binary.LittleEndian.Uint64(page[i*8:]))
+		case parquetInt96, parquetFixedBytes:
+			value = page[i*size : (i+1)*size]
+		case parquetByteArray:
+			if len(page) < 4 || int(binary.LittleEndian.Uint32(page)) > len(page)-4 {
+				return nil, errParquetCorrupt
+			}
+			n := int(binary.LittleEndian.Uint32(page))
+			value, page = page[4:4+n], page[4+n:]
+		}
+		if l.convert != nil {
+			value = l.convert(value)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// readHybrid decodes count values of the RLE/bit-packing hybrid encoding.
+func readHybrid(data []byte, width, count int) ([]int, error) {
+	if width > 32 || count < 0 {
+		return nil, errParquetCorrupt
+	}
+	out := make([]int, 0, count)
+	byteWidth := (width + 7) / 8
+	for len(out) < count {
+		header, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errParquetCorrupt
+		}
+		data = data[n:]
+		if header&1 == 0 {
+			if len(data) < byteWidth {
+				return nil, errParquetCorrupt
+			}
+			value := 0
+			for i := range byteWidth {
+				value |= int(data[i]) << (8 * i)
+			}
+			data = data[byteWidth:]
+			for range min(header>>1, uint64(count-len(out))) {
+				out = append(out, value)
+			}
+			continue
+		}
+		groups := header >> 1
+		if groups > uint64(len(data)) || int(groups)*width > len(data) {
+			return nil, errParquetCorrupt
+		}
+		packed := data[:int(groups)*width]
+		data = data[int(groups)*width:]
+		for i := 0; i < int(groups)*8 && len(out) < count; i++ {
+			value := 0
+			for b := range width {
+				bit := i*width + b
+				value |= int(packed[bit/8]>>(bit%8)&1) << b
+			}
+			out = append(out, value)
+		}
+	}
+	return out, nil
+}
+
+func decompress(codec int64, body []byte, size int64, decoder *zstd.Decoder) ([]byte, error) {
+	if size < 0 || size > maxParquetPageBytes {
+		return nil, errParquetCorrupt
+	}
+	switch codec {
+	case 0:
+		return body, nil
+	case 1:
+		if n, err := snappy.DecodedLen(body); err != nil || int64(n) != size {
+			return nil, errParquetCorrupt
+		}
+		return snappy.Decode(nil, body)
+	case 2:
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(io.LimitReader(reader, size))
+	case 6:
+		return decoder.DecodeAll(body, nil)
+	default:
+		return nil, fmt.Errorf("compression codec %d is not supported", codec)
+	}
+}
+
+// unscaled returns the unscaled value of a decimal, stored as an integer or as big-endian
+// two's complement bytes.
+func unscaled(value any) *big.Int {
+	switch v := value.(type) {
+	case int64:
+		return big.NewInt(v)
+	case []byte:
+		n := new(big.Int).SetBytes(v)
+		if len(v) > 0 && v[0]&0x80 != 0 {
+			n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(len(v))*8))
+		}
+		return n
+	default:
+		return new(big.Int)
+	}
+}
+
+// decimalText formats an unscaled decimal with scale digits after the point.
+func decimalText(n *big.Int, scale int) string {
+	if scale <= 0 {
+		return n.String()
+	}
+	digits := new(big.Int).Abs(n).String()
+	for len(digits) <= scale {
+		digits = "0" + digits
+	}
+	text := digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	if n.Sign() < 0 {
+		text = "-" + text
+	}
+	return text
+}
+
+func fieldInt(fields map[int16]any, id int16) int64 {
+	v, _ := fields[id].(int64)
+	return v
+}
+
+func fieldString(fields map[int16]any, id int16) string {
+	v, _ := fields[id].(string)
+	return v
+}
+
+func fieldList(fields map[int16]any, id int16) []any {
+	v, _ := fields[id].([]any)
+	return v
+}
+
+func fieldStruct(fields map[int16]any, id int16) map[int16]any {
+	v, _ := fields[id].(map[int16]any)
+	return v
+}
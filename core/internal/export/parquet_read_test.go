@@ -0,0 +1,154 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadParquetReadsExports(t *testing.T) {
+	want := [][]any{
+		{int64(1), "10.25", "alpha", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), true},
+		{int64(2), nil, nil, nil, nil, false},
+		{int64(3), "-0.50", "gamma", time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC), true},
+	}
+	for _, codec := range []string{"none", "snappy", "zstd"} {
+		var buf bytes.Buffer
+		// Two row groups, so that the rows of both are read.
+		if _, err := Run(context.Background(), parquetSet(), &buf, Options{Format: "parquet", Compression: codec, RowGroupRows: 2}); err != nil {
+			t.Fatalf("%s: Run returned error: %v", codec, err)
+		}
+		columns, rows, err := ReadParquet(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: ReadParquet returned error: %v", codec, err)
+		}
+		var types []string
+		for _, column := range columns {
+			types = append(types, column.Name+" "+string(column.Type))
+		}
+		if got := strings.Join(types, ", "); got != "id integer, price decimal, name string, day date, seen timestamp, active boolean" {
+			t.Fatalf("%s: columns = %s", codec, got)
+		}
+		if fmt.Sprint(rows) != fmt.Sprint(want) {
+			t.Fatalf("%s: rows = %v, want %v", codec, rows, want)
+		}
+	}
+}
+
+// parquetFile assembles a file holding pages, the column chunk of one row group, with the
+// given schema elements after the root.
+func parquetFile(rows int, pages [][]byte, dictionary bool, schema func(c *compactWriter)) []byte {
+	data := []byte(parquetMagic)
+	for _, page := range pages {
+		data = append(data, page...)
+	}
+
+	var c compactWriter
+	c.i32(1, 1)
+	c.list(2, thriftStruct, 2)
+	c.beginElement()
+	c.string(4, "schema")
+	c.i32(5, 1)
+	c.endStruct()
+	c.beginElement()
+	schema(&c)
+	c.endStruct()
+	c.i64(3, int64(rows))
+	c.list(4, thriftStruct, 1)
+	c.beginElement()
+	c.list(1, thriftStruct, 1)
+	c.beginElement()
+	c.i64(2, 4)
+	c.beginStruct(3)
+	c.i32(1, parquetByteArray)
+	c.i32(4, 0)
+	c.i64(5, int64(rows))
+	if dictionary {
+		c.i64(9, int64(4+len(pages[0])))
+		c.i64(11, 4)
+	} else {
+		c.i64(9, 4)
+	}
+	c.endStruct()
+	c.endStruct()
+	c.i64(3, int64(rows))
+	c.endStruct()
+	c.stop()
+
+	data = append(data, c.buf...)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(c.buf)))
+	return append(data, parquetMagic...)
+}
+
+func TestReadParquetDecodesDictionaryPagesV2(t *testing.T) {
+	dictionary := []byte("\x04\x00\x00\x00oslo\x04\x00\x00\x00lima")
+	var header compactWriter
+	header.i32(1, int32(pageDictionary))
+	header.i32(2, int32(len(dictionary)))
+	header.i32(3, int32(len(dictionary)))
+	header.beginStruct(7)
+	header.i32(1, 2)
+	header.i32(2, encodingPlain)
+	header.endStruct()
+	header.stop()
+	dictionaryPage := append(header.buf, dictionary...)
+
+	// Definition levels 1,0,1,1,1 and dictionary indexes 0,1,0,0, both bit-packed.
+	levels, values := []byte{0x03, 0x1d}, []byte{0x01, 0x03, 0x02}
+	header = compactWriter{}
+	header.i32(1, int32(pageDataV2))
+	header.i32(2, int32(len(levels)+len(values)))
+	header.i32(3, int32(len(levels)+len(values)))
+	header.beginStruct(8)
+	header.i32(1, 5)
+	header.i32(2, 1)
+	header.i32(3, 5)
+	header.i32(4, int32(encodingRLEDictionary))
+	header.i32(5, int32(len(levels)))
+	header.i32(6, 0)
+	header.bool(7, false)
+	header.endStruct()
+	header.stop()
+	dataPage := append(append(header.buf, levels...), values...)
+
+	file := parquetFile(5, [][]byte{dictionaryPage, dataPage}, true, func(c *compactWriter) {
+		c.i32(1, parquetByteArray)
+		c.i32(3, 1)
+		c.string(4, "city")
+		c.i32(6, convertedUTF8)
+	})
+	columns, rows, err := ReadParquet(file)
+	if err != nil {
+		t.Fatalf("ReadParquet returned error: %v", err)
+	}
+	if len(columns) != 1 || columns[0].Type != TypeString || !columns[0].Nullable {
+		t.Fatalf("columns = %+v", columns)
+	}
+	if got := fmt.Sprint(rows); got != "[[oslo] [<nil>] [lima] [oslo] [oslo]]" {
+		t.Fatalf("rows = %s", got)
+	}
+}
+
+func TestReadParquetRefusesWhatItCannotRead(t *testing.T) {
+	nested := parquetFile(0, nil, false, func(c *compactWriter) {
+		c.i32(3, 1)
+		c.string(4, "tags")
+		c.i32(5, 1)
+	})
+	for name, tc := range map[string]struct {
+		data []byte
+		want string
+	}{
+		"not parquet": {[]byte("PAR1"), "not a parquet file"},
+		"nested":      {nested, "column tags is nested"},
+		"truncated":   {append([]byte(parquetMagic+"\xff\xff\xff\x00"), parquetMagic...), "corrupt parquet file"},
+	} {
+		if _, _, err := ReadParquet(tc.data); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: error = %v, want %q", name, err, tc.want)
+		}
+	}
+}
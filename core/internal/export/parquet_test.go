@@ -0,0 +1,198 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+func readFooter(t *testing.T, data []byte) map[int16]any {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte(parquetMagic)) || !bytes.HasSuffix(data, []byte(parquetMagic)) {
+		t.Fatalf("missing parquet magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-size : len(data)-8]
+	return (&compactReader{buf: footer}).readStruct()
+}
+
+// readPage decodes the data page at offset and returns its decompressed body.
+func readPage(t *testing.T, data []byte, offset int64, codec int64) []byte {
+	t.Helper()
+	r := &compactReader{buf: data, pos: int(offset)}
+	header := r.readStruct()
+	body := data[r.pos : r.pos+int(header[3].(int64))]
+
+	switch codec {
+	case 1:
+		decoded, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Fatalf("snappy decode: %v", err)
+		}
+		return decoded
+	case 6:
+		decoder, _ := zstd.NewReader(nil)
+		defer decoder.Close()
+		decoded, err := decoder.DecodeAll(body, nil)
+		if err != nil {
+			t.Fatalf("zstd decode: %v", err)
+		}
+		return decoded
+	default:
+		return body
+	}
+}
+
+func parquetSet() resultset.Set {
+	return resultset.Set{
+		Columns: []resultset.Column{
+			{Name: "id", DataType: "20"},
+			{Name: "price", DataType: "1700"},
+			{Name: "name", DataType: "25"},
+			{Name: "day", DataType: "1082"},
+			{Name: "seen", DataType: "1184"},
+			{Name: "active", DataType: "16"},
+		},
+		Rows: [][]any{
+			{int64(1), "10.25", "alpha", "2024-05-01", time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), true},
+			{int64(2), nil, nil, "not a date", nil, false},
+			{int64(3), "-0.5", "gamma", "1969-12-31", time.Date(1970, 1, 1, 0, 0, 1, 0, time.UTC), true},
+		},
+	}
+}
+
+func TestRunParquetMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	stats, err := Run(context.Background(), parquetSet(), &buf, Options{
+		Format:       "parquet",
+		Compression:  "none",
+		RowGroupRows: 2,
+	})
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if stats.Rows != 3 || stats.Bytes != int64(buf.Len()) || stats.CoercionFailures != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	meta := readFooter(t, buf.Bytes())
+	if meta[3].(int64) != 3 {
+		t.Fatalf("unexpected num_rows %v", meta[3])
+	}
+
+	schema := meta[2].([]any)
+	if len(schema) != 7 || schema[0].(map[int16]any)[5].(int64) != 6 {
+		t.Fatalf("unexpected schema root %+v", schema)
+	}
+	price := schema[2].(map[int16]any)
+	decimal := price[10].(map[int16]any)[5].(map[int16]any)
+	if price[1].(int64) != int64(parquetFixedBytes) || decimal[1].(int64) != 2 || decimal[2].(int64) != 38 {
+		t.Fatalf("unexpected decimal element %+v", price)
+	}
+	seen := schema[5].(map[int16]any)
+	timestamp := seen[10].(map[int16]any)[8].(map[int16]any)
+	if timestamp[1] != true || timestamp[2].(map[int16]any)[2] == nil {
+		t.Fatalf("unexpected timestamp element %+v", seen)
+	}
+	if schema[3].(map[int16]any)[10].(map[int16]any)[1] == nil {
+		t.Fatalf("expected string logical type on name")
+	}
+
+	groups := meta[4].([]any)
+	if len(groups) != 2 || groups[0].(map[int16]any)[3].(int64) != 2 || groups[1].(map[int16]any)[3].(int64) != 1 {
+		t.Fatalf("unexpected row groups %+v", groups)
+	}
+
+	chunks := groups[0].(map[int16]any)[1].([]any)
+	column := func(i int) map[int16]any { return chunks[i].(map[int16]any)[3].(map[int16]any) }
+
+	// id: both rows present, so a single RLE run of 1s followed by two int64 values.
+	page := readPage(t, buf.Bytes(), column(0)[9].(int64), 0)
+	want := []byte{2, 0, 0, 0, 2 << 1, 1}
+	want = binary.LittleEndian.AppendUint64(want, 1)
+	want = binary.LittleEndian.AppendUint64(want, 2)
+	if !bytes.Equal(page, want) {
+		t.Fatalf("unexpected id page % x", page)
+	}
+
+	// day: the second value failed coercion and is written as NULL.
+	page = readPage(t, buf.Bytes(), column(3)[9].(int64), 0)
+	want = []byte{4, 0, 0, 0, 1 << 1, 1, 1 << 1, 0}
+	want = binary.LittleEndian.AppendUint32(want, uint32(19844))
+	if !bytes.Equal(page, want) {
+		t.Fatalf("unexpected day page % x", page)
+	}
+
+	// active: booleans are bit-packed.
+	page = readPage(t, buf.Bytes(), column(5)[9].(int64), 0)
+	if page[len(page)-1] != 0x01 {
+		t.Fatalf("unexpected active page % x", page)
+	}
+}
+
+func TestRunParquetCompression(t *testing.T) {
+	var plain bytes.Buffer
+	if _, err := Run(context.Background(), parquetSet(), &plain, Options{Format: "parquet", Compression: "none"}); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	plainMeta := readFooter(t, plain.Bytes())
+	plainColumn := plainMeta[4].([]any)[0].(map[int16]any)[1].([]any)[2].(map[int16]any)[3].(map[int16]any)
+	expected := readPage(t, plain.Bytes(), plainColumn[9].(int64), 0)
+
+	for _, codec := range []string{"snappy", "zstd"} {
+		var buf bytes.Buffer
+		if _, err := Run(context.Background(), parquetSet(), &buf, Options{Format: "parquet", Compression: codec}); err != nil {
+			t.Fatalf("%s: Run returned error: %v", codec, err)
+		}
+		meta := readFooter(t, buf.Bytes())
+		column := meta[4].([]any)[0].(map[int16]any)[1].([]any)[2].(map[int16]any)[3].(map[int16]any)
+		if column[4].(int64) != int64(parquetCodecs[codec]) {
+			t.Fatalf("%s: unexpected codec %v", codec, column[4])
+		}
+		if page := readPage(t, buf.Bytes(), column[9].(int64), column[4].(int64)); !bytes.Equal(page, expected) {
+			t.Fatalf("%s: decompressed page differs: % x", codec, page)
+		}
+	}
+}
+
+func TestDecimalBytes(t *testing.T) {
+	cases := map[string]int64{
+		"10.25":  1025,
+		"-0.5":   -50,
+		"1.005":  101,
+		"-1.005": -101,
+	}
+	for text, want := range cases {
+		encoded, ok := decimalBytes(text, 2)
+		if !ok || len(encoded) != parquetDecimalBytes {
+			t.Fatalf("decimalBytes(%q) failed", text)
+		}
+		got := new(big.Int).SetBytes(encoded)
+		if encoded[0]&0x80 != 0 {
+			got.Sub(got, new(big.Int).Lsh(big.NewInt(1), parquetDecimalBytes*8))
+		}
+		if got.Int64() != want {
+			t.Fatalf("decimalBytes(%q) = %s, want %d", text, got, want)
+		}
+	}
+
+	if _, ok := decimalBytes("1e40", 0); ok {
+		t.Fatal("expected overflow to be rejected")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if err := (Options{Format: "parquet", Compression: "lzo"}).Validate(); err == nil {
+		t.Fatal("expected unsupported compression error")
+	}
+	if err := (Options{Format: "parquet", Compression: "zstd", RowGroupRows: 1000}).Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package export
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Thrift compact protocol type ids.
+const (
+	thriftBoolTrue  byte = 1
+	thriftBoolFalse byte = 2
+	thriftByte      byte = 3
+	thriftI16       byte = 4
+	thriftI32       byte = 5
+	thriftI64       byte = 6
+	thriftDouble    byte = 7
+	thriftBinary    byte = 8
+	thriftList      byte = 9
+	thriftSet       byte = 10
+	thriftMap       byte = 11
+	thriftStruct    byte = 12
+)
+
+// maxThriftDepth bounds the nesting of structs and lists a reader follows, so that a
+// corrupt file cannot exhaust the stack.
+const maxThriftDepth = 64
+
+var errThriftCorrupt = errors.New("corrupt thrift data")
+
+// compactWriter encodes the subset of the Thrift compact protocol needed for Parquet page
+// headers and file metadata. Callers write fields in ascending id order and close every
+// struct they open; the top-level struct is closed with stop.
+type compactWriter struct {
+	buf   []byte
+	last  int16
+	stack []int16
+}
+
+func (c *compactWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - c.last; delta > 0 && delta <= 15 {
+		c.buf = append(c.buf, byte(delta)<<4|typ)
+	} else {
+		c.buf = append(c.buf, typ)
+		c.buf = binary.AppendVarint(c.buf, int64(id))
+	}
+	c.last = id
+}
+
+func (c *compactWriter) i8(id int16, v int8) {
+	c.fieldHeader(id, thriftByte)
+	c.buf = append(c.buf, byte(v))
+}
+
+func (c *compactWriter) i32(id int16, v int32) {
+	c.fieldHeader(id, thriftI32)
+	c.buf = binary.AppendVarint(c.buf, int64(v))
+}
+
+func (c *compactWriter) i64(id int16, v int64) {
+	c.fieldHeader(id, thriftI64)
+	c.buf = binary.AppendVarint(c.buf, v)
+}
+
+func (c *compactWriter) bool(id int16, v bool) {
+	typ := thriftBoolFalse
+	if v {
+		typ = thriftBoolTrue
+	}
+	c.fieldHeader(id, typ)
+}
+
+func (c *compactWriter) string(id int16, v string) {
+	c.fieldHeader(id, thriftBinary)
+	c.appendString(v)
+}
+
+func (c *compactWriter) appendI32(v int32) {
+	c.buf = binary.AppendVarint(c.buf, int64(v))
+}
+
+func (c *compactWriter) appendString(v string) {
+	c.buf = binary.AppendUvarint(c.buf, uint64(len(v)))
+	c.buf = append(c.buf, v...)
+}
+
+// beginStruct opens a struct-valued field.
+func (c *compactWriter) beginStruct(id int16) {
+	c.fieldHeader(id, thriftStruct)
+	c.beginElement()
+}
+
+// beginElement opens a struct that is an element of a list.
+func (c *compactWriter) beginElement() {
+	c.stack = append(c.stack, c.last)
+	c.last = 0
+}
+
+func (c *compactWriter) endStruct() {
+	c.buf = append(c.buf, 0)
+	c.last = c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+// emptyStruct writes a struct field with no members, as used by Parquet's union types.
+func (c *compactWriter) emptyStruct(id int16) {
+	c.beginStruct(id)
+	c.endStruct()
+}
+
+func (c *compactWriter) list(id int16, elem byte, size int) {
+	c.fieldHeader(id, thriftList)
+	if size < 15 {
+		c.buf = append(c.buf, byte(size)<<4|elem)
+		return
+	}
+	c.buf = append(c.buf, 0xf0|elem)
+	c.buf = binary.AppendUvarint(c.buf, uint64(size))
+}
+
+func (c *compactWriter) stop() {
+	c.buf = append(c.buf, 0)
+}
+
+// compactReader decodes compact-protocol structs into maps keyed by field id. Integers of
+// every width are read as int64, binary fields as strings, lists and sets as []any, and
+// maps as [][2]any. Reading stops at the first malformed value; err reports it.
+type compactReader struct {
+	buf   []byte
+	pos   int
+	depth int
+	err   error
+}
+
+func (r *compactReader) fail() {
+	if r.err == nil {
+		r.err = errThriftCorrupt
+	}
+}
+
+func (r *compactReader) next() byte {
+	if r.err != nil || r.pos >= len(r.buf) {
+		r.fail()
+		return 0
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *compactReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf[r.pos:])
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.buf)-r.pos {
+		r.fail()
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *compactReader) readStruct() map[int16]any {
+	fields := map[int16]any{}
+	var last int16
+	for r.err == nil {
+		b := r.next()
+		if b == 0 {
+			break
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			id = int16(r.varint())
+		}
+		last = id
+		fields[id] = r.readValue(b & 0x0f)
+	}
+	return fields
+}
+
+func (r *compactReader) readValue(typ byte) any {
+	switch typ {
+	case thriftList, thriftSet, thriftMap, thriftStruct:
+		if r.depth++; r.depth > maxThriftDepth {
+			r.fail()
+			return nil
+		}
+		defer func() { r.depth-- }()
+	}
+	switch typ {
+	case thriftBoolTrue:
+		return true
+	case thriftBoolFalse:
+		return false
+	case thriftByte:
+		return int64(int8(r.next()))
+	case thriftI16, thriftI32, thriftI64:
+		return r.varint()
+	case thriftDouble:
+		b := r.bytes(8)
+		if b == nil {
+			return 0.0
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case thriftBinary:
+		return string(r.bytes(int(r.uvarint())))
+	case thriftList, thriftSet:
+		header := r.next()
+		size := int(header >> 4)
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		// Every element takes at least one byte.
+		if size > len(r.buf)-r.pos {
+			r.fail()
+			return nil
+		}
+		list := make([]any, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			elem := header & 0x0f
+			if elem == thriftBoolTrue || elem == thriftBoolFalse {
+				list = append(list, r.next() == 1)
+				continue
+			}
+			list = append(list, r.readValue(elem))
+		}
+		return list
+	case thriftMap:
+		size := int(r.uvarint())
+		if size == 0 {
+			return [][2]any(nil)
+		}
+		if size > len(r.buf)-r.pos {
+			r.fail()
+			return nil
+		}
+		types := r.next()
+		entries := make([][2]any, 0, size)
+		for i := 0; i < size && r.err == nil; i++ {
+			key := r.readValue(types >> 4)
+			entries = append(entries, [2]any{key, r.readValue(types & 0x0f)})
+		}
+		return entries
+	case thriftStruct:
+		return r.readStruct()
+	default:
+		r.fail()
+		return nil
+	}
+}
@@ -0,0 +1,365 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// LogicalType is the output type chosen for a column in typed export formats.
+type LogicalType string
+
+const (
+	TypeString    LogicalType = "string"
+	TypeInteger   LogicalType = "integer"
+	TypeFloat     LogicalType = "float"
+	TypeDecimal   LogicalType = "decimal"
+	TypeBoolean   LogicalType = "boolean"
+	TypeDate      LogicalType = "date"
+	TypeTimestamp LogicalType = "timestamp"
+	TypeJSON      LogicalType = "json"
+	TypeBinary    LogicalType = "binary"
+	TypeUUID      LogicalType = "uuid"
+)
+
+// ColumnType records the chosen type for a column and where the decision came from.
+type ColumnType struct {
+	Name string      `json:"name"`
+	Type LogicalType `json:"type"`
+	// Source is driver, sample, override, or default; the columns ReadParquet returns have file.
+	Source string `json:"source"`
+	// Precision and Scale are set for decimal columns.
+	Precision int  `json:"precision,omitempty"`
+	Scale     int  `json:"scale,omitempty"`
+	Nullable  bool `json:"nullable"`
+}
+
+// InferOptions tunes InferColumnTypes.
+type InferOptions struct {
+	// SampleSize bounds the rows inspected per column. Zero samples every row.
+	SampleSize int `json:"sampleSize"`
+	// Overrides force a column (by name) to the given type.
+	Overrides map[string]LogicalType `json:"overrides"`
+}
+
+// ValidType reports whether t is a known logical type.
+func ValidType(t LogicalType) bool {
+	switch t {
+	case TypeString, TypeInteger, TypeFloat, TypeDecimal, TypeBoolean, TypeDate,
+		TypeTimestamp, TypeJSON, TypeBinary, TypeUUID:
+		return true
+	default:
+		return false
+	}
+}
+
+// InferColumnTypes chooses an output type per column: explicit overrides win, then
+// unambiguous driver metadata, then value sampling (for example a text column whose values
+// are all ISO dates becomes a date column).
+func InferColumnTypes(columns []resultset.Column, rows [][]any, opts InferOptions) ([]ColumnType, error) {
+	for name, t := range opts.Overrides {
+		if !ValidType(t) {
+			return nil, fmt.Errorf("unsupported type %q for column %s", t, name)
+		}
+	}
+
+	sample := rows
+	if opts.SampleSize > 0 && len(sample) > opts.SampleSize {
+		sample = sample[:opts.SampleSize]
+	}
+
+	types := make([]ColumnType, len(columns))
+	for i, col := range columns {
+		ct := ColumnType{Name: col.Name}
+		for _, row := range sample {
+			if i < len(row) && row[i] == nil {
+				ct.Nullable = true
+				break
+			}
+		}
+
+		if t, ok := opts.Overrides[col.Name]; ok {
+			ct.Type, ct.Source = t, "override"
+		} else if t, ok := driverType(col.DataType); ok {
+			ct.Type, ct.Source = t, "driver"
+		} else if t, ok := sampleType(sample, i); ok {
+			ct.Type, ct.Source = t, "sample"
+		} else {
+			ct.Type, ct.Source = TypeString, "default"
+		}
+
+		if ct.Type == TypeDecimal {
+			ct.Precision, ct.Scale = decimalShape(sample, i)
+		}
+		types[i] = ct
+	}
+	return types, nil
+}
+
+// postgresOIDs maps pgx type OIDs (reported as decimal strings by query.execute) to logical types.
+var postgresOIDs = map[string]LogicalType{
+	"16":   TypeBoolean,
+	"17":   TypeBinary,
+	"20":   TypeInteger,
+	"21":   TypeInteger,
+	"23":   TypeInteger,
+	"114":  TypeJSON,
+	"700":  TypeFloat,
+	"701":  TypeFloat,
+	"790":  TypeDecimal, // money, normalized to a plain decimal
+	"1082": TypeDate,
+	"1114": TypeTimestamp,
+	"1184": TypeTimestamp,
+	"1186": TypeString, // interval, as an ISO 8601 duration
+	"1560": TypeString, // bit and varbit, as their digits
+	"1562": TypeString,
+	"1700": TypeDecimal,
+	"2950": TypeUUID,
+	"3802": TypeJSON,
+	// Ranges and multiranges are written as their bounds.
+	"3904": TypeJSON,
+	"3906": TypeJSON,
+	"3908": TypeJSON,
+	"3910": TypeJSON,
+	"3912": TypeJSON,
+	"3926": TypeJSON,
+	"4451": TypeJSON,
+	"4532": TypeJSON,
+	"4533": TypeJSON,
+	"4534": TypeJSON,
+	"4535": TypeJSON,
+	"4536": TypeJSON,
+}
+
+// driverType maps driver metadata to a logical type. Text-like and unknown types return false
+// so that sampling can refine them.
+func driverType(dataType string) (LogicalType, bool) {
+	if t, ok := postgresOIDs[dataType]; ok {
+		return t, true
+	}
+
+	name := strings.ToUpper(strings.TrimSpace(dataType))
+	if idx := strings.IndexAny(name, "( "); idx >= 0 {
+		name = name[:idx]
+	}
+	switch name {
+	case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "UNSIGNED", "INT2", "INT4", "INT8":
+		return TypeInteger, true
+	case "FLOAT", "DOUBLE", "REAL", "FLOAT4", "FLOAT8":
+		return TypeFloat, true
+	case "DECIMAL", "NUMERIC":
+		return TypeDecimal, true
+	case "BOOL", "BOOLEAN":
+		return TypeBoolean, true
+	case "DATE":
+		return TypeDate, true
+	case "DATETIME", "TIMESTAMP", "TIMESTAMPTZ":
+		return TypeTimestamp, true
+	case "JSON", "JSONB":
+		return TypeJSON, true
+	case "BLOB", "BINARY", "VARBINARY", "BYTEA", "LONGBLOB", "MEDIUMBLOB", "TINYBLOB":
+		return TypeBinary, true
+	case "UUID":
+		return TypeUUID, true
+	default:
+		return "", false
+	}
+}
+
+// sampleType returns the narrowest type every non-null sampled value satisfies.
+func sampleType(rows [][]any, idx int) (LogicalType, bool) {
+	candidates := []LogicalType{TypeInteger, TypeFloat, TypeBoolean, TypeDate, TypeTimestamp}
+	seen := false
+	for _, row := range rows {
+		if idx >= len(row) || row[idx] == nil {
+			continue
+		}
+		seen = true
+		kept := candidates[:0]
+		for _, t := range candidates {
+			if _, err := Coerce(row[idx], ColumnType{Type: t}); err == nil {
+				kept = append(kept, t)
+			}
+		}
+		candidates = kept
+		if len(candidates) == 0 {
+			return "", false
+		}
+	}
+	if !seen {
+		return "", false
+	}
+	return candidates[0], true
+}
+
+func decimalShape(rows [][]any, idx int) (precision, scale int) {
+	intDigits := 1
+	for _, row := range rows {
+		if idx >= len(row) || row[idx] == nil {
+			continue
+		}
+		text := strings.TrimLeft(fmt.Sprint(row[idx]), "+-")
+		whole, frac, _ := strings.Cut(text, ".")
+		if len(whole) > intDigits {
+			intDigits = len(whole)
+		}
+		if len(frac) > scale {
+			scale = len(frac)
+		}
+	}
+	precision = intDigits + scale
+	if precision > 38 {
+		precision = 38
+	}
+	if scale > precision {
+		scale = precision
+	}
+	return precision, scale
+}
+
+var (
+	dateLayouts      = []string{"2006-01-02"}
+	timestampLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999",
+	}
+)
+
+// Coerce converts a cell into the Go representation for the column type:
+// int64, float64, string (decimal text), bool, time.Time, []byte, or string.
+// NULL stays nil. An error means the value cannot be represented in the type.
+func Coerce(value any, ct ColumnType) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	text, isText := value.(string)
+
+	switch ct.Type {
+	case TypeInteger:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int16:
+			return int64(v), nil
+		case int8:
+			return int64(v), nil
+		case uint8:
+			return int64(v), nil
+		case uint16:
+			return int64(v), nil
+		case uint32:
+			return int64(v), nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), nil
+			}
+		case json.Number:
+			return v.Int64()
+		}
+		if isText {
+			return strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		}
+	case TypeFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case resultset.SpecialFloat:
+			return v.Float(), nil
+		case float32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case int32:
+			return float64(v), nil
+		case json.Number:
+			return v.Float64()
+		}
+		if isText {
+			return strconv.ParseFloat(strings.TrimSpace(text), 64)
+		}
+	case TypeDecimal:
+		raw := strings.TrimSpace(fmt.Sprint(value))
+		if f, ok := value.(float64); ok {
+			raw = strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		if _, ok := new(big.Rat).SetString(raw); ok {
+			return raw, nil
+		}
+	case TypeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		}
+		if isText {
+			switch strings.ToLower(strings.TrimSpace(text)) {
+			case "true", "t":
+				return true, nil
+			case "false", "f":
+				return false, nil
+			}
+		}
+	case TypeDate:
+		if ts, ok := value.(time.Time); ok {
+			return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+		if isText {
+			for _, layout := range dateLayouts {
+				if ts, err := time.Parse(layout, text); err == nil {
+					return ts, nil
+				}
+			}
+		}
+	case TypeTimestamp:
+		if ts, ok := value.(time.Time); ok {
+			return ts.UTC(), nil
+		}
+		if isText {
+			for _, layout := range timestampLayouts {
+				if ts, err := time.Parse(layout, text); err == nil {
+					return ts.UTC(), nil
+				}
+			}
+		}
+	case TypeBinary:
+		if b, ok := value.([]byte); ok {
+			return b, nil
+		}
+		return []byte(fmt.Sprint(value)), nil
+	case TypeJSON:
+		if isText {
+			return text, nil
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		return string(encoded), nil
+	default:
+		if isText {
+			return text, nil
+		}
+		if ts, ok := value.(time.Time); ok {
+			return ts.UTC().Format(time.RFC3339Nano), nil
+		}
+		return fmt.Sprint(value), nil
+	}
+	return nil, fmt.Errorf("cannot represent %v as %s", value, ct.Type)
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestInferColumnTypesPrefersDriverMetadata(t *testing.T) {
+	columns := []resultset.Column{{Name: "id", DataType: "23"}, {Name: "price", DataType: "NUMERIC(10,2)"}}
+	rows := [][]any{{int64(1), "12.50"}, {int64(2), "3.125"}}
+
+	types, err := InferColumnTypes(columns, rows, InferOptions{})
+	if err != nil {
+		t.Fatalf("InferColumnTypes returned error: %v", err)
+	}
+	if types[0].Type != TypeInteger || types[0].Source != "driver" {
+		t.Fatalf("unexpected id type %+v", types[0])
+	}
+	if types[1].Type != TypeDecimal || types[1].Precision != 5 || types[1].Scale != 3 {
+		t.Fatalf("unexpected price type %+v", types[1])
+	}
+}
+
+func TestInferColumnTypesSamplesTextValues(t *testing.T) {
+	columns := []resultset.Column{{Name: "day", DataType: "25"}, {Name: "count", DataType: "TEXT"}, {Name: "note"}}
+	rows := [][]any{
+		{"2024-05-01", "10", "hello"},
+		{nil, "11", "2024-05-01"},
+		{"2024-05-03", "x", nil},
+	}
+
+	types, err := InferColumnTypes(columns, rows, InferOptions{SampleSize: 2})
+	if err != nil {
+		t.Fatalf("InferColumnTypes returned error: %v", err)
+	}
+	if types[0].Type != TypeDate || types[0].Source != "sample" || !types[0].Nullable {
+		t.Fatalf("unexpected day type %+v", types[0])
+	}
+	// The third row is outside the sample, so the non-numeric value does not demote the column.
+	if types[1].Type != TypeInteger {
+		t.Fatalf("unexpected count type %+v", types[1])
+	}
+	if types[2].Type != TypeString || types[2].Source != "default" {
+		t.Fatalf("unexpected note type %+v", types[2])
+	}
+}
+
+func TestInferColumnTypesOverrides(t *testing.T) {
+	columns := []resultset.Column{{Name: "zip", DataType: "23"}}
+	rows := [][]any{{int64(2134)}}
+
+	types, err := InferColumnTypes(columns, rows, InferOptions{Overrides: map[string]LogicalType{"zip": TypeString}})
+	if err != nil {
+		t.Fatalf("InferColumnTypes returned error: %v", err)
+	}
+	if types[0].Type != TypeString || types[0].Source != "override" {
+		t.Fatalf("unexpected zip type %+v", types[0])
+	}
+
+	if _, err := InferColumnTypes(columns, rows, InferOptions{Overrides: map[string]LogicalType{"zip": "money"}}); err == nil {
+		t.Fatal("expected error for unknown override type")
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	value, err := Coerce("2024-05-01T08:30:00+02:00", ColumnType{Type: TypeTimestamp})
+	if err != nil {
+		t.Fatalf("Coerce returned error: %v", err)
+	}
+	if !value.(time.Time).Equal(time.Date(2024, 5, 1, 6, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp %v", value)
+	}
+
+	if value, err := Coerce(float64(42), ColumnType{Type: TypeInteger}); err != nil || value != int64(42) {
+		t.Fatalf("unexpected integer coercion %v, %v", value, err)
+	}
+	if _, err := Coerce(1.5, ColumnType{Type: TypeInteger}); err == nil {
+		t.Fatal("expected error for fractional integer")
+	}
+	if value, err := Coerce("t", ColumnType{Type: TypeBoolean}); err != nil || value != true {
+		t.Fatalf("unexpected boolean coercion %v, %v", value, err)
+	}
+	if value, err := Coerce(nil, ColumnType{Type: TypeDate}); err != nil || value != nil {
+		t.Fatalf("expected NULL to stay nil, got %v, %v", value, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package faults describes failures injected into streams to test how the core and its
+// clients recover from them: a database connection lost mid-stream, acknowledgements
+// that arrive late and chunks that cannot be encoded. It is meant for test setups only;
+// a plan is read from the FLUXGRID_FAULTS environment variable or set in the handler
+// configuration.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvVar names the environment variable holding a plan, e.g.
+// "drop=2,corrupt=3,ack-delay=500ms".
+const EnvVar = "FLUXGRID_FAULTS"
+
+var (
+	// ErrConnectionDropped is the read error of a stream whose connection was dropped.
+	ErrConnectionDropped = errors.New("fault injection: connection dropped")
+	// ErrCorruptChunk is the encoding error of a corrupted chunk.
+	ErrCorruptChunk = errors.New("fault injection: chunk corrupted")
+)
+
+// Plan lists the faults to inject into every stream. The zero value injects none.
+type Plan struct {
+	// DropAfter drops the database connection once this many chunks were sent. Zero
+	// never drops it.
+	DropAfter int
+	// Corrupt corrupts the chunk with this sequence number. Zero corrupts none.
+	Corrupt int
+	// AckDelay holds back each acknowledgement from the client for this long.
+	AckDelay time.Duration
+}
+
+// Parse reads a plan from a comma-separated list of drop=<chunks>, corrupt=<seq> and
+// ack-delay=<duration>. An empty spec is the zero plan.
+func Parse(spec string) (Plan, error) {
+	var plan Plan
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return Plan{}, fmt.Errorf("invalid fault %q: want name=value", item)
+		}
+		var err error
+		switch name {
+		case "drop":
+			plan.DropAfter, err = parseCount(value)
+		case "corrupt":
+			plan.Corrupt, err = parseCount(value)
+		case "ack-delay":
+			plan.AckDelay, err = time.ParseDuration(value)
+			if err == nil && plan.AckDelay < 0 {
+				err = errors.New("must not be negative")
+			}
+		default:
+			return Plan{}, fmt.Errorf("unknown fault %q: want drop, corrupt or ack-delay", name)
+		}
+		if err != nil {
+			return Plan{}, fmt.Errorf("invalid fault %s: %w", name, err)
+		}
+	}
+	return plan, nil
+}
+
+func parseCount(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New("must be at least 1")
+	}
+	return n, nil
+}
+
+// Enabled reports whether the plan injects any fault.
+func (p Plan) Enabled() bool {
+	return p != Plan{}
+}
+
+// Dropped returns ErrConnectionDropped when the connection of a stream that sent chunks
+// chunks is to be dropped.
+func (p Plan) Dropped(chunks int) error {
+	if p.DropAfter > 0 && chunks >= p.DropAfter {
+		return ErrConnectionDropped
+	}
+	return nil
+}
+
+// Corrupted returns ErrCorruptChunk when the chunk seq is to be corrupted.
+func (p Plan) Corrupted(seq int) error {
+	if p.Corrupt > 0 && seq == p.Corrupt {
+		return ErrCorruptChunk
+	}
+	return nil
+}
+
+// String formats the plan in the syntax of Parse.
+func (p Plan) String() string {
+	var items []string
+	if p.DropAfter > 0 {
+		items = append(items, "drop="+strconv.Itoa(p.DropAfter))
+	}
+	if p.Corrupt > 0 {
+		items = append(items, "corrupt="+strconv.Itoa(p.Corrupt))
+	}
+	if p.AckDelay > 0 {
+		items = append(items, "ack-delay="+p.AckDelay.String())
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,38 @@
+package faults
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	plan, err := Parse(" drop=2, corrupt=3,ack-delay=250ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Plan{DropAfter: 2, Corrupt: 3, AckDelay: 250 * time.Millisecond}
+	if plan != want || plan.String() != "drop=2,corrupt=3,ack-delay=250ms" {
+		t.Fatalf("plan = %+v (%s)", plan, plan)
+	}
+	if plan, err := Parse(""); err != nil || plan.Enabled() {
+		t.Fatalf("empty spec = %+v, %v", plan, err)
+	}
+	for _, spec := range []string{"drop", "drop=0", "corrupt=x", "ack-delay=-1s", "flood=1"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestPlanFaults(t *testing.T) {
+	plan := Plan{DropAfter: 2, Corrupt: 3}
+	if plan.Dropped(1) != nil || plan.Dropped(2) != ErrConnectionDropped {
+		t.Fatal("dropped after the wrong chunk")
+	}
+	if plan.Corrupted(2) != nil || plan.Corrupted(3) != ErrCorruptChunk || plan.Corrupted(4) != nil {
+		t.Fatal("corrupted the wrong chunk")
+	}
+	if (Plan{}).Dropped(100) != nil || (Plan{}).Corrupted(1) != nil {
+		t.Fatal("the zero plan injected a fault")
+	}
+}
@@ -0,0 +1,129 @@
+// Package filewatch notices when files change on disk. It polls their size and
+// modification time rather than relying on platform notifications, so it behaves the same
+// everywhere, and a file written in bursts is reported once per poll instead of once per
+// write.
+package filewatch
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Change reports that files of a watched set changed since the last poll or settle.
+type Change struct {
+	// Path is the path the set was added under.
+	Path string
+	// Files are the paths of the set that changed, appeared or disappeared.
+	Files []string
+}
+
+// Watcher polls sets of files and reports changes to them.
+type Watcher struct {
+	onChange func(Change)
+
+	mu   sync.Mutex
+	sets map[string]*fileSet
+}
+
+type fileSet struct {
+	refs   int
+	paths  []string
+	stamps []stamp
+}
+
+type stamp struct {
+	exists bool
+	size   int64
+	mod    time.Time
+}
+
+func stat(path string) stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{exists: true, size: info.Size(), mod: info.ModTime()}
+}
+
+// New returns a watcher that calls onChange from Poll for every set that changed.
+func New(onChange func(Change)) *Watcher {
+	return &Watcher{onChange: onChange, sets: make(map[string]*fileSet)}
+}
+
+// Add watches path together with related files, such as a database's write-ahead log,
+// which need not exist yet. Adding the same path again shares the set; it is dropped once
+// every returned release has been called.
+func (w *Watcher) Add(path string, related ...string) (release func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	set, ok := w.sets[path]
+	if !ok {
+		set = &fileSet{paths: append([]string{path}, related...)}
+		set.stamps = make([]stamp, len(set.paths))
+		for i, p := range set.paths {
+			set.stamps[i] = stat(p)
+		}
+		w.sets[path] = set
+	}
+	set.refs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if set.refs--; set.refs == 0 {
+				delete(w.sets, path)
+			}
+		})
+	}
+}
+
+// Settle takes the current state of the set added under path as known, so that changes
+// the caller made itself are not reported.
+func (w *Watcher) Settle(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if set, ok := w.sets[path]; ok {
+		for i, p := range set.paths {
+			set.stamps[i] = stat(p)
+		}
+	}
+}
+
+// Poll checks every set once and reports those that changed.
+func (w *Watcher) Poll() {
+	var changes []Change
+	w.mu.Lock()
+	for path, set := range w.sets {
+		var changed []string
+		for i, p := range set.paths {
+			if current := stat(p); current != set.stamps[i] {
+				set.stamps[i] = current
+				changed = append(changed, p)
+			}
+		}
+		if len(changed) > 0 {
+			changes = append(changes, Change{Path: path, Files: changed})
+		}
+	}
+	w.mu.Unlock()
+	for _, change := range changes {
+		w.onChange(change)
+	}
+}
+
+// Run polls every interval until ctx is done.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Poll()
+		}
+	}
+}
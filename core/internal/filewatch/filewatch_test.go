@@ -0,0 +1,52 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatcherReportsOnlyUnsettledChanges(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "app.db")
+	wal := db + "-wal"
+	if err := os.WriteFile(db, []byte("one"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var changes []Change
+	w := New(func(c Change) { changes = append(changes, c) })
+	release := w.Add(db, wal)
+	w.Add(db, wal)()
+
+	w.Poll()
+	if len(changes) != 0 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	if err := os.WriteFile(wal, []byte("frame"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w.Poll()
+	w.Poll()
+	if len(changes) != 1 || changes[0].Path != db || len(changes[0].Files) != 1 || changes[0].Files[0] != wal {
+		t.Fatalf("changes = %+v", changes)
+	}
+
+	if err := os.WriteFile(db, []byte("two!"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	w.Settle(db)
+	w.Poll()
+	if len(changes) != 1 {
+		t.Fatalf("settled change reported: %+v", changes)
+	}
+
+	release()
+	if err := os.Remove(db); err != nil {
+		t.Fatal(err)
+	}
+	w.Poll()
+	if len(changes) != 1 {
+		t.Fatalf("released set still watched: %+v", changes)
+	}
+}
@@ -0,0 +1,248 @@
+// Package gateway exposes the methods of an RPC server over HTTP for scripts and clients
+// that do not speak JSON-RPC over stdio. Every HTTP request runs in a session of its own,
+// so state kept per session, such as connection handles, does not carry over between
+// requests; pass DSNs or connection aliases instead.
+package gateway
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// DefaultMaxBodySize bounds the body of one HTTP request.
+const DefaultMaxBodySize = 64 << 20
+
+// Shortcuts map convenience endpoints to the methods they call.
+var Shortcuts = map[string]string{
+	"/query":  "query.execute",
+	"/schema": "schema.list",
+}
+
+// Gateway serves the methods of an RPC server over HTTP:
+//
+//   - POST /rpc takes a JSON-RPC request object and returns the JSON-RPC response.
+//   - POST /rpc/{method} takes the params of a method and returns its result.
+//   - POST /query and POST /schema are shortcuts for query.execute and schema.list.
+//   - GET /openapi.json describes the endpoints.
+//
+// Every request needs a bearer token the gateway's authenticator accepts, and runs as the
+// tenant it belongs to.
+type Gateway struct {
+	server  *rpc.Server
+	auth    rpc.Authenticator
+	version string
+	// MaxBodySize bounds request bodies; zero uses DefaultMaxBodySize.
+	MaxBodySize int64
+}
+
+// New returns a gateway for server that accepts the tokens auth does. version is reported
+// in the OpenAPI document.
+func New(server *rpc.Server, auth rpc.Authenticator, version string) *Gateway {
+	return &Gateway{server: server, auth: auth, version: version}
+}
+
+// NewToken returns a random token for a gateway.
+func NewToken() (string, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := g.authorize(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="fluxgrid"`)
+		writeJSON(w, http.StatusUnauthorized, errorBody{Error: &rpc.Error{Code: -32600, Message: "missing or invalid token"}})
+		return
+	}
+	if r.URL.Path == "/openapi.json" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		document, err := g.openAPI(r, tenant)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, errorBody{Error: &rpc.Error{Code: -32603, Message: err.Error()}})
+			return
+		}
+		writeJSON(w, http.StatusOK, document)
+		return
+	}
+
+	var method string
+	switch {
+	case r.URL.Path == "/rpc":
+	case strings.HasPrefix(r.URL.Path, "/rpc/"):
+		method = strings.TrimPrefix(r.URL.Path, "/rpc/")
+	case Shortcuts[r.URL.Path] != "":
+		method = Shortcuts[r.URL.Path]
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	limit := g.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeJSON(w, status, errorBody{Error: &rpc.Error{Code: -32600, Message: "invalid request", Data: err.Error()}})
+		return
+	}
+
+	if method == "" {
+		g.serveEnvelope(w, tenant, body)
+		return
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = []byte("{}")
+	}
+	request, err := json.Marshal(rpc.Request{JSONRPC: "2.0", Method: method, Params: body, ID: &httpID})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: &rpc.Error{Code: -32700, Message: "parse error", Data: err.Error()}})
+		return
+	}
+	response, err := g.call(tenant, request)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: &rpc.Error{Code: -32603, Message: err.Error()}})
+		return
+	}
+	if response.Error != nil {
+		writeJSON(w, statusOf(response.Error), errorBody{Error: response.Error})
+		return
+	}
+	if response.Result == nil {
+		response.Result = json.RawMessage("null")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(response.Result)
+}
+
+var httpID = json.RawMessage(`"http"`)
+
+type errorBody struct {
+	Error *rpc.Error `json:"error"`
+}
+
+// response is a JSON-RPC response as written by the server.
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpc.Error      `json:"error"`
+}
+
+func (g *Gateway) serveEnvelope(w http.ResponseWriter, tenant string, body []byte) {
+	var envelope rpc.Request
+	var compact bytes.Buffer
+	if err := json.Unmarshal(body, &envelope); err != nil || json.Compact(&compact, body) != nil {
+		writeJSON(w, http.StatusBadRequest, rpc.Response{JSONRPC: "2.0", ID: &nullID, Error: &rpc.Error{Code: -32700, Message: "parse error"}})
+		return
+	}
+	response, err := g.call(tenant, compact.Bytes())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, rpc.Response{JSONRPC: "2.0", ID: envelope.ID, Error: &rpc.Error{Code: -32603, Message: err.Error()}})
+		return
+	}
+	if envelope.ID == nil && response.ID == nil {
+		// Notifications have no response.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	out := map[string]any{"jsonrpc": "2.0", "id": response.ID}
+	if response.Error != nil {
+		out["error"] = response.Error
+	} else {
+		out["result"] = response.Result
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+var nullID = json.RawMessage("null")
+
+// call runs one JSON-RPC message in a session of its own, as tenant, and returns the
+// response to it, skipping notifications the request sent. A nil ID in the result means
+// there was no response, as for notifications.
+func (g *Gateway) call(tenant string, message json.RawMessage) (response, error) {
+	conn := g.server.ConnectAs(tenant)
+	defer conn.Close()
+	if err := conn.Send(message); err != nil {
+		return response{}, err
+	}
+	var envelope rpc.Request
+	if err := json.Unmarshal(message, &envelope); err == nil && envelope.ID == nil {
+		return response{}, nil
+	}
+	for {
+		raw, err := conn.Receive()
+		if err != nil {
+			return response{}, err
+		}
+		var decoded response
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return response{}, err
+		}
+		if decoded.ID != nil {
+			return decoded, nil
+		}
+	}
+}
+
+// authorize returns the tenant the request's bearer token belongs to.
+func (g *Gateway) authorize(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	return g.auth(token)
+}
+
+// statusOf maps JSON-RPC error codes to HTTP statuses for the plain endpoints.
+func statusOf(err *rpc.Error) int {
+	switch err.Code {
+	case -32700, -32600, -32602:
+		return http.StatusBadRequest
+	case -32601:
+		return http.StatusNotFound
+	case -32603:
+		return http.StatusInternalServerError
+	case -32100:
+		return http.StatusTooManyRequests
+	case -32190:
+		return http.StatusForbidden
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeJSON(w, http.StatusMethodNotAllowed, errorBody{Error: &rpc.Error{Code: -32600, Message: fmt.Sprintf("use %s", allow)}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+type echoParams struct {
+	SQL string `json:"sql" jsonschema:"required"`
+}
+
+func testGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("query.execute", func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var p echoParams
+		_ = json.Unmarshal(params, &p)
+		if p.SQL == "fail" {
+			return nil, &rpc.Error{Code: -32011, Message: "query execution failed"}
+		}
+		return map[string]string{"sql": p.SQL}, nil
+	})
+	server.Document("query.execute", rpc.MethodDoc{Summary: "Run a statement", Params: echoParams{}, Result: map[string]string{}})
+	httpServer := httptest.NewServer(New(server, rpc.TokenAuthenticator("secret"), "1.2.3"))
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func post(t *testing.T, url, token, body string) (int, string) {
+	t.Helper()
+	request, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	out, _ := io.ReadAll(response.Body)
+	return response.StatusCode, strings.TrimSpace(string(out))
+}
+
+func TestGatewayServesMethodsOverHTTP(t *testing.T) {
+	server := testGateway(t)
+
+	for _, token := range []string{"", "wrong"} {
+		if status, _ := post(t, server.URL+"/query", token, `{"sql":"SELECT 1"}`); status != http.StatusUnauthorized {
+			t.Fatalf("token %q: status = %d", token, status)
+		}
+	}
+	for path, wantStatus := range map[string]int{
+		"/query":              http.StatusOK,
+		"/rpc/query.execute":  http.StatusOK,
+		"/rpc/missing.method": http.StatusNotFound,
+	} {
+		status, body := post(t, server.URL+path, "secret", `{"sql":"SELECT 1"}`)
+		if status != wantStatus {
+			t.Fatalf("%s: status = %d, body = %s", path, status, body)
+		}
+		if status == http.StatusOK && body != `{"sql":"SELECT 1"}` {
+			t.Fatalf("%s: body = %s", path, body)
+		}
+	}
+	if status, body := post(t, server.URL+"/query", "secret", `{}`); status != http.StatusBadRequest || !strings.Contains(body, `"code":-32602`) {
+		t.Fatalf("invalid params: %d %s", status, body)
+	}
+	if status, body := post(t, server.URL+"/query", "secret", `{"sql":"fail"}`); status != http.StatusUnprocessableEntity || !strings.Contains(body, "query execution failed") {
+		t.Fatalf("failure: %d %s", status, body)
+	}
+
+	status, body := post(t, server.URL+"/rpc", "secret", `{"jsonrpc":"2.0","id":7,"method":"query.execute","params":{"sql":"SELECT 2"}}`)
+	if status != http.StatusOK || body != `{"id":7,"jsonrpc":"2.0","result":{"sql":"SELECT 2"}}` {
+		t.Fatalf("rpc: %d %s", status, body)
+	}
+	if status, _ := post(t, server.URL+"/rpc", "secret", `{"jsonrpc":"2.0","method":"query.execute","params":{"sql":"SELECT 2"}}`); status != http.StatusNoContent {
+		t.Fatalf("notification: status = %d", status)
+	}
+}
+
+func TestGatewayDescribesItselfWithOpenAPI(t *testing.T) {
+	server := testGateway(t)
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/openapi.json", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	var document struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths map[string]struct {
+			Post struct {
+				RequestBody struct {
+					Content map[string]struct {
+						Schema rpc.Schema `json:"schema"`
+					} `json:"content"`
+				} `json:"requestBody"`
+			} `json:"post"`
+		} `json:"paths"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+	if document.OpenAPI != "3.0.3" || document.Info.Version != "1.2.3" {
+		t.Fatalf("document = %+v", document)
+	}
+	for _, path := range []string{"/rpc", "/rpc/query.execute", "/rpc/rpc.describe", "/query"} {
+		if _, ok := document.Paths[path]; !ok {
+			t.Fatalf("missing path %s in %v", path, document.Paths)
+		}
+	}
+	if _, ok := document.Paths["/schema"]; ok {
+		t.Fatal("shortcut listed for a method that is not registered")
+	}
+	params := document.Paths["/query"].Post.RequestBody.Content["application/json"].Schema
+	if len(params.Required) != 1 || params.Required[0] != "sql" {
+		t.Fatalf("params = %+v", params)
+	}
+}
+
+func TestGatewayRunsRequestsAsTheTokensTenant(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("whoami", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		session, _ := rpc.SessionFromContext(ctx)
+		return session.Tenant(), nil
+	})
+	server.Register("admin", func(context.Context, json.RawMessage) (any, *rpc.Error) {
+		return nil, &rpc.Error{Code: -32190, Message: "admin is not available to this API key"}
+	})
+	keys := map[string]string{"key-a": "alpha", "key-b": "beta"}
+	httpServer := httptest.NewServer(New(server, func(key string) (string, bool) {
+		tenant, ok := keys[key]
+		return tenant, ok
+	}, "1.2.3"))
+	t.Cleanup(httpServer.Close)
+
+	for key, tenant := range keys {
+		if status, body := post(t, httpServer.URL+"/rpc/whoami", key, ""); status != http.StatusOK || body != `"`+tenant+`"` {
+			t.Fatalf("%s: %d %s", key, status, body)
+		}
+	}
+	if status, _ := post(t, httpServer.URL+"/rpc/whoami", "key-c", ""); status != http.StatusUnauthorized {
+		t.Fatalf("unknown key: status = %d", status)
+	}
+	if status, _ := post(t, httpServer.URL+"/rpc/admin", "key-a", ""); status != http.StatusForbidden {
+		t.Fatalf("forbidden method: status = %d", status)
+	}
+}
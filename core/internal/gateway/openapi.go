@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// description is the part of the rpc.describe result the OpenAPI document is built from.
+type description struct {
+	Methods []struct {
+		Name    string      `json:"name"`
+		Summary string      `json:"summary"`
+		Params  *rpc.Schema `json:"params"`
+		Result  *rpc.Schema `json:"result"`
+	} `json:"methods"`
+}
+
+// openAPI builds an OpenAPI 3.0 document from rpc.describe, so it lists exactly the
+// methods the server has registered.
+func (g *Gateway) openAPI(r *http.Request, tenant string) (map[string]any, error) {
+	request, _ := json.Marshal(rpc.Request{JSONRPC: "2.0", Method: "rpc.describe", ID: &httpID})
+	response, err := g.call(tenant, request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, errors.New(response.Error.Message)
+	}
+	var described description
+	if err := json.Unmarshal(response.Result, &described); err != nil {
+		return nil, err
+	}
+	sort.Slice(described.Methods, func(i, j int) bool { return described.Methods[i].Name < described.Methods[j].Name })
+
+	errorResponse := map[string]any{
+		"description": "The method failed; error carries the JSON-RPC error",
+		"content":     jsonContent(&rpc.Schema{Type: "object", Properties: map[string]*rpc.Schema{"error": rpcErrorSchema}}),
+	}
+	operation := func(summary string, params, result *rpc.Schema) map[string]any {
+		if params == nil {
+			params = &rpc.Schema{Type: "object"}
+		}
+		if result == nil {
+			result = &rpc.Schema{}
+		}
+		return map[string]any{"post": map[string]any{
+			"summary":     summary,
+			"requestBody": map[string]any{"required": true, "content": jsonContent(params)},
+			"responses": map[string]any{
+				"200":     map[string]any{"description": "The method's result", "content": jsonContent(result)},
+				"default": errorResponse,
+			},
+		}}
+	}
+
+	paths := map[string]any{
+		"/rpc": map[string]any{"post": map[string]any{
+			"summary":     "Call any method with a JSON-RPC 2.0 request object",
+			"requestBody": map[string]any{"required": true, "content": jsonContent(rpcRequestSchema)},
+			"responses": map[string]any{
+				"200": map[string]any{"description": "The JSON-RPC response", "content": jsonContent(rpcResponseSchema)},
+				"204": map[string]any{"description": "The request was a notification"},
+			},
+		}},
+	}
+	byName := map[string]int{}
+	for i, method := range described.Methods {
+		byName[method.Name] = i
+		paths["/rpc/"+method.Name] = operation(method.Summary, method.Params, method.Result)
+	}
+	for path, name := range Shortcuts {
+		if i, ok := byName[name]; ok {
+			method := described.Methods[i]
+			paths[path] = operation(method.Summary+" (same as /rpc/"+name+")", method.Params, method.Result)
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "FluxGrid core",
+			"version":     g.version,
+			"description": "The core's JSON-RPC methods over HTTP. Each request runs in a session of its own, so connection handles and other per-session state do not carry over between requests.",
+		},
+		"servers":    []map[string]any{{"url": "http://" + r.Host}},
+		"security":   []map[string]any{{"bearer": []string{}}},
+		"paths":      paths,
+		"components": map[string]any{"securitySchemes": map[string]any{"bearer": map[string]any{"type": "http", "scheme": "bearer"}}},
+	}, nil
+}
+
+func jsonContent(schema *rpc.Schema) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+var (
+	rpcErrorSchema = &rpc.Schema{
+		Type: "object",
+		Properties: map[string]*rpc.Schema{
+			"code":    {Type: "integer"},
+			"message": {Type: "string"},
+			"data":    {},
+		},
+		Required: []string{"code", "message"},
+	}
+	rpcRequestSchema = &rpc.Schema{
+		Type: "object",
+		Properties: map[string]*rpc.Schema{
+			"jsonrpc": {Type: "string", Enum: []string{"2.0"}},
+			"method":  {Type: "string"},
+			"params":  {},
+			"id":      {Description: "Omit to send a notification"},
+		},
+		Required: []string{"jsonrpc", "method"},
+	}
+	rpcResponseSchema = &rpc.Schema{
+		Type: "object",
+		Properties: map[string]*rpc.Schema{
+			"jsonrpc": {Type: "string"},
+			"id":      {},
+			"result":  {},
+			"error":   rpcErrorSchema,
+		},
+	}
+)
@@ -0,0 +1,361 @@
+// Package grpcapi serves the core's methods over gRPC, as described by
+// proto/fluxgrid/core/v1/core.proto. Calls run through the same handlers as JSON-RPC
+// clients, over an in-process connection to the RPC server. The service's messages are
+// built from a descriptor at run time rather than generated, so the package needs no
+// protoc step; the descriptor must match core.proto.
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is the full name of the gRPC service.
+const ServiceName = "fluxgrid.core.v1.Core"
+
+// errorDomain is the domain of the ErrorInfo details of failed calls.
+const errorDomain = "core.fluxgrid"
+
+var (
+	file          protoreflect.FileDescriptor
+	callRequest   protoreflect.MessageDescriptor
+	callResponse  protoreflect.MessageDescriptor
+	streamEvent   protoreflect.MessageDescriptor
+	structMessage = (&structpb.Struct{}).ProtoReflect().Descriptor()
+)
+
+func init() {
+	message := func(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+	}
+	field := func(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		}
+		if typeName != "" {
+			f.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	descriptor := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("fluxgrid/core/v1/core.proto"),
+		Package:    proto.String("fluxgrid.core.v1"),
+		Dependency: []string{"google/protobuf/struct.proto"},
+		Syntax:     proto.String("proto3"),
+		Options:    &descriptorpb.FileOptions{GoPackage: proto.String("github.com/fluxgrid/core/proto/fluxgrid/core/v1;corev1")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			message("CallRequest", field("method", 1, ""), field("params", 2, ".google.protobuf.Struct")),
+			message("CallResponse", field("result", 1, ".google.protobuf.Value")),
+			message("StreamEvent", field("method", 1, ""), field("params", 2, ".google.protobuf.Struct")),
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Core"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Call"), InputType: proto.String(".fluxgrid.core.v1.CallRequest"), OutputType: proto.String(".fluxgrid.core.v1.CallResponse")},
+				{Name: proto.String("ExecuteStream"), InputType: proto.String(".google.protobuf.Struct"), OutputType: proto.String(".fluxgrid.core.v1.StreamEvent"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+	var err error
+	if file, err = protodesc.NewFile(descriptor, protoregistry.GlobalFiles); err != nil {
+		panic(err)
+	}
+	// Registered so that server reflection can describe the service.
+	if err := protoregistry.GlobalFiles.RegisterFile(file); err != nil {
+		panic(err)
+	}
+	callRequest = file.Messages().ByName("CallRequest")
+	callResponse = file.Messages().ByName("CallResponse")
+	streamEvent = file.Messages().ByName("StreamEvent")
+}
+
+// Service implements the Core gRPC service on top of an RPC server.
+type Service struct {
+	server *rpc.Server
+	auth   rpc.Authenticator
+}
+
+// Register adds the Core service to registrar. Calls must carry a bearer token auth
+// accepts, and run as the tenant it returns.
+func Register(registrar grpc.ServiceRegistrar, server *rpc.Server, auth rpc.Authenticator) {
+	registrar.RegisterService(&grpc.ServiceDesc{
+		ServiceName: ServiceName,
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Call",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := dynamicpb.NewMessage(callRequest)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return srv.(*Service).call(ctx, in)
+			},
+		}},
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "ExecuteStream",
+			ServerStreams: true,
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				in := dynamicpb.NewMessage(structMessage)
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+				return srv.(*Service).executeStream(stream, in)
+			},
+		}},
+		Metadata: "fluxgrid/core/v1/core.proto",
+	}, &Service{server: server, auth: auth})
+}
+
+// authorize returns the tenant the call's bearer token belongs to.
+func (s *Service) authorize(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			if tenant, ok := s.auth(token); ok {
+				return tenant, nil
+			}
+		}
+	}
+	return "", status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+func (s *Service) call(ctx context.Context, in proto.Message) (proto.Message, error) {
+	tenant, err := s.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var request struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := fromProto(in, &request); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if request.Method == "" {
+		return nil, status.Error(codes.InvalidArgument, "method is required")
+	}
+	if request.Params == nil {
+		request.Params = json.RawMessage("{}")
+	}
+
+	conn := s.server.ConnectAs(tenant)
+	defer conn.Close()
+	if err := conn.Send(rpc.Request{JSONRPC: "2.0", Method: request.Method, Params: request.Params, ID: &requestID}); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	response, err := receiveResponse(conn)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if response.Error != nil {
+		return nil, statusOf(response.Error)
+	}
+	if response.Result == nil {
+		response.Result = json.RawMessage("null")
+	}
+	return toProto(callResponse, map[string]json.RawMessage{"result": response.Result})
+}
+
+var requestID = json.RawMessage(`"grpc"`)
+
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Params json.RawMessage `json:"params"`
+	Error  *rpc.Error      `json:"error"`
+}
+
+// receiveResponse reads messages until the response to the request, skipping the
+// notifications before it.
+func receiveResponse(conn *rpc.Local) (response, error) {
+	for {
+		message, err := receive(conn)
+		if err != nil || message.ID != nil {
+			return message, err
+		}
+	}
+}
+
+func receive(conn *rpc.Local) (response, error) {
+	raw, err := conn.Receive()
+	if err != nil {
+		return response{}, err
+	}
+	var message response
+	err = json.Unmarshal(raw, &message)
+	return message, err
+}
+
+func (s *Service) executeStream(stream grpc.ServerStream, in proto.Message) error {
+	ctx := stream.Context()
+	tenant, err := s.authorize(ctx)
+	if err != nil {
+		return err
+	}
+	var params map[string]any
+	if err := fromProto(in, &params); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	options, _ := params["options"].(map[string]any)
+	if options == nil {
+		options = map[string]any{}
+	}
+	options["mode"] = "stream"
+	params["options"] = options
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	conn := s.server.ConnectAs(tenant)
+	defer conn.Close()
+	if err := conn.Send(rpc.Request{JSONRPC: "2.0", Method: "query.execute", Params: encoded, ID: &requestID}); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	response, err := receiveResponse(conn)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if response.Error != nil {
+		return statusOf(response.Error)
+	}
+	var started struct {
+		RequestID string `json:"requestId"`
+	}
+	if json.Unmarshal(response.Result, &started) != nil || started.RequestID == "" {
+		return status.Error(codes.Internal, errNotStreaming.Error())
+	}
+
+	// Cancelling the call cancels the stream; the core then ends it with an error event.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Send(map[string]any{"jsonrpc": "2.0", "method": "query.stream.cancel", "params": map[string]string{"requestId": started.RequestID}})
+	})
+	defer stop()
+	for {
+		event, err := receive(conn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return status.Error(codes.Internal, err.Error())
+		}
+		if !strings.HasPrefix(event.Method, "query.stream.") {
+			continue
+		}
+		if event.Method == "query.stream.error" {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			var failure struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(event.Params, &failure)
+			return withInfo(status.New(codes.Aborted, failure.Message), failure.Code, map[string]string{"stream": string(event.Params)})
+		}
+		message, err := toProto(streamEvent, map[string]any{"method": event.Method, "params": event.Params})
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.SendMsg(message); err != nil {
+			return err
+		}
+		switch event.Method {
+		case "query.stream.chunk":
+			var chunk struct {
+				Seq int `json:"seq"`
+			}
+			_ = json.Unmarshal(event.Params, &chunk)
+			ack := map[string]any{"requestId": started.RequestID, "seq": chunk.Seq}
+			if err := conn.Send(map[string]any{"jsonrpc": "2.0", "method": "query.stream.ack", "params": ack}); err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+		case "query.stream.complete":
+			return nil
+		}
+	}
+}
+
+// statusOf converts a JSON-RPC error to a status carrying its code and data.
+func statusOf(rpcErr *rpc.Error) error {
+	code := codes.Unknown
+	switch rpcErr.Code {
+	case -32700, -32600, -32602:
+		code = codes.InvalidArgument
+	case -32601:
+		code = codes.Unimplemented
+	case -32603:
+		code = codes.Internal
+	case -32100:
+		code = codes.ResourceExhausted
+	case -32190:
+		code = codes.PermissionDenied
+	}
+	metadata := map[string]string{"code": strconv.Itoa(rpcErr.Code)}
+	if rpcErr.Data != nil {
+		if data, err := json.Marshal(rpcErr.Data); err == nil {
+			metadata["data"] = string(data)
+		}
+	}
+	return withInfo(status.New(code, rpcErr.Message), "RPC_ERROR", metadata)
+}
+
+func withInfo(st *status.Status, reason string, metadata map[string]string) error {
+	if reason == "" {
+		reason = "STREAM_ERROR"
+	}
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain, Metadata: metadata})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// fromProto decodes a message into v through its JSON form.
+func fromProto(message proto.Message, v any) error {
+	encoded, err := protojson.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// toProto builds a message of the given type from the JSON form of v.
+func toProto(descriptor protoreflect.MessageDescriptor, v any) (proto.Message, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	message := dynamicpb.NewMessage(descriptor)
+	if err := protojson.Unmarshal(encoded, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// errNotStreaming is returned when query.execute did not start a stream.
+var errNotStreaming = errors.New("query.execute did not start a stream")
@@ -0,0 +1,242 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// testServer serves echo and a query.execute that streams three chunks, sending each one
+// only after the previous one was acknowledged, or fails after the first for SQL "fail".
+func testServer(t *testing.T) *rpc.Server {
+	t.Helper()
+	server := rpc.NewServer(zerolog.Nop())
+	var mu sync.Mutex
+	acks := map[string]chan int{}
+	server.Register("echo", func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var p map[string]any
+		_ = json.Unmarshal(params, &p)
+		if p["fail"] == true {
+			return nil, &rpc.Error{Code: -32602, Message: "invalid parameters", Data: "fail was set"}
+		}
+		return p, nil
+	})
+	server.Register("query.execute", func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var p struct {
+			SQL     string `json:"sql"`
+			Options struct {
+				Mode string `json:"mode"`
+			} `json:"options"`
+		}
+		_ = json.Unmarshal(params, &p)
+		if p.Options.Mode != "stream" {
+			return nil, &rpc.Error{Code: -32602, Message: "expected stream mode"}
+		}
+		session, _ := rpc.SessionFromContext(ctx)
+		id, _ := rpc.RequestIDFromContext(ctx)
+		ack := make(chan int, 1)
+		mu.Lock()
+		acks[id] = ack
+		mu.Unlock()
+		go func() {
+			_ = session.NotifyRequest(id, "query.stream.start", map[string]any{"requestId": id, "columns": []any{map[string]string{"name": "n"}}})
+			for seq := 1; seq <= 3; seq++ {
+				_ = session.NotifyRequest(id, "query.stream.chunk", map[string]any{"requestId": id, "seq": seq, "rows": [][]int{{seq}}, "hasMore": seq < 3})
+				if p.SQL == "fail" {
+					_ = session.NotifyRequest(id, "query.stream.error", map[string]any{"requestId": id, "code": "EXECUTION_ERROR", "message": "boom", "fatal": true})
+					return
+				}
+				select {
+				case got := <-ack:
+					if got != seq {
+						return
+					}
+				case <-session.Context().Done():
+					return
+				}
+			}
+			_ = session.NotifyRequest(id, "query.stream.complete", map[string]any{"requestId": id})
+		}()
+		return map[string]any{"mode": "stream", "requestId": id}, nil
+	})
+	server.RegisterNotification("query.stream.ack", func(_ context.Context, params json.RawMessage) {
+		var p struct {
+			RequestID string `json:"requestId"`
+			Seq       int    `json:"seq"`
+		}
+		_ = json.Unmarshal(params, &p)
+		mu.Lock()
+		ack := acks[p.RequestID]
+		mu.Unlock()
+		if ack != nil {
+			ack <- p.Seq
+		}
+	})
+	return server
+}
+
+func dial(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	Register(grpcServer, testServer(t), rpc.TokenAuthenticator("secret"))
+	go func() { _ = grpcServer.Serve(listener) }()
+	t.Cleanup(grpcServer.Stop)
+	conn, err := grpc.NewClient("passthrough:///core",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func authorized(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestCallRunsMethods(t *testing.T) {
+	conn := dial(t)
+	invoke := func(ctx context.Context, request string) (string, error) {
+		in, err := toProto(callRequest, json.RawMessage(request))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := dynamicpb.NewMessage(callResponse)
+		if err := conn.Invoke(ctx, "/fluxgrid.core.v1.Core/Call", in, out); err != nil {
+			return "", err
+		}
+		var decoded map[string]any
+		if err := fromProto(out, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		encoded, _ := json.Marshal(decoded["result"])
+		return string(encoded), nil
+	}
+
+	if _, err := invoke(authorized("wrong"), `{"method":"echo"}`); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("wrong token: %v", err)
+	}
+	result, err := invoke(authorized("secret"), `{"method":"echo","params":{"n":1,"s":"x"}}`)
+	if err != nil || result != `{"n":1,"s":"x"}` {
+		t.Fatalf("echo = %s, %v", result, err)
+	}
+	if _, err := invoke(authorized("secret"), `{"method":"missing"}`); status.Code(err) != codes.Unimplemented {
+		t.Fatalf("missing: %v", err)
+	}
+	_, err = invoke(authorized("secret"), `{"method":"echo","params":{"fail":true}}`)
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+		t.Fatalf("fail: %v", err)
+	}
+	info := st.Details()[0].(*errdetails.ErrorInfo)
+	if info.Metadata["code"] != "-32602" || info.Metadata["data"] != `"fail was set"` {
+		t.Fatalf("info = %v", info)
+	}
+}
+
+func TestExecuteStreamSendsEventsAndAcknowledgesChunks(t *testing.T) {
+	conn := dial(t)
+	desc := &grpc.StreamDesc{StreamName: "ExecuteStream", ServerStreams: true}
+	run := func(sql string) ([]string, error) {
+		stream, err := conn.NewStream(authorized("secret"), desc, "/fluxgrid.core.v1.Core/ExecuteStream")
+		if err != nil {
+			t.Fatal(err)
+		}
+		in, _ := toProto(structMessage, map[string]any{"sql": sql})
+		if err := stream.SendMsg(in); err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatal(err)
+		}
+		var methods []string
+		for {
+			out := dynamicpb.NewMessage(streamEvent)
+			if err := stream.RecvMsg(out); err != nil {
+				if errors.Is(err, io.EOF) {
+					return methods, nil
+				}
+				return methods, err
+			}
+			methods = append(methods, out.Get(streamEvent.Fields().ByName("method")).String())
+		}
+	}
+
+	methods, err := run("SELECT n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "query.stream.start query.stream.chunk query.stream.chunk query.stream.chunk query.stream.complete"
+	if got := strings.Join(methods, " "); got != want {
+		t.Fatalf("events = %s", got)
+	}
+
+	_, err = run("fail")
+	st := status.Convert(err)
+	if st.Code() != codes.Aborted || st.Message() != "boom" || st.Details()[0].(*errdetails.ErrorInfo).Reason != "EXECUTION_ERROR" {
+		t.Fatalf("error = %v", err)
+	}
+}
+
+// TestDescriptorMatchesProtoFile keeps the run-time descriptor in step with core.proto.
+func TestDescriptorMatchesProtoFile(t *testing.T) {
+	source, err := os.ReadFile("../../proto/fluxgrid/core/v1/core.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := regexp.MustCompile(`\s+`).ReplaceAllString(string(source), " ")
+	messages := file.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		message := messages.Get(i)
+		if !strings.Contains(text, "message "+string(message.Name())+" {") {
+			t.Errorf("core.proto lacks message %s", message.Name())
+		}
+		for j := 0; j < message.Fields().Len(); j++ {
+			field := message.Fields().Get(j)
+			typeName := field.Kind().String()
+			if field.Kind() == protoreflect.MessageKind {
+				typeName = string(field.Message().FullName())
+			}
+			line := fmt.Sprintf("%s %s = %d;", typeName, field.Name(), field.Number())
+			if !strings.Contains(text, line) {
+				t.Errorf("core.proto lacks %q in %s", line, message.Name())
+			}
+		}
+	}
+	methods := file.Services().Get(0).Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		output := string(method.Output().FullName())
+		if method.IsStreamingServer() {
+			output = "stream " + output
+		}
+		input := strings.TrimPrefix(string(method.Input().FullName()), "fluxgrid.core.v1.")
+		output = strings.Replace(output, "fluxgrid.core.v1.", "", 1)
+		line := "rpc " + string(method.Name()) + "(" + input + ") returns (" + output + ");"
+		if !strings.Contains(text, line) {
+			t.Errorf("core.proto lacks %q", line)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fluxgrid/core/internal/advisor"
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/explain"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultAdvisorHistory     = 50
+	defaultAdvisorSuggestions = 10
+	// maxSuggestionConditions bounds the conditions listed for a suggestion.
+	maxSuggestionConditions = 5
+)
+
+type advisorIndexesParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	// SQL is the statement to advise on. Without it the advisor reads the recent
+	// successful runs on the connection's database from history.
+	SQL string `json:"sql,omitempty"`
+	// HistoryLimit bounds the distinct statements read from history; it defaults to 50.
+	HistoryLimit int `json:"historyLimit,omitempty"`
+	// MaxSuggestions defaults to 10.
+	MaxSuggestions int `json:"maxSuggestions,omitempty"`
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+type indexSuggestion struct {
+	// Table is schema-qualified when the table is not on the search path.
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	DDL     string   `json:"ddl"`
+	// Reasons are advisor.ReasonFilter and advisor.ReasonJoinKey.
+	Reasons    []string `json:"reasons"`
+	Conditions []string `json:"conditions"`
+	// Statements counts the statements the index may help.
+	Statements int `json:"statements"`
+	// CostPercent is the largest share of a statement's estimated cost spent in the scan
+	// the index would replace.
+	CostPercent float64 `json:"costPercent"`
+	// CostBefore and CostAfter are the summed estimated costs of those statements
+	// without and with the index, when hypopg could create it hypothetically.
+	CostBefore         *float64 `json:"costBefore,omitempty"`
+	CostAfter          *float64 `json:"costAfter,omitempty"`
+	ImprovementPercent *float64 `json:"improvementPercent,omitempty"`
+
+	table      string
+	statements map[int]bool
+}
+
+type skippedIndex struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Reason  string   `json:"reason"`
+}
+
+type statementFailure struct {
+	SQL   string `json:"sql"`
+	Error string `json:"error"`
+}
+
+type advisorIndexesResult struct {
+	// Statements counts the statements that were planned.
+	Statements int `json:"statements"`
+	// Hypothetical is set when the suggestions were checked with hypopg.
+	Hypothetical bool               `json:"hypothetical"`
+	Suggestions  []indexSuggestion  `json:"suggestions"`
+	Skipped      []skippedIndex     `json:"skipped,omitempty"`
+	Failed       []statementFailure `json:"failed,omitempty"`
+}
+
+// advisorIndexesHandler suggests indexes for a statement, or for the recent history of a
+// database. Sequential scans whose filters or join keys an index could serve give the
+// candidates; those an existing index already covers are dropped. When the hypopg
+// extension is installed each candidate is created hypothetically and kept only if it
+// lowers the estimated cost of the statements it was proposed for.
+func advisorIndexesHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload advisorIndexesParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Connection.Driver != "postgres" {
+			return nil, &rpc.Error{
+				Code:    -32601,
+				Message: fmt.Sprintf("index advice is not supported for driver: %s", payload.Connection.Driver),
+			}
+		}
+		if payload.HistoryLimit <= 0 {
+			payload.HistoryLimit = defaultAdvisorHistory
+		}
+		if payload.MaxSuggestions <= 0 {
+			payload.MaxSuggestions = defaultAdvisorSuggestions
+		}
+		if payload.TimeoutSeconds <= 0 {
+			payload.TimeoutSeconds = 30
+		}
+
+		statements := []string{payload.SQL}
+		if payload.SQL == "" {
+			statements = advisedRuns(ctx, spaces, payload.Connection, payload.HistoryLimit)
+		}
+		result := advisorIndexesResult{Suggestions: []indexSuggestion{}}
+		if len(statements) == 0 {
+			return result, nil
+		}
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(payload.TimeoutSeconds)*time.Second)
+		defer cancel()
+		conn, _, err := connectPostgres(timeoutCtx, payload.Connection.DSN)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32010,
+				Message: "failed to connect to database",
+				Data:    err.Error(),
+			}
+		}
+		defer conn.Close(context.Background())
+
+		costs := make([]float64, len(statements))
+		byKey := make(map[string]*indexSuggestion)
+		var order []*indexSuggestion
+		for i, statement := range statements {
+			plan, err := explainCost(timeoutCtx, conn, statement)
+			if err != nil {
+				result.Failed = append(result.Failed, statementFailure{SQL: statement, Error: err.Error()})
+				continue
+			}
+			result.Statements++
+			costs[i] = plan.TotalCost
+			for _, candidate := range advisor.Candidates(plan) {
+				key := candidate.Table + "\x00" + strings.Join(candidate.Columns, "\x00")
+				s, ok := byKey[key]
+				if !ok {
+					s = &indexSuggestion{table: candidate.Table, Columns: candidate.Columns, statements: make(map[int]bool)}
+					byKey[key] = s
+					order = append(order, s)
+				}
+				s.statements[i] = true
+				s.CostPercent = math.Max(s.CostPercent, candidate.CostPercent)
+				if !slices.Contains(s.Reasons, candidate.Reason) {
+					s.Reasons = append(s.Reasons, candidate.Reason)
+				}
+				if !slices.Contains(s.Conditions, candidate.Condition) && len(s.Conditions) < maxSuggestionConditions {
+					s.Conditions = append(s.Conditions, candidate.Condition)
+				}
+			}
+		}
+
+		tables := make(map[string]*advisedTable)
+		var kept []*indexSuggestion
+		for _, s := range order {
+			table, ok := tables[s.table]
+			if !ok {
+				if table, err = readAdvisedTable(timeoutCtx, conn, s.table); err != nil {
+					return nil, &rpc.Error{
+						Code:    -32011,
+						Message: "query execution failed",
+						Data:    err.Error(),
+					}
+				}
+				tables[s.table] = table
+			}
+			skip := func(reason string) {
+				result.Skipped = append(result.Skipped, skippedIndex{Table: s.table, Columns: s.Columns, Reason: reason})
+			}
+			if table == nil {
+				skip("table not found")
+				continue
+			}
+			if missing := table.missing(s.Columns); missing != "" {
+				skip("column not found: " + missing)
+				continue
+			}
+			if index := table.covering(s.Columns); index != "" {
+				skip("covered by index " + index)
+				continue
+			}
+			quoted := make([]string, len(s.Columns))
+			for i, column := range s.Columns {
+				quoted[i] = pgx.Identifier{column}.Sanitize()
+			}
+			s.Table = table.name
+			s.DDL = fmt.Sprintf("CREATE INDEX ON %s (%s)", table.name, strings.Join(quoted, ", "))
+			s.Statements = len(s.statements)
+			kept = append(kept, s)
+		}
+
+		if err := conn.QueryRow(timeoutCtx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'hypopg')").Scan(&result.Hypothetical); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32011,
+				Message: "query execution failed",
+				Data:    err.Error(),
+			}
+		}
+		if result.Hypothetical {
+			checked := kept[:0]
+			for _, s := range kept {
+				before, after, err := hypotheticalCosts(timeoutCtx, conn, s, statements, costs)
+				if err != nil {
+					result.Skipped = append(result.Skipped, skippedIndex{Table: s.Table, Columns: s.Columns, Reason: "hypopg: " + err.Error()})
+					continue
+				}
+				if after >= before {
+					result.Skipped = append(result.Skipped, skippedIndex{Table: s.Table, Columns: s.Columns, Reason: "the planner would not use it"})
+					continue
+				}
+				improvement := math.Round(1000*(before-after)/before) / 10
+				s.CostBefore, s.CostAfter, s.ImprovementPercent = &before, &after, &improvement
+				checked = append(checked, s)
+			}
+			kept = checked
+		}
+
+		sort.SliceStable(kept, func(i, j int) bool {
+			a, b := kept[i], kept[j]
+			if a.ImprovementPercent != nil && *a.ImprovementPercent != *b.ImprovementPercent {
+				return *a.ImprovementPercent > *b.ImprovementPercent
+			}
+			if a.Statements != b.Statements {
+				return a.Statements > b.Statements
+			}
+			return a.CostPercent > b.CostPercent
+		})
+		for _, s := range kept[:min(len(kept), payload.MaxSuggestions)] {
+			result.Suggestions = append(result.Suggestions, *s)
+		}
+		return result, nil
+	}
+}
+
+// advisedRuns returns the statements recently run successfully on the database of conn,
+// newest first, that EXPLAIN can plan: the latest run of each fingerprint, so that runs
+// of one query with other values are planned once.
+func advisedRuns(ctx context.Context, spaces *workspaces, conn dbConnectionParams, limit int) []string {
+	runs := spaces.history(ctx)
+	if runs == nil {
+		return nil
+	}
+	target := connectionTarget(conn)
+	entries := runs.Runs()
+	seen := make(map[string]bool)
+	var statements []string
+	for i := len(entries) - 1; i >= 0 && len(statements) < limit; i-- {
+		e := entries[i]
+		if e.Driver != conn.Driver || e.Target != target || e.Error != "" || seen[runFingerprint(e)] || !ddl.Explainable(e.SQL) {
+			continue
+		}
+		seen[runFingerprint(e)] = true
+		statements = append(statements, e.SQL)
+	}
+	return statements
+}
+
+// explainCost plans statement on conn without running it.
+func explainCost(ctx context.Context, conn *pgx.Conn, statement string) (*explain.Analysis, error) {
+	var plan string
+	if err := conn.QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+statement).Scan(&plan); err != nil {
+		return nil, err
+	}
+	return explain.Analyze(json.RawMessage(plan))
+}
+
+// hypotheticalCosts returns the summed estimated costs of the statements s was proposed
+// for, as planned without and with s created as a hypothetical index.
+func hypotheticalCosts(ctx context.Context, conn *pgx.Conn, s *indexSuggestion, statements []string, costs []float64) (float64, float64, error) {
+	if _, err := conn.Exec(ctx, "SELECT * FROM hypopg_create_index($1)", s.DDL); err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.WithoutCancel(ctx), "SELECT hypopg_reset()")
+	}()
+	var before, after float64
+	for i := range s.statements {
+		plan, err := explainCost(ctx, conn, statements[i])
+		if err != nil {
+			return 0, 0, err
+		}
+		before += costs[i]
+		after += plan.TotalCost
+	}
+	return before, after, nil
+}
+
+// advisedTable holds what the advisor needs to know of a table.
+type advisedTable struct {
+	// name is the table as regclass prints it.
+	name    string
+	columns map[string]bool
+	// indexes are the key columns of its indexes by index name; expressions are "".
+	indexes map[string][]string
+}
+
+// readAdvisedTable reads the columns and indexes of the table a plan names, resolved on
+// the search path. It returns nil for a table it cannot find.
+func readAdvisedTable(ctx context.Context, conn *pgx.Conn, relation string) (*advisedTable, error) {
+	var (
+		oid  *uint32
+		name string
+	)
+	if err := conn.QueryRow(ctx, "SELECT to_regclass($1)::oid, coalesce(to_regclass($1)::text, '')", pgx.Identifier{relation}.Sanitize()).Scan(&oid, &name); err != nil {
+		return nil, err
+	}
+	if oid == nil {
+		return nil, nil
+	}
+	table := &advisedTable{name: name, columns: make(map[string]bool), indexes: make(map[string][]string)}
+	rows, err := conn.Query(ctx, "SELECT attname FROM pg_attribute WHERE attrelid = $1 AND attnum > 0 AND NOT attisdropped", *oid)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, column := range columns {
+		table.columns[column] = true
+	}
+	rows, err = conn.Query(ctx, `
+		SELECT i.indexrelid::regclass::text,
+			array(SELECT coalesce(a.attname::text, '')
+				FROM unnest(i.indkey::int2[]) WITH ORDINALITY AS k(attnum, n)
+				LEFT JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+				ORDER BY k.n)
+		FROM pg_index i
+		WHERE i.indrelid = $1 AND i.indpred IS NULL`, *oid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			index string
+			keys  []string
+		)
+		if err := rows.Scan(&index, &keys); err != nil {
+			return nil, err
+		}
+		table.indexes[index] = keys
+	}
+	return table, rows.Err()
+}
+
+// missing returns the first of columns the table does not have.
+func (t *advisedTable) missing(columns []string) string {
+	for _, column := range columns {
+		if !t.columns[column] {
+			return column
+		}
+	}
+	return ""
+}
+
+// covering returns the name of an index that already serves columns.
+func (t *advisedTable) covering(columns []string) string {
+	names := make([]string, 0, len(t.indexes))
+	for name := range t.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if advisor.Covers(t.indexes[name], columns) {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestAdvisorIndexesSuggestsAnIndexForAFilter(t *testing.T) {
+	dsn := os.Getenv("FLUXGRID_PG_DSN")
+	if dsn == "" {
+		t.Skip("FLUXGRID_PG_DSN not set, skipping integration test")
+	}
+	ctx := context.Background()
+	conn, _, err := connectPostgres(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	for _, stmt := range []string{
+		"DROP TABLE IF EXISTS advisor_orders",
+		"CREATE TABLE advisor_orders (id bigint PRIMARY KEY, status text, created_at timestamptz)",
+		"INSERT INTO advisor_orders SELECT g, CASE WHEN g % 100 = 0 THEN 'open' ELSE 'closed' END, now() FROM generate_series(1, 20000) g",
+		"ANALYZE advisor_orders",
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	defer conn.Exec(ctx, "DROP TABLE advisor_orders")
+
+	handler := advisorIndexesHandler(newWorkspaces(t.TempDir(), nil))
+	params, _ := json.Marshal(advisorIndexesParams{
+		Connection: dbConnectionParams{Driver: "postgres", DSN: dsn},
+		SQL:        "SELECT * FROM advisor_orders WHERE status = 'open'",
+	})
+	result, rpcErr := handler(ctx, params)
+	if rpcErr != nil {
+		t.Fatalf("advisor.indexes: %+v", rpcErr)
+	}
+	advice := result.(advisorIndexesResult)
+	if advice.Statements != 1 || len(advice.Suggestions) != 1 {
+		t.Fatalf("advice = %+v", advice)
+	}
+	suggestion := advice.Suggestions[0]
+	if !slices.Equal(suggestion.Columns, []string{"status"}) || suggestion.DDL != `CREATE INDEX ON advisor_orders ("status")` {
+		t.Fatalf("suggestion = %+v", suggestion)
+	}
+}
+
+func TestAdvisorIndexesNeedsPostgres(t *testing.T) {
+	handler := advisorIndexesHandler(newWorkspaces(t.TempDir(), nil))
+	params, _ := json.Marshal(advisorIndexesParams{
+		Connection: dbConnectionParams{Driver: "sqlite", DSN: "file::memory:"},
+		SQL:        "SELECT 1",
+	})
+	if _, rpcErr := handler(context.Background(), params); rpcErr == nil || rpcErr.Code != -32601 {
+		t.Fatalf("error = %+v", rpcErr)
+	}
+}
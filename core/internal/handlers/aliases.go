@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ConnectionAlias is a connection defined in the core's configuration. Clients refer to it
+// as {"alias": name}, so that teams can share connection definitions without copying
+// hostnames and credentials into each editor's settings.
+type ConnectionAlias struct {
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+	// Pool sizes the connection pool of a Postgres alias.
+	Pool *PoolOptions `json:"pool,omitempty"`
+	// Replicas are DSNs of read replicas that query.execute sends reads to.
+	Replicas []string `json:"replicas,omitempty"`
+	// Tags label the alias. Results of aliases tagged restricted are masked by the
+	// configured masking policy.
+	Tags []string `json:"tags,omitempty"`
+	// SearchPath sets the schemas unqualified names resolve in on a Postgres alias.
+	SearchPath []string `json:"searchPath,omitempty"`
+	// Variables are the default values of template variables in statements run on the
+	// alias, such as {"tenant_id": 42} for {{tenant_id}}.
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+// LoadConnectionAliases reads a JSON object mapping alias names to connections. Postgres
+// DSNs may themselves name a pg_service.conf entry with service=.
+func LoadConnectionAliases(path string) (map[string]ConnectionAlias, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var aliases map[string]ConnectionAlias
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name, alias := range aliases {
+		if err := checkConnectionAlias(name, alias); err != nil {
+			return nil, err
+		}
+		if len(alias.SearchPath) > 0 {
+			alias.DSN = withSearchPath(alias.DSN, alias.SearchPath)
+			for i, replica := range alias.Replicas {
+				alias.Replicas[i] = withSearchPath(replica, alias.SearchPath)
+			}
+			aliases[name] = alias
+		}
+	}
+	return aliases, nil
+}
+
+// activateConnectionAlias sets up the pool, replicas and masking of an alias. Alias DSNs
+// are configured for the life of the process, so they stay redacted.
+func activateConnectionAlias(alias ConnectionAlias) {
+	for _, dsn := range append([]string{alias.DSN}, alias.Replicas...) {
+		for _, value := range connectionSecrets(dbConnectionParams{Driver: alias.Driver, DSN: dsn}) {
+			logging.Redact(value)
+		}
+	}
+	if alias.Driver == "postgres" && alias.Pool != nil {
+		postgresPools.configure(alias.DSN, *alias.Pool)
+	}
+	if len(alias.Replicas) > 0 {
+		readReplicas.configure(dbConnectionParams{Driver: alias.Driver, DSN: alias.DSN}, alias.Replicas)
+	}
+	if alias.Restricted() {
+		dataMasks.restrict(alias.Driver, append([]string{alias.DSN}, alias.Replicas...)...)
+	}
+	if len(alias.Variables) > 0 {
+		templateVariables.configure(dbConnectionParams{Driver: alias.Driver, DSN: alias.DSN}, alias.Variables)
+	}
+}
+
+func checkConnectionAlias(name string, alias ConnectionAlias) error {
+	if _, ok := defaultConnectionTesters()[alias.Driver]; !ok {
+		return fmt.Errorf("alias %q: driver not supported: %s", name, alias.Driver)
+	}
+	if alias.DSN == "" {
+		return fmt.Errorf("alias %q: DSN is required", name)
+	}
+	for _, replica := range alias.Replicas {
+		if replica == "" {
+			return fmt.Errorf("alias %q: replica DSN is required", name)
+		}
+	}
+	if len(alias.SearchPath) > 0 && alias.Driver != "postgres" {
+		return fmt.Errorf("alias %q: searchPath is only supported for postgres", name)
+	}
+	if err := checkTemplateValues(alias.Variables); err != nil {
+		return fmt.Errorf("alias %q: %w", name, err)
+	}
+	return nil
+}
+
+// resolveConnectionService checks that a Postgres DSN naming a service resolves against
+// the service file, so that a missing or misspelt service is reported as bad parameters
+// rather than as a failure to dial.
+func resolveConnectionService(driver, dsn string) error {
+	if driver != "postgres" || !strings.Contains(dsn, "service=") {
+		return nil
+	}
+	if _, err := pgconn.ParseConfig(dsn); err != nil {
+		return fmt.Errorf("cannot resolve connection service: %w", err)
+	}
+	return nil
+}
+
+type connectionAliasInfo struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"`
+}
+
+type connectionAliasesResult struct {
+	Aliases []connectionAliasInfo `json:"aliases"`
+}
+
+// connectionAliasesHandler lists the aliases of the client's workspace without their DSNs.
+func connectionAliasesHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		aliases := spaces.aliases(ctx)
+		result := connectionAliasesResult{Aliases: make([]connectionAliasInfo, 0, len(aliases))}
+		for name, alias := range aliases {
+			result.Aliases = append(result.Aliases, connectionAliasInfo{Name: name, Driver: alias.Driver})
+		}
+		sort.Slice(result.Aliases, func(i, j int) bool { return result.Aliases[i].Name < result.Aliases[j].Name })
+		return result, nil
+	}
+}
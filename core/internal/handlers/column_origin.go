@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const columnOriginSQL = `
+SELECT a.attrelid::bigint, n.nspname, c.relname, a.attnum, a.attname
+FROM pg_catalog.pg_attribute a
+JOIN pg_catalog.pg_class c ON c.oid = a.attrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+WHERE a.attrelid::bigint = ANY($1) AND a.attnum > 0`
+
+type attributeKey struct {
+	table  uint32
+	number int16
+}
+
+// lookupColumnOrigins fills in the source table and column of result columns that reference
+// a table column directly, so clients can tell apart columns that share a name. It must run
+// after the result rows have been closed because it reuses the connection.
+func lookupColumnOrigins(ctx context.Context, conn *pgx.Conn, fields []pgconn.FieldDescription, columns []column) error {
+	var tables []int64
+	seen := make(map[uint32]bool)
+	for _, field := range fields {
+		if field.TableOID != 0 && !seen[field.TableOID] {
+			seen[field.TableOID] = true
+			tables = append(tables, int64(field.TableOID))
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	rows, err := conn.Query(ctx, columnOriginSQL, tables)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	origins := make(map[attributeKey]resultset.ColumnOrigin)
+	for rows.Next() {
+		var (
+			oid    int64
+			number int16
+			origin resultset.ColumnOrigin
+		)
+		if err := rows.Scan(&oid, &origin.Schema, &origin.Table, &number, &origin.Column); err != nil {
+			return err
+		}
+		origin.TableOID = uint32(oid)
+		origins[attributeKey{table: origin.TableOID, number: number}] = origin
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	applyColumnOrigins(fields, columns, origins)
+	return nil
+}
+
+func applyColumnOrigins(fields []pgconn.FieldDescription, columns []column, origins map[attributeKey]resultset.ColumnOrigin) {
+	for i, field := range fields {
+		if i >= len(columns) || field.TableOID == 0 {
+			continue
+		}
+		if origin, ok := origins[attributeKey{table: field.TableOID, number: int16(field.TableAttributeNumber)}]; ok {
+			columns[i].Origin = &origin
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/secret"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	errUnknownHandle  = errors.New("unknown connection handle")
+	errHandleRequired = errors.New("raw DSNs are disabled; open the connection with connection.open and pass its handle")
+)
+
+// connectionRootMethods take their connection as the params object itself rather than
+// under a "connection" key.
+var connectionRootMethods = map[string]bool{"connect.test": true}
+
+type openConnection struct {
+	driver  string
+	dsn     secret.Secret
+	release []func()
+}
+
+// connectionHandles maps the handles a client opened to their connection parameters, so
+// that the DSN crosses the wire once. Handles are only valid on the session that opened
+// them and are released when it disconnects.
+type connectionHandles struct {
+	mu      sync.Mutex
+	handles map[string]*openConnection
+}
+
+type connectionHandlesKey struct{}
+
+func handlesOf(ctx context.Context) (*connectionHandles, bool) {
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return client.Value(connectionHandlesKey{}, func() any {
+		h := &connectionHandles{handles: make(map[string]*openConnection)}
+		client.OnClose(h.closeAll)
+		return h
+	}).(*connectionHandles), true
+}
+
+func (h *connectionHandles) open(params dbConnectionParams, replicas ...string) (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", err
+	}
+	handle := "conn_" + hex.EncodeToString(id[:])
+
+	conn := &openConnection{driver: params.Driver, dsn: secret.New(params.DSN)}
+	conn.release = append(conn.release, conn.dsn.Release)
+	// Handles stand in for credentials, so both are kept out of the logs.
+	for _, value := range connectionSecrets(params) {
+		conn.release = append(conn.release, logging.Redact(value))
+	}
+	for _, replica := range replicas {
+		for _, value := range connectionSecrets(dbConnectionParams{Driver: params.Driver, DSN: replica}) {
+			conn.release = append(conn.release, logging.Redact(value))
+		}
+	}
+	conn.release = append(conn.release, logging.Redact(handle))
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handles[handle] = conn
+	return handle, nil
+}
+
+func (h *connectionHandles) lookup(handle string) (dbConnectionParams, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conn, ok := h.handles[handle]
+	if !ok {
+		return dbConnectionParams{}, false
+	}
+	return dbConnectionParams{Driver: conn.driver, DSN: conn.dsn.Reveal()}, true
+}
+
+// onClose runs release when handle is closed.
+func (h *connectionHandles) onClose(handle string, release func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if conn, ok := h.handles[handle]; ok {
+		conn.release = append(conn.release, release)
+	}
+}
+
+func (h *connectionHandles) close(handle string) bool {
+	h.mu.Lock()
+	conn, ok := h.handles[handle]
+	delete(h.handles, handle)
+	h.mu.Unlock()
+	if ok {
+		for _, release := range conn.release {
+			release()
+		}
+	}
+	return ok
+}
+
+func (h *connectionHandles) closeAll() {
+	h.mu.Lock()
+	handles := make([]string, 0, len(h.handles))
+	for handle := range h.handles {
+		handles = append(handles, handle)
+	}
+	h.mu.Unlock()
+	for _, handle := range handles {
+		h.close(handle)
+	}
+}
+
+// connectionSecrets returns the parts of a connection that must not be logged: the DSN,
+// and for Postgres also the password, which appears on its own in driver errors, and for
+// SQLite the encryption key.
+func connectionSecrets(params dbConnectionParams) []string {
+	secrets := []string{params.DSN}
+	switch params.Driver {
+	case "postgres":
+		if cfg, err := pgx.ParseConfig(params.DSN); err == nil && cfg.Password != "" {
+			secrets = append(secrets, cfg.Password)
+		}
+	case "sqlite":
+		if key := sqliteKey(params.DSN); key != "" {
+			secrets = append(secrets, key)
+		}
+	}
+	return secrets
+}
+
+type connectionOpenParams struct {
+	dbConnectionParams
+	// Pool sizes the connection pool used for this Postgres connection's queries.
+	Pool *PoolOptions `json:"pool,omitempty"`
+	// Replicas are DSNs of read replicas of the connection; query.execute sends
+	// statements that only read to them.
+	Replicas []string `json:"replicas,omitempty"`
+	// SearchPath sets the schemas unqualified names resolve in on a Postgres connection.
+	SearchPath []string `json:"searchPath,omitempty"`
+	// SQLite attaches databases and sets pragmas on a SQLite connection.
+	SQLite *SQLiteOptions `json:"sqlite,omitempty"`
+	// Variables are the default values of template variables in statements run on the
+	// connection.
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type connectionOpenResult struct {
+	Handle string `json:"handle"`
+}
+
+type connectionHandleParams struct {
+	Handle string `json:"handle" jsonschema:"required"`
+}
+
+type connectionCloseResult struct {
+	Closed bool `json:"closed"`
+}
+
+func connectionOpenHandler(ctx context.Context, raw json.RawMessage) (any, *rpc.Error) {
+	var payload connectionOpenParams
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+	if _, ok := defaultConnectionTesters()[payload.Driver]; !ok {
+		return nil, &rpc.Error{
+			Code:    -32601,
+			Message: fmt.Sprintf("driver not supported: %s", payload.Driver),
+		}
+	}
+	if payload.DSN == "" {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "DSN is required",
+		}
+	}
+	if len(payload.SearchPath) > 0 {
+		if payload.Driver != "postgres" {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "searchPath is only supported for postgres",
+			}
+		}
+		payload.DSN = withSearchPath(payload.DSN, payload.SearchPath)
+		for i, replica := range payload.Replicas {
+			payload.Replicas[i] = withSearchPath(replica, payload.SearchPath)
+		}
+	}
+	if payload.SQLite != nil {
+		if payload.Driver != "sqlite" {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "sqlite options are only supported for sqlite",
+			}
+		}
+		dsn, err := withSQLiteOptions(payload.DSN, *payload.SQLite)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: "invalid parameters", Data: err.Error()}
+		}
+		payload.DSN = dsn
+	}
+	if err := checkTemplateValues(payload.Variables); err != nil {
+		return nil, &rpc.Error{Code: -32602, Message: "invalid parameters", Data: err.Error()}
+	}
+
+	handles, ok := handlesOf(ctx)
+	if !ok {
+		return nil, &rpc.Error{Code: -32603, Message: "connection.open requires a client session"}
+	}
+	handle, err := handles.open(payload.dbConnectionParams, payload.Replicas...)
+	if err != nil {
+		return nil, &rpc.Error{Code: -32603, Message: "failed to allocate a connection handle", Data: err.Error()}
+	}
+	if payload.Driver == "postgres" && payload.Pool != nil {
+		postgresPools.configure(payload.DSN, *payload.Pool)
+	}
+	if len(payload.Replicas) > 0 {
+		readReplicas.configure(payload.dbConnectionParams, payload.Replicas)
+	}
+	if len(payload.Variables) > 0 {
+		templateVariables.configure(payload.dbConnectionParams, payload.Variables)
+	}
+	if client, ok := rpc.SessionFromContext(ctx); ok && payload.Driver == "sqlite" {
+		if release, ok := sqliteWatchesOf(client).watch(handle, payload.DSN); ok {
+			handles.onClose(handle, release)
+		}
+	}
+	return connectionOpenResult{Handle: handle}, nil
+}
+
+func connectionCloseHandler(ctx context.Context, raw json.RawMessage) (any, *rpc.Error) {
+	var payload connectionHandleParams
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+	handles, ok := handlesOf(ctx)
+	return connectionCloseResult{Closed: ok && handles.close(payload.Handle)}, nil
+}
+
+// connectionHandleResolution replaces {"handle": ...} and {"alias": ...} connection
+// objects with the driver and DSN the handle was opened with or the alias defines, before
+// the handler or parameter validation sees them. With requireHandles, calls carrying a raw
+// DSN are refused, so that credentials only ever travel in connection.open. Tenants
+// without host access are refused raw DSNs too, and must use their aliases.
+func connectionHandleResolution(requireHandles bool, spaces *workspaces) rpc.Middleware {
+	return func(method string, next rpc.HandlerFunc) rpc.HandlerFunc {
+		if method == "connection.open" {
+			return next
+		}
+		return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+			aliasesOnly := spaces.aliasesOnly(ctx)
+			// A raw DSN can hide behind escaped or differently cased keys, so params are
+			// always walked when DSNs are refused.
+			if !requireHandles && !aliasesOnly &&
+				!bytes.Contains(params, []byte(`"handle"`)) &&
+				!bytes.Contains(params, []byte(`"alias"`)) &&
+				!bytes.Contains(params, []byte("service=")) {
+				return next(ctx, params)
+			}
+			resolved, err := resolveConnectionHandles(ctx, params, connectionRootMethods[method], requireHandles, aliasesOnly, spaces.aliases(ctx))
+			if err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: err.Error(),
+				}
+			}
+			return next(ctx, resolved)
+		}
+	}
+}
+
+func resolveConnectionHandles(
+	ctx context.Context,
+	params json.RawMessage,
+	root, requireHandles, aliasesOnly bool,
+	aliases map[string]ConnectionAlias,
+) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		// Leave malformed params to the handler's own error.
+		return params, nil
+	}
+
+	// Keys are matched like encoding/json matches them to fields, ignoring case.
+	resolve := func(conn map[string]any) error {
+		handleValue, _ := lookupFold(conn, "handle")
+		handle, hasHandle := handleValue.(string)
+		aliasValue, _ := lookupFold(conn, "alias")
+		name, hasAlias := aliasValue.(string)
+		switch {
+		case hasHandle:
+			handles, ok := handlesOf(ctx)
+			if !ok {
+				return errUnknownHandle
+			}
+			target, ok := handles.lookup(handle)
+			if !ok {
+				return errUnknownHandle
+			}
+			deleteFold(conn, "handle", "driver", "dsn")
+			conn["driver"] = target.Driver
+			conn["dsn"] = target.DSN
+		case hasAlias:
+			alias, ok := aliases[name]
+			if !ok {
+				return fmt.Errorf("unknown connection alias: %s", name)
+			}
+			deleteFold(conn, "alias", "driver", "dsn")
+			conn["driver"] = alias.Driver
+			conn["dsn"] = alias.DSN
+		default:
+			if _, hasDSN := lookupFold(conn, "dsn"); hasDSN && aliasesOnly {
+				return errAliasRequired
+			}
+			if _, hasDSN := lookupFold(conn, "dsn"); hasDSN && requireHandles {
+				return errHandleRequired
+			}
+		}
+		driverValue, _ := lookupFold(conn, "driver")
+		driver, _ := driverValue.(string)
+		dsnValue, _ := lookupFold(conn, "dsn")
+		dsn, _ := dsnValue.(string)
+		return resolveConnectionService(driver, dsn)
+	}
+
+	var walk func(any) error
+	walk = func(value any) error {
+		switch v := value.(type) {
+		case map[string]any:
+			for key, child := range v {
+				if conn, ok := child.(map[string]any); ok && strings.EqualFold(key, "connection") {
+					if err := resolve(conn); err != nil {
+						return err
+					}
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, child := range v {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if conn, ok := value.(map[string]any); ok && root {
+		if err := resolve(conn); err != nil {
+			return nil, err
+		}
+	}
+	if err := walk(value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// lookupFold returns the value of a key of m equal to name under case folding.
+func lookupFold(m map[string]any, name string) (any, bool) {
+	if value, ok := m[name]; ok {
+		return value, true
+	}
+	for key, value := range m {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// deleteFold deletes the keys of m equal to any of names under case folding.
+func deleteFold(m map[string]any, names ...string) {
+	for key := range m {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				delete(m, key)
+				break
+			}
+		}
+	}
+}
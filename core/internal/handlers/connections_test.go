@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+// handleServer echoes the params its probe method receives, after handle resolution.
+func handleServer(requireHandles bool, aliases map[string]ConnectionAlias) *rpc.Server {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Use(connectionHandleResolution(requireHandles, newWorkspaces("", aliases)))
+	server.Register("connection.open", connectionOpenHandler)
+	server.Register("connection.close", connectionCloseHandler)
+	server.Register("probe", func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		return params, nil
+	})
+	return server
+}
+
+// call sends one request on a connection served by server and returns the response line.
+type call func(method, params string) string
+
+func connectTo(t *testing.T, server *rpc.Server) call {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		_ = server.Serve(inR, outW)
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+	output := bufio.NewScanner(outR)
+	return func(method, params string) string {
+		t.Helper()
+		request := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":` + params + "}\n"
+		if _, err := io.WriteString(inW, request); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if !output.Scan() {
+			t.Fatalf("connection closed: %v", output.Err())
+		}
+		return output.Text()
+	}
+}
+
+func openHandle(t *testing.T, c call, driver, dsn string) string {
+	t.Helper()
+	line := c("connection.open", `{"driver":"`+driver+`","dsn":"`+dsn+`"}`)
+	var opened struct {
+		Result connectionOpenResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &opened); err != nil || !strings.HasPrefix(opened.Result.Handle, "conn_") {
+		t.Fatalf("expected a handle, got %s", line)
+	}
+	return opened.Result.Handle
+}
+
+func TestConnectionHandlesResolveWithinTheirSession(t *testing.T) {
+	server := handleServer(false, nil)
+	a, b := connectTo(t, server), connectTo(t, server)
+	handle := openHandle(t, a, "sqlite", "file:app.db")
+
+	line := a("probe", `{"connection":{"handle":"`+handle+`"},"sql":"select 1","sources":[{"connection":{"handle":"`+handle+`"}}]}`)
+	var probed struct {
+		Result struct {
+			Connection map[string]string `json:"connection"`
+			SQL        string            `json:"sql"`
+			Sources    []struct {
+				Connection map[string]string `json:"connection"`
+			} `json:"sources"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &probed); err != nil {
+		t.Fatalf("invalid response %s: %v", line, err)
+	}
+	for _, conn := range []map[string]string{probed.Result.Connection, probed.Result.Sources[0].Connection} {
+		if len(conn) != 2 || conn["driver"] != "sqlite" || conn["dsn"] != "file:app.db" {
+			t.Fatalf("expected the handle to resolve, got %s", line)
+		}
+	}
+	if probed.Result.SQL != "select 1" {
+		t.Fatalf("expected other params to be kept, got %s", line)
+	}
+
+	if got := b("probe", `{"connection":{"handle":"`+handle+`"}}`); !strings.Contains(got, errUnknownHandle.Error()) {
+		t.Fatalf("expected the handle to be unknown on another connection, got %s", got)
+	}
+	if got := a("connection.close", `{"handle":"`+handle+`"}`); !strings.Contains(got, `"closed":true`) {
+		t.Fatalf("expected the handle to close, got %s", got)
+	}
+	if got := a("probe", `{"connection":{"handle":"`+handle+`"}}`); !strings.Contains(got, errUnknownHandle.Error()) {
+		t.Fatalf("expected a closed handle to be unknown, got %s", got)
+	}
+}
+
+func TestRequiredConnectionHandlesRefuseDSNs(t *testing.T) {
+	c := connectTo(t, handleServer(true, nil))
+	handle := openHandle(t, c, "postgres", "postgres://app:s3cret@db/app")
+
+	if got := c("probe", `{"connection":{"driver":"postgres","dsn":"postgres://app:s3cret@db/app"}}`); !strings.Contains(got, `"code":-32602`) {
+		t.Fatalf("expected a raw DSN to be refused, got %s", got)
+	}
+	if got := c("probe", `{"connection":{"handle":"`+handle+`"}}`); !strings.Contains(got, "s3cret") {
+		t.Fatalf("expected the handle to be accepted, got %s", got)
+	}
+	// encoding/json decodes escaped and differently cased keys to the same fields.
+	for _, params := range []string{
+		`{"connection":{"driver":"postgres","\u0064sn":"postgres://app:s3cret@db/app"}}`,
+		`{"connection":{"driver":"postgres","DSN":"postgres://app:s3cret@db/app"}}`,
+		`{"Connection":{"driver":"postgres","dsn":"postgres://app:s3cret@db/app"}}`,
+		`{"\u0063onnection":{"Driver":"postgres","Dsn":"postgres://app:s3cret@db/app"}}`,
+	} {
+		if got := c("probe", params); !strings.Contains(got, errHandleRequired.Error()) {
+			t.Fatalf("expected %s to be refused, got %s", params, got)
+		}
+	}
+}
+
+func TestConnectionAliasesResolve(t *testing.T) {
+	dir := t.TempDir()
+	services := filepath.Join(dir, "pg_service.conf")
+	if err := os.WriteFile(services, []byte("[reporting]\nhost=db.internal\ndbname=reports\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	aliasFile := filepath.Join(dir, "aliases.json")
+	aliasJSON := `{"reports":{"driver":"postgres","dsn":"service=reporting servicefile=` + services + `"}}`
+	if err := os.WriteFile(aliasFile, []byte(aliasJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	aliases, err := LoadConnectionAliases(aliasFile)
+	if err != nil {
+		t.Fatalf("load aliases: %v", err)
+	}
+
+	c := connectTo(t, handleServer(true, aliases))
+	if got := c("probe", `{"connection":{"alias":"reports"}}`); !strings.Contains(got, `"dsn":"service=reporting`) || strings.Contains(got, `"alias"`) {
+		t.Fatalf("expected the alias to resolve, got %s", got)
+	}
+	if got := c("probe", `{"connection":{"alias":"missing"}}`); !strings.Contains(got, `"code":-32602`) {
+		t.Fatalf("expected an unknown alias to be refused, got %s", got)
+	}
+
+	c = connectTo(t, handleServer(false, nil))
+	if got := c("probe", `{"connection":{"driver":"postgres","dsn":"service=nope servicefile=`+services+`"}}`); !strings.Contains(got, `"code":-32602`) {
+		t.Fatalf("expected an unknown service to be refused, got %s", got)
+	}
+}
+
+func TestLoadConnectionAliasesRejectsUnknownDrivers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	if err := os.WriteFile(path, []byte(`{"x":{"driver":"oracle","dsn":"x"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConnectionAliases(path); err == nil {
+		t.Fatal("expected an unsupported driver to be refused")
+	}
+}
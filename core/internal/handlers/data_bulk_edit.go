@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+// defaultBulkConfirmThreshold is how many rows a bulk edit may change without the caller
+// confirming the count.
+const defaultBulkConfirmThreshold = 100
+
+type dataBulkEditParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	Table      string             `json:"table" jsonschema:"required"`
+	tablequery.BulkEdit
+	// Preview only counts the rows the edit would affect.
+	Preview bool `json:"preview"`
+	// ConfirmRows repeats the previewed count to apply an edit above the threshold.
+	ConfirmRows int64 `json:"confirmRows"`
+	Options     struct {
+		TimeoutSeconds   int     `json:"timeoutSeconds"`
+		ConfirmThreshold int     `json:"confirmThreshold"`
+		Retry            txRetry `json:"retry"`
+	} `json:"options"`
+}
+
+type dataBulkEditResult struct {
+	// Affected is the counted rows of a preview, or the rows changed once applied.
+	Affected             int64   `json:"affected"`
+	Applied              bool    `json:"applied"`
+	RequiresConfirmation bool    `json:"requiresConfirmation"`
+	SQL                  string  `json:"sql"`
+	ExecutionTimeMs      float64 `json:"executionTimeMs"`
+	// Retries lists the attempts aborted by a deadlock or serialization failure before
+	// the one that committed.
+	Retries []txRetryAttempt `json:"retries,omitempty"`
+}
+
+// dataBulkEditHandler updates or deletes the rows matching a filter. It counts them first;
+// above the confirmation threshold the caller must repeat that count in confirmRows, and
+// the transaction is rolled back if the statement changes more rows than were allowed.
+func dataBulkEditHandler(execute classicExecutor, runEdits statementRunner) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload dataBulkEditParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		stmt, count, err := tablequery.BuildBulkEdit(dialect, payload.Schema, payload.Table, payload.BulkEdit)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: "invalid bulk edit", Data: err.Error()}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		threshold := int64(payload.Options.ConfirmThreshold)
+		if threshold <= 0 {
+			threshold = defaultBulkConfirmThreshold
+		}
+
+		start := time.Now()
+		counted, rpcErr := runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, count.SQL, count.Args, 1)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		var matching int64
+		if len(counted.Rows) > 0 && len(counted.Rows[0]) > 0 {
+			n, _ := countValue(counted.Rows[0][0])
+			matching = int64(n)
+		}
+		result := dataBulkEditResult{
+			Affected:             matching,
+			RequiresConfirmation: matching > threshold,
+			SQL:                  stmt.SQL,
+		}
+		if payload.Preview {
+			result.ExecutionTimeMs = time.Since(start).Seconds() * 1000
+			return result, nil
+		}
+
+		allowed := threshold
+		if matching > threshold {
+			if payload.ConfirmRows != matching {
+				return nil, &rpc.Error{
+					Code:    -32163,
+					Message: fmt.Sprintf("%d rows would be affected; confirm the count to apply the edit", matching),
+					Data:    map[string]any{"affected": matching, "threshold": threshold},
+				}
+			}
+			allowed = payload.ConfirmRows
+		}
+		affected, retries, rpcErr := runEdits(ctx, payload.Connection, payload.Options.TimeoutSeconds, payload.Options.Retry, []tablequery.Statement{stmt},
+			func(_ int, affected int64) *rpc.Error {
+				if affected <= allowed {
+					return nil
+				}
+				return &rpc.Error{
+					Code:    -32163,
+					Message: fmt.Sprintf("the edit affected %d rows, more than the %d allowed; it was rolled back", affected, allowed),
+					Data:    map[string]any{"affected": affected, "threshold": allowed},
+				}
+			})
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		result.Affected = affected[0]
+		result.Applied = true
+		result.Retries = retries
+		result.ExecutionTimeMs = time.Since(start).Seconds() * 1000
+		return result, nil
+	}
+}
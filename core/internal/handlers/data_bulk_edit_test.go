@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+)
+
+func TestDataBulkEditRequiresConfirmationAboveThreshold(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE jobs (id INTEGER PRIMARY KEY, status TEXT)`,
+		`INSERT INTO jobs (status) VALUES ('stale'), ('stale'), ('stale'), ('done')`,
+	)
+	bulk := dataBulkEditHandler(executeClassic, runStatements)
+	call := func(extra string) (dataBulkEditResult, int) {
+		params := `{"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"jobs","op":"update",` +
+			`"filter":{"column":"status","op":"eq","value":"stale"},"values":{"status":"queued"},` +
+			`"options":{"confirmThreshold":2}` + extra + `}`
+		raw, rpcErr := bulk(context.Background(), json.RawMessage(params))
+		if rpcErr != nil {
+			return dataBulkEditResult{}, rpcErr.Code
+		}
+		return raw.(dataBulkEditResult), 0
+	}
+
+	preview, code := call(`,"preview":true`)
+	if code != 0 || preview.Affected != 3 || !preview.RequiresConfirmation || preview.Applied {
+		t.Fatalf("unexpected preview %+v (%d)", preview, code)
+	}
+	if _, code := call(""); code != -32163 {
+		t.Fatalf("expected an unconfirmed edit to be refused, got %d", code)
+	}
+	if _, code := call(`,"confirmRows":2`); code != -32163 {
+		t.Fatalf("expected a stale confirmation to be refused, got %d", code)
+	}
+	applied, code := call(`,"confirmRows":3`)
+	if code != 0 || applied.Affected != 3 || !applied.Applied {
+		t.Fatalf("unexpected result %+v (%d)", applied, code)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var queued int
+	if err := db.QueryRow(`SELECT count(*) FROM jobs WHERE status = 'queued'`).Scan(&queued); err != nil {
+		t.Fatal(err)
+	}
+	if queued != 3 {
+		t.Fatalf("%d rows were queued, want 3", queued)
+	}
+}
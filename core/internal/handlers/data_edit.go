@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+// statementRunner runs statements in one transaction, calling check with the rows each
+// one affected. The transaction is rolled back when a statement fails or check refuses.
+// Transactions the database aborts to resolve a deadlock or serialization conflict are
+// replayed according to retry, and the aborted attempts returned.
+type statementRunner func(
+	ctx context.Context,
+	conn dbConnectionParams,
+	timeoutSeconds int,
+	retry txRetry,
+	statements []tablequery.Statement,
+	check func(i int, affected int64) *rpc.Error,
+) ([]int64, []txRetryAttempt, *rpc.Error)
+
+func runStatements(
+	ctx context.Context,
+	conn dbConnectionParams,
+	timeoutSeconds int,
+	retry txRetry,
+	statements []tablequery.Statement,
+	check func(i int, affected int64) *rpc.Error,
+) ([]int64, []txRetryAttempt, *rpc.Error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+	return retryTransaction(timeoutCtx, retry, func() ([]int64, *rpc.Error, error) {
+		return runTransaction(ctx, timeoutCtx, conn, statements, check)
+	})
+}
+
+// runTransaction makes one attempt at running statements in a transaction. Besides the
+// error to report it returns the driver error behind it, if any, for retryTransaction.
+func runTransaction(
+	ctx, timeoutCtx context.Context,
+	conn dbConnectionParams,
+	statements []tablequery.Statement,
+	check func(i int, affected int64) *rpc.Error,
+) ([]int64, *rpc.Error, error) {
+	connectErr := func(err error) *rpc.Error {
+		return &rpc.Error{Code: -32010, Message: "failed to connect to database", Data: err.Error()}
+	}
+	execErr := func(err error) *rpc.Error {
+		return &rpc.Error{Code: -32011, Message: "query execution failed", Data: err.Error()}
+	}
+	affected := make([]int64, 0, len(statements))
+
+	switch conn.Driver {
+	case "postgres":
+		pg, _, err := connectPostgres(timeoutCtx, conn.DSN)
+		if err != nil {
+			return nil, connectErr(err), err
+		}
+		defer pg.Close(context.Background())
+		tx, err := pg.Begin(timeoutCtx)
+		if err != nil {
+			return nil, execErr(err), err
+		}
+		defer tx.Rollback(context.Background())
+		for i, stmt := range statements {
+			tag, err := tx.Exec(timeoutCtx, tagSQL(ctx, stmt.SQL), stmt.Args...)
+			if err != nil {
+				return nil, execErr(err), err
+			}
+			if rpcErr := check(i, tag.RowsAffected()); rpcErr != nil {
+				return nil, rpcErr, nil
+			}
+			affected = append(affected, tag.RowsAffected())
+		}
+		if err := tx.Commit(timeoutCtx); err != nil {
+			return nil, execErr(err), err
+		}
+	case "mysql", "sqlite":
+		dsn := conn.DSN
+		if conn.Driver == "mysql" {
+			dsn = mysqlFoundRowsDSN(dsn)
+		}
+		db, err := defaultSQLOpener(conn.Driver)(timeoutCtx, dsn)
+		if err != nil {
+			return nil, connectErr(err), err
+		}
+		defer db.Close()
+		tx, err := db.BeginTx(timeoutCtx, nil)
+		if err != nil {
+			return nil, connectErr(err), err
+		}
+		defer tx.Rollback()
+		for i, stmt := range statements {
+			var result sql.Result
+			if result, err = tx.ExecContext(timeoutCtx, tagSQL(ctx, stmt.SQL), stmt.Args...); err != nil {
+				return nil, execErr(err), err
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return nil, execErr(err), err
+			}
+			if rpcErr := check(i, n); rpcErr != nil {
+				return nil, rpcErr, nil
+			}
+			affected = append(affected, n)
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, execErr(err), err
+		}
+	default:
+		return nil, &rpc.Error{Code: -32601, Message: fmt.Sprintf("driver not supported: %s", conn.Driver)}, nil
+	}
+	return affected, nil, nil
+}
+
+// mysqlFoundRowsDSN makes MySQL count the rows an UPDATE matched rather than those it
+// changed, as the other drivers do. Otherwise an edit writing the values a row already
+// holds would affect no row and be taken for a conflict. The parameter is appended rather
+// than the DSN reformatted, which would merge the addresses of a failover DSN into one.
+func mysqlFoundRowsDSN(dsn string) string {
+	if strings.Contains(dsn[strings.LastIndex(dsn, "/")+1:], "?") {
+		return dsn + "&clientFoundRows=true"
+	}
+	return dsn + "?clientFoundRows=true"
+}
+
+// detectRowIdentity works out how rows of a table are identified for editing.
+func detectRowIdentity(
+	dialect tablequery.Dialect,
+	run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error),
+	schema, table string,
+) (tablequery.RowIdentity, *rpc.Error) {
+	unique, rpcErr := run(tablequery.UniqueKeysSQL(dialect, schema, table), nil, maxForeignKeyRows)
+	if rpcErr != nil {
+		return tablequery.RowIdentity{}, rpcErr
+	}
+	pseudo := false
+	if sql := tablequery.PseudoIdentitySQL(dialect, schema, table); sql != "" {
+		result, rpcErr := run(sql, nil, 1)
+		if rpcErr != nil {
+			return tablequery.RowIdentity{}, rpcErr
+		}
+		pseudo = tablequery.ParsePseudoIdentity(result.Rows)
+	}
+	return tablequery.ChooseIdentity(dialect, unique.Rows, pseudo), nil
+}
+
+type tableIdentityParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	Table      string             `json:"table" jsonschema:"required"`
+	Options    struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type tableIdentityResult struct {
+	tablequery.RowIdentity
+	Editable bool `json:"editable"`
+}
+
+func tableIdentityHandler(execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload tableIdentityParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+		identity, rpcErr := detectRowIdentity(dialect, run, payload.Schema, payload.Table)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return tableIdentityResult{RowIdentity: identity, Editable: identity.Editable()}, nil
+	}
+}
+
+type dataApplyEditsParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	Table      string             `json:"table" jsonschema:"required"`
+	Edits      []tablequery.Edit  `json:"edits" jsonschema:"required"`
+	Options    struct {
+		TimeoutSeconds int     `json:"timeoutSeconds"`
+		Retry          txRetry `json:"retry"`
+	} `json:"options"`
+}
+
+type dataApplyEditsResult struct {
+	Identity tablequery.RowIdentity `json:"identity"`
+	// Applied counts the edits, all of which were committed in one transaction.
+	Applied         int     `json:"applied"`
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+	// Retries lists the attempts aborted by a deadlock or serialization failure before
+	// the one that committed.
+	Retries []txRetryAttempt `json:"retries,omitempty"`
+}
+
+// dataApplyEditsHandler applies grid edits in one transaction. Every edit must change
+// exactly one row, found by the table's row identity; tables without a safe identity are
+// refused. Edits carrying the values originally read only apply while the row still holds
+// them, and otherwise fail with the row as it is now.
+func dataApplyEditsHandler(execute classicExecutor, runEdits statementRunner) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload dataApplyEditsParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if len(payload.Edits) == 0 {
+			return nil, &rpc.Error{Code: -32602, Message: "edits must not be empty"}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+
+		start := time.Now()
+		identity, rpcErr := detectRowIdentity(dialect, run, payload.Schema, payload.Table)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if !identity.Editable() {
+			return nil, &rpc.Error{
+				Code:    -32160,
+				Message: "rows of this table cannot be identified safely, so it cannot be edited",
+				Data:    identity,
+			}
+		}
+
+		statements := make([]tablequery.Statement, len(payload.Edits))
+		for i, edit := range payload.Edits {
+			if statements[i], err = tablequery.BuildEdit(dialect, payload.Schema, payload.Table, identity, edit); err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: fmt.Sprintf("invalid edit %d", i),
+					Data:    err.Error(),
+				}
+			}
+		}
+		conflict := -1
+		_, retries, rpcErr := runEdits(ctx, payload.Connection, payload.Options.TimeoutSeconds, payload.Options.Retry, statements,
+			func(i int, affected int64) *rpc.Error {
+				if affected == 1 {
+					return nil
+				}
+				if affected == 0 && len(payload.Edits[i].Original) > 0 {
+					conflict = i
+					return &rpc.Error{Code: -32162}
+				}
+				return &rpc.Error{
+					Code:    -32161,
+					Message: fmt.Sprintf("edit %d matched %d rows instead of one; no edits were applied", i, affected),
+					Data:    map[string]any{"edit": i, "affected": affected},
+				}
+			})
+		if rpcErr != nil && conflict >= 0 {
+			return nil, editConflict(dialect, run, payload.Schema, payload.Table, identity, conflict, payload.Edits[conflict])
+		}
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return dataApplyEditsResult{
+			Identity:        identity,
+			Applied:         len(statements),
+			ExecutionTimeMs: time.Since(start).Seconds() * 1000,
+			Retries:         retries,
+		}, nil
+	}
+}
+
+// editConflict reports that edit i found its row changed since it was read, with the row
+// as it now is, or without one when the row was deleted.
+func editConflict(
+	dialect tablequery.Dialect,
+	run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error),
+	schema, table string,
+	identity tablequery.RowIdentity,
+	i int,
+	edit tablequery.Edit,
+) *rpc.Error {
+	data := map[string]any{"edit": i, "deleted": true}
+	lookup, err := tablequery.BuildLookup(dialect, schema, table, identity, edit.Key)
+	if err != nil {
+		return &rpc.Error{Code: -32602, Message: fmt.Sprintf("invalid edit %d", i), Data: err.Error()}
+	}
+	current, rpcErr := run(lookup.SQL, lookup.Args, 1)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	message := fmt.Sprintf("the row of edit %d was deleted by someone else; no edits were applied", i)
+	if len(current.Rows) > 0 {
+		message = fmt.Sprintf("the row of edit %d was changed by someone else; no edits were applied", i)
+		data["deleted"] = false
+		data["columns"] = columnNames(current)
+		data["row"] = current.Rows[0]
+	}
+	return &rpc.Error{Code: -32162, Message: "CONFLICT: " + message, Data: data}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestTableIdentityFallsBackFromPrimaryKey(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE with_pk (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE with_unique (code TEXT NOT NULL UNIQUE, other TEXT UNIQUE)`,
+		`CREATE TABLE bare (name TEXT)`,
+	)
+	want := map[string]string{
+		"with_pk":     tablequery.IdentityPrimaryKey,
+		"with_unique": tablequery.IdentityUniqueIndex,
+		"bare":        tablequery.IdentityRowID,
+	}
+	for table, strategy := range want {
+		params := `{"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"` + table + `"}`
+		raw, rpcErr := tableIdentityHandler(executeClassic)(context.Background(), json.RawMessage(params))
+		if rpcErr != nil {
+			t.Fatalf("%s: %+v", table, rpcErr)
+		}
+		if got := raw.(tableIdentityResult); got.Strategy != strategy || !got.Editable {
+			t.Errorf("%s: got %+v, want %s", table, got, strategy)
+		}
+	}
+}
+
+func TestDataApplyEditsIsAllOrNothing(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE items (name TEXT, qty INTEGER)`,
+		`INSERT INTO items VALUES ('a', 1), ('b', 2), ('c', 3)`,
+	)
+	conn := `"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"items"`
+
+	// The table has no key, so rows are read and edited by rowid.
+	raw, rpcErr := tablePeekHandler(executeClassic)(context.Background(), json.RawMessage(`{`+conn+`,"rowIdentity":true,"sort":[{"column":"name"}]}`))
+	if rpcErr != nil {
+		t.Fatalf("table.peek: %+v", rpcErr)
+	}
+	peek := raw.(tablePeekResult)
+	if peek.Identity == nil || peek.Identity.Strategy != tablequery.IdentityRowID || peek.Columns[2].Name != tablequery.RowIDColumn {
+		t.Fatalf("unexpected peek %+v", peek)
+	}
+	rowid := func(i int) string {
+		b, _ := json.Marshal(peek.Rows[i][2])
+		return string(b)
+	}
+
+	apply := dataApplyEditsHandler(executeClassic, runStatements)
+	edits := `{` + conn + `,"edits":[` +
+		`{"op":"update","key":{"__rowid":` + rowid(0) + `},"values":{"qty":10}},` +
+		`{"op":"delete","key":{"__rowid":999}}]}`
+	if _, rpcErr := apply(context.Background(), json.RawMessage(edits)); rpcErr == nil || rpcErr.Code != -32161 {
+		t.Fatalf("expected a missing row to be refused, got %+v", rpcErr)
+	}
+
+	edits = `{` + conn + `,"edits":[` +
+		`{"op":"update","key":{"__rowid":` + rowid(0) + `},"values":{"qty":10}},` +
+		`{"op":"delete","key":{"__rowid":` + rowid(1) + `}}]}`
+	raw, rpcErr = apply(context.Background(), json.RawMessage(edits))
+	if rpcErr != nil {
+		t.Fatalf("data.applyEdits: %+v", rpcErr)
+	}
+	if got := raw.(dataApplyEditsResult); got.Applied != 2 {
+		t.Fatalf("unexpected result %+v", got)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var total, count int
+	if err := db.QueryRow(`SELECT sum(qty), count(*) FROM items`).Scan(&total, &count); err != nil {
+		t.Fatal(err)
+	}
+	if total != 13 || count != 2 {
+		t.Fatalf("table holds %d rows totalling %d; only the second attempt should have applied", count, total)
+	}
+}
+
+func TestDataApplyEditsRefusesTablesWithoutIdentity(t *testing.T) {
+	execute := func(context.Context, executeParams) (any, *rpc.Error) {
+		return executeResult{}, nil
+	}
+	run := func(context.Context, dbConnectionParams, int, txRetry, []tablequery.Statement, func(int, int64) *rpc.Error) ([]int64, []txRetryAttempt, *rpc.Error) {
+		t.Fatal("no statement should run")
+		return nil, nil, nil
+	}
+	params := `{"connection":{"driver":"mysql","dsn":"x"},"table":"t","edits":[{"op":"delete","key":{"id":1}}]}`
+	if _, rpcErr := dataApplyEditsHandler(execute, run)(context.Background(), json.RawMessage(params)); rpcErr == nil || rpcErr.Code != -32160 {
+		t.Fatalf("expected -32160, got %+v", rpcErr)
+	}
+}
+
+func TestDataApplyEditsReportsConflicts(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, note TEXT)`,
+		`INSERT INTO items VALUES (1, 'a', NULL), (2, 'b', 'x')`,
+	)
+	conn := `"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"items"`
+	apply := dataApplyEditsHandler(executeClassic, runStatements)
+
+	// NULL originals compare equal, so an unchanged row is updated.
+	edits := `{` + conn + `,"edits":[{"op":"update","key":{"id":1},"values":{"name":"a2"},"original":{"name":"a","note":null}}]}`
+	if _, rpcErr := apply(context.Background(), json.RawMessage(edits)); rpcErr != nil {
+		t.Fatalf("data.applyEdits: %+v", rpcErr)
+	}
+
+	// The same edit again finds the row changed and reports it as it now is.
+	_, rpcErr := apply(context.Background(), json.RawMessage(edits))
+	if rpcErr == nil || rpcErr.Code != -32162 {
+		t.Fatalf("expected -32162, got %+v", rpcErr)
+	}
+	data := rpcErr.Data.(map[string]any)
+	if data["deleted"] != false || data["row"].([]any)[1] != "a2" {
+		t.Fatalf("unexpected conflict %+v", data)
+	}
+
+	edits = `{` + conn + `,"edits":[{"op":"delete","key":{"id":3},"original":{"name":"c"}}]}`
+	if _, rpcErr = apply(context.Background(), json.RawMessage(edits)); rpcErr == nil || rpcErr.Code != -32162 || rpcErr.Data.(map[string]any)["deleted"] != true {
+		t.Fatalf("expected a deleted conflict, got %+v", rpcErr)
+	}
+}
+
+func TestMySQLEditsCountMatchedRows(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"u:p@tcp(a:3306)/db":                       "u:p@tcp(a:3306)/db?clientFoundRows=true",
+		"u:p?x@tcp(a:3306,b:3306)/db":              "u:p?x@tcp(a:3306,b:3306)/db?clientFoundRows=true",
+		"u:p@tcp(a:3306)/db?clientFoundRows=false": "u:p@tcp(a:3306)/db?clientFoundRows=false&clientFoundRows=true",
+	} {
+		got := mysqlFoundRowsDSN(dsn)
+		if got != want {
+			t.Fatalf("mysqlFoundRowsDSN(%q) = %q, want %q", dsn, got, want)
+		}
+		if cfg, err := mysql.ParseDSN(got); err != nil || !cfg.ClientFoundRows {
+			t.Fatalf("%s: clientFoundRows not set: %v", got, err)
+		}
+	}
+}
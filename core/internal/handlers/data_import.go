@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fluxgrid/core/internal/dataimport"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+type dataImportParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	Table      string             `json:"table" jsonschema:"required"`
+	// Format is csv, or json for an array of objects.
+	Format string `json:"format" jsonschema:"required,enum=csv|json"`
+	// Data is the pasted text.
+	Data string `json:"data" jsonschema:"required"`
+	// Create creates the table with a column per CSV header or JSON key, typed after the
+	// values they hold. Without it the rows are added to an existing table.
+	Create  bool `json:"create"`
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+		// NoHeader reads the first CSV record as data.
+		NoHeader bool `json:"noHeader"`
+		// Delimiter separates CSV fields; it defaults to a comma.
+		Delimiter string `json:"delimiter"`
+	} `json:"options"`
+}
+
+type dataImportColumn struct {
+	Name string `json:"name"`
+	// Kind is boolean, integer, real or text.
+	Kind string `json:"kind"`
+}
+
+type dataImportResult struct {
+	Columns         []dataImportColumn `json:"columns"`
+	Rows            int                `json:"rows"`
+	Created         bool               `json:"created"`
+	ExecutionTimeMs float64            `json:"executionTimeMs"`
+}
+
+// dataImportHandler adds pasted CSV or JSON rows to a table in one transaction, creating
+// the table when asked.
+func dataImportHandler(runStatements statementRunner) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload dataImportParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		table, err := dataimport.Parse(payload.Format, []byte(payload.Data), dataimport.Options{
+			NoHeader:  payload.Options.NoHeader,
+			Delimiter: payload.Options.Delimiter,
+		})
+		if err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: "invalid import data", Data: err.Error()}
+		}
+		statements, err := tablequery.BuildImport(dialect, payload.Schema, payload.Table, tablequery.Import{
+			Columns: table.Columns,
+			Kinds:   table.Kinds,
+			Rows:    table.Rows,
+			Create:  payload.Create,
+		})
+		if err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: "invalid import", Data: err.Error()}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+
+		start := time.Now()
+		_, _, rpcErr := runStatements(ctx, payload.Connection, payload.Options.TimeoutSeconds, txRetry{}, statements,
+			func(int, int64) *rpc.Error { return nil })
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		result := dataImportResult{
+			Columns:         make([]dataImportColumn, len(table.Columns)),
+			Rows:            len(table.Rows),
+			Created:         payload.Create,
+			ExecutionTimeMs: time.Since(start).Seconds() * 1000,
+		}
+		for i, column := range table.Columns {
+			result.Columns[i] = dataImportColumn{Name: column, Kind: table.Kinds[i]}
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+const (
+	defaultRelatedRows = 20
+	maxRelatedRows     = 1000
+	// maxForeignKeyRows bounds the catalog query listing foreign key columns.
+	maxForeignKeyRows = 10000
+)
+
+// Relation directions.
+const (
+	relatedParent = "parent"
+	relatedChild  = "child"
+)
+
+type dataRelatedParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	Table      string             `json:"table" jsonschema:"required"`
+	// Key identifies the row by its primary key columns.
+	Key map[string]any `json:"key" jsonschema:"required"`
+	// Relation and Direction restrict the response, to page through one relation.
+	Relation  string `json:"relation"`
+	Direction string `json:"direction" jsonschema:"enum=parent|child"`
+	Limit     int    `json:"limit"`
+	Offset    int    `json:"offset"`
+	Options   struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type relatedRows struct {
+	// Relation is the foreign key constraint's name.
+	Relation string `json:"relation"`
+	// Direction is parent for the row the given row references and child for the rows
+	// that reference it.
+	Direction string `json:"direction"`
+	Schema    string `json:"schema,omitempty"`
+	Table     string `json:"table"`
+	// KeyColumns are the columns of the related table the relation joins on.
+	KeyColumns []string `json:"keyColumns"`
+	Count      int      `json:"count"`
+	Offset     int      `json:"offset"`
+	HasMore    bool     `json:"hasMore"`
+	Columns    []column `json:"columns"`
+	Rows       [][]any  `json:"rows"`
+}
+
+type dataRelatedResult struct {
+	Relations       []relatedRows `json:"relations"`
+	ExecutionTimeMs float64       `json:"executionTimeMs"`
+}
+
+// dataRelatedHandler follows the foreign keys of a table from one row, to the row it
+// references and to the rows that reference it.
+func dataRelatedHandler(execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload dataRelatedParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if payload.Table == "" || len(payload.Key) == 0 {
+			return nil, &rpc.Error{Code: -32602, Message: "table and key are required"}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		if payload.Limit <= 0 {
+			payload.Limit = defaultRelatedRows
+		}
+		payload.Limit = min(payload.Limit, maxRelatedRows)
+		payload.Offset = max(payload.Offset, 0)
+
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+		invalid := func(err error) *rpc.Error {
+			return &rpc.Error{Code: -32602, Message: "invalid related request", Data: err.Error()}
+		}
+		primaryKeys := map[string][]string{}
+		primaryKey := func(schema, table string) []string {
+			id := schema + "." + table
+			if keys, ok := primaryKeys[id]; ok {
+				return keys
+			}
+			// Tables without a primary key are paged without an order.
+			result, rpcErr := run(tablequery.PrimaryKeySQL(dialect, schema, table), nil, maxKeyColumns)
+			if rpcErr == nil {
+				primaryKeys[id] = columnNames(result)
+			}
+			return primaryKeys[id]
+		}
+
+		start := time.Now()
+		fkRows, rpcErr := run(tablequery.ForeignKeysSQL(dialect, payload.Schema, payload.Table), nil, maxForeignKeyRows)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		foreignKeys, err := tablequery.ParseForeignKeys(fkRows.Rows)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32603, Message: "failed to read foreign keys", Data: err.Error()}
+		}
+
+		keyColumns := make([]string, 0, len(payload.Key))
+		for name := range payload.Key {
+			keyColumns = append(keyColumns, name)
+		}
+		sort.Strings(keyColumns)
+		keyValues := make([]any, len(keyColumns))
+		for i, name := range keyColumns {
+			keyValues[i] = payload.Key[name]
+		}
+		keyFilter, ok := tablequery.KeyFilter(keyColumns, keyValues)
+		if !ok {
+			return nil, &rpc.Error{Code: -32602, Message: "key values must not be null"}
+		}
+		sql, args, err := tablequery.Build(dialect, tablequery.Request{
+			Schema: payload.Schema, Table: payload.Table, Filter: &keyFilter, Limit: 1,
+		}, nil)
+		if err != nil {
+			return nil, invalid(err)
+		}
+		found, rpcErr := run(sql, args, 1)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if len(found.Rows) == 0 {
+			return nil, &rpc.Error{Code: -32602, Message: "row not found"}
+		}
+		row := toResultSet(found)
+		valuesOf := func(columns []string) []any {
+			values := make([]any, len(columns))
+			for i, name := range columns {
+				if idx := row.ColumnIndex(name); idx >= 0 {
+					values[i] = row.Rows[0][idx]
+				}
+			}
+			return values
+		}
+
+		relations := []relatedRows{}
+		for _, fk := range foreignKeys {
+			var candidates []relatedRows
+			var values [][]any
+			if fk.DeclaredOn(dialect, payload.Schema, payload.Table) {
+				refColumns := fk.RefColumns
+				if refColumns[0] == "" {
+					refColumns = primaryKey(fk.RefSchema, fk.RefTable)
+				}
+				candidates = append(candidates, relatedRows{
+					Relation: fk.Name, Direction: relatedParent, Schema: fk.RefSchema, Table: fk.RefTable, KeyColumns: refColumns,
+				})
+				values = append(values, valuesOf(fk.Columns))
+			}
+			if fk.References(dialect, payload.Schema, payload.Table) {
+				refColumns := fk.RefColumns
+				if refColumns[0] == "" {
+					refColumns = primaryKey(payload.Schema, payload.Table)
+				}
+				candidates = append(candidates, relatedRows{
+					Relation: fk.Name, Direction: relatedChild, Schema: fk.Schema, Table: fk.Table, KeyColumns: fk.Columns,
+				})
+				values = append(values, valuesOf(refColumns))
+			}
+
+			for i, rel := range candidates {
+				if payload.Relation != "" && rel.Relation != payload.Relation ||
+					payload.Direction != "" && rel.Direction != payload.Direction {
+					continue
+				}
+				rel.Offset = payload.Offset
+				rel.Columns, rel.Rows = []column{}, [][]any{}
+				filter, ok := tablequery.KeyFilter(rel.KeyColumns, values[i])
+				if !ok || len(rel.KeyColumns) != len(values[i]) {
+					// A NULL foreign key references nothing.
+					relations = append(relations, rel)
+					continue
+				}
+				if rpcErr := fetchRelated(dialect, run, &rel, filter, primaryKey(rel.Schema, rel.Table), payload.Limit); rpcErr != nil {
+					return nil, rpcErr
+				}
+				relations = append(relations, rel)
+			}
+		}
+
+		return dataRelatedResult{
+			Relations:       relations,
+			ExecutionTimeMs: time.Since(start).Seconds() * 1000,
+		}, nil
+	}
+}
+
+// fetchRelated reads a page of a relation's rows, and counts them when the page does not
+// show them all.
+func fetchRelated(
+	dialect tablequery.Dialect,
+	run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error),
+	rel *relatedRows,
+	filter resultset.Filter,
+	order []string,
+	limit int,
+) *rpc.Error {
+	sortKeys := make([]resultset.SortKey, len(order))
+	for i, name := range order {
+		sortKeys[i] = resultset.SortKey{Column: name}
+	}
+	request := tablequery.Request{
+		Schema: rel.Schema, Table: rel.Table, Filter: &filter, Sort: sortKeys,
+		Limit: limit + 1, Offset: rel.Offset,
+	}
+	sql, args, err := tablequery.Build(dialect, request, nil)
+	if err != nil {
+		return &rpc.Error{Code: -32602, Message: "invalid related request", Data: err.Error()}
+	}
+	result, rpcErr := run(sql, args, request.Limit)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	rel.Columns, rel.Rows = result.Columns, result.Rows
+	rel.HasMore = len(rel.Rows) > limit
+	if rel.HasMore {
+		rel.Rows = rel.Rows[:limit]
+	}
+	rel.Count = rel.Offset + len(rel.Rows)
+	if !rel.HasMore && (rel.Offset == 0 || len(rel.Rows) > 0) {
+		return nil
+	}
+
+	sql, args, err = tablequery.BuildCount(dialect, request)
+	if err != nil {
+		return &rpc.Error{Code: -32602, Message: "invalid related request", Data: err.Error()}
+	}
+	count, rpcErr := run(sql, args, 1)
+	if rpcErr != nil {
+		return rpcErr
+	}
+	if len(count.Rows) == 1 {
+		if n, ok := countValue(count.Rows[0][0]); ok {
+			rel.Count = n
+		}
+	}
+	return nil
+}
+
+func countValue(value any) (int, bool) {
+	switch v := value.(type) {
+	case int64:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		var n int
+		if err := json.Unmarshal([]byte(v), &n); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
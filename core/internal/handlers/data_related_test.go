@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDataRelatedFollowsForeignKeys(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE customers (id INTEGER PRIMARY KEY, name TEXT)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers, total REAL)`,
+		`CREATE TABLE notes (id INTEGER PRIMARY KEY, order_id INTEGER REFERENCES orders(id))`,
+		`INSERT INTO customers VALUES (1, 'Ann'), (2, 'Bo')`,
+		`INSERT INTO orders VALUES (10, 1, 5), (11, 1, 7), (12, 1, 9), (13, 2, 1), (14, NULL, 3)`,
+		`INSERT INTO notes VALUES (100, 11)`,
+	)
+	call := func(params string) dataRelatedResult {
+		t.Helper()
+		raw, rpcErr := dataRelatedHandler(executeClassic)(context.Background(), json.RawMessage(params))
+		if rpcErr != nil {
+			t.Fatalf("data.related: %+v", rpcErr)
+		}
+		return raw.(dataRelatedResult)
+	}
+	conn := `"connection":{"driver":"sqlite","dsn":"` + dsn + `"}`
+
+	orders := call(`{` + conn + `,"table":"orders","key":{"id":11}}`)
+	if len(orders.Relations) != 2 {
+		t.Fatalf("relations = %+v", orders.Relations)
+	}
+	for _, rel := range orders.Relations {
+		switch rel.Direction {
+		case relatedParent:
+			if rel.Table != "customers" || rel.Count != 1 || rel.Rows[0][1] != "Ann" || rel.KeyColumns[0] != "id" {
+				t.Errorf("unexpected parent %+v", rel)
+			}
+		case relatedChild:
+			if rel.Table != "notes" || rel.Count != 1 || rel.Rows[0][0] != int64(100) {
+				t.Errorf("unexpected child %+v", rel)
+			}
+		}
+	}
+
+	customer := call(`{` + conn + `,"table":"customers","key":{"id":1},"limit":2}`)
+	if len(customer.Relations) != 1 {
+		t.Fatalf("relations = %+v", customer.Relations)
+	}
+	children := customer.Relations[0]
+	if children.Direction != relatedChild || children.Count != 3 || !children.HasMore || len(children.Rows) != 2 || children.Rows[0][0] != int64(10) {
+		t.Fatalf("unexpected first page %+v", children)
+	}
+	next := call(`{` + conn + `,"table":"customers","key":{"id":1},"relation":"` + children.Relation + `","direction":"child","limit":2,"offset":2}`)
+	if len(next.Relations) != 1 || next.Relations[0].Count != 3 || next.Relations[0].HasMore || next.Relations[0].Rows[0][0] != int64(12) {
+		t.Fatalf("unexpected second page %+v", next.Relations)
+	}
+
+	orphan := call(`{` + conn + `,"table":"orders","key":{"id":14},"direction":"parent"}`)
+	for _, rel := range orphan.Relations {
+		if rel.Direction == relatedParent && (rel.Count != 0 || len(rel.Rows) != 0) {
+			t.Errorf("a NULL foreign key should reference nothing, got %+v", rel)
+		}
+	}
+
+	if _, rpcErr := dataRelatedHandler(executeClassic)(context.Background(), json.RawMessage(`{`+conn+`,"table":"orders","key":{"id":99}}`)); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected a missing row to be refused, got %+v", rpcErr)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/datagen"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const (
+	maxGeneratedRows = 100000
+	previewRowLimit  = 20
+)
+
+type dataConnectionFactory func(ctx context.Context, dsn string) (datagen.Conn, func(), error)
+
+var defaultDataGenService = datagen.NewPostgresService()
+
+type dataGenerateParams struct {
+	Connection dbConnectionParams `json:"connection"`
+	Target     struct {
+		Schema string `json:"schema"`
+		Name   string `json:"name"`
+	} `json:"target"`
+	Options struct {
+		Rows            int      `json:"rows"`
+		Seed            *int64   `json:"seed"`
+		BatchSize       int      `json:"batchSize"`
+		NullProbability *float64 `json:"nullProbability"`
+		DryRun          bool     `json:"dryRun"`
+		TimeoutSeconds  int      `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type dataGenerateResult struct {
+	Seed            int64           `json:"seed"`
+	Inserted        int64           `json:"inserted"`
+	Columns         []column        `json:"columns"`
+	Preview         [][]interface{} `json:"preview"`
+	DryRun          bool            `json:"dryRun"`
+	ExecutionTimeMs float64         `json:"executionTimeMs"`
+}
+
+func dataGenerateHandler(service datagen.Service, factory dataConnectionFactory) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload dataGenerateParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		if payload.Connection.Driver != "postgres" {
+			return nil, &rpc.Error{
+				Code:    -32601,
+				Message: fmt.Sprintf("driver not supported: %s", payload.Connection.Driver),
+			}
+		}
+
+		if payload.Connection.DSN == "" {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "DSN is required",
+			}
+		}
+
+		if payload.Target.Schema == "" || payload.Target.Name == "" {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "target schema and name are required",
+			}
+		}
+
+		if payload.Options.Rows <= 0 || payload.Options.Rows > maxGeneratedRows {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("rows must be between 1 and %d", maxGeneratedRows),
+			}
+		}
+
+		seed := time.Now().UnixNano()
+		if payload.Options.Seed != nil {
+			seed = *payload.Options.Seed
+		}
+		nullProbability := 0.1
+		if payload.Options.NullProbability != nil {
+			nullProbability = *payload.Options.NullProbability
+		}
+
+		timeout := payload.Options.TimeoutSeconds
+		if timeout <= 0 {
+			timeout = 60
+		}
+
+		timeoutCtx, cancelTimeout := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancelTimeout()
+
+		start := time.Now()
+
+		conn, cleanup, err := factory(timeoutCtx, payload.Connection.DSN)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32010,
+				Message: "failed to connect to database",
+				Data:    err.Error(),
+			}
+		}
+		defer cleanup()
+
+		table := datagen.TableRef{Schema: payload.Target.Schema, Name: payload.Target.Name}
+		specs, err := service.Columns(timeoutCtx, conn, table)
+		if err != nil {
+			if errors.Is(err, datagen.ErrTableNotFound) {
+				return nil, &rpc.Error{
+					Code:    -32044,
+					Message: "object not found",
+				}
+			}
+			return nil, &rpc.Error{
+				Code:    -32050,
+				Message: "failed to inspect target table",
+				Data:    err.Error(),
+			}
+		}
+
+		insertable := datagen.Insertable(specs)
+		if len(insertable) == 0 {
+			return nil, &rpc.Error{
+				Code:    -32051,
+				Message: "target table has no columns that accept generated values",
+			}
+		}
+
+		generator := datagen.NewGenerator(seed, nullProbability)
+		rows, err := generator.Rows(insertable, payload.Options.Rows)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32051,
+				Message: "failed to generate rows",
+				Data:    err.Error(),
+			}
+		}
+
+		var inserted int64
+		if !payload.Options.DryRun {
+			inserted, err = service.Insert(timeoutCtx, conn, datagen.InsertRequest{
+				Table:     table,
+				Columns:   insertable,
+				Rows:      rows,
+				BatchSize: payload.Options.BatchSize,
+			})
+			if err != nil {
+				return nil, &rpc.Error{
+					Code:    -32052,
+					Message: "failed to insert generated rows",
+					Data:    err.Error(),
+				}
+			}
+		}
+
+		columns := make([]column, len(insertable))
+		for i, spec := range insertable {
+			columns[i] = column{Name: spec.Name, DataType: spec.DataType}
+		}
+
+		previewCount := len(rows)
+		if previewCount > previewRowLimit {
+			previewCount = previewRowLimit
+		}
+		preview := make([][]interface{}, previewCount)
+		for i := range preview {
+			row := make([]interface{}, len(rows[i]))
+			for j, value := range rows[i] {
+				row[j] = normalizeValue(value)
+			}
+			preview[i] = row
+		}
+
+		duration := time.Since(start).Seconds() * 1000
+
+		logger := logging.Logger()
+		logger.Info().
+			Str("driver", payload.Connection.Driver).
+			Int64("inserted", inserted).
+			Bool("dry_run", payload.Options.DryRun).
+			Float64("duration_ms", duration).
+			Msg("data.generate completed")
+
+		return dataGenerateResult{
+			Seed:            seed,
+			Inserted:        inserted,
+			Columns:         columns,
+			Preview:         preview,
+			DryRun:          payload.Options.DryRun,
+			ExecutionTimeMs: duration,
+		}, nil
+	}
+}
+
+func pgxDataConnectionFactory(ctx context.Context, dsn string) (datagen.Conn, func(), error) {
+	conn, _, err := connectPostgres(ctx, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		if cerr := conn.Close(context.Background()); cerr != nil {
+			logger := logging.Logger()
+			logger.Warn().Err(cerr).Msg("failed to close data connection")
+		}
+	}
+	return conn, cleanup, nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/datagen"
+)
+
+type stubDataGenService struct {
+	columns    []datagen.ColumnSpec
+	err        error
+	insertErr  error
+	lastInsert datagen.InsertRequest
+	inserts    int
+}
+
+func (s *stubDataGenService) Columns(context.Context, datagen.Conn, datagen.TableRef) ([]datagen.ColumnSpec, error) {
+	return s.columns, s.err
+}
+
+func (s *stubDataGenService) Insert(_ context.Context, _ datagen.Conn, req datagen.InsertRequest) (int64, error) {
+	s.inserts++
+	s.lastInsert = req
+	return int64(len(req.Rows)), s.insertErr
+}
+
+func stubDataConnectionFactory(context.Context, string) (datagen.Conn, func(), error) {
+	return nil, func() {}, nil
+}
+
+func TestDataGenerateHandlerSuccess(t *testing.T) {
+	svc := &stubDataGenService{
+		columns: []datagen.ColumnSpec{
+			{Name: "id", DataType: "integer", BaseType: "int4", NotNull: true, HasDefault: true},
+			{Name: "email", DataType: "text", BaseType: "text", NotNull: true},
+		},
+	}
+	handler := dataGenerateHandler(svc, stubDataConnectionFactory)
+
+	raw, _ := json.Marshal(map[string]any{
+		"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+		"target":     map[string]string{"schema": "public", "name": "customers"},
+		"options":    map[string]any{"rows": 30, "seed": 7},
+	})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+
+	response, ok := result.(dataGenerateResult)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result)
+	}
+	if response.Seed != 7 || response.Inserted != 30 {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	if len(response.Columns) != 1 || response.Columns[0].Name != "email" {
+		t.Fatalf("expected only the email column to be generated, got %+v", response.Columns)
+	}
+	if len(response.Preview) != previewRowLimit {
+		t.Fatalf("expected %d preview rows, got %d", previewRowLimit, len(response.Preview))
+	}
+	if len(svc.lastInsert.Rows) != 30 {
+		t.Fatalf("expected 30 rows to be inserted, got %d", len(svc.lastInsert.Rows))
+	}
+}
+
+func TestDataGenerateHandlerDryRun(t *testing.T) {
+	svc := &stubDataGenService{
+		columns: []datagen.ColumnSpec{{Name: "name", DataType: "text", BaseType: "text"}},
+	}
+	handler := dataGenerateHandler(svc, stubDataConnectionFactory)
+
+	raw, _ := json.Marshal(map[string]any{
+		"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+		"target":     map[string]string{"schema": "public", "name": "customers"},
+		"options":    map[string]any{"rows": 5, "dryRun": true},
+	})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	if svc.inserts != 0 {
+		t.Fatalf("expected no inserts during dry run, got %d", svc.inserts)
+	}
+	if response := result.(dataGenerateResult); response.Inserted != 0 || len(response.Preview) != 5 {
+		t.Fatalf("unexpected dry run response %+v", response)
+	}
+}
+
+func TestDataGenerateHandlerValidation(t *testing.T) {
+	handler := dataGenerateHandler(&stubDataGenService{}, stubDataConnectionFactory)
+
+	cases := map[string]map[string]any{
+		"unsupported driver": {
+			"connection": map[string]string{"driver": "oracle", "dsn": "x"},
+			"target":     map[string]string{"schema": "public", "name": "t"},
+			"options":    map[string]any{"rows": 1},
+		},
+		"missing target": {
+			"connection": map[string]string{"driver": "postgres", "dsn": "x"},
+			"options":    map[string]any{"rows": 1},
+		},
+		"too many rows": {
+			"connection": map[string]string{"driver": "postgres", "dsn": "x"},
+			"target":     map[string]string{"schema": "public", "name": "t"},
+			"options":    map[string]any{"rows": maxGeneratedRows + 1},
+		},
+	}
+
+	for name, params := range cases {
+		raw, _ := json.Marshal(params)
+		if _, rpcErr := handler(context.Background(), raw); rpcErr == nil {
+			t.Fatalf("%s: expected rpc error", name)
+		}
+	}
+}
+
+func TestDataGenerateHandlerTableNotFound(t *testing.T) {
+	handler := dataGenerateHandler(&stubDataGenService{err: datagen.ErrTableNotFound}, stubDataConnectionFactory)
+
+	raw, _ := json.Marshal(map[string]any{
+		"connection": map[string]string{"driver": "postgres", "dsn": "x"},
+		"target":     map[string]string{"schema": "public", "name": "missing"},
+		"options":    map[string]any{"rows": 1},
+	})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32044 {
+		t.Fatalf("expected object not found error, got %+v", rpcErr)
+	}
+}
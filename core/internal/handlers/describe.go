@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/explain"
+	"github.com/fluxgrid/core/internal/history"
+	"github.com/fluxgrid/core/internal/jobs"
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/protocol"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/serverstats"
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"github.com/fluxgrid/core/internal/tempstore"
+	"github.com/fluxgrid/core/internal/tunnel"
+)
+
+type requestIDParams struct {
+	RequestID string `json:"requestId" jsonschema:"required"`
+}
+
+type jobListParams struct {
+	Kind string `json:"kind"`
+}
+
+type jobListResult struct {
+	Jobs []jobs.Info `json:"jobs"`
+}
+
+type jobCancelResult struct {
+	JobID     string `json:"jobId"`
+	Cancelled bool   `json:"cancelled"`
+	State     string `json:"state"`
+}
+
+type jobStartParams struct {
+	Kind   string `json:"kind" jsonschema:"required"`
+	Params any    `json:"params"`
+}
+
+type scheduleIDParams struct {
+	ScheduleID string `json:"scheduleId" jsonschema:"required"`
+}
+
+type streamStartEvent struct {
+	RequestID   string   `json:"requestId"`
+	Cursor      string   `json:"cursor"`
+	Columns     []column `json:"columns"`
+	RowCount    *int     `json:"rowCount"`
+	Pace        string   `json:"pace"`
+	Compression string   `json:"compression,omitempty"`
+	Layout      string   `json:"layout,omitempty"`
+}
+
+type streamChunkEvent struct {
+	RequestID   string  `json:"requestId"`
+	Seq         int     `json:"seq"`
+	Rows        [][]any `json:"rows,omitempty"`
+	Columns     [][]any `json:"columns,omitempty"`
+	HasMore     bool    `json:"hasMore"`
+	Compression string  `json:"compression,omitempty"`
+	Data        string  `json:"data,omitempty"`
+	RowCount    int     `json:"rowCount,omitempty"`
+}
+
+type streamErrorEvent struct {
+	RequestID string `json:"requestId"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Fatal     bool   `json:"fatal"`
+}
+
+type schemaChangedEvent struct {
+	RequestID string       `json:"requestId,omitempty"`
+	Driver    string       `json:"driver"`
+	Objects   []ddl.Object `json:"objects"`
+	Schemas   []string     `json:"schemas"`
+	Tables    []string     `json:"tables"`
+}
+
+type jobProgressEvent struct {
+	JobID    string        `json:"jobId"`
+	Kind     string        `json:"kind"`
+	State    string        `json:"state"`
+	Progress jobs.Progress `json:"progress"`
+}
+
+// outboundNotifications documents the notifications the core sends to the client. It is
+// also the notification set offered in core.initialize.
+var outboundNotifications = map[string]rpc.MethodDoc{
+	"query.stream.start":    {Summary: "Stream columns are known", Params: streamStartEvent{}},
+	"query.stream.chunk":    {Summary: "A batch of streamed rows", Params: streamChunkEvent{}},
+	"query.stream.complete": {Summary: "The stream finished"},
+	"query.stream.error":    {Summary: "The stream failed or was cancelled", Params: streamErrorEvent{}},
+	"query.progress":        {Summary: "Rows read so far by a running classic query", Params: queryProgressEvent{}},
+	"query.notice":          {Summary: "A notice or warning the server sent while running a statement", Params: queryNoticeEvent{}},
+	"query.schedule.result": {Summary: "A scheduled query produced a result"},
+	"query.schedule.error":  {Summary: "A scheduled run failed"},
+	"schema.changed":        {Summary: "DDL changed schema objects", Params: schemaChangedEvent{}},
+	"job.progress":          {Summary: "Background job progress", Params: jobProgressEvent{}},
+	"job.finished":          {Summary: "A background job reached a final state", Params: jobs.Info{}},
+	"core.pressure":         {Summary: "Memory or stream use crossed a configured limit, or recovered", Params: pressure.Event{}},
+	"tunnel.closed":         {Summary: "A tunnel stopped because an SSH hop disconnected or kubectl exited", Params: tunnelClosedEvent{}},
+	"database.changed":      {Summary: "Another program wrote to the SQLite file of a connection handle", Params: databaseChangedEvent{}},
+}
+
+// documentMethods registers the parameter and result shapes reported by rpc.describe.
+func documentMethods(server *rpc.Server) {
+	methods := map[string]rpc.MethodDoc{
+		"core.ping":          {Summary: "Report engine status and version"},
+		"core.initialize":    {Summary: "Negotiate the protocol version and capabilities", Params: protocol.ClientHello{}, Result: initializeResult{}},
+		"core.metrics":       {Summary: "Report outbound queue and resource statistics", Result: metricsResult{}},
+		"query.execute":      {Summary: "Run a statement in classic, cached or streaming mode", Params: executeParams{}, Result: executeResult{}},
+		"connect.test":       {Summary: "Check that a connection can be opened", Params: connectTestParams{}, Result: connectTestResult{}},
+		"connection.open":    {Summary: "Register a connection and return a handle to use instead of its DSN", Params: connectionOpenParams{}, Result: connectionOpenResult{}},
+		"connection.close":   {Summary: "Release a connection handle", Params: connectionHandleParams{}, Result: connectionCloseResult{}},
+		"sandbox.open":       {Summary: "Return a connection handle on the session's scratch in-memory SQLite database, created on first use and dropped when the client disconnects", Result: connectionOpenResult{}},
+		"sandbox.execute":    {Summary: "Run a statement against the session's scratch in-memory SQLite database; takes the params of query.execute without a connection", Result: executeResult{}},
+		"connection.aliases": {Summary: "List the connection aliases defined in the core configuration", Result: connectionAliasesResult{}},
+		"discover.docker":    {Summary: "List running Postgres, MySQL and MariaDB containers as connection candidates", Params: discoverDockerParams{}, Result: discoverResult{}},
+		"discover.scan":      {Summary: "Probe common database ports on localhost and an optional network for Postgres and MySQL servers", Params: discoverScanParams{}, Result: discoverResult{}},
+		"tunnel.open":        {Summary: "Open a port forward through SSH hops or into a Kubernetes pod or service and return its local port", Params: tunnelOpenParams{}, Result: tunnel.Info{}},
+		"tunnel.list":        {Summary: "List this client's tunnels with their traffic counters", Result: tunnelListResult{}},
+		"tunnel.close":       {Summary: "Close a tunnel", Params: tunnelCloseParams{}, Result: tunnelCloseResult{}},
+		"state.export":       {Summary: "Bundle the connection aliases without passwords, rewrite rules, masking rules without the salt and trusted SSH hosts as portable JSON", Params: stateExportParams{}, Result: stateExportResult{}},
+		"state.import":       {Summary: "Store a state bundle's configuration under the state directory for the next start and add its trusted SSH hosts", Params: stateImportParams{}, Result: stateImportResult{}},
+		"ssh.trustHost":      {Summary: "Record an SSH host key as trusted, replacing any key recorded for the host", Params: sshTrustHostParams{}, Result: sshtrust.HostKey{}},
+		"schema.list":        {Summary: "List schemas, tables and columns; on SQLite each attached database is a schema", Params: schemaListParams{}, Result: schemaListResult{}},
+		"server.topQueries":  {Summary: "List the heaviest statements recorded by the server", Params: serverTopQueriesParams{}, Result: serverTopQueriesResult{}},
+		"server.locks":       {Summary: "List lock waits and the sessions blocking them", Params: serverLocksParams{}, Result: serverstats.LockReport{}},
+		"server.terminate":   {Summary: "Terminate a session or cancel its statement", Params: serverTerminateParams{}, Result: serverTerminateResult{}},
+		"maintenance.run":    {Summary: "Start a background VACUUM, ANALYZE or REINDEX job on selected tables", Params: maintenanceRunParams{}, Result: jobs.Info{}},
+		"table.resolve":      {Summary: "Resolve a table name as typed to its schema-qualified form using the session search path or current database", Params: tableResolveParams{}, Result: tableResolveResult{}},
+		"table.peek":         {Summary: "Read a page of a table, filtered with a structured filter, sorted with explicit NULL ordering and with JSON paths projected into columns", Params: tablePeekParams{}, Result: tablePeekResult{}},
+		"table.search":       {Summary: "Search the text columns of a table for a term, with match positions for highlighting", Params: tableSearchParams{}, Result: tableSearchResult{}},
+		"ddl.get":            {Summary: "Return the DDL of a table or view", Params: ddlGetParams{}, Result: ddlGetResult{}},
+		"data.related":       {Summary: "Follow foreign keys from a row to the row it references and the rows referencing it", Params: dataRelatedParams{}, Result: dataRelatedResult{}},
+		"table.identity":     {Summary: "Report how rows of a table are identified for editing: primary key, unique index, ctid or rowid", Params: tableIdentityParams{}, Result: tableIdentityResult{}},
+		"data.applyEdits":    {Summary: "Apply row updates and deletes in one transaction, each matched by the table's row identity and optionally its originally read values", Params: dataApplyEditsParams{}, Result: dataApplyEditsResult{}},
+		"data.bulkEdit":      {Summary: "Update or delete the rows matching a filter in one transaction, counting them first and requiring confirmation above a threshold", Params: dataBulkEditParams{}, Result: dataBulkEditResult{}},
+		"data.import":        {Summary: "Insert pasted CSV or JSON rows into a table in one transaction, optionally creating it with column types inferred from the data", Params: dataImportParams{}, Result: dataImportResult{}},
+		"sequence.list":      {Summary: "List sequences and AUTO_INCREMENT counters with their current values", Params: sequenceListParams{}, Result: sequenceListResult{}},
+		"sequence.reset":     {Summary: "Restart a sequence or AUTO_INCREMENT counter, refusing values its column already holds unless allowed", Params: sequenceResetParams{}, Result: sequenceResetResult{}},
+		"tx.begin":           {Summary: "Open a transaction on a dedicated connection, kept until it is committed or rolled back or the client disconnects", Params: txBeginParams{}, Result: txBeginResult{}},
+		"tx.execute":         {Summary: "Run a statement inside an open transaction", Params: txExecuteParams{}, Result: executeResult{}},
+		"tx.commit":          {Summary: "Commit an open transaction and close its connection", Params: txIDParams{}, Result: txFinishResult{}},
+		"tx.rollback":        {Summary: "Roll back an open transaction and close its connection", Params: txIDParams{}, Result: txFinishResult{}},
+		"tx.recover":         {Summary: "List transactions left open by a core that exited without ending them, optionally dismissing some", Params: txRecoverParams{}, Result: txRecoverResult{}},
+		"tx.savepoint":       {Summary: "Set a savepoint in an open transaction and push it on the transaction's savepoint stack", Params: txSavepointParams{}, Result: txSavepointResult{}},
+		"tx.rollbackTo":      {Summary: "Roll an open transaction back to a savepoint on its stack, discarding the savepoints set after it", Params: txSavepointParams{}, Result: txSavepointResult{}},
+		"tx.release":         {Summary: "Release a savepoint on an open transaction's stack along with the savepoints set after it", Params: txSavepointParams{}, Result: txSavepointResult{}},
+		"tx.mode":            {Summary: "Report whether the client is in autocommit mode and list the transactions it has open", Result: txModeResult{}},
+		"tx.setAutocommit":   {Summary: "Turn autocommit on or off for the client; with it off, query.execute keeps each connection's statements in one transaction until tx.commit or tx.rollback", Params: txSetAutocommitParams{}, Result: txModeResult{}},
+		"data.generate":      {Summary: "Generate and insert mock rows", Params: dataGenerateParams{}, Result: dataGenerateResult{}},
+		"result.compare":     {Summary: "Diff two query results, or a query result and a pinned snapshot, by key", Params: resultCompareParams{}, Result: resultCompareResult{}},
+		"result.pivot":       {Summary: "Pivot a cached result", Params: resultPivotParams{}},
+		"privacy.scan":       {Summary: "Sample a table or cached result and report columns likely holding personal data, with suggested masking rules", Params: privacyScanParams{}, Result: privacyScanResult{}},
+		"result.search":      {Summary: "Search a cached result", Params: resultSearchParams{}},
+		"result.sort":        {Summary: "Sort a cached result, optionally with a locale's collation, into a new cached result", Params: resultSortParams{}, Result: resultSortResult{}},
+		"result.filter":      {Summary: "Filter a cached result with a structured filter into a new cached result", Params: resultFilterParams{}, Result: resultFilterResult{}},
+		"result.expandJson":  {Summary: "Extract JSON paths of a json column into new columns of a new cached result", Params: resultExpandJSONParams{}, Result: resultExpandJSONResult{}},
+		"result.copyAs":      {Summary: "Render a cached result for the clipboard", Params: resultCopyParams{}, Result: resultCopyResult{}},
+		"result.release": {Summary: "Drop a cached result", Params: struct {
+			ResultID string `json:"resultId"`
+		}{}},
+		"export.run":          {Summary: "Export rows to a file and wait for completion", Params: exportRunParams{}, Result: exportRunResult{}},
+		"export.inferTypes":   {Summary: "Infer export column types", Params: exportInferParams{}},
+		"export.start":        {Summary: "Start a background export job", Params: exportRunParams{}, Result: jobs.Info{}},
+		"export.status":       {Summary: "Return an export job", Params: jobIDParams{}, Result: jobs.Info{}},
+		"export.cancel":       {Summary: "Cancel an export job", Params: jobIDParams{}, Result: jobCancelResult{}},
+		"export.list":         {Summary: "List export jobs", Result: jobListResult{}},
+		"job.start":           {Summary: "Start a background job of a registered kind", Params: jobStartParams{}, Result: jobs.Info{}},
+		"job.status":          {Summary: "Return a background job", Params: jobIDParams{}, Result: jobs.Info{}},
+		"job.cancel":          {Summary: "Cancel a background job", Params: jobIDParams{}, Result: jobCancelResult{}},
+		"job.list":            {Summary: "List background jobs", Params: jobListParams{}, Result: jobListResult{}},
+		"temp.usage":          {Summary: "Report temp storage usage", Result: tempstore.Usage{}},
+		"history.list":        {Summary: "List recent query.execute runs and pinned runs, newest first, optionally only those of one fingerprint", Params: historyListParams{}, Result: historyListResult{}},
+		"history.stats":       {Summary: "Summarize recent runs: most used tables, daily duration trend, error rate by connection, busiest hours, slowest and failing statements", Params: historyStatsParams{}, Result: history.Stats{}},
+		"history.pin":         {Summary: "Pin a run whose result is cached, keeping its result as a compressed snapshot in the state directory", Params: historyPinParams{}, Result: history.Entry{}},
+		"history.unpin":       {Summary: "Delete the snapshot of a pinned run", Params: historyIDParams{}, Result: historyUnpinResult{}},
+		"history.getSnapshot": {Summary: "Read a page of a pinned run's snapshot, optionally loading it into the result cache", Params: historySnapshotParams{}, Result: historySnapshotResult{}},
+		"history.getPlan":     {Summary: "Read the execution plan captured for a run, with the previous run of the same statement that has one", Params: historyIDParams{}, Result: historyPlanResult{}},
+		"sql.fingerprint":     {Summary: "Normalize a statement and compute the fingerprint history groups its runs by", Params: sqlFingerprintParams{}, Result: sqlFingerprintResult{}},
+		"plan.analyze":        {Summary: "Annotate a Postgres JSON plan for display with per-node exclusive time and cost, row estimate skew, buffer use and highlights", Params: planAnalyzeParams{}, Result: explain.Analysis{}},
+		"advisor.indexes":     {Summary: "Suggest Postgres indexes for a statement or the recent history of a database, checked with hypopg when it is installed", Params: advisorIndexesParams{}, Result: advisorIndexesResult{}},
+		"query.schedule":      {Summary: "Re-run a query on an interval", Params: scheduleParams{}, Result: scheduleInfo{}},
+		"query.unschedule":    {Summary: "Stop a scheduled query", Params: scheduleIDParams{}},
+		"query.schedule.list": {Summary: "List scheduled queries"},
+		"query.cancel":        {Summary: "Cancel an in-flight request", Params: requestIDParams{}},
+		"query.stream.ack": {Summary: "Acknowledge stream chunks up to seq", Params: struct {
+			RequestID string `json:"requestId"`
+			Seq       int    `json:"seq"`
+		}{}},
+		"query.stream.cancel": {Summary: "Cancel a streaming query", Params: requestIDParams{}},
+	}
+	for name, doc := range methods {
+		server.Document(name, doc)
+	}
+
+	for name, doc := range outboundNotifications {
+		server.DocumentOutbound(name, doc)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+type describeResponse struct {
+	Methods []struct {
+		Name    string      `json:"name"`
+		Summary string      `json:"summary"`
+		Params  *rpc.Schema `json:"params"`
+	} `json:"methods"`
+	Notifications []struct {
+		Name      string `json:"name"`
+		Direction string `json:"direction"`
+		Summary   string `json:"summary"`
+	} `json:"notifications"`
+}
+
+func TestEveryMethodIsDocumented(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	Register(server, Config{})
+
+	var out bytes.Buffer
+	request := `{"jsonrpc":"2.0","id":1,"method":"rpc.describe"}`
+	if err := server.Serve(strings.NewReader(request), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	var response struct {
+		Result describeResponse `json:"result"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %s: %v", out.String(), err)
+	}
+
+	for _, method := range response.Result.Methods {
+		if method.Summary == "" {
+			t.Errorf("method %s is not documented", method.Name)
+		}
+		if method.Name == "query.execute" && method.Params.Properties["sql"].Type != "string" {
+			t.Errorf("unexpected query.execute params %+v", method.Params)
+		}
+	}
+	for _, notification := range response.Result.Notifications {
+		if notification.Summary == "" {
+			t.Errorf("notification %s (%s) is not documented", notification.Name, notification.Direction)
+		}
+	}
+}
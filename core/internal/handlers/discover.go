@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fluxgrid/core/internal/discover"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const defaultDiscoverTimeout = 5 * time.Second
+
+type discoverDockerParams struct {
+	// Host is a Docker endpoint such as unix:///var/run/docker.sock; DOCKER_HOST applies
+	// when empty.
+	Host string `json:"host"`
+}
+
+type discoverResult struct {
+	Candidates []discover.Candidate `json:"candidates"`
+}
+
+func discoverDockerHandler(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+	var payload discoverDockerParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+	}
+	docker, err := discover.NewDocker(payload.Host)
+	if err != nil {
+		return nil, &rpc.Error{Code: -32602, Message: err.Error()}
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, defaultDiscoverTimeout)
+	defer cancel()
+	candidates, err := docker.Candidates(timeoutCtx)
+	if err != nil {
+		return nil, &rpc.Error{
+			Code:    -32150,
+			Message: "Docker is not reachable",
+			Data:    err.Error(),
+		}
+	}
+	return discoverResult{Candidates: candidates}, nil
+}
+
+const scanTimeout = 30 * time.Second
+
+type discoverScanParams struct {
+	// CIDR adds a network to localhost, up to 1024 addresses.
+	CIDR  string `json:"cidr"`
+	Ports []int  `json:"ports"`
+	// ProbeTimeoutMs bounds each connection attempt.
+	ProbeTimeoutMs int `json:"probeTimeoutMs"`
+}
+
+// discoverScanHandler probes well-known database ports. Clients only call it when the user
+// asks, since it opens connections to every address in the range.
+func discoverScanHandler(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+	var payload discoverScanParams
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+	}
+	opts := discover.ScanOptions{
+		CIDR:    payload.CIDR,
+		Ports:   payload.Ports,
+		Timeout: time.Duration(payload.ProbeTimeoutMs) * time.Millisecond,
+	}
+	if _, err := discover.ScanHosts(opts.CIDR); err != nil {
+		return nil, &rpc.Error{Code: -32602, Message: err.Error()}
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, scanTimeout)
+	defer cancel()
+	candidates, err := discover.Scan(timeoutCtx, opts)
+	if err != nil {
+		code := -32603
+		if timeoutCtx.Err() == nil {
+			code = -32602
+		}
+		return nil, &rpc.Error{Code: code, Message: "scan failed", Data: err.Error()}
+	}
+	return discoverResult{Candidates: candidates}, nil
+}
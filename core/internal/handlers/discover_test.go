@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscoverDockerReportsUnreachableEngine(t *testing.T) {
+	raw, _ := json.Marshal(map[string]string{"host": "unix://" + filepath.Join(t.TempDir(), "missing.sock")})
+	if _, rpcErr := discoverDockerHandler(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32150 {
+		t.Fatalf("expected an unreachable engine error, got %+v", rpcErr)
+	}
+	if _, rpcErr := discoverDockerHandler(context.Background(), json.RawMessage(`{"host":"ssh://remote"}`)); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected an unsupported host to be refused, got %+v", rpcErr)
+	}
+}
+
+func TestDiscoverScanValidatesParams(t *testing.T) {
+	for _, params := range []string{`{"cidr":"10.0.0.0/8"}`, `{"cidr":"not a network"}`, `{"ports":[70000]}`} {
+		if _, rpcErr := discoverScanHandler(context.Background(), json.RawMessage(params)); rpcErr == nil || rpcErr.Code != -32602 {
+			t.Fatalf("expected %s to be refused, got %+v", params, rpcErr)
+		}
+	}
+}
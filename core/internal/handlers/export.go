@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fluxgrid/core/internal/export"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const defaultExportMaxRows = 1000000
+
+type exportSource struct {
+	ResultID   string             `json:"resultId"`
+	Connection dbConnectionParams `json:"connection"`
+	SQL        string             `json:"sql"`
+	Table      *exportTableSource `json:"table,omitempty"`
+}
+
+type exportRunParams struct {
+	Source  exportSource `json:"source"`
+	Path    string       `json:"path" jsonschema:"required"`
+	Options struct {
+		export.Options
+		ColumnTypes    map[string]export.LogicalType `json:"columnTypes"`
+		Overwrite      bool                          `json:"overwrite"`
+		MaxRows        int                           `json:"maxRows"`
+		TimeoutSeconds int                           `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type exportRunResult struct {
+	Path string `json:"path"`
+	export.Stats
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+}
+
+// resolveExportSource returns the rows to export, either from the result cache or by running
+// the source query in classic mode, or by reading a table source.
+func resolveExportSource(
+	ctx context.Context,
+	results *resultset.Cache,
+	execute classicExecutor,
+	source exportSource,
+	maxRows, timeoutSeconds int,
+) (resultset.Set, *rpc.Error) {
+	if source.ResultID != "" {
+		return lookupResult(results, source.ResultID)
+	}
+	if source.Table != nil {
+		return fetchTableSet(ctx, source, maxRows, timeoutSeconds)
+	}
+
+	if source.SQL == "" || source.Connection.Driver == "" || source.Connection.DSN == "" {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32602,
+			Message: "source requires a resultId, a connection and SQL, or a connection and table",
+		}
+	}
+
+	var exec executeParams
+	exec.Connection.Driver = source.Connection.Driver
+	exec.Connection.DSN = source.Connection.DSN
+	exec.SQL = source.SQL
+	exec.Options.MaxRows = maxRows
+	exec.Options.TimeoutSeconds = timeoutSeconds
+	return runClassicSet(ctx, execute, exec)
+}
+
+func exportRunHandler(results *resultset.Cache, execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		payload, rpcErr := parseExportRun(params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		result, rpcErr := runExport(ctx, results, execute, payload, nil)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return result, nil
+	}
+}
+
+// parseExportRun decodes export.run and export.start parameters and applies defaults.
+func parseExportRun(params json.RawMessage) (exportRunParams, *rpc.Error) {
+	var payload exportRunParams
+	if err := json.Unmarshal(params, &payload); err != nil {
+		return payload, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+
+	if payload.Path == "" || !filepath.IsAbs(payload.Path) {
+		return payload, &rpc.Error{
+			Code:    -32602,
+			Message: "an absolute output path is required",
+		}
+	}
+	if payload.Options.Format == "" {
+		payload.Options.Format = formatFromExtension(payload.Path)
+	}
+	payload.Options.Overrides = payload.Options.ColumnTypes
+	if err := payload.Options.Validate(); err != nil {
+		return payload, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid export options",
+			Data:    err.Error(),
+		}
+	}
+	if payload.Options.MaxRows <= 0 {
+		payload.Options.MaxRows = defaultExportMaxRows
+	}
+	if payload.Options.TimeoutSeconds <= 0 {
+		payload.Options.TimeoutSeconds = 300
+	}
+	return payload, nil
+}
+
+// exportObserver receives progress from runExport. Export jobs use it to publish status.
+type exportObserver interface {
+	sourceReady(rows int)
+	progress(stats export.Stats)
+}
+
+func runExport(
+	ctx context.Context,
+	results *resultset.Cache,
+	execute classicExecutor,
+	payload exportRunParams,
+	observer exportObserver,
+) (exportRunResult, *rpc.Error) {
+	start := time.Now()
+
+	set, rpcErr := resolveExportSource(
+		ctx, results, execute, payload.Source, payload.Options.MaxRows, payload.Options.TimeoutSeconds,
+	)
+	if rpcErr != nil {
+		return exportRunResult{}, rpcErr
+	}
+
+	opts := payload.Options.Options
+	if observer != nil {
+		observer.sourceReady(len(set.Rows))
+		opts.Progress = observer.progress
+	}
+
+	stats, err := writeExportFile(ctx, set, payload.Path, payload.Options.Overwrite, opts)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return exportRunResult{}, &rpc.Error{
+				Code:    -32081,
+				Message: "output file already exists",
+				Data:    payload.Path,
+			}
+		}
+		return exportRunResult{}, &rpc.Error{
+			Code:    -32080,
+			Message: "export failed",
+			Data:    err.Error(),
+		}
+	}
+
+	duration := time.Since(start).Seconds() * 1000
+
+	logger := logging.Logger()
+	logger.Info().
+		Str("format", payload.Options.Format).
+		Int("row_count", stats.Rows).
+		Int64("bytes", stats.Bytes).
+		Float64("duration_ms", duration).
+		Msg("export completed")
+
+	return exportRunResult{
+		Path:            payload.Path,
+		Stats:           stats,
+		ExecutionTimeMs: duration,
+	}, nil
+}
+
+// writeExportFile writes to a sibling .partial file and renames it into place on success, so
+// readers never observe a half-written export.
+func writeExportFile(ctx context.Context, set resultset.Set, path string, overwrite bool, opts export.Options) (export.Stats, error) {
+	if !overwrite {
+		if _, err := os.Stat(path); err == nil {
+			return export.Stats{}, os.ErrExist
+		}
+	}
+
+	partial := path + ".partial"
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return export.Stats{}, err
+	}
+
+	stats, err := export.Run(ctx, set, file, opts)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return stats, err
+	}
+
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return stats, err
+	}
+	return stats, nil
+}
+
+func formatFromExtension(path string) string {
+	switch ext := filepath.Ext(path); ext {
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case "":
+		return ""
+	default:
+		return ext[1:]
+	}
+}
+
+type exportInferParams struct {
+	Source  exportSource `json:"source"`
+	Options struct {
+		SampleSize      int                           `json:"sampleSize"`
+		ColumnTypes     map[string]export.LogicalType `json:"columnTypes"`
+		AliasDuplicates bool                          `json:"aliasDuplicates"`
+		MaxRows         int                           `json:"maxRows"`
+		TimeoutSeconds  int                           `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+func exportInferTypesHandler(results *resultset.Cache, execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload exportInferParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Options.SampleSize <= 0 {
+			payload.Options.SampleSize = 1000
+		}
+		if payload.Options.MaxRows <= 0 {
+			payload.Options.MaxRows = payload.Options.SampleSize
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+
+		set, rpcErr := resolveExportSource(
+			ctx, results, execute, payload.Source, payload.Options.MaxRows, payload.Options.TimeoutSeconds,
+		)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		if payload.Options.AliasDuplicates {
+			set.Columns = resultset.DisambiguateNames(set.Columns)
+		}
+		columns, err := export.InferColumnTypes(set.Columns, set.Rows, export.InferOptions{
+			SampleSize: payload.Options.SampleSize,
+			Overrides:  payload.Options.ColumnTypes,
+		})
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid column type override",
+				Data:    err.Error(),
+			}
+		}
+
+		return map[string]any{"columns": columns}, nil
+	}
+}
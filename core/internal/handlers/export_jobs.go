@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/export"
+	"github.com/fluxgrid/core/internal/jobs"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// exportJobKind runs export.run in the background through the shared job manager.
+func exportJobKind(results *resultset.Cache, execute classicExecutor) jobs.Kind {
+	return jobs.Kind{
+		Validate: func(params json.RawMessage) (string, *rpc.Error) {
+			payload, rpcErr := parseExportRun(params)
+			if rpcErr != nil {
+				return "", rpcErr
+			}
+			return payload.Path, nil
+		},
+		Run: func(ctx context.Context, params json.RawMessage, report jobs.Reporter) (any, *rpc.Error) {
+			payload, rpcErr := parseExportRun(params)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			report(jobs.Progress{Phase: "querying"})
+			result, rpcErr := runExport(ctx, results, execute, payload, &exportJobProgress{report: report})
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			return result, nil
+		},
+	}
+}
+
+// exportJobProgress adapts export progress to job progress.
+type exportJobProgress struct {
+	report jobs.Reporter
+	total  int64
+}
+
+func (p *exportJobProgress) sourceReady(rows int) {
+	p.total = int64(rows)
+	p.report(jobs.Progress{Phase: "writing", Total: p.total})
+}
+
+func (p *exportJobProgress) progress(stats export.Stats) {
+	p.report(jobs.Progress{
+		Phase: "writing",
+		Done:  int64(stats.Rows),
+		Total: p.total,
+		Bytes: stats.Bytes,
+	})
+}
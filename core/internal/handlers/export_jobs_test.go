@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/jobs"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func waitForJob(t *testing.T, manager *jobs.Manager, notify *recordingNotifier, id string) jobs.Info {
+	t.Helper()
+	for count := 1; ; count++ {
+		events := notify.waitFor(t, count)
+		if events[count-1].method == "job.finished" {
+			info, _ := manager.Status(id)
+			return info
+		}
+	}
+}
+
+func TestExportJobReportsProgress(t *testing.T) {
+	rows := make([][]any, 2500)
+	for i := range rows {
+		rows[i] = []any{int64(i)}
+	}
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{Columns: []resultset.Column{{Name: "id", DataType: "20"}}, Rows: rows})
+
+	notify := newRecordingNotifier()
+	manager := jobs.NewManager(notify, jobs.Options{ProgressInterval: -1})
+	manager.RegisterKind("export", exportJobKind(results, nil))
+
+	path := filepath.Join(t.TempDir(), "out.csv")
+	raw, _ := json.Marshal(map[string]any{"source": map[string]any{"resultId": id}, "path": path})
+	started, rpcErr := jobKindStartHandler(manager, "export")(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("start returned rpc error: %v", rpcErr)
+	}
+
+	info := waitForJob(t, manager, notify, started.(jobs.Info).ID)
+	if info.State != jobs.StateCompleted || info.Label != path {
+		t.Fatalf("unexpected job %+v", info)
+	}
+
+	var result exportRunResult
+	if err := json.Unmarshal(info.Result, &result); err != nil || result.Rows != 2500 {
+		t.Fatalf("unexpected job result %s (%v)", info.Result, err)
+	}
+
+	var sawPartial bool
+	for _, event := range notify.waitFor(t, 1) {
+		if event.method != "job.progress" {
+			continue
+		}
+		progress := event.params["progress"].(jobs.Progress)
+		if progress.Phase == "writing" && progress.Done == 1000 && progress.Total == 2500 {
+			sawPartial = true
+		}
+	}
+	if !sawPartial {
+		t.Fatal("expected a progress notification after 1000 rows")
+	}
+
+	listed, _ := jobListHandler(manager, "export")(context.Background(), nil)
+	if jobsList := listed.(map[string]any)["jobs"].([]jobs.Info); len(jobsList) != 1 {
+		t.Fatalf("unexpected job list %+v", jobsList)
+	}
+}
+
+func TestExportJobCancel(t *testing.T) {
+	running := make(chan struct{})
+	execute := func(ctx context.Context, _ executeParams) (any, *rpc.Error) {
+		close(running)
+		<-ctx.Done()
+		return nil, &rpc.Error{Code: -32011, Message: "query execution failed"}
+	}
+
+	notify := newRecordingNotifier()
+	manager := jobs.NewManager(notify, jobs.Options{})
+	manager.RegisterKind("export", exportJobKind(resultset.NewCache(4, 0), execute))
+
+	path := filepath.Join(t.TempDir(), "out.json")
+	raw, _ := json.Marshal(map[string]any{
+		"source": map[string]any{
+			"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+			"sql":        "SELECT * FROM big_table",
+		},
+		"path": path,
+	})
+	started, rpcErr := jobKindStartHandler(manager, "export")(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("start returned rpc error: %v", rpcErr)
+	}
+	<-running
+
+	jobID := started.(jobs.Info).ID
+	raw, _ = json.Marshal(map[string]string{"jobId": jobID})
+	cancelled, rpcErr := jobCancelHandler(manager)(context.Background(), raw)
+	if rpcErr != nil || cancelled.(map[string]any)["cancelled"] != true {
+		t.Fatalf("unexpected cancel response %+v, %v", cancelled, rpcErr)
+	}
+
+	if info := waitForJob(t, manager, notify, jobID); info.State != jobs.StateCancelled {
+		t.Fatalf("expected cancelled job, got %+v", info)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no output file, got %v", err)
+	}
+}
+
+func TestJobHandlersRejectUnknownJobs(t *testing.T) {
+	manager := jobs.NewManager(nil, jobs.Options{})
+
+	raw, _ := json.Marshal(map[string]string{"jobId": "job-99"})
+	if _, rpcErr := jobStatusHandler(manager)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32083 {
+		t.Fatalf("expected job not found error, got %+v", rpcErr)
+	}
+
+	raw, _ = json.Marshal(map[string]any{"kind": "backup", "params": map[string]any{}})
+	if _, rpcErr := jobStartHandler(manager)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected unknown kind error, got %+v", rpcErr)
+	}
+}
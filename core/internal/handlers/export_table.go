@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/partfetch"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxExportParallel = 16
+
+// exportTableSource exports a Postgres table rather than the result of a query. With
+// Parallel above one, the leaf partitions of a partitioned table are read concurrently and
+// merged back into OrderBy order.
+type exportTableSource struct {
+	Schema  string               `json:"schema"`
+	Name    string               `json:"name" jsonschema:"required"`
+	Columns []string             `json:"columns"`
+	Where   string               `json:"where"`
+	OrderBy []partfetch.OrderKey `json:"orderBy"`
+	// Parallel is how many partitions are read at once, up to 16.
+	Parallel int `json:"parallel"`
+}
+
+type tableFetcher func(ctx context.Context, dsn string, req partfetch.Request) (partfetch.Result, error)
+
+// exportTableFetcher reads table sources. Tests replace it to avoid a database.
+var exportTableFetcher tableFetcher = pgxPoolTableFetcher
+
+// pgxPoolTableFetcher reads over a pool sized to the requested parallelism.
+func pgxPoolTableFetcher(ctx context.Context, dsn string, req partfetch.Request) (partfetch.Result, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return partfetch.Result{}, err
+	}
+	cfg.MaxConns = int32(max(req.Workers, 1))
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return partfetch.Result{}, err
+	}
+	defer pool.Close()
+
+	return partfetch.Fetch(ctx, func(ctx context.Context) (partfetch.Conn, func(), error) {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, conn.Release, nil
+	}, req)
+}
+
+func fetchTableSet(ctx context.Context, source exportSource, maxRows, timeoutSeconds int) (resultset.Set, *rpc.Error) {
+	table := source.Table
+	if source.Connection.Driver != "postgres" {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32601,
+			Message: fmt.Sprintf("table sources are not supported for driver: %s", source.Connection.Driver),
+		}
+	}
+	if table.Name == "" || source.Connection.DSN == "" {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32602,
+			Message: "a table source requires a connection and a table name",
+		}
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+	fetched, err := exportTableFetcher(timeoutCtx, source.Connection.DSN, partfetch.Request{
+		Schema:  table.Schema,
+		Table:   table.Name,
+		Columns: table.Columns,
+		Where:   table.Where,
+		OrderBy: table.OrderBy,
+		Limit:   maxRows,
+		Workers: min(table.Parallel, maxExportParallel),
+	})
+	if err != nil {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32011,
+			Message: "query execution failed",
+			Data:    err.Error(),
+		}
+	}
+
+	set := resultset.Set{
+		Columns: make([]resultset.Column, len(fetched.Fields)),
+		Rows:    fetched.Rows,
+	}
+	for i, field := range fetched.Fields {
+		set.Columns[i] = resultset.Column{Name: field.Name, DataType: fmt.Sprintf("%d", field.DataTypeOID)}
+	}
+	for _, row := range set.Rows {
+		for i, value := range row {
+			row[i] = normalizeValue(value)
+		}
+	}
+	if policy := dataMasks.policyFor(source.Connection); policy != nil {
+		schema := table.Schema
+		if schema == "" {
+			schema = "public"
+		}
+		columns := make([]masking.Column, len(fetched.Fields))
+		for i, field := range fetched.Fields {
+			columns[i] = masking.Column{Name: field.Name, Schema: schema, Table: table.Name, Column: field.Name}
+		}
+		maskRows(policy, columns, set.Rows)
+	}
+	return set, nil
+}
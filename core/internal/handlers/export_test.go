@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/export"
+	"github.com/fluxgrid/core/internal/partfetch"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestExportRunHandlerWritesCachedResult(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "id", DataType: "23"}, {Name: "zip", DataType: "23"}},
+		Rows:    [][]any{{int64(1), int64(2134)}},
+	})
+
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	handler := exportRunHandler(results, nil)
+	raw, _ := json.Marshal(map[string]any{
+		"source":  map[string]any{"resultId": id},
+		"path":    path,
+		"options": map[string]any{"columnTypes": map[string]string{"zip": "string"}},
+	})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	response, ok := result.(exportRunResult)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result)
+	}
+	if response.Rows != 1 || response.Columns[1].Source != "override" {
+		t.Fatalf("unexpected response %+v", response)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	if string(data) != "{\"id\":1,\"zip\":\"2134\"}\n" {
+		t.Fatalf("unexpected file contents %q", data)
+	}
+	if _, err := os.Stat(path + ".partial"); !os.IsNotExist(err) {
+		t.Fatalf("expected partial file to be removed, got %v", err)
+	}
+
+	if _, rpcErr := handler(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32081 {
+		t.Fatalf("expected existing file error, got %+v", rpcErr)
+	}
+}
+
+func TestExportRunHandlerRejectsUnknownFormat(t *testing.T) {
+	handler := exportRunHandler(resultset.NewCache(4, 0), nil)
+	raw, _ := json.Marshal(map[string]any{
+		"source": map[string]any{"resultId": "res-1"},
+		"path":   filepath.Join(t.TempDir(), "out.xml"),
+	})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected invalid params error, got %+v", rpcErr)
+	}
+}
+
+func TestExportInferTypesHandlerRunsQuery(t *testing.T) {
+	var captured executeParams
+	execute := func(_ context.Context, payload executeParams) (any, *rpc.Error) {
+		captured = payload
+		return executeResult{
+			Columns: []column{{Name: "day", DataType: "25"}},
+			Rows:    [][]interface{}{{"2024-05-01"}, {"2024-05-02"}},
+		}, nil
+	}
+
+	handler := exportInferTypesHandler(resultset.NewCache(4, 0), execute)
+	raw, _ := json.Marshal(map[string]any{
+		"source": map[string]any{
+			"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+			"sql":        "SELECT day FROM events",
+		},
+		"options": map[string]any{"sampleSize": 50},
+	})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	if captured.Options.MaxRows != 50 {
+		t.Fatalf("expected sample size to bound the query, got %d", captured.Options.MaxRows)
+	}
+	columns := result.(map[string]any)["columns"].([]export.ColumnType)
+	if columns[0].Type != export.TypeDate {
+		t.Fatalf("unexpected column types %+v", columns)
+	}
+}
+
+func TestExportRunHandlerParquetFromExtension(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "id", DataType: "20"}},
+		Rows:    [][]any{{int64(1)}, {int64(2)}},
+	})
+
+	path := filepath.Join(t.TempDir(), "out.parquet")
+	handler := exportRunHandler(results, nil)
+	raw, _ := json.Marshal(map[string]any{
+		"source":  map[string]any{"resultId": id},
+		"path":    path,
+		"options": map[string]any{"compression": "zstd", "rowGroupRows": 1},
+	})
+
+	if _, rpcErr := handler(context.Background(), raw); rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading export: %v", err)
+	}
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatalf("expected parquet magic, got % x", data[:4])
+	}
+
+	raw, _ = json.Marshal(map[string]any{
+		"source":  map[string]any{"resultId": id},
+		"path":    filepath.Join(t.TempDir(), "out.parquet"),
+		"options": map[string]any{"compression": "lzo"},
+	})
+	if _, rpcErr := handler(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected invalid params error, got %+v", rpcErr)
+	}
+}
+
+func TestExportRunHandlerReadsTableSource(t *testing.T) {
+	var captured partfetch.Request
+	previous := exportTableFetcher
+	exportTableFetcher = func(_ context.Context, dsn string, req partfetch.Request) (partfetch.Result, error) {
+		captured = req
+		return partfetch.Result{
+			Fields: []pgconn.FieldDescription{{Name: "id", DataTypeOID: 20}},
+			Rows:   [][]any{{int64(1)}, {int64(2)}},
+		}, nil
+	}
+	defer func() { exportTableFetcher = previous }()
+
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	raw, _ := json.Marshal(map[string]any{
+		"source": map[string]any{
+			"connection": map[string]any{"driver": "postgres", "dsn": "postgres://localhost/db"},
+			"table": map[string]any{
+				"name":     "events",
+				"orderBy":  []map[string]any{{"column": "id"}},
+				"parallel": 64,
+			},
+		},
+		"path":    path,
+		"options": map[string]any{"maxRows": 10},
+	})
+	if _, rpcErr := exportRunHandler(resultset.NewCache(4, 0), nil)(context.Background(), raw); rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	if captured.Table != "events" || captured.Workers != maxExportParallel || captured.Limit != 10 {
+		t.Fatalf("unexpected fetch request %+v", captured)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Fatalf("unexpected file contents %q", data)
+	}
+}
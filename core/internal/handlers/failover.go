@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// connectPostgres connects to the first host of a possibly multi-host DSN
+// (host=a,b,c or postgres://a,b,c/db) that accepts the connection and satisfies its
+// target_session_attrs, trying the hosts in order. It returns the host:port it used.
+func connectPostgres(ctx context.Context, dsn string) (*pgx.Conn, string, error) {
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg.OnNotice = postgresNotices.handle
+	var errs []error
+	for _, group := range postgresHostGroups(cfg) {
+		attempt := cfg.Copy()
+		attempt.Host, attempt.Port, attempt.TLSConfig = group[0].Host, group[0].Port, group[0].TLSConfig
+		attempt.Fallbacks = group[1:]
+		conn, err := pgx.ConnectConfig(ctx, attempt)
+		if err == nil {
+			return conn, postgresHost(group[0]), nil
+		}
+		errs = append(errs, err)
+		// Bad credentials would fail on every host.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "28") || ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// postgresHostGroups lists the hosts of cfg in order, each with the TLS variants pgx
+// derived from its sslmode.
+func postgresHostGroups(cfg *pgx.ConnConfig) [][]*pgconn.FallbackConfig {
+	entries := append([]*pgconn.FallbackConfig{{Host: cfg.Host, Port: cfg.Port, TLSConfig: cfg.TLSConfig}}, cfg.Fallbacks...)
+	var groups [][]*pgconn.FallbackConfig
+	for _, entry := range entries {
+		if n := len(groups); n > 0 && groups[n-1][0].Host == entry.Host && groups[n-1][0].Port == entry.Port {
+			groups[n-1] = append(groups[n-1], entry)
+			continue
+		}
+		groups = append(groups, []*pgconn.FallbackConfig{entry})
+	}
+	return groups
+}
+
+func postgresHost(entry *pgconn.FallbackConfig) string {
+	if strings.HasPrefix(entry.Host, "/") {
+		return entry.Host
+	}
+	return net.JoinHostPort(entry.Host, strconv.Itoa(int(entry.Port)))
+}
+
+// mysqlFailover picks the first reachable server of a MySQL DSN listing several
+// addresses, as in user:pass@tcp(a:3306,b:3306)/db, and returns a DSN for that server
+// alone and its address. DSNs with one address are returned unchanged without dialling.
+func mysqlFailover(ctx context.Context, dsn string) (string, string, error) {
+	prefix, addrs, suffix := mysqlAddrs(dsn)
+	if len(addrs) < 2 {
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return "", "", err
+		}
+		return dsn, cfg.Addr, nil
+	}
+	var errs []error
+	for _, addr := range addrs {
+		candidate := prefix + addr + suffix
+		db, err := sql.Open("mysql", candidate)
+		if err != nil {
+			return "", "", err
+		}
+		err = db.PingContext(ctx)
+		db.Close()
+		if err == nil {
+			return candidate, addr, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+		// Bad credentials would fail on every server.
+		var myErr *mysql.MySQLError
+		if errors.As(err, &myErr) && myErr.Number == 1045 || ctx.Err() != nil {
+			break
+		}
+	}
+	return "", "", errors.Join(errs...)
+}
+
+// mysqlAddrs splits the address list out of a DSN of the form
+// [user[:password]@][net[(addr,addr)]]/dbname[?params]. The driver would take the list
+// for a single host.
+func mysqlAddrs(dsn string) (prefix string, addrs []string, suffix string) {
+	slash := strings.LastIndex(dsn, "/")
+	if slash < 0 {
+		return dsn, nil, ""
+	}
+	head := dsn[:slash]
+	at := strings.LastIndex(head, "@")
+	open := strings.Index(head[at+1:], "(")
+	if open < 0 || !strings.HasSuffix(head, ")") {
+		return dsn, nil, ""
+	}
+	open += at + 1
+	for _, addr := range strings.Split(head[open+1:len(head)-1], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return dsn[:open+1], addrs, dsn[len(head)-1:]
+}
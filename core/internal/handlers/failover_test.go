@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPostgresHostGroups(t *testing.T) {
+	cfg, err := pgx.ParseConfig("host=a,b port=5432,5433 user=app sslmode=prefer target_session_attrs=read-write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := postgresHostGroups(cfg)
+	if len(groups) != 2 || len(groups[0]) != 2 || len(groups[1]) != 2 {
+		t.Fatalf("expected two hosts with a TLS and a plain attempt each, got %d groups", len(groups))
+	}
+	if got := []string{postgresHost(groups[0][0]), postgresHost(groups[1][0])}; !reflect.DeepEqual(got, []string{"a:5432", "b:5433"}) {
+		t.Fatalf("unexpected hosts %v", got)
+	}
+	if cfg.ValidateConnect == nil {
+		t.Fatal("expected target_session_attrs to be checked on every host")
+	}
+}
+
+func TestConnectPostgresTriesEveryHost(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, err := connectPostgres(ctx, "postgres://app@127.0.0.1:1,127.0.0.1:2/app?sslmode=disable&connect_timeout=2")
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") || !strings.Contains(err.Error(), "127.0.0.1:2") {
+		t.Fatalf("expected a failure naming both hosts, got %v", err)
+	}
+}
+
+func TestMySQLFailoverLists(t *testing.T) {
+	prefix, addrs, suffix := mysqlAddrs("app:p@ss(w)/rd@tcp(a:3306, b:3307)/shop?parseTime=true")
+	if prefix != "app:p@ss(w)/rd@tcp(" || !reflect.DeepEqual(addrs, []string{"a:3306", "b:3307"}) || suffix != ")/shop?parseTime=true" {
+		t.Fatalf("unexpected split %q %q %q", prefix, addrs, suffix)
+	}
+	if _, addrs, _ := mysqlAddrs("app@unix(/tmp/mysql.sock)/shop"); !reflect.DeepEqual(addrs, []string{"/tmp/mysql.sock"}) {
+		t.Fatalf("unexpected socket split %q", addrs)
+	}
+
+	dsn, host, err := mysqlFailover(context.Background(), "app@tcp(db:3306)/shop")
+	if err != nil || dsn != "app@tcp(db:3306)/shop" || host != "db:3306" {
+		t.Fatalf("a single server must be used as given, got %q %q %v", dsn, host, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, _, err = mysqlFailover(ctx, "app@tcp(127.0.0.1:1,127.0.0.1:2)/shop?timeout=2s")
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1:") || !strings.Contains(err.Error(), "127.0.0.1:2:") {
+		t.Fatalf("expected a failure naming both servers, got %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/fluxgrid/core/internal/faults"
+)
+
+// faultInjection holds the faults injected into streams, configured with Config.Faults.
+type faultInjection struct {
+	mu   sync.RWMutex
+	plan faults.Plan
+}
+
+var streamFaults = &faultInjection{}
+
+func (f *faultInjection) configure(plan faults.Plan) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.plan = plan
+}
+
+// current returns the plan applied to streams starting now.
+func (f *faultInjection) current() faults.Plan {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.plan
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/faults"
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/replay"
+)
+
+var faultyNumbers = replay.Interaction{
+	SQL:     "SELECT n FROM numbers",
+	Columns: []replay.Column{{Name: "n"}},
+	Rows:    [][]any{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}},
+}
+
+// faultyStream streams faultyNumbers in chunks of two rows under plan, on a core that runs
+// one stream at a time, and returns the notification ending the stream after the chunks
+// it delivered.
+func faultyStream(t *testing.T, plan faults.Plan, options map[string]any) (*matrixClient, int, streamErrorEvent) {
+	t.Helper()
+	c := newMatrixClientWith(t, Config{Faults: plan, Resources: pressure.Limits{MaxStreams: 1}})
+	t.Cleanup(func() { streamFaults.configure(faults.Plan{}) })
+	options["stream"] = map[string]any{"fetchSize": 2, "highWaterMark": 2}
+	replayStream(t, c, faultyNumbers, "off", options)
+
+	chunks := 0
+	for {
+		received := c.await("query.stream.chunk", "query.stream.error", "query.stream.complete")
+		last := received[len(received)-1]
+		switch last.Method {
+		case "query.stream.chunk":
+			chunks++
+			requestID, seq, _ := streamEvent(t, last)
+			c.notify("query.stream.ack", map[string]any{"requestId": requestID, "seq": seq})
+		case "query.stream.error":
+			var event streamErrorEvent
+			if err := json.Unmarshal(last.Params, &event); err != nil {
+				t.Fatal(err)
+			}
+			return c, chunks, event
+		default:
+			t.Fatalf("the stream completed despite %s", plan)
+		}
+	}
+}
+
+// assertStreamReleased checks that the failed stream gave back its slot, so that the next
+// one is accepted.
+func assertStreamReleased(t *testing.T, c *matrixClient) {
+	t.Helper()
+	// The slot is released after the error notification is sent.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rpcErr := c.call("query.execute", map[string]any{
+			"connection": map[string]any{"driver": "replay", "dsn": "missing.json"},
+			"sql":        faultyNumbers.SQL,
+			"options":    map[string]any{"mode": "stream"},
+		}, nil)
+		if rpcErr == nil {
+			c.await("query.stream.error")
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the stream slot was not released: %+v", rpcErr)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFaultDroppedConnectionEndsStream(t *testing.T) {
+	c, chunks, event := faultyStream(t, faults.Plan{DropAfter: 1}, map[string]any{})
+	if chunks != 1 || event.Code != "READ_ERROR" || !event.Fatal || event.Message != faults.ErrConnectionDropped.Error() {
+		t.Fatalf("after %d chunks: %+v", chunks, event)
+	}
+	assertStreamReleased(t, c)
+}
+
+func TestFaultCorruptChunkAbortsStream(t *testing.T) {
+	c, chunks, event := faultyStream(t, faults.Plan{Corrupt: 2}, map[string]any{})
+	if chunks != 1 || event.Code != "STREAM_ABORTED" || !event.Fatal || event.Message != faults.ErrCorruptChunk.Error() {
+		t.Fatalf("after %d chunks: %+v", chunks, event)
+	}
+	assertStreamReleased(t, c)
+}
+
+func TestFaultDelayedAcksTimeOut(t *testing.T) {
+	c, chunks, event := faultyStream(t, faults.Plan{AckDelay: time.Minute}, map[string]any{"timeoutSeconds": 1})
+	if chunks != 1 || event.Code != "ACK_TIMEOUT" || !event.Fatal {
+		t.Fatalf("after %d chunks: %+v", chunks, event)
+	}
+	assertStreamReleased(t, c)
+}
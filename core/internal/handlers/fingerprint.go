@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type sqlFingerprintParams struct {
+	SQL string `json:"sql" jsonschema:"required"`
+}
+
+type sqlFingerprintResult struct {
+	// Fingerprint is what history entries and history.stats group runs by.
+	Fingerprint string `json:"fingerprint"`
+	// Normalized is the statement the fingerprint is computed from: literals and bind
+	// parameters replaced with ?, comments dropped and unquoted words in lower case.
+	Normalized string `json:"normalized"`
+}
+
+// sqlFingerprintHandler identifies a statement the way history does, so that clients
+// can group or deduplicate their own lists of statements consistently with it.
+func sqlFingerprintHandler() rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload sqlFingerprintParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		return sqlFingerprintResult{
+			Fingerprint: rewrite.Fingerprint(payload.SQL),
+			Normalized:  rewrite.Normalize(payload.SQL),
+		}, nil
+	}
+}
@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/fluxgrid/core/internal/history"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const (
+	// historyRuns is how many recent runs are remembered.
+	historyRuns          = 5000
+	defaultHistoryList   = 100
+	defaultSnapshotLimit = 500
+	defaultStatsDays     = 30
+	defaultStatsTop      = 10
+)
+
+func historyStore(stateDir string, planBytes int64) *history.Store {
+	var runs *history.Store
+	if stateDir == "" {
+		runs = history.New("", historyRuns)
+	} else {
+		runs = history.New(filepath.Join(stateDir, "history"), historyRuns)
+	}
+	runs.KeepPlans(planBytes)
+	return runs
+}
+
+// runEntry describes a query.execute run under the SQL as typed, before any rewrite.
+func runEntry(typed string, payload executeParams) history.Entry {
+	return history.Entry{
+		SQL:    typed,
+		Driver: payload.Connection.Driver,
+		Target: connectionTarget(dbConnectionParams{Driver: payload.Connection.Driver, DSN: payload.Connection.DSN}),
+		RanAt:  time.Now().UTC(),
+		Tables: rewrite.Tables(typed),
+
+		Fingerprint: rewrite.Fingerprint(typed),
+	}
+}
+
+// recordFailedRun adds a query.execute run that failed to the history.
+func recordFailedRun(runs *history.Store, typed string, payload executeParams, rpcErr *rpc.Error) {
+	if runs == nil {
+		return
+	}
+	entry := runEntry(typed, payload)
+	entry.Error = rpcErr.Message
+	if detail, ok := rpcErr.Data.(string); ok && detail != "" {
+		entry.Error += ": " + detail
+	}
+	runs.Record(entry)
+}
+
+// recordRun adds a query.execute run to the history, with its plan when one was captured,
+// and pins it with its result when the request asks for it. The full cached result is
+// pinned when the run was cached.
+func recordRun(runs *history.Store, results *resultset.Cache, typed string, payload executeParams, result any, plan *history.Plan) any {
+	r, ok := result.(executeResult)
+	if !ok || runs == nil {
+		return result
+	}
+	entry := runEntry(typed, payload)
+	entry.RowCount = len(r.Rows)
+	entry.ExecutionTimeMs = r.ExecutionTimeMs
+	entry.ResultID = r.ResultID
+	if plan != nil {
+		entry.PlanHash = plan.Hash
+	}
+	entry = runs.Record(entry)
+	r.HistoryID = entry.ID
+	if plan != nil {
+		plan.HistoryID = entry.ID
+		if err := runs.SavePlan(*plan); err != nil {
+			logger := logging.Logger()
+			logger.Warn().Err(err).Str("history_id", entry.ID).Msg("failed to keep query plan")
+		}
+	}
+	if payload.Options.Pin {
+		set := toResultSet(r)
+		if cached, ok := results.Get(r.ResultID); ok && r.ResultID != "" {
+			set = cached
+		}
+		if _, err := runs.Pin(entry.ID, "", set, time.Now().UTC()); err != nil {
+			logger := logging.Logger()
+			logger.Warn().Err(err).Str("history_id", entry.ID).Msg("failed to pin query result")
+		}
+	}
+	return r
+}
+
+// runFingerprint returns the fingerprint of a run, computing it for runs recorded before
+// runs had one.
+func runFingerprint(e history.Entry) string {
+	if e.Fingerprint != "" {
+		return e.Fingerprint
+	}
+	return rewrite.Fingerprint(e.SQL)
+}
+
+func historyError(err error, id string) *rpc.Error {
+	switch {
+	case errors.Is(err, history.ErrNotFound):
+		return &rpc.Error{Code: -32180, Message: "history entry not found", Data: id}
+	case errors.Is(err, history.ErrNotPinned):
+		return &rpc.Error{Code: -32181, Message: "history entry has no snapshot", Data: id}
+	case errors.Is(err, history.ErrNoStorage):
+		return &rpc.Error{Code: -32182, Message: "snapshots need a state directory"}
+	case errors.Is(err, history.ErrNoPlan):
+		return &rpc.Error{Code: -32183, Message: "history entry has no plan", Data: id}
+	default:
+		return &rpc.Error{Code: -32603, Message: "history storage failed", Data: err.Error()}
+	}
+}
+
+type historyListParams struct {
+	Limit  int  `json:"limit"`
+	Pinned bool `json:"pinned"`
+	// Fingerprint lists only the runs of one statement, as sql.fingerprint identifies it.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+type historyListResult struct {
+	Entries []history.Entry `json:"entries"`
+}
+
+func historyListHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		runs := spaces.history(ctx)
+		var payload historyListParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &payload); err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "invalid parameters",
+					Data:    err.Error(),
+				}
+			}
+		}
+		if payload.Limit <= 0 {
+			payload.Limit = defaultHistoryList
+		}
+		if payload.Fingerprint == "" {
+			entries, err := runs.List(payload.Limit, payload.Pinned)
+			if err != nil {
+				return nil, historyError(err, "")
+			}
+			return historyListResult{Entries: entries}, nil
+		}
+		entries, err := runs.List(0, payload.Pinned)
+		if err != nil {
+			return nil, historyError(err, "")
+		}
+		matching := []history.Entry{}
+		for _, e := range entries {
+			if len(matching) < payload.Limit && runFingerprint(e) == payload.Fingerprint {
+				matching = append(matching, e)
+			}
+		}
+		return historyListResult{Entries: matching}, nil
+	}
+}
+
+type historyStatsParams struct {
+	// Days limits the statistics to the runs of the last days; it defaults to 30.
+	Days int `json:"days"`
+	// TimeZone is the IANA zone days and hours are counted in; it defaults to UTC.
+	TimeZone string `json:"timeZone"`
+	// Top bounds the tables, slowest and failing statements listed; it defaults to 10.
+	Top int `json:"top"`
+}
+
+// historyStatsHandler summarizes the recorded runs, so that users can spot the
+// statements and connections that are slow or fail.
+func historyStatsHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		runs := spaces.history(ctx)
+		var payload historyStatsParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &payload); err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "invalid parameters",
+					Data:    err.Error(),
+				}
+			}
+		}
+		if payload.Days <= 0 {
+			payload.Days = defaultStatsDays
+		}
+		if payload.Top <= 0 {
+			payload.Top = defaultStatsTop
+		}
+		loc, err := time.LoadLocation(payload.TimeZone)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "unknown time zone",
+				Data:    payload.TimeZone,
+			}
+		}
+		since := time.Now().In(loc).AddDate(0, 0, -payload.Days)
+		return history.Summarize(runs.Runs(), since, loc, payload.Top), nil
+	}
+}
+
+type historyPinParams struct {
+	HistoryID string `json:"historyId" jsonschema:"required"`
+	Label     string `json:"label,omitempty"`
+}
+
+// historyPinHandler pins a run whose result is still cached. Runs without a cached result
+// can be pinned as they run with options.pin.
+func historyPinHandler(spaces *workspaces, results *resultset.Cache) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		runs := spaces.history(ctx)
+		var payload historyPinParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		entry, err := runs.Get(payload.HistoryID)
+		if err != nil {
+			return nil, historyError(err, payload.HistoryID)
+		}
+		var set resultset.Set
+		if entry.PinnedAt != nil {
+			// Relabelling a pin keeps its snapshot.
+			snap, err := runs.Snapshot(entry.ID)
+			if err != nil {
+				return nil, historyError(err, entry.ID)
+			}
+			set = resultset.Set{Columns: snap.Columns, Rows: snap.Rows}
+		} else {
+			cached, ok := results.Get(entry.ResultID)
+			if entry.ResultID == "" || !ok {
+				return nil, &rpc.Error{
+					Code:    -32062,
+					Message: "the run's result is no longer cached; run it with options.cache or options.pin",
+					Data:    entry.ID,
+				}
+			}
+			set = cached
+		}
+		pinned, err := runs.Pin(entry.ID, payload.Label, set, time.Now().UTC())
+		if err != nil {
+			return nil, historyError(err, entry.ID)
+		}
+		return pinned, nil
+	}
+}
+
+type historyIDParams struct {
+	HistoryID string `json:"historyId" jsonschema:"required"`
+}
+
+type historyUnpinResult struct {
+	Unpinned bool `json:"unpinned"`
+}
+
+func historyUnpinHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		runs := spaces.history(ctx)
+		var payload historyIDParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if err := runs.Unpin(payload.HistoryID); err != nil {
+			return nil, historyError(err, payload.HistoryID)
+		}
+		return historyUnpinResult{Unpinned: true}, nil
+	}
+}
+
+type historySnapshotParams struct {
+	HistoryID string `json:"historyId" jsonschema:"required"`
+	Offset    int    `json:"offset"`
+	Limit     int    `json:"limit"`
+	// Cache loads the whole snapshot into the result cache, so that the result.* methods
+	// can work on it.
+	Cache bool `json:"cache"`
+}
+
+type historySnapshotResult struct {
+	Entry     history.Entry `json:"entry"`
+	Columns   []column      `json:"columns"`
+	Rows      [][]any       `json:"rows"`
+	TotalRows int           `json:"totalRows"`
+	ResultID  string        `json:"resultId,omitempty"`
+}
+
+func historySnapshotHandler(spaces *workspaces, results *resultset.Cache) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		runs := spaces.history(ctx)
+		var payload historySnapshotParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Limit <= 0 {
+			payload.Limit = defaultSnapshotLimit
+		}
+		payload.Offset = max(payload.Offset, 0)
+		snap, err := runs.Snapshot(payload.HistoryID)
+		if err != nil {
+			return nil, historyError(err, payload.HistoryID)
+		}
+		result := historySnapshotResult{
+			Entry:     snap.Entry,
+			Columns:   make([]column, len(snap.Columns)),
+			TotalRows: len(snap.Rows),
+		}
+		for i, col := range snap.Columns {
+			result.Columns[i] = column{Name: col.Name, DataType: col.DataType, Origin: col.Origin}
+		}
+		start := min(payload.Offset, len(snap.Rows))
+		result.Rows = snap.Rows[start:min(start+payload.Limit, len(snap.Rows))]
+		if payload.Cache {
+			result.ResultID = results.Put(resultset.Set{Columns: snap.Columns, Rows: snap.Rows})
+		}
+		return result, nil
+	}
+}
+
+type historyPlanResult struct {
+	Entry history.Entry `json:"entry"`
+	Plan  history.Plan  `json:"plan"`
+	// Previous is the latest earlier run of the same statement on the same target that
+	// has a plan, among the recent runs, so that clients can show how the plan changed.
+	Previous *history.Entry `json:"previous,omitempty"`
+	// Changed reports whether Previous was planned differently.
+	Changed bool `json:"changed"`
+}
+
+// historyPlanHandler returns the plan captured for a run. Plans are captured when the
+// core runs with a plan budget (--history-plans-mb).
+func historyPlanHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		runs := spaces.history(ctx)
+		var payload historyIDParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		entry, err := runs.Get(payload.HistoryID)
+		if err != nil {
+			return nil, historyError(err, payload.HistoryID)
+		}
+		plan, err := runs.Plan(entry.ID)
+		if err != nil {
+			return nil, historyError(err, entry.ID)
+		}
+		result := historyPlanResult{Entry: entry, Plan: plan}
+		for _, run := range runs.Runs() {
+			if run.ID != entry.ID && run.PlanHash != "" && run.SQL == entry.SQL && run.Target == entry.Target && run.RanAt.Before(entry.RanAt) {
+				previous := run
+				result.Previous = &previous
+			}
+		}
+		if result.Previous != nil {
+			result.Changed = result.Previous.PlanHash != entry.PlanHash
+		}
+		return result, nil
+	}
+}
+
+// snapshotSet reads the snapshot of a pinned run for result.compare. Values read back
+// from JSON lose their Go types, so the other side of a comparison goes through
+// sameJSONForm to compare like with like.
+func snapshotSet(runs *history.Store, id string) (resultset.Set, string, *rpc.Error) {
+	snap, err := runs.Snapshot(id)
+	if err != nil {
+		return resultset.Set{}, "", historyError(err, id)
+	}
+	return resultset.Set{Columns: snap.Columns, Rows: snap.Rows}, snap.Entry.SQL, nil
+}
+
+// sameJSONForm returns the rows of set as a snapshot would hold them after a round trip
+// through JSON.
+func sameJSONForm(set resultset.Set) (resultset.Set, error) {
+	data, err := json.Marshal(set.Rows)
+	if err != nil {
+		return set, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var rows [][]any
+	if err := decoder.Decode(&rows); err != nil {
+		return set, err
+	}
+	set.Rows = rows
+	return set, nil
+}
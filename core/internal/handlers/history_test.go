@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/history"
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestPinnedRunComparesWithLaterData(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE prices (sku TEXT, amount INTEGER)",
+		"INSERT INTO prices VALUES ('a', 10), ('b', 20)",
+	)
+	spaces := newWorkspaces(t.TempDir(), nil)
+	results := resultset.NewCache(4, 0)
+	execute := executeHandler(rpc.NewServer(zerolog.Nop()), results, nil, pressure.New(pressure.Limits{}, nil), nil, nil, spaces, 0)
+	call := func(handler rpc.HandlerFunc, params map[string]any) any {
+		t.Helper()
+		raw, _ := json.Marshal(params)
+		result, rpcErr := handler(context.Background(), raw)
+		if rpcErr != nil {
+			t.Fatal(rpcErr)
+		}
+		return result
+	}
+	conn := map[string]any{"driver": "sqlite", "dsn": dsn}
+
+	run := call(execute, map[string]any{
+		"connection": conn,
+		"sql":        "SELECT sku, amount FROM prices ORDER BY sku",
+		"options":    map[string]any{"pin": true},
+	}).(executeResult)
+	if run.HistoryID == "" {
+		t.Fatal("expected the run to be recorded")
+	}
+	call(execute, map[string]any{"connection": conn, "sql": "UPDATE prices SET amount = 25 WHERE sku = 'b'"})
+
+	snap := call(historySnapshotHandler(spaces, results), map[string]any{"historyId": run.HistoryID, "limit": 1, "cache": true}).(historySnapshotResult)
+	if snap.TotalRows != 2 || len(snap.Rows) != 1 || snap.Entry.PinnedAt == nil || snap.ResultID == "" {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+
+	diff := call(resultCompareHandler(executeClassic, spaces), map[string]any{
+		"left":  map[string]any{"historyId": run.HistoryID},
+		"right": map[string]any{"connection": conn},
+		"keys":  []string{"sku"},
+	}).(resultCompareResult)
+	if diff.Summary.Changed != 1 || diff.Summary.Added != 0 || diff.Summary.Removed != 0 {
+		t.Fatalf("summary = %+v", diff.Summary)
+	}
+
+	listed := call(historyListHandler(spaces), map[string]any{"pinned": true}).(historyListResult)
+	if len(listed.Entries) != 1 || listed.Entries[0].ID != run.HistoryID {
+		t.Fatalf("pinned = %+v", listed.Entries)
+	}
+	call(historyUnpinHandler(spaces), map[string]any{"historyId": run.HistoryID})
+	raw, _ := json.Marshal(map[string]any{"historyId": run.HistoryID})
+	if _, rpcErr := historySnapshotHandler(spaces, results)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32181 {
+		t.Fatalf("expected no snapshot after unpinning, got %v", rpcErr)
+	}
+}
+
+func TestPinNeedsACachedResult(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE t (id INTEGER)", "INSERT INTO t VALUES (1)")
+	spaces := newWorkspaces(t.TempDir(), nil)
+	results := resultset.NewCache(4, 0)
+	execute := executeHandler(rpc.NewServer(zerolog.Nop()), results, nil, pressure.New(pressure.Limits{}, nil), nil, nil, spaces, 0)
+	pin := historyPinHandler(spaces, results)
+
+	for _, cache := range []bool{false, true} {
+		params, _ := json.Marshal(map[string]any{
+			"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+			"sql":        "SELECT id FROM t",
+			"options":    map[string]any{"cache": cache},
+		})
+		result, rpcErr := execute(context.Background(), params)
+		if rpcErr != nil {
+			t.Fatal(rpcErr)
+		}
+		params, _ = json.Marshal(map[string]any{"historyId": result.(executeResult).HistoryID, "label": "baseline"})
+		pinned, rpcErr := pin(context.Background(), params)
+		if !cache {
+			if rpcErr == nil || rpcErr.Code != -32062 {
+				t.Fatalf("expected an uncached run to be refused, got %v", rpcErr)
+			}
+			continue
+		}
+		if rpcErr != nil {
+			t.Fatal(rpcErr)
+		}
+		if e := pinned.(history.Entry); e.Label != "baseline" || e.SnapshotRows != 1 {
+			t.Fatalf("pinned = %+v", e)
+		}
+	}
+}
+
+func TestHistoryStatsCountsFailures(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE t (id INTEGER)")
+	spaces := newWorkspaces(t.TempDir(), nil)
+	execute := executeHandler(rpc.NewServer(zerolog.Nop()), resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, spaces, 0)
+	for _, sql := range []string{"SELECT id FROM t", "SELECT id FROM T", "SELECT id FROM missing"} {
+		params, _ := json.Marshal(map[string]any{
+			"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+			"sql":        sql,
+		})
+		execute(context.Background(), params)
+	}
+
+	raw, rpcErr := historyStatsHandler(spaces)(context.Background(), json.RawMessage(`{"timeZone":"UTC"}`))
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	stats := raw.(history.Stats)
+	if stats.Runs != 3 || stats.Failed != 1 || len(stats.Connections) != 1 || stats.Connections[0].Target != dsn {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.Tables[0].Table != "t" || stats.Tables[0].Runs != 2 {
+		t.Fatalf("tables = %+v", stats.Tables)
+	}
+	if len(stats.Failing) != 1 || stats.Failing[0].SQL != "SELECT id FROM missing" || stats.Failing[0].LastError == "" {
+		t.Fatalf("failing = %+v", stats.Failing)
+	}
+	// The two spellings of the first statement share a fingerprint.
+	if len(stats.Slowest) != 1 || stats.Slowest[0].Runs != 2 || stats.Slowest[0].SQL != "SELECT id FROM T" {
+		t.Fatalf("slowest = %+v", stats.Slowest)
+	}
+	params, _ := json.Marshal(historyListParams{Fingerprint: stats.Slowest[0].Fingerprint})
+	raw, rpcErr = historyListHandler(spaces)(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if entries := raw.(historyListResult).Entries; len(entries) != 2 || entries[0].SQL != "SELECT id FROM T" {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	if _, rpcErr := historyStatsHandler(spaces)(context.Background(), json.RawMessage(`{"timeZone":"Mars/Olympus"}`)); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected an unknown zone to be refused, got %v", rpcErr)
+	}
+}
+
+func TestRunsKeepTheirPlans(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE orders (id INTEGER, customer TEXT)")
+	spaces := newWorkspaces(t.TempDir(), nil)
+	spaces.planBytes = 1 << 20
+	execute := executeHandler(rpc.NewServer(zerolog.Nop()), resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, spaces, 0)
+	call := func(handler rpc.HandlerFunc, params map[string]any) (any, *rpc.Error) {
+		raw, _ := json.Marshal(params)
+		return handler(context.Background(), raw)
+	}
+	run := func(sql string) string {
+		t.Helper()
+		result, rpcErr := call(execute, map[string]any{"connection": map[string]any{"driver": "sqlite", "dsn": dsn}, "sql": sql})
+		if rpcErr != nil {
+			t.Fatal(rpcErr)
+		}
+		return result.(executeResult).HistoryID
+	}
+	const query = "SELECT id FROM orders WHERE customer = 'ann'"
+
+	first := run(query)
+	second := run(query)
+	run("CREATE INDEX orders_customer ON orders (customer)")
+	third := run(query)
+
+	result, rpcErr := call(historyPlanHandler(spaces), map[string]any{"historyId": second})
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	plan := result.(historyPlanResult)
+	if plan.Previous == nil || plan.Previous.ID != first || plan.Changed || plan.Plan.Hash == "" {
+		t.Fatalf("second run = %+v", plan)
+	}
+	result, rpcErr = call(historyPlanHandler(spaces), map[string]any{"historyId": third})
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	plan = result.(historyPlanResult)
+	if plan.Previous == nil || plan.Previous.ID != second || !plan.Changed || !strings.Contains(string(plan.Plan.Plan), "orders_customer") {
+		t.Fatalf("run after the index = %+v, plan %s", plan, plan.Plan.Plan)
+	}
+
+	listed, _ := call(historyListHandler(spaces), map[string]any{})
+	var ddlRun history.Entry
+	for _, entry := range listed.(historyListResult).Entries {
+		if strings.HasPrefix(entry.SQL, "CREATE") {
+			ddlRun = entry
+		}
+	}
+	if _, rpcErr := call(historyPlanHandler(spaces), map[string]any{"historyId": ddlRun.ID}); rpcErr == nil || rpcErr.Code != -32183 {
+		t.Fatalf("DDL run plan: %v", rpcErr)
+	}
+	if _, rpcErr := call(planAnalyzeHandler(spaces), map[string]any{"historyId": third}); rpcErr == nil || rpcErr.Message != "plan.analyze reads Postgres plans" {
+		t.Fatalf("analyzing a SQLite plan: %v", rpcErr)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/protocol"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const serverName = "fluxgrid-core"
+
+type initializeResult struct {
+	protocol.Features
+	Server protocol.Peer `json:"server"`
+	// Workspace echoes the workspace the client's state is kept in.
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// clientSession holds the features one client negotiated with core.initialize. Until a
+// client initializes, everything the core offers is allowed so older clients keep working.
+type clientSession struct {
+	mu       sync.RWMutex
+	features *protocol.Features
+	user     string
+	client   string
+	// workspace is the workspace the client named in core.initialize.
+	workspace string
+	// tenant is the tenant the session runs as, whose workspace is the only one it uses.
+	tenant string
+}
+
+type clientSessionKey struct{}
+
+// clientSessionOf returns the negotiated features of the client that ctx belongs to.
+// Outside a connection, as when a handler is called directly, everything is allowed.
+func clientSessionOf(ctx context.Context) *clientSession {
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return &clientSession{}
+	}
+	return client.Value(clientSessionKey{}, func() any {
+		s := &clientSession{tenant: client.Tenant()}
+		client.FilterNotifications(s.allowsNotification)
+		return s
+	}).(*clientSession)
+}
+
+// coreOffer lists what this build of the core supports.
+func coreOffer() protocol.Offer {
+	notifications := make([]string, 0, len(outboundNotifications))
+	for name := range outboundNotifications {
+		notifications = append(notifications, name)
+	}
+	sort.Strings(notifications)
+	return protocol.Offer{
+		StreamEncodings: []string{protocol.CompressionGzip, protocol.CompressionZstd},
+		ChunkLayouts:    []string{protocol.LayoutColumns},
+		Framing:         []string{protocol.FramingNDJSON},
+		Notifications:   notifications,
+	}
+}
+
+func initializeHandler(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+	return clientSessionOf(ctx).initialize(params)
+}
+
+func (s *clientSession) initialize(params json.RawMessage) (any, *rpc.Error) {
+	var hello protocol.ClientHello
+	if err := json.Unmarshal(params, &hello); err != nil {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+
+	if hello.Workspace != "" && !validWorkspace.MatchString(hello.Workspace) {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    "workspace must be 1 to 64 letters, digits, dots, dashes or underscores, starting with a letter or digit",
+		}
+	}
+
+	if s.tenant != "" {
+		if hello.Workspace != "" && hello.Workspace != s.tenant {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    "the workspace of this API key is " + s.tenant,
+			}
+		}
+		hello.Workspace = s.tenant
+	}
+
+	features, err := protocol.Negotiate(hello, coreOffer())
+	if err != nil {
+		code := -32001
+		if errors.Is(err, protocol.ErrNoCommonFraming) {
+			code = -32002
+		}
+		return nil, &rpc.Error{
+			Code:    code,
+			Message: err.Error(),
+			Data: map[string]string{
+				"serverVersion": protocol.Version,
+				"clientVersion": hello.ProtocolVersion,
+			},
+		}
+	}
+
+	s.mu.Lock()
+	s.features = &features
+	s.user, s.client = hello.User, hello.Client.Name
+	if s.tenant == "" {
+		s.workspace = hello.Workspace
+	}
+	s.mu.Unlock()
+
+	return initializeResult{
+		Features:  features,
+		Server:    protocol.Peer{Name: serverName, Version: Version},
+		Workspace: hello.Workspace,
+	}, nil
+}
+
+// identity returns the user and client name declared in core.initialize.
+func (s *clientSession) identity() (user, client string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.user, s.client
+}
+
+// workspaceID returns the workspace declared in core.initialize, or "" for the default.
+// Sessions of a tenant always use the tenant's workspace.
+func (s *clientSession) workspaceID() string {
+	if s.tenant != "" {
+		return tenantWorkspacePrefix + s.tenant
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.workspace
+}
+
+func (s *clientSession) allowsNotification(method string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.features == nil || protocol.Allows(s.features.Notifications, method)
+}
+
+func (s *clientSession) allowsEncoding(codec string) bool {
+	if codec == protocol.CompressionNone {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.features == nil || protocol.Allows(s.features.StreamEncodings, codec)
+}
+
+func (s *clientSession) allowsLayout(layout string) bool {
+	if layout == "" || layout == protocol.LayoutRows {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.features == nil || protocol.Allows(s.features.ChunkLayouts, layout)
+}
+
+// checkStreaming rejects stream mode when the client did not negotiate the stream
+// notifications, the requested chunk compression or the requested chunk layout.
+func (s *clientSession) checkStreaming(codec, layout string) *rpc.Error {
+	for _, method := range []string{"query.stream.start", "query.stream.chunk", "query.stream.complete", "query.stream.error"} {
+		if !s.allowsNotification(method) {
+			return &rpc.Error{
+				Code:    -32003,
+				Message: "streaming requires the client to handle " + method,
+			}
+		}
+	}
+	if !s.allowsEncoding(codec) {
+		return &rpc.Error{
+			Code:    -32003,
+			Message: "stream compression was not negotiated: " + codec,
+		}
+	}
+	if !s.allowsLayout(layout) {
+		return &rpc.Error{
+			Code:    -32003,
+			Message: "stream chunk layout was not negotiated: " + layout,
+		}
+	}
+	return nil
+}
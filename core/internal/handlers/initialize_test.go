@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/rpc/rpctest"
+	"github.com/rs/zerolog"
+)
+
+func TestInitializeNegotiatesFeatures(t *testing.T) {
+	server := rpctest.NewSerialServer(zerolog.Nop())
+	server.Register("core.initialize", initializeHandler)
+	server.Register("probe", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		_ = server.Notify("schema.changed", map[string]any{})
+		_ = server.Notify("job.progress", map[string]any{})
+		return nil, clientSessionOf(ctx).checkStreaming("zstd", "")
+	})
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"core.initialize","params":{"protocolVersion":"2.0"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"core.initialize","params":{"protocolVersion":"1.0","client":{"name":"vscode"},"capabilities":{"streamEncodings":["gzip"],"notifications":["job.progress"]}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"probe"}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	type message struct {
+		Method string            `json:"method"`
+		Result *initializeResult `json:"result"`
+		Error  *rpc.Error        `json:"error"`
+	}
+	var responses []message
+	var notifications []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var decoded message
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("invalid message %s: %v", line, err)
+		}
+		if decoded.Method != "" {
+			notifications = append(notifications, decoded.Method)
+			continue
+		}
+		responses = append(responses, decoded)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("expected 3 responses, got %s", out.String())
+	}
+	if responses[0].Error == nil || responses[0].Error.Code != -32001 {
+		t.Fatalf("expected major version mismatch to be refused, got %+v", responses[0])
+	}
+	result := responses[1].Result
+	if result == nil || result.Framing != "ndjson" || result.Server.Name != serverName {
+		t.Fatalf("unexpected result %+v", responses[1])
+	}
+	if strings.Join(result.StreamEncodings, ",") != "gzip" || strings.Join(result.Notifications, ",") != "job.progress" {
+		t.Fatalf("unexpected negotiated features %+v", result.Features)
+	}
+	if strings.Join(notifications, ",") != "job.progress" {
+		t.Fatalf("expected only negotiated notifications, got %v", notifications)
+	}
+	if responses[2].Error == nil || responses[2].Error.Code != -32003 {
+		t.Fatalf("expected streaming without stream notifications to be refused, got %+v", responses[2])
+	}
+}
+
+func TestSessionRefusesUnnegotiatedLayouts(t *testing.T) {
+	session := &clientSession{}
+	if _, rpcErr := session.initialize(json.RawMessage(`{"protocolVersion":"1.0","capabilities":{"chunkLayouts":[]}}`)); rpcErr != nil {
+		t.Fatalf("initialize failed: %+v", rpcErr)
+	}
+	if rpcErr := session.checkStreaming("", "columns"); rpcErr == nil || rpcErr.Code != -32003 {
+		t.Fatalf("expected the columnar layout to be refused, got %+v", rpcErr)
+	}
+	if rpcErr := session.checkStreaming("", "rows"); rpcErr != nil {
+		t.Fatalf("expected the row layout to be allowed, got %+v", rpcErr)
+	}
+}
+
+func TestSessionAllowsEverythingBeforeInitialize(t *testing.T) {
+	session := clientSessionOf(context.Background())
+	if !session.allowsNotification("schema.changed") || session.checkStreaming("zstd", "columns") != nil {
+		t.Fatal("expected an uninitialized session to allow every feature")
+	}
+	if _, rpcErr := session.initialize(json.RawMessage(`{"protocolVersion":"1.0","capabilities":{"framing":["lsp"]}}`)); rpcErr == nil || rpcErr.Code != -32002 {
+		t.Fatalf("expected framing mismatch to be refused, got %+v", rpcErr)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+
+	"github.com/fluxgrid/core/internal/jobs"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// jobStore returns the job metadata store under stateDir, or nil when persistence is off.
+func jobStore(stateDir string) jobs.Store {
+	if stateDir == "" {
+		return nil
+	}
+	return jobs.NewFileStore(filepath.Join(stateDir, "jobs.json"))
+}
+
+type jobIDParams struct {
+	JobID string `json:"jobId" jsonschema:"required"`
+}
+
+func jobStartHandler(manager *jobs.Manager) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload struct {
+			Kind   string          `json:"kind"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		info, rpcErr := manager.StartAs(tenantOf(ctx), payload.Kind, payload.Params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return info, nil
+	}
+}
+
+// jobKindStartHandler starts a job of a fixed kind, taking the job parameters as the
+// request parameters (for example export.start).
+func jobKindStartHandler(manager *jobs.Manager, kind string) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		info, rpcErr := manager.StartAs(tenantOf(ctx), kind, params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return info, nil
+	}
+}
+
+func parseJobID(params json.RawMessage) (string, *rpc.Error) {
+	var payload jobIDParams
+	if err := json.Unmarshal(params, &payload); err != nil {
+		return "", &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+	return payload.JobID, nil
+}
+
+func jobNotFound(id string) *rpc.Error {
+	return &rpc.Error{
+		Code:    -32083,
+		Message: "job not found",
+		Data:    id,
+	}
+}
+
+func jobStatusHandler(manager *jobs.Manager) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		id, rpcErr := parseJobID(params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		info, ok := manager.Status(id)
+		if !ok || info.Owner != tenantOf(ctx) {
+			return nil, jobNotFound(id)
+		}
+		return info, nil
+	}
+}
+
+func jobCancelHandler(manager *jobs.Manager) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		id, rpcErr := parseJobID(params)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if info, ok := manager.Status(id); ok && info.Owner != tenantOf(ctx) {
+			return nil, jobNotFound(id)
+		}
+		info, cancelled, ok := manager.Cancel(id)
+		if !ok {
+			return nil, jobNotFound(id)
+		}
+		return map[string]any{"jobId": id, "cancelled": cancelled, "state": info.State}, nil
+	}
+}
+
+// jobListHandler lists the jobs of the caller's tenant. A non-empty kind fixes the filter;
+// otherwise the optional "kind" parameter is used.
+func jobListHandler(manager *jobs.Manager, fixedKind string) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		kind := fixedKind
+		if kind == "" && len(params) > 0 {
+			var payload struct {
+				Kind string `json:"kind"`
+			}
+			if err := json.Unmarshal(params, &payload); err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "invalid parameters",
+					Data:    err.Error(),
+				}
+			}
+			kind = payload.Kind
+		}
+		owner := tenantOf(ctx)
+		listed := []jobs.Info{}
+		for _, info := range manager.List(kind) {
+			if info.Owner == owner {
+				listed = append(listed, info)
+			}
+		}
+		return map[string]any{"jobs": listed}, nil
+	}
+}
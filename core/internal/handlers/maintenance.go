@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/jobs"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/maintenance"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const maxMaintenanceTargets = 100
+
+type maintenanceConnectionFactory func(ctx context.Context, dsn string) (maintenance.Conn, func(), error)
+
+type maintenanceRunParams struct {
+	Connection dbConnectionParams   `json:"connection" jsonschema:"required"`
+	Action     string               `json:"action" jsonschema:"required,enum=vacuum|vacuumAnalyze|vacuumFull|analyze|reindex"`
+	Targets    []maintenance.Target `json:"targets" jsonschema:"required"`
+	Options    struct {
+		// ConfirmExclusiveLock acknowledges that vacuumFull and reindex block reads and
+		// writes on each table while they run.
+		ConfirmExclusiveLock bool `json:"confirmExclusiveLock"`
+		// LockTimeoutSeconds bounds the wait for each table lock. Defaults to 5 seconds;
+		// negative waits indefinitely.
+		LockTimeoutSeconds int `json:"lockTimeoutSeconds"`
+	} `json:"options"`
+}
+
+type maintenanceTableResult struct {
+	maintenance.Target
+	DurationMs float64 `json:"durationMs"`
+}
+
+type maintenanceRunResult struct {
+	Action string                   `json:"action"`
+	Tables []maintenanceTableResult `json:"tables"`
+}
+
+type maintenanceFailedData struct {
+	Completed []maintenanceTableResult `json:"completed"`
+	Error     string                   `json:"error"`
+}
+
+func parseMaintenanceRun(params json.RawMessage) (maintenanceRunParams, *rpc.Error) {
+	var payload maintenanceRunParams
+	if err := json.Unmarshal(params, &payload); err != nil {
+		return payload, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+	if payload.Connection.Driver != "postgres" {
+		return payload, &rpc.Error{
+			Code:    -32601,
+			Message: fmt.Sprintf("maintenance not supported for driver: %s", payload.Connection.Driver),
+		}
+	}
+	if len(payload.Targets) == 0 || len(payload.Targets) > maxMaintenanceTargets {
+		return payload, &rpc.Error{
+			Code:    -32602,
+			Message: fmt.Sprintf("between 1 and %d targets are required", maxMaintenanceTargets),
+		}
+	}
+	action := maintenance.Action(payload.Action)
+	for _, target := range payload.Targets {
+		if _, err := maintenance.Statement(action, target); err != nil {
+			return payload, &rpc.Error{
+				Code:    -32602,
+				Message: err.Error(),
+			}
+		}
+	}
+	if action.Exclusive() && !payload.Options.ConfirmExclusiveLock {
+		return payload, &rpc.Error{
+			Code:    -32602,
+			Message: payload.Action + " locks each table against reads and writes; set options.confirmExclusiveLock to run it",
+		}
+	}
+	return payload, nil
+}
+
+// maintenanceJobKind runs VACUUM, ANALYZE and REINDEX on selected tables in the background,
+// reporting the server's own progress views through job.progress.
+func maintenanceJobKind(factory maintenanceConnectionFactory) jobs.Kind {
+	return jobs.Kind{
+		Validate: func(params json.RawMessage) (string, *rpc.Error) {
+			payload, rpcErr := parseMaintenanceRun(params)
+			if rpcErr != nil {
+				return "", rpcErr
+			}
+			if len(payload.Targets) == 1 {
+				return payload.Action + " " + payload.Targets[0].String(), nil
+			}
+			return fmt.Sprintf("%s %d tables", payload.Action, len(payload.Targets)), nil
+		},
+		Run: func(ctx context.Context, params json.RawMessage, report jobs.Reporter) (any, *rpc.Error) {
+			payload, rpcErr := parseMaintenanceRun(params)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			conn, cleanup, err := factory(ctx, payload.Connection.DSN)
+			if err != nil {
+				return nil, connectError(err)
+			}
+			defer cleanup()
+			// Progress is read on a second connection while the first is busy.
+			monitor, cleanupMonitor, err := factory(ctx, payload.Connection.DSN)
+			if err != nil {
+				return nil, connectError(err)
+			}
+			defer cleanupMonitor()
+
+			opts := maintenance.Options{LockTimeout: 5 * time.Second}
+			if payload.Options.LockTimeoutSeconds > 0 {
+				opts.LockTimeout = time.Duration(payload.Options.LockTimeoutSeconds) * time.Second
+			} else if payload.Options.LockTimeoutSeconds < 0 {
+				opts.LockTimeout = 0
+			}
+			action := maintenance.Action(payload.Action)
+			durations, err := maintenance.Run(ctx, conn, monitor, action, payload.Targets, opts, func(p maintenance.Progress) {
+				report(jobs.Progress{Phase: maintenance.Describe(action, p), Done: p.Done, Total: p.Total})
+			})
+
+			tables := make([]maintenanceTableResult, len(durations))
+			for i, d := range durations {
+				tables[i] = maintenanceTableResult{Target: payload.Targets[i], DurationMs: float64(d.Microseconds()) / 1000}
+			}
+			if err != nil {
+				return nil, &rpc.Error{
+					Code:    -32120,
+					Message: "maintenance failed",
+					Data:    maintenanceFailedData{Completed: tables, Error: err.Error()},
+				}
+			}
+			return maintenanceRunResult{Action: payload.Action, Tables: tables}, nil
+		},
+	}
+}
+
+func pgxMaintenanceConnectionFactory(ctx context.Context, dsn string) (maintenance.Conn, func(), error) {
+	conn, _, err := connectPostgres(ctx, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		if cerr := conn.Close(context.Background()); cerr != nil {
+			logger := logging.Logger()
+			logger.Warn().Err(cerr).Msg("failed to close maintenance connection")
+		}
+	}
+	return conn, cleanup, nil
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/maintenance"
+)
+
+func TestMaintenanceJobKindValidation(t *testing.T) {
+	kind := maintenanceJobKind(func(context.Context, string) (maintenance.Conn, func(), error) {
+		t.Fatal("validation must not connect")
+		return nil, nil, nil
+	})
+
+	label, rpcErr := kind.Validate(json.RawMessage(`{"connection":{"driver":"postgres","dsn":"x"},"action":"vacuumAnalyze","targets":[{"schema":"public","table":"orders"}]}`))
+	if rpcErr != nil || label != "vacuumAnalyze public.orders" {
+		t.Fatalf("unexpected label %q, %+v", label, rpcErr)
+	}
+
+	for params, code := range map[string]int{
+		`{"connection":{"driver":"mysql","dsn":"x"},"action":"analyze","targets":[{"table":"t"}]}`:                                              -32601,
+		`{"connection":{"driver":"postgres","dsn":"x"},"action":"analyze","targets":[]}`:                                                        -32602,
+		`{"connection":{"driver":"postgres","dsn":"x"},"action":"drop","targets":[{"table":"t"}]}`:                                              -32602,
+		`{"connection":{"driver":"postgres","dsn":"x"},"action":"reindex","targets":[{"table":"t"}]}`:                                           -32602,
+		`{"connection":{"driver":"postgres","dsn":"x"},"action":"vacuumFull","targets":[{"table":""}],"options":{"confirmExclusiveLock":true}}`: -32602,
+	} {
+		if _, rpcErr := kind.Validate(json.RawMessage(params)); rpcErr == nil || rpcErr.Code != code {
+			t.Errorf("%s: expected code %d, got %+v", params, code, rpcErr)
+		}
+	}
+
+	label, rpcErr = kind.Validate(json.RawMessage(`{"connection":{"driver":"postgres","dsn":"x"},"action":"reindex","targets":[{"table":"a"},{"table":"b"}],"options":{"confirmExclusiveLock":true}}`))
+	if rpcErr != nil || label != "reindex 2 tables" {
+		t.Fatalf("unexpected label %q, %+v", label, rpcErr)
+	}
+}
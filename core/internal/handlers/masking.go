@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// restrictedTag marks connection aliases whose results are masked.
+const restrictedTag = "restricted"
+
+// maskRegistry keeps the masking policy and the connections it applies to, keyed by
+// driver and DSN so that replicas of a restricted alias and handles opened on it are
+// masked as well.
+type maskRegistry struct {
+	mu         sync.RWMutex
+	policy     *masking.Policy
+	restricted map[string]bool
+}
+
+var dataMasks = newMaskRegistry()
+
+func newMaskRegistry() *maskRegistry {
+	return &maskRegistry{restricted: make(map[string]bool)}
+}
+
+func (m *maskRegistry) configure(policy *masking.Policy) {
+	m.mu.Lock()
+	m.policy = policy
+	m.mu.Unlock()
+}
+
+// configured reports whether there is a masking policy to apply.
+func (m *maskRegistry) configured() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.policy != nil
+}
+
+// restrict masks the results of the given DSNs of driver.
+func (m *maskRegistry) restrict(driver string, dsns ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, dsn := range dsns {
+		m.restricted[replicaKey(driver, dsn)] = true
+	}
+}
+
+// policyFor returns the masking policy of conn, or nil when its results are not masked.
+func (m *maskRegistry) policyFor(conn dbConnectionParams) *masking.Policy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.restricted[replicaKey(conn.Driver, conn.DSN)] {
+		return nil
+	}
+	return m.policy
+}
+
+// Restricted reports whether the alias is tagged restricted, so that its results are masked.
+func (a ConnectionAlias) Restricted() bool {
+	return slices.Contains(a.Tags, restrictedTag)
+}
+
+// maskResult masks the rows of an execute result read through conn.
+func maskResult(conn dbConnectionParams, result any) any {
+	r, ok := result.(executeResult)
+	if !ok {
+		return result
+	}
+	r.mask(dataMasks.policyFor(conn))
+	return r
+}
+
+func (r *executeResult) mask(policy *masking.Policy) {
+	if policy == nil {
+		return
+	}
+	columns := make([]masking.Column, len(r.Columns))
+	for i, col := range r.Columns {
+		columns[i] = maskingColumn(col.Name, col.Origin)
+	}
+	r.Masked = maskRows(policy, columns, r.Rows)
+}
+
+func maskRows(policy *masking.Policy, columns []masking.Column, rows [][]any) []string {
+	plan := policy.Plan(columns)
+	for _, row := range rows {
+		plan.Row(row)
+	}
+	return plan.Masked()
+}
+
+func maskingColumn(name string, origin *resultset.ColumnOrigin) masking.Column {
+	col := masking.Column{Name: name}
+	if origin != nil {
+		col.Schema, col.Table, col.Column = origin.Schema, origin.Table, origin.Column
+	}
+	return col
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestRestrictedConnectionsMaskResults(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE people (id INTEGER, email TEXT, note TEXT)",
+		"INSERT INTO people VALUES (1, 'jane@example.com', 'card 4111 1111 1111 1111'), (2, NULL, '078-05-1120')",
+	)
+	policy, err := masking.New(masking.Config{Rules: []masking.Rule{
+		{Column: "email", Action: masking.ActionPartial},
+		{Detect: masking.DetectSSN},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := dataMasks
+	dataMasks = newMaskRegistry()
+	t.Cleanup(func() { dataMasks = saved })
+	dataMasks.configure(policy)
+
+	server := rpc.NewServer(zerolog.Nop())
+	handler := executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, nil, 0)
+	run := func(options map[string]any) (executeResult, *rpc.Error) {
+		params, _ := json.Marshal(map[string]any{
+			"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+			"sql":        "SELECT id, email, note FROM people ORDER BY id",
+			"options":    options,
+		})
+		result, rpcErr := handler(context.Background(), params)
+		if rpcErr != nil {
+			return executeResult{}, rpcErr
+		}
+		return result.(executeResult), nil
+	}
+
+	r, rpcErr := run(nil)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if r.Rows[0][1] != "jane@example.com" || r.Masked != nil {
+		t.Fatalf("unrestricted connections must not be masked: %v", r.Rows)
+	}
+
+	dataMasks.restrict("sqlite", dsn)
+	r, rpcErr = run(map[string]any{"cache": true})
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	want := [][]any{
+		{int64(1), "j***@example.com", "card 4111 1111 1111 1111"},
+		{int64(2), nil, masking.Redacted},
+	}
+	for i := range want {
+		for j := range want[i] {
+			if r.Rows[i][j] != want[i][j] {
+				t.Fatalf("rows = %v, want %v", r.Rows, want)
+			}
+		}
+	}
+	if len(r.Masked) != 2 || r.Masked[0] != "email" || r.Masked[1] != "note" {
+		t.Fatalf("masked = %v", r.Masked)
+	}
+
+	if _, rpcErr := run(map[string]any{"mode": "stream"}); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected streaming to be refused on a restricted connection, got %v", rpcErr)
+	}
+}
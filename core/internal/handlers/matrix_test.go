@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/dbtest"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+// matrixMessage is any message the server writes: a response or a notification.
+type matrixMessage struct {
+	ID     *json.RawMessage `json:"id"`
+	Method string           `json:"method"`
+	Params json.RawMessage  `json:"params"`
+	Result json.RawMessage  `json:"result"`
+	Error  *rpc.Error       `json:"error"`
+}
+
+// matrixClient talks to a fully registered server over pipes, one call at a time, the way
+// an editor does.
+type matrixClient struct {
+	t        *testing.T
+	requests *io.PipeWriter
+	messages chan matrixMessage
+	next     int
+	// notifications holds those received while waiting for responses.
+	notifications []matrixMessage
+}
+
+func newMatrixClient(t *testing.T) *matrixClient {
+	return newMatrixClientWith(t, Config{})
+}
+
+// newMatrixClientWith registers the handlers with cfg, in a state directory of the test.
+func newMatrixClientWith(t *testing.T, cfg Config) *matrixClient {
+	server := rpc.NewServer(zerolog.Nop())
+	cfg.StateDir = t.TempDir()
+	Register(server, cfg)
+	return connectMatrixClient(t, server, "")
+}
+
+// connectMatrixClient opens another connection to server, running as tenant.
+func connectMatrixClient(t *testing.T, server *rpc.Server, tenant string) *matrixClient {
+	requestsIn, requests := io.Pipe()
+	responses, responsesOut := io.Pipe()
+	c := &matrixClient{t: t, requests: requests, messages: make(chan matrixMessage, 64)}
+	go func() {
+		server.ServeAs(tenant, requestsIn, responsesOut)
+		responsesOut.Close()
+	}()
+	go func() {
+		defer close(c.messages)
+		scanner := bufio.NewScanner(responses)
+		scanner.Buffer(make([]byte, 1<<20), 1<<24)
+		for scanner.Scan() {
+			var msg matrixMessage
+			if err := json.Unmarshal(scanner.Bytes(), &msg); err == nil {
+				c.messages <- msg
+			}
+		}
+	}()
+	t.Cleanup(func() { requests.Close() })
+	return c
+}
+
+func (c *matrixClient) receive() matrixMessage {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("the server closed the connection")
+		}
+		return msg
+	case <-time.After(time.Minute):
+		c.t.Fatal("timed out waiting for the server")
+	}
+	return matrixMessage{}
+}
+
+// call sends a request and decodes its result into out, returning the error instead when
+// the call fails.
+func (c *matrixClient) call(method string, params any, out any) *rpc.Error {
+	c.t.Helper()
+	c.next++
+	id := fmt.Sprintf("m%d", c.next)
+	line, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if _, err := c.requests.Write(append(line, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.receive()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, msg)
+			continue
+		}
+		if string(*msg.ID) != `"`+id+`"` {
+			continue
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if out != nil {
+			if err := json.Unmarshal(msg.Result, out); err != nil {
+				c.t.Fatalf("%s result: %v", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+// notify sends a notification.
+func (c *matrixClient) notify(method string, params any) {
+	c.t.Helper()
+	line, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+	if _, err := c.requests.Write(append(line, '\n')); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// mustCall is call for calls that must succeed.
+func (c *matrixClient) mustCall(method string, params any, out any) {
+	c.t.Helper()
+	if rpcErr := c.call(method, params, out); rpcErr != nil {
+		c.t.Fatalf("%s: %+v", method, rpcErr)
+	}
+}
+
+// await returns the notifications received until one of methods arrives, including it.
+func (c *matrixClient) await(methods ...string) []matrixMessage {
+	c.t.Helper()
+	var received []matrixMessage
+	for {
+		var msg matrixMessage
+		if len(c.notifications) > 0 {
+			msg, c.notifications = c.notifications[0], c.notifications[1:]
+		} else {
+			msg = c.receive()
+		}
+		if msg.ID != nil {
+			continue
+		}
+		received = append(received, msg)
+		if slices.Contains(methods, msg.Method) {
+			return received
+		}
+	}
+}
+
+// matrixDrivers are the servers the matrix runs against. Features a driver lacks must be
+// refused with the documented error, not fail in some other way.
+var matrixDrivers = map[string]func(testing.TB) dbtest.Server{
+	"postgres": dbtest.Postgres,
+	"mysql":    dbtest.MySQL,
+}
+
+func TestDriverMatrix(t *testing.T) {
+	for name, start := range matrixDrivers {
+		t.Run(name, func(t *testing.T) {
+			db := start(t)
+			c := newMatrixClient(t)
+			conn := map[string]any{"driver": db.Driver, "dsn": db.DSN}
+			exec := func(sql string, options map[string]any, out any) *rpc.Error {
+				return c.call("query.execute", map[string]any{"connection": conn, "sql": sql, "options": options}, out)
+			}
+
+			for _, sql := range []string{
+				"DROP TABLE IF EXISTS matrix_items",
+				"CREATE TABLE matrix_items (id INTEGER PRIMARY KEY, name VARCHAR(40) NOT NULL, amount DECIMAL(10,2))",
+				"INSERT INTO matrix_items VALUES (1, 'anchor', 10.50), (2, 'bolt', NULL), (3, 'cog', 3.25)",
+			} {
+				if rpcErr := exec(sql, nil, nil); rpcErr != nil {
+					t.Fatalf("%s: %+v", sql, rpcErr)
+				}
+			}
+			t.Cleanup(func() { exec("DROP TABLE matrix_items", nil, nil) })
+
+			var classic executeResult
+			if rpcErr := exec("SELECT id, name, amount FROM matrix_items ORDER BY id", nil, &classic); rpcErr != nil {
+				t.Fatalf("classic: %+v", rpcErr)
+			}
+			if len(classic.Columns) != 3 || classic.Columns[1].Name != "name" || len(classic.Rows) != 3 || classic.Rows[1][1] != "bolt" || classic.Rows[1][2] != nil {
+				t.Fatalf("classic result = %+v", classic)
+			}
+
+			var cached executeResult
+			if rpcErr := exec("SELECT id FROM matrix_items", map[string]any{"cache": true, "maxRows": 1}, &cached); rpcErr != nil {
+				t.Fatalf("cached: %+v", rpcErr)
+			}
+			if cached.ResultID == "" || cached.CachedRows != 3 || len(cached.Rows) != 1 {
+				t.Fatalf("cached result = %+v", cached)
+			}
+
+			var page tablePeekResult
+			c.mustCall("table.peek", map[string]any{
+				"connection": conn,
+				"table":      "matrix_items",
+				"sort":       []map[string]any{{"column": "amount"}},
+				"limit":      2,
+			}, &page)
+			// NULLs sort last on every driver.
+			if !page.HasMore || len(page.Rows) != 2 || fmt.Sprint(page.Rows[0][0]) != "3" {
+				t.Fatalf("peek = %+v", page)
+			}
+
+			// An edit writing the values the row already holds is not a conflict.
+			c.mustCall("data.applyEdits", map[string]any{
+				"connection": conn,
+				"table":      "matrix_items",
+				"edits": []map[string]any{{
+					"op": "update", "key": map[string]any{"id": 1},
+					"values": map[string]any{"name": "anchor"}, "original": map[string]any{"name": "anchor"},
+				}},
+			}, nil)
+
+			if rpcErr := exec("SELECT * FROM matrix_missing", nil, nil); rpcErr == nil || rpcErr.Code != -32011 {
+				t.Fatalf("missing table: %+v", rpcErr)
+			}
+
+			var schemas schemaListResult
+			rpcErr := c.call("schema.list", map[string]any{"connection": conn}, &schemas)
+			switch db.Driver {
+			case "postgres":
+				if rpcErr != nil {
+					t.Fatalf("schema.list: %+v", rpcErr)
+				}
+				found := false
+				for _, s := range schemas.Schemas {
+					for _, table := range s.Tables {
+						found = found || table.Name == "matrix_items" && len(table.Columns) == 3
+					}
+				}
+				if !found {
+					t.Fatalf("schema.list did not list matrix_items: %+v", schemas)
+				}
+			default:
+				if rpcErr == nil || rpcErr.Code != -32601 {
+					t.Fatalf("schema.list: %+v", rpcErr)
+				}
+			}
+
+			rpcErr = exec("SELECT id, name FROM matrix_items ORDER BY id", map[string]any{"mode": "stream"}, nil)
+			switch db.Driver {
+			case "postgres":
+				if rpcErr != nil {
+					t.Fatalf("stream: %+v", rpcErr)
+				}
+				rows := 0
+				for _, msg := range c.await("query.stream.complete", "query.stream.error") {
+					switch msg.Method {
+					case "query.stream.chunk":
+						var chunk streamChunkEvent
+						json.Unmarshal(msg.Params, &chunk)
+						rows += len(chunk.Rows)
+					case "query.stream.error":
+						t.Fatalf("stream failed: %s", msg.Params)
+					}
+				}
+				if rows != 3 {
+					t.Fatalf("streamed %d rows", rows)
+				}
+			default:
+				if rpcErr == nil || rpcErr.Code != -32601 {
+					t.Fatalf("stream: %+v", rpcErr)
+				}
+			}
+		})
+	}
+}
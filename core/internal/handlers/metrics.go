@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type metricsResult struct {
+	Outbound  rpc.OutboundStats `json:"outbound"`
+	Resources pressure.Event    `json:"resources"`
+	// Pools lists the Postgres connection pools used for queries.
+	Pools []pgPoolStats `json:"pools"`
+}
+
+// metricsHandler reports engine internals that help diagnose a slow or stuck client. The
+// outbound queue is the calling client's own; resources and connection pools are
+// process-wide.
+func metricsHandler(guard *pressure.Guard) rpc.HandlerFunc {
+	return func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		result := metricsResult{Resources: guard.Stats(), Pools: postgresPools.stats()}
+		if client, ok := rpc.SessionFromContext(ctx); ok {
+			result.Outbound = client.OutboundStats()
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// callLogging logs every request with its duration; failed requests are logged at warn.
+func callLogging() rpc.Middleware {
+	return rpc.Hooks{
+		After: func(_ context.Context, call rpc.Call, _ any) {
+			logger := logging.Logger()
+			event := logger.Debug()
+			if call.Error != nil {
+				event = logger.Warn().Int("code", call.Error.Code).Str("error", call.Error.Message)
+			}
+			event.
+				Str("method", call.Method).
+				Str("request_id", call.RequestID).
+				Int("params_bytes", call.ParamsSize).
+				Float64("duration_ms", call.Duration.Seconds()*1000).
+				Msg("rpc call finished")
+		},
+	}.Middleware()
+}
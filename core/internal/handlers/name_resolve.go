@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+// withSearchPath sets the Postgres search_path of the sessions opened with dsn, so that
+// a profile can default to its own schemas. An empty path returns dsn unchanged.
+func withSearchPath(dsn string, path []string) string {
+	if len(path) == 0 {
+		return dsn
+	}
+	quoted := make([]string, len(path))
+	for i, schema := range path {
+		quoted[i] = tablequery.Postgres.Quote(schema)
+	}
+	value := strings.Join(quoted, ", ")
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if u, err := url.Parse(dsn); err == nil {
+			query := u.Query()
+			query.Set("search_path", value)
+			u.RawQuery = query.Encode()
+			return u.String()
+		}
+	}
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return strings.TrimSpace(dsn + " search_path='" + value + "'")
+}
+
+type tableResolveParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	// Name is the table name as the user typed it: bare, qualified by schema or database,
+	// and with or without quoted parts.
+	Name    string `json:"name" jsonschema:"required"`
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type tableResolveResult struct {
+	Found bool `json:"found"`
+	// Schema and Table are the resolved names as stored in the catalog, ready for
+	// table.peek and the other table methods.
+	Schema string `json:"schema,omitempty"`
+	Table  string `json:"table,omitempty"`
+	// Kind is table, view, materializedView, foreignTable or partitionedTable.
+	Kind string `json:"kind,omitempty"`
+	// Qualified is the quoted, schema-qualified name.
+	Qualified string `json:"qualified,omitempty"`
+	// SearchPath lists the schemas an unqualified name is looked up in, in order: the
+	// session search_path on Postgres, the current database on MySQL and the attached
+	// databases on SQLite.
+	SearchPath []string `json:"searchPath"`
+}
+
+var pgRelationKinds = map[string]string{
+	"r": "table",
+	"v": "view",
+	"m": "materializedView",
+	"f": "foreignTable",
+	"p": "partitionedTable",
+}
+
+// tableResolveHandler resolves a table name typed by the user to the table it refers to,
+// following the session's search path the way the server would.
+func tableResolveHandler(execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload tableResolveParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if strings.TrimSpace(payload.Name) == "" {
+			return nil, &rpc.Error{Code: -32602, Message: "name is required"}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+
+		var result tableResolveResult
+		var rpcErr *rpc.Error
+		if dialect == tablequery.Postgres {
+			// to_regclass parses the name as typed, folding case and honouring quotes.
+			result, rpcErr = resolvePostgresTable(run, payload.Name)
+		} else {
+			parts, err := splitQualifiedName(payload.Name)
+			if err != nil || len(parts) > 2 {
+				return nil, &rpc.Error{Code: -32602, Message: "invalid table name", Data: payload.Name}
+			}
+			if dialect == tablequery.MySQL {
+				result, rpcErr = resolveMySQLTable(run, parts)
+			} else {
+				result, rpcErr = resolveSQLiteTable(run, parts)
+			}
+		}
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if result.Found {
+			result.Qualified = dialect.Table(result.Schema, result.Table)
+		}
+		return result, nil
+	}
+}
+
+const pgResolveTableSQL = `SELECT n.nspname, c.relname, c.relkind::text
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.oid = to_regclass($1)`
+
+func resolvePostgresTable(run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error), name string) (tableResolveResult, *rpc.Error) {
+	path, rpcErr := run(`SELECT unnest(current_schemas(false))::text`, nil, 1000)
+	if rpcErr != nil {
+		return tableResolveResult{}, rpcErr
+	}
+	result := tableResolveResult{SearchPath: stringColumn(path, 0)}
+	found, rpcErr := run(pgResolveTableSQL, []any{name}, 1)
+	if rpcErr != nil {
+		// A name to_regclass cannot parse, such as one with an unbalanced quote.
+		if rpcErr.Code == -32011 {
+			return tableResolveResult{}, &rpc.Error{Code: -32602, Message: "invalid table name", Data: rpcErr.Data}
+		}
+		return tableResolveResult{}, rpcErr
+	}
+	if len(found.Rows) == 1 {
+		row := found.Rows[0]
+		result.Found = true
+		result.Schema, result.Table = fmt.Sprint(row[0]), fmt.Sprint(row[1])
+		result.Kind = pgRelationKinds[fmt.Sprint(row[2])]
+	}
+	return result, nil
+}
+
+func resolveMySQLTable(run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error), parts []string) (tableResolveResult, *rpc.Error) {
+	current, rpcErr := run(`SELECT DATABASE()`, nil, 1)
+	if rpcErr != nil {
+		return tableResolveResult{}, rpcErr
+	}
+	result := tableResolveResult{SearchPath: stringColumn(current, 0)}
+	schema := ""
+	if len(result.SearchPath) > 0 {
+		schema = result.SearchPath[0]
+	}
+	table := parts[len(parts)-1]
+	if len(parts) == 2 {
+		schema = parts[0]
+	}
+	if schema == "" {
+		return result, nil
+	}
+	found, rpcErr := run(`SELECT table_schema, table_name, table_type FROM information_schema.tables
+WHERE table_schema = ? AND table_name = ?`, []any{schema, table}, 1)
+	if rpcErr != nil {
+		return tableResolveResult{}, rpcErr
+	}
+	if len(found.Rows) == 1 {
+		row := found.Rows[0]
+		result.Found = true
+		result.Schema, result.Table = fmt.Sprint(row[0]), fmt.Sprint(row[1])
+		result.Kind = "table"
+		if fmt.Sprint(row[2]) == "VIEW" {
+			result.Kind = "view"
+		}
+	}
+	return result, nil
+}
+
+func resolveSQLiteTable(run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error), parts []string) (tableResolveResult, *rpc.Error) {
+	databases, rpcErr := run(`SELECT name FROM pragma_database_list ORDER BY seq`, nil, 1000)
+	if rpcErr != nil {
+		return tableResolveResult{}, rpcErr
+	}
+	// SQLite looks unqualified names up in temp first, then main, then attached databases.
+	var path []string
+	for _, name := range stringColumn(databases, 0) {
+		if name == "temp" {
+			path = append([]string{name}, path...)
+		} else {
+			path = append(path, name)
+		}
+	}
+	result := tableResolveResult{SearchPath: path}
+	table := parts[len(parts)-1]
+	candidates := path
+	if len(parts) == 2 {
+		candidates = nil
+		for _, name := range path {
+			if strings.EqualFold(name, parts[0]) {
+				candidates = []string{name}
+			}
+		}
+	}
+	for _, schema := range candidates {
+		found, rpcErr := run(`SELECT name, type FROM `+tablequery.SQLite.Quote(schema)+`.sqlite_master
+WHERE type IN ('table', 'view') AND name = ? COLLATE NOCASE`, []any{table}, 1)
+		if rpcErr != nil {
+			return tableResolveResult{}, rpcErr
+		}
+		if len(found.Rows) == 1 {
+			row := found.Rows[0]
+			result.Found = true
+			result.Schema, result.Table, result.Kind = schema, fmt.Sprint(row[0]), fmt.Sprint(row[1])
+			break
+		}
+	}
+	return result, nil
+}
+
+func stringColumn(result executeResult, i int) []string {
+	values := []string{}
+	for _, row := range result.Rows {
+		if i < len(row) && row[i] != nil {
+			values = append(values, fmt.Sprint(row[i]))
+		}
+	}
+	return values
+}
+
+// splitQualifiedName splits a dotted name into its parts, unquoting parts written in
+// double quotes, backticks or brackets.
+func splitQualifiedName(name string) ([]string, error) {
+	var (
+		parts []string
+		part  strings.Builder
+	)
+	name = strings.TrimSpace(name)
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; c {
+		case '"', '`', '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			for i++; ; i++ {
+				if i >= len(name) {
+					return nil, fmt.Errorf("unterminated quoted name: %s", name)
+				}
+				if name[i] == closing {
+					if closing != ']' && i+1 < len(name) && name[i+1] == closing {
+						part.WriteByte(closing)
+						i++
+						continue
+					}
+					break
+				}
+				part.WriteByte(name[i])
+			}
+		case '.':
+			if part.Len() == 0 {
+				return nil, fmt.Errorf("empty name part: %s", name)
+			}
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+		default:
+			part.WriteByte(c)
+		}
+	}
+	if part.Len() == 0 {
+		return nil, fmt.Errorf("empty name part: %s", name)
+	}
+	return append(parts, strings.TrimSpace(part.String())), nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestWithSearchPathSetsTheSessionSearchPath(t *testing.T) {
+	for _, dsn := range []string{
+		"postgres://app@db.internal/app?sslmode=disable",
+		"host=db.internal user=app dbname=app",
+	} {
+		cfg, err := pgx.ParseConfig(withSearchPath(dsn, []string{"Sales", "public"}))
+		if err != nil {
+			t.Fatalf("%s: %v", dsn, err)
+		}
+		if got := cfg.RuntimeParams["search_path"]; got != `"Sales", "public"` {
+			t.Fatalf("%s: search_path = %q", dsn, got)
+		}
+	}
+	if got := withSearchPath("host=db", nil); got != "host=db" {
+		t.Fatalf("an empty search path must leave the DSN alone, got %s", got)
+	}
+}
+
+func TestSplitQualifiedName(t *testing.T) {
+	cases := map[string][]string{
+		"users":                    {"users"},
+		` app . "Order ""Items"""`: {"app", `Order "Items"`},
+		"`db`.`t.x`":               {"db", "t.x"},
+		"[main].[My Table]":        {"main", "My Table"},
+	}
+	for in, want := range cases {
+		got, err := splitQualifiedName(in)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{`"open`, "a..b", "a."} {
+		if _, err := splitQualifiedName(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestTableResolveFindsTablesAsTyped(t *testing.T) {
+	dsn := searchDB(t, `CREATE TABLE "Users" (id INTEGER)`, `CREATE VIEW active AS SELECT id FROM "Users"`)
+	handler := tableResolveHandler(executeClassic)
+	resolve := func(name string) tableResolveResult {
+		t.Helper()
+		params, _ := json.Marshal(map[string]any{
+			"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+			"name":       name,
+		})
+		result, rpcErr := handler(context.Background(), params)
+		if rpcErr != nil {
+			t.Fatalf("%s: %v", name, rpcErr)
+		}
+		return result.(tableResolveResult)
+	}
+
+	for _, typed := range []string{"users", `main."Users"`, "[USERS]"} {
+		got := resolve(typed)
+		if !got.Found || got.Schema != "main" || got.Table != "Users" || got.Kind != "table" || got.Qualified != `"main"."Users"` {
+			t.Errorf("%s: %+v", typed, got)
+		}
+	}
+	if got := resolve("Active"); !got.Found || got.Kind != "view" || got.Table != "active" {
+		t.Errorf("view: %+v", got)
+	}
+	if got := resolve("missing"); got.Found || len(got.SearchPath) == 0 || got.SearchPath[0] != "main" {
+		t.Errorf("missing: %+v", got)
+	}
+	if got := resolve("other.users"); got.Found {
+		t.Errorf("a table in a database that is not attached must not resolve: %+v", got)
+	}
+}
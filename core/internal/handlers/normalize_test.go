@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestNormalizeValueEncodesPostgresTypes(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		in   any
+		want string
+	}{
+		{pgtype.Interval{Days: 1, Microseconds: 90 * 60_000_000, Valid: true}, `"P1DT1H30M"`},
+		{pgtype.Bits{Bytes: []byte{0xa0}, Len: 4, Valid: true}, `"1010"`},
+		{
+			pgtype.Range[any]{Lower: day, LowerType: pgtype.Inclusive, UpperType: pgtype.Unbounded, Valid: true},
+			`{"lower":"2024-05-01T00:00:00Z","upper":null,"bounds":"[)"}`,
+		},
+		{
+			pgtype.Multirange[pgtype.Range[any]]{{Lower: int32(1), Upper: int32(3), LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive, Valid: true}},
+			`[{"lower":1,"upper":3,"bounds":"[)"}]`,
+		},
+		{json.Number("12.50"), `12.50`},
+	}
+	for _, tc := range cases {
+		encoded, err := json.Marshal(normalizeValue(tc.in))
+		if err != nil {
+			t.Fatalf("%#v: %v", tc.in, err)
+		}
+		if string(encoded) != tc.want {
+			t.Errorf("%#v: got %s, want %s", tc.in, encoded, tc.want)
+		}
+	}
+}
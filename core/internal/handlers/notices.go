@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxStatementNotices bounds the notices kept on one result, since a script may raise one
+// per row. query.notice notifications still carry every notice.
+const maxStatementNotices = 100
+
+// statementNotice is a message the server sent while running a statement: a Postgres
+// NOTICE, WARNING or INFO, such as the output of RAISE NOTICE, or a MySQL warning or note.
+type statementNotice struct {
+	// Severity is the Postgres severity (NOTICE, WARNING, INFO, LOG, DEBUG) or the MySQL
+	// level (Note, Warning, Error).
+	Severity string `json:"severity"`
+	// Code is the SQLSTATE on Postgres and the error number on MySQL.
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Detail  string `json:"detail,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+	// Where is the Postgres context, such as the PL/pgSQL function and line that raised
+	// the notice.
+	Where string `json:"where,omitempty"`
+}
+
+type queryNoticeEvent struct {
+	RequestID string `json:"requestId,omitempty"`
+	// Seq numbers the notices of a statement from 1, counting those left out of the
+	// result.
+	Seq int `json:"seq"`
+	// ElapsedMs is the time since the statement started.
+	ElapsedMs float64 `json:"elapsedMs"`
+	statementNotice
+}
+
+// noticeCollector gathers the notices of one statement for its result and sends each to
+// the client as a query.notice notification as soon as it arrives, so that clients can
+// follow long procedures and DO blocks while they run. The notifications are not tied to
+// the request's response: Postgres notices of a classic query or transaction statement
+// precede it, those of a stream interleave with its chunks. MySQL only reports warnings
+// once the statement has finished.
+type noticeCollector struct {
+	client    *rpc.Session
+	requestID string
+	start     time.Time
+
+	mu      sync.Mutex
+	seq     int
+	notices []statementNotice
+}
+
+func newNoticeCollector(client *rpc.Session, requestID string) *noticeCollector {
+	return &noticeCollector{client: client, requestID: requestID, start: time.Now()}
+}
+
+// noticesFor returns a collector for the request ctx belongs to.
+func noticesFor(ctx context.Context) *noticeCollector {
+	client, _ := rpc.SessionFromContext(ctx)
+	requestID, _ := rpc.RequestIDFromContext(ctx)
+	return newNoticeCollector(client, requestID)
+}
+
+func (c *noticeCollector) add(notice statementNotice) {
+	// The lock is held while sending so that notifications keep the order of the notices.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	if len(c.notices) < maxStatementNotices {
+		c.notices = append(c.notices, notice)
+	}
+	if c.client != nil {
+		_ = c.client.Notify("query.notice", queryNoticeEvent{
+			RequestID:       c.requestID,
+			Seq:             c.seq,
+			ElapsedMs:       time.Since(c.start).Seconds() * 1000,
+			statementNotice: notice,
+		})
+	}
+}
+
+// list returns the notices kept so far, nil when there were none.
+func (c *noticeCollector) list() []statementNotice {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.notices) == 0 {
+		return nil
+	}
+	return append([]statementNotice(nil), c.notices...)
+}
+
+// pgNoticeRoutes sends the notices a Postgres connection receives to the collector of the
+// statement running on it. Pooled connections serve many requests in turn, so the route
+// is set for each statement; notices outside a statement are dropped.
+type pgNoticeRoutes struct {
+	mu     sync.Mutex
+	routes map[*pgconn.PgConn]*noticeCollector
+}
+
+var postgresNotices = &pgNoticeRoutes{routes: make(map[*pgconn.PgConn]*noticeCollector)}
+
+// handle is the OnNotice callback of every Postgres connection the core opens.
+func (r *pgNoticeRoutes) handle(conn *pgconn.PgConn, notice *pgconn.Notice) {
+	r.mu.Lock()
+	collector := r.routes[conn]
+	r.mu.Unlock()
+	if collector == nil {
+		return
+	}
+	collector.add(statementNotice{
+		Severity: notice.Severity,
+		Code:     notice.Code,
+		Message:  notice.Message,
+		Detail:   notice.Detail,
+		Hint:     notice.Hint,
+		Where:    notice.Where,
+	})
+}
+
+// route sends the notices of conn to collector until the returned function is called.
+func (r *pgNoticeRoutes) route(conn *pgconn.PgConn, collector *noticeCollector) func() {
+	r.mu.Lock()
+	r.routes[conn] = collector
+	r.mu.Unlock()
+	return func() {
+		r.mu.Lock()
+		delete(r.routes, conn)
+		r.mu.Unlock()
+	}
+}
+
+// sqlQueryer is the part of *sql.Conn and *sql.Tx that reads warnings.
+type sqlQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// collectMySQLWarnings reads the warnings of the last statement run on conn, which must be
+// the connection it ran on, into collector.
+func collectMySQLWarnings(ctx context.Context, conn sqlQueryer, collector *noticeCollector) error {
+	rows, err := conn.QueryContext(ctx, "SHOW WARNINGS")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			level, message string
+			code           int
+		)
+		if err := rows.Scan(&level, &code, &message); err != nil {
+			return err
+		}
+		collector.add(statementNotice{Severity: level, Code: strconv.Itoa(code), Message: message})
+	}
+	return rows.Err()
+}
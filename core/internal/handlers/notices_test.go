@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/rs/zerolog"
+)
+
+func TestPostgresNoticesGoToTheRunningStatement(t *testing.T) {
+	routes := &pgNoticeRoutes{routes: make(map[*pgconn.PgConn]*noticeCollector)}
+	conn, other := &pgconn.PgConn{}, &pgconn.PgConn{}
+	notices := &noticeCollector{}
+
+	routes.handle(conn, &pgconn.Notice{Severity: "NOTICE", Message: "before"})
+	unroute := routes.route(conn, notices)
+	routes.handle(conn, &pgconn.Notice{Severity: "NOTICE", Code: "00000", Message: "step 1", Where: "PL/pgSQL function f() line 3 at RAISE"})
+	routes.handle(other, &pgconn.Notice{Severity: "WARNING", Message: "elsewhere"})
+	unroute()
+	routes.handle(conn, &pgconn.Notice{Severity: "NOTICE", Message: "after"})
+
+	got := notices.list()
+	want := statementNotice{Severity: "NOTICE", Code: "00000", Message: "step 1", Where: "PL/pgSQL function f() line 3 at RAISE"}
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf("notices = %+v", got)
+	}
+
+	for i := 0; i < maxStatementNotices+10; i++ {
+		notices.add(statementNotice{Severity: "NOTICE", Message: fmt.Sprint(i)})
+	}
+	if n := len(notices.list()); n != maxStatementNotices {
+		t.Fatalf("kept %d notices", n)
+	}
+}
+
+func TestNoticesAreSentWhileTheStatementRuns(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("query.execute", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		notices := noticesFor(ctx)
+		notices.add(statementNotice{Severity: "NOTICE", Message: "step 1"})
+		notices.add(statementNotice{Severity: "NOTICE", Message: "step 2"})
+		return executeResult{Warnings: notices.list()}, nil
+	})
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(`{"jsonrpc":"2.0","id":"run","method":"query.execute"}`), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("output = %s", out.String())
+	}
+	for i, line := range lines[:2] {
+		var notification struct {
+			Method string           `json:"method"`
+			Params queryNoticeEvent `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(line), &notification); err != nil {
+			t.Fatal(err)
+		}
+		if notification.Method != "query.notice" || notification.Params.Seq != i+1 || notification.Params.RequestID == "" ||
+			notification.Params.Message != fmt.Sprintf("step %d", i+1) {
+			t.Fatalf("notification %d = %s", i+1, line)
+		}
+	}
+	if !strings.Contains(lines[2], `"id":"run"`) || !strings.Contains(lines[2], `"warnings":[`) {
+		t.Fatalf("response = %s", lines[2])
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolOptions sizes the Postgres connection pool of a connection profile. Zero values
+// keep pgxpool's defaults.
+type PoolOptions struct {
+	MinConns int32 `json:"minConns,omitempty"`
+	MaxConns int32 `json:"maxConns,omitempty"`
+	// MaxIdleSeconds closes connections left idle for longer.
+	MaxIdleSeconds int `json:"maxIdleSeconds,omitempty"`
+}
+
+// pgResetSession clears what a statement may have changed on a pooled connection, so
+// that the next request sees a fresh session as it did before pooling. It is DISCARD
+// ALL without discarding prepared statements, which pgx caches per connection.
+const pgResetSession = "CLOSE ALL; SET SESSION AUTHORIZATION DEFAULT; RESET ALL; UNLISTEN *; " +
+	"SELECT pg_advisory_unlock_all(); DISCARD TEMP; DISCARD SEQUENCES"
+
+// pgPools keeps a connection pool per Postgres DSN for classic query execution.
+type pgPools struct {
+	mu      sync.Mutex
+	options map[string]PoolOptions
+	pools   map[string]*pgxpool.Pool
+	// prepared tracks the named statements prepared on the pools' connections.
+	prepared *preparedStatements
+}
+
+var postgresPools = newPGPools()
+
+func newPGPools() *pgPools {
+	return &pgPools{
+		options:  make(map[string]PoolOptions),
+		pools:    make(map[string]*pgxpool.Pool),
+		prepared: newPreparedStatements(),
+	}
+}
+
+// configure sets the pool options for dsn. A pool already open with other options is
+// closed once its connections are released, and the next request opens a new one.
+func (p *pgPools) configure(dsn string, opts PoolOptions) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if current, ok := p.options[dsn]; ok && current == opts {
+		return
+	}
+	p.options[dsn] = opts
+	if pool, ok := p.pools[dsn]; ok {
+		delete(p.pools, dsn)
+		go pool.Close()
+	}
+}
+
+// acquire takes a connection from the pool for dsn, opening the pool on first use.
+func (p *pgPools) acquire(ctx context.Context, dsn string) (*pgxpool.Conn, error) {
+	pool, err := p.poolFor(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return pool.Acquire(ctx)
+}
+
+func (p *pgPools) poolFor(dsn string) (*pgxpool.Pool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pool, ok := p.pools[dsn]; ok {
+		return pool, nil
+	}
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	opts := p.options[dsn]
+	if opts.MinConns > 0 {
+		cfg.MinConns = opts.MinConns
+	}
+	if opts.MaxConns > 0 {
+		cfg.MaxConns = opts.MaxConns
+	}
+	if cfg.MinConns > cfg.MaxConns {
+		cfg.MinConns = cfg.MaxConns
+	}
+	if opts.MaxIdleSeconds > 0 {
+		cfg.MaxConnIdleTime = time.Duration(opts.MaxIdleSeconds) * time.Second
+	}
+	cfg.AfterRelease = func(conn *pgx.Conn) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err := conn.PgConn().Exec(ctx, pgResetSession).ReadAll()
+		return err == nil
+	}
+	cfg.BeforeClose = p.prepared.forget
+	cfg.ConnConfig.OnNotice = postgresNotices.handle
+	// Creating the pool connects lazily unless MinConns asks for connections up front.
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.pools[dsn] = pool
+	return pool, nil
+}
+
+// pgPoolStats is a snapshot of one pool for core.metrics.
+type pgPoolStats struct {
+	// Target names the server and database without credentials.
+	Target        string `json:"target"`
+	MinConns      int32  `json:"minConns"`
+	MaxConns      int32  `json:"maxConns"`
+	TotalConns    int32  `json:"totalConns"`
+	AcquiredConns int32  `json:"acquiredConns"`
+	IdleConns     int32  `json:"idleConns"`
+	AcquireCount  int64  `json:"acquireCount"`
+	// WaitCount counts acquires that found no idle connection and had to wait for one
+	// to be opened or released.
+	WaitCount         int64   `json:"waitCount"`
+	AcquireDurationMs float64 `json:"acquireDurationMs"`
+	CanceledAcquires  int64   `json:"canceledAcquires"`
+}
+
+func (p *pgPools) stats() []pgPoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]pgPoolStats, 0, len(p.pools))
+	for dsn, pool := range p.pools {
+		s := pool.Stat()
+		stats = append(stats, pgPoolStats{
+			Target:            connectionTarget(dbConnectionParams{Driver: "postgres", DSN: dsn}),
+			MinConns:          pool.Config().MinConns,
+			MaxConns:          s.MaxConns(),
+			TotalConns:        s.TotalConns(),
+			AcquiredConns:     s.AcquiredConns(),
+			IdleConns:         s.IdleConns(),
+			AcquireCount:      s.AcquireCount(),
+			WaitCount:         s.EmptyAcquireCount(),
+			AcquireDurationMs: s.AcquireDuration().Seconds() * 1000,
+			CanceledAcquires:  s.CanceledAcquireCount(),
+		})
+	}
+	sort.Slice(stats, func(a, b int) bool { return stats[a].Target < stats[b].Target })
+	return stats
+}
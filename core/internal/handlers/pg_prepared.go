@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/tablequery"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxPreparedPerConn bounds the named statements kept on each pooled connection.
+const maxPreparedPerConn = 128
+
+// preparedStatements keeps the named prepared statements that grid operations such as
+// table.peek and data.related reuse on pooled Postgres connections. The statement names
+// are derived from the SQL, so that every connection prepares a given shape under the
+// same name.
+//
+// A statement stops being reused once DDL run through the core touches a table it
+// names. Until then Postgres would refuse to run a SELECT * whose columns changed.
+type preparedStatements struct {
+	mu sync.Mutex
+	// epoch counts the DDL seen per DSN; changed records, per DSN, the epoch at which
+	// each quoted table name last changed.
+	epoch   map[string]uint64
+	changed map[string]map[string]uint64
+
+	conns sync.Map // *pgx.Conn -> *connStatements
+}
+
+// connStatements are the statements prepared on one connection. A pooled connection is
+// used by one request at a time, so they need no lock of their own.
+type connStatements struct {
+	epochs map[string]uint64
+	order  []string
+	failed map[string]bool
+}
+
+func newPreparedStatements() *preparedStatements {
+	return &preparedStatements{epoch: make(map[string]uint64), changed: make(map[string]map[string]uint64)}
+}
+
+// preparedName names the statement for sql.
+func preparedName(sql string) string {
+	sum := sha256.Sum256([]byte(sql))
+	return "fg_" + hex.EncodeToString(sum[:12])
+}
+
+// invalidate records DDL run on dsn, so that statements naming the affected tables are
+// prepared again on their next use.
+func (p *preparedStatements) invalidate(dsn string, objects []ddl.Object) {
+	if len(objects) == 0 {
+		return
+	}
+	dialect, _ := tablequery.ParseDialect("postgres")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.epoch[dsn]++
+	changed := p.changed[dsn]
+	if changed == nil {
+		changed = make(map[string]uint64)
+		p.changed[dsn] = changed
+	}
+	for _, o := range objects {
+		for _, name := range []string{o.Name, o.NewName, o.Table} {
+			if name != "" {
+				changed[dialect.Quote(name)] = p.epoch[dsn]
+			}
+		}
+	}
+}
+
+// current returns the DDL epoch of dsn.
+func (p *preparedStatements) current(dsn string) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.epoch[dsn]
+}
+
+// stale reports whether a table named in sql changed on dsn after epoch. Matching quoted
+// names in the text can only err towards preparing a statement again.
+func (p *preparedStatements) stale(dsn, sql string, epoch uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.epoch[dsn] == epoch {
+		return false
+	}
+	for name, at := range p.changed[dsn] {
+		if at > epoch && strings.Contains(sql, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *preparedStatements) of(conn *pgx.Conn) *connStatements {
+	s, _ := p.conns.LoadOrStore(conn, &connStatements{epochs: make(map[string]uint64), failed: make(map[string]bool)})
+	return s.(*connStatements)
+}
+
+// forget drops what was recorded for a connection that is being closed.
+func (p *preparedStatements) forget(conn *pgx.Conn) {
+	p.conns.Delete(conn)
+}
+
+// query runs sql on conn as a named prepared statement, preparing it on first use and
+// again after its tables changed. The statement outlives the request, so it is prepared
+// without the request's query tag.
+func (p *preparedStatements) query(ctx context.Context, conn *pgx.Conn, dsn, sql string, args ...any) (pgx.Rows, error) {
+	name := preparedName(sql)
+	st := p.of(conn)
+	if epoch, ok := st.epochs[name]; ok && (st.failed[name] || p.stale(dsn, sql, epoch)) {
+		if err := conn.Deallocate(ctx, name); err != nil {
+			// The server may have dropped it already, as after DISCARD ALL; start over.
+			if err := conn.DeallocateAll(ctx); err != nil {
+				return nil, err
+			}
+			st.reset()
+		} else {
+			st.remove(name)
+		}
+	}
+	if _, ok := st.epochs[name]; !ok {
+		epoch := p.current(dsn)
+		if _, err := conn.Prepare(ctx, name, sql); err != nil {
+			return nil, err
+		}
+		if len(st.order) >= maxPreparedPerConn {
+			oldest := st.order[0]
+			if err := conn.Deallocate(ctx, oldest); err != nil {
+				return nil, err
+			}
+			st.remove(oldest)
+		}
+		st.epochs[name] = epoch
+		st.order = append(st.order, name)
+	}
+	return conn.Query(ctx, name, args...)
+}
+
+// failed marks the statement for sql to be prepared again when running it failed because
+// its plan no longer fits the table, as after DDL run outside the core, or because the
+// server no longer has it.
+func (p *preparedStatements) failed(conn *pgx.Conn, sql string, err error) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "0A000" || pgErr.Code == "26000") {
+		st, name := p.of(conn), preparedName(sql)
+		if _, ok := st.epochs[name]; ok {
+			st.failed[name] = true
+		}
+	}
+}
+
+func (s *connStatements) reset() {
+	s.epochs = make(map[string]uint64)
+	s.failed = make(map[string]bool)
+	s.order = nil
+}
+
+func (s *connStatements) remove(name string) {
+	delete(s.epochs, name)
+	delete(s.failed, name)
+	for i, n := range s.order {
+		if n == name {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
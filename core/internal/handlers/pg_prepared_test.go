@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func TestPreparedStatementsGoStaleOnDDLOfTheirTables(t *testing.T) {
+	p := newPreparedStatements()
+	const dsn = "postgres://db/app"
+	peek := `SELECT * FROM "public"."users" LIMIT $1`
+	related := `SELECT * FROM "public"."orders" WHERE "user_id" = $1`
+
+	epoch := p.current(dsn)
+	if preparedName(peek) != preparedName(peek) || preparedName(peek) == preparedName(related) {
+		t.Fatal("statement names must follow the SQL")
+	}
+	p.invalidate(dsn, []ddl.Object{{Action: "alter", Kind: "table", Schema: "public", Name: "users"}})
+	if !p.stale(dsn, peek, epoch) {
+		t.Fatal("expected DDL on users to invalidate its peek")
+	}
+	if p.stale(dsn, related, epoch) {
+		t.Fatal("DDL on users must not invalidate statements on other tables")
+	}
+	if p.stale("postgres://other/app", peek, 0) {
+		t.Fatal("DDL on one connection must not invalidate another's statements")
+	}
+	if p.stale(dsn, peek, p.current(dsn)) {
+		t.Fatal("a statement prepared after the DDL is current")
+	}
+
+	p.invalidate(dsn, []ddl.Object{{Action: "create", Kind: "index", Name: "orders_user", Table: "orders"}})
+	if !p.stale(dsn, related, epoch) {
+		t.Fatal("expected an index on orders to invalidate statements on it")
+	}
+}
+
+func TestTableQueriesArePrepared(t *testing.T) {
+	var prepared bool
+	execute := func(_ context.Context, payload executeParams) (any, *rpc.Error) {
+		prepared = payload.Prepare
+		return executeResult{}, nil
+	}
+	if _, rpcErr := runTableQuery(context.Background(), execute, dbConnectionParams{Driver: "postgres"}, 5, "SELECT 1", nil, 1); rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if !prepared {
+		t.Fatal("expected core-built statements to be prepared")
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/explain"
+	"github.com/fluxgrid/core/internal/history"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// planCaptureTimeout bounds the EXPLAIN run after a statement to capture its plan.
+const planCaptureTimeout = 5 * time.Second
+
+// explainPlan returns the plan the database chooses for the statement of payload, in JSON
+// form, without running it. SQLite's EXPLAIN QUERY PLAN rows become an array of
+// {id, parent, detail} objects.
+func explainPlan(ctx context.Context, payload executeParams) (json.RawMessage, error) {
+	var text string
+	switch payload.Connection.Driver {
+	case "postgres":
+		pooled, err := postgresPools.acquire(ctx, payload.Connection.DSN)
+		if err != nil {
+			return nil, err
+		}
+		defer pooled.Release()
+		if err := pooled.Conn().QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+payload.SQL, payload.Args...).Scan(&text); err != nil {
+			return nil, err
+		}
+	case "mysql":
+		db, err := defaultSQLOpener("mysql")(ctx, payload.Connection.DSN)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		if err := db.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+payload.SQL, payload.Args...).Scan(&text); err != nil {
+			return nil, err
+		}
+	case "sqlite":
+		db, err := defaultSQLOpener("sqlite")(ctx, payload.Connection.DSN)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		rows, err := db.QueryContext(ctx, "EXPLAIN QUERY PLAN "+payload.SQL, payload.Args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		type step struct {
+			ID     int64  `json:"id"`
+			Parent int64  `json:"parent"`
+			Detail string `json:"detail"`
+		}
+		steps := []step{}
+		for rows.Next() {
+			var (
+				s       step
+				notUsed any
+			)
+			if err := rows.Scan(&s.ID, &s.Parent, &notUsed, &s.Detail); err != nil {
+				return nil, err
+			}
+			steps = append(steps, s)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return json.Marshal(steps)
+	default:
+		return nil, fmt.Errorf("driver not supported: %s", payload.Connection.Driver)
+	}
+	if !json.Valid([]byte(text)) {
+		return nil, fmt.Errorf("EXPLAIN returned a plan that is not JSON")
+	}
+	return json.RawMessage(text), nil
+}
+
+// capturePlan explains the statement payload ran, for its history entry. Statements
+// EXPLAIN cannot plan, and plans that fail to capture, are left without one: capturing
+// never fails the run.
+func capturePlan(ctx context.Context, payload executeParams) *history.Plan {
+	if !ddl.Explainable(payload.SQL) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, planCaptureTimeout)
+	defer cancel()
+	plan, err := explainPlan(ctx, payload)
+	if err == nil {
+		var hash string
+		if hash, err = history.PlanHash(plan); err == nil {
+			return &history.Plan{Hash: hash, CapturedAt: time.Now().UTC(), Plan: plan}
+		}
+	}
+	logger := logging.Logger()
+	logger.Debug().Err(err).Str("driver", payload.Connection.Driver).Msg("failed to capture query plan")
+	return nil
+}
+
+type planAnalyzeParams struct {
+	// Plan is the output of EXPLAIN (FORMAT JSON), ideally with ANALYZE and BUFFERS.
+	Plan json.RawMessage `json:"plan,omitempty"`
+	// HistoryID analyzes the plan captured for a run instead.
+	HistoryID string `json:"historyId,omitempty"`
+}
+
+// planAnalyzeHandler annotates a Postgres plan for display: per-node totals, exclusive
+// time and cost, row estimate skew, buffer use and the nodes that deserve attention.
+func planAnalyzeHandler(spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload planAnalyzeParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if (len(payload.Plan) == 0) == (payload.HistoryID == "") {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    "pass either plan or historyId",
+			}
+		}
+		plan := payload.Plan
+		if payload.HistoryID != "" {
+			runs := spaces.history(ctx)
+			entry, err := runs.Get(payload.HistoryID)
+			if err != nil {
+				return nil, historyError(err, payload.HistoryID)
+			}
+			if entry.Driver != "postgres" {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "plan.analyze reads Postgres plans",
+					Data:    "the run used " + entry.Driver,
+				}
+			}
+			captured, err := runs.Plan(entry.ID)
+			if err != nil {
+				return nil, historyError(err, entry.ID)
+			}
+			plan = captured.Plan
+		}
+		analysis, err := explain.Analyze(plan)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		return analysis, nil
+	}
+}
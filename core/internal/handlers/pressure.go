@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const pressureSampleInterval = time.Second
+
+// heavyMethods hold result sets, files or generated data in memory and are refused while
+// the process is over its memory limit.
+var heavyMethods = map[string]bool{
+	"query.execute":     true,
+	"result.compare":    true,
+	"result.pivot":      true,
+	"export.run":        true,
+	"export.start":      true,
+	"export.inferTypes": true,
+	"data.generate":     true,
+	"job.start":         true,
+}
+
+type resourceExhaustedData struct {
+	Code     string `json:"code"`
+	Resource string `json:"resource"`
+	Current  uint64 `json:"current"`
+	Limit    uint64 `json:"limit"`
+}
+
+// resourceCeilings refuses heavy methods while memory is over the configured limit.
+func resourceCeilings(guard *pressure.Guard) rpc.Middleware {
+	return func(method string, next rpc.HandlerFunc) rpc.HandlerFunc {
+		if !heavyMethods[method] {
+			return next
+		}
+		return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+			if err := guard.Admit(); err != nil {
+				return nil, resourceExhausted(err)
+			}
+			return next(ctx, params)
+		}
+	}
+}
+
+func resourceExhausted(err error) *rpc.Error {
+	rpcErr := &rpc.Error{
+		Code:    -32130,
+		Message: err.Error(),
+	}
+	var exhausted *pressure.ExhaustedError
+	if errors.As(err, &exhausted) {
+		rpcErr.Data = resourceExhaustedData{
+			Code:     "RESOURCE_EXHAUSTED",
+			Resource: exhausted.Resource,
+			Current:  exhausted.Current,
+			Limit:    exhausted.Limit,
+		}
+	}
+	return rpcErr
+}
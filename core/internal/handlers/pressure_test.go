@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func TestResourceCeilingsRefuseHeavyMethods(t *testing.T) {
+	guard := pressure.New(pressure.Limits{MaxRSS: 1}, nil)
+	next := func(context.Context, json.RawMessage) (any, *rpc.Error) { return "ok", nil }
+	middleware := resourceCeilings(guard)
+
+	_, rpcErr := middleware("query.execute", next)(context.Background(), nil)
+	if rpcErr == nil || rpcErr.Code != -32130 {
+		t.Fatalf("expected a RESOURCE_EXHAUSTED error, got %+v", rpcErr)
+	}
+	data, ok := rpcErr.Data.(resourceExhaustedData)
+	if !ok || data.Code != "RESOURCE_EXHAUSTED" || data.Resource != pressure.Memory || data.Limit != 1 {
+		t.Fatalf("unexpected error data %+v", rpcErr.Data)
+	}
+
+	if result, rpcErr := middleware("core.ping", next)(context.Background(), nil); rpcErr != nil || result != "ok" {
+		t.Fatalf("expected light methods to pass, got %v %+v", result, rpcErr)
+	}
+}
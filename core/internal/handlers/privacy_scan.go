@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+const (
+	defaultScanRows = 1000
+	maxScanRows     = 10000
+)
+
+type privacyScanParams struct {
+	// ResultID scans a cached result. Otherwise Connection and Table name a table to sample.
+	ResultID   string             `json:"resultId,omitempty"`
+	Connection dbConnectionParams `json:"connection"`
+	Schema     string             `json:"schema,omitempty"`
+	Table      string             `json:"table,omitempty"`
+	// SampleRows bounds the rows inspected.
+	SampleRows int `json:"sampleRows"`
+	Options    struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type privacyScanColumn struct {
+	Name     string                  `json:"name"`
+	Origin   *resultset.ColumnOrigin `json:"origin,omitempty"`
+	Findings []masking.Finding       `json:"findings"`
+}
+
+type privacyScanResult struct {
+	// Columns lists the columns with findings.
+	Columns     []privacyScanColumn `json:"columns"`
+	SampledRows int                 `json:"sampledRows"`
+	// SuggestedRules are masking rules for the confident findings, ready to add to the
+	// masking policy.
+	SuggestedRules  []masking.Rule `json:"suggestedRules"`
+	ExecutionTimeMs float64        `json:"executionTimeMs"`
+}
+
+// privacyScanHandler samples a table or cached result and reports the columns that
+// likely hold personal data.
+func privacyScanHandler(results *resultset.Cache, execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload privacyScanParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.SampleRows <= 0 {
+			payload.SampleRows = defaultScanRows
+		}
+		payload.SampleRows = min(payload.SampleRows, maxScanRows)
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+
+		start := time.Now()
+		var set resultset.Set
+		switch {
+		case payload.ResultID != "":
+			cached, rpcErr := lookupResult(results, payload.ResultID)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			set = cached
+			if len(set.Rows) > payload.SampleRows {
+				set.Rows = set.Rows[:payload.SampleRows]
+			}
+		case payload.Table != "":
+			sampled, rpcErr := sampleTable(ctx, execute, payload)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			set = sampled
+		default:
+			return nil, &rpc.Error{Code: -32602, Message: "privacy.scan requires a resultId, or a connection and table"}
+		}
+
+		result := privacyScanResult{
+			Columns:        []privacyScanColumn{},
+			SampledRows:    len(set.Rows),
+			SuggestedRules: []masking.Rule{},
+		}
+		values := make([]any, len(set.Rows))
+		for i, col := range set.Columns {
+			for r, row := range set.Rows {
+				values[r] = nil
+				if i < len(row) {
+					values[r] = row[i]
+				}
+			}
+			findings := masking.Scan(col.Name, values)
+			if len(findings) == 0 {
+				continue
+			}
+			result.Columns = append(result.Columns, privacyScanColumn{Name: col.Name, Origin: col.Origin, Findings: findings})
+			if rule, ok := masking.Suggest(maskingPattern(col), findings[0]); ok {
+				result.SuggestedRules = append(result.SuggestedRules, rule)
+			}
+		}
+		result.ExecutionTimeMs = time.Since(start).Seconds() * 1000
+		return result, nil
+	}
+}
+
+// sampleTable reads the first rows of a table. Postgres columns report the table as their
+// origin, so that suggested rules name it.
+func sampleTable(ctx context.Context, execute classicExecutor, payload privacyScanParams) (resultset.Set, *rpc.Error) {
+	dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+	if err != nil {
+		return resultset.Set{}, &rpc.Error{Code: -32601, Message: err.Error()}
+	}
+	sql, args, err := tablequery.Build(dialect, tablequery.Request{
+		Schema: payload.Schema,
+		Table:  payload.Table,
+		Limit:  payload.SampleRows,
+	}, nil)
+	if err != nil {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid table request",
+			Data:    err.Error(),
+		}
+	}
+	result, rpcErr := runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, payload.SampleRows)
+	if rpcErr != nil {
+		return resultset.Set{}, rpcErr
+	}
+	set := toResultSet(result)
+	// Masking only knows the tables of Postgres columns, so other drivers' columns are
+	// suggested by name.
+	if dialect != tablequery.Postgres {
+		return set, nil
+	}
+	schema := payload.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	for i := range set.Columns {
+		if set.Columns[i].Origin == nil {
+			set.Columns[i].Origin = &resultset.ColumnOrigin{Schema: schema, Table: payload.Table, Column: set.Columns[i].Name}
+		}
+	}
+	return set, nil
+}
+
+// maskingPattern names a column for a masking rule: by schema, table and column when its
+// origin is known, since masking matches against origins, and by name otherwise.
+func maskingPattern(col resultset.Column) string {
+	if col.Origin == nil || col.Origin.Table == "" {
+		return col.Name
+	}
+	return col.Origin.Schema + "." + col.Origin.Table + "." + col.Origin.Column
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestPrivacyScanFindsPersonalData(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE customers (id INTEGER, email TEXT, phone TEXT, notes TEXT)",
+		"INSERT INTO customers VALUES (1, 'ann@example.com', '+1 415 555 0100', 'called'), (2, 'bo@example.org', '(020) 7946 0958', NULL)",
+	)
+	handler := privacyScanHandler(resultset.NewCache(4, 0), executeClassic)
+	params, _ := json.Marshal(map[string]any{
+		"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+		"table":      "customers",
+	})
+	raw, rpcErr := handler(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	result := raw.(privacyScanResult)
+	if result.SampledRows != 2 || len(result.Columns) != 2 {
+		t.Fatalf("result = %+v", result)
+	}
+	for i, kind := range []string{masking.DetectEmail, masking.DetectPhone} {
+		if f := result.Columns[i].Findings[0]; f.Kind != kind || f.Confidence != 1 {
+			t.Fatalf("column %s: %+v", result.Columns[i].Name, f)
+		}
+	}
+	want := []masking.Rule{{Column: "email", Action: masking.ActionPartial}, {Column: "phone", Action: masking.ActionPartial}}
+	if len(result.SuggestedRules) != 2 || result.SuggestedRules[0] != want[0] || result.SuggestedRules[1] != want[1] {
+		t.Fatalf("suggested = %+v", result.SuggestedRules)
+	}
+	if _, err := masking.New(masking.Config{Rules: result.SuggestedRules}); err != nil {
+		t.Fatalf("suggested rules must form a valid policy: %v", err)
+	}
+
+	if _, rpcErr := handler(context.Background(), json.RawMessage(`{}`)); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected a source to be required, got %v", rpcErr)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// queryProgressInterval is how often a running classic query reports progress. Queries
+// that finish sooner report none.
+const queryProgressInterval = 500 * time.Millisecond
+
+type queryProgressEvent struct {
+	RequestID string  `json:"requestId"`
+	RowsRead  int64   `json:"rowsRead"`
+	ElapsedMs float64 `json:"elapsedMs"`
+}
+
+// queryProgress counts the rows a classic query has read so far.
+type queryProgress struct {
+	rows atomic.Int64
+}
+
+type queryProgressKey struct{}
+
+// withQueryProgress sends query.progress for the request in ctx every interval until stop
+// is called. The notifications are not tied to the request's response, which they
+// precede; stop waits for any notification in progress, so none follows the response.
+func withQueryProgress(ctx context.Context, interval time.Duration) (_ context.Context, stop func()) {
+	requestID, ok := rpc.RequestIDFromContext(ctx)
+	client, hasClient := rpc.SessionFromContext(ctx)
+	if !ok || requestID == "" || !hasClient {
+		return ctx, func() {}
+	}
+
+	progress := &queryProgress{}
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = client.Notify("query.progress", queryProgressEvent{
+					RequestID: requestID,
+					RowsRead:  progress.rows.Load(),
+					ElapsedMs: time.Since(start).Seconds() * 1000,
+				})
+			}
+		}
+	}()
+	return context.WithValue(ctx, queryProgressKey{}, progress), func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// queryProgressOf returns the progress of the query running in ctx, or nil when it does
+// not report any.
+func queryProgressOf(ctx context.Context) *queryProgress {
+	progress, _ := ctx.Value(queryProgressKey{}).(*queryProgress)
+	return progress
+}
+
+func (p *queryProgress) rowRead() {
+	if p != nil {
+		p.rows.Add(1)
+	}
+}
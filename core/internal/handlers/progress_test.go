@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestQueryProgressPrecedesResponse(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("probe", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		ctx, stop := withQueryProgress(ctx, time.Millisecond)
+		defer stop()
+		progress := queryProgressOf(ctx)
+		for i := 0; i < 3; i++ {
+			progress.rowRead()
+		}
+		time.Sleep(20 * time.Millisecond)
+		return "done", nil
+	})
+
+	var out bytes.Buffer
+	input := `{"jsonrpc":"2.0","id":7,"method":"probe"}` + "\n" + `{"jsonrpc":"2.0","method":"probe"}`
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 2 || !strings.Contains(lines[len(lines)-1], `"result":"done"`) {
+		t.Fatalf("expected progress followed by the response, got %v", lines)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		var notification struct {
+			Method string             `json:"method"`
+			Params queryProgressEvent `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(line), &notification); err != nil {
+			t.Fatalf("invalid notification %s: %v", line, err)
+		}
+		if notification.Method != "query.progress" || notification.Params.RequestID != "7" || notification.Params.RowsRead != 3 {
+			t.Fatalf("unexpected progress %s", line)
+		}
+	}
+}
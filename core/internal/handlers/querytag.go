@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type queryTagKey struct{}
+
+// queryTagging prefixes the statements a request executes with a comment identifying the
+// user, the client and the request, so that DBAs can trace them in server logs and
+// pg_stat_statements. The comment is built once per call and applied by tagSQL.
+func queryTagging(enabled bool) rpc.Middleware {
+	return func(_ string, next rpc.HandlerFunc) rpc.HandlerFunc {
+		if !enabled {
+			return next
+		}
+		return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+			return next(context.WithValue(ctx, queryTagKey{}, queryTag(ctx)), params)
+		}
+	}
+}
+
+func queryTag(ctx context.Context) string {
+	var tag strings.Builder
+	tag.WriteString("/* FluxGrid")
+	add := func(key, value string) {
+		if value == "" {
+			return
+		}
+		tag.WriteString(" " + key + "=")
+		tag.WriteString(strings.Map(tagRune, value))
+	}
+	user, client := clientSessionOf(ctx).identity()
+	add("user", user)
+	add("client", client)
+	if requestID, ok := rpc.RequestIDFromContext(ctx); ok {
+		add("requestId", requestID)
+	}
+	tag.WriteString(" */ ")
+	return tag.String()
+}
+
+// tagRune keeps tag values to characters that cannot end the comment or break the line.
+func tagRune(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return r
+	case strings.ContainsRune("._@:-", r):
+		return r
+	default:
+		return '_'
+	}
+}
+
+// tagSQL prefixes sql with the query tag of the call running in ctx, if tagging is on.
+func tagSQL(ctx context.Context, sql string) string {
+	tag, _ := ctx.Value(queryTagKey{}).(string)
+	return tag + sql
+}
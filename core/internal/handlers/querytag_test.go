@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/rpc/rpctest"
+	"github.com/rs/zerolog"
+)
+
+func TestQueryTaggingIdentifiesTheCall(t *testing.T) {
+	for _, tc := range []struct {
+		enabled bool
+		want    string
+	}{
+		{true, `/* FluxGrid user=ann____drop client=vscode requestId=r-1 */ select 1`},
+		{false, `select 1`},
+	} {
+		server := rpctest.NewSerialServer(zerolog.Nop())
+		server.Use(queryTagging(tc.enabled))
+		server.Register("core.initialize", initializeHandler)
+		server.Register("probe", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+			return tagSQL(ctx, "select 1"), nil
+		})
+
+		input := `{"jsonrpc":"2.0","id":1,"method":"core.initialize","params":{"protocolVersion":"1.0","client":{"name":"vscode"},"user":"ann */ drop"}}` + "\n" +
+			`{"jsonrpc":"2.0","id":"r-1","method":"probe"}`
+		var out bytes.Buffer
+		if err := server.Serve(strings.NewReader(input), &out); err != nil {
+			t.Fatalf("Serve returned error: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		var response struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(lines[len(lines)-1]), &response); err != nil {
+			t.Fatalf("invalid response %s: %v", out.String(), err)
+		}
+		if response.Result != tc.want {
+			t.Fatalf("expected %q, got %q", tc.want, response.Result)
+		}
+	}
+}
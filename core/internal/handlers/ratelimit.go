@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/fluxgrid/core/internal/ratelimit"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// RateLimits caps how often expensive methods may run, keyed by method name. Session rules
+// apply to each client connection on its own; profile rules apply to each database
+// (driver and DSN) across all clients, protecting a shared database from runaway
+// automation. Methods without a rule are not limited.
+type RateLimits struct {
+	Session map[string]ratelimit.Rule
+	Profile map[string]ratelimit.Rule
+}
+
+type rateLimitedData struct {
+	Code         string `json:"code"`
+	Method       string `json:"method"`
+	Scope        string `json:"scope"`
+	RetryAfterMs int64  `json:"retryAfterMs"`
+}
+
+type methodLimiters struct {
+	session *ratelimit.Limiter
+	profile *ratelimit.Limiter
+	// tenants are keyed by tenant name.
+	tenants map[string]*ratelimit.Limiter
+}
+
+// rateLimiting rejects calls over the configured limits with a RATE_LIMITED error that
+// tells the client when to retry. The rules of a tenant apply to all its sessions
+// together.
+func rateLimiting(limits RateLimits, tenants map[string]Tenant) rpc.Middleware {
+	byMethod := make(map[string]*methodLimiters)
+	get := func(method string) *methodLimiters {
+		m, ok := byMethod[method]
+		if !ok {
+			m = &methodLimiters{}
+			byMethod[method] = m
+		}
+		return m
+	}
+	for method, rule := range limits.Session {
+		get(method).session = ratelimit.New(rule)
+	}
+	for method, rule := range limits.Profile {
+		get(method).profile = ratelimit.New(rule)
+	}
+	for name, tenant := range tenants {
+		for method, rule := range tenant.rateLimits {
+			m := get(method)
+			if m.tenants == nil {
+				m.tenants = make(map[string]*ratelimit.Limiter)
+			}
+			m.tenants[name] = ratelimit.New(rule)
+		}
+	}
+
+	return func(method string, next rpc.HandlerFunc) rpc.HandlerFunc {
+		limiters, ok := byMethod[method]
+		if !ok {
+			return next
+		}
+		return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+			tenant := tenantOf(ctx)
+			tenantLimiter := limiters.tenants[tenant]
+			if tenantLimiter != nil {
+				if allowed, wait := tenantLimiter.Allow(tenant); !allowed {
+					return nil, rateLimited(method, "tenant", wait)
+				}
+			}
+			refund := func() {
+				if tenantLimiter != nil {
+					tenantLimiter.Refund(tenant)
+				}
+			}
+			var sessionKey string
+			if limiters.session != nil {
+				if client, ok := rpc.SessionFromContext(ctx); ok {
+					sessionKey = client.ID()
+					// Drop the client's bucket once it disconnects.
+					client.Value(limiters, func() any {
+						client.OnClose(func() { limiters.session.Forget(sessionKey) })
+						return struct{}{}
+					})
+					if allowed, wait := limiters.session.Allow(sessionKey); !allowed {
+						refund()
+						return nil, rateLimited(method, "session", wait)
+					}
+				}
+			}
+			if limiters.profile != nil {
+				if profileKey, ok := connectionProfileKey(params); ok {
+					if allowed, wait := limiters.profile.Allow(profileKey); !allowed {
+						if sessionKey != "" {
+							limiters.session.Refund(sessionKey)
+						}
+						refund()
+						return nil, rateLimited(method, "profile", wait)
+					}
+				}
+			}
+			return next(ctx, params)
+		}
+	}
+}
+
+func rateLimited(method, scope string, wait time.Duration) *rpc.Error {
+	return &rpc.Error{
+		Code:    -32100,
+		Message: "rate limit exceeded for " + method,
+		Data: rateLimitedData{
+			Code:         "RATE_LIMITED",
+			Method:       method,
+			Scope:        scope,
+			RetryAfterMs: (wait + time.Millisecond - 1).Milliseconds(),
+		},
+	}
+}
+
+// connectionProfileKey identifies the database a call targets from its connection
+// parameters. The DSN is hashed so that credentials are not kept as map keys.
+func connectionProfileKey(params json.RawMessage) (string, bool) {
+	var payload struct {
+		Connection dbConnectionParams `json:"connection"`
+	}
+	if err := json.Unmarshal(params, &payload); err != nil || payload.Connection.DSN == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(payload.Connection.Driver + "\x00" + payload.Connection.DSN))
+	return hex.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/ratelimit"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/rpc/rpctest"
+	"github.com/rs/zerolog"
+)
+
+func TestRateLimitingBySessionAndProfile(t *testing.T) {
+	server := rpctest.NewSerialServer(zerolog.Nop())
+	server.Use(rateLimiting(RateLimits{
+		Session: map[string]ratelimit.Rule{"query.execute": {Rate: 0.001, Burst: 3}},
+		Profile: map[string]ratelimit.Rule{"query.execute": {Rate: 0.001, Burst: 2}},
+	}, nil))
+	server.Register("query.execute", func(context.Context, json.RawMessage) (any, *rpc.Error) {
+		return "ok", nil
+	})
+	server.Register("core.ping", func(context.Context, json.RawMessage) (any, *rpc.Error) {
+		return "pong", nil
+	})
+
+	call := func(id int, method, dsn string) string {
+		return `{"jsonrpc":"2.0","id":` + string(rune('0'+id)) + `,"method":"` + method +
+			`","params":{"connection":{"driver":"postgres","dsn":"` + dsn + `"}}}`
+	}
+	input := strings.Join([]string{
+		call(1, "query.execute", "db-a"),
+		call(2, "query.execute", "db-a"),
+		call(3, "query.execute", "db-a"), // profile db-a exhausted
+		call(4, "query.execute", "db-b"),
+		call(5, "query.execute", "db-b"), // session exhausted
+		call(6, "core.ping", "db-a"),
+	}, "\n")
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	type response struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Code int             `json:"code"`
+			Data rateLimitedData `json:"data"`
+		} `json:"error"`
+	}
+	var scopes []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var decoded response
+		if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+			t.Fatalf("invalid response %s: %v", line, err)
+		}
+		if decoded.Error == nil {
+			scopes = append(scopes, decoded.Result)
+			continue
+		}
+		data := decoded.Error.Data
+		if decoded.Error.Code != -32100 || data.Code != "RATE_LIMITED" || data.Method != "query.execute" || data.RetryAfterMs <= 0 {
+			t.Fatalf("unexpected rate limit error %s", line)
+		}
+		scopes = append(scopes, data.Scope)
+	}
+	// The profile refusal refunds the session token, so db-b gets one call before the
+	// session's burst of three runs out.
+	if got := strings.Join(scopes, ","); got != "ok,ok,profile,ok,session,pong" {
+		t.Fatalf("unexpected outcomes %s", got)
+	}
+}
@@ -9,34 +9,74 @@ import (
 	"sync"
 	"time"
 
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/faults"
+	"github.com/fluxgrid/core/internal/history"
+	"github.com/fluxgrid/core/internal/jobs"
 	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/pgvalue"
+	"github.com/fluxgrid/core/internal/pressure"
 	"github.com/fluxgrid/core/internal/protocol"
+	"github.com/fluxgrid/core/internal/replay"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rowbuf"
 	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/schema"
+	"github.com/fluxgrid/core/internal/tempstore"
+	"github.com/fluxgrid/core/internal/txjournal"
+	"github.com/fluxgrid/core/internal/uuidfmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const (
-	version = "0.0.1"
-)
+// Version is the version of the core reported to clients.
+const Version = "0.0.1"
 
 type streamSessionState struct {
 	ackCh  chan protocol.StreamAck
 	cancel context.CancelFunc
 }
 
+// streamManager tracks the running streams of one client, so that acks and cancellations
+// only reach that client's streams.
 type streamManager struct {
-	server *rpc.Server
 	mu     sync.RWMutex
 	active map[string]*streamSessionState
 }
 
-func newStreamManager(server *rpc.Server) *streamManager {
+func newStreamManager() *streamManager {
 	return &streamManager{
-		server: server,
 		active: make(map[string]*streamSessionState),
 	}
 }
 
+type streamManagerKey struct{}
+
+// streamsOf returns the stream manager of the client that ctx belongs to. Its streams are
+// cancelled when the client disconnects.
+func streamsOf(ctx context.Context) (*streamManager, bool) {
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return client.Value(streamManagerKey{}, func() any {
+		m := newStreamManager()
+		client.OnClose(m.cancelAll)
+		return m
+	}).(*streamManager), true
+}
+
+// perClient adapts a stream notification handler to the streams of the calling client.
+func perClient(handler func(*streamManager, context.Context, json.RawMessage)) rpc.NotificationFunc {
+	return func(ctx context.Context, raw json.RawMessage) {
+		if m, ok := streamsOf(ctx); ok {
+			handler(m, ctx, raw)
+		}
+	}
+}
+
 func (m *streamManager) register(requestID string, state *streamSessionState) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -49,6 +89,16 @@ func (m *streamManager) unregister(requestID string) {
 	delete(m.active, requestID)
 }
 
+func (m *streamManager) cancelAll() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, state := range m.active {
+		if state.cancel != nil {
+			state.cancel()
+		}
+	}
+}
+
 func (m *streamManager) handleAck(_ context.Context, raw json.RawMessage) {
 	var payload struct {
 		RequestID string `json:"requestId"`
@@ -72,13 +122,21 @@ func (m *streamManager) handleAck(_ context.Context, raw json.RawMessage) {
 		return
 	}
 
-	select {
-	case state.ackCh <- protocol.StreamAck{
+	ack := protocol.StreamAck{
 		RequestID: payload.RequestID,
 		Seq:       payload.Seq,
-	}:
-	default:
 	}
+	deliver := func() {
+		select {
+		case state.ackCh <- ack:
+		default:
+		}
+	}
+	if delay := streamFaults.current().AckDelay; delay > 0 {
+		time.AfterFunc(delay, deliver)
+		return
+	}
+	deliver()
 }
 
 func (m *streamManager) handleCancel(_ context.Context, raw json.RawMessage) {
@@ -108,59 +166,286 @@ func (m *streamManager) handleCancel(_ context.Context, raw json.RawMessage) {
 	}
 }
 
+// Config carries process-level settings for the handlers.
+type Config struct {
+	// StateDir holds persistent engine state such as job metadata and the journal of open
+	// transactions. Empty disables persistence.
+	StateDir string
+	// Temp is the managed temp storage shared by spill buffers and staging files.
+	Temp *tempstore.Store
+	// RateLimits caps how often expensive methods run. The zero value sets no limits.
+	RateLimits RateLimits
+	// RequireConnectionHandles refuses raw DSNs outside connection.open, so that methods
+	// only accept handles returned by it.
+	RequireConnectionHandles bool
+	// DisableQueryTags stops prefixing executed statements with a comment that identifies
+	// the user, client and request.
+	DisableQueryTags bool
+	// MaxResultBytes caps the estimated size of classic query results. Zero uses
+	// defaultMaxResultBytes; negative disables the limit.
+	MaxResultBytes int64
+	// Resources caps memory and concurrent streams. Heavy requests over a limit are
+	// refused with RESOURCE_EXHAUSTED rather than letting the process be OOM-killed.
+	Resources pressure.Limits
+	// ConnectionAliases are named connections clients may use in place of a DSN.
+	ConnectionAliases map[string]ConnectionAlias
+	// Rewriter applies the configured rewrite rules to statements run by query.execute and
+	// tx.execute. Nil runs statements as sent.
+	Rewriter *rewrite.Rewriter
+	// Masking masks the results of connection aliases tagged restricted.
+	Masking *masking.Policy
+	// Tenants are the clients of a core shared over HTTP or gRPC, by name.
+	Tenants map[string]Tenant
+	// HistoryPlanBytes bounds the execution plans captured into the history of each
+	// workspace, one for each query.execute run outside a transaction. Zero captures none.
+	HistoryPlanBytes int64
+	// ReplayRecorder records the classic query.execute runs against real databases into a
+	// fixture for the replay driver. Nil records nothing.
+	ReplayRecorder *replay.Recorder
+	// Faults injects failures into streams, for testing how clients recover. The zero
+	// value injects none.
+	Faults faults.Plan
+}
+
 // Register attaches all handlers to the RPC server.
-func Register(server *rpc.Server) {
-	streams := newStreamManager(server)
+func Register(server *rpc.Server, cfg Config) {
+	results := resultset.NewCache(resultCacheEntries, resultCacheTTL)
+	schemas := schema.NewCache(schemaCacheTTL)
+	schedules := newScheduleManager(executeClassic, nil)
+	jobManager := jobs.NewManager(server, jobs.Options{Store: jobStore(cfg.StateDir)})
+	jobManager.RegisterKind("export", exportJobKind(results, executeClassic))
+	jobManager.RegisterKind("maintenance", maintenanceJobKind(pgxMaintenanceConnectionFactory))
+	serverConns := defaultServerConnections()
+	guard := pressure.New(cfg.Resources, func(event pressure.Event) {
+		logger := logging.Logger()
+		logger.Warn().Str("resource", event.Resource).Str("level", event.Level).
+			Uint64("rssBytes", event.RSSBytes).Int("streams", event.Streams).Msg("resource pressure changed")
+		_ = server.Notify("core.pressure", event)
+	})
+	guard.OnPressure(func() {
+		results.Clear()
+		schemas.Clear()
+	})
+	go guard.Watch(context.Background(), pressureSampleInterval)
+	dataMasks.configure(cfg.Masking)
+	replayFixtures.configure(cfg.ReplayRecorder)
+	streamFaults.configure(cfg.Faults)
+	for _, alias := range cfg.ConnectionAliases {
+		activateConnectionAlias(alias)
+	}
+	for _, tenant := range cfg.Tenants {
+		for _, alias := range tenant.Connections {
+			activateConnectionAlias(alias)
+		}
+	}
+	spaces := newWorkspaces(cfg.StateDir, cfg.ConnectionAliases)
+	spaces.tenants = cfg.Tenants
+	spaces.planBytes = cfg.HistoryPlanBytes
+
+	server.Use(
+		callLogging(),
+		sqliteChangeSettling(),
+		tenantRestrictions(cfg.Tenants),
+		connectionHandleResolution(cfg.RequireConnectionHandles, spaces),
+		rateLimiting(cfg.RateLimits, cfg.Tenants),
+		resourceCeilings(guard),
+		queryTagging(!cfg.DisableQueryTags),
+	)
+	// A later progress report supersedes a dropped one; everything else waits for room.
+	server.SetNotifyPolicy("job.progress", rpc.NotifyDrop)
+	server.SetNotifyPolicy("query.progress", rpc.NotifyDrop)
 
 	server.Register("core.ping", pingHandler)
-	server.Register("query.execute", executeHandler(server, streams))
+	server.Register("core.initialize", initializeHandler)
+	server.Register("core.metrics", metricsHandler(guard))
+	journal := txJournal(cfg.StateDir)
+	execute := executeHandler(server, results, schemas, guard, journal, cfg.Rewriter, spaces, cfg.MaxResultBytes)
+	server.Register("query.execute", execute)
+	server.Register("sandbox.open", sandboxOpenHandler)
+	server.Register("sandbox.execute", sandboxExecuteHandler(execute))
 	server.Register("connect.test", connectTestHandler(defaultConnectionTesters()))
-	server.Register("schema.list", schemaListHandler(defaultSchemaService, pgxConnectionFactory))
+	server.Register("connection.open", connectionOpenHandler)
+	server.Register("connection.close", connectionCloseHandler)
+	server.Register("connection.aliases", connectionAliasesHandler(spaces))
+	server.Register("discover.docker", discoverDockerHandler)
+	server.Register("discover.scan", discoverScanHandler)
+	hostKeys := hostKeyStore(cfg.StateDir)
+	server.Register("ssh.trustHost", sshTrustHostHandler(hostKeys))
+	server.Register("tunnel.open", tunnelOpenHandler(hostKeys))
+	server.Register("tunnel.list", tunnelListHandler(hostKeys))
+	server.Register("tunnel.close", tunnelCloseHandler(hostKeys))
+	server.Register("state.export", stateExportHandler(cfg, spaces, hostKeys))
+	server.Register("state.import", stateImportHandler(cfg, spaces, hostKeys))
+	server.Register("schema.list", schemaListHandler(defaultSchemaService, pgxConnectionFactory, schemas))
+	server.Register("table.peek", tablePeekHandler(executeClassic))
+	server.Register("table.search", tableSearchHandler(executeClassic))
+	server.Register("data.related", dataRelatedHandler(executeClassic))
+	server.Register("table.identity", tableIdentityHandler(executeClassic))
+	server.Register("table.resolve", tableResolveHandler(executeClassic))
+	server.Register("data.applyEdits", dataApplyEditsHandler(executeClassic, runStatements))
+	server.Register("data.bulkEdit", dataBulkEditHandler(executeClassic, runStatements))
+	server.Register("data.import", dataImportHandler(runStatements))
+	server.Register("sequence.list", sequenceListHandler(executeClassic))
+	server.Register("sequence.reset", sequenceResetHandler(executeClassic, runStatements))
+	server.Register("tx.begin", txBeginHandler(journal))
+	server.Register("tx.execute", txExecuteHandler(journal, cfg.Rewriter))
+	server.Register("tx.commit", txFinishHandler(journal, true))
+	server.Register("tx.rollback", txFinishHandler(journal, false))
+	server.Register("tx.recover", txRecoverHandler(journal))
+	server.Register("tx.savepoint", txSavepointHandler(journal, savepointCreate))
+	server.Register("tx.rollbackTo", txSavepointHandler(journal, savepointRollbackTo))
+	server.Register("tx.release", txSavepointHandler(journal, savepointRelease))
+	server.Register("tx.mode", txModeHandler(journal))
+	server.Register("tx.setAutocommit", txSetAutocommitHandler(journal))
 	server.Register("ddl.get", ddlGetHandler(defaultSchemaService, pgxConnectionFactory))
-	server.RegisterNotification("query.cancel", cancelHandler(server))
-	server.RegisterNotification("query.stream.ack", streams.handleAck)
-	server.RegisterNotification("query.stream.cancel", streams.handleCancel)
+	server.Register("server.topQueries", serverTopQueriesHandler(serverConns))
+	server.Register("server.locks", serverLocksHandler(serverConns))
+	server.Register("server.terminate", serverTerminateHandler(serverConns))
+	server.Register("maintenance.run", jobKindStartHandler(jobManager, "maintenance"))
+	server.Register("data.generate", dataGenerateHandler(defaultDataGenService, pgxDataConnectionFactory))
+	server.Register("result.compare", resultCompareHandler(executeClassic, spaces))
+	server.Register("history.list", historyListHandler(spaces))
+	server.Register("history.stats", historyStatsHandler(spaces))
+	server.Register("history.pin", historyPinHandler(spaces, results))
+	server.Register("history.unpin", historyUnpinHandler(spaces))
+	server.Register("history.getSnapshot", historySnapshotHandler(spaces, results))
+	server.Register("history.getPlan", historyPlanHandler(spaces))
+	server.Register("sql.fingerprint", sqlFingerprintHandler())
+	server.Register("plan.analyze", planAnalyzeHandler(spaces))
+	server.Register("advisor.indexes", advisorIndexesHandler(spaces))
+	server.Register("privacy.scan", privacyScanHandler(results, executeClassic))
+	server.Register("result.pivot", resultPivotHandler(results))
+	server.Register("result.search", resultSearchHandler(results))
+	server.Register("result.sort", resultSortHandler(results))
+	server.Register("result.filter", resultFilterHandler(results))
+	server.Register("result.expandJson", resultExpandJSONHandler(results))
+	server.Register("result.copyAs", resultCopyAsHandler(results))
+	server.Register("result.release", resultReleaseHandler(results))
+	server.Register("export.run", exportRunHandler(results, executeClassic))
+	server.Register("export.inferTypes", exportInferTypesHandler(results, executeClassic))
+	server.Register("export.start", jobKindStartHandler(jobManager, "export"))
+	server.Register("export.status", jobStatusHandler(jobManager))
+	server.Register("export.cancel", jobCancelHandler(jobManager))
+	server.Register("export.list", jobListHandler(jobManager, "export"))
+	server.Register("job.start", jobStartHandler(jobManager))
+	server.Register("job.status", jobStatusHandler(jobManager))
+	server.Register("job.cancel", jobCancelHandler(jobManager))
+	server.Register("job.list", jobListHandler(jobManager, ""))
+	server.Register("temp.usage", tempUsageHandler(cfg.Temp))
+	server.Register("query.schedule", schedules.scheduleHandler)
+	server.Register("query.unschedule", schedules.unscheduleHandler)
+	server.Register("query.schedule.list", schedules.listHandler)
+	server.RegisterNotification("query.cancel", cancelHandler)
+	server.RegisterNotification("query.stream.ack", perClient((*streamManager).handleAck))
+	server.RegisterNotification("query.stream.cancel", perClient((*streamManager).handleCancel))
+
+	documentMethods(server)
 }
 
 func pingHandler(_ context.Context, _ json.RawMessage) (any, *rpc.Error) {
 	return map[string]any{
 		"status":  "ok",
-		"version": version,
+		"version": Version,
 		"time":    time.Now().UTC().Format(time.RFC3339Nano),
 	}, nil
 }
 
 type executeParams struct {
 	Connection struct {
-		Driver string `json:"driver"`
-		DSN    string `json:"dsn"`
-	} `json:"connection"`
-	SQL     string `json:"sql"`
+		Driver string `json:"driver" jsonschema:"required,enum=postgres|mysql|sqlite|replay"`
+		DSN    string `json:"dsn" jsonschema:"required"`
+	} `json:"connection" jsonschema:"required"`
+	SQL     string `json:"sql" jsonschema:"required"`
 	Options struct {
 		TimeoutSeconds int    `json:"timeoutSeconds"`
 		MaxRows        int    `json:"maxRows"`
 		Mode           string `json:"mode"`
+		Cache          bool   `json:"cache"`
+		CacheMaxRows   int    `json:"cacheMaxRows"`
+		// MaxResultBytes lowers the size limit for this result. It cannot raise the limit
+		// the core was started with.
+		MaxResultBytes int64 `json:"maxResultBytes"`
 		Stream         struct {
-			HighWaterMark int `json:"highWaterMark"`
-			FetchSize     int `json:"fetchSize"`
+			HighWaterMark int    `json:"highWaterMark"`
+			FetchSize     int    `json:"fetchSize"`
+			Compression   string `json:"compression" jsonschema:"enum=gzip|zstd"`
+			// Layout "columns" sends each chunk as one array per column instead of one
+			// per row, for results too wide to serialize well as rows.
+			Layout string `json:"layout" jsonschema:"enum=rows|columns"`
 		} `json:"stream"`
+		// Charset is the character set MySQL and SQLite text that is not valid UTF-8 is
+		// decoded from, or "raw" to return such text as hex. MySQL defaults to the charset
+		// of the DSN.
+		Charset string `json:"charset"`
+		// SpecialFloats is how NaN and infinite values appear: "tagged" (the default) as
+		// {"$float": "NaN"}, or "null".
+		SpecialFloats string `json:"specialFloats" jsonschema:"enum=tagged|null"`
+		// UUIDFormat is how uuid values appear: canonical "lower" (the default) or
+		// "upper" text, or their 16 "bytes" as hex.
+		UUIDFormat string `json:"uuidFormat" jsonschema:"enum=lower|upper|bytes"`
+		// Route picks the server of a connection with read replicas: "auto" (the
+		// default) sends statements that only read to a replica, "primary" and
+		// "replica" override that.
+		Route string `json:"route" jsonschema:"enum=auto|primary|replica"`
+		// Pin keeps the result as a snapshot of the run, retrievable with
+		// history.getSnapshot. With cache set the whole cached result is kept.
+		Pin bool `json:"pin"`
 	} `json:"options"`
+	// Variables are values of the {{name}} template variables of SQL, over the defaults
+	// of the connection. Variables are bound as parameters, never spliced into the text.
+	Variables map[string]any `json:"variables,omitempty"`
+	// Args are bind arguments for SQL built by the core, such as table.peek filters, and
+	// for template variables. Clients cannot set them.
+	Args []any `json:"-"`
+	// Prepare runs core-built SQL as a named prepared statement reused across requests
+	// on pooled Postgres connections.
+	Prepare bool `json:"-"`
 }
 
 type executeResult struct {
 	Columns         []column        `json:"columns"`
 	Rows            [][]interface{} `json:"rows"`
 	ExecutionTimeMs float64         `json:"executionTimeMs"`
+	Timing          *queryTiming    `json:"timing,omitempty"`
+	ResultID        string          `json:"resultId,omitempty"`
+	CachedRows      int             `json:"cachedRows,omitempty"`
+	// EstimatedBytes is the approximate JSON size of the rows read.
+	EstimatedBytes int64 `json:"estimatedBytes,omitempty"`
+	// Oversized is set when rows were left out because the result grew past the size
+	// limit. Rows holds the rows read up to that point.
+	Oversized *oversizedResult `json:"oversized,omitempty"`
+	// Affected lists the objects changed by DDL statements so clients can refresh only
+	// those schema-tree nodes.
+	Affected []ddl.Object `json:"affected,omitempty"`
+	// Transcoding reports text that was decoded from a legacy charset or could not be.
+	Transcoding *transcodingReport `json:"transcoding,omitempty"`
+	// Transaction reports whether the statement ran in a transaction that is still open.
+	Transaction *txStatus `json:"transaction,omitempty"`
+	// Endpoint reports the server that ran the statement when the connection has read
+	// replicas.
+	Endpoint *queryEndpoint `json:"endpoint,omitempty"`
+	// Rewrite reports the configured rewrite rules that changed the statement.
+	Rewrite *rewriteReport `json:"rewrite,omitempty"`
+	// Masked lists the columns in which values were masked because the connection is
+	// restricted.
+	Masked []string `json:"masked,omitempty"`
+	// HistoryID identifies the run in history.list, for pinning it.
+	HistoryID string `json:"historyId,omitempty"`
+	// Warnings lists the notices and warnings the server sent while running the
+	// statement, such as the output of RAISE NOTICE, up to maxStatementNotices. Each is
+	// also sent as a query.notice notification.
+	Warnings []statementNotice `json:"warnings,omitempty"`
 }
 
 type column struct {
-	Name     string `json:"name"`
-	DataType string `json:"dataType"`
+	Name     string                  `json:"name"`
+	DataType string                  `json:"dataType"`
+	Origin   *resultset.ColumnOrigin `json:"origin,omitempty"`
 }
 
 type connectTestParams struct {
-	Driver  string             `json:"driver"`
-	DSN     string             `json:"dsn"`
+	Driver  string             `json:"driver" jsonschema:"required"`
+	DSN     string             `json:"dsn" jsonschema:"required"`
 	Options connectTestOptions `json:"options"`
 }
 
@@ -175,6 +460,13 @@ type connectTestResult struct {
 	ConnectionInfo map[string]string `json:"connectionInfo,omitempty"`
 }
 
+// connectTestErrorData tells apart failures a client reacts to differently, such as a
+// wrong encryption key.
+type connectTestErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 type connectionTester interface {
 	TestConnection(ctx context.Context, params connectTestParams) (connectTestResult, error)
 }
@@ -191,7 +483,7 @@ func (postgresConnectionTester) TestConnection(ctx context.Context, params conne
 	defer cancel()
 
 	start := time.Now()
-	conn, err := pgx.Connect(timeoutCtx, params.DSN)
+	conn, host, err := connectPostgres(timeoutCtx, params.DSN)
 	if err != nil {
 		return connectTestResult{}, err
 	}
@@ -204,6 +496,7 @@ func (postgresConnectionTester) TestConnection(ctx context.Context, params conne
 
 	info := map[string]string{
 		"backend_pid": strconv.Itoa(int(conn.PgConn().PID())),
+		"host":        host,
 	}
 	if appName := conn.PgConn().ParameterStatus("application_name"); appName != "" {
 		info["application_name"] = appName
@@ -221,10 +514,27 @@ func defaultConnectionTesters() map[string]connectionTester {
 		"postgres": postgresConnectionTester{},
 		"mysql":    newMySQLConnectionTester(),
 		"sqlite":   newSQLiteConnectionTester(),
+		"replay":   replayConnectionTester{},
 	}
 }
 
-func executeHandler(server *rpc.Server, streams *streamManager) rpc.HandlerFunc {
+func executeHandler(
+	server *rpc.Server,
+	results *resultset.Cache,
+	schemas *schema.Cache,
+	guard *pressure.Guard,
+	journal *txjournal.Journal,
+	rewriter *rewrite.Rewriter,
+	spaces *workspaces,
+	maxResultBytes int64,
+) rpc.HandlerFunc {
+	switch {
+	case maxResultBytes == 0:
+		maxResultBytes = defaultMaxResultBytes
+	case maxResultBytes < 0:
+		maxResultBytes = 0
+	}
+
 	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
 		var payload executeParams
 		if len(params) > 0 {
@@ -237,27 +547,6 @@ func executeHandler(server *rpc.Server, streams *streamManager) rpc.HandlerFunc
 			}
 		}
 
-		if payload.SQL == "" {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "SQL is required",
-			}
-		}
-
-		if payload.Connection.Driver == "" {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "driver is required",
-			}
-		}
-
-		if payload.Connection.DSN == "" {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "DSN is required",
-			}
-		}
-
 		if payload.Options.TimeoutSeconds <= 0 {
 			payload.Options.TimeoutSeconds = 30
 		}
@@ -270,23 +559,96 @@ func executeHandler(server *rpc.Server, streams *streamManager) rpc.HandlerFunc
 		if payload.Options.Stream.FetchSize <= 0 {
 			payload.Options.Stream.FetchSize = 256
 		}
+		if payload.Options.MaxResultBytes <= 0 || (maxResultBytes > 0 && payload.Options.MaxResultBytes > maxResultBytes) {
+			payload.Options.MaxResultBytes = maxResultBytes
+		}
+
+		if !resultset.ValidSpecialFloats(payload.Options.SpecialFloats) {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("unsupported specialFloats mode: %s", payload.Options.SpecialFloats),
+			}
+		}
+		if !uuidfmt.Valid(payload.Options.UUIDFormat) {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("unsupported uuidFormat: %s", payload.Options.UUIDFormat),
+			}
+		}
+		switch payload.Options.Route {
+		case "", routeAuto, routePrimary, routeReplica:
+		default:
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("unsupported route: %s", payload.Options.Route),
+			}
+		}
 
 		switch payload.Connection.Driver {
-		case "postgres", "mysql", "sqlite":
+		case "postgres", "mysql", "sqlite", "replay":
 		default:
 			return nil, &rpc.Error{
 				Code:    -32601,
 				Message: fmt.Sprintf("driver not supported: %s", payload.Connection.Driver),
 			}
 		}
+		typed := payload.SQL
+		runs := spaces.history(ctx)
+		rewritten := applyRewrites(rewriter, payload.Connection.Driver, &payload.SQL)
+		if rpcErr := bindTemplateVariables(&payload); rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		if sessions, ok := txSessionsOf(ctx, journal); ok && !sessions.autocommit() {
+			if payload.Options.Mode == "stream" || payload.Options.Cache {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "stream and cache modes are unavailable while autocommit is off",
+				}
+			}
+			result, rpcErr := sessions.executeImplicit(ctx, payload)
+			if rpcErr != nil {
+				recordFailedRun(runs, typed, payload, rpcErr)
+				return nil, rpcErr
+			}
+			publishSchemaChanges(ctx, server, schemas, payload, result)
+			return withRewrite(recordRun(runs, results, typed, payload, result, nil), rewritten), nil
+		}
 
 		if payload.Options.Mode == "stream" {
-			if payload.Connection.Driver != "postgres" {
+			if payload.Options.Pin {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "pin is unavailable in streaming mode",
+				}
+			}
+			if dataMasks.policyFor(dbConnectionParams{Driver: payload.Connection.Driver, DSN: payload.Connection.DSN}) != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "streaming mode is unavailable on restricted connections",
+				}
+			}
+			if payload.Connection.Driver != "postgres" && payload.Connection.Driver != "replay" {
 				return nil, &rpc.Error{
 					Code:    -32601,
 					Message: fmt.Sprintf("streaming mode is not supported for driver: %s", payload.Connection.Driver),
 				}
 			}
+			if !protocol.ValidCompression(payload.Options.Stream.Compression) {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: fmt.Sprintf("unsupported stream compression: %s", payload.Options.Stream.Compression),
+				}
+			}
+			if !protocol.ValidLayout(payload.Options.Stream.Layout) {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: fmt.Sprintf("unsupported stream layout: %s", payload.Options.Stream.Layout),
+				}
+			}
+			if rpcErr := clientSessionOf(ctx).checkStreaming(payload.Options.Stream.Compression, payload.Options.Stream.Layout); rpcErr != nil {
+				return nil, rpcErr
+			}
 			requestID, ok := rpc.RequestIDFromContext(ctx)
 			if !ok || requestID == "" {
 				return nil, &rpc.Error{
@@ -294,23 +656,87 @@ func executeHandler(server *rpc.Server, streams *streamManager) rpc.HandlerFunc
 					Message: "streaming mode requires a request identifier",
 				}
 			}
-			return executeStream(ctx, server, streams, requestID, payload)
+			client, _ := rpc.SessionFromContext(ctx)
+			streams, ok := streamsOf(ctx)
+			if !ok {
+				return nil, &rpc.Error{
+					Code:    -32030,
+					Message: "streaming mode requires a client connection",
+				}
+			}
+			release, err := guard.AcquireStream()
+			if err != nil {
+				return nil, resourceExhausted(err)
+			}
+			stream := executeStream
+			if payload.Connection.Driver == "replay" {
+				stream = executeReplayStream
+			}
+			result, rpcErr := stream(ctx, client, streams, requestID, payload, release)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			return withRewrite(result, rewritten), nil
 		}
 
-		switch payload.Connection.Driver {
-		case "postgres":
-			return executeClassicPostgres(ctx, payload)
-		case "mysql":
-			return executeClassicSQL(ctx, payload, "mysql", defaultSQLOpener("mysql"))
-		case "sqlite":
-			return executeClassicSQL(ctx, payload, "sqlite", defaultSQLOpener("sqlite"))
-		default:
-			return nil, &rpc.Error{
-				Code:    -32601,
-				Message: fmt.Sprintf("driver not supported: %s", payload.Connection.Driver),
-			}
+		ctx, stopProgress := withQueryProgress(ctx, queryProgressInterval)
+		defer stopProgress()
+		var (
+			result any
+			rpcErr *rpc.Error
+		)
+		if payload.Options.Cache {
+			result, rpcErr = executeRouted(ctx, payload, func(ctx context.Context, payload executeParams) (any, *rpc.Error) {
+				return executeCached(ctx, results, payload)
+			})
+		} else {
+			result, rpcErr = executeRouted(ctx, payload, executeClassic)
+			replayFixtures.record(payload, result, rpcErr)
+		}
+		if rpcErr != nil {
+			recordFailedRun(runs, typed, payload, rpcErr)
+			return nil, rpcErr
+		}
+		if r, ok := result.(executeResult); ok {
+			r.Transaction = &txStatus{Autocommit: true}
+			result = r
+		}
+
+		publishSchemaChanges(ctx, server, schemas, payload, result)
+		var plan *history.Plan
+		if spaces.capturesPlans() {
+			plan = capturePlan(ctx, payload)
+		}
+		return withRewrite(recordRun(runs, results, typed, payload, result, plan), rewritten), nil
+	}
+}
+
+// executeClassic runs the statement in non-streaming mode using the driver named in the
+// payload. Results of restricted connections are masked.
+func executeClassic(ctx context.Context, payload executeParams) (any, *rpc.Error) {
+	var (
+		result any
+		rpcErr *rpc.Error
+	)
+	switch payload.Connection.Driver {
+	case "postgres":
+		result, rpcErr = executeClassicPostgres(ctx, payload)
+	case "mysql":
+		result, rpcErr = executeClassicSQL(ctx, payload, "mysql", defaultSQLOpener("mysql"))
+	case "sqlite":
+		result, rpcErr = executeClassicSQL(ctx, payload, "sqlite", defaultSQLOpener("sqlite"))
+	case "replay":
+		result, rpcErr = executeClassicSQL(ctx, payload, "replay", defaultSQLOpener("replay"))
+	default:
+		return nil, &rpc.Error{
+			Code:    -32601,
+			Message: fmt.Sprintf("driver not supported: %s", payload.Connection.Driver),
 		}
 	}
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	return maskResult(dbConnectionParams{Driver: payload.Connection.Driver, DSN: payload.Connection.DSN}, result), nil
 }
 
 func executeClassicPostgres(ctx context.Context, payload executeParams) (any, *rpc.Error) {
@@ -319,8 +745,9 @@ func executeClassicPostgres(ctx context.Context, payload executeParams) (any, *r
 
 	logger := logging.Logger()
 	start := time.Now()
+	timer := newQueryTimer()
 
-	conn, err := pgx.Connect(timeoutCtx, payload.Connection.DSN)
+	pooled, err := postgresPools.acquire(timeoutCtx, payload.Connection.DSN)
 	if err != nil {
 		return nil, &rpc.Error{
 			Code:    -32010,
@@ -328,10 +755,22 @@ func executeClassicPostgres(ctx context.Context, payload executeParams) (any, *r
 			Data:    err.Error(),
 		}
 	}
-	defer conn.Close(context.Background())
-
-	rows, err := conn.Query(timeoutCtx, payload.SQL)
+	defer pooled.Release()
+	conn := pooled.Conn()
+	timer.connected()
+	notices := noticesFor(ctx)
+	defer postgresNotices.route(conn.PgConn(), notices)()
+
+	var rows pgx.Rows
+	if payload.Prepare {
+		rows, err = postgresPools.prepared.query(timeoutCtx, conn, payload.Connection.DSN, payload.SQL, payload.Args...)
+	} else {
+		rows, err = conn.Query(timeoutCtx, tagSQL(ctx, payload.SQL), payload.Args...)
+	}
 	if err != nil {
+		if payload.Prepare {
+			postgresPools.prepared.failed(conn, payload.SQL, err)
+		}
 		return nil, &rpc.Error{
 			Code:    -32011,
 			Message: "query execution failed",
@@ -350,16 +789,22 @@ func executeClassicPostgres(ctx context.Context, payload executeParams) (any, *r
 	}
 
 	var (
-		resultRows [][]interface{}
+		resultRows = make([][]interface{}, 0, min(payload.Options.MaxRows, classicBlockRows))
 		rowCount   int
+		progress   = queryProgressOf(ctx)
+		size       = newResultSize(payload.Options.MaxResultBytes)
+		cells      = rowbuf.NewBatch(len(fields), classicBlockRows)
+		decoder    = rowbuf.NewDecoder(conn.TypeMap(), fields, newInterner())
+		normalize  = normalizerFor(payload.Options.SpecialFloats, payload.Options.UUIDFormat)
 	)
 
 	for rows.Next() {
+		timer.rowArrived()
 		if rowCount >= payload.Options.MaxRows {
 			break
 		}
-		values, err := rows.Values()
-		if err != nil {
+		row := cells.NewRow()
+		if err := decoder.Decode(rows.RawValues(), row); err != nil {
 			return nil, &rpc.Error{
 				Code:    -32012,
 				Message: "failed to read result row",
@@ -367,22 +812,43 @@ func executeClassicPostgres(ctx context.Context, payload executeParams) (any, *r
 			}
 		}
 
-		row := make([]interface{}, len(values))
-		for i, value := range values {
-			row[i] = normalizeValue(value)
+		serializeStart := time.Now()
+		for i, value := range row {
+			row[i] = normalize(value)
+		}
+		timer.serialized(serializeStart)
+		if !size.add(row) {
+			break
 		}
 
 		resultRows = append(resultRows, row)
 		rowCount++
+		progress.rowRead()
 	}
 
 	if err := rows.Err(); err != nil {
+		if payload.Prepare {
+			postgresPools.prepared.failed(conn, payload.SQL, err)
+		}
 		return nil, &rpc.Error{
 			Code:    -32012,
 			Message: "error occurred while reading rows",
 			Data:    err.Error(),
 		}
 	}
+	rows.Close()
+	timing := timer.finish()
+
+	if err := lookupColumnOrigins(timeoutCtx, conn, fields, columns); err != nil {
+		logger.Warn().Err(err).Msg("failed to resolve column origins")
+	}
+
+	affected := ddl.Parse(payload.SQL)
+	if len(affected) > 0 {
+		if err := ddl.ResolvePostgres(timeoutCtx, conn, affected); err != nil {
+			logger.Warn().Err(err).Msg("failed to resolve affected objects")
+		}
+	}
 
 	duration := time.Since(start).Seconds() * 1000
 
@@ -396,44 +862,66 @@ func executeClassicPostgres(ctx context.Context, payload executeParams) (any, *r
 		Columns:         columns,
 		Rows:            resultRows,
 		ExecutionTimeMs: duration,
+		Timing:          timing,
+		EstimatedBytes:  size.bytes,
+		Oversized:       size.report(),
+		Affected:        affected,
+		Warnings:        notices.list(),
 	}, nil
 }
 
 func executeStream(
-	_ context.Context,
-	server *rpc.Server,
+	ctx context.Context,
+	client *rpc.Session,
 	streams *streamManager,
 	requestID string,
 	payload executeParams,
+	release func(),
 ) (any, *rpc.Error) {
 	logger := logging.Logger()
 
 	ackCh := make(chan protocol.StreamAck, 1)
 	session := protocol.NewStreamSession(requestID, payload.Options.Stream.HighWaterMark, ackCh)
 
-	runCtx, runCancel := context.WithCancel(context.Background())
+	statement := tagSQL(ctx, payload.SQL)
+	runCtx, runCancel := context.WithCancel(client.Context())
 	streams.register(requestID, &streamSessionState{
 		ackCh:  ackCh,
 		cancel: runCancel,
 	})
 
 	go func() {
+		defer release()
 		defer streams.unregister(requestID)
 		defer runCancel()
 
 		streamCtx, cancelTimeout := context.WithTimeout(runCtx, time.Duration(payload.Options.TimeoutSeconds)*time.Second)
 		defer cancelTimeout()
 
-		conn, err := pgx.Connect(streamCtx, payload.Connection.DSN)
+		timer := newQueryTimer()
+		plan := streamFaults.current()
+		conn, _, err := connectPostgres(streamCtx, payload.Connection.DSN)
 		if err != nil {
-			notifyStreamError(server, requestID, "CONNECTION_ERROR", err.Error(), true)
+			notifyStreamError(client, requestID, "CONNECTION_ERROR", err.Error(), true)
 			return
 		}
 		defer conn.Close(context.Background())
+		timer.connected()
+		notices := newNoticeCollector(client, requestID)
+		defer postgresNotices.route(conn.PgConn(), notices)()
+
+		var encoder *protocol.RowEncoder
+		if codec := payload.Options.Stream.Compression; codec != protocol.CompressionNone {
+			if encoder, err = protocol.NewRowEncoder(codec); err != nil {
+				notifyStreamError(client, requestID, "STREAM_ABORTED", err.Error(), true)
+				return
+			}
+			defer encoder.Close()
+		}
 
-		rows, err := conn.Query(streamCtx, payload.SQL)
+		rows, err := conn.Query(streamCtx, statement, payload.Args...)
 		if err != nil {
-			notifyStreamError(server, requestID, "EXECUTION_ERROR", err.Error(), true)
+			notifyStreamError(client, requestID, "EXECUTION_ERROR", err.Error(), true)
 			return
 		}
 		defer rows.Close()
@@ -454,34 +942,83 @@ func executeStream(
 			"rowCount":  nil,
 			"pace":      "auto",
 		}
+		if encoder != nil {
+			startPayload["compression"] = encoder.Codec()
+		}
+		columnar := payload.Options.Stream.Layout == protocol.LayoutColumns
+		if columnar {
+			startPayload["layout"] = protocol.LayoutColumns
+		}
 
-		if err := server.Notify("query.stream.start", startPayload); err != nil {
+		if err := client.NotifyRequest(requestID, "query.stream.start", startPayload); err != nil {
 			logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream start notification")
 			return
 		}
 
 		fetchSize := payload.Options.Stream.FetchSize
-		batch := make([][]interface{}, 0, fetchSize)
+		// Rows are encoded into the chunk's JSON array as they arrive, straight from their
+		// wire values. The columnar layout encodes each value into its column's array.
+		rowJSON := rowbuf.NewRowJSON(conn.TypeMap(), fields, normalizerFor(payload.Options.SpecialFloats, payload.Options.UUIDFormat))
+		var columnJSON *rowbuf.ColumnJSON
+		if columnar {
+			columnJSON = rowJSON.Columns()
+		}
+		batch := []byte{'['}
+		batchRows := 0
 		seq := 1
 		totalRows := 0
 		startTime := time.Now()
 
 		sendChunk := func(hasMore bool) error {
-			if len(batch) == 0 {
+			if batchRows == 0 {
 				return nil
 			}
+			if err := plan.Corrupted(seq); err != nil {
+				return err
+			}
 
-			chunkData := make([][]interface{}, len(batch))
-			copy(chunkData, batch)
-
+			chunkRows := batchRows
+			if columnar {
+				batch = columnJSON.AppendTo(batch[:0])
+			} else {
+				batch = append(batch, ']')
+			}
 			chunkPayload := map[string]any{
 				"requestId": requestID,
 				"seq":       seq,
-				"rows":      chunkData,
 				"hasMore":   hasMore,
 			}
+			if encoder != nil {
+				// Compressed chunks carry the rows as base64 data plus the row count the
+				// extension needs for acknowledgement accounting before decoding.
+				encodeStart := time.Now()
+				data, err := encoder.EncodeJSON(batch)
+				timer.serialized(encodeStart)
+				if err != nil {
+					return err
+				}
+				chunkPayload["compression"] = encoder.Codec()
+				chunkPayload["data"] = data
+				chunkPayload["rowCount"] = chunkRows
+				batch = batch[:1]
+			} else {
+				// The queued notification keeps the encoded rows until they are written,
+				// so the next chunk starts a new buffer.
+				if columnar {
+					chunkPayload["columns"] = json.RawMessage(batch)
+					chunkPayload["rowCount"] = chunkRows
+				} else {
+					chunkPayload["rows"] = json.RawMessage(batch)
+				}
+				batch = append(make([]byte, 0, cap(batch)), '[')
+			}
+			batchRows = 0
 
-			if err := server.Notify("query.stream.chunk", chunkPayload); err != nil {
+			// Sending parks while the outbound queue is full, and HandleChunk waits for
+			// acks: both are the client holding the stream back.
+			waitStart := time.Now()
+			defer timer.waited(waitStart)
+			if err := client.NotifyRequest(requestID, "query.stream.chunk", chunkPayload); err != nil {
 				logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream chunk")
 				return err
 			}
@@ -489,14 +1026,13 @@ func executeStream(
 			if err := session.HandleChunk(streamCtx, protocol.StreamChunk{
 				RequestID: requestID,
 				Seq:       seq,
-				Rows:      chunkData,
+				RowCount:  chunkRows,
 				HasMore:   hasMore,
 			}); err != nil {
 				return err
 			}
 
 			seq++
-			batch = make([][]interface{}, 0, fetchSize)
 			return nil
 		}
 
@@ -507,43 +1043,52 @@ func executeStream(
 				break loop
 			default:
 			}
-
-			values, err := rows.Values()
-			if err != nil {
-				notifyStreamError(server, requestID, "READ_ERROR", err.Error(), true)
+			if err := plan.Dropped(seq - 1); err != nil {
+				notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
 				return
 			}
 
-			row := make([]interface{}, len(values))
-			for i, value := range values {
-				row[i] = normalizeValue(value)
+			timer.rowArrived()
+			serializeStart := time.Now()
+			var err error
+			if columnar {
+				err = columnJSON.AppendRow(rows.RawValues())
+			} else {
+				if batchRows > 0 {
+					batch = append(batch, ',')
+				}
+				batch, err = rowJSON.AppendRow(batch, rows.RawValues())
 			}
-
-			batch = append(batch, row)
+			if err != nil {
+				notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
+				return
+			}
+			timer.serialized(serializeStart)
+			batchRows++
 			totalRows++
 
-			if len(batch) >= fetchSize {
+			if batchRows >= fetchSize {
 				if err := sendChunk(true); err != nil {
-					handleStreamChunkError(server, requestID, err)
+					handleStreamChunkError(client, requestID, err)
 					return
 				}
 			}
 		}
 
-		if len(batch) > 0 {
+		if batchRows > 0 {
 			if err := sendChunk(false); err != nil {
-				handleStreamChunkError(server, requestID, err)
+				handleStreamChunkError(client, requestID, err)
 				return
 			}
 		}
 
 		if err := rows.Err(); err != nil {
-			notifyStreamError(server, requestID, "READ_ERROR", err.Error(), true)
+			notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
 			return
 		}
 
 		if err := streamCtx.Err(); err != nil && !errors.Is(err, context.Canceled) {
-			handleStreamChunkError(server, requestID, err)
+			handleStreamChunkError(client, requestID, err)
 			return
 		}
 
@@ -554,10 +1099,14 @@ func executeStream(
 			"statistics": map[string]any{
 				"executionTimeMs": durationMs,
 				"totalRows":       totalRows,
+				"timing":          timer.finish(),
 			},
 		}
+		if warnings := notices.list(); warnings != nil {
+			completePayload["warnings"] = warnings
+		}
 
-		if err := server.Notify("query.stream.complete", completePayload); err != nil {
+		if err := client.NotifyRequest(requestID, "query.stream.complete", completePayload); err != nil {
 			logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream completion notification")
 			return
 		}
@@ -577,73 +1126,72 @@ func executeStream(
 	}, nil
 }
 
-func notifyStreamError(server *rpc.Server, requestID, code, message string, fatal bool) {
+func notifyStreamError(client *rpc.Session, requestID, code, message string, fatal bool) {
 	payload := map[string]any{
 		"requestId": requestID,
 		"code":      code,
 		"message":   message,
 		"fatal":     fatal,
 	}
-	if err := server.Notify("query.stream.error", payload); err != nil {
+	if err := client.NotifyRequest(requestID, "query.stream.error", payload); err != nil {
 		logger := logging.Logger()
 		logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream error notification")
 	}
 }
 
-func handleStreamChunkError(server *rpc.Server, requestID string, err error) {
+func handleStreamChunkError(client *rpc.Session, requestID string, err error) {
 	switch {
 	case err == nil:
 		return
 	case errors.Is(err, context.Canceled):
-		notifyStreamError(server, requestID, "CANCELLED", "stream cancelled", false)
+		notifyStreamError(client, requestID, "CANCELLED", "stream cancelled", false)
 	case errors.Is(err, context.DeadlineExceeded):
-		notifyStreamError(server, requestID, "ACK_TIMEOUT", "stream acknowledgement timeout", true)
+		notifyStreamError(client, requestID, "ACK_TIMEOUT", "stream acknowledgement timeout", true)
 	default:
-		notifyStreamError(server, requestID, "STREAM_ABORTED", err.Error(), true)
+		notifyStreamError(client, requestID, "STREAM_ABORTED", err.Error(), true)
 	}
 }
 
-func cancelHandler(server *rpc.Server) rpc.NotificationFunc {
-	return func(_ context.Context, params json.RawMessage) {
-		type cancelPayload struct {
-			RequestID json.RawMessage `json:"requestId"`
-		}
+// cancelHandler cancels an in-flight request of the calling client; requests of other
+// clients are out of its reach.
+func cancelHandler(ctx context.Context, params json.RawMessage) {
+	type cancelPayload struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
 
-		var payload cancelPayload
-		if err := json.Unmarshal(params, &payload); err != nil {
-			logger := logging.Logger()
-			logger.Warn().Err(err).Msg("query.cancel: failed to parse parameters")
-			return
-		}
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return
+	}
 
-		if len(payload.RequestID) == 0 {
-			return
-		}
+	var payload cancelPayload
+	if err := json.Unmarshal(params, &payload); err != nil {
+		logger := logging.Logger()
+		logger.Warn().Err(err).Msg("query.cancel: failed to parse parameters")
+		return
+	}
 
-		var anyID interface{}
-		if err := json.Unmarshal(payload.RequestID, &anyID); err != nil {
-			id := string(payload.RequestID)
-			server.Cancel(id)
-			return
-		}
+	if len(payload.RequestID) == 0 {
+		return
+	}
 
-		requestID := fmt.Sprint(anyID)
-		if !server.Cancel(requestID) {
-			logger := logging.Logger()
-			logger.Warn().Str("request_id", requestID).Msg("query.cancel: request not found")
-		}
+	var anyID interface{}
+	if err := json.Unmarshal(payload.RequestID, &anyID); err != nil {
+		id := string(payload.RequestID)
+		client.Cancel(id)
+		return
+	}
+
+	requestID := fmt.Sprint(anyID)
+	if !client.Cancel(requestID) {
+		logger := logging.Logger()
+		logger.Warn().Str("request_id", requestID).Msg("query.cancel: request not found")
 	}
 }
 
 func connectTestHandler(testers map[string]connectionTester) rpc.HandlerFunc {
 	return func(ctx context.Context, raw json.RawMessage) (any, *rpc.Error) {
 		var payload connectTestParams
-		if len(raw) == 0 {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "connection parameters are required",
-			}
-		}
 		if err := json.Unmarshal(raw, &payload); err != nil {
 			return nil, &rpc.Error{
 				Code:    -32602,
@@ -651,19 +1199,6 @@ func connectTestHandler(testers map[string]connectionTester) rpc.HandlerFunc {
 				Data:    err.Error(),
 			}
 		}
-		if payload.Driver == "" {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "driver is required",
-			}
-		}
-		if payload.DSN == "" {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "DSN is required",
-			}
-		}
-
 		tester, ok := testers[payload.Driver]
 		if !ok {
 			return nil, &rpc.Error{
@@ -674,17 +1209,30 @@ func connectTestHandler(testers map[string]connectionTester) rpc.HandlerFunc {
 
 		result, err := tester.TestConnection(ctx, payload)
 		if err != nil {
-			return nil, &rpc.Error{
+			rpcErr := &rpc.Error{
 				Code:    -32020,
 				Message: "connection test failed",
 				Data:    err.Error(),
 			}
+			var keyErr *sqliteKeyError
+			if errors.As(err, &keyErr) {
+				rpcErr.Data = connectTestErrorData{Code: keyErr.Code, Message: keyErr.Error()}
+			}
+			return nil, rpcErr
 		}
 
 		return result, nil
 	}
 }
 
+// classicBlockRows is how many rows of cells classic results allocate at a time.
+const classicBlockRows = 256
+
+// newInterner returns the string interner for the rows of one result.
+func newInterner() *rowbuf.Interner {
+	return rowbuf.NewInterner(rowbuf.DefaultInternMaxLen, rowbuf.DefaultInternMaxEntries)
+}
+
 func normalizeValue(value interface{}) interface{} {
 	switch v := value.(type) {
 	case nil:
@@ -693,6 +1241,38 @@ func normalizeValue(value interface{}) interface{} {
 		return v.UTC().Format(time.RFC3339Nano)
 	case []byte:
 		return string(v)
+	case float64:
+		if special, ok := resultset.SpecialFloatOf(v); ok {
+			return special
+		}
+		return v
+	case float32:
+		if special, ok := resultset.SpecialFloatOf(float64(v)); ok {
+			return special
+		}
+		return v
+	case pgtype.Numeric:
+		switch {
+		case v.NaN:
+			return resultset.SpecialFloat{Value: "NaN"}
+		case v.InfinityModifier == pgtype.Infinity:
+			return resultset.SpecialFloat{Value: "Infinity"}
+		case v.InfinityModifier == pgtype.NegativeInfinity:
+			return resultset.SpecialFloat{Value: "-Infinity"}
+		}
+		return v
+	case json.Number:
+		return v
+	case [16]byte:
+		return uuidfmt.Format(v, uuidfmt.Lower)
+	case pgtype.Interval:
+		return pgvalue.Interval(v)
+	case pgtype.Bits:
+		return pgvalue.Bits(v)
+	case pgtype.Range[any]:
+		return pgvalue.NewRange(v, normalizeValue)
+	case pgtype.Multirange[pgtype.Range[any]]:
+		return pgvalue.NewMultirange(v, normalizeValue)
 	case fmt.Stringer:
 		return v.String()
 	default:
@@ -703,6 +1283,25 @@ func normalizeValue(value interface{}) interface{} {
 	}
 }
 
+// normalizerFor returns the normalization of values for a special float mode and a UUID
+// format: NaN and infinite values are tagged by normalizeValue, or with the null mode
+// become null, and UUIDs are rendered in uuidFormat rather than lowercase.
+func normalizerFor(specialFloats, uuidFormat string) func(any) any {
+	if specialFloats != resultset.SpecialFloatsNull && (uuidFormat == "" || uuidFormat == uuidfmt.Lower) {
+		return normalizeValue
+	}
+	return func(value any) any {
+		if u, ok := value.([16]byte); ok {
+			return uuidfmt.Format(u, uuidFormat)
+		}
+		normalized := normalizeValue(value)
+		if _, ok := normalized.(resultset.SpecialFloat); ok && specialFloats == resultset.SpecialFloatsNull {
+			return nil
+		}
+		return normalized
+	}
+}
+
 func ensureJSONCompatible(value interface{}) error {
 	_, err := json.Marshal(value)
 	return err
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/protocol"
+	"github.com/fluxgrid/core/internal/replay"
+	"github.com/fluxgrid/core/internal/rowbuf"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// replayRecording records the classic runs of query.execute against real databases into
+// the fixture configured with Config.ReplayRecorder.
+type replayRecording struct {
+	mu       sync.RWMutex
+	recorder *replay.Recorder
+}
+
+var replayFixtures = &replayRecording{}
+
+func (r *replayRecording) configure(recorder *replay.Recorder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.recorder = recorder
+}
+
+// record adds the outcome of a classic run to the fixture. Failures to connect are not
+// recorded: the replay driver always connects.
+func (r *replayRecording) record(payload executeParams, result any, rpcErr *rpc.Error) {
+	r.mu.RLock()
+	recorder := r.recorder
+	r.mu.RUnlock()
+	if recorder == nil || payload.Connection.Driver == replay.DriverName {
+		return
+	}
+	interaction := replay.Interaction{SQL: payload.SQL}
+	if rpcErr != nil {
+		message, _ := rpcErr.Data.(string)
+		if message == "" {
+			message = rpcErr.Message
+		}
+		switch rpcErr.Code {
+		case -32011:
+			interaction.Error = message
+		case -32012:
+			interaction.RowError = message
+		default:
+			return
+		}
+	} else {
+		executed, ok := result.(executeResult)
+		if !ok {
+			return
+		}
+		for _, c := range executed.Columns {
+			interaction.Columns = append(interaction.Columns, replay.Column{Name: c.Name, Type: c.DataType})
+		}
+		interaction.Rows = executed.Rows
+		if timing := executed.Timing; timing != nil {
+			interaction.FirstRowMs = timing.FirstRowMs
+			if len(executed.Rows) > 1 {
+				interaction.RowMs = timing.FetchMs / float64(len(executed.Rows)-1)
+			}
+		}
+	}
+	if err := recorder.Record(interaction); err != nil {
+		logger := logging.Logger()
+		logger.Warn().Err(err).Msg("failed to record replay fixture")
+	}
+}
+
+// replayConnectionTester checks that the fixture of a replay DSN can be loaded.
+type replayConnectionTester struct{}
+
+func (replayConnectionTester) TestConnection(ctx context.Context, params connectTestParams) (connectTestResult, error) {
+	start := time.Now()
+	db, err := sql.Open(replay.DriverName, params.DSN)
+	if err != nil {
+		return connectTestResult{}, err
+	}
+	defer db.Close()
+	if err := db.PingContext(ctx); err != nil {
+		return connectTestResult{}, err
+	}
+	path, _, _ := strings.Cut(params.DSN, "?")
+	fixture, err := replay.Load(path)
+	if err != nil {
+		return connectTestResult{}, err
+	}
+	return connectTestResult{
+		LatencyMs:     time.Since(start).Seconds() * 1000,
+		ServerVersion: "replay",
+		ConnectionInfo: map[string]string{
+			"fixture":      path,
+			"interactions": strconv.Itoa(len(fixture.Interactions)),
+		},
+	}, nil
+}
+
+// executeReplayStream streams the rows of a replay fixture with the notifications,
+// acknowledgements and cancellation of executeStream, so that clients can be tested
+// against recorded results.
+func executeReplayStream(
+	ctx context.Context,
+	client *rpc.Session,
+	streams *streamManager,
+	requestID string,
+	payload executeParams,
+	release func(),
+) (any, *rpc.Error) {
+	logger := logging.Logger()
+
+	ackCh := make(chan protocol.StreamAck, 1)
+	session := protocol.NewStreamSession(requestID, payload.Options.Stream.HighWaterMark, ackCh)
+
+	statement := tagSQL(ctx, payload.SQL)
+	runCtx, runCancel := context.WithCancel(client.Context())
+	streams.register(requestID, &streamSessionState{
+		ackCh:  ackCh,
+		cancel: runCancel,
+	})
+
+	go func() {
+		defer release()
+		defer streams.unregister(requestID)
+		defer runCancel()
+
+		streamCtx, cancelTimeout := context.WithTimeout(runCtx, time.Duration(payload.Options.TimeoutSeconds)*time.Second)
+		defer cancelTimeout()
+
+		timer := newQueryTimer()
+		plan := streamFaults.current()
+		db, err := sql.Open(replay.DriverName, payload.Connection.DSN)
+		if err == nil {
+			err = db.PingContext(streamCtx)
+		}
+		if err != nil {
+			notifyStreamError(client, requestID, "CONNECTION_ERROR", err.Error(), true)
+			return
+		}
+		defer db.Close()
+		timer.connected()
+
+		var encoder *protocol.RowEncoder
+		if codec := payload.Options.Stream.Compression; codec != protocol.CompressionNone {
+			if encoder, err = protocol.NewRowEncoder(codec); err != nil {
+				notifyStreamError(client, requestID, "STREAM_ABORTED", err.Error(), true)
+				return
+			}
+			defer encoder.Close()
+		}
+
+		rows, err := db.QueryContext(streamCtx, statement, payload.Args...)
+		if err != nil {
+			notifyStreamError(client, requestID, "EXECUTION_ERROR", err.Error(), true)
+			return
+		}
+		defer rows.Close()
+
+		names, err := rows.Columns()
+		if err != nil {
+			notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
+			return
+		}
+		types, _ := rows.ColumnTypes()
+		columns := make([]column, len(names))
+		for i, name := range names {
+			columns[i] = column{Name: name, DataType: "text"}
+			if i < len(types) && types[i].DatabaseTypeName() != "" {
+				columns[i].DataType = types[i].DatabaseTypeName()
+			}
+		}
+
+		startPayload := map[string]any{
+			"requestId": requestID,
+			"cursor":    "",
+			"columns":   columns,
+			"rowCount":  nil,
+			"pace":      "auto",
+		}
+		if encoder != nil {
+			startPayload["compression"] = encoder.Codec()
+		}
+		columnar := payload.Options.Stream.Layout == protocol.LayoutColumns
+		if columnar {
+			startPayload["layout"] = protocol.LayoutColumns
+		}
+		if err := client.NotifyRequest(requestID, "query.stream.start", startPayload); err != nil {
+			logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream start notification")
+			return
+		}
+
+		var (
+			normalize = normalizerFor(payload.Options.SpecialFloats, payload.Options.UUIDFormat)
+			batch     = rowbuf.GetBatch(len(columns), payload.Options.Stream.FetchSize)
+			seq       = 1
+			totalRows = 0
+			startTime = time.Now()
+		)
+
+		defer batch.Release()
+
+		// Chunks are encoded before the batch is reset, so its rows are reused.
+		sendChunk := func(hasMore bool) error {
+			if batch.Len() == 0 {
+				return nil
+			}
+			if err := plan.Corrupted(seq); err != nil {
+				return err
+			}
+			chunkRows := batch.Len()
+			var values any = batch.Rows()
+			if columnar {
+				values = transposeRows(batch.Rows(), len(columns))
+			}
+			encodeStart := time.Now()
+			encoded, err := json.Marshal(values)
+			if err != nil {
+				return err
+			}
+			chunkPayload := map[string]any{
+				"requestId": requestID,
+				"seq":       seq,
+				"hasMore":   hasMore,
+			}
+			switch {
+			case encoder != nil:
+				data, err := encoder.EncodeJSON(encoded)
+				if err != nil {
+					return err
+				}
+				chunkPayload["compression"] = encoder.Codec()
+				chunkPayload["data"] = data
+				chunkPayload["rowCount"] = chunkRows
+			case columnar:
+				chunkPayload["columns"] = json.RawMessage(encoded)
+				chunkPayload["rowCount"] = chunkRows
+			default:
+				chunkPayload["rows"] = json.RawMessage(encoded)
+			}
+			timer.serialized(encodeStart)
+			batch.Reset()
+
+			waitStart := time.Now()
+			defer timer.waited(waitStart)
+			if err := client.NotifyRequest(requestID, "query.stream.chunk", chunkPayload); err != nil {
+				logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream chunk")
+				return err
+			}
+			if err := session.HandleChunk(streamCtx, protocol.StreamChunk{
+				RequestID: requestID,
+				Seq:       seq,
+				RowCount:  chunkRows,
+				HasMore:   hasMore,
+			}); err != nil {
+				return err
+			}
+			seq++
+			return nil
+		}
+
+		values := make([]any, len(columns))
+		targets := make([]any, len(columns))
+		for i := range values {
+			targets[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := plan.Dropped(seq - 1); err != nil {
+				notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
+				return
+			}
+			timer.rowArrived()
+			if err := rows.Scan(targets...); err != nil {
+				notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
+				return
+			}
+			row := batch.NewRow()
+			for i, value := range values {
+				row[i] = normalize(value)
+			}
+			totalRows++
+			if batch.Len() >= payload.Options.Stream.FetchSize {
+				if err := sendChunk(true); err != nil {
+					handleStreamChunkError(client, requestID, err)
+					return
+				}
+			}
+		}
+
+		// A cancelled stream ends the rows with the error of its context.
+		if err := rows.Err(); err != nil && streamCtx.Err() == nil {
+			if err := sendChunk(false); err != nil {
+				handleStreamChunkError(client, requestID, err)
+				return
+			}
+			notifyStreamError(client, requestID, "READ_ERROR", err.Error(), true)
+			return
+		}
+		if err := streamCtx.Err(); err != nil {
+			handleStreamChunkError(client, requestID, err)
+			return
+		}
+		if err := sendChunk(false); err != nil {
+			handleStreamChunkError(client, requestID, err)
+			return
+		}
+
+		durationMs := time.Since(startTime).Seconds() * 1000
+		if err := client.NotifyRequest(requestID, "query.stream.complete", map[string]any{
+			"requestId": requestID,
+			"cursor":    "",
+			"statistics": map[string]any{
+				"executionTimeMs": durationMs,
+				"totalRows":       totalRows,
+				"timing":          timer.finish(),
+			},
+		}); err != nil {
+			logger.Error().Err(err).Str("request_id", requestID).Msg("failed to send stream completion notification")
+			return
+		}
+		session.Reset()
+
+		logger.Info().
+			Str("driver", payload.Connection.Driver).
+			Int("row_count", totalRows).
+			Float64("duration_ms", durationMs).
+			Msg("query.execute streaming completed")
+	}()
+
+	return map[string]any{
+		"mode":      "stream",
+		"requestId": requestID,
+	}, nil
+}
+
+// transposeRows turns rows into the value arrays of the columnar stream layout.
+func transposeRows(rows [][]any, width int) [][]any {
+	columns := make([][]any, width)
+	for i := range columns {
+		columns[i] = make([]any, len(rows))
+		for j, row := range rows {
+			columns[i][j] = row[i]
+		}
+	}
+	return columns
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/replay"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestReplayRecordsAndReplaysClassicRuns(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE orders (id INTEGER, status TEXT)",
+		"INSERT INTO orders VALUES (1, 'open'), (2, NULL)",
+	)
+	fixture := filepath.Join(t.TempDir(), "orders.json")
+	recorder, err := replay.NewRecorder(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayFixtures.configure(recorder)
+	defer replayFixtures.configure(nil)
+
+	execute := executeHandler(rpc.NewServer(zerolog.Nop()), resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, newWorkspaces("", nil), 0)
+	run := func(driver, dsn, sql string) (any, *rpc.Error) {
+		params, _ := json.Marshal(map[string]any{
+			"connection": map[string]any{"driver": driver, "dsn": dsn},
+			"sql":        sql,
+		})
+		return execute(context.Background(), params)
+	}
+
+	const sql = "SELECT id, status FROM orders ORDER BY id"
+	recorded, rpcErr := run("sqlite", dsn, sql)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if _, rpcErr := run("sqlite", dsn, "SELECT * FROM missing"); rpcErr == nil {
+		t.Fatal("expected an error")
+	}
+
+	replayed, rpcErr := run("replay", fixture+"?timing=off", sql)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	want, got := recorded.(executeResult), replayed.(executeResult)
+	if !reflect.DeepEqual(got.Columns, want.Columns) || !reflect.DeepEqual(got.Rows, want.Rows) {
+		t.Fatalf("replayed %+v %v, recorded %+v %v", got.Columns, got.Rows, want.Columns, want.Rows)
+	}
+	_, rpcErr = run("replay", fixture, "SELECT * FROM missing")
+	if rpcErr == nil || rpcErr.Code != -32011 || rpcErr.Data != "SQL logic error: no such table: missing (1)" {
+		t.Fatalf("error = %+v", rpcErr)
+	}
+}
+
+// replayStream starts streaming the statement of interaction from a fixture holding it,
+// with the query.execute options given.
+func replayStream(t *testing.T, c *matrixClient, interaction replay.Interaction, timing string, options map[string]any) {
+	t.Helper()
+	fixture := filepath.Join(t.TempDir(), "stream.json")
+	recorder, _ := replay.NewRecorder(fixture)
+	if err := recorder.Record(interaction); err != nil {
+		t.Fatal(err)
+	}
+	options["mode"] = "stream"
+	c.mustCall("query.execute", map[string]any{
+		"connection": map[string]any{"driver": "replay", "dsn": fixture + "?timing=" + timing},
+		"sql":        interaction.SQL,
+		"options":    options,
+	}, nil)
+}
+
+func streamEvent(t *testing.T, msg matrixMessage) (requestID string, seq int, rows int) {
+	t.Helper()
+	var event struct {
+		RequestID string  `json:"requestId"`
+		Seq       int     `json:"seq"`
+		Rows      [][]any `json:"rows"`
+	}
+	if err := json.Unmarshal(msg.Params, &event); err != nil {
+		t.Fatal(err)
+	}
+	return event.RequestID, event.Seq, len(event.Rows)
+}
+
+func TestReplayStreamWaitsForAcknowledgements(t *testing.T) {
+	c := newMatrixClient(t)
+	rows := make([][]any, 5)
+	for i := range rows {
+		rows[i] = []any{int64(i)}
+	}
+	replayStream(t, c, replay.Interaction{SQL: "SELECT n FROM numbers", Columns: []replay.Column{{Name: "n"}}, Rows: rows},
+		"off", map[string]any{"stream": map[string]any{"fetchSize": 2, "highWaterMark": 2}})
+
+	var sizes []int
+	for {
+		received := c.await("query.stream.chunk", "query.stream.complete")
+		last := received[len(received)-1]
+		if last.Method == "query.stream.complete" {
+			break
+		}
+		requestID, seq, n := streamEvent(t, last)
+		sizes = append(sizes, n)
+		// Nothing more arrives until the chunk is acknowledged.
+		select {
+		case msg := <-c.messages:
+			t.Fatalf("%s arrived before the ack of chunk %d", msg.Method, seq)
+		case <-time.After(20 * time.Millisecond):
+		}
+		c.notify("query.stream.ack", map[string]any{"requestId": requestID, "seq": seq})
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Fatalf("chunk sizes = %v", sizes)
+	}
+}
+
+func TestReplayStreamCancellation(t *testing.T) {
+	c := newMatrixClient(t)
+	replayStream(t, c, replay.Interaction{
+		SQL:     "SELECT n FROM slow",
+		Columns: []replay.Column{{Name: "n"}},
+		Rows:    [][]any{{int64(1)}, {int64(2)}},
+		RowMs:   time.Hour.Seconds() * 1000,
+	}, "recorded", map[string]any{"stream": map[string]any{"fetchSize": 1, "highWaterMark": 10}})
+
+	received := c.await("query.stream.chunk")
+	requestID, _, _ := streamEvent(t, received[len(received)-1])
+	c.notify("query.stream.cancel", map[string]any{"requestId": requestID})
+	received = c.await("query.stream.error", "query.stream.complete")
+	var event struct {
+		Code  string `json:"code"`
+		Fatal bool   `json:"fatal"`
+	}
+	json.Unmarshal(received[len(received)-1].Params, &event)
+	if event.Code != "CANCELLED" || event.Fatal {
+		t.Fatalf("end of stream = %s", received[len(received)-1].Params)
+	}
+}
+
+func TestReplayStreamReportsRowErrors(t *testing.T) {
+	c := newMatrixClient(t)
+	replayStream(t, c, replay.Interaction{
+		SQL:      "SELECT n FROM flaky",
+		Columns:  []replay.Column{{Name: "n"}},
+		Rows:     [][]any{{int64(1)}},
+		RowError: "server closed the connection unexpectedly",
+	}, "off", map[string]any{"stream": map[string]any{"fetchSize": 10}})
+
+	// The rows read before the error are delivered first.
+	received := c.await("query.stream.chunk", "query.stream.error")
+	requestID, seq, n := streamEvent(t, received[len(received)-1])
+	if n != 1 {
+		t.Fatalf("chunk = %s", received[len(received)-1].Params)
+	}
+	c.notify("query.stream.ack", map[string]any{"requestId": requestID, "seq": seq})
+	received = c.await("query.stream.error", "query.stream.complete")
+	var event struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	json.Unmarshal(received[len(received)-1].Params, &event)
+	if event.Code != "READ_ERROR" || event.Message != "server closed the connection unexpectedly" {
+		t.Fatalf("end of stream = %s", received[len(received)-1].Params)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// Routes a query.execute request may ask for.
+const (
+	routeAuto    = "auto"
+	routePrimary = "primary"
+	routeReplica = "replica"
+)
+
+// replicaDownFor is how long a replica that could not be reached is left out of the
+// rotation before it is tried again.
+const replicaDownFor = 30 * time.Second
+
+// queryEndpoint reports which server of a connection with read replicas ran a query.
+type queryEndpoint struct {
+	// Role is "primary" or "replica".
+	Role string `json:"role"`
+	// Target names the server and database without credentials.
+	Target string `json:"target"`
+}
+
+type replicaEndpoint struct {
+	dsn       string
+	target    string
+	downUntil time.Time
+}
+
+type replicaSet struct {
+	endpoints []*replicaEndpoint
+	next      int
+}
+
+// replicaRouter keeps the read replicas of connection profiles, keyed by the driver and
+// DSN of their primary.
+type replicaRouter struct {
+	mu   sync.Mutex
+	sets map[string]*replicaSet
+	now  func() time.Time
+}
+
+var readReplicas = newReplicaRouter()
+
+func newReplicaRouter() *replicaRouter {
+	return &replicaRouter{sets: make(map[string]*replicaSet), now: time.Now}
+}
+
+func replicaKey(driver, dsn string) string {
+	return driver + "\x00" + dsn
+}
+
+// configure sets the replicas of the primary conn. No replicas removes the set.
+func (r *replicaRouter) configure(primary dbConnectionParams, replicas []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := replicaKey(primary.Driver, primary.DSN)
+	if len(replicas) == 0 {
+		delete(r.sets, key)
+		return
+	}
+	set := &replicaSet{}
+	for _, dsn := range replicas {
+		set.endpoints = append(set.endpoints, &replicaEndpoint{
+			dsn:    dsn,
+			target: connectionTarget(dbConnectionParams{Driver: primary.Driver, DSN: dsn}),
+		})
+	}
+	r.sets[key] = set
+}
+
+// candidates returns the healthy replicas of primary in round-robin order, starting with
+// the next one in turn. ok is false when primary has no replicas.
+func (r *replicaRouter) candidates(primary dbConnectionParams) ([]*replicaEndpoint, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	set, ok := r.sets[replicaKey(primary.Driver, primary.DSN)]
+	if !ok {
+		return nil, false
+	}
+	now := r.now()
+	var healthy []*replicaEndpoint
+	for i := range set.endpoints {
+		endpoint := set.endpoints[(set.next+i)%len(set.endpoints)]
+		if !now.Before(endpoint.downUntil) {
+			healthy = append(healthy, endpoint)
+		}
+	}
+	set.next = (set.next + 1) % len(set.endpoints)
+	return healthy, true
+}
+
+// markDown leaves a replica that could not be reached out of the rotation for a while.
+func (r *replicaRouter) markDown(endpoint *replicaEndpoint) {
+	r.mu.Lock()
+	endpoint.downUntil = r.now().Add(replicaDownFor)
+	r.mu.Unlock()
+}
+
+// executeRouted runs a query.execute statement on a read replica of its connection when
+// the connection has replicas, the statement only reads and the request does not ask for
+// the primary. A replica that cannot be reached is marked down and the next one tried,
+// then the primary. Results report the endpoint that ran the statement.
+func executeRouted(
+	ctx context.Context,
+	payload executeParams,
+	run func(context.Context, executeParams) (any, *rpc.Error),
+) (any, *rpc.Error) {
+	primary := dbConnectionParams{Driver: payload.Connection.Driver, DSN: payload.Connection.DSN}
+	replicas, ok := readReplicas.candidates(primary)
+	if !ok {
+		if payload.Options.Route == routeReplica {
+			return nil, &rpc.Error{Code: -32013, Message: "the connection has no read replicas"}
+		}
+		return run(ctx, payload)
+	}
+
+	route := payload.Options.Route
+	if route == "" || route == routeAuto {
+		route = routePrimary
+		if ddl.ReadOnly(payload.SQL) {
+			route = routeReplica
+		}
+	}
+	if route == routeReplica {
+		for _, replica := range replicas {
+			onReplica := payload
+			onReplica.Connection.DSN = replica.dsn
+			result, rpcErr := run(ctx, onReplica)
+			if rpcErr != nil && rpcErr.Code == -32010 {
+				readReplicas.markDown(replica)
+				continue
+			}
+			return withEndpoint(result, queryEndpoint{Role: routeReplica, Target: replica.target}), rpcErr
+		}
+		if payload.Options.Route == routeReplica {
+			return nil, &rpc.Error{Code: -32013, Message: "no read replica is reachable"}
+		}
+	}
+	result, rpcErr := run(ctx, payload)
+	return withEndpoint(result, queryEndpoint{Role: routePrimary, Target: connectionTarget(primary)}), rpcErr
+}
+
+func withEndpoint(result any, endpoint queryEndpoint) any {
+	if r, ok := result.(executeResult); ok {
+		r.Endpoint = &endpoint
+		return r
+	}
+	return result
+}
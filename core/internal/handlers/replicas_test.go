@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	saved := readReplicas
+	defer func() { readReplicas = saved }()
+	readReplicas = newReplicaRouter()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	readReplicas.now = func() time.Time { return now }
+
+	primary := dbConnectionParams{Driver: "sqlite", DSN: "primary.db"}
+	readReplicas.configure(primary, []string{"replica-a.db", "replica-b.db"})
+	down := map[string]bool{}
+	var ran []string
+	run := func(_ context.Context, payload executeParams) (any, *rpc.Error) {
+		ran = append(ran, payload.Connection.DSN)
+		if down[payload.Connection.DSN] {
+			return nil, &rpc.Error{Code: -32010, Message: "failed to connect to database"}
+		}
+		return executeResult{}, nil
+	}
+	execute := func(sql, route string) executeResult {
+		t.Helper()
+		var payload executeParams
+		payload.Connection.Driver, payload.Connection.DSN = primary.Driver, primary.DSN
+		payload.SQL, payload.Options.Route = sql, route
+		result, rpcErr := executeRouted(context.Background(), payload, run)
+		if rpcErr != nil {
+			t.Fatalf("%s: %+v", sql, rpcErr)
+		}
+		return result.(executeResult)
+	}
+
+	if r := execute("SELECT 1", ""); r.Endpoint.Role != "replica" || r.Endpoint.Target != "replica-a.db" {
+		t.Fatalf("expected the first replica, got %+v", r.Endpoint)
+	}
+	if r := execute("SELECT 1", ""); r.Endpoint.Target != "replica-b.db" {
+		t.Fatalf("expected round-robin to the second replica, got %+v", r.Endpoint)
+	}
+	if r := execute("UPDATE t SET x = 1", ""); r.Endpoint.Role != "primary" || r.Endpoint.Target != "primary.db" {
+		t.Fatalf("expected writes on the primary, got %+v", r.Endpoint)
+	}
+	if r := execute("SELECT 1", "primary"); r.Endpoint.Role != "primary" {
+		t.Fatalf("expected the override to reach the primary, got %+v", r.Endpoint)
+	}
+
+	down["replica-a.db"] = true
+	ran = nil
+	execute("SELECT 1", "")
+	execute("SELECT 1", "")
+	if len(ran) != 3 || ran[0] != "replica-a.db" || ran[1] != "replica-b.db" || ran[2] != "replica-b.db" {
+		t.Fatalf("expected the unreachable replica to be skipped once marked down, ran %v", ran)
+	}
+	down["replica-b.db"] = true
+	if r := execute("SELECT 1", ""); r.Endpoint.Role != "primary" {
+		t.Fatalf("expected a fallback to the primary, got %+v", r.Endpoint)
+	}
+	var payload executeParams
+	payload.Connection.Driver, payload.Connection.DSN = primary.Driver, primary.DSN
+	payload.SQL, payload.Options.Route = "SELECT 1", "replica"
+	if _, rpcErr := executeRouted(context.Background(), payload, run); rpcErr == nil || rpcErr.Code != -32013 {
+		t.Fatalf("expected a forced replica read to fail, got %+v", rpcErr)
+	}
+
+	delete(down, "replica-a.db")
+	now = now.Add(replicaDownFor)
+	if r := execute("SELECT 1", ""); r.Endpoint.Role != "replica" || r.Endpoint.Target != "replica-a.db" {
+		t.Fatalf("expected the replica to rejoin after its down period, got %+v", r.Endpoint)
+	}
+
+	payload.Connection.DSN = "other.db"
+	if result, _ := executeRouted(context.Background(), payload, run); result != nil {
+		t.Fatal("expected a forced replica read without replicas to fail")
+	}
+	payload.Options.Route = ""
+	if result, _ := executeRouted(context.Background(), payload, run); result.(executeResult).Endpoint != nil {
+		t.Fatal("connections without replicas report no endpoint")
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// classicExecutor runs a statement in non-streaming mode; executeClassic is the production implementation.
+type classicExecutor func(ctx context.Context, payload executeParams) (any, *rpc.Error)
+
+type compareSide struct {
+	Connection dbConnectionParams `json:"connection"`
+	SQL        string             `json:"sql"`
+	// HistoryID compares the snapshot of a pinned run instead of running SQL. The other
+	// side's SQL defaults to the pinned statement.
+	HistoryID string `json:"historyId,omitempty"`
+}
+
+type resultCompareParams struct {
+	Left    compareSide `json:"left"`
+	Right   compareSide `json:"right"`
+	Keys    []string    `json:"keys"`
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+		MaxRows        int `json:"maxRows"`
+		MaxDiffs       int `json:"maxDiffs"`
+	} `json:"options"`
+}
+
+type resultCompareResult struct {
+	resultset.Diff
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+}
+
+func resultCompareHandler(execute classicExecutor, spaces *workspaces) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultCompareParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		var (
+			sets     [2]resultset.Set
+			snapshot [2]bool
+		)
+		for i, cs := range []*compareSide{&payload.Left, &payload.Right} {
+			if cs.HistoryID == "" {
+				continue
+			}
+			set, sql, rpcErr := snapshotSet(spaces.history(ctx), cs.HistoryID)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			sets[i], snapshot[i] = set, true
+			if cs.SQL == "" {
+				cs.SQL = sql
+			}
+		}
+		if payload.Left.SQL == "" && snapshot[1] {
+			payload.Left.SQL = payload.Right.SQL
+		}
+
+		// An omitted right side reuses the left connection or SQL, so callers can compare one
+		// query across two environments or two queries on one connection.
+		if payload.Right.Connection.Driver == "" && payload.Right.Connection.DSN == "" {
+			payload.Right.Connection = payload.Left.Connection
+		}
+		if payload.Right.SQL == "" {
+			payload.Right.SQL = payload.Left.SQL
+		}
+
+		sides := []string{"left", "right"}
+		for i, cs := range []compareSide{payload.Left, payload.Right} {
+			side := sides[i]
+			if snapshot[i] {
+				continue
+			}
+			if cs.SQL == "" {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: fmt.Sprintf("%s SQL is required", side),
+				}
+			}
+			if cs.Connection.Driver == "" || cs.Connection.DSN == "" {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: fmt.Sprintf("%s connection driver and DSN are required", side),
+				}
+			}
+		}
+
+		if len(payload.Keys) == 0 {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "at least one key column is required",
+			}
+		}
+
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		if payload.Options.MaxRows <= 0 {
+			payload.Options.MaxRows = 10000
+		}
+		if payload.Options.MaxDiffs <= 0 {
+			payload.Options.MaxDiffs = 1000
+		}
+
+		start := time.Now()
+
+		var (
+			wg      sync.WaitGroup
+			rpcErrs [2]*rpc.Error
+		)
+		for i, cs := range []compareSide{payload.Left, payload.Right} {
+			if snapshot[i] {
+				continue
+			}
+			var exec executeParams
+			exec.Connection.Driver = cs.Connection.Driver
+			exec.Connection.DSN = cs.Connection.DSN
+			exec.SQL = cs.SQL
+			exec.Options.TimeoutSeconds = payload.Options.TimeoutSeconds
+			// One row past the limit tells a complete result from a cut one.
+			exec.Options.MaxRows = payload.Options.MaxRows + 1
+
+			wg.Add(1)
+			go func(i int, exec executeParams) {
+				defer wg.Done()
+				sets[i], rpcErrs[i] = runComparedSet(ctx, execute, exec, payload.Options.MaxRows)
+			}(i, exec)
+		}
+		wg.Wait()
+
+		for i, side := range sides {
+			if rpcErrs[i] != nil {
+				rpcErrs[i].Message = fmt.Sprintf("%s query: %s", side, rpcErrs[i].Message)
+				return nil, rpcErrs[i]
+			}
+		}
+		// Snapshot values were read back from JSON, so a live side is compared in the same
+		// form: timestamps as text and numbers as written.
+		if snapshot[0] != snapshot[1] {
+			live := 0
+			if snapshot[0] {
+				live = 1
+			}
+			converted, err := sameJSONForm(sets[live])
+			if err != nil {
+				return nil, &rpc.Error{
+					Code:    -32060,
+					Message: "failed to compare results",
+					Data:    err.Error(),
+				}
+			}
+			sets[live] = converted
+		}
+
+		diff, err := resultset.Compare(sets[0], sets[1], resultset.CompareOptions{
+			Keys:     payload.Keys,
+			MaxDiffs: payload.Options.MaxDiffs,
+		})
+		if err != nil {
+			var dupErr *resultset.DuplicateKeyError
+			if errors.As(err, &dupErr) {
+				return nil, &rpc.Error{
+					Code:    -32061,
+					Message: "key columns do not uniquely identify rows",
+					Data:    err.Error(),
+				}
+			}
+			return nil, &rpc.Error{
+				Code:    -32060,
+				Message: "failed to compare results",
+				Data:    err.Error(),
+			}
+		}
+
+		duration := time.Since(start).Seconds() * 1000
+
+		logger := logging.Logger()
+		logger.Info().
+			Int("added", diff.Summary.Added).
+			Int("removed", diff.Summary.Removed).
+			Int("changed", diff.Summary.Changed).
+			Float64("duration_ms", duration).
+			Msg("result.compare completed")
+
+		return resultCompareResult{
+			Diff:            diff,
+			ExecutionTimeMs: duration,
+		}, nil
+	}
+}
+
+// runComparedSet runs one side of a comparison. A side with rows left out would show
+// the missing rows as added or removed, so a result over maxRows or the size limit fails
+// the comparison instead.
+func runComparedSet(ctx context.Context, execute classicExecutor, payload executeParams, maxRows int) (resultset.Set, *rpc.Error) {
+	result, rpcErr := runClassic(ctx, execute, payload)
+	if rpcErr != nil {
+		return resultset.Set{}, rpcErr
+	}
+	if len(result.Rows) > maxRows {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32063,
+			Message: fmt.Sprintf("result has more than %d rows", maxRows),
+			Data:    "raise options.maxRows or narrow the query to compare complete results",
+		}
+	}
+	if result.Oversized != nil {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32063,
+			Message: fmt.Sprintf("result exceeds %d bytes", result.Oversized.LimitBytes),
+			Data:    result.Oversized.Advice,
+		}
+	}
+	return toResultSet(result), nil
+}
+
+func runClassicSet(ctx context.Context, execute classicExecutor, payload executeParams) (resultset.Set, *rpc.Error) {
+	result, rpcErr := runClassic(ctx, execute, payload)
+	if rpcErr != nil {
+		return resultset.Set{}, rpcErr
+	}
+	return toResultSet(result), nil
+}
+
+func runClassic(ctx context.Context, execute classicExecutor, payload executeParams) (executeResult, *rpc.Error) {
+	raw, rpcErr := execute(ctx, payload)
+	if rpcErr != nil {
+		return executeResult{}, rpcErr
+	}
+	result, ok := raw.(executeResult)
+	if !ok {
+		return executeResult{}, &rpc.Error{
+			Code:    -32603,
+			Message: fmt.Sprintf("unexpected execute result %T", raw),
+		}
+	}
+	return result, nil
+}
+
+func toResultSet(result executeResult) resultset.Set {
+	columns := make([]resultset.Column, len(result.Columns))
+	for i, col := range result.Columns {
+		columns[i] = resultset.Column{Name: col.Name, DataType: col.DataType, Origin: col.Origin}
+	}
+	return resultset.Set{Columns: columns, Rows: result.Rows}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func TestResultCompareHandlerReusesLeftSide(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []executeParams
+	)
+	execute := func(_ context.Context, payload executeParams) (any, *rpc.Error) {
+		mu.Lock()
+		calls = append(calls, payload)
+		mu.Unlock()
+
+		rows := [][]interface{}{{int64(1), "Alice"}}
+		if payload.Connection.DSN == "postgresql://staging" {
+			rows = [][]interface{}{{int64(1), "Alicia"}, {int64(2), "Bob"}}
+		}
+		return executeResult{
+			Columns: []column{{Name: "id", DataType: "23"}, {Name: "name", DataType: "25"}},
+			Rows:    rows,
+		}, nil
+	}
+
+	handler := resultCompareHandler(execute, nil)
+	raw, _ := json.Marshal(map[string]any{
+		"left": map[string]any{
+			"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://prod"},
+			"sql":        "SELECT id, name FROM users",
+		},
+		"right": map[string]any{
+			"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://staging"},
+		},
+		"keys": []string{"id"},
+	})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+
+	if len(calls) != 2 {
+		t.Fatalf("expected two executions, got %d", len(calls))
+	}
+	for _, call := range calls {
+		if call.SQL != "SELECT id, name FROM users" {
+			t.Fatalf("expected right side to reuse left SQL, got %q", call.SQL)
+		}
+	}
+
+	response, ok := result.(resultCompareResult)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result)
+	}
+	if response.Summary.Added != 1 || response.Summary.Changed != 1 {
+		t.Fatalf("unexpected summary %+v", response.Summary)
+	}
+}
+
+func TestResultCompareHandlerPropagatesExecutionError(t *testing.T) {
+	execute := func(_ context.Context, payload executeParams) (any, *rpc.Error) {
+		if payload.SQL == "broken" {
+			return nil, &rpc.Error{Code: -32011, Message: "query execution failed"}
+		}
+		return executeResult{Columns: []column{{Name: "id"}}}, nil
+	}
+
+	handler := resultCompareHandler(execute, nil)
+	raw, _ := json.Marshal(map[string]any{
+		"left": map[string]any{
+			"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+			"sql":        "SELECT 1 AS id",
+		},
+		"right": map[string]any{"sql": "broken"},
+		"keys":  []string{"id"},
+	})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32011 {
+		t.Fatalf("expected execution error, got %+v", rpcErr)
+	}
+}
+
+func TestResultCompareHandlerRequiresKeys(t *testing.T) {
+	handler := resultCompareHandler(func(context.Context, executeParams) (any, *rpc.Error) {
+		t.Fatal("executor should not be called")
+		return nil, nil
+	}, nil)
+	raw, _ := json.Marshal(map[string]any{
+		"left": map[string]any{
+			"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+			"sql":        "SELECT 1",
+		},
+	})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected invalid params error, got %+v", rpcErr)
+	}
+}
+
+func TestResultCompareHandlerRejectsTruncatedSides(t *testing.T) {
+	execute := func(_ context.Context, payload executeParams) (any, *rpc.Error) {
+		total := 2
+		if payload.Connection.DSN == "postgresql://prod" {
+			total = 5
+		}
+		var rows [][]interface{}
+		for id := 1; id <= total && len(rows) < payload.Options.MaxRows; id++ {
+			rows = append(rows, []interface{}{int64(id)})
+		}
+		return executeResult{Columns: []column{{Name: "id", DataType: "23"}}, Rows: rows}, nil
+	}
+	compare := func(maxRows int) (any, *rpc.Error) {
+		raw, _ := json.Marshal(map[string]any{
+			"left":    map[string]any{"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://prod"}, "sql": "SELECT id FROM users"},
+			"right":   map[string]any{"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://staging"}},
+			"keys":    []string{"id"},
+			"options": map[string]any{"maxRows": maxRows},
+		})
+		return resultCompareHandler(execute, nil)(context.Background(), raw)
+	}
+
+	_, rpcErr := compare(3)
+	if rpcErr == nil || rpcErr.Code != -32063 || rpcErr.Message != "left query: result has more than 3 rows" {
+		t.Fatalf("expected the cut left side to fail the comparison, got %+v", rpcErr)
+	}
+	result, rpcErr := compare(5)
+	if rpcErr != nil {
+		t.Fatalf("a side exactly at the limit failed: %v", rpcErr)
+	}
+	if removed := result.(resultCompareResult).Summary.Removed; removed != 3 {
+		t.Fatalf("expected 3 removed rows, got %d", removed)
+	}
+}
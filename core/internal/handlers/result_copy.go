@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type resultCopyParams struct {
+	ResultID string `json:"resultId" jsonschema:"required"`
+	resultset.FormatRequest
+}
+
+type resultCopyResult struct {
+	Format string `json:"format"`
+	Text   string `json:"text"`
+	Bytes  int    `json:"bytes"`
+}
+
+func resultCopyAsHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultCopyParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		set, rpcErr := lookupResult(results, payload.ResultID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		text, err := resultset.Format(set, payload.FormatRequest)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid copy request",
+				Data:    err.Error(),
+			}
+		}
+
+		return resultCopyResult{
+			Format: payload.Format,
+			Text:   text,
+			Bytes:  len(text),
+		}, nil
+	}
+}
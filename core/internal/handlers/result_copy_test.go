@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestResultCopyAsHandler(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "id"}, {Name: "name"}},
+		Rows:    [][]any{{int64(1), "Alice"}, {int64(2), "Bob"}},
+	})
+
+	handler := resultCopyAsHandler(results)
+	raw, _ := json.Marshal(map[string]any{"resultId": id, "format": "csv", "rows": []int{1}})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	copied, ok := result.(resultCopyResult)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result)
+	}
+	if copied.Text != "id,name\n2,Bob\n" || copied.Bytes != len(copied.Text) {
+		t.Fatalf("unexpected copy result %+v", copied)
+	}
+}
+
+func TestResultCopyAsHandlerUnsupportedFormat(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{})
+
+	handler := resultCopyAsHandler(results)
+	raw, _ := json.Marshal(map[string]any{"resultId": id, "format": "xml"})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected invalid params error, got %+v", rpcErr)
+	}
+}
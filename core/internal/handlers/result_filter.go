@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type resultFilterParams struct {
+	ResultID string           `json:"resultId" jsonschema:"required"`
+	Filter   resultset.Filter `json:"filter" jsonschema:"required"`
+	// Offset and Limit select the page of matching rows returned with the new result.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type resultFilterResult struct {
+	// ResultID names the filtered copy, which later result.* calls and exports can use.
+	ResultID  string  `json:"resultId"`
+	TotalRows int     `json:"totalRows"`
+	Offset    int     `json:"offset"`
+	Rows      [][]any `json:"rows"`
+}
+
+func resultFilterHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultFilterParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		set, rpcErr := lookupResult(results, payload.ResultID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		filtered, err := resultset.Where(set, payload.Filter)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid filter",
+				Data:    err.Error(),
+			}
+		}
+
+		if payload.Limit <= 0 {
+			payload.Limit = defaultSortPageRows
+		}
+		start := min(max(payload.Offset, 0), len(filtered.Rows))
+		end := min(start+payload.Limit, len(filtered.Rows))
+		return resultFilterResult{
+			ResultID:  results.Put(filtered),
+			TotalRows: len(filtered.Rows),
+			Offset:    start,
+			Rows:      filtered.Rows[start:end],
+		}, nil
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestResultFilterHandlerCachesFilteredCopy(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "n", DataType: "23"}},
+		Rows:    [][]any{{int64(1)}, {int64(5)}, {nil}, {int64(9)}},
+	})
+
+	raw := json.RawMessage(`{"resultId":"` + id + `","filter":{"column":"n","op":"gt","value":3},"limit":1}`)
+	result, rpcErr := resultFilterHandler(results)(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	filtered := result.(resultFilterResult)
+	if filtered.TotalRows != 2 || len(filtered.Rows) != 1 || filtered.Rows[0][0] != int64(5) || filtered.ResultID == id {
+		t.Fatalf("unexpected response %+v", filtered)
+	}
+	if set, ok := results.Get(filtered.ResultID); !ok || len(set.Rows) != 2 {
+		t.Fatalf("expected the filtered copy to be cached, got %+v", set)
+	}
+
+	raw = json.RawMessage(`{"resultId":"` + id + `","filter":{"column":"n","op":"between","value":3}}`)
+	if _, rpcErr := resultFilterHandler(results)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected an unknown operator to be refused, got %+v", rpcErr)
+	}
+}
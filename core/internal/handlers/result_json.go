@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type resultExpandJSONParams struct {
+	ResultID string `json:"resultId" jsonschema:"required"`
+	resultset.ExpandRequest
+	// Offset and Limit select the page of rows returned with the new result.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type resultExpandJSONResult struct {
+	// ResultID names the expanded copy, which later result.* calls and exports can use.
+	ResultID  string             `json:"resultId"`
+	Columns   []resultset.Column `json:"columns"`
+	TotalRows int                `json:"totalRows"`
+	Offset    int                `json:"offset"`
+	Rows      [][]any            `json:"rows"`
+}
+
+func resultExpandJSONHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultExpandJSONParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		set, rpcErr := lookupResult(results, payload.ResultID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		expanded, err := resultset.ExpandJSON(set, payload.ExpandRequest)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid JSON expansion",
+				Data:    err.Error(),
+			}
+		}
+
+		if payload.Limit <= 0 {
+			payload.Limit = defaultSortPageRows
+		}
+		start := min(max(payload.Offset, 0), len(expanded.Rows))
+		end := min(start+payload.Limit, len(expanded.Rows))
+		return resultExpandJSONResult{
+			ResultID:  results.Put(expanded),
+			Columns:   expanded.Columns,
+			TotalRows: len(expanded.Rows),
+			Offset:    start,
+			Rows:      expanded.Rows[start:end],
+		}, nil
+	}
+}
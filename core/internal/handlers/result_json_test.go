@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestResultExpandJSONHandlerCachesExpandedCopy(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "doc", DataType: "114"}},
+		Rows:    [][]any{{`{"a":{"b":1}}`}, {`{"a":{"b":2}}`}},
+	})
+
+	raw := json.RawMessage(`{"resultId":"` + id + `","column":"doc","paths":[{"path":"$.a.b","as":"b"}],"offset":1}`)
+	result, rpcErr := resultExpandJSONHandler(results)(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	expanded := result.(resultExpandJSONResult)
+	if len(expanded.Columns) != 2 || expanded.Columns[1].Name != "b" || expanded.TotalRows != 2 ||
+		len(expanded.Rows) != 1 || expanded.Rows[0][1] != int64(2) {
+		t.Fatalf("unexpected response %+v", expanded)
+	}
+	if set, ok := results.Get(expanded.ResultID); !ok || len(set.Columns) != 2 {
+		t.Fatalf("expected the expanded copy to be cached, got %+v", set)
+	}
+
+	raw = json.RawMessage(`{"resultId":"` + id + `","column":"doc","paths":[{"path":"$[x]"}]}`)
+	if _, rpcErr := resultExpandJSONHandler(results)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected an invalid path to be refused, got %+v", rpcErr)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type resultPivotParams struct {
+	ResultID string `json:"resultId" jsonschema:"required"`
+	resultset.PivotRequest
+}
+
+func resultPivotHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultPivotParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		set, rpcErr := lookupResult(results, payload.ResultID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		if payload.MaxCategories <= 0 {
+			payload.MaxCategories = 5000
+		}
+
+		pivot, err := resultset.Pivot(set, payload.PivotRequest)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid pivot request",
+				Data:    err.Error(),
+			}
+		}
+
+		return pivot, nil
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestResultPivotHandler(t *testing.T) {
+	results := resultset.NewCache(4, time.Minute)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "status"}, {Name: "total"}},
+		Rows: [][]any{
+			{"open", int64(3)},
+			{"closed", int64(5)},
+			{"open", int64(4)},
+		},
+	})
+
+	handler := resultPivotHandler(results)
+	raw, _ := json.Marshal(map[string]any{
+		"resultId":   id,
+		"groupBy":    []string{"status"},
+		"aggregates": []map[string]string{{"fn": "sum", "column": "total"}},
+	})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+
+	pivot, ok := result.(resultset.PivotResult)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result)
+	}
+	if len(pivot.Categories) != 2 || pivot.Categories[1][0] != "open" || pivot.Series[0].Values[1] != float64(7) {
+		t.Fatalf("unexpected pivot %+v", pivot)
+	}
+}
+
+func TestResultPivotHandlerUnknownResult(t *testing.T) {
+	handler := resultPivotHandler(resultset.NewCache(1, 0))
+	raw, _ := json.Marshal(map[string]any{"resultId": "res-404"})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32062 {
+		t.Fatalf("expected result not found error, got %+v", rpcErr)
+	}
+}
+
+func TestResultReleaseHandler(t *testing.T) {
+	results := resultset.NewCache(1, 0)
+	id := results.Put(resultset.Set{})
+
+	handler := resultReleaseHandler(results)
+	raw, _ := json.Marshal(map[string]any{"resultId": id})
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	if released := result.(map[string]any)["released"]; released != true {
+		t.Fatalf("expected result to be released, got %v", released)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type resultSearchParams struct {
+	ResultID string `json:"resultId" jsonschema:"required"`
+	resultset.SearchRequest
+}
+
+func resultSearchHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultSearchParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		set, rpcErr := lookupResult(results, payload.ResultID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		if payload.MaxMatches <= 0 {
+			payload.MaxMatches = 1000
+		}
+
+		found, err := resultset.Search(set, payload.SearchRequest)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid search request",
+				Data:    err.Error(),
+			}
+		}
+
+		return found, nil
+	}
+}
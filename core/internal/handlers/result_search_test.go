@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestResultSearchHandler(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "name"}},
+		Rows:    [][]any{{"alpha"}, {"beta"}, {"alphabet"}},
+	})
+
+	handler := resultSearchHandler(results)
+	raw, _ := json.Marshal(map[string]any{"resultId": id, "query": "alpha"})
+
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	found, ok := result.(resultset.SearchResult)
+	if !ok {
+		t.Fatalf("unexpected response type %T", result)
+	}
+	if len(found.Rows) != 2 || found.Rows[1] != 2 {
+		t.Fatalf("unexpected search rows %v", found.Rows)
+	}
+}
+
+func TestResultSearchHandlerInvalidPattern(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{Columns: []resultset.Column{{Name: "name"}}})
+
+	handler := resultSearchHandler(results)
+	raw, _ := json.Marshal(map[string]any{"resultId": id, "query": "[", "regex": true})
+
+	_, rpcErr := handler(context.Background(), raw)
+	if rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected invalid params error, got %+v", rpcErr)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// defaultMaxResultBytes caps the estimated JSON size of a classic result, so that a
+// careless SELECT cannot flood the editor process with a response it has to parse whole.
+const defaultMaxResultBytes = 64 << 20
+
+// oversizedResult explains why a classic result stops short of the rows the query returned.
+type oversizedResult struct {
+	LimitBytes int64  `json:"limitBytes"`
+	Advice     string `json:"advice"`
+}
+
+// resultSize accumulates the estimated serialized size of a classic result against a
+// limit. A zero limit only measures.
+type resultSize struct {
+	limit     int64
+	bytes     int64
+	oversized bool
+}
+
+func newResultSize(limit int64) *resultSize {
+	return &resultSize{limit: limit}
+}
+
+// add accounts for row and reports whether it fits. A row that does not fit is not
+// counted, and the result is marked oversized.
+func (s *resultSize) add(row []interface{}) bool {
+	size := estimateRowSize(row)
+	if s.limit > 0 && s.bytes+size > s.limit {
+		s.oversized = true
+		return false
+	}
+	s.bytes += size
+	return true
+}
+
+// report returns the oversized marker for the result, or nil when it is complete.
+func (s *resultSize) report() *oversizedResult {
+	if !s.oversized {
+		return nil
+	}
+	return &oversizedResult{
+		LimitBytes: s.limit,
+		Advice: fmt.Sprintf("the result exceeds %d MiB; use streaming mode or export to read every row",
+			s.limit>>20),
+	}
+}
+
+// estimateRowSize approximates the JSON encoding of a normalized row without encoding it.
+// Escapes in strings are not counted.
+func estimateRowSize(row []interface{}) int64 {
+	size := int64(2 + len(row))
+	for _, value := range row {
+		size += estimateValueSize(value)
+	}
+	return size
+}
+
+func estimateValueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 4
+	case bool:
+		return 5
+	case string:
+		return int64(len(v) + 2)
+	case int64:
+		return int64(len(strconv.FormatInt(v, 10)))
+	case int32:
+		return int64(len(strconv.FormatInt(int64(v), 10)))
+	case int:
+		return int64(len(strconv.Itoa(v)))
+	case float64:
+		return int64(len(strconv.FormatFloat(v, 'g', -1, 64)))
+	case float32:
+		return int64(len(strconv.FormatFloat(float64(v), 'g', -1, 32)))
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return 0
+		}
+		return int64(len(encoded))
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const defaultSortPageRows = 1000
+
+type resultSortParams struct {
+	ResultID string `json:"resultId" jsonschema:"required"`
+	resultset.SortRequest
+	// Offset and Limit select the page of sorted rows returned with the new result.
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type resultSortResult struct {
+	// ResultID names the sorted copy, which later result.* calls and exports can use.
+	ResultID  string  `json:"resultId"`
+	TotalRows int     `json:"totalRows"`
+	Offset    int     `json:"offset"`
+	Rows      [][]any `json:"rows"`
+}
+
+func resultSortHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload resultSortParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		set, rpcErr := lookupResult(results, payload.ResultID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		sorted, err := resultset.Sort(set, payload.SortRequest)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid sort request",
+				Data:    err.Error(),
+			}
+		}
+
+		if payload.Limit <= 0 {
+			payload.Limit = defaultSortPageRows
+		}
+		start := min(max(payload.Offset, 0), len(sorted.Rows))
+		end := min(start+payload.Limit, len(sorted.Rows))
+		return resultSortResult{
+			ResultID:  results.Put(sorted),
+			TotalRows: len(sorted.Rows),
+			Offset:    start,
+			Rows:      sorted.Rows[start:end],
+		}, nil
+	}
+}
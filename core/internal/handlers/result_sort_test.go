@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestResultSortHandlerCachesSortedCopy(t *testing.T) {
+	results := resultset.NewCache(4, 0)
+	id := results.Put(resultset.Set{
+		Columns: []resultset.Column{{Name: "name", DataType: "25"}},
+		Rows:    [][]any{{"b"}, {"a"}, {"c"}},
+	})
+
+	raw, _ := json.Marshal(map[string]any{"resultId": id, "keys": []map[string]any{{"column": "name"}}, "offset": 1, "limit": 1})
+	result, rpcErr := resultSortHandler(results)(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	sorted := result.(resultSortResult)
+	if sorted.TotalRows != 3 || len(sorted.Rows) != 1 || sorted.Rows[0][0] != "b" || sorted.ResultID == id {
+		t.Fatalf("unexpected response %+v", sorted)
+	}
+	if set, ok := results.Get(sorted.ResultID); !ok || set.Rows[0][0] != "a" {
+		t.Fatalf("expected the sorted copy to be cached, got %+v", set)
+	}
+
+	raw, _ = json.Marshal(map[string]any{"resultId": id, "keys": []map[string]any{{"column": "name"}}, "locale": "??"})
+	if _, rpcErr := resultSortHandler(results)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected an invalid locale to be refused, got %+v", rpcErr)
+	}
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+const (
+	resultCacheEntries  = 16
+	resultCacheTTL      = 30 * time.Minute
+	defaultCacheMaxRows = 100000
+)
+
+// executeCached runs the statement with the larger cache row limit, keeps the full set in the
+// result cache, and returns only the first maxRows rows alongside the result identifier.
+func executeCached(ctx context.Context, results *resultset.Cache, payload executeParams) (any, *rpc.Error) {
+	visibleRows := payload.Options.MaxRows
+	if payload.Options.CacheMaxRows <= 0 {
+		payload.Options.CacheMaxRows = defaultCacheMaxRows
+	}
+	if payload.Options.CacheMaxRows > visibleRows {
+		payload.Options.MaxRows = payload.Options.CacheMaxRows
+	}
+
+	raw, rpcErr := executeClassic(ctx, payload)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	result, ok := raw.(executeResult)
+	if !ok {
+		return raw, nil
+	}
+
+	result.ResultID = results.Put(toResultSet(result))
+	result.CachedRows = len(result.Rows)
+	if len(result.Rows) > visibleRows {
+		result.Rows = result.Rows[:visibleRows]
+	}
+	return result, nil
+}
+
+// lookupResult resolves the resultId parameter shared by the result.* methods.
+func lookupResult(results *resultset.Cache, resultID string) (resultset.Set, *rpc.Error) {
+	if resultID == "" {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32602,
+			Message: "resultId is required",
+		}
+	}
+	set, ok := results.Get(resultID)
+	if !ok {
+		return resultset.Set{}, &rpc.Error{
+			Code:    -32062,
+			Message: "result not found or expired",
+		}
+	}
+	return set, nil
+}
+
+func resultReleaseHandler(results *resultset.Cache) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload struct {
+			ResultID string `json:"resultId"`
+		}
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		return map[string]any{
+			"resultId": payload.ResultID,
+			"released": results.Release(payload.ResultID),
+		}, nil
+	}
+}
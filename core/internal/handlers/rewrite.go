@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/fluxgrid/core/internal/rewrite"
+)
+
+// rewriteReport lists the configured rewrite rules that changed a statement, and the
+// statement that ran instead.
+type rewriteReport struct {
+	Applied []rewrite.Applied `json:"applied"`
+	SQL     string            `json:"sql"`
+}
+
+// applyRewrites rewrites sql in place with the configured rules. It returns nil when no
+// rule changed it.
+func applyRewrites(rewriter *rewrite.Rewriter, driver string, sql *string) *rewriteReport {
+	rewritten, applied := rewriter.Apply(driver, *sql)
+	if len(applied) == 0 {
+		return nil
+	}
+	*sql = rewritten
+	return &rewriteReport{Applied: applied, SQL: rewritten}
+}
+
+func withRewrite(result any, report *rewriteReport) any {
+	if report == nil {
+		return result
+	}
+	switch r := result.(type) {
+	case executeResult:
+		r.Rewrite = report
+		return r
+	case map[string]any:
+		r["rewrite"] = report
+	}
+	return result
+}
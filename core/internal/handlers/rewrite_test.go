@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestExecuteAppliesRewriteRules(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE invoices (id INTEGER, tenant_id TEXT)",
+		"INSERT INTO invoices VALUES (1, 'acme'), (2, 'globex'), (3, 'acme')",
+	)
+	rewriter, err := rewrite.New([]rewrite.Rule{
+		{Name: "tenant", Kind: rewrite.KindTenantFilter, Table: "invoices", Column: "tenant_id", Value: "acme"},
+		{Name: "cap", Kind: rewrite.KindLimit, Limit: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := rpc.NewServer(zerolog.Nop())
+	handler := executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, rewriter, nil, 0)
+
+	params, _ := json.Marshal(map[string]any{
+		"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+		"sql":        "SELECT id FROM invoices ORDER BY id DESC",
+	})
+	result, rpcErr := handler(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	r := result.(executeResult)
+	if len(r.Rows) != 1 || r.Rows[0][0] != int64(3) {
+		t.Fatalf("rows = %v", r.Rows)
+	}
+	if r.Rewrite == nil || len(r.Rewrite.Applied) != 2 || r.Rewrite.Applied[0].Rule != "tenant" {
+		t.Fatalf("rewrite = %+v", r.Rewrite)
+	}
+	const want = `SELECT id FROM (SELECT * FROM invoices WHERE "tenant_id" = 'acme') AS invoices ORDER BY id DESC LIMIT 1`
+	if r.Rewrite.SQL != want {
+		t.Fatalf("rewritten to %s", r.Rewrite.SQL)
+	}
+
+	params, _ = json.Marshal(map[string]any{
+		"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+		"sql":        "UPDATE invoices SET tenant_id = 'acme'",
+	})
+	result, rpcErr = handler(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if r := result.(executeResult); r.Rewrite != nil {
+		t.Fatalf("writes match no rule, got %+v", r.Rewrite)
+	}
+}
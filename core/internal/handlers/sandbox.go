@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// sandbox is a scratch in-memory SQLite database shared by every request of one client
+// session. Requests open connections of their own, so the database is named and shared
+// between them, and one connection is held open to keep it alive until the session ends.
+type sandbox struct {
+	mu     sync.Mutex
+	dsn    string
+	db     *sql.DB
+	keep   *sql.Conn
+	handle string
+}
+
+type sandboxKey struct{}
+
+func sandboxOf(client *rpc.Session) *sandbox {
+	return client.Value(sandboxKey{}, func() any {
+		s := &sandbox{}
+		client.OnClose(s.close)
+		return s
+	}).(*sandbox)
+}
+
+// connection returns the connection parameters of the sandbox, creating it on first use.
+func (s *sandbox) connection(ctx context.Context) (dbConnectionParams, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keep == nil {
+		var id [16]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return dbConnectionParams{}, err
+		}
+		dsn := "file:fluxgrid-sandbox-" + hex.EncodeToString(id[:]) + "?mode=memory&cache=shared"
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			return dbConnectionParams{}, err
+		}
+		keep, err := db.Conn(ctx)
+		if err != nil {
+			db.Close()
+			return dbConnectionParams{}, err
+		}
+		s.dsn, s.db, s.keep = dsn, db, keep
+	}
+	return dbConnectionParams{Driver: "sqlite", DSN: s.dsn}, nil
+}
+
+// open returns a connection handle on the sandbox, reusing the one handed out before
+// while it is open.
+func (s *sandbox) open(ctx context.Context, handles *connectionHandles) (string, error) {
+	conn, err := s.connection(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := handles.lookup(s.handle); ok {
+		return s.handle, nil
+	}
+	handle, err := handles.open(conn)
+	if err != nil {
+		return "", err
+	}
+	s.handle = handle
+	return handle, nil
+}
+
+func (s *sandbox) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keep != nil {
+		s.keep.Close()
+		s.db.Close()
+		s.keep, s.db = nil, nil
+	}
+}
+
+// sandboxOpenHandler returns a connection handle on the session's sandbox, for methods
+// that take a connection such as data.import and schema.list.
+func sandboxOpenHandler(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return nil, &rpc.Error{Code: -32603, Message: "sandbox.open requires a client session"}
+	}
+	handles, _ := handlesOf(ctx)
+	handle, err := sandboxOf(client).open(ctx, handles)
+	if err != nil {
+		return nil, &rpc.Error{Code: -32603, Message: "failed to open the sandbox", Data: err.Error()}
+	}
+	return connectionOpenResult{Handle: handle}, nil
+}
+
+// sandboxExecuteHandler runs query.execute against the session's sandbox. Its params are
+// those of query.execute without a connection.
+func sandboxExecuteHandler(execute rpc.HandlerFunc) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if _, ok := payload["connection"]; ok {
+			return nil, &rpc.Error{Code: -32602, Message: "sandbox.execute takes no connection"}
+		}
+		client, ok := rpc.SessionFromContext(ctx)
+		if !ok {
+			return nil, &rpc.Error{Code: -32603, Message: "sandbox.execute requires a client session"}
+		}
+		conn, err := sandboxOf(client).connection(ctx)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32603, Message: "failed to open the sandbox", Data: err.Error()}
+		}
+		payload["connection"], _ = json.Marshal(conn)
+		params, _ = json.Marshal(payload)
+		return execute(ctx, params)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func sandboxServer() *rpc.Server {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Use(connectionHandleResolution(false, newWorkspaces("", nil)))
+	execute := executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, nil, 0)
+	server.Register("sandbox.open", sandboxOpenHandler)
+	server.Register("sandbox.execute", sandboxExecuteHandler(execute))
+	server.Register("data.import", dataImportHandler(runStatements))
+	return server
+}
+
+func TestSandboxKeepsImportedDataForTheSession(t *testing.T) {
+	server := sandboxServer()
+	c := connectTo(t, server)
+	line := c("sandbox.open", `{}`)
+	handle := strings.SplitN(strings.SplitN(line, `"handle":"`, 2)[1], `"`, 2)[0]
+
+	line = c("data.import", `{"connection":{"handle":"`+handle+`"},"table":"people","format":"csv","create":true,"data":"name,age\nada,36\nalan,41\n"}`)
+	if !strings.Contains(line, `"rows":2`) || !strings.Contains(line, `{"name":"age","kind":"integer"}`) {
+		t.Fatalf("import = %s", line)
+	}
+	line = c("sandbox.execute", `{"sql":"SELECT sum(age) AS total FROM people"}`)
+	if !strings.Contains(line, "77") {
+		t.Fatalf("execute = %s", line)
+	}
+	if again := c("sandbox.open", `{}`); !strings.Contains(again, handle) {
+		t.Fatalf("reopen = %s, want %s", again, handle)
+	}
+
+	other := connectTo(t, server)
+	if line := other("sandbox.execute", `{"sql":"SELECT count(*) FROM people"}`); !strings.Contains(line, "no such table") {
+		t.Fatalf("another session saw the sandbox: %s", line)
+	}
+	if line := c("sandbox.execute", `{"connection":{"driver":"sqlite","dsn":":memory:"},"sql":"SELECT 1"}`); !strings.Contains(line, "-32602") {
+		t.Fatalf("connection = %s", line)
+	}
+}
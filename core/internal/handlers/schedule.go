@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/secret"
+)
+
+const (
+	minScheduleInterval = time.Second
+	maxSchedules        = 32
+)
+
+// notifier emits JSON-RPC notifications; *rpc.Server satisfies it.
+type notifier interface {
+	Notify(method string, params interface{}) error
+}
+
+type scheduleParams struct {
+	Connection dbConnectionParams `json:"connection"`
+	SQL        string             `json:"sql"`
+	Options    struct {
+		IntervalSeconds float64  `json:"intervalSeconds"`
+		Mode            string   `json:"mode"`
+		Keys            []string `json:"keys"`
+		OnlyOnChange    bool     `json:"onlyOnChange"`
+		SkipInitialRun  bool     `json:"skipInitialRun"`
+		TimeoutSeconds  int      `json:"timeoutSeconds"`
+		MaxRows         int      `json:"maxRows"`
+	} `json:"options"`
+}
+
+type scheduleInfo struct {
+	ScheduleID      string  `json:"scheduleId"`
+	SQL             string  `json:"sql"`
+	Driver          string  `json:"driver"`
+	IntervalSeconds float64 `json:"intervalSeconds"`
+	Mode            string  `json:"mode"`
+	Runs            int     `json:"runs"`
+	LastRunAt       string  `json:"lastRunAt,omitempty"`
+	LastError       string  `json:"lastError,omitempty"`
+}
+
+type scheduledQuery struct {
+	// params has its DSN moved to dsn, which is wiped when the schedule stops.
+	params   scheduleParams
+	dsn      secret.Secret
+	interval time.Duration
+	cancel   context.CancelFunc
+	// owner is the session that created the schedule, or nil for a caller without one.
+	// Only the owner sees the schedule and receives its notifications.
+	owner  *rpc.Session
+	notify notifier
+
+	mu        sync.Mutex
+	info      scheduleInfo
+	previous  *resultset.Set
+	lastHash  [32]byte
+	hasResult bool
+}
+
+type scheduleManager struct {
+	execute classicExecutor
+	// notify receives the notifications of schedules created outside a session, as
+	// in-process callers do. Calls over the server always come with one.
+	notify      notifier
+	minInterval time.Duration
+
+	mu      sync.Mutex
+	nextID  int
+	entries map[string]*scheduledQuery
+}
+
+func newScheduleManager(execute classicExecutor, notify notifier) *scheduleManager {
+	return &scheduleManager{
+		execute:     execute,
+		notify:      notify,
+		minInterval: minScheduleInterval,
+		entries:     make(map[string]*scheduledQuery),
+	}
+}
+
+func (m *scheduleManager) scheduleHandler(ctx context.Context, raw json.RawMessage) (any, *rpc.Error) {
+	var payload scheduleParams
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+
+	if payload.SQL == "" {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "SQL is required",
+		}
+	}
+	if payload.Connection.Driver == "" || payload.Connection.DSN == "" {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "connection driver and DSN are required",
+		}
+	}
+
+	interval := time.Duration(payload.Options.IntervalSeconds * float64(time.Second))
+	if interval < m.minInterval || interval <= 0 {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: fmt.Sprintf("intervalSeconds must be at least %s", m.minInterval),
+		}
+	}
+
+	switch payload.Options.Mode {
+	case "":
+		payload.Options.Mode = "full"
+	case "full":
+	case "diff":
+		if len(payload.Options.Keys) == 0 {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "diff mode requires key columns",
+			}
+		}
+	default:
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: fmt.Sprintf("unsupported schedule mode: %s", payload.Options.Mode),
+		}
+	}
+
+	if payload.Options.TimeoutSeconds <= 0 {
+		payload.Options.TimeoutSeconds = 30
+	}
+	if payload.Options.MaxRows <= 0 {
+		payload.Options.MaxRows = 500
+	}
+
+	m.mu.Lock()
+	if len(m.entries) >= maxSchedules {
+		m.mu.Unlock()
+		return nil, &rpc.Error{
+			Code:    -32070,
+			Message: fmt.Sprintf("schedule limit reached (%d)", maxSchedules),
+		}
+	}
+	m.nextID++
+	id := "sched-" + strconv.Itoa(m.nextID)
+	// A schedule belongs to the client that created it and stops when that client
+	// disconnects.
+	parent, notify := context.Background(), m.notify
+	client, ok := rpc.SessionFromContext(ctx)
+	if ok {
+		parent, notify = client.Context(), client
+	}
+	loopCtx, cancel := context.WithCancel(parent)
+	dsn := secret.New(payload.Connection.DSN)
+	payload.Connection.DSN = ""
+	entry := &scheduledQuery{
+		params:   payload,
+		dsn:      dsn,
+		interval: interval,
+		cancel:   cancel,
+		owner:    client,
+		notify:   notify,
+		info: scheduleInfo{
+			ScheduleID:      id,
+			SQL:             payload.SQL,
+			Driver:          payload.Connection.Driver,
+			IntervalSeconds: interval.Seconds(),
+			Mode:            payload.Options.Mode,
+		},
+	}
+	m.entries[id] = entry
+	m.mu.Unlock()
+
+	if client != nil {
+		client.OnClose(func() { m.remove(id) })
+	}
+	go m.loop(loopCtx, entry)
+
+	return entry.snapshot(), nil
+}
+
+func (m *scheduleManager) unscheduleHandler(ctx context.Context, raw json.RawMessage) (any, *rpc.Error) {
+	var payload struct {
+		ScheduleID string `json:"scheduleId"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+
+	m.mu.Lock()
+	entry, ok := m.entries[payload.ScheduleID]
+	ok = ok && entry.owner == sessionOf(ctx)
+	if ok {
+		delete(m.entries, payload.ScheduleID)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return nil, &rpc.Error{
+			Code:    -32071,
+			Message: "schedule not found",
+		}
+	}
+	entry.cancel()
+
+	return map[string]any{"scheduleId": payload.ScheduleID, "removed": true}, nil
+}
+
+func (m *scheduleManager) listHandler(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+	owner := sessionOf(ctx)
+	m.mu.Lock()
+	schedules := make([]scheduleInfo, 0, len(m.entries))
+	for _, entry := range m.entries {
+		if entry.owner == owner {
+			schedules = append(schedules, entry.snapshot())
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return scheduleOrdinal(schedules[i].ScheduleID) < scheduleOrdinal(schedules[j].ScheduleID)
+	})
+
+	return map[string]any{"schedules": schedules}, nil
+}
+
+// remove stops the schedule id, if it is still running.
+func (m *scheduleManager) remove(id string) {
+	m.mu.Lock()
+	entry, ok := m.entries[id]
+	delete(m.entries, id)
+	m.mu.Unlock()
+	if ok {
+		entry.cancel()
+	}
+}
+
+// sessionOf returns the session of ctx, or nil outside one.
+func sessionOf(ctx context.Context) *rpc.Session {
+	client, _ := rpc.SessionFromContext(ctx)
+	return client
+}
+
+func scheduleOrdinal(id string) int {
+	n, _ := strconv.Atoi(id[len("sched-"):])
+	return n
+}
+
+func (m *scheduleManager) loop(ctx context.Context, entry *scheduledQuery) {
+	defer entry.dsn.Release()
+
+	if !entry.params.Options.SkipInitialRun {
+		m.run(ctx, entry)
+	}
+
+	ticker := time.NewTicker(entry.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.run(ctx, entry)
+		}
+	}
+}
+
+func (m *scheduleManager) run(ctx context.Context, entry *scheduledQuery) {
+	var exec executeParams
+	exec.Connection.Driver = entry.params.Connection.Driver
+	exec.Connection.DSN = entry.dsn.Reveal()
+	exec.SQL = entry.params.SQL
+	exec.Options.TimeoutSeconds = entry.params.Options.TimeoutSeconds
+	exec.Options.MaxRows = entry.params.Options.MaxRows
+
+	ranAt := time.Now().UTC()
+	raw, rpcErr := m.execute(ctx, exec)
+	if ctx.Err() != nil {
+		return
+	}
+
+	entry.mu.Lock()
+	entry.info.Runs++
+	entry.info.LastRunAt = ranAt.Format(time.RFC3339Nano)
+	seq := entry.info.Runs
+	id := entry.info.ScheduleID
+	if rpcErr != nil {
+		entry.info.LastError = rpcErr.Message
+		entry.mu.Unlock()
+		m.emit(entry, "query.schedule.error", map[string]any{
+			"scheduleId": id,
+			"seq":        seq,
+			"code":       rpcErr.Code,
+			"message":    rpcErr.Message,
+			"data":       rpcErr.Data,
+		})
+		return
+	}
+	entry.info.LastError = ""
+
+	result, ok := raw.(executeResult)
+	if !ok {
+		entry.mu.Unlock()
+		return
+	}
+
+	hash := hashRows(result)
+	changed := !entry.hasResult || hash != entry.lastHash
+	entry.lastHash = hash
+	entry.hasResult = true
+
+	payload := map[string]any{
+		"scheduleId": id,
+		"seq":        seq,
+		"ranAt":      ranAt.Format(time.RFC3339Nano),
+		"changed":    changed,
+		"mode":       entry.params.Options.Mode,
+	}
+
+	current := toResultSet(result)
+	previous := entry.previous
+	entry.previous = &current
+	entry.mu.Unlock()
+
+	if !changed && entry.params.Options.OnlyOnChange {
+		return
+	}
+
+	if entry.params.Options.Mode == "diff" && previous != nil {
+		diff, err := resultset.Compare(*previous, current, resultset.CompareOptions{
+			Keys: entry.params.Options.Keys,
+		})
+		if err != nil {
+			m.emit(entry, "query.schedule.error", map[string]any{
+				"scheduleId": id,
+				"seq":        seq,
+				"code":       -32060,
+				"message":    "failed to compare results",
+				"data":       err.Error(),
+			})
+			return
+		}
+		payload["diff"] = diff
+	} else {
+		payload["result"] = result
+	}
+
+	m.emit(entry, "query.schedule.result", payload)
+}
+
+func (m *scheduleManager) emit(entry *scheduledQuery, method string, payload map[string]any) {
+	if entry.notify == nil {
+		return
+	}
+	if err := entry.notify.Notify(method, payload); err != nil {
+		logger := logging.Logger()
+		logger.Error().Err(err).Str("method", method).Msg("failed to send schedule notification")
+	}
+}
+
+func (e *scheduledQuery) snapshot() scheduleInfo {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.info
+}
+
+func hashRows(result executeResult) [32]byte {
+	data, err := json.Marshal(result.Rows)
+	if err != nil {
+		return [32]byte{}
+	}
+	return sha256.Sum256(data)
+}
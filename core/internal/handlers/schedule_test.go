@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+type recordedNotification struct {
+	method string
+	params map[string]any
+}
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []recordedNotification
+	signal chan struct{}
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{signal: make(chan struct{}, 64)}
+}
+
+func (n *recordingNotifier) Notify(method string, params interface{}) error {
+	n.mu.Lock()
+	payload, _ := params.(map[string]any)
+	n.events = append(n.events, recordedNotification{method: method, params: payload})
+	n.mu.Unlock()
+	select {
+	case n.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (n *recordingNotifier) NotifyTenant(_, method string, params interface{}) error {
+	return n.Notify(method, params)
+}
+
+func (n *recordingNotifier) waitFor(t *testing.T, count int) []recordedNotification {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		n.mu.Lock()
+		if len(n.events) >= count {
+			events := append([]recordedNotification(nil), n.events...)
+			n.mu.Unlock()
+			return events
+		}
+		n.mu.Unlock()
+		select {
+		case <-n.signal:
+		case <-deadline:
+			t.Fatalf("timed out waiting for %d notifications", count)
+		}
+	}
+}
+
+func TestScheduleManagerDiffMode(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		runs int
+	)
+	execute := func(context.Context, executeParams) (any, *rpc.Error) {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		rows := [][]interface{}{{int64(1), "pending"}}
+		if runs > 1 {
+			rows = [][]interface{}{{int64(1), "done"}}
+		}
+		return executeResult{
+			Columns: []column{{Name: "id"}, {Name: "status"}},
+			Rows:    rows,
+		}, nil
+	}
+
+	notify := newRecordingNotifier()
+	manager := newScheduleManager(execute, notify)
+	manager.minInterval = 0
+
+	raw, _ := json.Marshal(map[string]any{
+		"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+		"sql":        "SELECT id, status FROM jobs",
+		"options":    map[string]any{"intervalSeconds": 0.01, "mode": "diff", "keys": []string{"id"}},
+	})
+	result, rpcErr := manager.scheduleHandler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("scheduleHandler returned rpc error: %v", rpcErr)
+	}
+	info := result.(scheduleInfo)
+
+	events := notify.waitFor(t, 2)
+
+	unscheduleRaw, _ := json.Marshal(map[string]string{"scheduleId": info.ScheduleID})
+	if _, rpcErr := manager.unscheduleHandler(context.Background(), unscheduleRaw); rpcErr != nil {
+		t.Fatalf("unscheduleHandler returned rpc error: %v", rpcErr)
+	}
+
+	if events[0].method != "query.schedule.result" || events[0].params["result"] == nil {
+		t.Fatalf("expected first run to carry the full result, got %+v", events[0])
+	}
+	diff, ok := events[1].params["diff"].(resultset.Diff)
+	if !ok {
+		t.Fatalf("expected second run to carry a diff, got %+v", events[1])
+	}
+	if diff.Summary.Changed != 1 {
+		t.Fatalf("unexpected diff summary %+v", diff.Summary)
+	}
+}
+
+func TestScheduleManagerOnlyOnChangeAndList(t *testing.T) {
+	execute := func(context.Context, executeParams) (any, *rpc.Error) {
+		return executeResult{
+			Columns: []column{{Name: "n"}},
+			Rows:    [][]interface{}{{int64(1)}},
+		}, nil
+	}
+
+	notify := newRecordingNotifier()
+	manager := newScheduleManager(execute, notify)
+	manager.minInterval = 0
+
+	raw, _ := json.Marshal(map[string]any{
+		"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+		"sql":        "SELECT 1 AS n",
+		"options":    map[string]any{"intervalSeconds": 0.01, "onlyOnChange": true},
+	})
+	result, rpcErr := manager.scheduleHandler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("scheduleHandler returned rpc error: %v", rpcErr)
+	}
+	id := result.(scheduleInfo).ScheduleID
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		listed, _ := manager.listHandler(context.Background(), nil)
+		schedules := listed.(map[string]any)["schedules"].([]scheduleInfo)
+		if len(schedules) != 1 {
+			t.Fatalf("expected one schedule, got %d", len(schedules))
+		}
+		if schedules[0].Runs >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for schedule runs")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	unscheduleRaw, _ := json.Marshal(map[string]string{"scheduleId": id})
+	if _, rpcErr := manager.unscheduleHandler(context.Background(), unscheduleRaw); rpcErr != nil {
+		t.Fatalf("unscheduleHandler returned rpc error: %v", rpcErr)
+	}
+
+	notify.mu.Lock()
+	defer notify.mu.Unlock()
+	if len(notify.events) != 1 {
+		t.Fatalf("expected unchanged results to be suppressed, got %d notifications", len(notify.events))
+	}
+}
+
+func TestScheduleManagerValidation(t *testing.T) {
+	manager := newScheduleManager(nil, newRecordingNotifier())
+
+	cases := map[string]map[string]any{
+		"interval too small": {
+			"connection": map[string]string{"driver": "postgres", "dsn": "x"},
+			"sql":        "SELECT 1",
+			"options":    map[string]any{"intervalSeconds": 0.1},
+		},
+		"diff without keys": {
+			"connection": map[string]string{"driver": "postgres", "dsn": "x"},
+			"sql":        "SELECT 1",
+			"options":    map[string]any{"intervalSeconds": 5, "mode": "diff"},
+		},
+		"missing sql": {
+			"connection": map[string]string{"driver": "postgres", "dsn": "x"},
+			"options":    map[string]any{"intervalSeconds": 5},
+		},
+	}
+	for name, params := range cases {
+		raw, _ := json.Marshal(params)
+		if _, rpcErr := manager.scheduleHandler(context.Background(), raw); rpcErr == nil {
+			t.Fatalf("%s: expected rpc error", name)
+		}
+	}
+
+	raw, _ := json.Marshal(map[string]string{"scheduleId": "sched-404"})
+	if _, rpcErr := manager.unscheduleHandler(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32071 {
+		t.Fatalf("expected schedule not found error, got %+v", rpcErr)
+	}
+}
+
+func TestScheduleBelongsToItsSession(t *testing.T) {
+	var runs atomic.Int64
+	execute := func(context.Context, executeParams) (any, *rpc.Error) {
+		runs.Add(1)
+		return executeResult{Columns: []column{{Name: "n"}}, Rows: [][]interface{}{{int64(1)}}}, nil
+	}
+	manager := newScheduleManager(execute, nil)
+	manager.minInterval = 0
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("query.schedule", manager.scheduleHandler)
+	server.Register("query.unschedule", manager.unscheduleHandler)
+	server.Register("query.schedule.list", manager.listHandler)
+	owner := connectMatrixClient(t, server, "")
+	other := connectMatrixClient(t, server, "")
+
+	var info scheduleInfo
+	owner.mustCall("query.schedule", map[string]any{
+		"connection": map[string]string{"driver": "postgres", "dsn": "postgresql://example"},
+		"sql":        "SELECT 1 AS n",
+		"options":    map[string]any{"intervalSeconds": 0.01},
+	}, &info)
+	owner.await("query.schedule.result")
+	owner.await("query.schedule.result")
+
+	var listed struct {
+		Schedules []scheduleInfo `json:"schedules"`
+	}
+	other.mustCall("query.schedule.list", nil, &listed)
+	if len(listed.Schedules) != 0 {
+		t.Fatalf("another session listed %+v", listed.Schedules)
+	}
+	if rpcErr := other.call("query.unschedule", map[string]string{"scheduleId": info.ScheduleID}, nil); rpcErr == nil || rpcErr.Code != -32071 {
+		t.Fatalf("another session unscheduled: %+v", rpcErr)
+	}
+	if len(other.notifications) != 0 {
+		t.Fatalf("another session received %s", other.notifications[0].Method)
+	}
+
+	// Disconnecting the owner stops the schedule.
+	owner.requests.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		manager.mu.Lock()
+		remaining := len(manager.entries)
+		manager.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the schedule outlived its session")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// A tick that raced the cancellation may still run once.
+	time.Sleep(20 * time.Millisecond)
+	stopped := runs.Load()
+	time.Sleep(50 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Fatal("the schedule kept running after its session closed")
+	}
+}
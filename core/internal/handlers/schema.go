@@ -10,7 +10,6 @@ import (
 	"github.com/fluxgrid/core/internal/logging"
 	"github.com/fluxgrid/core/internal/rpc"
 	"github.com/fluxgrid/core/internal/schema"
-	"github.com/jackc/pgx/v5"
 )
 
 type connectionFactory func(ctx context.Context, dsn string) (schema.Conn, func(), error)
@@ -18,25 +17,30 @@ type connectionFactory func(ctx context.Context, dsn string) (schema.Conn, func(
 var defaultSchemaService = schema.NewPostgresService()
 
 type dbConnectionParams struct {
-	Driver string `json:"driver"`
-	DSN    string `json:"dsn"`
+	Driver string `json:"driver" jsonschema:"required"`
+	DSN    string `json:"dsn" jsonschema:"required"`
 }
 
 type schemaListOptions struct {
 	TimeoutSeconds int    `json:"timeoutSeconds"`
 	Search         string `json:"search"`
+	// Refresh bypasses the schema cache.
+	Refresh bool `json:"refresh"`
 }
 
 type schemaListParams struct {
-	Connection dbConnectionParams `json:"connection"`
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
 	Options    schemaListOptions  `json:"options"`
 }
 
 type schemaListResult struct {
 	Schemas []schema.Schema `json:"schemas"`
+	Cached  bool            `json:"cached,omitempty"`
 }
 
-func schemaListHandler(service schema.Service, factory connectionFactory) rpc.HandlerFunc {
+// schemaListHandler lists schema objects, serving repeated requests from cache when one is
+// given. Entries are invalidated when DDL runs on the same connection.
+func schemaListHandler(service schema.Service, factory connectionFactory, cache *schema.Cache) rpc.HandlerFunc {
 	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
 		var payload schemaListParams
 		if err := json.Unmarshal(params, &payload); err != nil {
@@ -47,17 +51,17 @@ func schemaListHandler(service schema.Service, factory connectionFactory) rpc.Ha
 			}
 		}
 
-		if payload.Connection.Driver != "postgres" {
+		if payload.Connection.Driver != "postgres" && payload.Connection.Driver != "sqlite" {
 			return nil, &rpc.Error{
 				Code:    -32601,
 				Message: fmt.Sprintf("driver not supported: %s", payload.Connection.Driver),
 			}
 		}
 
-		if payload.Connection.DSN == "" {
-			return nil, &rpc.Error{
-				Code:    -32602,
-				Message: "DSN is required",
+		connKey := schema.ConnectionKey(payload.Connection.DSN)
+		if cache != nil && !payload.Options.Refresh {
+			if cached, ok := cache.Get(connKey, payload.Options.Search); ok {
+				return schemaListResult{Schemas: cached.Schemas, Cached: true}, nil
 			}
 		}
 
@@ -69,19 +73,27 @@ func schemaListHandler(service schema.Service, factory connectionFactory) rpc.Ha
 		timeoutCtx, cancelTimeout := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 		defer cancelTimeout()
 
-		conn, cleanup, err := factory(timeoutCtx, payload.Connection.DSN)
-		if err != nil {
-			return nil, &rpc.Error{
-				Code:    -32010,
-				Message: "failed to connect to database",
-				Data:    err.Error(),
+		var (
+			result schema.ListResponse
+			err    error
+		)
+		if payload.Connection.Driver == "sqlite" {
+			// Attached databases are listed as schemas.
+			result, err = listSQLiteSchemas(timeoutCtx, payload)
+		} else {
+			conn, cleanup, connErr := factory(timeoutCtx, payload.Connection.DSN)
+			if connErr != nil {
+				return nil, &rpc.Error{
+					Code:    -32010,
+					Message: "failed to connect to database",
+					Data:    connErr.Error(),
+				}
 			}
+			defer cleanup()
+			result, err = service.List(timeoutCtx, conn, schema.ListRequest{
+				Search: payload.Options.Search,
+			})
 		}
-		defer cleanup()
-
-		result, err := service.List(timeoutCtx, conn, schema.ListRequest{
-			Search: payload.Options.Search,
-		})
 		if err != nil {
 			return nil, &rpc.Error{
 				Code:    -32040,
@@ -90,12 +102,15 @@ func schemaListHandler(service schema.Service, factory connectionFactory) rpc.Ha
 			}
 		}
 
+		if cache != nil {
+			cache.Put(connKey, payload.Options.Search, result)
+		}
 		return schemaListResult{Schemas: result.Schemas}, nil
 	}
 }
 
 type ddlGetParams struct {
-	Connection dbConnectionParams `json:"connection"`
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
 	Target     struct {
 		Schema string `json:"schema"`
 		Name   string `json:"name"`
@@ -182,7 +197,7 @@ func ddlGetHandler(service schema.Service, factory connectionFactory) rpc.Handle
 }
 
 func pgxConnectionFactory(ctx context.Context, dsn string) (schema.Conn, func(), error) {
-	conn, err := pgx.Connect(ctx, dsn)
+	conn, _, err := connectPostgres(ctx, dsn)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/schema"
+)
+
+const schemaCacheTTL = 10 * time.Minute
+
+// tenantNotifier emits notifications to the clients of one tenant; *rpc.Server satisfies it.
+type tenantNotifier interface {
+	NotifyTenant(tenant, method string, params interface{}) error
+}
+
+// publishSchemaChanges invalidates the cached schema listings of the connection after DDL
+// and emits schema.changed so the clients of the caller's tenant can refresh the affected
+// tree nodes. Other tenants never learn about the objects.
+func publishSchemaChanges(ctx context.Context, notify tenantNotifier, schemas *schema.Cache, payload executeParams, result any) {
+	execResult, ok := result.(executeResult)
+	if !ok || len(execResult.Affected) == 0 {
+		return
+	}
+
+	if schemas != nil {
+		schemas.Invalidate(schema.ConnectionKey(payload.Connection.DSN))
+	}
+	if payload.Connection.Driver == "postgres" {
+		postgresPools.prepared.invalidate(payload.Connection.DSN, execResult.Affected)
+	}
+
+	event := map[string]any{
+		"driver":  payload.Connection.Driver,
+		"objects": execResult.Affected,
+		"schemas": affectedSchemas(execResult.Affected),
+		"tables":  affectedTables(execResult.Affected),
+	}
+	if requestID, ok := rpc.RequestIDFromContext(ctx); ok {
+		event["requestId"] = requestID
+	}
+	if err := notify.NotifyTenant(tenantOf(ctx), "schema.changed", event); err != nil {
+		logger := logging.Logger()
+		logger.Error().Err(err).Msg("failed to send schema.changed notification")
+	}
+}
+
+func affectedSchemas(objects []ddl.Object) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		name := obj.Schema
+		if obj.Kind == "schema" {
+			name = obj.Name
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// affectedTables returns schema-qualified names of the tables and views whose tree nodes
+// changed, including the parents of indexes and triggers and both names of a rename.
+func affectedTables(objects []ddl.Object) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(schemaName, name string) {
+		if name == "" {
+			return
+		}
+		qualified := name
+		if schemaName != "" {
+			qualified = schemaName + "." + name
+		}
+		if !seen[qualified] {
+			seen[qualified] = true
+			names = append(names, qualified)
+		}
+	}
+
+	for _, obj := range objects {
+		switch obj.Kind {
+		case "table", "foreign table", "view", "materialized view":
+			add(obj.Schema, obj.Name)
+			add(obj.Schema, obj.NewName)
+		case "index", "trigger":
+			add(obj.Schema, obj.Table)
+		}
+	}
+	return names
+}
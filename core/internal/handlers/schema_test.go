@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/fluxgrid/core/internal/ddl"
 	"github.com/fluxgrid/core/internal/schema"
 )
 
@@ -52,7 +53,7 @@ func TestSchemaListHandlerSuccess(t *testing.T) {
 
 	handler := schemaListHandler(svc, connectionFactory(func(context.Context, string) (schema.Conn, func(), error) {
 		return nil, func() {}, nil
-	}))
+	}), nil)
 
 	params := map[string]any{
 		"connection": map[string]string{
@@ -105,3 +106,50 @@ func TestSchemaDDLHandlerMissingTarget(t *testing.T) {
 		t.Fatalf("expected rpc error for missing name")
 	}
 }
+
+func TestSchemaListCacheInvalidatedByDDL(t *testing.T) {
+	svc := &stubSchemaService{listResp: schema.ListResponse{Schemas: []schema.Schema{{Name: "public"}}}}
+	cache := schema.NewCache(0)
+	handler := schemaListHandler(svc, connectionFactory(func(context.Context, string) (schema.Conn, func(), error) {
+		return nil, func() {}, nil
+	}), cache)
+
+	var payload executeParams
+	payload.Connection.Driver = "postgres"
+	payload.Connection.DSN = "postgresql://example"
+	raw, _ := json.Marshal(map[string]any{"connection": payload.Connection})
+
+	list := func() schemaListResult {
+		svc.listCalled = false
+		result, rpcErr := handler(context.Background(), raw)
+		if rpcErr != nil {
+			t.Fatalf("handler returned rpc error: %v", rpcErr)
+		}
+		return result.(schemaListResult)
+	}
+
+	list()
+	if cached := list(); !cached.Cached || svc.listCalled {
+		t.Fatalf("expected second listing to come from cache, got %+v", cached)
+	}
+
+	notify := newRecordingNotifier()
+	publishSchemaChanges(context.Background(), notify, cache, payload, executeResult{
+		Affected: []ddl.Object{
+			{Action: ddl.ActionCreate, Kind: "index", Schema: "public", Name: "orders_idx", Table: "orders"},
+			{Action: ddl.ActionRename, Kind: "table", Schema: "public", Name: "users", NewName: "customers"},
+		},
+	})
+
+	events := notify.waitFor(t, 1)
+	if events[0].method != "schema.changed" {
+		t.Fatalf("unexpected notification %+v", events[0])
+	}
+	tables := events[0].params["tables"].([]string)
+	if len(tables) != 3 || tables[0] != "public.orders" || tables[2] != "public.customers" {
+		t.Fatalf("unexpected affected tables %v", tables)
+	}
+	if fresh := list(); fresh.Cached || !svc.listCalled {
+		t.Fatal("expected listing to be reloaded after DDL")
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+type sequenceListParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	// Table restricts the list to the sequences feeding one table.
+	Table   string `json:"table"`
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type sequenceListResult struct {
+	Sequences []tablequery.Sequence `json:"sequences"`
+	SQL       string                `json:"sql"`
+}
+
+// listSequences reads the sequences of a schema, or of one table, returning the query it
+// ran.
+func listSequences(
+	dialect tablequery.Dialect,
+	run func(sql string, args []any, maxRows int) (executeResult, *rpc.Error),
+	schema, table string,
+) ([]tablequery.Sequence, string, *rpc.Error) {
+	if sql := tablequery.SequenceTableSQL(dialect, schema); sql != "" {
+		result, rpcErr := run(sql, nil, 1)
+		if rpcErr != nil {
+			return nil, "", rpcErr
+		}
+		if n, _ := countValue(firstCell(result)); n == 0 {
+			return []tablequery.Sequence{}, "", nil
+		}
+	}
+	sql := tablequery.SequencesSQL(dialect, schema, table)
+	result, rpcErr := run(sql, nil, maxForeignKeyRows)
+	if rpcErr != nil {
+		return nil, "", rpcErr
+	}
+	sequences, err := tablequery.ParseSequences(result.Rows)
+	if err != nil {
+		return nil, "", &rpc.Error{Code: -32012, Message: "failed to read sequences", Data: err.Error()}
+	}
+	return sequences, sql, nil
+}
+
+func firstCell(result executeResult) any {
+	if len(result.Rows) == 0 || len(result.Rows[0]) == 0 {
+		return nil
+	}
+	return result.Rows[0][0]
+}
+
+func sequenceListHandler(execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload sequenceListParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+		sequences, sql, rpcErr := listSequences(dialect, run, payload.Schema, payload.Table)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return sequenceListResult{Sequences: sequences, SQL: sql}, nil
+	}
+}
+
+type sequenceResetParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Schema     string             `json:"schema"`
+	// Table and Sequence select the sequence; either may be left out when the other
+	// identifies it.
+	Table    string `json:"table"`
+	Sequence string `json:"sequence"`
+	// RestartWith is the next value to hand out. It defaults to one past the largest value
+	// of the column the sequence feeds.
+	RestartWith *int64 `json:"restartWith"`
+	// DryRun returns the statement without running it.
+	DryRun  bool `json:"dryRun"`
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+		// AllowCollision permits restarting at or below a value the column already holds.
+		AllowCollision bool `json:"allowCollision"`
+	} `json:"options"`
+}
+
+type sequenceResetResult struct {
+	// Sequence is the sequence as it was before the reset.
+	Sequence    tablequery.Sequence `json:"sequence"`
+	RestartWith int64               `json:"restartWith"`
+	// ColumnMax is the largest value of the column the sequence feeds.
+	ColumnMax       *int64  `json:"columnMax"`
+	SQL             string  `json:"sql"`
+	Args            []any   `json:"args,omitempty"`
+	Applied         bool    `json:"applied"`
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+}
+
+// sequenceResetHandler restarts a sequence or AUTO_INCREMENT counter. Restarting below the
+// values its column already holds would hand them out again, so it is refused unless
+// allowed explicitly.
+func sequenceResetHandler(execute classicExecutor, runEdits statementRunner) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload sequenceResetParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if payload.Table == "" && payload.Sequence == "" {
+			return nil, &rpc.Error{Code: -32602, Message: "table or sequence is required"}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+
+		start := time.Now()
+		sequences, _, rpcErr := listSequences(dialect, run, payload.Schema, payload.Table)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		var matches []tablequery.Sequence
+		for _, seq := range sequences {
+			if payload.Sequence == "" || seq.Name == payload.Sequence {
+				matches = append(matches, seq)
+			}
+		}
+		switch {
+		case len(matches) == 0:
+			return nil, &rpc.Error{Code: -32602, Message: "no matching sequence found"}
+		case len(matches) > 1:
+			names := make([]string, len(matches))
+			for i, seq := range matches {
+				names[i] = seq.Name
+			}
+			return nil, &rpc.Error{Code: -32602, Message: "several sequences match; name one", Data: names}
+		}
+		result := sequenceResetResult{Sequence: matches[0]}
+
+		if sql, err := tablequery.SequenceMaxSQL(dialect, result.Sequence); err == nil {
+			highest, rpcErr := run(sql, nil, 1)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			if n, ok := countValue(firstCell(highest)); ok {
+				columnMax := int64(n)
+				result.ColumnMax = &columnMax
+			}
+		}
+		switch {
+		case payload.RestartWith != nil:
+			result.RestartWith = *payload.RestartWith
+		case result.Sequence.Column == "":
+			return nil, &rpc.Error{Code: -32602, Message: "restartWith is required for a sequence that feeds no column"}
+		case result.ColumnMax != nil:
+			result.RestartWith = *result.ColumnMax + 1
+		default:
+			result.RestartWith = 1
+		}
+		if result.ColumnMax != nil && result.RestartWith <= *result.ColumnMax && !payload.Options.AllowCollision {
+			return nil, &rpc.Error{
+				Code: -32602,
+				Message: fmt.Sprintf("restarting at %d would hand out values up to %d that %s already holds; set options.allowCollision to restart anyway",
+					result.RestartWith, *result.ColumnMax, result.Sequence.Column),
+				Data: result,
+			}
+		}
+
+		stmt, err := tablequery.BuildSequenceReset(dialect, result.Sequence, result.RestartWith)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: err.Error()}
+		}
+		result.SQL, result.Args = stmt.SQL, stmt.Args
+		if !payload.DryRun {
+			_, _, rpcErr := runEdits(ctx, payload.Connection, payload.Options.TimeoutSeconds, txRetry{}, []tablequery.Statement{stmt},
+				func(int, int64) *rpc.Error { return nil })
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			result.Applied = true
+		}
+		result.ExecutionTimeMs = time.Since(start).Seconds() * 1000
+		return result, nil
+	}
+}
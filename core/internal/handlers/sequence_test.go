@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+)
+
+func TestSequenceResetGuardsExistingValues(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE plain (name TEXT)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY AUTOINCREMENT, note TEXT)`,
+		`INSERT INTO orders (note) VALUES ('a'), ('b'), ('c')`,
+		`DELETE FROM orders WHERE id = 3`,
+		`INSERT INTO orders (id, note) VALUES (40, 'loaded')`,
+		`UPDATE sqlite_sequence SET seq = 3 WHERE name = 'orders'`,
+	)
+	conn := `"connection":{"driver":"sqlite","dsn":"` + dsn + `"}`
+
+	raw, rpcErr := sequenceListHandler(executeClassic)(context.Background(), json.RawMessage(`{`+conn+`}`))
+	if rpcErr != nil {
+		t.Fatalf("sequence.list: %+v", rpcErr)
+	}
+	list := raw.(sequenceListResult)
+	if len(list.Sequences) != 1 || list.Sequences[0].Column != "id" || *list.Sequences[0].NextValue != 4 || list.SQL == "" {
+		t.Fatalf("unexpected list %+v", list)
+	}
+
+	reset := sequenceResetHandler(executeClassic, runStatements)
+	if _, rpcErr := reset(context.Background(), json.RawMessage(`{`+conn+`,"table":"orders","restartWith":10}`)); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected a colliding restart to be refused, got %+v", rpcErr)
+	}
+	raw, rpcErr = reset(context.Background(), json.RawMessage(`{`+conn+`,"table":"orders","dryRun":true}`))
+	if rpcErr != nil {
+		t.Fatalf("sequence.reset: %+v", rpcErr)
+	}
+	if got := raw.(sequenceResetResult); got.RestartWith != 41 || got.Applied || got.SQL == "" {
+		t.Fatalf("unexpected dry run %+v", got)
+	}
+	if _, rpcErr = reset(context.Background(), json.RawMessage(`{`+conn+`,"table":"orders"}`)); rpcErr != nil {
+		t.Fatalf("sequence.reset: %+v", rpcErr)
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`INSERT INTO orders (note) VALUES ('next')`); err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := db.QueryRow(`SELECT id FROM orders WHERE note = 'next'`).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id != 41 {
+		t.Fatalf("next id = %d, want 41", id)
+	}
+}
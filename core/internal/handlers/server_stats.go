@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/serverstats"
+)
+
+const maxTopQueries = 100
+
+// serverConnections opens connections for the server.* methods, which read server-wide
+// statistics through driver-specific views.
+type serverConnections struct {
+	postgres connectionFactory
+	mysql    sqlOpener
+}
+
+func defaultServerConnections() serverConnections {
+	return serverConnections{postgres: pgxConnectionFactory, mysql: defaultSQLOpener("mysql")}
+}
+
+// run opens conn with a timeout and calls the function for its driver.
+func (c serverConnections) run(
+	ctx context.Context,
+	conn dbConnectionParams,
+	timeoutSeconds int,
+	postgres func(context.Context, serverstats.Conn) error,
+	mysql func(context.Context, *sql.DB) error,
+) *rpc.Error {
+	if timeoutSeconds <= 0 {
+		timeoutSeconds = 15
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	var err error
+	switch conn.Driver {
+	case "postgres":
+		pg, cleanup, cerr := c.postgres(timeoutCtx, conn.DSN)
+		if cerr != nil {
+			return connectError(cerr)
+		}
+		defer cleanup()
+		err = postgres(timeoutCtx, pg)
+	case "mysql":
+		db, cerr := c.mysql(timeoutCtx, conn.DSN)
+		if cerr != nil {
+			return connectError(cerr)
+		}
+		defer db.Close()
+		err = mysql(timeoutCtx, db)
+	default:
+		return &rpc.Error{
+			Code:    -32601,
+			Message: fmt.Sprintf("driver not supported: %s", conn.Driver),
+		}
+	}
+	if err != nil {
+		return serverStatsError(err)
+	}
+	return nil
+}
+
+type serverTopQueriesParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Options    struct {
+		OrderBy string `json:"orderBy" jsonschema:"enum=totalTime|meanTime|calls|rows"`
+		Limit   int    `json:"limit"`
+		// AllDatabases includes statements run against other databases of the server.
+		AllDatabases   bool `json:"allDatabases"`
+		TimeoutSeconds int  `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type serverTopQueriesResult struct {
+	// Source names the statistics view the statements were read from.
+	Source     string                  `json:"source"`
+	Statements []serverstats.Statement `json:"statements"`
+}
+
+// serverTopQueriesHandler returns the heaviest statements recorded by pg_stat_statements or
+// the MySQL performance_schema digest summary.
+func serverTopQueriesHandler(conns serverConnections) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload serverTopQueriesParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Options.Limit > maxTopQueries {
+			payload.Options.Limit = maxTopQueries
+		}
+		req := serverstats.TopRequest{
+			OrderBy:      serverstats.Order(payload.Options.OrderBy),
+			Limit:        payload.Options.Limit,
+			AllDatabases: payload.Options.AllDatabases,
+		}
+
+		var result serverTopQueriesResult
+		rpcErr := conns.run(ctx, payload.Connection, payload.Options.TimeoutSeconds,
+			func(ctx context.Context, conn serverstats.Conn) (err error) {
+				result.Source = "pg_stat_statements"
+				result.Statements, err = serverstats.TopQueriesPostgres(ctx, conn, req)
+				return err
+			},
+			func(ctx context.Context, db *sql.DB) (err error) {
+				result.Source = "performance_schema"
+				result.Statements, err = serverstats.TopQueriesMySQL(ctx, db, req)
+				return err
+			})
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if result.Statements == nil {
+			result.Statements = []serverstats.Statement{}
+		}
+		return result, nil
+	}
+}
+
+type serverLocksParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Options    struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+// serverLocksHandler returns the sessions waiting for locks and the sessions blocking them.
+func serverLocksHandler(conns serverConnections) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload serverLocksParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+
+		var report serverstats.LockReport
+		rpcErr := conns.run(ctx, payload.Connection, payload.Options.TimeoutSeconds,
+			func(ctx context.Context, conn serverstats.Conn) (err error) {
+				report, err = serverstats.LocksPostgres(ctx, conn)
+				return err
+			},
+			func(ctx context.Context, db *sql.DB) (err error) {
+				report, err = serverstats.LocksMySQL(ctx, db)
+				return err
+			})
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return report, nil
+	}
+}
+
+type serverTerminateParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	PID        int64              `json:"pid" jsonschema:"required"`
+	// CancelOnly cancels the running statement instead of closing the session.
+	CancelOnly bool `json:"cancelOnly"`
+}
+
+type serverTerminateResult struct {
+	PID        int64 `json:"pid"`
+	Terminated bool  `json:"terminated"`
+}
+
+// serverTerminateHandler ends a session found by server.locks, typically a root blocker.
+func serverTerminateHandler(conns serverConnections) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload serverTerminateParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.PID <= 0 {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "pid must be positive",
+			}
+		}
+
+		result := serverTerminateResult{PID: payload.PID}
+		rpcErr := conns.run(ctx, payload.Connection, 0,
+			func(ctx context.Context, conn serverstats.Conn) (err error) {
+				result.Terminated, err = serverstats.TerminatePostgres(ctx, conn, payload.PID, payload.CancelOnly)
+				return err
+			},
+			func(ctx context.Context, db *sql.DB) (err error) {
+				result.Terminated, err = serverstats.TerminateMySQL(ctx, db, payload.PID, payload.CancelOnly)
+				return err
+			})
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return result, nil
+	}
+}
+
+func connectError(err error) *rpc.Error {
+	return &rpc.Error{
+		Code:    -32010,
+		Message: "failed to connect to database",
+		Data:    err.Error(),
+	}
+}
+
+func serverStatsError(err error) *rpc.Error {
+	if errors.Is(err, serverstats.ErrUnavailable) {
+		return &rpc.Error{
+			Code:    -32110,
+			Message: err.Error(),
+		}
+	}
+	return &rpc.Error{
+		Code:    -32111,
+		Message: "failed to read server statistics",
+		Data:    err.Error(),
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fluxgrid/core/internal/schema"
+)
+
+func TestServerTopQueriesHandlerMySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	mock.ExpectQuery("select @@performance_schema").
+		WillReturnRows(sqlmock.NewRows([]string{"@@performance_schema"}).AddRow(1))
+	mock.ExpectQuery("events_statements_summary_by_digest").
+		WithArgs(maxTopQueries).
+		WillReturnRows(sqlmock.NewRows([]string{"digest", "text", "schema", "calls", "total", "mean", "rows"}).
+			AddRow("ab12", "SELECT ?", "shop", 3, 1.5, 0.5, 3))
+	mock.ExpectClose()
+
+	handler := serverTopQueriesHandler(serverConnections{
+		mysql: func(context.Context, string) (*sql.DB, error) { return db, nil },
+	})
+	params := json.RawMessage(`{"connection":{"driver":"mysql","dsn":"mock"},"options":{"limit":1000}}`)
+	result, rpcErr := handler(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	top := result.(serverTopQueriesResult)
+	if top.Source != "performance_schema" || len(top.Statements) != 1 || top.Statements[0].Calls != 3 {
+		t.Fatalf("unexpected result %+v", top)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestServerTopQueriesHandlerErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	mock.ExpectQuery("select @@performance_schema").
+		WillReturnRows(sqlmock.NewRows([]string{"@@performance_schema"}).AddRow(0))
+	mock.ExpectClose()
+
+	handler := serverTopQueriesHandler(serverConnections{
+		postgres: func(context.Context, string) (schema.Conn, func(), error) { return nil, nil, sql.ErrConnDone },
+		mysql:    func(context.Context, string) (*sql.DB, error) { return db, nil },
+	})
+	for params, code := range map[string]int{
+		`{"connection":{"driver":"mysql","dsn":"mock"}}`:    -32110,
+		`{"connection":{"driver":"postgres","dsn":"mock"}}`: -32010,
+		`{"connection":{"driver":"sqlite","dsn":"mock"}}`:   -32601,
+	} {
+		if _, rpcErr := handler(context.Background(), json.RawMessage(params)); rpcErr == nil || rpcErr.Code != code {
+			t.Errorf("%s: expected code %d, got %+v", params, code, rpcErr)
+		}
+	}
+}
+
+func TestServerTerminateHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	mock.ExpectExec("KILL QUERY 42").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectClose()
+
+	handler := serverTerminateHandler(serverConnections{
+		mysql: func(context.Context, string) (*sql.DB, error) { return db, nil },
+	})
+	if _, rpcErr := handler(context.Background(), json.RawMessage(`{"connection":{"driver":"mysql","dsn":"mock"},"pid":0}`)); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected a missing pid to be refused, got %+v", rpcErr)
+	}
+	result, rpcErr := handler(context.Background(), json.RawMessage(`{"connection":{"driver":"mysql","dsn":"mock"},"pid":42,"cancelOnly":true}`))
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %+v", rpcErr)
+	}
+	if got := result.(serverTerminateResult); got != (serverTerminateResult{PID: 42, Terminated: true}) {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
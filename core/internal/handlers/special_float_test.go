@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rowbuf"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestExecuteClassicTagsInfiniteFloats(t *testing.T) {
+	dsn := searchDB(t)
+	run := func(mode string) []any {
+		var payload executeParams
+		payload.Connection.Driver, payload.Connection.DSN = "sqlite", dsn
+		payload.SQL = "SELECT 9e999, -9e999, 1.5"
+		payload.Options.TimeoutSeconds, payload.Options.MaxRows, payload.Options.SpecialFloats = 10, 10, mode
+		raw, rpcErr := executeClassic(context.Background(), payload)
+		if rpcErr != nil {
+			t.Fatalf("%s: %+v", mode, rpcErr)
+		}
+		return raw.(executeResult).Rows[0]
+	}
+
+	row := run("")
+	if row[0] != (resultset.SpecialFloat{Value: "Infinity"}) || row[1] != (resultset.SpecialFloat{Value: "-Infinity"}) || row[2] != 1.5 {
+		t.Fatalf("unexpected tagged row %#v", row)
+	}
+	row = run(resultset.SpecialFloatsNull)
+	if row[0] != nil || row[1] != nil || row[2] != 1.5 {
+		t.Fatalf("unexpected null row %#v", row)
+	}
+}
+
+func TestStreamRowsTagNaN(t *testing.T) {
+	fields := []pgconn.FieldDescription{{Name: "f", DataTypeOID: pgtype.Float8OID, Format: pgx.BinaryFormatCode}}
+	raw := [][]byte{binary.BigEndian.AppendUint64(nil, math.Float64bits(math.NaN()))}
+	for mode, want := range map[string]string{"": `[{"$float":"NaN"}]`, resultset.SpecialFloatsNull: `[null]`} {
+		encoded, err := rowbuf.NewRowJSON(pgtype.NewMap(), fields, normalizerFor(mode, "")).AppendRow(nil, raw)
+		if err != nil {
+			t.Fatalf("%q: %v", mode, err)
+		}
+		if string(encoded) != want {
+			t.Errorf("%q: got %s, want %s", mode, encoded, want)
+		}
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"time"
+	"unicode/utf8"
 
+	"github.com/fluxgrid/core/internal/ddl"
 	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rowbuf"
 	"github.com/fluxgrid/core/internal/rpc"
 	_ "github.com/go-sql-driver/mysql"
 	_ "modernc.org/sqlite"
@@ -14,8 +18,16 @@ import (
 
 type sqlOpener func(ctx context.Context, dsn string) (*sql.DB, error)
 
+// defaultSQLOpener opens dsn with driverName. A MySQL DSN listing several servers is
+// opened on the first one that can be reached.
 func defaultSQLOpener(driverName string) sqlOpener {
-	return func(_ context.Context, dsn string) (*sql.DB, error) {
+	return func(ctx context.Context, dsn string) (*sql.DB, error) {
+		if driverName == "mysql" {
+			var err error
+			if dsn, _, err = mysqlFailover(ctx, dsn); err != nil {
+				return nil, err
+			}
+		}
 		db, err := sql.Open(driverName, dsn)
 		if err != nil {
 			return nil, err
@@ -33,6 +45,18 @@ func executeClassicSQL(
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(payload.Options.TimeoutSeconds)*time.Second)
 	defer cancel()
 
+	text, err := newResultText(driverName, payload.Connection.DSN, payload.Options.Charset)
+	if err != nil {
+		return nil, &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+
+	start := time.Now()
+	timer := newQueryTimer()
+
 	db, err := open(timeoutCtx, payload.Connection.DSN)
 	if err != nil {
 		return nil, &rpc.Error{
@@ -42,10 +66,28 @@ func executeClassicSQL(
 		}
 	}
 	defer db.Close()
+	// database/sql connects lazily; ping so that connecting is timed on its own.
+	if err := db.PingContext(timeoutCtx); err != nil {
+		return nil, &rpc.Error{
+			Code:    -32010,
+			Message: "failed to connect to database",
+			Data:    err.Error(),
+		}
+	}
+	timer.connected()
+	// MySQL reports warnings through SHOW WARNINGS on the connection that ran the
+	// statement, so the statement runs on a pinned one.
+	conn, err := db.Conn(timeoutCtx)
+	if err != nil {
+		return nil, &rpc.Error{
+			Code:    -32010,
+			Message: "failed to connect to database",
+			Data:    err.Error(),
+		}
+	}
+	defer conn.Close()
 
-	start := time.Now()
-
-	rows, err := db.QueryContext(timeoutCtx, payload.SQL)
+	rows, err := conn.QueryContext(timeoutCtx, tagSQL(ctx, payload.SQL), payload.Args...)
 	if err != nil {
 		return nil, &rpc.Error{
 			Code:    -32011,
@@ -84,9 +126,17 @@ func executeClassicSQL(
 		}
 	}
 
+	text.setColumns(columns)
+	uuids := newUUIDColumns(columns, payload.Options.UUIDFormat)
+
 	var (
-		resultRows [][]interface{}
+		resultRows = make([][]interface{}, 0, min(payload.Options.MaxRows, classicBlockRows))
 		rowCount   int
+		progress   = queryProgressOf(ctx)
+		size       = newResultSize(payload.Options.MaxResultBytes)
+		cells      = rowbuf.NewBatch(len(columnNames), classicBlockRows)
+		intern     = newInterner()
+		normalize  = normalizerFor(payload.Options.SpecialFloats, payload.Options.UUIDFormat)
 	)
 
 	rawValues := make([]interface{}, len(columnNames))
@@ -96,6 +146,7 @@ func executeClassicSQL(
 	}
 
 	for rows.Next() {
+		timer.rowArrived()
 		if rowCount >= payload.Options.MaxRows {
 			break
 		}
@@ -110,12 +161,30 @@ func executeClassicSQL(
 			}
 		}
 
-		row := make([]interface{}, len(columnNames))
+		serializeStart := time.Now()
+		row := cells.NewRow()
 		for i, value := range rawValues {
-			row[i] = normalizeValue(value)
+			if id, ok := uuids.cell(i, value); ok {
+				row[i] = id
+				continue
+			}
+			if b, ok := value.([]byte); ok {
+				row[i] = text.cell(rowCount, i, b, intern)
+				continue
+			}
+			if s, ok := value.(string); ok && !utf8.ValidString(s) {
+				row[i] = text.cell(rowCount, i, []byte(s), intern)
+				continue
+			}
+			row[i] = normalize(value)
+		}
+		timer.serialized(serializeStart)
+		if !size.add(row) {
+			break
 		}
 		resultRows = append(resultRows, row)
 		rowCount++
+		progress.rowRead()
 	}
 
 	if err := rows.Err(); err != nil {
@@ -125,10 +194,19 @@ func executeClassicSQL(
 			Data:    err.Error(),
 		}
 	}
+	rows.Close()
+	timing := timer.finish()
+
+	logger := logging.Logger()
+	notices := noticesFor(ctx)
+	if driverName == "mysql" {
+		if err := collectMySQLWarnings(timeoutCtx, conn, notices); err != nil {
+			logger.Warn().Err(err).Msg("failed to read warnings")
+		}
+	}
 
 	duration := time.Since(start).Seconds() * 1000
 
-	logger := logging.Logger()
 	logger.Info().
 		Str("driver", driverName).
 		Int("row_count", rowCount).
@@ -139,6 +217,12 @@ func executeClassicSQL(
 		Columns:         columns,
 		Rows:            resultRows,
 		ExecutionTimeMs: duration,
+		Timing:          timing,
+		EstimatedBytes:  size.bytes,
+		Oversized:       size.report(),
+		Affected:        ddl.Parse(payload.SQL),
+		Transcoding:     text.result(),
+		Warnings:        notices.list(),
 	}, nil
 }
 
@@ -159,14 +243,17 @@ func (m *mysqlConnectionTester) TestConnection(ctx context.Context, params conne
 	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
 	defer cancel()
 
-	db, err := m.open(timeoutCtx, params.DSN)
+	start := time.Now()
+	dsn, host, err := mysqlFailover(timeoutCtx, params.DSN)
+	if err != nil {
+		return connectTestResult{}, err
+	}
+	db, err := m.open(timeoutCtx, dsn)
 	if err != nil {
 		return connectTestResult{}, err
 	}
 	defer db.Close()
 
-	start := time.Now()
-
 	if err := db.PingContext(timeoutCtx); err != nil {
 		return connectTestResult{}, err
 	}
@@ -176,7 +263,7 @@ func (m *mysqlConnectionTester) TestConnection(ctx context.Context, params conne
 		return connectTestResult{}, err
 	}
 
-	info := map[string]string{}
+	info := map[string]string{"host": host}
 	if params.DSN != "" {
 		info["dsn"] = params.DSN
 	}
@@ -216,14 +303,29 @@ func (s *sqliteConnectionTester) TestConnection(ctx context.Context, params conn
 	if err := db.PingContext(timeoutCtx); err != nil {
 		return connectTestResult{}, err
 	}
+	if err := checkSQLiteKey(timeoutCtx, db, params.DSN); err != nil {
+		return connectTestResult{}, err
+	}
 
 	var version string
 	if err := db.QueryRowContext(timeoutCtx, "SELECT sqlite_version()").Scan(&version); err != nil {
 		return connectTestResult{}, err
 	}
+	var (
+		journalMode string
+		pageSize    int64
+	)
+	if err := db.QueryRowContext(timeoutCtx, "PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		return connectTestResult{}, err
+	}
+	if err := db.QueryRowContext(timeoutCtx, "PRAGMA page_size").Scan(&pageSize); err != nil {
+		return connectTestResult{}, err
+	}
 
 	info := map[string]string{
-		"dsn": params.DSN,
+		"dsn":         params.DSN,
+		"journalMode": journalMode,
+		"pageSize":    strconv.FormatInt(pageSize, 10),
 	}
 
 	return connectTestResult{
@@ -23,6 +23,9 @@ func TestExecuteClassicSQL_Success(t *testing.T) {
 
 	mock.ExpectQuery("SELECT").
 		WillReturnRows(rows)
+	mock.ExpectQuery("SHOW WARNINGS").
+		WillReturnRows(sqlmock.NewRows([]string{"Level", "Code", "Message"}).
+			AddRow("Warning", 1366, "Incorrect integer value"))
 	mock.ExpectClose()
 
 	var payload executeParams
@@ -60,12 +63,51 @@ func TestExecuteClassicSQL_Success(t *testing.T) {
 	if execResult.Rows[1][1] != "Bob" {
 		t.Fatalf("expected second row name to be Bob, got %#v", execResult.Rows[1][1])
 	}
+	if execResult.Timing == nil || execResult.Timing.FetchMs < 0 || execResult.Timing.BackpressureMs != 0 {
+		t.Fatalf("unexpected timing %+v", execResult.Timing)
+	}
+	if len(execResult.Warnings) != 1 || execResult.Warnings[0] != (statementNotice{Severity: "Warning", Code: "1366", Message: "Incorrect integer value"}) {
+		t.Fatalf("unexpected warnings %+v", execResult.Warnings)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Fatalf("expectations not met: %v", err)
 	}
 }
 
+func TestExecuteClassicSQL_StopsWhenOversized(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"id", "name"}).
+		AddRow(int64(1), "Alice").
+		AddRow(int64(2), "Bob")
+	mock.ExpectQuery("SELECT").WillReturnRows(rows)
+	mock.ExpectClose()
+
+	var payload executeParams
+	payload.SQL = "SELECT id, name FROM users"
+	payload.Options.MaxRows = 10
+	payload.Options.TimeoutSeconds = 5
+	// [1,"Alice"] is estimated at 12 bytes, [2,"Bob"] at 10.
+	payload.Options.MaxResultBytes = 15
+
+	result, rpcErr := executeClassicSQL(context.Background(), payload, "mysql",
+		func(context.Context, string) (*sql.DB, error) { return db, nil })
+	if rpcErr != nil {
+		t.Fatalf("unexpected rpc error: %v", rpcErr)
+	}
+	execResult := result.(executeResult)
+	if len(execResult.Rows) != 1 || execResult.EstimatedBytes != 12 {
+		t.Fatalf("expected one row of 12 bytes, got %d rows of %d bytes", len(execResult.Rows), execResult.EstimatedBytes)
+	}
+	if execResult.Oversized == nil || execResult.Oversized.LimitBytes != 15 || execResult.Oversized.Advice == "" {
+		t.Fatalf("expected the result to be flagged oversized, got %+v", execResult.Oversized)
+	}
+}
+
 func TestExecuteClassicSQL_QueryError(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fluxgrid/core/internal/dataimport"
+	"github.com/fluxgrid/core/internal/export"
+	"github.com/fluxgrid/core/internal/tablequery"
+	"modernc.org/sqlite"
+)
+
+// sqliteFilesParam is the DSN query parameter naming a directory whose data files are
+// loaded as tables into an in-memory SQLite database, so that SELECT * FROM 'data.csv'
+// reads the file. SQLite accepts a quoted string where a table name is expected.
+const sqliteFilesParam = "_files"
+
+// maxSQLiteFileBytes caps the size of a data file loaded as a table. Files are read again
+// by every connection, so larger ones should be imported into a database instead.
+const maxSQLiteFileBytes = 256 << 20
+
+// sqliteParquetFormat marks Parquet files, which export reads rather than dataimport.
+const sqliteParquetFormat = "parquet"
+
+// sqliteFileFormats maps the extensions of loadable files to their format and delimiter.
+var sqliteFileFormats = map[string]struct {
+	format    string
+	delimiter string
+}{
+	".csv":     {dataimport.FormatCSV, ""},
+	".tsv":     {dataimport.FormatCSV, "\t"},
+	".json":    {dataimport.FormatJSON, ""},
+	".parquet": {sqliteParquetFormat, ""},
+}
+
+func init() {
+	sqlite.MustRegisterScalarFunction("fluxgrid_file_error", 1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		message, _ := args[0].(string)
+		return nil, errors.New(message)
+	})
+	sqlite.RegisterConnectionHook(loadSQLiteFiles)
+}
+
+// sqliteFilesDSN reports whether dsn opens a private in-memory database, the only kind
+// files are loaded into: loading them into a file or a shared database would write the
+// tables into it once per connection.
+func sqliteFilesDSN(dsn string) bool {
+	path, rawQuery, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	return path == ":memory:" && !strings.Contains(rawQuery, "cache=shared")
+}
+
+// loadSQLiteFiles creates a table for every data file in the directory a DSN names.
+// Files that cannot be loaded become views that fail with the reason when read, so that
+// they are still listed and a query on them says why it failed.
+func loadSQLiteFiles(conn sqlite.ExecQuerierContext, dsn string) error {
+	_, rawQuery, ok := strings.Cut(dsn, "?")
+	if !ok || !strings.Contains(rawQuery, sqliteFilesParam) {
+		return nil
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+	dir := query.Get(sqliteFilesParam)
+	if dir == "" {
+		return nil
+	}
+	if !sqliteFilesDSN(dsn) {
+		return fmt.Errorf("%s needs an in-memory database (:memory:)", sqliteFilesParam)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if entry.IsDir() {
+			continue
+		}
+		if _, ok := sqliteFileFormats[ext]; !ok {
+			continue
+		}
+		statements, err := sqliteFileTable(filepath.Join(dir, name), ext)
+		if err != nil {
+			if err := createSQLiteFileError(ctx, conn, name, fmt.Sprintf("%s: %v", name, err)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, statement := range statements {
+			args := make([]driver.NamedValue, len(statement.Args))
+			for i, arg := range statement.Args {
+				args[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+			}
+			if _, err := conn.ExecContext(ctx, statement.SQL, args); err != nil {
+				return fmt.Errorf("load %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// sqliteFileTable returns the statements that create and fill the table of a data file.
+func sqliteFileTable(path, ext string) ([]tablequery.Statement, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxSQLiteFileBytes {
+		return nil, fmt.Errorf("the file is larger than %d MiB; import it into a database instead", maxSQLiteFileBytes>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := sqliteFileFormats[ext]
+	var table dataimport.Table
+	if format.format == sqliteParquetFormat {
+		table, err = sqliteParquetTable(data)
+	} else {
+		table, err = dataimport.Parse(format.format, data, dataimport.Options{Delimiter: format.delimiter})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tablequery.BuildImport(tablequery.SQLite, "", filepath.Base(path), tablequery.Import{
+		Columns: table.Columns,
+		Kinds:   table.Kinds,
+		Rows:    table.Rows,
+		Create:  true,
+	})
+}
+
+// sqliteParquetTable reads a Parquet file into a table. Columns keep the kind of their
+// Parquet type; dates and timestamps become text SQLite's date functions understand.
+func sqliteParquetTable(data []byte) (dataimport.Table, error) {
+	columns, rows, err := export.ReadParquet(data)
+	if err != nil {
+		return dataimport.Table{}, err
+	}
+	table := dataimport.Table{Rows: rows}
+	for i, column := range columns {
+		kind := dataimport.KindText
+		switch column.Type {
+		case export.TypeBoolean:
+			kind = dataimport.KindBoolean
+		case export.TypeInteger:
+			kind = dataimport.KindInteger
+		case export.TypeFloat:
+			kind = dataimport.KindReal
+		}
+		table.Columns = append(table.Columns, column.Name)
+		table.Kinds = append(table.Kinds, kind)
+		layout := "2006-01-02 15:04:05.999999999"
+		if column.Type == export.TypeDate {
+			layout = time.DateOnly
+		}
+		for _, row := range rows {
+			if value, ok := row[i].(time.Time); ok {
+				row[i] = value.Format(layout)
+			}
+		}
+	}
+	return table, nil
+}
+
+func createSQLiteFileError(ctx context.Context, conn sqlite.ExecQuerierContext, name, reason string) error {
+	statement := "CREATE VIEW " + tablequery.SQLite.Quote(name) +
+		" AS SELECT fluxgrid_file_error('" + strings.ReplaceAll(reason, "'", "''") + "') AS error"
+	_, err := conn.ExecContext(ctx, statement, nil)
+	return err
+}
+
+// sqliteFilesDirectory checks the directory of the files option and returns its absolute
+// path.
+func sqliteFilesDirectory(dsn, dir string) (string, error) {
+	if !sqliteFilesDSN(dsn) {
+		return "", errors.New("files needs the in-memory DSN :memory:")
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return abs, nil
+}
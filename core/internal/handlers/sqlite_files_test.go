@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/export"
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestSQLiteFilesQueryDataFilesAsTables(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"people.csv":     "name,age\nada,36\nalan,41\n",
+		"orders.json":    `[{"id":1,"person":"ada"},{"id":2,"person":"ada","note":"gift"}]`,
+		"broken.parquet": "PAR1",
+		"broken.csv":     "a,b\n1\n",
+		"notes.txt":      "ignored",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var events bytes.Buffer
+	_, err := export.Run(context.Background(), resultset.Set{
+		Columns: []resultset.Column{{Name: "person", DataType: "25"}, {Name: "amount", DataType: "701"}, {Name: "day", DataType: "1082"}},
+		Rows:    [][]any{{"ada", 2.5, "2024-05-01"}, {"alan", nil, "2024-05-02"}, {"ada", 4.0, nil}},
+	}, &events, export.Options{Format: "parquet"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "events.parquet"), events.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	dsn, err := withSQLiteOptions(":memory:", SQLiteOptions{Files: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(sql string) (executeResult, string) {
+		var payload executeParams
+		payload.Connection.Driver, payload.Connection.DSN = "sqlite", dsn
+		payload.SQL = sql
+		payload.Options.TimeoutSeconds, payload.Options.MaxRows = 10, 10
+		result, rpcErr := executeClassic(context.Background(), payload)
+		if rpcErr != nil {
+			return executeResult{}, rpcErr.Message + ": " + rpcErr.Data.(string)
+		}
+		return result.(executeResult), ""
+	}
+
+	result, failure := run(`SELECT p.name, count(*) AS orders FROM 'people.csv' p JOIN 'orders.json' o ON o.person = p.name GROUP BY p.name`)
+	if failure != "" {
+		t.Fatal(failure)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "ada" {
+		t.Fatalf("rows = %v", result.Rows)
+	}
+	result, failure = run(`SELECT person, sum(amount), max(day) FROM 'events.parquet' GROUP BY person ORDER BY person`)
+	if failure != "" {
+		t.Fatal(failure)
+	}
+	if got := fmt.Sprint(result.Rows); got != "[[ada 6.5 2024-05-01] [alan <nil> 2024-05-02]]" {
+		t.Fatalf("parquet rows = %s", got)
+	}
+	if _, failure := run(`SELECT * FROM 'broken.parquet'`); !strings.Contains(failure, "broken.parquet: not a parquet file") {
+		t.Fatalf("broken parquet = %q", failure)
+	}
+	if _, failure := run(`SELECT * FROM 'broken.csv'`); !strings.Contains(failure, "broken.csv: record 1 has 1 fields") {
+		t.Fatalf("broken = %q", failure)
+	}
+
+	params, _ := json.Marshal(schemaListParams{Connection: dbConnectionParams{Driver: "sqlite", DSN: dsn}})
+	listed, rpcErr := schemaListHandler(nil, nil, nil)(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	var tables []string
+	for _, table := range listed.(schemaListResult).Schemas[0].Tables {
+		tables = append(tables, table.Name)
+	}
+	if got := strings.Join(tables, ","); got != "broken.csv,broken.parquet,events.parquet,orders.json,people.csv" {
+		t.Fatalf("tables = %s", got)
+	}
+
+	if _, err := withSQLiteOptions(filepath.Join(dir, "app.db"), SQLiteOptions{Files: dir}); err == nil {
+		t.Fatal("expected files to need an in-memory database")
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/schema"
+	"modernc.org/sqlite"
+)
+
+// sqliteAttachParam is the DSN query parameter naming a database to attach, as
+// schema:path. The driver ignores parameters it does not know, so the core handles it in
+// a connection hook; it may also be written into a DSN or an alias by hand.
+const sqliteAttachParam = "_attach"
+
+var (
+	validSQLiteSchema  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	sqliteJournalModes = []string{"delete", "truncate", "persist", "memory", "wal", "off"}
+)
+
+// SQLiteOptions are applied to every SQLite connection opened for a handle, as each
+// request opens connections of its own.
+type SQLiteOptions struct {
+	// Attach maps schema names to database files attached next to the main database.
+	Attach map[string]string `json:"attach,omitempty"`
+	// ForeignKeys turns enforcement of foreign keys on or off.
+	ForeignKeys *bool `json:"foreignKeys,omitempty"`
+	// JournalMode is delete, truncate, persist, memory, wal or off.
+	JournalMode string `json:"journalMode,omitempty"`
+	// Key opens a database encrypted with SQLCipher or a compatible extension. It is
+	// sent as PRAGMA key before any other setting, and only takes effect when the
+	// SQLite driver is built with encryption support.
+	Key string `json:"key,omitempty"`
+	// Files names a directory whose CSV, TSV and JSON files are loaded as tables named
+	// after the files, as in SELECT * FROM 'data.csv'. It needs the DSN :memory:.
+	Files string `json:"files,omitempty"`
+}
+
+func init() {
+	sqlite.RegisterConnectionHook(attachSQLiteDatabases)
+}
+
+// withSQLiteOptions adds the options to a SQLite DSN as query parameters.
+func withSQLiteOptions(dsn string, options SQLiteOptions) (string, error) {
+	query := url.Values{}
+	if options.Key != "" {
+		query.Add("_pragma", "key('"+strings.ReplaceAll(options.Key, "'", "''")+"')")
+	}
+	names := make([]string, 0, len(options.Attach))
+	for name := range options.Attach {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if !validSQLiteSchema.MatchString(name) || strings.EqualFold(name, "main") || strings.EqualFold(name, "temp") {
+			return "", fmt.Errorf("invalid schema name for an attached database: %q", name)
+		}
+		if options.Attach[name] == "" {
+			return "", fmt.Errorf("attached database %s needs a path", name)
+		}
+		query.Add(sqliteAttachParam, name+":"+options.Attach[name])
+	}
+	if options.ForeignKeys != nil {
+		if *options.ForeignKeys {
+			query.Add("_pragma", "foreign_keys(1)")
+		} else {
+			query.Add("_pragma", "foreign_keys(0)")
+		}
+	}
+	if options.JournalMode != "" {
+		mode := strings.ToLower(options.JournalMode)
+		if !slices.Contains(sqliteJournalModes, mode) {
+			return "", fmt.Errorf("unknown journal mode: %s", options.JournalMode)
+		}
+		query.Add("_pragma", "journal_mode("+mode+")")
+	}
+	if options.Files != "" {
+		dir, err := sqliteFilesDirectory(dsn, options.Files)
+		if err != nil {
+			return "", err
+		}
+		query.Add(sqliteFilesParam, dir)
+	}
+	if len(query) == 0 {
+		return dsn, nil
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + query.Encode(), nil
+}
+
+// sqliteKey returns the encryption key a SQLite DSN sets with a key pragma.
+func sqliteKey(dsn string) string {
+	_, rawQuery, ok := strings.Cut(dsn, "?")
+	if !ok {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	for _, pragma := range query["_pragma"] {
+		if key, ok := sqliteKeyPragma(pragma); ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// sqliteKeyPragma returns the key of a key(...) or key=... pragma.
+func sqliteKeyPragma(pragma string) (string, bool) {
+	lower := strings.ToLower(pragma)
+	var key string
+	switch {
+	case strings.HasPrefix(lower, "key(") && strings.HasSuffix(lower, ")"):
+		key = pragma[len("key(") : len(pragma)-1]
+	case strings.HasPrefix(lower, "key="):
+		key = pragma[len("key="):]
+	default:
+		return "", false
+	}
+	key = strings.TrimSpace(key)
+	if len(key) >= 2 && key[0] == '\'' && key[len(key)-1] == '\'' {
+		key = strings.ReplaceAll(key[1:len(key)-1], "''", "'")
+	}
+	return key, true
+}
+
+// sqliteWithoutKey returns dsn without its key pragma, and whether it had one.
+func sqliteWithoutKey(dsn string) (string, bool) {
+	path, rawQuery, ok := strings.Cut(dsn, "?")
+	if !ok {
+		return dsn, false
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return dsn, false
+	}
+	pragmas := query["_pragma"][:0:0]
+	for _, pragma := range query["_pragma"] {
+		if _, isKey := sqliteKeyPragma(pragma); !isKey {
+			pragmas = append(pragmas, pragma)
+		}
+	}
+	if len(pragmas) == len(query["_pragma"]) {
+		return dsn, false
+	}
+	if len(pragmas) == 0 {
+		query.Del("_pragma")
+	} else {
+		query["_pragma"] = pragmas
+	}
+	if len(query) == 0 {
+		return path, true
+	}
+	return path + "?" + query.Encode(), true
+}
+
+// Codes connect.test reports for encrypted SQLite databases, so that clients can tell a
+// wrong key from a file that needs none.
+const (
+	sqliteNotEncrypted          = "NOT_AN_ENCRYPTED_DB"
+	sqliteWrongKey              = "WRONG_KEY"
+	sqliteKeyRequired           = "KEY_REQUIRED"
+	sqliteEncryptionUnsupported = "ENCRYPTION_UNSUPPORTED"
+)
+
+// sqliteHeader starts every SQLite database file that is not encrypted.
+const sqliteHeader = "SQLite format 3\x00"
+
+// sqliteKeyError explains why an encrypted SQLite database, or a key, was refused.
+type sqliteKeyError struct {
+	Code string
+	Err  error
+}
+
+func (e *sqliteKeyError) Error() string { return e.Err.Error() }
+func (e *sqliteKeyError) Unwrap() error { return e.Err }
+
+// sqliteEncrypted reports whether the file of dsn exists and whether it lacks the header
+// of a plain database. Empty files are new databases, not encrypted ones.
+func sqliteEncrypted(dsn string) (exists, encrypted bool) {
+	path, ok := sqliteFile(dsn)
+	if !ok {
+		return false, false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false, false
+	}
+	defer file.Close()
+	header := make([]byte, len(sqliteHeader))
+	n, _ := io.ReadFull(file, header)
+	return true, n > 0 && string(header[:n]) != sqliteHeader
+}
+
+// checkSQLiteKey matches the key of dsn, if any, against the file it opens.
+func checkSQLiteKey(ctx context.Context, db *sql.DB, dsn string) error {
+	key := sqliteKey(dsn)
+	exists, encrypted := sqliteEncrypted(dsn)
+	switch {
+	case key != "" && exists && !encrypted:
+		return &sqliteKeyError{Code: sqliteNotEncrypted, Err: errors.New("the database is not encrypted; connect without a key")}
+	case key == "" && encrypted:
+		return &sqliteKeyError{Code: sqliteKeyRequired, Err: errors.New("the file is not a plain SQLite database; if it is encrypted, connect with its key")}
+	case !encrypted:
+		return nil
+	}
+	// Builds without encryption support ignore the key and cipher pragmas alike.
+	var cipher string
+	if err := db.QueryRowContext(ctx, "PRAGMA cipher_version").Scan(&cipher); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return &sqliteKeyError{Code: sqliteEncryptionUnsupported, Err: errors.New("this build of the core cannot open encrypted SQLite databases")}
+		}
+		return err
+	}
+	var tables int
+	if err := db.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").Scan(&tables); err != nil {
+		return &sqliteKeyError{Code: sqliteWrongKey, Err: fmt.Errorf("the key does not open the database: %w", err)}
+	}
+	return nil
+}
+
+// attachSQLiteDatabases attaches the databases a DSN names to a new connection.
+func attachSQLiteDatabases(conn sqlite.ExecQuerierContext, dsn string) error {
+	_, rawQuery, ok := strings.Cut(dsn, "?")
+	if !ok || !strings.Contains(rawQuery, sqliteAttachParam) {
+		return nil
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return err
+	}
+	for _, value := range query[sqliteAttachParam] {
+		name, path, _ := strings.Cut(value, ":")
+		if !validSQLiteSchema.MatchString(name) || path == "" {
+			return fmt.Errorf("invalid %s parameter: %q", sqliteAttachParam, value)
+		}
+		statement := `ATTACH DATABASE ? AS "` + name + `"`
+		if _, err := conn.ExecContext(context.Background(), statement, []driver.NamedValue{{Ordinal: 1, Value: path}}); err != nil {
+			return fmt.Errorf("attach %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func listSQLiteSchemas(ctx context.Context, payload schemaListParams) (schema.ListResponse, error) {
+	db, err := defaultSQLOpener("sqlite")(ctx, payload.Connection.DSN)
+	if err != nil {
+		return schema.ListResponse{}, err
+	}
+	defer db.Close()
+	return schema.ListSQLite(ctx, db, schema.ListRequest{Search: payload.Options.Search})
+}
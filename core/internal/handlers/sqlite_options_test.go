@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func TestSQLiteHandleAttachesDatabasesAndSetsPragmas(t *testing.T) {
+	main := searchDB(t, "CREATE TABLE orders (id INTEGER PRIMARY KEY, customer_id INTEGER REFERENCES customers(id))")
+	archive := searchDB(t, "CREATE TABLE old_orders (id INTEGER NOT NULL)", "INSERT INTO old_orders VALUES (7)")
+
+	c := connectTo(t, handleServer(false, nil))
+	line := c("connection.open", `{"driver":"sqlite","dsn":"`+main+`","sqlite":{"attach":{"archive":"`+archive+`"},"foreignKeys":true,"journalMode":"WAL"}}`)
+	var opened struct {
+		Result connectionOpenResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &opened); err != nil || opened.Result.Handle == "" {
+		t.Fatalf("expected a handle, got %s", line)
+	}
+	line = c("probe", `{"connection":{"handle":"`+opened.Result.Handle+`"}}`)
+	var probed struct {
+		Result struct {
+			Connection dbConnectionParams `json:"connection"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &probed); err != nil {
+		t.Fatal(err)
+	}
+	conn := probed.Result.Connection
+	run := func(sql string) (any, *rpc.Error) {
+		var payload executeParams
+		payload.Connection.Driver, payload.Connection.DSN = conn.Driver, conn.DSN
+		payload.SQL = sql
+		payload.Options.TimeoutSeconds, payload.Options.MaxRows = 10, 10
+		return executeClassic(context.Background(), payload)
+	}
+
+	result, rpcErr := run("SELECT id FROM archive.old_orders")
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if rows := result.(executeResult).Rows; len(rows) != 1 {
+		t.Fatalf("rows = %v", rows)
+	}
+	if _, rpcErr := run("INSERT INTO orders VALUES (1, 99)"); rpcErr == nil {
+		t.Fatal("expected the foreign key to be enforced")
+	}
+
+	tested, err := newSQLiteConnectionTester().TestConnection(context.Background(), connectTestParams{DSN: conn.DSN})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tested.ConnectionInfo["journalMode"] != "wal" || tested.ConnectionInfo["pageSize"] == "" {
+		t.Fatalf("info = %v", tested.ConnectionInfo)
+	}
+
+	params, _ := json.Marshal(schemaListParams{Connection: conn})
+	listed, rpcErr := schemaListHandler(nil, nil, nil)(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	schemas := listed.(schemaListResult).Schemas
+	if len(schemas) != 2 || schemas[0].Name != "main" || schemas[1].Name != "archive" {
+		t.Fatalf("schemas = %+v", schemas)
+	}
+	if table := schemas[1].Tables[0]; table.Name != "old_orders" || !table.Columns[0].NotNull {
+		t.Fatalf("archive tables = %+v", schemas[1].Tables)
+	}
+}
+
+func TestSQLiteOptionsAreValidated(t *testing.T) {
+	for _, options := range []SQLiteOptions{
+		{Attach: map[string]string{"main": "/tmp/other.db"}},
+		{Attach: map[string]string{`x"; DROP`: "/tmp/other.db"}},
+		{Attach: map[string]string{"archive": ""}},
+		{JournalMode: "fast"},
+	} {
+		if _, err := withSQLiteOptions("/tmp/app.db", options); err == nil {
+			t.Errorf("%+v: expected an error", options)
+		}
+	}
+	dsn, err := withSQLiteOptions("file:/tmp/app.db?cache=shared", SQLiteOptions{JournalMode: "wal"})
+	if err != nil || !strings.HasPrefix(dsn, "file:/tmp/app.db?cache=shared&_pragma=") {
+		t.Fatalf("dsn = %q, %v", dsn, err)
+	}
+}
+
+func TestSQLiteKeyErrorsTellFilesApart(t *testing.T) {
+	plain := searchDB(t, "CREATE TABLE t (id INTEGER)")
+	encrypted := filepath.Join(t.TempDir(), "app.db")
+	if err := os.WriteFile(encrypted, bytes.Repeat([]byte{0x5a, 0xc3}, 2048), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyed := func(dsn string) string {
+		t.Helper()
+		withKey, err := withSQLiteOptions(dsn, SQLiteOptions{Key: "it's secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return withKey
+	}
+	if key := sqliteKey(keyed(plain)); key != "it's secret" {
+		t.Fatalf("key = %q", key)
+	}
+	if dsn, removed := dsnWithoutPassword("sqlite", keyed(plain)+"&_txlock=immediate"); !removed || strings.Contains(dsn, "secret") || !strings.HasSuffix(dsn, "?_txlock=immediate") {
+		t.Fatalf("dsn = %q", dsn)
+	}
+
+	handler := connectTestHandler(defaultConnectionTesters())
+	for dsn, want := range map[string]string{
+		keyed(plain):     sqliteNotEncrypted,
+		encrypted:        sqliteKeyRequired,
+		keyed(encrypted): sqliteEncryptionUnsupported,
+	} {
+		params, _ := json.Marshal(connectTestParams{Driver: "sqlite", DSN: dsn})
+		_, rpcErr := handler(context.Background(), params)
+		if rpcErr == nil {
+			t.Fatalf("%s: expected an error", dsn)
+		}
+		if data, ok := rpcErr.Data.(connectTestErrorData); !ok || data.Code != want {
+			t.Fatalf("%s: data = %+v, want %s", dsn, rpcErr.Data, want)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/filewatch"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// sqliteWatchInterval is how often watched SQLite files are checked for changes.
+const sqliteWatchInterval = time.Second
+
+type databaseChangedEvent struct {
+	// Handles are the client's connection handles on the changed database.
+	Handles []string `json:"handles"`
+	Path    string   `json:"path"`
+	// Files lists the changed files: the database, its write-ahead log or both.
+	Files []string `json:"files"`
+}
+
+// sqliteWatches watches the SQLite files a client opened handles on, so that it can
+// refresh open results and the schema tree when another program writes to them.
+type sqliteWatches struct {
+	watcher *filewatch.Watcher
+	// run starts polling on the first watched file.
+	run sync.Once
+	ctx context.Context
+
+	mu sync.Mutex
+	// paths maps each watched handle to its database file.
+	paths map[string]string
+}
+
+type sqliteWatchesKey struct{}
+
+func sqliteWatchesOf(client *rpc.Session) *sqliteWatches {
+	return client.Value(sqliteWatchesKey{}, func() any {
+		w := &sqliteWatches{ctx: client.Context(), paths: make(map[string]string)}
+		w.watcher = filewatch.New(func(change filewatch.Change) {
+			_ = client.Notify("database.changed", databaseChangedEvent{
+				Handles: w.handlesOn(change.Path),
+				Path:    change.Path,
+				Files:   change.Files,
+			})
+		})
+		return w
+	}).(*sqliteWatches)
+}
+
+// sqliteFile returns the file a SQLite DSN opens, or false for in-memory databases.
+func sqliteFile(dsn string) (string, bool) {
+	path, query, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	if path == "" || path == ":memory:" || strings.Contains(query, "mode=memory") {
+		return "", false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	return abs, true
+}
+
+// watch reports changes to the file of a SQLite handle until the returned release is
+// called.
+func (w *sqliteWatches) watch(handle, dsn string) (release func(), ok bool) {
+	path, ok := sqliteFile(dsn)
+	if !ok {
+		return nil, false
+	}
+	stop := w.watcher.Add(path, path+"-wal")
+	w.run.Do(func() { go w.watcher.Run(w.ctx, sqliteWatchInterval) })
+	w.mu.Lock()
+	w.paths[handle] = path
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		delete(w.paths, handle)
+		w.mu.Unlock()
+		stop()
+	}, true
+}
+
+func (w *sqliteWatches) handlesOn(path string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var handles []string
+	for handle, p := range w.paths {
+		if p == path {
+			handles = append(handles, handle)
+		}
+	}
+	slices.Sort(handles)
+	return handles
+}
+
+// settle takes the files of the handles named in params as they are now, after a request
+// through those handles wrote to them.
+func (w *sqliteWatches) settle(params json.RawMessage) {
+	w.mu.Lock()
+	var paths []string
+	for handle, path := range w.paths {
+		if bytes.Contains(params, []byte(handle)) {
+			paths = append(paths, path)
+		}
+	}
+	w.mu.Unlock()
+	for _, path := range paths {
+		w.watcher.Settle(path)
+	}
+}
+
+// sqliteChangeSettling keeps database.changed to writes made outside the client's own
+// requests: once a request through a watched handle returns, the files it touched are
+// taken as they are. It runs before handle resolution, while params still name handles.
+func sqliteChangeSettling() rpc.Middleware {
+	return func(_ string, next rpc.HandlerFunc) rpc.HandlerFunc {
+		return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+			client, ok := rpc.SessionFromContext(ctx)
+			if !ok || !bytes.Contains(params, []byte(`"handle"`)) {
+				return next(ctx, params)
+			}
+			result, rpcErr := next(ctx, params)
+			sqliteWatchesOf(client).settle(params)
+			return result, rpcErr
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestSQLiteFileChangesAreReportedOnceFromElsewhere(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	other, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := other.Exec("CREATE TABLE t (id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+
+	server := rpc.NewServer(zerolog.Nop())
+	server.Use(sqliteChangeSettling(), connectionHandleResolution(false, newWorkspaces("", nil)))
+	server.Register("connection.open", connectionOpenHandler)
+	server.Register("connection.close", connectionCloseHandler)
+	server.Register("query.execute", executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, nil, 0))
+	server.Register("poll", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		client, _ := rpc.SessionFromContext(ctx)
+		sqliteWatchesOf(client).watcher.Poll()
+		return nil, nil
+	})
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		_ = server.Serve(inR, outW)
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+	output := bufio.NewScanner(outR)
+	// send returns the response to a request and the notifications sent before it.
+	send := func(method, params string) (string, []databaseChangedEvent) {
+		t.Helper()
+		if _, err := io.WriteString(inW, `{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":`+params+"}\n"); err != nil {
+			t.Fatal(err)
+		}
+		var events []databaseChangedEvent
+		for output.Scan() {
+			var message struct {
+				Method string               `json:"method"`
+				Params databaseChangedEvent `json:"params"`
+			}
+			if err := json.Unmarshal(output.Bytes(), &message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Method == "" {
+				return output.Text(), events
+			}
+			events = append(events, message.Params)
+		}
+		t.Fatalf("connection closed: %v", output.Err())
+		return "", nil
+	}
+
+	line, _ := send("connection.open", `{"driver":"sqlite","dsn":"`+path+`"}`)
+	var opened struct {
+		Result connectionOpenResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &opened); err != nil || opened.Result.Handle == "" {
+		t.Fatalf("expected a handle, got %s", line)
+	}
+	handle := opened.Result.Handle
+
+	if line, _ := send("query.execute", `{"connection":{"handle":"`+handle+`"},"sql":"INSERT INTO t VALUES (1)"}`); strings.Contains(line, `"error"`) {
+		t.Fatal(line)
+	}
+	if _, events := send("poll", `{}`); len(events) != 0 {
+		t.Fatalf("the client's own write was reported: %+v", events)
+	}
+
+	if _, err := other.Exec("INSERT INTO t VALUES (2)"); err != nil {
+		t.Fatal(err)
+	}
+	_, events := send("poll", `{}`)
+	if len(events) != 1 || events[0].Path != path || len(events[0].Handles) != 1 || events[0].Handles[0] != handle {
+		t.Fatalf("events = %+v", events)
+	}
+	if _, events := send("poll", `{}`); len(events) != 0 {
+		t.Fatalf("the change was reported twice: %+v", events)
+	}
+
+	send("connection.close", `{"handle":"`+handle+`"}`)
+	if _, err := other.Exec("INSERT INTO t VALUES (3)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, events := send("poll", `{}`); len(events) != 0 {
+		t.Fatalf("a closed handle is still watched: %+v", events)
+	}
+}
+
+func TestSQLiteFileOfDSN(t *testing.T) {
+	for dsn, want := range map[string]bool{
+		"/data/app.db":               true,
+		"file:/data/app.db?_pragma=": true,
+		":memory:":                   false,
+		"file::memory:?cache=shared": false,
+		"file:mem?mode=memory":       false,
+	} {
+		if _, ok := sqliteFile(dsn); ok != want {
+			t.Errorf("%s: got %v", dsn, ok)
+		}
+	}
+}
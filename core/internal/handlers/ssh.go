@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"golang.org/x/crypto/ssh"
+)
+
+func hostKeyStore(stateDir string) *sshtrust.Store {
+	if stateDir == "" {
+		return nil
+	}
+	return sshtrust.NewStore(filepath.Join(stateDir, "known_hosts"))
+}
+
+type sshTrustHostParams struct {
+	Host string `json:"host" jsonschema:"required"`
+	Port int    `json:"port"`
+	// Key is the host key in authorized_keys format, as returned in a host key error.
+	Key string `json:"key" jsonschema:"required"`
+	// Fingerprint, when given, must match Key, so that the user approves the key they saw.
+	Fingerprint string `json:"fingerprint"`
+}
+
+func sshTrustHostHandler(store *sshtrust.Store) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload sshTrustHostParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Host == "" {
+			return nil, &rpc.Error{Code: -32602, Message: "host is required"}
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(payload.Key))
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid host key",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Fingerprint != "" && payload.Fingerprint != ssh.FingerprintSHA256(key) {
+			return nil, &rpc.Error{Code: -32602, Message: "fingerprint does not match the host key"}
+		}
+		if store == nil {
+			return nil, &rpc.Error{Code: -32603, Message: "trusting hosts requires a state directory"}
+		}
+
+		port := payload.Port
+		if port == 0 {
+			port = 22
+		}
+		address := net.JoinHostPort(payload.Host, strconv.Itoa(port))
+		if err := store.Trust(address, key); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32603,
+				Message: "failed to record the host key",
+				Data:    err.Error(),
+			}
+		}
+		return sshtrust.Describe(address, key), nil
+	}
+}
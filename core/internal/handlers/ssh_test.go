@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHTrustHostRecordsKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	key, _ := ssh.NewPublicKey(pub)
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	handler := sshTrustHostHandler(hostKeyStore(t.TempDir()))
+
+	raw, _ := json.Marshal(map[string]any{"host": "db.internal", "port": 2222, "key": authorized, "fingerprint": "SHA256:nope"})
+	if _, rpcErr := handler(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected a mismatched fingerprint to be refused, got %+v", rpcErr)
+	}
+
+	raw, _ = json.Marshal(map[string]any{"host": "db.internal", "port": 2222, "key": authorized, "fingerprint": ssh.FingerprintSHA256(key)})
+	result, rpcErr := handler(context.Background(), raw)
+	if rpcErr != nil {
+		t.Fatalf("handler returned rpc error: %v", rpcErr)
+	}
+	if recorded := result.(sshtrust.HostKey); recorded.Host != "[db.internal]:2222" || recorded.Key != authorized {
+		t.Fatalf("unexpected result %+v", recorded)
+	}
+
+	if _, rpcErr := sshTrustHostHandler(nil)(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32603 {
+		t.Fatalf("expected trusting without a state directory to fail, got %+v", rpcErr)
+	}
+}
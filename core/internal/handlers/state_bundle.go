@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"github.com/go-sql-driver/mysql"
+)
+
+// Files state.import writes under <state-dir>/config. The core reads them at startup in
+// place of the matching flag when the flag is not set.
+const (
+	ImportedAliasesFile = "connection-aliases.json"
+	ImportedRewriteFile = "rewrite-rules.json"
+	ImportedMaskingFile = "masking-policy.json"
+)
+
+const (
+	stateBundleFormat  = "fluxgrid-state"
+	stateBundleVersion = 1
+)
+
+// Sections of a state bundle.
+const (
+	sectionConnections  = "connections"
+	sectionRewriteRules = "rewriteRules"
+	sectionMasking      = "maskingPolicy"
+	sectionTrustedHosts = "trustedHosts"
+)
+
+var stateSections = []string{sectionConnections, sectionRewriteRules, sectionMasking, sectionTrustedHosts}
+
+// ImportedConfig returns the path of an imported configuration file under stateDir, or ""
+// when there is none.
+func ImportedConfig(stateDir, name string) string {
+	if stateDir == "" {
+		return ""
+	}
+	path := filepath.Join(stateDir, "config", name)
+	if !fileExists(path) {
+		return ""
+	}
+	return path
+}
+
+// stateBundle is the portable form of the core's configuration and state. It never holds
+// passwords or the masking salt.
+type stateBundle struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exportedAt"`
+	// Connections are the connection aliases, with passwords removed from their DSNs.
+	Connections  map[string]ConnectionAlias `json:"connections,omitempty"`
+	RewriteRules []rewrite.Rule             `json:"rewriteRules,omitempty"`
+	// MaskingPolicy holds the masking rules without the salt.
+	MaskingPolicy *masking.Config `json:"maskingPolicy,omitempty"`
+	// TrustedHosts are the known_hosts entries of the SSH hosts trusted for tunnels.
+	TrustedHosts []string `json:"trustedHosts,omitempty"`
+}
+
+type stateExportParams struct {
+	// Sections limits the bundle to connections, rewriteRules, maskingPolicy and
+	// trustedHosts. Empty exports them all.
+	Sections []string `json:"sections,omitempty"`
+}
+
+type stateExportResult struct {
+	Bundle stateBundle `json:"bundle"`
+	// SecretsRemoved lists the connections whose DSNs had passwords removed.
+	SecretsRemoved []string `json:"secretsRemoved"`
+}
+
+type stateImportParams struct {
+	Bundle stateBundle `json:"bundle" jsonschema:"required"`
+	// Overwrite replaces connections of the same name and configured rules. Without it
+	// they are kept and reported as skipped.
+	Overwrite bool `json:"overwrite"`
+}
+
+type stateImportResult struct {
+	Connections  int `json:"connections"`
+	RewriteRules int `json:"rewriteRules"`
+	MaskingRules int `json:"maskingRules"`
+	TrustedHosts int `json:"trustedHosts"`
+	// Skipped lists what was kept because it already existed: connection names, or
+	// rewriteRules and maskingPolicy.
+	Skipped []string `json:"skipped"`
+	// RestartRequired is set when imported configuration takes effect on restart.
+	// Trusted hosts, and connections imported into a named workspace, take effect at once.
+	RestartRequired bool     `json:"restartRequired"`
+	Warnings        []string `json:"warnings"`
+}
+
+func parseSections(sections []string) (map[string]bool, *rpc.Error) {
+	if len(sections) == 0 {
+		sections = stateSections
+	}
+	set := map[string]bool{}
+	for _, section := range sections {
+		if !slices.Contains(stateSections, section) {
+			return nil, &rpc.Error{Code: -32602, Message: fmt.Sprintf("unknown state section: %s", section)}
+		}
+		set[section] = true
+	}
+	return set, nil
+}
+
+// stateExportHandler bundles the configuration the core runs with, for moving it to
+// another machine or sharing it with a team. Connections are those of the client's
+// workspace.
+func stateExportHandler(cfg Config, spaces *workspaces, hostKeys *sshtrust.Store) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload stateExportParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &payload); err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "invalid parameters",
+					Data:    err.Error(),
+				}
+			}
+		}
+		sections, rpcErr := parseSections(payload.Sections)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		result := stateExportResult{
+			Bundle:         stateBundle{Format: stateBundleFormat, Version: stateBundleVersion, ExportedAt: time.Now().UTC()},
+			SecretsRemoved: []string{},
+		}
+		if aliases := spaces.aliases(ctx); sections[sectionConnections] && len(aliases) > 0 {
+			result.Bundle.Connections = map[string]ConnectionAlias{}
+			for name, alias := range aliases {
+				exported, removed := aliasWithoutSecrets(alias)
+				result.Bundle.Connections[name] = exported
+				if removed {
+					result.SecretsRemoved = append(result.SecretsRemoved, name)
+				}
+			}
+			slices.Sort(result.SecretsRemoved)
+		}
+		if sections[sectionRewriteRules] {
+			result.Bundle.RewriteRules = cfg.Rewriter.Rules()
+		}
+		if sections[sectionMasking] && cfg.Masking != nil {
+			policy := cfg.Masking.Config()
+			policy.Salt = ""
+			result.Bundle.MaskingPolicy = &policy
+		}
+		if sections[sectionTrustedHosts] && hostKeys != nil {
+			lines, err := hostKeys.Lines()
+			if err != nil {
+				return nil, &rpc.Error{Code: -32603, Message: "failed to read trusted hosts", Data: err.Error()}
+			}
+			result.Bundle.TrustedHosts = lines
+		}
+		return result, nil
+	}
+}
+
+// stateImportHandler stores the configuration of a bundle under the state directory,
+// where the core reads it at startup, and adds its trusted hosts. A client in a named
+// workspace imports connections into that workspace, where they are usable at once;
+// rewrite rules and the masking policy always apply to the whole core.
+func stateImportHandler(cfg Config, spaces *workspaces, hostKeys *sshtrust.Store) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload stateImportParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		bundle := payload.Bundle
+		if bundle.Format != stateBundleFormat || bundle.Version < 1 || bundle.Version > stateBundleVersion {
+			return nil, &rpc.Error{
+				Code:    -32186,
+				Message: "unsupported state bundle",
+				Data:    fmt.Sprintf("%s version %d", bundle.Format, bundle.Version),
+			}
+		}
+		if cfg.StateDir == "" {
+			return nil, &rpc.Error{Code: -32185, Message: "state.import needs a state directory"}
+		}
+		// Check everything before writing anything.
+		for name, alias := range bundle.Connections {
+			if err := checkConnectionAlias(name, alias); err != nil {
+				return nil, &rpc.Error{Code: -32186, Message: "invalid state bundle", Data: err.Error()}
+			}
+		}
+		if _, err := rewrite.New(bundle.RewriteRules); err != nil {
+			return nil, &rpc.Error{Code: -32186, Message: "invalid state bundle", Data: err.Error()}
+		}
+		if bundle.MaskingPolicy != nil {
+			if _, err := masking.New(*bundle.MaskingPolicy); err != nil {
+				return nil, &rpc.Error{Code: -32186, Message: "invalid state bundle", Data: err.Error()}
+			}
+		}
+		// The core refuses to start with restricted aliases and no masking policy.
+		// Workspace aliases are used at once, so they need the policy in effect.
+		dir := filepath.Join(cfg.StateDir, "config")
+		workspace := clientSessionOf(ctx).workspaceID()
+		hasPolicy := cfg.Masking != nil || bundle.MaskingPolicy != nil || fileExists(filepath.Join(dir, ImportedMaskingFile))
+		if workspace != "" {
+			hasPolicy = dataMasks.configured()
+		}
+		for name, alias := range bundle.Connections {
+			if alias.Restricted() && !hasPolicy {
+				return nil, &rpc.Error{
+					Code:    -32186,
+					Message: "invalid state bundle",
+					Data:    fmt.Sprintf("alias %q is restricted but there is no masking policy", name),
+				}
+			}
+		}
+
+		result := stateImportResult{Skipped: []string{}, Warnings: []string{}}
+		// Add checks every entry before writing any.
+		if len(bundle.TrustedHosts) > 0 && hostKeys != nil {
+			added, err := hostKeys.Add(bundle.TrustedHosts)
+			if err != nil {
+				return nil, &rpc.Error{Code: -32186, Message: "invalid state bundle", Data: err.Error()}
+			}
+			result.TrustedHosts = added
+		}
+		if len(bundle.Connections) > 0 {
+			path := filepath.Join(spaces.dir(workspace), "config", ImportedAliasesFile)
+			stored := map[string]ConnectionAlias{}
+			if err := readJSONFile(path, &stored); err != nil {
+				return nil, stateWriteError(err)
+			}
+			names := make([]string, 0, len(bundle.Connections))
+			for name := range bundle.Connections {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				_, configured := spaces.global[name]
+				_, imported := stored[name]
+				if (configured || imported) && !payload.Overwrite {
+					result.Skipped = append(result.Skipped, name)
+					continue
+				}
+				stored[name] = bundle.Connections[name]
+				result.Connections++
+			}
+			if result.Connections > 0 {
+				if err := writeJSONFile(path, stored); err != nil {
+					return nil, stateWriteError(err)
+				}
+			}
+		}
+		live := 0
+		if workspace != "" && result.Connections > 0 {
+			spaces.reloadAliases(workspace)
+			live = result.Connections
+		}
+		if len(bundle.RewriteRules) > 0 {
+			path := filepath.Join(dir, ImportedRewriteFile)
+			if (cfg.Rewriter != nil || fileExists(path)) && !payload.Overwrite {
+				result.Skipped = append(result.Skipped, sectionRewriteRules)
+			} else {
+				if err := writeJSONFile(path, bundle.RewriteRules); err != nil {
+					return nil, stateWriteError(err)
+				}
+				result.RewriteRules = len(bundle.RewriteRules)
+			}
+		}
+		if bundle.MaskingPolicy != nil {
+			path := filepath.Join(dir, ImportedMaskingFile)
+			if (cfg.Masking != nil || fileExists(path)) && !payload.Overwrite {
+				result.Skipped = append(result.Skipped, sectionMasking)
+			} else {
+				if err := writeJSONFile(path, bundle.MaskingPolicy); err != nil {
+					return nil, stateWriteError(err)
+				}
+				result.MaskingRules = len(bundle.MaskingPolicy.Rules)
+				if bundle.MaskingPolicy.Salt == "" {
+					result.Warnings = append(result.Warnings, fmt.Sprintf("the masking policy has no salt; add one to %s before relying on hashed values", path))
+				}
+			}
+		}
+		result.RestartRequired = result.Connections-live+result.RewriteRules+result.MaskingRules > 0
+		return result, nil
+	}
+}
+
+func stateWriteError(err error) *rpc.Error {
+	return &rpc.Error{Code: -32603, Message: "failed to store imported state", Data: err.Error()}
+}
+
+var pgPasswordKeyword = regexp.MustCompile(`(^|\s+)password\s*=\s*('(?:[^'\\]|\\.)*'|\S*)`)
+
+// aliasWithoutSecrets returns alias with the passwords removed from its DSNs, and whether
+// there were any.
+func aliasWithoutSecrets(alias ConnectionAlias) (ConnectionAlias, bool) {
+	dsn, removed := dsnWithoutPassword(alias.Driver, alias.DSN)
+	alias.DSN = dsn
+	replicas := make([]string, len(alias.Replicas))
+	for i, replica := range alias.Replicas {
+		var replicaRemoved bool
+		replicas[i], replicaRemoved = dsnWithoutPassword(alias.Driver, replica)
+		removed = removed || replicaRemoved
+	}
+	if len(replicas) > 0 {
+		alias.Replicas = replicas
+	}
+	return alias, removed
+}
+
+func dsnWithoutPassword(driver, dsn string) (string, bool) {
+	switch driver {
+	case "postgres":
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			u, err := url.Parse(dsn)
+			if err != nil {
+				return dsn, false
+			}
+			removed := false
+			if _, ok := u.User.Password(); ok {
+				u.User = url.User(u.User.Username())
+				removed = true
+			}
+			query := u.Query()
+			if query.Has("password") {
+				query.Del("password")
+				u.RawQuery = query.Encode()
+				removed = true
+			}
+			return u.String(), removed
+		}
+		stripped := strings.TrimSpace(pgPasswordKeyword.ReplaceAllString(dsn, ""))
+		return stripped, stripped != strings.TrimSpace(dsn)
+	case "mysql":
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil || cfg.Passwd == "" {
+			return dsn, false
+		}
+		cfg.Passwd = ""
+		return cfg.FormatDSN(), true
+	case "sqlite":
+		return sqliteWithoutKey(dsn)
+	}
+	return dsn, false
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
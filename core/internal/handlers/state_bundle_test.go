@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/rewrite"
+)
+
+func TestDSNWithoutPassword(t *testing.T) {
+	cases := []struct {
+		driver, dsn, want string
+		removed           bool
+	}{
+		{"postgres", "postgres://app:s3cret@db:5432/shop?sslmode=require", "postgres://app@db:5432/shop?sslmode=require", true},
+		{"postgres", "host=db user=app password='a b\\'c' dbname=shop", "host=db user=app dbname=shop", true},
+		{"postgres", "postgres://app@db/shop", "postgres://app@db/shop", false},
+		{"mysql", "app:s3cret@tcp(db:3306)/shop", "app@tcp(db:3306)/shop", true},
+		{"sqlite", "/tmp/app.db", "/tmp/app.db", false},
+	}
+	for _, c := range cases {
+		got, removed := dsnWithoutPassword(c.driver, c.dsn)
+		if got != c.want || removed != c.removed {
+			t.Errorf("%s: got %q, %v; want %q, %v", c.dsn, got, removed, c.want, c.removed)
+		}
+	}
+}
+
+func TestStateBundleRoundTrip(t *testing.T) {
+	rewriter, err := rewrite.New([]rewrite.Rule{{Kind: rewrite.KindLimit, Limit: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := masking.New(masking.Config{Rules: []masking.Rule{{Detect: masking.DetectEmail}}, Salt: "pepper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := Config{
+		ConnectionAliases: map[string]ConnectionAlias{
+			"shop":      {Driver: "postgres", DSN: "postgres://app:s3cret@db/shop", Tags: []string{restrictedTag}},
+			"analytics": {Driver: "sqlite", DSN: "/data/analytics.db"},
+		},
+		Rewriter: rewriter,
+		Masking:  policy,
+	}
+	raw, rpcErr := stateExportHandler(source, newWorkspaces("", source.ConnectionAliases), nil)(context.Background(), nil)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	exported := raw.(stateExportResult)
+	data, _ := json.Marshal(exported.Bundle)
+	if strings.Contains(string(data), "s3cret") || strings.Contains(string(data), "pepper") {
+		t.Fatalf("bundle leaks secrets: %s", data)
+	}
+	if len(exported.SecretsRemoved) != 1 || exported.SecretsRemoved[0] != "shop" {
+		t.Fatalf("secretsRemoved = %v", exported.SecretsRemoved)
+	}
+
+	stateDir := t.TempDir()
+	target := Config{
+		StateDir:          stateDir,
+		ConnectionAliases: map[string]ConnectionAlias{"analytics": {Driver: "sqlite", DSN: "/other.db"}},
+	}
+	params, _ := json.Marshal(map[string]any{"bundle": exported.Bundle})
+	raw, rpcErr = stateImportHandler(target, newWorkspaces(stateDir, target.ConnectionAliases), nil)(context.Background(), params)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	imported := raw.(stateImportResult)
+	if imported.Connections != 1 || imported.RewriteRules != 1 || imported.MaskingRules != 1 || !imported.RestartRequired {
+		t.Fatalf("imported = %+v", imported)
+	}
+	if len(imported.Skipped) != 1 || imported.Skipped[0] != "analytics" || len(imported.Warnings) != 1 {
+		t.Fatalf("skipped = %v, warnings = %v", imported.Skipped, imported.Warnings)
+	}
+
+	aliases, err := LoadConnectionAliases(ImportedConfig(stateDir, ImportedAliasesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliases["shop"].DSN != "postgres://app@db/shop" || !aliases["shop"].Restricted() {
+		t.Fatalf("aliases = %+v", aliases)
+	}
+	if _, err := rewrite.Load(ImportedConfig(stateDir, ImportedRewriteFile)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := masking.Load(ImportedConfig(stateDir, ImportedMaskingFile)); err != nil {
+		t.Fatal(err)
+	}
+	if ImportedConfig(t.TempDir(), ImportedAliasesFile) != "" || ImportedConfig("", ImportedAliasesFile) != "" {
+		t.Fatal("expected no imported config")
+	}
+}
+
+func TestStateImportRefusesUnsafeBundles(t *testing.T) {
+	stateDir := t.TempDir()
+	handler := stateImportHandler(Config{StateDir: stateDir}, newWorkspaces(stateDir, nil), nil)
+	for name, bundle := range map[string]stateBundle{
+		"wrong format": {Format: "other", Version: 1},
+		"restricted without policy": {Format: stateBundleFormat, Version: 1, Connections: map[string]ConnectionAlias{
+			"shop": {Driver: "postgres", DSN: "postgres://db/shop", Tags: []string{restrictedTag}},
+		}},
+		"invalid rule": {Format: stateBundleFormat, Version: 1, RewriteRules: []rewrite.Rule{{Kind: rewrite.KindLimit}}},
+	} {
+		params, _ := json.Marshal(map[string]any{"bundle": bundle})
+		if _, rpcErr := handler(context.Background(), params); rpcErr == nil || rpcErr.Code != -32186 {
+			t.Fatalf("%s: expected the bundle to be refused, got %v", name, rpcErr)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(stateDir, "config", "*")); len(matches) != 0 {
+		t.Fatalf("refused bundles wrote %v", matches)
+	}
+}
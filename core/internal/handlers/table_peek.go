@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+const (
+	defaultPeekRows = 200
+	maxPeekRows     = 10000
+	// maxKeyColumns bounds the primary key lookup; no real key is wider.
+	maxKeyColumns = 64
+)
+
+type tablePeekParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	tablequery.Request
+	// RowIdentity reports how rows can be identified for editing and, when that is by a
+	// ctid or rowid, adds it to the rows as the __rowid column.
+	RowIdentity bool `json:"rowIdentity"`
+	Options     struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type tablePeekResult struct {
+	Columns []column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	// HasMore reports that rows follow this page.
+	HasMore bool `json:"hasMore"`
+	// Identity is set when rowIdentity was requested.
+	Identity *tablequery.RowIdentity `json:"identity,omitempty"`
+	// SQL is the statement that was run, for display.
+	SQL             string  `json:"sql"`
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+}
+
+// tablePeekHandler reads a page of a table. When the rows are sorted, the primary key is
+// appended to the sort keys so that rows with equal values do not move between pages.
+func tablePeekHandler(execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload tablePeekParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		if payload.Limit <= 0 {
+			payload.Limit = defaultPeekRows
+		}
+		payload.Limit = min(payload.Limit, maxPeekRows)
+		payload.Offset = max(payload.Offset, 0)
+
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+
+		start := time.Now()
+		var tiebreak []string
+		if len(payload.Sort) > 0 {
+			// Views and tables without a primary key are sorted without a tiebreak.
+			keys, rpcErr := run(tablequery.PrimaryKeySQL(dialect, payload.Schema, payload.Table), nil, maxKeyColumns)
+			if rpcErr == nil {
+				tiebreak = columnNames(keys)
+			}
+		}
+
+		var identity *tablequery.RowIdentity
+		if payload.RowIdentity {
+			detected, rpcErr := detectRowIdentity(dialect, run, payload.Schema, payload.Table)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			identity = &detected
+		}
+
+		// One extra row tells whether another page follows.
+		request := payload.Request
+		request.Limit++
+		request.RowID = identity != nil &&
+			(identity.Strategy == tablequery.IdentityCTID || identity.Strategy == tablequery.IdentityRowID)
+		sql, args, err := tablequery.Build(dialect, request, tiebreak)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid table request",
+				Data:    err.Error(),
+			}
+		}
+		result, rpcErr := run(sql, args, request.Limit)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		rows := result.Rows
+		hasMore := len(rows) > payload.Limit
+		if hasMore {
+			rows = rows[:payload.Limit]
+		}
+		return tablePeekResult{
+			Columns:         result.Columns,
+			Rows:            rows,
+			HasMore:         hasMore,
+			Identity:        identity,
+			SQL:             sql,
+			ExecutionTimeMs: time.Since(start).Seconds() * 1000,
+		}, nil
+	}
+}
+
+// runTableQuery runs a statement built by the core and returns its rows. The statement
+// shapes repeat per table, so Postgres keeps them prepared on pooled connections.
+func runTableQuery(
+	ctx context.Context,
+	execute classicExecutor,
+	conn dbConnectionParams,
+	timeoutSeconds int,
+	sql string,
+	args []any,
+	maxRows int,
+) (executeResult, *rpc.Error) {
+	var exec executeParams
+	exec.Connection.Driver = conn.Driver
+	exec.Connection.DSN = conn.DSN
+	exec.SQL = sql
+	exec.Args = args
+	exec.Prepare = true
+	exec.Options.TimeoutSeconds = timeoutSeconds
+	exec.Options.MaxRows = maxRows
+	raw, rpcErr := execute(ctx, exec)
+	if rpcErr != nil {
+		return executeResult{}, rpcErr
+	}
+	result, ok := raw.(executeResult)
+	if !ok {
+		return executeResult{}, &rpc.Error{
+			Code:    -32603,
+			Message: fmt.Sprintf("unexpected execute result %T", raw),
+		}
+	}
+	return result, nil
+}
+
+// columnNames reads the column names a catalog query returned in its first column.
+func columnNames(result executeResult) []string {
+	names := make([]string, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if name, ok := row[0].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
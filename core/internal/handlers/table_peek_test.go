@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+func TestTablePeekSortsNullsAndPagesStably(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "peek.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE items (id INTEGER PRIMARY KEY, score INTEGER)`,
+		`INSERT INTO items (id, score) VALUES (4, 1), (2, NULL), (3, 1), (1, 2), (5, NULL)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	handler := tablePeekHandler(executeClassic)
+	peek := func(params string) tablePeekResult {
+		t.Helper()
+		raw, rpcErr := handler(context.Background(), json.RawMessage(params))
+		if rpcErr != nil {
+			t.Fatalf("table.peek: %+v", rpcErr)
+		}
+		return raw.(tablePeekResult)
+	}
+	ids := func(result tablePeekResult) []any {
+		out := make([]any, len(result.Rows))
+		for i, row := range result.Rows {
+			out[i] = row[0]
+		}
+		return out
+	}
+	conn := `"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"items"`
+
+	// Ascending puts NULLs last, as on Postgres, and ties keep primary key order.
+	first := peek(`{` + conn + `,"sort":[{"column":"score"}],"limit":3}`)
+	if got, want := ids(first), []any{int64(3), int64(4), int64(1)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("first page = %v, want %v", got, want)
+	}
+	if !first.HasMore {
+		t.Fatal("expected more rows after the first page")
+	}
+	second := peek(`{` + conn + `,"sort":[{"column":"score"}],"limit":3,"offset":3}`)
+	if got, want := ids(second), []any{int64(2), int64(5)}; !reflect.DeepEqual(got, want) || second.HasMore {
+		t.Fatalf("second page = %v (hasMore %v), want %v", got, second.HasMore, want)
+	}
+
+	// Filter values are bound, so quotes in them are data rather than SQL.
+	filtered := peek(`{` + conn + `,"filter":{"or":[{"column":"score","op":"eq","value":1},{"column":"score","op":"eq","value":"1' OR 1=1 --"}]},"sort":[{"column":"id"}]}`)
+	if got, want := ids(filtered), []any{int64(3), int64(4)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("filtered = %v, want %v", got, want)
+	}
+
+	desc := peek(`{` + conn + `,"sort":[{"column":"score","desc":true,"nulls":"last"}]}`)
+	if got, want := ids(desc), []any{int64(1), int64(3), int64(4), int64(2), int64(5)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("descending = %v, want %v", got, want)
+	}
+}
+
+func TestTablePeekRejectsInvalidRequests(t *testing.T) {
+	handler := tablePeekHandler(func(context.Context, executeParams) (any, *rpc.Error) {
+		return nil, &rpc.Error{Code: -32011, Message: "query execution failed"}
+	})
+	cases := map[string]int{
+		`{"connection":{"driver":"oracle","dsn":"x"},"table":"t"}`:                                      -32601,
+		`{"connection":{"driver":"sqlite","dsn":"x"}}`:                                                  -32602,
+		`{"connection":{"driver":"sqlite","dsn":"x"},"table":"t","sort":[{"column":"a","nulls":"up"}]}`: -32602,
+	}
+	for params, code := range cases {
+		_, rpcErr := handler(context.Background(), json.RawMessage(params))
+		if rpcErr == nil || rpcErr.Code != code {
+			t.Errorf("%s: got %+v, want code %d", params, rpcErr, code)
+		}
+	}
+}
+
+func TestTablePeekProjectsJSONPaths(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "json.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE events (id INTEGER PRIMARY KEY, payload TEXT)`,
+		`INSERT INTO events VALUES (1, '{"user":{"name":"Ann"},"tags":["x"]}'), (2, '{"user":{}}')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	params := `{"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"events","columns":["id"],` +
+		`"jsonPaths":[{"column":"payload","path":"$.user.name"},{"column":"payload","path":"$.tags[0]","as":"tag"}],"sort":[{"column":"id"}]}`
+	raw, rpcErr := tablePeekHandler(executeClassic)(context.Background(), json.RawMessage(params))
+	if rpcErr != nil {
+		t.Fatalf("table.peek: %+v", rpcErr)
+	}
+	result := raw.(tablePeekResult)
+	if len(result.Columns) != 3 || result.Columns[1].Name != "payload.user.name" || result.Columns[2].Name != "tag" {
+		t.Fatalf("unexpected columns %+v", result.Columns)
+	}
+	if want := [][]any{{int64(1), "Ann", "x"}, {int64(2), nil, nil}}; !reflect.DeepEqual(result.Rows, want) {
+		t.Fatalf("rows = %v, want %v", result.Rows, want)
+	}
+}
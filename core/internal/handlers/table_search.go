@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+const (
+	defaultSearchRows = 100
+	maxSearchRows     = 1000
+	// maxSearchColumns bounds the catalog queries that list text columns.
+	maxSearchColumns = 4096
+)
+
+type tableSearchParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	tablequery.SearchRequest
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type tableSearchResult struct {
+	Columns []column `json:"columns"`
+	Rows    [][]any  `json:"rows"`
+	// Matches locate the term in the returned rows for highlighting. Full-text modes can
+	// match rows on word forms that do not contain the term verbatim.
+	Matches []resultset.CellMatch `json:"matches"`
+	// SearchedColumns are the text columns the term was looked for in.
+	SearchedColumns []string `json:"searchedColumns"`
+	// Mode is like, fulltext (a MySQL FULLTEXT index) or fts5 (an SQLite FTS5 table).
+	Mode string `json:"mode"`
+	// HasMore reports that more rows match than were returned.
+	HasMore         bool    `json:"hasMore"`
+	SQL             string  `json:"sql"`
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+}
+
+// tableSearchHandler looks for a term in every text column of a table, using the table's
+// full-text index where the driver has one.
+func tableSearchHandler(execute classicExecutor) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload tableSearchParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		dialect, err := tablequery.ParseDialect(payload.Connection.Driver)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+		}
+		if payload.Table == "" || payload.Term == "" {
+			return nil, &rpc.Error{Code: -32602, Message: "table and term are required"}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		if payload.Limit <= 0 {
+			payload.Limit = defaultSearchRows
+		}
+		payload.Limit = min(payload.Limit, maxSearchRows)
+
+		run := func(sql string, args []any, maxRows int) (executeResult, *rpc.Error) {
+			return runTableQuery(ctx, execute, payload.Connection, payload.Options.TimeoutSeconds, sql, args, maxRows)
+		}
+
+		start := time.Now()
+		columns := payload.Columns
+		if len(columns) == 0 {
+			text, rpcErr := run(tablequery.TextColumnsSQL(dialect, payload.Schema, payload.Table), nil, maxSearchColumns)
+			if rpcErr != nil {
+				return nil, rpcErr
+			}
+			columns = columnNames(text)
+		}
+		var index tablequery.SearchIndex
+		if sql := tablequery.SearchIndexSQL(dialect, payload.Schema, payload.Table); sql != "" {
+			// Without catalog access the search falls back to LIKE.
+			if rows, rpcErr := run(sql, nil, maxSearchColumns); rpcErr == nil {
+				index = tablequery.ParseSearchIndex(dialect, rows.Rows)
+			}
+		}
+
+		// One extra row tells whether more rows match.
+		request := payload.SearchRequest
+		request.Limit++
+		sql, args, mode, err := tablequery.BuildSearch(dialect, request, columns, index)
+		if err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid search request",
+				Data:    err.Error(),
+			}
+		}
+		result, rpcErr := run(sql, args, request.Limit)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		rows := result.Rows
+		hasMore := len(rows) > payload.Limit
+		if hasMore {
+			rows = rows[:payload.Limit]
+		}
+		set := toResultSet(executeResult{Columns: result.Columns, Rows: rows})
+		if mode == tablequery.SearchFTS5 {
+			columns = nil
+			for _, col := range set.Columns {
+				columns = append(columns, col.Name)
+			}
+		}
+		var highlight []string
+		for _, name := range columns {
+			if set.ColumnIndex(name) >= 0 {
+				highlight = append(highlight, name)
+			}
+		}
+		matches := []resultset.CellMatch{}
+		if len(highlight) > 0 {
+			found, err := resultset.Search(set, resultset.SearchRequest{Query: payload.Term, Columns: highlight})
+			if err == nil {
+				matches = found.Matches
+			}
+		}
+
+		return tableSearchResult{
+			Columns:         result.Columns,
+			Rows:            rows,
+			Matches:         matches,
+			SearchedColumns: columns,
+			Mode:            mode,
+			HasMore:         hasMore,
+			SQL:             sql,
+			ExecutionTimeMs: time.Since(start).Seconds() * 1000,
+		}, nil
+	}
+}
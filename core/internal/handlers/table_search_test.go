@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+func searchDB(t *testing.T, stmts ...string) string {
+	t.Helper()
+	dsn := filepath.Join(t.TempDir(), "search.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dsn
+}
+
+func TestTableSearchFindsTermInTextColumns(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE notes (id INTEGER PRIMARY KEY, title TEXT, body VARCHAR(200), score INTEGER)`,
+		`INSERT INTO notes VALUES (1, 'Groceries', 'buy MILK and eggs', 5), (2, 'Milkshake', 'banana milk', 7), (3, 'Other', 'nothing', 8)`,
+	)
+	params := `{"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"notes","term":"milk"}`
+	raw, rpcErr := tableSearchHandler(executeClassic)(context.Background(), json.RawMessage(params))
+	if rpcErr != nil {
+		t.Fatalf("table.search: %+v", rpcErr)
+	}
+	result := raw.(tableSearchResult)
+	if result.Mode != tablequery.SearchLike || !reflect.DeepEqual(result.SearchedColumns, []string{"title", "body"}) {
+		t.Fatalf("unexpected mode %s over %v", result.Mode, result.SearchedColumns)
+	}
+	if len(result.Rows) != 2 || result.HasMore {
+		t.Fatalf("rows = %v (hasMore %v)", result.Rows, result.HasMore)
+	}
+	want := []resultset.CellMatch{
+		{Row: 0, Column: 2, Name: "body", Start: 4, End: 8},
+		{Row: 1, Column: 1, Name: "title", Start: 0, End: 4},
+		{Row: 1, Column: 2, Name: "body", Start: 7, End: 11},
+	}
+	if !reflect.DeepEqual(result.Matches, want) {
+		t.Fatalf("matches = %+v, want %+v", result.Matches, want)
+	}
+
+	params = `{"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"notes","term":"milk","limit":1}`
+	raw, rpcErr = tableSearchHandler(executeClassic)(context.Background(), json.RawMessage(params))
+	if rpcErr != nil || !raw.(tableSearchResult).HasMore {
+		t.Fatalf("expected a limited search to report more rows, got %+v %+v", raw, rpcErr)
+	}
+}
+
+func TestTableSearchUsesFTS5Tables(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE VIRTUAL TABLE docs USING fts5(title, body)`,
+		`INSERT INTO docs VALUES ('Release notes', 'the parser is faster'), ('Roadmap', 'more drivers')`,
+	)
+	params := `{"connection":{"driver":"sqlite","dsn":"` + dsn + `"},"table":"docs","term":"parser"}`
+	raw, rpcErr := tableSearchHandler(executeClassic)(context.Background(), json.RawMessage(params))
+	if rpcErr != nil {
+		t.Fatalf("table.search: %+v", rpcErr)
+	}
+	result := raw.(tableSearchResult)
+	if result.Mode != tablequery.SearchFTS5 || len(result.Rows) != 1 || result.Rows[0][0] != "Release notes" {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].Name != "body" {
+		t.Fatalf("matches = %+v", result.Matches)
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tempstore"
+)
+
+func tempUsageHandler(temp *tempstore.Store) rpc.HandlerFunc {
+	return func(_ context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		if temp == nil {
+			return nil, &rpc.Error{
+				Code:    -32090,
+				Message: "temp storage is not configured",
+			}
+		}
+		return temp.Usage(), nil
+	}
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fluxgrid/core/internal/ratelimit"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// Tenant is a client of a core shared as a service over HTTP or gRPC, such as a member of
+// a team, identified by its API keys. Each tenant sees only its own connection aliases,
+// history and jobs, and is rate limited on its own.
+type Tenant struct {
+	// KeySHA256 lists the hex SHA-256 digests of the tenant's API keys, so that the file
+	// does not hold the keys themselves. Several keys allow rotating them.
+	KeySHA256 []string `json:"keySha256"`
+	// Aliases names the connection aliases of the core's configuration the tenant may use.
+	Aliases []string `json:"aliases,omitempty"`
+	// Connections are aliases of the tenant's own.
+	Connections map[string]ConnectionAlias `json:"connections,omitempty"`
+	// HostAccess lets the tenant pass DSNs of its own and call methods that reach the
+	// host the core runs on: its files, its network and its SSH keys. Without it the
+	// tenant only connects through its aliases.
+	HostAccess bool `json:"hostAccess,omitempty"`
+	// RateLimit caps the calls of all the tenant's sessions together, in the syntax of
+	// --session-rate-limit.
+	RateLimit string `json:"rateLimit,omitempty"`
+
+	rateLimits map[string]ratelimit.Rule
+}
+
+// tenantWorkspacePrefix marks the workspace ids of tenants, which clients cannot name in
+// core.initialize.
+const tenantWorkspacePrefix = "tenant:"
+
+// operatorMethods change or reveal the configuration of the whole core, or state shared by
+// all of its clients, so tenants cannot call them.
+var operatorMethods = map[string]bool{
+	"state.export":        true,
+	"state.import":        true,
+	"tx.recover":          true,
+	"query.schedule":      true,
+	"query.unschedule":    true,
+	"query.schedule.list": true,
+}
+
+// hostMethods reach the host the core runs on. Tenants need HostAccess to call them.
+var hostMethods = map[string]bool{
+	"connection.open": true,
+	"sandbox.open":    true,
+	"sandbox.execute": true,
+	"discover.docker": true,
+	"discover.scan":   true,
+	"ssh.trustHost":   true,
+	"tunnel.open":     true,
+	"tunnel.list":     true,
+	"tunnel.close":    true,
+	"export.run":      true,
+	"export.start":    true,
+	"job.start":       true,
+}
+
+var errAliasRequired = errors.New("this API key may only connect through connection aliases; list them with connection.aliases")
+
+// LoadTenants reads a JSON object mapping tenant names to tenants. Names are 1 to 64
+// letters, digits, dots, dashes or underscores, like workspaces; the state of a tenant is
+// kept under <state-dir>/tenants/<name>. Aliases must name entries of aliases.
+func LoadTenants(path string, aliases map[string]ConnectionAlias) (map[string]Tenant, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tenants map[string]Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	owners := make(map[string]string)
+	for name, tenant := range tenants {
+		if !validWorkspace.MatchString(name) {
+			return nil, fmt.Errorf("tenant %q: names are 1 to 64 letters, digits, dots, dashes or underscores, starting with a letter or digit", name)
+		}
+		if len(tenant.KeySHA256) == 0 {
+			return nil, fmt.Errorf("tenant %q: keySha256 lists no keys", name)
+		}
+		for _, digest := range tenant.KeySHA256 {
+			if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("tenant %q: %q is not a hex SHA-256 digest", name, digest)
+			}
+			if owner, ok := owners[digest]; ok {
+				return nil, fmt.Errorf("tenants %q and %q share an API key", owner, name)
+			}
+			owners[digest] = name
+		}
+		for _, alias := range tenant.Aliases {
+			if _, ok := aliases[alias]; !ok {
+				return nil, fmt.Errorf("tenant %q: unknown connection alias: %s", name, alias)
+			}
+		}
+		for alias, connection := range tenant.Connections {
+			if err := checkConnectionAlias(alias, connection); err != nil {
+				return nil, fmt.Errorf("tenant %q: %w", name, err)
+			}
+			if len(connection.SearchPath) > 0 {
+				connection.DSN = withSearchPath(connection.DSN, connection.SearchPath)
+				for i, replica := range connection.Replicas {
+					connection.Replicas[i] = withSearchPath(replica, connection.SearchPath)
+				}
+				tenant.Connections[alias] = connection
+			}
+		}
+		if tenant.rateLimits, err = ratelimit.ParseRules(tenant.RateLimit); err != nil {
+			return nil, fmt.Errorf("tenant %q: rateLimit: %w", name, err)
+		}
+		tenants[name] = tenant
+	}
+	return tenants, nil
+}
+
+// HashAPIKey returns the digest a tenant lists for key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// TenantAuthenticator accepts the API keys of tenants, for sessions that run as the tenant
+// the key belongs to.
+func TenantAuthenticator(tenants map[string]Tenant) rpc.Authenticator {
+	owners := make(map[string]string)
+	for name, tenant := range tenants {
+		for _, digest := range tenant.KeySHA256 {
+			owners[digest] = name
+		}
+	}
+	return func(key string) (string, bool) {
+		name, ok := owners[HashAPIKey(key)]
+		return name, ok
+	}
+}
+
+// tenantOf returns the tenant ctx runs as, or "" for the core's own sessions.
+func tenantOf(ctx context.Context) string {
+	if client, ok := rpc.SessionFromContext(ctx); ok {
+		return client.Tenant()
+	}
+	return ""
+}
+
+// tenantRestrictions refuses the methods a tenant may not call.
+func tenantRestrictions(tenants map[string]Tenant) rpc.Middleware {
+	return func(method string, next rpc.HandlerFunc) rpc.HandlerFunc {
+		if !operatorMethods[method] && !hostMethods[method] {
+			return next
+		}
+		return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+			name := tenantOf(ctx)
+			if name == "" {
+				return next(ctx, params)
+			}
+			if operatorMethods[method] || !tenants[name].HostAccess {
+				return nil, &rpc.Error{
+					Code:    -32190,
+					Message: method + " is not available to this API key",
+					Data:    map[string]string{"code": "FORBIDDEN", "tenant": name},
+				}
+			}
+			return next(ctx, params)
+		}
+	}
+}
+
+// tenantAliases returns the aliases a tenant may use: the configured ones it lists and
+// its own, which win on a name clash.
+func tenantAliases(tenant Tenant, global map[string]ConnectionAlias) map[string]ConnectionAlias {
+	aliases := make(map[string]ConnectionAlias, len(tenant.Aliases)+len(tenant.Connections))
+	for _, name := range tenant.Aliases {
+		aliases[name] = global[name]
+	}
+	for name, alias := range tenant.Connections {
+		aliases[name] = alias
+	}
+	return aliases
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/jobs"
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/ratelimit"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/rpc/rpctest"
+	"github.com/fluxgrid/core/internal/schema"
+	"github.com/rs/zerolog"
+)
+
+func TestLoadTenantsChecksTheFile(t *testing.T) {
+	digest := HashAPIKey("key")
+	aliases := map[string]ConnectionAlias{"shared": {Driver: "sqlite", DSN: ":memory:"}}
+	for _, tc := range []struct {
+		name, file, want string
+	}{
+		{"bad name", `{"a b":{"keySha256":["` + digest + `"]}}`, "names are"},
+		{"no keys", `{"a":{}}`, "lists no keys"},
+		{"bad digest", `{"a":{"keySha256":["key"]}}`, "not a hex SHA-256 digest"},
+		{"shared key", `{"a":{"keySha256":["` + digest + `"]},"b":{"keySha256":["` + digest + `"]}}`, "share an API key"},
+		{"unknown alias", `{"a":{"keySha256":["` + digest + `"],"aliases":["missing"]}}`, "unknown connection alias: missing"},
+		{"bad connection", `{"a":{"keySha256":["` + digest + `"],"connections":{"x":{"driver":"oracle","dsn":"x"}}}}`, "driver not supported"},
+		{"bad rate limit", `{"a":{"keySha256":["` + digest + `"],"rateLimit":"query.execute"}}`, "rateLimit"},
+	} {
+		path := filepath.Join(t.TempDir(), "tenants.json")
+		if err := os.WriteFile(path, []byte(tc.file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadTenants(path, aliases); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	if err := os.WriteFile(path, []byte(`{"team":{"keySha256":["`+digest+`"],"aliases":["shared"],"rateLimit":"query.execute=1/s"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tenants, err := LoadTenants(path, aliases)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := TenantAuthenticator(tenants)
+	if tenant, ok := auth("key"); !ok || tenant != "team" {
+		t.Fatalf("auth(key) = %q, %v", tenant, ok)
+	}
+	if _, ok := auth("other"); ok {
+		t.Fatal("an unknown key was accepted")
+	}
+	if tenants["team"].rateLimits["query.execute"].Burst != 1 {
+		t.Fatalf("rate limits = %+v", tenants["team"].rateLimits)
+	}
+}
+
+func TestTenantsKeepStateApart(t *testing.T) {
+	shared := searchDB(t, "CREATE TABLE t (id INTEGER)", "INSERT INTO t VALUES (1)")
+	own := searchDB(t, "CREATE TABLE mine (id INTEGER)")
+	stateDir := t.TempDir()
+	aliases := map[string]ConnectionAlias{
+		"shared": {Driver: "sqlite", DSN: shared},
+		"admin":  {Driver: "sqlite", DSN: shared},
+	}
+	tenants := map[string]Tenant{
+		"alpha": {Aliases: []string{"shared"}, Connections: map[string]ConnectionAlias{"own": {Driver: "sqlite", DSN: own}}},
+		"beta":  {Aliases: []string{"shared"}, HostAccess: true},
+	}
+	spaces := newWorkspaces(stateDir, aliases)
+	spaces.tenants = tenants
+	manager := jobs.NewManager(nil, jobs.Options{})
+	manager.RegisterKind("noop", jobs.Kind{Run: func(_ context.Context, _ json.RawMessage, _ jobs.Reporter) (any, *rpc.Error) {
+		return nil, nil
+	}})
+	server := rpctest.NewSerialServer(zerolog.Nop())
+	server.Use(tenantRestrictions(tenants), connectionHandleResolution(false, spaces))
+	server.Register("core.initialize", initializeHandler)
+	server.Register("query.execute", executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, spaces, 0))
+	server.Register("connection.aliases", connectionAliasesHandler(spaces))
+	server.Register("history.list", historyListHandler(spaces))
+	server.Register("state.export", stateExportHandler(Config{}, spaces, nil))
+	server.Register("connection.open", connectionOpenHandler)
+	server.Register("job.list", jobListHandler(manager, ""))
+	server.Register("maintenance.run", jobKindStartHandler(manager, "noop"))
+
+	type response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpc.Error      `json:"error"`
+	}
+	session := func(tenant string, requests ...string) []response {
+		t.Helper()
+		lines := make([]string, len(requests))
+		for i, request := range requests {
+			lines[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,%s}`, i+1, request)
+		}
+		var out bytes.Buffer
+		if err := server.ServeAs(tenant, strings.NewReader(strings.Join(lines, "\n")), &out); err != nil {
+			t.Fatal(err)
+		}
+		var responses []response
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var decoded response
+			if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			responses = append(responses, decoded)
+		}
+		return responses
+	}
+
+	alpha := session("alpha",
+		`"method":"core.initialize","params":{"protocolVersion":"1.0"}`,
+		`"method":"connection.aliases"`,
+		`"method":"query.execute","params":{"connection":{"alias":"shared"},"sql":"SELECT id FROM t"}`,
+		`"method":"query.execute","params":{"connection":{"alias":"own"},"sql":"SELECT id FROM mine"}`,
+		`"method":"history.list"`,
+		`"method":"maintenance.run","params":{}`,
+		`"method":"query.execute","params":{"connection":{"alias":"admin"},"sql":"SELECT 1"}`,
+		`"method":"query.execute","params":{"connection":{"driver":"sqlite","dsn":"`+shared+`"},"sql":"SELECT 1"}`,
+		`"method":"connection.open","params":{"driver":"sqlite","dsn":":memory:"}`,
+		`"method":"state.export"`,
+		`"method":"core.initialize","params":{"protocolVersion":"1.0","workspace":"beta"}`,
+	)
+	for i, r := range alpha[:6] {
+		if r.Error != nil {
+			t.Fatalf("alpha %d: %+v", i+1, r.Error)
+		}
+	}
+	if !strings.Contains(string(alpha[0].Result), `"workspace":"alpha"`) {
+		t.Fatalf("initialize = %s", alpha[0].Result)
+	}
+	if got := string(alpha[1].Result); !strings.Contains(got, `"shared"`) || !strings.Contains(got, `"own"`) || strings.Contains(got, `"admin"`) {
+		t.Fatalf("aliases = %s", got)
+	}
+	if !strings.Contains(string(alpha[4].Result), "SELECT id FROM mine") {
+		t.Fatalf("history = %s", alpha[4].Result)
+	}
+	if alpha[6].Error == nil || !strings.Contains(alpha[6].Error.Message, "unknown connection alias: admin") {
+		t.Fatalf("admin alias: %+v", alpha[6].Error)
+	}
+	if alpha[7].Error == nil || alpha[7].Error.Message != errAliasRequired.Error() {
+		t.Fatalf("raw DSN: %+v", alpha[7].Error)
+	}
+	for _, r := range alpha[8:10] {
+		if r.Error == nil || r.Error.Code != -32190 {
+			t.Fatalf("restricted method: %+v", r.Error)
+		}
+	}
+	if alpha[10].Error == nil || alpha[10].Error.Code != -32602 {
+		t.Fatalf("other workspace: %+v", alpha[10].Error)
+	}
+	for i, r := range session("alpha",
+		`"method":"query.execute","params":{"connection":{"driver":"sqlite","\u0064sn":"`+shared+`"},"sql":"SELECT 1"}`,
+		`"method":"query.execute","params":{"Connection":{"driver":"sqlite","DSN":"`+shared+`"},"sql":"SELECT 1"}`,
+	) {
+		if r.Error == nil || r.Error.Message != errAliasRequired.Error() {
+			t.Fatalf("raw DSN variant %d: %+v", i+1, r.Error)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "tenants", "alpha")); err != nil {
+		t.Fatal(err)
+	}
+
+	beta := session("beta",
+		`"method":"history.list"`,
+		`"method":"job.list"`,
+		`"method":"connection.open","params":{"driver":"sqlite","dsn":":memory:"}`,
+		`"method":"state.export"`,
+	)
+	if strings.Contains(string(beta[0].Result), "SELECT") || !strings.Contains(string(beta[1].Result), `"jobs":[]`) {
+		t.Fatalf("beta sees alpha's state: history = %s, jobs = %s", beta[0].Result, beta[1].Result)
+	}
+	if beta[2].Error != nil {
+		t.Fatalf("host access: %+v", beta[2].Error)
+	}
+	if beta[3].Error == nil || beta[3].Error.Code != -32190 {
+		t.Fatalf("operator method: %+v", beta[3].Error)
+	}
+
+	core := session("", `"method":"history.list"`, `"method":"job.list"`)
+	if strings.Contains(string(core[0].Result), "SELECT") || !strings.Contains(string(core[1].Result), `"jobs":[]`) {
+		t.Fatalf("the core's own clients see alpha's state: %s, %s", core[0].Result, core[1].Result)
+	}
+	alphaJobs := session("alpha", `"method":"job.list"`)
+	if !strings.Contains(string(alphaJobs[0].Result), `"owner":"alpha"`) {
+		t.Fatalf("alpha's jobs = %s", alphaJobs[0].Result)
+	}
+}
+
+func TestRateLimitingPerTenant(t *testing.T) {
+	rules, err := ratelimit.ParseRules("core.ping=1/m:2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenants := map[string]Tenant{"alpha": {rateLimits: rules}}
+	server := rpc.NewServer(zerolog.Nop())
+	server.Use(rateLimiting(RateLimits{}, tenants))
+	server.Register("core.ping", pingHandler)
+
+	ping := func(tenant string) string {
+		var out bytes.Buffer
+		if err := server.ServeAs(tenant, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"core.ping"}`), &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+	for i := 0; i < 2; i++ {
+		if got := ping("alpha"); !strings.Contains(got, `"status":"ok"`) {
+			t.Fatalf("ping %d = %s", i+1, got)
+		}
+	}
+	// The limit spans the tenant's sessions, and leaves other clients alone.
+	if got := ping("alpha"); !strings.Contains(got, `"scope":"tenant"`) {
+		t.Fatalf("third ping = %s", got)
+	}
+	if got := ping(""); !strings.Contains(got, `"status":"ok"`) {
+		t.Fatalf("own ping = %s", got)
+	}
+}
+
+func TestJobEventsReachOnlyTheirTenant(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	manager := jobs.NewManager(server, jobs.Options{ProgressInterval: -1})
+	manager.RegisterKind("noop", jobs.Kind{Run: func(_ context.Context, _ json.RawMessage, report jobs.Reporter) (any, *rpc.Error) {
+		report(jobs.Progress{Phase: "working", Done: 1, Total: 2})
+		return map[string]any{"rows": 1}, nil
+	}})
+	server.Register("core.ping", pingHandler)
+	server.Register("maintenance.run", jobKindStartHandler(manager, "noop"))
+
+	alpha := connectMatrixClient(t, server, "alpha")
+	beta := connectMatrixClient(t, server, "beta")
+	beta.mustCall("core.ping", nil, nil)
+
+	alpha.mustCall("maintenance.run", map[string]any{}, nil)
+	received := alpha.await("job.finished")
+	if received[0].Method != "job.progress" {
+		t.Fatalf("the owner received %s first", received[0].Method)
+	}
+	beta.mustCall("core.ping", nil, nil)
+	for _, msg := range beta.notifications {
+		if strings.HasPrefix(msg.Method, "job.") {
+			t.Fatalf("another tenant received %s: %s", msg.Method, msg.Params)
+		}
+	}
+}
+
+func TestSchemaChangesReachOnlyTheirTenant(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("core.ping", pingHandler)
+	server.Register("test.ddl", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		var payload executeParams
+		payload.Connection.Driver = "sqlite"
+		payload.Connection.DSN = ":memory:"
+		publishSchemaChanges(ctx, server, schema.NewCache(0), payload, executeResult{
+			Affected: []ddl.Object{{Action: ddl.ActionCreate, Kind: "table", Schema: "main", Name: "secret_orders"}},
+		})
+		return map[string]any{}, nil
+	})
+
+	alpha := connectMatrixClient(t, server, "alpha")
+	otherAlpha := connectMatrixClient(t, server, "alpha")
+	beta := connectMatrixClient(t, server, "beta")
+	otherAlpha.mustCall("core.ping", nil, nil)
+	beta.mustCall("core.ping", nil, nil)
+
+	alpha.mustCall("test.ddl", nil, nil)
+	alpha.await("schema.changed")
+	otherAlpha.await("schema.changed")
+	beta.mustCall("core.ping", nil, nil)
+	for _, msg := range beta.notifications {
+		if msg.Method == "schema.changed" {
+			t.Fatalf("another tenant received schema.changed: %s", msg.Params)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import "time"
+
+// queryTiming breaks a query's elapsed time down by phase, so that slowness can be told
+// apart as network, planner or transfer.
+type queryTiming struct {
+	// ConnectMs is spent opening the connection.
+	ConnectMs float64 `json:"connectMs"`
+	// FirstRowMs runs from sending the statement until the first row, or the end of the
+	// result when it has none. It covers planning and execution up to that row.
+	FirstRowMs float64 `json:"firstRowMs"`
+	// FetchMs is spent reading the remaining rows.
+	FetchMs float64 `json:"fetchMs"`
+	// SerializeMs is spent converting rows to JSON values and, when streaming, encoding
+	// chunks.
+	SerializeMs float64 `json:"serializeMs"`
+	// BackpressureMs is spent by a stream waiting for the client to accept chunks.
+	BackpressureMs float64 `json:"backpressureMs,omitempty"`
+}
+
+// queryTimer measures the phases of queryTiming. Serialization and backpressure are
+// accumulated separately and subtracted from the fetch phase they interrupt.
+type queryTimer struct {
+	timing       queryTiming
+	phase        time.Time
+	firstRow     bool
+	serialize    time.Duration
+	backpressure time.Duration
+}
+
+func newQueryTimer() *queryTimer {
+	return &queryTimer{phase: time.Now()}
+}
+
+// connected ends the connect phase.
+func (t *queryTimer) connected() {
+	now := time.Now()
+	t.timing.ConnectMs = milliseconds(now.Sub(t.phase))
+	t.phase = now
+}
+
+// rowArrived ends the first-row phase on its first call.
+func (t *queryTimer) rowArrived() {
+	if t.firstRow {
+		return
+	}
+	t.firstRow = true
+	now := time.Now()
+	t.timing.FirstRowMs = milliseconds(now.Sub(t.phase))
+	t.phase = now
+}
+
+// serialized adds the time since start to the serialize phase.
+func (t *queryTimer) serialized(start time.Time) {
+	t.serialize += time.Since(start)
+}
+
+// waited adds the time since start to the backpressure phase.
+func (t *queryTimer) waited(start time.Time) {
+	t.backpressure += time.Since(start)
+}
+
+// finish ends the fetch phase and returns the breakdown.
+func (t *queryTimer) finish() *queryTiming {
+	t.rowArrived()
+	fetch := time.Since(t.phase) - t.serialize - t.backpressure
+	t.timing.FetchMs = milliseconds(max(fetch, 0))
+	t.timing.SerializeMs = milliseconds(t.serialize)
+	t.timing.BackpressureMs = milliseconds(t.backpressure)
+	timing := t.timing
+	return &timing
+}
+
+func milliseconds(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
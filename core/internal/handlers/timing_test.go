@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryTimerSplitsPhases(t *testing.T) {
+	timer := newQueryTimer()
+	time.Sleep(5 * time.Millisecond)
+	timer.connected()
+	time.Sleep(5 * time.Millisecond)
+	timer.rowArrived()
+
+	start := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	timer.serialized(start)
+	timer.rowArrived()
+	start = time.Now()
+	time.Sleep(10 * time.Millisecond)
+	timer.waited(start)
+
+	timing := timer.finish()
+	if timing.ConnectMs < 5 || timing.FirstRowMs < 5 || timing.SerializeMs < 10 || timing.BackpressureMs < 10 {
+		t.Fatalf("expected every phase to be measured, got %+v", timing)
+	}
+	if timing.FetchMs < 0 || timing.FetchMs >= timing.SerializeMs {
+		t.Fatalf("expected serialization and backpressure to be excluded from fetch, got %+v", timing)
+	}
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fluxgrid/core/internal/charset"
+	"github.com/fluxgrid/core/internal/rowbuf"
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxLossyCells caps the cells a transcoding report lists.
+const maxLossyCells = 1000
+
+type transcodingReport struct {
+	// Charset is the character set text was decoded from, or "raw".
+	Charset string `json:"charset"`
+	// TranscodedCells counts the cells decoded from Charset or rendered as hex.
+	TranscodedCells int `json:"transcodedCells"`
+	// LossyCells counts the cells holding bytes with no character in Charset, which were
+	// replaced with U+FFFD. Lossy lists the first of them as [row, column].
+	LossyCells int      `json:"lossyCells"`
+	Lossy      [][2]int `json:"lossy,omitempty"`
+}
+
+// resultText turns the byte cells of a database/sql result into text. Cells that are
+// valid UTF-8 are kept as they are, unless the connection itself uses a legacy charset:
+// then the server sends every text column in it.
+type resultText struct {
+	decoder charset.Decoder
+	all     bool
+	binary  []bool
+	report  transcodingReport
+}
+
+// newResultText picks the charset of a result from the charset option, or for MySQL from
+// the charset the DSN asks the server to send.
+func newResultText(driver, dsn, option string) (*resultText, error) {
+	if option != "" {
+		decoder, err := charset.Lookup(option)
+		if err != nil {
+			return nil, err
+		}
+		return &resultText{decoder: decoder, report: transcodingReport{Charset: decoder.Name}}, nil
+	}
+	decoder, _ := charset.Lookup("utf8")
+	text := &resultText{decoder: decoder}
+	if driver == "mysql" {
+		if cfg, err := mysql.ParseDSN(dsn); err == nil && cfg.Params["charset"] != "" {
+			// The driver uses the first charset of the list the server accepts.
+			name, _, _ := strings.Cut(cfg.Params["charset"], ",")
+			if legacy, err := charset.Lookup(name); err == nil && !legacy.UTF8() {
+				text.decoder, text.all = legacy, true
+			}
+		}
+	}
+	text.report.Charset = text.decoder.Name
+	return text, nil
+}
+
+// setColumns marks the binary columns, which are never in the connection charset.
+func (t *resultText) setColumns(columns []column) {
+	t.binary = make([]bool, len(columns))
+	for i, col := range columns {
+		name := strings.ToUpper(col.DataType)
+		t.binary[i] = strings.Contains(name, "BLOB") || strings.Contains(name, "BINARY") || name == "BIT" || name == "GEOMETRY"
+	}
+}
+
+func (t *resultText) cell(row, col int, b []byte, intern *rowbuf.Interner) any {
+	if t.all && !t.binary[col] {
+		if isASCII(b) {
+			return intern.String(b)
+		}
+	} else if utf8.Valid(b) {
+		return intern.String(b)
+	}
+	text, lossy := t.decoder.Decode(b)
+	if !t.decoder.UTF8() {
+		t.report.TranscodedCells++
+	}
+	if lossy {
+		t.report.LossyCells++
+		if len(t.report.Lossy) < maxLossyCells {
+			t.report.Lossy = append(t.report.Lossy, [2]int{row, col})
+		}
+	}
+	return text
+}
+
+// result returns the report, or nil when no cell needed decoding.
+func (t *resultText) result() *transcodingReport {
+	if t.report.TranscodedCells == 0 && t.report.LossyCells == 0 {
+		return nil
+	}
+	return &t.report
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewResultTextReadsTheDSNCharset(t *testing.T) {
+	text, err := newResultText("mysql", "user:pw@tcp(db:3306)/app?charset=latin1,utf8mb4", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.setColumns([]column{{Name: "name", DataType: "VARCHAR"}, {Name: "data", DataType: "BLOB"}})
+	if got := text.cell(0, 0, []byte("caf\xe9"), newInterner()); got != "café" {
+		t.Errorf("latin1 text was not decoded: %q", got)
+	}
+	if got := text.cell(0, 1, []byte("é"), newInterner()); got != "é" {
+		t.Errorf("binary column was decoded: %q", got)
+	}
+	if report := text.result(); report == nil || report.Charset != "latin1" || report.TranscodedCells != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if text, _ := newResultText("mysql", "user:pw@tcp(db:3306)/app", ""); !text.decoder.UTF8() || text.all {
+		t.Errorf("expected UTF-8 without a DSN charset, got %+v", text)
+	}
+	if _, err := newResultText("mysql", "", "klingon"); err == nil {
+		t.Error("expected an unknown charset to be refused")
+	}
+}
+
+func TestExecuteClassicTranscodesInvalidUTF8(t *testing.T) {
+	dsn := searchDB(t,
+		`CREATE TABLE t (id INTEGER, name TEXT, data BLOB)`,
+		`INSERT INTO t VALUES (1, 'plain', X'636166E9'), (2, CAST(X'6E61EF7665' AS TEXT), X'6F6B')`,
+	)
+	run := func(charset string) executeResult {
+		var payload executeParams
+		payload.Connection.Driver, payload.Connection.DSN = "sqlite", dsn
+		payload.SQL = "SELECT name, data FROM t ORDER BY id"
+		payload.Options.TimeoutSeconds, payload.Options.MaxRows, payload.Options.Charset = 10, 100, charset
+		raw, rpcErr := executeClassic(context.Background(), payload)
+		if rpcErr != nil {
+			t.Fatalf("%s: %+v", charset, rpcErr)
+		}
+		return raw.(executeResult)
+	}
+
+	result := run("")
+	if result.Transcoding == nil || result.Transcoding.LossyCells != 2 || result.Transcoding.Lossy[0] != [2]int{0, 1} {
+		t.Fatalf("expected lossy cells to be flagged, got %+v", result.Transcoding)
+	}
+
+	result = run("latin1")
+	if result.Rows[0][1] != "café" || result.Rows[1][0] != "naïve" || result.Rows[1][1] != "ok" {
+		t.Fatalf("unexpected rows %v", result.Rows)
+	}
+	if result.Transcoding.TranscodedCells != 2 || result.Transcoding.LossyCells != 0 {
+		t.Fatalf("unexpected report %+v", result.Transcoding)
+	}
+
+	result = run("raw")
+	if result.Rows[0][1] != `\x636166e9` || result.Rows[0][0] != "plain" {
+		t.Fatalf("unexpected rows %v", result.Rows)
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"github.com/fluxgrid/core/internal/tunnel"
+)
+
+const tunnelOpenTimeout = 30 * time.Second
+
+type tunnelOpenParams struct {
+	tunnel.Spec
+	// HostKeyMode is strict, tofu or prompt (the default).
+	HostKeyMode string `json:"hostKeyMode"`
+}
+
+type tunnelListResult struct {
+	Tunnels []tunnel.Info `json:"tunnels"`
+}
+
+type tunnelCloseParams struct {
+	ID string `json:"id" jsonschema:"required"`
+}
+
+type tunnelCloseResult struct {
+	Closed bool `json:"closed"`
+}
+
+// tunnelHostKeyError is the data of a -32141 error. The client shows the key to the user
+// and, if they accept it, calls ssh.trustHost and opens the tunnel again.
+type tunnelHostKeyError struct {
+	Reason string `json:"reason"`
+	sshtrust.HostKey
+	Known []string `json:"known,omitempty"`
+}
+
+// tunnelClosedEvent tells the client that a tunnel stopped on its own.
+type tunnelClosedEvent struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+type sessionTunnelsKey struct{}
+
+// sessionTunnels are the tunnels opened by one client. They close when it disconnects.
+type sessionTunnels struct {
+	manager *tunnel.Manager
+
+	mu sync.Mutex
+	// release holds the log redactions of each tunnel's credentials.
+	release map[string]func()
+}
+
+func tunnelsOf(ctx context.Context, store *sshtrust.Store) (*sessionTunnels, bool) {
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return client.Value(sessionTunnelsKey{}, func() any {
+		t := &sessionTunnels{release: make(map[string]func())}
+		t.manager = tunnel.NewManager(tunnel.Options{HostKeys: store}, func(info tunnel.Info, err error) {
+			t.forget(info.ID)
+			_ = client.Notify("tunnel.closed", tunnelClosedEvent{ID: info.ID, Error: err.Error()})
+		})
+		client.OnClose(func() {
+			t.manager.CloseAll()
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			for id, release := range t.release {
+				release()
+				delete(t.release, id)
+			}
+		})
+		return t
+	}).(*sessionTunnels), true
+}
+
+func (t *sessionTunnels) remember(id string, release func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.release[id] = release
+}
+
+func (t *sessionTunnels) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if release, ok := t.release[id]; ok {
+		release()
+		delete(t.release, id)
+	}
+}
+
+func tunnelOpenHandler(store *sshtrust.Store) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload tunnelOpenParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		mode, err := sshtrust.ParseMode(payload.HostKeyMode)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: err.Error()}
+		}
+		if err := payload.Validate(); err != nil {
+			return nil, &rpc.Error{Code: -32602, Message: err.Error()}
+		}
+		if store == nil && payload.Kubernetes == nil {
+			return nil, &rpc.Error{Code: -32603, Message: "SSH tunnels require a state directory for known hosts"}
+		}
+		tunnels, ok := tunnelsOf(ctx, store)
+		if !ok {
+			return nil, &rpc.Error{Code: -32603, Message: "tunnel.open requires a client session"}
+		}
+
+		var releases []func()
+		for _, hop := range payload.Hops {
+			for _, value := range []string{hop.Auth.Password, hop.Auth.PrivateKey, hop.Auth.Passphrase} {
+				releases = append(releases, logging.Redact(value))
+			}
+		}
+		releaseAll := func() {
+			for _, release := range releases {
+				release()
+			}
+		}
+
+		openCtx, cancel := context.WithTimeout(ctx, tunnelOpenTimeout)
+		defer cancel()
+		info, err := tunnels.manager.Open(openCtx, payload.Spec, mode)
+		if err != nil {
+			releaseAll()
+			return nil, tunnelError(err)
+		}
+		tunnels.remember(info.ID, releaseAll)
+		return info, nil
+	}
+}
+
+func tunnelError(err error) *rpc.Error {
+	var (
+		unknown *sshtrust.UnknownHostError
+		changed *sshtrust.ChangedHostError
+	)
+	switch {
+	case errors.As(err, &unknown):
+		return &rpc.Error{
+			Code:    -32141,
+			Message: err.Error(),
+			Data:    tunnelHostKeyError{Reason: "unknown", HostKey: unknown.HostKey},
+		}
+	case errors.As(err, &changed):
+		return &rpc.Error{
+			Code:    -32141,
+			Message: err.Error(),
+			Data:    tunnelHostKeyError{Reason: "changed", HostKey: changed.HostKey, Known: changed.Known},
+		}
+	default:
+		return &rpc.Error{
+			Code:    -32140,
+			Message: "failed to open SSH tunnel",
+			Data:    err.Error(),
+		}
+	}
+}
+
+func tunnelListHandler(store *sshtrust.Store) rpc.HandlerFunc {
+	return func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		result := tunnelListResult{Tunnels: []tunnel.Info{}}
+		if tunnels, ok := tunnelsOf(ctx, store); ok {
+			result.Tunnels = tunnels.manager.List()
+		}
+		return result, nil
+	}
+}
+
+func tunnelCloseHandler(store *sshtrust.Store) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload tunnelCloseParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		tunnels, ok := tunnelsOf(ctx, store)
+		closed := ok && tunnels.manager.Close(payload.ID)
+		if closed {
+			tunnels.forget(payload.ID)
+		}
+		return tunnelCloseResult{Closed: closed}, nil
+	}
+}
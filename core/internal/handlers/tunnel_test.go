@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/sshtrust"
+)
+
+func TestTunnelOpenValidatesParams(t *testing.T) {
+	handler := tunnelOpenHandler(hostKeyStore(t.TempDir()))
+	for _, params := range []map[string]any{
+		{"remoteHost": "db", "remotePort": 5432},
+		{"hops": []map[string]any{{"host": "bastion", "user": "me"}}, "remoteHost": "db"},
+		{"hops": []map[string]any{{"host": "bastion", "user": "me"}}, "remoteHost": "db", "remotePort": 5432, "hostKeyMode": "off"},
+	} {
+		raw, _ := json.Marshal(params)
+		if _, rpcErr := handler(context.Background(), raw); rpcErr == nil || rpcErr.Code != -32602 {
+			t.Fatalf("expected invalid params for %v, got %+v", params, rpcErr)
+		}
+	}
+}
+
+func TestTunnelErrorReportsHostKeys(t *testing.T) {
+	unknown := &sshtrust.UnknownHostError{HostKey: sshtrust.HostKey{Host: "bastion", Fingerprint: "SHA256:abc"}}
+	rpcErr := tunnelError(fmt.Errorf("ssh hop 1 (bastion:22): %w", unknown))
+	data, ok := rpcErr.Data.(tunnelHostKeyError)
+	if rpcErr.Code != -32141 || !ok || data.Reason != "unknown" || data.Fingerprint != "SHA256:abc" {
+		t.Fatalf("unexpected error %+v", rpcErr)
+	}
+
+	changed := &sshtrust.ChangedHostError{HostKey: sshtrust.HostKey{Host: "bastion"}, Known: []string{"SHA256:old"}}
+	if rpcErr := tunnelError(changed); rpcErr.Code != -32141 || rpcErr.Data.(tunnelHostKeyError).Reason != "changed" {
+		t.Fatalf("unexpected error %+v", rpcErr)
+	}
+	if rpcErr := tunnelError(errors.New("connection refused")); rpcErr.Code != -32140 {
+		t.Fatalf("unexpected error %+v", rpcErr)
+	}
+}
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/ddl"
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/masking"
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/txjournal"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+)
+
+// txJournal returns the journal of open transactions under stateDir, or nil when
+// persistence is off.
+func txJournal(stateDir string) *txjournal.Journal {
+	if stateDir == "" {
+		return nil
+	}
+	return txjournal.Open(filepath.Join(stateDir, "transactions"))
+}
+
+// txSession is a transaction a client keeps open across calls, on a connection of its
+// own.
+type txSession struct {
+	id         string
+	driver     string
+	target     string
+	startedAt  time.Time
+	backendPID int64
+
+	// mu runs one statement at a time; a connection cannot do more.
+	mu    sync.Mutex
+	pg    *pgx.Conn
+	pgTx  pgx.Tx
+	db    *sql.DB
+	sqlTx *sql.Tx
+	// savepoints is the stack of savepoints set through tx.savepoint, outermost first.
+	savepoints []string
+	// masking masks results when the connection is restricted.
+	masking *masking.Policy
+}
+
+// beginTx connects and opens a transaction.
+func beginTx(ctx context.Context, conn dbConnectionParams) (*txSession, *rpc.Error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, &rpc.Error{Code: -32603, Message: "failed to allocate a transaction id", Data: err.Error()}
+	}
+	s := &txSession{
+		id:        "tx_" + hex.EncodeToString(id[:]),
+		driver:    conn.Driver,
+		target:    connectionTarget(conn),
+		startedAt: time.Now().UTC(),
+		masking:   dataMasks.policyFor(conn),
+	}
+	connectErr := func(err error) *rpc.Error {
+		return &rpc.Error{Code: -32010, Message: "failed to connect to database", Data: err.Error()}
+	}
+
+	switch conn.Driver {
+	case "postgres":
+		pg, _, err := connectPostgres(ctx, conn.DSN)
+		if err != nil {
+			return nil, connectErr(err)
+		}
+		tx, err := pg.Begin(ctx)
+		if err != nil {
+			pg.Close(context.Background())
+			return nil, connectErr(err)
+		}
+		s.pg, s.pgTx, s.backendPID = pg, tx, int64(pg.PgConn().PID())
+	case "mysql", "sqlite":
+		db, err := defaultSQLOpener(conn.Driver)(ctx, conn.DSN)
+		if err != nil {
+			return nil, connectErr(err)
+		}
+		// database/sql rolls a transaction back when the context it began with is done,
+		// so the transaction is detached from this request once connected.
+		if err := db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, connectErr(err)
+		}
+		tx, err := db.BeginTx(context.WithoutCancel(ctx), nil)
+		if err != nil {
+			db.Close()
+			return nil, connectErr(err)
+		}
+		s.db, s.sqlTx = db, tx
+		if conn.Driver == "mysql" {
+			_ = tx.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&s.backendPID)
+		}
+	default:
+		return nil, &rpc.Error{Code: -32601, Message: fmt.Sprintf("driver not supported: %s", conn.Driver)}
+	}
+	return s, nil
+}
+
+// query runs a statement in the transaction and reads up to maxRows of its result.
+func (s *txSession) query(ctx context.Context, statement string, maxRows int, args ...any) (executeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := time.Now()
+	var result executeResult
+	notices := noticesFor(ctx)
+
+	if s.pgTx != nil {
+		defer postgresNotices.route(s.pg.PgConn(), notices)()
+		rows, err := s.pgTx.Query(ctx, tagSQL(ctx, statement), args...)
+		if err != nil {
+			return result, err
+		}
+		defer rows.Close()
+		for _, field := range rows.FieldDescriptions() {
+			result.Columns = append(result.Columns, column{Name: field.Name, DataType: fmt.Sprintf("%d", field.DataTypeOID)})
+		}
+		for len(result.Rows) < maxRows && rows.Next() {
+			values, err := rows.Values()
+			if err != nil {
+				return result, err
+			}
+			for i, value := range values {
+				values[i] = normalizeValue(value)
+			}
+			result.Rows = append(result.Rows, values)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+	} else {
+		rows, err := s.sqlTx.QueryContext(ctx, tagSQL(ctx, statement), args...)
+		if err != nil {
+			return result, err
+		}
+		defer rows.Close()
+		names, err := rows.Columns()
+		if err != nil {
+			return result, err
+		}
+		types, _ := rows.ColumnTypes()
+		for i, name := range names {
+			dataType := "text"
+			if i < len(types) && types[i].DatabaseTypeName() != "" {
+				dataType = types[i].DatabaseTypeName()
+			}
+			result.Columns = append(result.Columns, column{Name: name, DataType: dataType})
+		}
+		for len(result.Rows) < maxRows && rows.Next() {
+			values := make([]any, len(names))
+			targets := make([]any, len(names))
+			for i := range values {
+				targets[i] = &values[i]
+			}
+			if err := rows.Scan(targets...); err != nil {
+				return result, err
+			}
+			for i, value := range values {
+				values[i] = normalizeValue(value)
+			}
+			result.Rows = append(result.Rows, values)
+		}
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+		rows.Close()
+		if s.driver == "mysql" {
+			if err := collectMySQLWarnings(ctx, s.sqlTx, notices); err != nil {
+				logger := logging.Logger()
+				logger.Warn().Err(err).Msg("failed to read warnings")
+			}
+		}
+	}
+
+	if result.Columns == nil {
+		result.Columns = []column{}
+	}
+	if result.Rows == nil {
+		result.Rows = [][]any{}
+	}
+	result.mask(s.masking)
+	result.ExecutionTimeMs = time.Since(start).Seconds() * 1000
+	result.Affected = ddl.Parse(statement)
+	result.Warnings = notices.list()
+	return result, nil
+}
+
+// finish commits or rolls back the transaction and closes its connection.
+func (s *txSession) finish(ctx context.Context, commit bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	if s.pgTx != nil {
+		if commit {
+			err = s.pgTx.Commit(ctx)
+		} else {
+			err = s.pgTx.Rollback(ctx)
+		}
+		s.pg.Close(context.Background())
+		return err
+	}
+	if commit {
+		err = s.sqlTx.Commit()
+	} else {
+		err = s.sqlTx.Rollback()
+	}
+	s.db.Close()
+	return err
+}
+
+func (s *txSession) entry() txjournal.Entry {
+	sum := sha256.Sum256([]byte(s.driver + "\x00" + s.target))
+	return txjournal.Entry{
+		ID:          s.id,
+		Driver:      s.driver,
+		Target:      s.target,
+		Fingerprint: hex.EncodeToString(sum[:8]),
+		BackendPID:  s.backendPID,
+		StartedAt:   s.startedAt,
+	}
+}
+
+// connectionTarget names the server and database of a connection without its
+// credentials.
+func connectionTarget(conn dbConnectionParams) string {
+	switch conn.Driver {
+	case "postgres":
+		if cfg, err := pgx.ParseConfig(conn.DSN); err == nil {
+			return fmt.Sprintf("%s@%s:%d/%s", cfg.User, cfg.Host, cfg.Port, cfg.Database)
+		}
+	case "mysql":
+		if cfg, err := mysql.ParseDSN(conn.DSN); err == nil {
+			return fmt.Sprintf("%s@%s/%s", cfg.User, cfg.Addr, cfg.DBName)
+		}
+	case "sqlite":
+		path, _, _ := strings.Cut(strings.TrimPrefix(conn.DSN, "file:"), "?")
+		return path
+	}
+	return conn.Driver
+}
+
+// txSessions holds the transactions one client has open. They are rolled back when the
+// client disconnects.
+type txSessions struct {
+	journal *txjournal.Journal
+
+	mu   sync.Mutex
+	open map[string]*txSession
+	// manual is set while autocommit is off; implicit maps each connection to the
+	// transaction query.execute opened on it in that mode.
+	manual   bool
+	implicit map[string]string
+	beginMu  sync.Mutex
+}
+
+type txSessionsKey struct{}
+
+func txSessionsOf(ctx context.Context, journal *txjournal.Journal) (*txSessions, bool) {
+	client, ok := rpc.SessionFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return client.Value(txSessionsKey{}, func() any {
+		s := &txSessions{journal: journal, open: make(map[string]*txSession), implicit: make(map[string]string)}
+		client.OnClose(s.rollbackAll)
+		return s
+	}).(*txSessions), true
+}
+
+func (t *txSessions) add(s *txSession) {
+	t.mu.Lock()
+	t.open[s.id] = s
+	t.mu.Unlock()
+	t.record(t.journal.Begin(s.entry()))
+}
+
+func (t *txSessions) get(id string) (*txSession, *rpc.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.open[id]
+	if !ok {
+		return nil, &rpc.Error{Code: -32170, Message: fmt.Sprintf("unknown transaction: %s", id)}
+	}
+	return s, nil
+}
+
+// remove takes a transaction out of the session before it is finished, so that no
+// statement can start on it meanwhile.
+func (t *txSessions) remove(id string) (*txSession, *rpc.Error) {
+	t.mu.Lock()
+	s, ok := t.open[id]
+	delete(t.open, id)
+	for key, txID := range t.implicit {
+		if txID == id {
+			delete(t.implicit, key)
+		}
+	}
+	t.mu.Unlock()
+	if !ok {
+		return nil, &rpc.Error{Code: -32170, Message: fmt.Sprintf("unknown transaction: %s", id)}
+	}
+	t.record(t.journal.End(id))
+	return s, nil
+}
+
+func (t *txSessions) rollbackAll() {
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.open))
+	for id := range t.open {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+	for _, id := range ids {
+		if s, rpcErr := t.remove(id); rpcErr == nil {
+			_ = s.finish(context.Background(), false)
+		}
+	}
+}
+
+// record logs a failure to update the journal. The transaction itself is unaffected;
+// only its recovery after a crash is.
+func (t *txSessions) record(err error) {
+	if err != nil {
+		logger := logging.Logger()
+		logger.Warn().Err(err).Msg("failed to update the transaction journal")
+	}
+}
+
+type txBeginParams struct {
+	Connection dbConnectionParams `json:"connection" jsonschema:"required"`
+	Options    struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+	} `json:"options"`
+}
+
+type txBeginResult struct {
+	TxID string `json:"txId"`
+	// BackendPID is the server's id for the session holding the transaction.
+	BackendPID int64     `json:"backendPid,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+type txExecuteParams struct {
+	TxID    string `json:"txId" jsonschema:"required"`
+	SQL     string `json:"sql" jsonschema:"required"`
+	Options struct {
+		TimeoutSeconds int `json:"timeoutSeconds"`
+		MaxRows        int `json:"maxRows"`
+	} `json:"options"`
+}
+
+type txIDParams struct {
+	TxID string `json:"txId" jsonschema:"required"`
+}
+
+type txFinishResult struct {
+	TxID      string `json:"txId"`
+	Committed bool   `json:"committed"`
+}
+
+type txRecoverParams struct {
+	// Dismiss lists orphaned transactions the user has dealt with, to stop reporting them.
+	Dismiss []string `json:"dismiss"`
+}
+
+type txRecoverResult struct {
+	Orphans   []txjournal.Orphan `json:"orphans"`
+	Dismissed int                `json:"dismissed"`
+}
+
+// txBeginHandler opens a transaction on a connection of its own, kept until it is
+// committed or rolled back or the client disconnects.
+func txBeginHandler(journal *txjournal.Journal) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload txBeginParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 15
+		}
+		sessions, ok := txSessionsOf(ctx, journal)
+		if !ok {
+			return nil, &rpc.Error{Code: -32603, Message: "tx.begin requires a client session"}
+		}
+
+		connectCtx, cancel := context.WithTimeout(ctx, time.Duration(payload.Options.TimeoutSeconds)*time.Second)
+		defer cancel()
+		session, rpcErr := beginTx(connectCtx, payload.Connection)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		sessions.add(session)
+		return txBeginResult{TxID: session.id, BackendPID: session.backendPID, StartedAt: session.startedAt}, nil
+	}
+}
+
+func txExecuteHandler(journal *txjournal.Journal, rewriter *rewrite.Rewriter) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload txExecuteParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Options.TimeoutSeconds <= 0 {
+			payload.Options.TimeoutSeconds = 30
+		}
+		if payload.Options.MaxRows <= 0 {
+			payload.Options.MaxRows = 500
+		}
+		sessions, ok := txSessionsOf(ctx, journal)
+		if !ok {
+			return nil, &rpc.Error{Code: -32170, Message: fmt.Sprintf("unknown transaction: %s", payload.TxID)}
+		}
+		session, rpcErr := sessions.get(payload.TxID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+
+		rewritten := applyRewrites(rewriter, session.driver, &payload.SQL)
+
+		sessions.record(journal.Statement(session.id, payload.SQL, time.Now().UTC()))
+		timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(payload.Options.TimeoutSeconds)*time.Second)
+		defer cancel()
+		result, err := session.query(timeoutCtx, payload.SQL, payload.Options.MaxRows)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32011, Message: "query execution failed", Data: err.Error()}
+		}
+		result.Transaction = sessions.status(session.id)
+		result.Rewrite = rewritten
+		return result, nil
+	}
+}
+
+// txFinishHandler commits or rolls back a transaction. The transaction is closed either
+// way, even when committing fails.
+func txFinishHandler(journal *txjournal.Journal, commit bool) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload txIDParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		sessions, ok := txSessionsOf(ctx, journal)
+		if !ok {
+			return nil, &rpc.Error{Code: -32170, Message: fmt.Sprintf("unknown transaction: %s", payload.TxID)}
+		}
+		session, rpcErr := sessions.remove(payload.TxID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		if err := session.finish(ctx, commit); err != nil {
+			return nil, &rpc.Error{Code: -32011, Message: "query execution failed", Data: err.Error()}
+		}
+		return txFinishResult{TxID: session.id, Committed: commit}, nil
+	}
+}
+
+// txRecoverHandler reports transactions left open by a core that exited without ending
+// them, so that the user can look for them on the server.
+func txRecoverHandler(journal *txjournal.Journal) rpc.HandlerFunc {
+	return func(_ context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload txRecoverParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &payload); err != nil {
+				return nil, &rpc.Error{
+					Code:    -32602,
+					Message: "invalid parameters",
+					Data:    err.Error(),
+				}
+			}
+		}
+		dismissed, err := journal.Dismiss(payload.Dismiss)
+		if err != nil {
+			return nil, &rpc.Error{Code: -32603, Message: "failed to update the transaction journal", Data: err.Error()}
+		}
+		orphans, err := journal.Orphans()
+		if err != nil {
+			return nil, &rpc.Error{Code: -32603, Message: "failed to read the transaction journal", Data: err.Error()}
+		}
+		if orphans == nil {
+			orphans = []txjournal.Orphan{}
+		}
+		return txRecoverResult{Orphans: orphans, Dismissed: dismissed}, nil
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/txjournal"
+)
+
+// txStatus tells a client whether the statement it ran left changes uncommitted.
+type txStatus struct {
+	Autocommit bool `json:"autocommit"`
+	// InTransaction is set when the statement ran in a transaction that is still open.
+	InTransaction bool   `json:"inTransaction"`
+	TxID          string `json:"txId,omitempty"`
+}
+
+type txSetAutocommitParams struct {
+	Autocommit *bool `json:"autocommit" jsonschema:"required"`
+}
+
+type txModeResult struct {
+	Autocommit   bool         `json:"autocommit"`
+	Transactions []txOpenInfo `json:"transactions"`
+}
+
+// txOpenInfo describes a transaction the client has open.
+type txOpenInfo struct {
+	TxID      string    `json:"txId"`
+	Driver    string    `json:"driver"`
+	Target    string    `json:"target"`
+	StartedAt time.Time `json:"startedAt"`
+	// Implicit is set for transactions query.execute opened while autocommit was off.
+	Implicit   bool     `json:"implicit"`
+	Savepoints []string `json:"savepoints"`
+}
+
+func (t *txSessions) autocommit() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.manual
+}
+
+// status reports the state of transaction id after a statement ran in it.
+func (t *txSessions) status(id string) *txStatus {
+	return &txStatus{Autocommit: t.autocommit(), InTransaction: true, TxID: id}
+}
+
+// setAutocommit switches the client between autocommit and explicit transactions.
+// Autocommit cannot be turned back on while a transaction it would have committed is
+// open; the client has to commit or roll those back first.
+func (t *txSessions) setAutocommit(on bool) *rpc.Error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if on && len(t.implicit) > 0 {
+		ids := make([]string, 0, len(t.implicit))
+		for _, id := range t.implicit {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		return &rpc.Error{
+			Code:    -32172,
+			Message: "transactions opened with autocommit off are still open",
+			Data:    map[string]any{"transactions": ids},
+		}
+	}
+	t.manual = !on
+	return nil
+}
+
+func (t *txSessions) mode() txModeResult {
+	t.mu.Lock()
+	implicit := make(map[string]bool, len(t.implicit))
+	for _, id := range t.implicit {
+		implicit[id] = true
+	}
+	open := make([]*txSession, 0, len(t.open))
+	for _, s := range t.open {
+		open = append(open, s)
+	}
+	result := txModeResult{Autocommit: !t.manual, Transactions: []txOpenInfo{}}
+	t.mu.Unlock()
+
+	for _, s := range open {
+		s.mu.Lock()
+		savepoints := s.stack()
+		s.mu.Unlock()
+		result.Transactions = append(result.Transactions, txOpenInfo{
+			TxID:       s.id,
+			Driver:     s.driver,
+			Target:     s.target,
+			StartedAt:  s.startedAt,
+			Implicit:   implicit[s.id],
+			Savepoints: savepoints,
+		})
+	}
+	sort.Slice(result.Transactions, func(a, b int) bool {
+		return result.Transactions[a].StartedAt.Before(result.Transactions[b].StartedAt)
+	})
+	return result
+}
+
+// executeImplicit runs a query.execute statement while autocommit is off, in the
+// transaction open on its connection, beginning one on the first statement. The
+// transaction is ended with tx.commit or tx.rollback like one from tx.begin.
+func (t *txSessions) executeImplicit(ctx context.Context, payload executeParams) (executeResult, *rpc.Error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Duration(payload.Options.TimeoutSeconds)*time.Second)
+	defer cancel()
+	session, rpcErr := t.implicitFor(timeoutCtx, dbConnectionParams{Driver: payload.Connection.Driver, DSN: payload.Connection.DSN})
+	if rpcErr != nil {
+		return executeResult{}, rpcErr
+	}
+
+	t.record(t.journal.Statement(session.id, payload.SQL, time.Now().UTC()))
+	result, err := session.query(timeoutCtx, payload.SQL, payload.Options.MaxRows, payload.Args...)
+	if err != nil {
+		return executeResult{}, &rpc.Error{
+			Code:    -32011,
+			Message: "query execution failed",
+			Data:    map[string]any{"error": err.Error(), "transaction": t.status(session.id)},
+		}
+	}
+	result.Transaction = t.status(session.id)
+	return result, nil
+}
+
+// implicitFor returns the implicit transaction open on conn, beginning one if there is
+// none.
+func (t *txSessions) implicitFor(ctx context.Context, conn dbConnectionParams) (*txSession, *rpc.Error) {
+	t.beginMu.Lock()
+	defer t.beginMu.Unlock()
+	key := conn.Driver + "\x00" + conn.DSN
+	t.mu.Lock()
+	id, ok := t.implicit[key]
+	t.mu.Unlock()
+	if ok {
+		return t.get(id)
+	}
+
+	session, rpcErr := beginTx(ctx, conn)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	t.add(session)
+	t.mu.Lock()
+	t.implicit[key] = session.id
+	t.mu.Unlock()
+	return session, nil
+}
+
+// txModeHandler reports whether the client is in autocommit mode and which
+// transactions it has open.
+func txModeHandler(journal *txjournal.Journal) rpc.HandlerFunc {
+	return func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		sessions, ok := txSessionsOf(ctx, journal)
+		if !ok {
+			return txModeResult{Autocommit: true, Transactions: []txOpenInfo{}}, nil
+		}
+		return sessions.mode(), nil
+	}
+}
+
+// txSetAutocommitHandler turns autocommit on or off for the client. With autocommit
+// off, query.execute runs each connection's statements in one transaction until the
+// client commits or rolls it back.
+func txSetAutocommitHandler(journal *txjournal.Journal) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload txSetAutocommitParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Autocommit == nil {
+			return nil, &rpc.Error{Code: -32602, Message: "autocommit is required"}
+		}
+		sessions, ok := txSessionsOf(ctx, journal)
+		if !ok {
+			return nil, &rpc.Error{Code: -32603, Message: "tx.setAutocommit requires a client session"}
+		}
+		if rpcErr := sessions.setAutocommit(*payload.Autocommit); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return sessions.mode(), nil
+	}
+}
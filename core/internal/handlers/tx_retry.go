@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultTxMaxAttempts = 3
+	defaultTxBackoffMs   = 50
+	// maxTxBackoff bounds the wait between attempts however many are allowed.
+	maxTxBackoff = 5 * time.Second
+)
+
+// txRetry is how a transaction the database aborted to resolve a deadlock or a
+// serialization conflict is retried. The database rolls such a transaction back whole,
+// so every statement is replayed from the start.
+type txRetry struct {
+	// MaxAttempts caps how often the transaction runs, the first attempt included. One
+	// disables retrying; the default is 3.
+	MaxAttempts int `json:"maxAttempts"`
+	// BackoffMs is the wait before the first retry, doubled before each further one and
+	// jittered so that the conflicting transactions do not collide again. The default is
+	// 50.
+	BackoffMs int `json:"backoffMs"`
+}
+
+// txRetryAttempt describes an attempt that was aborted and retried.
+type txRetryAttempt struct {
+	Attempt int `json:"attempt"`
+	// Code is the SQLSTATE, or the MySQL error number.
+	Code      string  `json:"code"`
+	Message   string  `json:"message"`
+	BackoffMs float64 `json:"backoffMs"`
+}
+
+// retryTransaction calls attempt until it succeeds, fails for a reason other than a
+// deadlock or serialization failure, or runs out of attempts. attempt returns the driver
+// error behind a failure, which decides whether it is retried.
+func retryTransaction(
+	ctx context.Context,
+	retry txRetry,
+	attempt func() ([]int64, *rpc.Error, error),
+) ([]int64, []txRetryAttempt, *rpc.Error) {
+	if retry.MaxAttempts <= 0 {
+		retry.MaxAttempts = defaultTxMaxAttempts
+	}
+	if retry.BackoffMs <= 0 {
+		retry.BackoffMs = defaultTxBackoffMs
+	}
+	var retries []txRetryAttempt
+	backoff := time.Duration(retry.BackoffMs) * time.Millisecond
+	for n := 1; ; n++ {
+		affected, rpcErr, cause := attempt()
+		if rpcErr == nil {
+			return affected, retries, nil
+		}
+		code, retryable := transientTxError(cause)
+		if !retryable || n >= retry.MaxAttempts {
+			if len(retries) > 0 {
+				rpcErr.Data = map[string]any{"error": rpcErr.Data, "retries": retries}
+			}
+			return nil, retries, rpcErr
+		}
+
+		// Wait between half and all of the backoff.
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		retries = append(retries, txRetryAttempt{
+			Attempt:   n,
+			Code:      code,
+			Message:   cause.Error(),
+			BackoffMs: wait.Seconds() * 1000,
+		})
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			rpcErr.Data = map[string]any{"error": rpcErr.Data, "retries": retries}
+			return nil, retries, rpcErr
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxTxBackoff)
+	}
+}
+
+// transientTxError reports whether err aborted its transaction to resolve a conflict
+// with another one, so that running the transaction again may succeed: a Postgres
+// serialization failure (40001) or deadlock (40P01), or a MySQL deadlock (1213).
+func transientTxError(err error) (code string, ok bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code, pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return strconv.Itoa(int(myErr.Number)), myErr.Number == 1213
+	}
+	return "", false
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRetryTransactionReplaysDeadlocks(t *testing.T) {
+	failures := []error{
+		&pgconn.PgError{Code: "40P01", Message: "deadlock detected"},
+		fmt.Errorf("commit: %w", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}),
+	}
+	calls := 0
+	affected, retries, rpcErr := retryTransaction(context.Background(), txRetry{BackoffMs: 1}, func() ([]int64, *rpc.Error, error) {
+		calls++
+		if calls <= len(failures) {
+			err := failures[calls-1]
+			return nil, &rpc.Error{Code: -32011, Data: err.Error()}, err
+		}
+		return []int64{1}, nil, nil
+	})
+	if rpcErr != nil || len(affected) != 1 || calls != 3 {
+		t.Fatalf("expected the third attempt to commit, got %v %+v after %d calls", affected, rpcErr, calls)
+	}
+	if len(retries) != 2 || retries[0].Code != "40P01" || retries[1].Code != "1213" || retries[1].Attempt != 2 {
+		t.Fatalf("unexpected retries %+v", retries)
+	}
+}
+
+func TestRetryTransactionGivesUp(t *testing.T) {
+	serialization := &pgconn.PgError{Code: "40001", Message: "could not serialize access"}
+	calls := 0
+	_, retries, rpcErr := retryTransaction(context.Background(), txRetry{MaxAttempts: 2, BackoffMs: 1}, func() ([]int64, *rpc.Error, error) {
+		calls++
+		return nil, &rpc.Error{Code: -32011, Data: serialization.Error()}, serialization
+	})
+	if rpcErr == nil || calls != 2 || len(retries) != 1 {
+		t.Fatalf("expected two attempts and one retry, got %+v after %d calls with %+v", rpcErr, calls, retries)
+	}
+	if data, ok := rpcErr.Data.(map[string]any); !ok || data["retries"] == nil {
+		t.Fatalf("expected the retries in the error, got %#v", rpcErr.Data)
+	}
+
+	// Other failures, and refusals without a driver error, are not retried.
+	for _, cause := range []error{&pgconn.PgError{Code: "23505"}, errors.New("connection refused"), nil} {
+		calls = 0
+		_, retries, _ = retryTransaction(context.Background(), txRetry{BackoffMs: 1}, func() ([]int64, *rpc.Error, error) {
+			calls++
+			return nil, &rpc.Error{Code: -32011}, cause
+		})
+		if calls != 1 || len(retries) != 0 {
+			t.Fatalf("%v: expected a single attempt, got %d", cause, calls)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/tablequery"
+	"github.com/fluxgrid/core/internal/txjournal"
+)
+
+// Savepoint operations, named after the methods.
+const (
+	savepointCreate     = "savepoint"
+	savepointRollbackTo = "rollbackTo"
+	savepointRelease    = "release"
+)
+
+type txSavepointParams struct {
+	TxID string `json:"txId" jsonschema:"required"`
+	// Name is the savepoint. tx.savepoint names it sp_<depth> when it is left out.
+	Name string `json:"name"`
+}
+
+type txSavepointResult struct {
+	TxID string `json:"txId"`
+	// Savepoints is the stack after the operation, outermost first.
+	Savepoints []string `json:"savepoints"`
+}
+
+// savepoint creates, rolls back to or releases a savepoint, keeping the session's stack
+// in step: rolling back to a savepoint discards the ones set after it, and releasing one
+// releases those too. Savepoints not on the stack are refused before reaching the server,
+// whose error would abort a Postgres transaction.
+func (s *txSession) savepoint(ctx context.Context, op, name string) ([]string, *rpc.Error) {
+	dialect, err := tablequery.ParseDialect(s.driver)
+	if err != nil {
+		return nil, &rpc.Error{Code: -32601, Message: err.Error()}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	depth := slices.Index(s.savepoints, name)
+	var statement string
+	switch op {
+	case savepointCreate:
+		if name == "" {
+			name = "sp_" + strconv.Itoa(len(s.savepoints)+1)
+			depth = slices.Index(s.savepoints, name)
+		}
+		if depth >= 0 {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: fmt.Sprintf("savepoint %s already exists", name),
+				Data:    map[string]any{"savepoint": name, "savepoints": s.stack()},
+			}
+		}
+		statement = "SAVEPOINT " + dialect.Quote(name)
+	case savepointRollbackTo, savepointRelease:
+		if depth < 0 {
+			return nil, &rpc.Error{
+				Code:    -32171,
+				Message: fmt.Sprintf("unknown savepoint: %s", name),
+				Data:    map[string]any{"savepoint": name, "savepoints": s.stack()},
+			}
+		}
+		if op == savepointRollbackTo {
+			statement = "ROLLBACK TO SAVEPOINT " + dialect.Quote(name)
+		} else {
+			statement = "RELEASE SAVEPOINT " + dialect.Quote(name)
+		}
+	}
+
+	if err := s.execLocked(ctx, statement); err != nil {
+		return nil, &rpc.Error{Code: -32011, Message: "query execution failed", Data: err.Error()}
+	}
+	switch op {
+	case savepointCreate:
+		s.savepoints = append(s.savepoints, name)
+	case savepointRollbackTo:
+		s.savepoints = s.savepoints[:depth+1]
+	case savepointRelease:
+		s.savepoints = s.savepoints[:depth]
+	}
+	return s.stack(), nil
+}
+
+// stack returns a copy of the savepoint stack.
+func (s *txSession) stack() []string {
+	return append([]string{}, s.savepoints...)
+}
+
+// execLocked runs a statement without a result; s.mu must be held.
+func (s *txSession) execLocked(ctx context.Context, statement string) error {
+	if s.pgTx != nil {
+		_, err := s.pgTx.Exec(ctx, tagSQL(ctx, statement))
+		return err
+	}
+	_, err := s.sqlTx.ExecContext(ctx, tagSQL(ctx, statement))
+	return err
+}
+
+// txSavepointHandler serves tx.savepoint, tx.rollbackTo and tx.release.
+func txSavepointHandler(journal *txjournal.Journal, op string) rpc.HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (any, *rpc.Error) {
+		var payload txSavepointParams
+		if err := json.Unmarshal(params, &payload); err != nil {
+			return nil, &rpc.Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+		if payload.Name == "" && op != savepointCreate {
+			return nil, &rpc.Error{Code: -32602, Message: "name is required"}
+		}
+		sessions, ok := txSessionsOf(ctx, journal)
+		if !ok {
+			return nil, &rpc.Error{Code: -32170, Message: fmt.Sprintf("unknown transaction: %s", payload.TxID)}
+		}
+		session, rpcErr := sessions.get(payload.TxID)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		stack, rpcErr := session.savepoint(ctx, op, payload.Name)
+		if rpcErr != nil {
+			return nil, rpcErr
+		}
+		return txSavepointResult{TxID: session.id, Savepoints: stack}, nil
+	}
+}
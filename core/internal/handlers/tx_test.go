@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/txjournal"
+	"github.com/rs/zerolog"
+)
+
+func txServer(journal *txjournal.Journal) *rpc.Server {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("tx.begin", txBeginHandler(journal))
+	server.Register("tx.execute", txExecuteHandler(journal, nil))
+	server.Register("tx.commit", txFinishHandler(journal, true))
+	server.Register("tx.rollback", txFinishHandler(journal, false))
+	server.Register("tx.recover", txRecoverHandler(journal))
+	server.Register("tx.savepoint", txSavepointHandler(journal, savepointCreate))
+	server.Register("tx.rollbackTo", txSavepointHandler(journal, savepointRollbackTo))
+	server.Register("tx.release", txSavepointHandler(journal, savepointRelease))
+	server.Register("tx.mode", txModeHandler(journal))
+	server.Register("tx.setAutocommit", txSetAutocommitHandler(journal))
+	server.Register("query.execute", executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), journal, nil, nil, 0))
+	return server
+}
+
+func beginTxIn(t *testing.T, c call, dsn string) string {
+	t.Helper()
+	line := c("tx.begin", `{"connection":{"driver":"sqlite","dsn":"`+dsn+`"}}`)
+	var begun struct {
+		Result txBeginResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &begun); err != nil || !strings.HasPrefix(begun.Result.TxID, "tx_") {
+		t.Fatalf("expected a transaction, got %s", line)
+	}
+	return begun.Result.TxID
+}
+
+func countRows(t *testing.T, dsn string) any {
+	t.Helper()
+	var payload executeParams
+	payload.Connection.Driver, payload.Connection.DSN = "sqlite", dsn
+	payload.SQL = "SELECT count(*) FROM t"
+	payload.Options.TimeoutSeconds, payload.Options.MaxRows = 10, 1
+	raw, rpcErr := executeClassic(context.Background(), payload)
+	if rpcErr != nil {
+		t.Fatalf("count: %+v", rpcErr)
+	}
+	return raw.(executeResult).Rows[0][0]
+}
+
+func TestTransactionSessions(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+	dir := t.TempDir()
+	c := connectTo(t, txServer(txjournal.Open(dir)))
+
+	txID := beginTxIn(t, c, dsn)
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected the open transaction to be journaled, got %d files", len(files))
+	}
+	c("tx.execute", `{"txId":"`+txID+`","sql":"INSERT INTO t VALUES (1)"}`)
+	line := c("tx.execute", `{"txId":"`+txID+`","sql":"SELECT count(*) FROM t"}`)
+	if !strings.Contains(line, `"rows":[[1]]`) {
+		t.Fatalf("expected the transaction to see its own insert, got %s", line)
+	}
+	if line := c("tx.rollback", `{"txId":"`+txID+`"}`); !strings.Contains(line, `"committed":false`) {
+		t.Fatalf("unexpected rollback response %s", line)
+	}
+	if n := countRows(t, dsn); n != int64(0) {
+		t.Fatalf("expected the rollback to discard the insert, got %v rows", n)
+	}
+	if line := c("tx.execute", `{"txId":"`+txID+`","sql":"SELECT 1"}`); !strings.Contains(line, `"code":-32170`) {
+		t.Fatalf("expected a finished transaction to be unknown, got %s", line)
+	}
+
+	txID = beginTxIn(t, c, dsn)
+	c("tx.execute", `{"txId":"`+txID+`","sql":"INSERT INTO t VALUES (2)"}`)
+	if line := c("tx.commit", `{"txId":"`+txID+`"}`); !strings.Contains(line, `"committed":true`) {
+		t.Fatalf("unexpected commit response %s", line)
+	}
+	if n := countRows(t, dsn); n != int64(1) {
+		t.Fatalf("expected the commit to keep the insert, got %v rows", n)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the journal to be empty once transactions end, got %d files", len(files))
+	}
+	if line := c("tx.recover", `{}`); !strings.Contains(line, `"orphans":[]`) {
+		t.Fatalf("expected no orphans, got %s", line)
+	}
+}
+
+func TestTransactionSavepoints(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+	c := connectTo(t, txServer(nil))
+	txID := beginTxIn(t, c, dsn)
+	tx := `"txId":"` + txID + `"`
+
+	c("tx.execute", `{`+tx+`,"sql":"INSERT INTO t VALUES (1)"}`)
+	if line := c("tx.savepoint", `{`+tx+`}`); !strings.Contains(line, `"savepoints":["sp_1"]`) {
+		t.Fatalf("expected a default savepoint name, got %s", line)
+	}
+	c("tx.execute", `{`+tx+`,"sql":"INSERT INTO t VALUES (2)"}`)
+	c("tx.savepoint", `{`+tx+`,"name":"before three"}`)
+	c("tx.execute", `{`+tx+`,"sql":"INSERT INTO t VALUES (3)"}`)
+	if line := c("tx.savepoint", `{`+tx+`,"name":"sp_1"}`); !strings.Contains(line, `"code":-32602`) {
+		t.Fatalf("expected a duplicate savepoint to be refused, got %s", line)
+	}
+
+	line := c("tx.rollbackTo", `{`+tx+`,"name":"missing"}`)
+	if !strings.Contains(line, `"code":-32171`) || !strings.Contains(line, `"savepoints":["sp_1","before three"]`) {
+		t.Fatalf("expected an unknown savepoint error listing the stack, got %s", line)
+	}
+	if line := c("tx.rollbackTo", `{`+tx+`,"name":"sp_1"}`); !strings.Contains(line, `"savepoints":["sp_1"]`) {
+		t.Fatalf("expected later savepoints to be discarded, got %s", line)
+	}
+	if line := c("tx.execute", `{`+tx+`,"sql":"SELECT count(*) FROM t"}`); !strings.Contains(line, `"rows":[[1]]`) {
+		t.Fatalf("expected the rollback to undo the later inserts, got %s", line)
+	}
+	if line := c("tx.rollbackTo", `{`+tx+`,"name":"before three"}`); !strings.Contains(line, `"code":-32171`) {
+		t.Fatalf("expected a discarded savepoint to be unknown, got %s", line)
+	}
+	if line := c("tx.release", `{`+tx+`,"name":"sp_1"}`); !strings.Contains(line, `"savepoints":[]`) {
+		t.Fatalf("expected the release to empty the stack, got %s", line)
+	}
+	if line := c("tx.release", `{`+tx+`}`); !strings.Contains(line, `"code":-32602`) {
+		t.Fatalf("expected a name to be required, got %s", line)
+	}
+
+	c("tx.commit", `{`+tx+`}`)
+	if n := countRows(t, dsn); n != int64(1) {
+		t.Fatalf("expected one committed row, got %v", n)
+	}
+}
+
+func TestAutocommitOffKeepsStatementsInATransaction(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE t (id INTEGER PRIMARY KEY)")
+	c := connectTo(t, txServer(nil))
+	execute := func(statement string) string {
+		return c("query.execute", `{"connection":{"driver":"sqlite","dsn":"`+dsn+`"},"sql":"`+statement+`"}`)
+	}
+
+	if line := execute("INSERT INTO t VALUES (1)"); !strings.Contains(line, `"transaction":{"autocommit":true,"inTransaction":false}`) {
+		t.Fatalf("expected an autocommitted statement, got %s", line)
+	}
+	if line := c("tx.setAutocommit", `{}`); !strings.Contains(line, `"code":-32602`) {
+		t.Fatalf("expected autocommit to be required, got %s", line)
+	}
+	if line := c("tx.setAutocommit", `{"autocommit":false}`); !strings.Contains(line, `"autocommit":false,"transactions":[]`) {
+		t.Fatalf("unexpected mode %s", line)
+	}
+
+	line := execute("INSERT INTO t VALUES (2)")
+	var inserted struct {
+		Result executeResult `json:"result"`
+	}
+	if err := json.Unmarshal([]byte(line), &inserted); err != nil || inserted.Result.Transaction == nil || !inserted.Result.Transaction.InTransaction {
+		t.Fatalf("expected the statement to run in a transaction, got %s", line)
+	}
+	txID := inserted.Result.Transaction.TxID
+	if line := execute("SELECT count(*) FROM t"); !strings.Contains(line, `"txId":"`+txID+`"`) || !strings.Contains(line, `"rows":[[2]]`) {
+		t.Fatalf("expected the next statement to join the transaction, got %s", line)
+	}
+	if n := countRows(t, dsn); n != int64(1) {
+		t.Fatalf("expected the insert to be uncommitted, got %v rows", n)
+	}
+	if line := c("tx.mode", `{}`); !strings.Contains(line, `"txId":"`+txID+`"`) || !strings.Contains(line, `"implicit":true`) {
+		t.Fatalf("expected the implicit transaction to be listed, got %s", line)
+	}
+	if line := c("query.execute", `{"connection":{"driver":"sqlite","dsn":"`+dsn+`"},"sql":"SELECT 1","options":{"cache":true}}`); !strings.Contains(line, `"code":-32602`) {
+		t.Fatalf("expected cache mode to be refused, got %s", line)
+	}
+	if line := c("tx.setAutocommit", `{"autocommit":true}`); !strings.Contains(line, `"code":-32172`) || !strings.Contains(line, txID) {
+		t.Fatalf("expected autocommit to wait for the open transaction, got %s", line)
+	}
+
+	c("tx.commit", `{"txId":"`+txID+`"}`)
+	if n := countRows(t, dsn); n != int64(2) {
+		t.Fatalf("expected the commit to keep the insert, got %v rows", n)
+	}
+	if line := c("tx.setAutocommit", `{"autocommit":true}`); !strings.Contains(line, `"autocommit":true,"transactions":[]`) {
+		t.Fatalf("unexpected mode %s", line)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/fluxgrid/core/internal/uuidfmt"
+)
+
+// uuidColumns renders the UUID cells of a database/sql result in the requested format.
+// Columns declared UUID, as SQLite and MariaDB allow, hold the text form or 16 bytes.
+// MySQL has no UUID type and stores them as BINARY(16). The driver does not report the
+// length, but BINARY is fixed width, so a BINARY column whose values are 16 bytes long is
+// a BINARY(16); its type is reported as UUID once one is seen.
+type uuidColumns struct {
+	format   string
+	columns  []column
+	declared []bool
+	binary   []bool
+}
+
+func newUUIDColumns(columns []column, format string) *uuidColumns {
+	u := &uuidColumns{
+		format:   format,
+		columns:  columns,
+		declared: make([]bool, len(columns)),
+		binary:   make([]bool, len(columns)),
+	}
+	for i, col := range columns {
+		switch strings.ToUpper(col.DataType) {
+		case "UUID":
+			u.declared[i] = true
+		case "BINARY":
+			u.binary[i] = true
+		}
+	}
+	return u
+}
+
+// cell returns the rendering of value when column i holds UUIDs and value is one.
+func (u *uuidColumns) cell(i int, value any) (string, bool) {
+	if !u.declared[i] && !u.binary[i] {
+		return "", false
+	}
+	var (
+		id [16]byte
+		ok bool
+	)
+	switch v := value.(type) {
+	case []byte:
+		if len(v) == len(id) {
+			id, ok = [16]byte(v), true
+		} else if u.declared[i] {
+			id, ok = uuidfmt.Parse(string(v))
+		}
+	case string:
+		if u.declared[i] {
+			id, ok = uuidfmt.Parse(v)
+		}
+	}
+	if !ok {
+		return "", false
+	}
+	if u.binary[i] {
+		u.columns[i].DataType = "UUID"
+	}
+	return uuidfmt.Format(id, u.format), true
+}
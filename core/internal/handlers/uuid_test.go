@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/rowbuf"
+	"github.com/fluxgrid/core/internal/uuidfmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var sampleUUID = [16]byte{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4, 0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00}
+
+func TestStreamRowsFormatUUIDs(t *testing.T) {
+	fields := []pgconn.FieldDescription{{Name: "id", DataTypeOID: pgtype.UUIDOID, Format: pgx.BinaryFormatCode}}
+	raw := [][]byte{sampleUUID[:]}
+	for format, want := range map[string]string{
+		"":            `["550e8400-e29b-41d4-a716-446655440000"]`,
+		uuidfmt.Upper: `["550E8400-E29B-41D4-A716-446655440000"]`,
+		uuidfmt.Bytes: `["\\x550e8400e29b41d4a716446655440000"]`,
+	} {
+		encoded, err := rowbuf.NewRowJSON(pgtype.NewMap(), fields, normalizerFor("", format)).AppendRow(nil, raw)
+		if err != nil {
+			t.Fatalf("%q: %v", format, err)
+		}
+		if string(encoded) != want {
+			t.Errorf("%q: got %s, want %s", format, encoded, want)
+		}
+	}
+}
+
+func TestExecuteClassicFormatsUUIDs(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE t (id UUID, raw BINARY, other BLOB)",
+		"INSERT INTO t VALUES ('550E8400-E29B-41D4-A716-446655440000', x'550e8400e29b41d4a716446655440000', x'550e8400e29b41d4a716446655440000')",
+	)
+	run := func(format string) executeResult {
+		var payload executeParams
+		payload.Connection.Driver, payload.Connection.DSN = "sqlite", dsn
+		payload.SQL = "SELECT id, raw, other FROM t"
+		payload.Options.TimeoutSeconds, payload.Options.MaxRows, payload.Options.UUIDFormat = 10, 10, format
+		raw, rpcErr := executeClassic(context.Background(), payload)
+		if rpcErr != nil {
+			t.Fatalf("%q: %+v", format, rpcErr)
+		}
+		return raw.(executeResult)
+	}
+
+	result := run("")
+	row := result.Rows[0]
+	if row[0] != "550e8400-e29b-41d4-a716-446655440000" || row[1] != "550e8400-e29b-41d4-a716-446655440000" {
+		t.Fatalf("unexpected row %#v", row)
+	}
+	if row[2] == row[1] {
+		t.Errorf("plain blob was read as a UUID: %#v", row[2])
+	}
+	if result.Columns[1].DataType != "UUID" {
+		t.Errorf("BINARY(16) column reported as %s", result.Columns[1].DataType)
+	}
+
+	row = run(uuidfmt.Upper).Rows[0]
+	if row[0] != "550E8400-E29B-41D4-A716-446655440000" || row[1] != row[0] {
+		t.Fatalf("unexpected upper row %#v", row)
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/rewrite"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// templateVariablesError is the data of the error for a statement with template
+// variables that neither the request nor the connection has a value for.
+type templateVariablesError struct {
+	Unresolved []string `json:"unresolved"`
+}
+
+// variableDefaults keeps the default values of the template variables of connection
+// profiles, keyed by driver and DSN.
+type variableDefaults struct {
+	mu     sync.Mutex
+	values map[string]map[string]any
+}
+
+var templateVariables = newVariableDefaults()
+
+func newVariableDefaults() *variableDefaults {
+	return &variableDefaults{values: make(map[string]map[string]any)}
+}
+
+// configure sets the defaults of conn. No values removes them.
+func (d *variableDefaults) configure(conn dbConnectionParams, values map[string]any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := replicaKey(conn.Driver, conn.DSN)
+	if len(values) == 0 {
+		delete(d.values, key)
+		return
+	}
+	d.values[key] = maps.Clone(values)
+}
+
+// resolve returns the defaults of conn overridden by values.
+func (d *variableDefaults) resolve(conn dbConnectionParams, values map[string]any) map[string]any {
+	d.mu.Lock()
+	resolved := maps.Clone(d.values[replicaKey(conn.Driver, conn.DSN)])
+	d.mu.Unlock()
+	if resolved == nil {
+		resolved = make(map[string]any, len(values))
+	}
+	maps.Copy(resolved, values)
+	return resolved
+}
+
+// checkTemplateValues refuses values that cannot be bound as a parameter: template
+// variables hold strings, numbers, booleans or null.
+func checkTemplateValues(values map[string]any) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch values[name].(type) {
+		case nil, string, float64, bool:
+		default:
+			return fmt.Errorf("template variable %s must be a string, number, boolean or null", name)
+		}
+	}
+	return nil
+}
+
+// bindTemplateVariables replaces the {{name}} variables of the statement with bind
+// parameters, taking their values from the request and then from the defaults of the
+// connection. Whole numbers are bound as integers, so that they compare with integer
+// columns.
+func bindTemplateVariables(payload *executeParams) *rpc.Error {
+	if err := checkTemplateValues(payload.Variables); err != nil {
+		return &rpc.Error{
+			Code:    -32602,
+			Message: "invalid parameters",
+			Data:    err.Error(),
+		}
+	}
+	if len(rewrite.Variables(payload.SQL)) == 0 {
+		return nil
+	}
+	conn := dbConnectionParams{Driver: payload.Connection.Driver, DSN: payload.Connection.DSN}
+	values := templateVariables.resolve(conn, payload.Variables)
+	for name, value := range values {
+		if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			values[name] = int64(f)
+		}
+	}
+	sql, args, missing := rewrite.BindVariables(payload.Connection.Driver, payload.SQL, len(payload.Args), values)
+	if len(missing) > 0 {
+		return &rpc.Error{
+			Code:    -32014,
+			Message: "unresolved template variables",
+			Data:    templateVariablesError{Unresolved: missing},
+		}
+	}
+	payload.SQL = sql
+	payload.Args = append(payload.Args, args...)
+	return nil
+}
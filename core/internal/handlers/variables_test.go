@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+func TestTemplateVariablesBindConnectionDefaults(t *testing.T) {
+	dsn := searchDB(t,
+		"CREATE TABLE orders (id INTEGER, tenant_id INTEGER, status TEXT)",
+		"INSERT INTO orders VALUES (1, 7, 'open'), (2, 7, 'closed'), (3, 8, 'open')",
+	)
+	conn := dbConnectionParams{Driver: "sqlite", DSN: dsn}
+	templateVariables.configure(conn, map[string]any{"tenant_id": float64(7), "status": "open"})
+	defer templateVariables.configure(conn, nil)
+
+	execute := executeHandler(rpc.NewServer(zerolog.Nop()), resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, newWorkspaces("", nil), 0)
+	run := func(variables map[string]any, sql string) (any, *rpc.Error) {
+		params, _ := json.Marshal(map[string]any{
+			"connection": map[string]any{"driver": "sqlite", "dsn": dsn},
+			"sql":        sql,
+			"variables":  variables,
+		})
+		return execute(context.Background(), params)
+	}
+
+	const sql = "SELECT id FROM orders WHERE tenant_id = {{tenant_id}} AND status = {{ status }} ORDER BY id"
+	result, rpcErr := run(nil, sql)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if rows := result.(executeResult).Rows; !reflect.DeepEqual(rows, [][]any{{int64(1)}}) {
+		t.Fatalf("rows = %v", rows)
+	}
+	// Request values override the connection's defaults.
+	result, rpcErr = run(map[string]any{"status": "closed"}, sql)
+	if rpcErr != nil {
+		t.Fatal(rpcErr)
+	}
+	if rows := result.(executeResult).Rows; !reflect.DeepEqual(rows, [][]any{{int64(2)}}) {
+		t.Fatalf("rows = %v", rows)
+	}
+
+	_, rpcErr = run(nil, "SELECT id FROM orders WHERE id = {{order_id}}")
+	if rpcErr == nil || rpcErr.Code != -32014 || !reflect.DeepEqual(rpcErr.Data, templateVariablesError{Unresolved: []string{"order_id"}}) {
+		t.Fatalf("error = %+v", rpcErr)
+	}
+	if _, rpcErr = run(map[string]any{"status": []any{"open"}}, sql); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("error = %+v", rpcErr)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/history"
+	"github.com/fluxgrid/core/internal/logging"
+)
+
+// validWorkspace bounds workspace ids to names that are safe as directory names.
+var validWorkspace = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// workspaces keeps the state of each workspace a client names in core.initialize apart,
+// so that projects opened in different editor windows do not see each other's history
+// or connection aliases. Clients that name no workspace share the default one, whose
+// state lives directly in the state directory; named workspaces live under
+// <state-dir>/workspaces/<id>.
+//
+// Aliases from the core's configuration are visible in every workspace. A workspace's
+// own aliases, imported with state.import, are added to them and win on a name clash.
+//
+// Every tenant has a workspace of its own under <state-dir>/tenants/<name>, in which only
+// the aliases the tenant is given are visible.
+type workspaces struct {
+	stateDir string
+	global   map[string]ConnectionAlias
+	tenants  map[string]Tenant
+	// planBytes bounds the plans captured into each workspace's history; zero captures
+	// none.
+	planBytes int64
+
+	mu     sync.Mutex
+	spaces map[string]*workspace
+}
+
+type workspace struct {
+	runs *history.Store
+	// aliases is nil until the workspace's aliases are first needed.
+	aliases map[string]ConnectionAlias
+}
+
+func newWorkspaces(stateDir string, aliases map[string]ConnectionAlias) *workspaces {
+	return &workspaces{stateDir: stateDir, global: aliases, spaces: make(map[string]*workspace)}
+}
+
+// dir returns the state directory of workspace id, or "" when persistence is off.
+func (w *workspaces) dir(id string) string {
+	if w.stateDir == "" || id == "" {
+		return w.stateDir
+	}
+	if tenant, ok := strings.CutPrefix(id, tenantWorkspacePrefix); ok {
+		return filepath.Join(w.stateDir, "tenants", tenant)
+	}
+	return filepath.Join(w.stateDir, "workspaces", id)
+}
+
+func (w *workspaces) get(id string) *workspace {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	space, ok := w.spaces[id]
+	if !ok {
+		space = &workspace{runs: historyStore(w.dir(id), w.planBytes)}
+		w.spaces[id] = space
+	}
+	return space
+}
+
+// history returns the run history of the workspace of ctx. It returns nil for a nil
+// registry, which records nothing.
+func (w *workspaces) history(ctx context.Context) *history.Store {
+	if w == nil {
+		return nil
+	}
+	return w.get(clientSessionOf(ctx).workspaceID()).runs
+}
+
+// capturesPlans reports whether runs are recorded with their execution plans.
+func (w *workspaces) capturesPlans() bool {
+	return w != nil && w.planBytes > 0
+}
+
+// aliases returns the connection aliases visible in the workspace of ctx.
+func (w *workspaces) aliases(ctx context.Context) map[string]ConnectionAlias {
+	id := clientSessionOf(ctx).workspaceID()
+	if id == "" {
+		return w.global
+	}
+	space := w.get(id)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if space.aliases == nil {
+		space.aliases = w.loadAliases(id)
+	}
+	return space.aliases
+}
+
+// aliasesOnly reports whether ctx runs as a tenant without host access, which may only
+// connect through its aliases.
+func (w *workspaces) aliasesOnly(ctx context.Context) bool {
+	name := tenantOf(ctx)
+	return name != "" && !w.tenants[name].HostAccess
+}
+
+// loadAliases merges the aliases imported into workspace id over the configured ones, or
+// over a tenant's. A file that does not load leaves the workspace with those.
+func (w *workspaces) loadAliases(id string) map[string]ConnectionAlias {
+	base := w.global
+	if tenant, ok := strings.CutPrefix(id, tenantWorkspacePrefix); ok {
+		base = tenantAliases(w.tenants[tenant], w.global)
+	}
+	merged := make(map[string]ConnectionAlias, len(base))
+	for name, alias := range base {
+		merged[name] = alias
+	}
+	if w.stateDir == "" {
+		return merged
+	}
+	path := filepath.Join(w.dir(id), "config", ImportedAliasesFile)
+	own, err := LoadConnectionAliases(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger := logging.Logger()
+			logger.Warn().Err(err).Str("workspace", id).Msg("failed to load workspace connection aliases")
+		}
+		return merged
+	}
+	for name, alias := range own {
+		if alias.Restricted() && !dataMasks.configured() {
+			logger := logging.Logger()
+			logger.Warn().Str("workspace", id).Str("alias", name).Msg("skipping restricted alias without a masking policy")
+			continue
+		}
+		activateConnectionAlias(alias)
+		merged[name] = alias
+	}
+	return merged
+}
+
+// reloadAliases drops the cached aliases of workspace id, so that the next request reads
+// the ones just imported.
+func (w *workspaces) reloadAliases(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if space, ok := w.spaces[id]; ok {
+		space.aliases = nil
+	}
+}
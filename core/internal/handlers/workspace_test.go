@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/pressure"
+	"github.com/fluxgrid/core/internal/resultset"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/fluxgrid/core/internal/rpc/rpctest"
+	"github.com/rs/zerolog"
+)
+
+func TestWorkspacesKeepHistoryAndAliasesApart(t *testing.T) {
+	dsn := searchDB(t, "CREATE TABLE t (id INTEGER)", "INSERT INTO t VALUES (1)")
+	stateDir := t.TempDir()
+	spaces := newWorkspaces(stateDir, nil)
+	server := rpctest.NewSerialServer(zerolog.Nop())
+	server.Use(connectionHandleResolution(false, spaces))
+	server.Register("core.initialize", initializeHandler)
+	server.Register("query.execute", executeHandler(server, resultset.NewCache(4, 0), nil, pressure.New(pressure.Limits{}, nil), nil, nil, spaces, 0))
+	server.Register("connection.aliases", connectionAliasesHandler(spaces))
+	server.Register("history.list", historyListHandler(spaces))
+	server.Register("state.import", stateImportHandler(Config{StateDir: stateDir}, spaces, nil))
+
+	type response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpc.Error      `json:"error"`
+	}
+	session := func(workspace string, requests ...string) []response {
+		t.Helper()
+		lines := []string{fmt.Sprintf(`{"jsonrpc":"2.0","id":0,"method":"core.initialize","params":{"protocolVersion":"1.0","workspace":%q}}`, workspace)}
+		for i, request := range requests {
+			lines = append(lines, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,%s}`, i+1, request))
+		}
+		var out bytes.Buffer
+		if err := server.Serve(strings.NewReader(strings.Join(lines, "\n")), &out); err != nil {
+			t.Fatal(err)
+		}
+		var responses []response
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var decoded response
+			if err := json.Unmarshal([]byte(line), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			responses = append(responses, decoded)
+		}
+		return responses
+	}
+
+	bundle := fmt.Sprintf(`{"format":"fluxgrid-state","version":1,"connections":{"local":{"driver":"sqlite","dsn":%q}}}`, dsn)
+	first := session("alpha",
+		`"method":"state.import","params":{"bundle":`+bundle+`}`,
+		`"method":"query.execute","params":{"connection":{"alias":"local"},"sql":"SELECT id FROM t"}`,
+		`"method":"connection.aliases"`,
+		`"method":"history.list"`,
+	)
+	for _, r := range first {
+		if r.Error != nil {
+			t.Fatalf("alpha: %+v", r.Error)
+		}
+	}
+	if !strings.Contains(string(first[1].Result), `"restartRequired":false`) {
+		t.Fatalf("import = %s", first[1].Result)
+	}
+	if !strings.Contains(string(first[3].Result), `"local"`) || !strings.Contains(string(first[4].Result), "SELECT id FROM t") {
+		t.Fatalf("aliases = %s, history = %s", first[3].Result, first[4].Result)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "workspaces", "alpha", "config", ImportedAliasesFile)); err != nil {
+		t.Fatal(err)
+	}
+
+	second := session("beta",
+		`"method":"connection.aliases"`,
+		`"method":"history.list"`,
+		`"method":"query.execute","params":{"connection":{"alias":"local"},"sql":"SELECT id FROM t"}`,
+	)
+	if string(second[1].Result) != `{"aliases":[]}` || string(second[2].Result) != `{"entries":[]}` {
+		t.Fatalf("beta sees alpha's state: %s, %s", second[1].Result, second[2].Result)
+	}
+	if second[3].Error == nil {
+		t.Fatal("expected alpha's alias to be unknown in beta")
+	}
+
+	if invalid := session("../alpha"); invalid[0].Error == nil || invalid[0].Error.Code != -32602 {
+		t.Fatalf("expected the workspace to be refused, got %+v", invalid[0])
+	}
+}
@@ -0,0 +1,427 @@
+// Package history remembers the queries a core process ran, and keeps pinned runs with a
+// snapshot of their result so that a later data state can be compared against them.
+//
+// Recent runs are appended to runs.jsonl in the history directory, which is trimmed to
+// the most recent runs as it grows. Pinning a run writes its result, gzip-compressed, next
+// to a small metadata file, so pins survive restarts and can be listed without
+// decompressing them. Each pin has its own files, so several cores can share a state
+// directory. Execution plans captured for runs are kept under plans/, one file each,
+// within a total size.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// maxSQLLen bounds the statement text kept for each run.
+const maxSQLLen = 64 << 10
+
+// runsFile is the log of recent runs in the history directory.
+const runsFile = "runs.jsonl"
+
+var (
+	// ErrNotFound is returned for runs that are neither recent nor pinned.
+	ErrNotFound = errors.New("history entry not found")
+	// ErrNotPinned is returned when asking for the snapshot of a run that has none.
+	ErrNotPinned = errors.New("history entry has no snapshot")
+	// ErrNoStorage is returned when pinning without a snapshot directory.
+	ErrNoStorage = errors.New("snapshots need a state directory")
+)
+
+// Entry describes a query run.
+type Entry struct {
+	ID     string `json:"id"`
+	SQL    string `json:"sql"`
+	Driver string `json:"driver"`
+	// Target names the server and database without credentials.
+	Target          string    `json:"target"`
+	RanAt           time.Time `json:"ranAt"`
+	RowCount        int       `json:"rowCount"`
+	ExecutionTimeMs float64   `json:"executionTimeMs"`
+	// ResultID is the cached result of the run, while the cache holds it.
+	ResultID string `json:"resultId,omitempty"`
+	// PinnedAt is set when the run has a snapshot.
+	PinnedAt *time.Time `json:"pinnedAt,omitempty"`
+	// Label is an optional name given when pinning.
+	Label string `json:"label,omitempty"`
+	// SnapshotRows and SnapshotBytes describe the snapshot; bytes are compressed.
+	SnapshotRows  int   `json:"snapshotRows,omitempty"`
+	SnapshotBytes int64 `json:"snapshotBytes,omitempty"`
+	// Tables lists the tables the statement names.
+	Tables []string `json:"tables,omitempty"`
+	// Error is the message of a run that failed.
+	Error string `json:"error,omitempty"`
+	// PlanHash is the Hash of the plan captured for the run, if any.
+	PlanHash string `json:"planHash,omitempty"`
+	// Fingerprint is shared by the runs of the statement with other literals, spacing or
+	// comments.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// Snapshot is the result a pinned run returned.
+type Snapshot struct {
+	Entry   Entry              `json:"entry"`
+	Columns []resultset.Column `json:"columns"`
+	Rows    [][]any            `json:"rows"`
+}
+
+// Store holds recent runs and pinned snapshots.
+type Store struct {
+	dir    string
+	recent int
+
+	mu   sync.Mutex
+	runs []Entry
+	// logged counts the lines of the runs log, to trim it once it holds twice the recent
+	// runs.
+	logged int
+	// planBytes bounds the plans kept, in plans when dir is empty and under dir
+	// otherwise.
+	planBytes int64
+	plans     []memoryPlan
+}
+
+// New returns a store keeping the last recent runs and the snapshots in dir, loading the
+// runs recorded there before. An empty dir keeps recent runs in memory only.
+func New(dir string, recent int) *Store {
+	s := &Store{dir: dir, recent: recent}
+	s.runs, s.logged = s.readRuns()
+	return s
+}
+
+// Record adds a run and returns it with its id. Failing to log the run to disk only
+// loses it on restart, so it is not reported.
+func (s *Store) Record(e Entry) Entry {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	e.ID = "h_" + hex.EncodeToString(id[:])
+	if len(e.SQL) > maxSQLLen {
+		e.SQL = strings.ToValidUTF8(e.SQL[:maxSQLLen], "")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.runs = append(s.runs, e)
+	if over := len(s.runs) - s.recent; over > 0 {
+		s.runs = append(s.runs[:0:0], s.runs[over:]...)
+	}
+	s.logRun(e)
+	return e
+}
+
+// Runs returns the recent runs, oldest first.
+func (s *Store) Runs() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.runs...)
+}
+
+func (s *Store) logRun(e Entry) {
+	if s.dir == "" {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, runsFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(data, '\n'))
+	f.Close()
+	if err != nil {
+		return
+	}
+	if s.logged++; s.logged >= 2*s.recent {
+		s.trimRuns()
+	}
+}
+
+// trimRuns rewrites the runs log with its last recent lines. It reads the file rather
+// than using the runs in memory, so that it keeps the runs of other cores sharing it.
+func (s *Store) trimRuns() {
+	path := filepath.Join(s.dir, runsFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	lines := bytes.SplitAfter(bytes.TrimRight(data, "\n"), []byte("\n"))
+	if len(lines) > s.recent {
+		lines = lines[len(lines)-s.recent:]
+	}
+	kept := bytes.Join(lines, nil)
+	if len(kept) > 0 {
+		kept = append(bytes.TrimRight(kept, "\n"), '\n')
+	}
+	if writeFile(path, kept) == nil {
+		s.logged = len(lines)
+	}
+}
+
+// readRuns loads the last recent runs of the runs log, skipping lines that do not parse,
+// such as one cut short by a crash.
+func (s *Store) readRuns() ([]Entry, int) {
+	if s.dir == "" {
+		return nil, 0
+	}
+	f, err := os.Open(filepath.Join(s.dir, runsFile))
+	if err != nil {
+		return nil, 0
+	}
+	defer f.Close()
+	var (
+		runs  []Entry
+		lines int
+	)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 2*maxSQLLen+(64<<10))
+	for scanner.Scan() {
+		lines++
+		var e Entry
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || !validID(e.ID) {
+			continue
+		}
+		runs = append(runs, e)
+		if len(runs) > s.recent {
+			runs = runs[1:]
+		}
+	}
+	return runs, lines
+}
+
+// List returns recent and pinned runs, newest first, at most limit of them when limit is
+// positive.
+func (s *Store) List(limit int, pinnedOnly bool) ([]Entry, error) {
+	pinned, err := s.pinned()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Entry, len(pinned))
+	for _, e := range pinned {
+		byID[e.ID] = e
+	}
+	if !pinnedOnly {
+		s.mu.Lock()
+		for _, e := range s.runs {
+			if _, ok := byID[e.ID]; !ok {
+				byID[e.ID] = e
+			}
+		}
+		s.mu.Unlock()
+	}
+	entries := make([]Entry, 0, len(byID))
+	for _, e := range byID {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].RanAt.After(entries[j].RanAt) })
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// Get returns a run by id.
+func (s *Store) Get(id string) (Entry, error) {
+	if e, err := s.readEntry(id); err == nil {
+		return e, nil
+	} else if !errors.Is(err, ErrNotFound) {
+		return Entry{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.runs {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// Pin stores set as the snapshot of run id, replacing any earlier snapshot.
+func (s *Store) Pin(id, label string, set resultset.Set, now time.Time) (Entry, error) {
+	if s.dir == "" {
+		return Entry{}, ErrNoStorage
+	}
+	e, err := s.Get(id)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.PinnedAt = &now
+	e.Label = label
+	e.SnapshotRows = len(set.Rows)
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return Entry{}, err
+	}
+	size, err := writeSnapshot(s.path(id, ".json.gz"), Snapshot{Entry: e, Columns: set.Columns, Rows: set.Rows})
+	if err != nil {
+		return Entry{}, err
+	}
+	e.SnapshotBytes = size
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := writeFile(s.path(id, ".json"), data); err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Unpin deletes the snapshot of run id.
+func (s *Store) Unpin(id string) error {
+	if _, err := s.readEntry(id); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrNotPinned
+		}
+		return err
+	}
+	if err := os.Remove(s.path(id, ".json")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.path(id, ".json.gz")); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Snapshot reads the snapshot of run id.
+func (s *Store) Snapshot(id string) (Snapshot, error) {
+	if s.dir == "" || !validID(id) {
+		return Snapshot{}, ErrNotPinned
+	}
+	f, err := os.Open(s.path(id, ".json.gz"))
+	if errors.Is(err, os.ErrNotExist) {
+		if _, getErr := s.Get(id); getErr != nil {
+			return Snapshot{}, getErr
+		}
+		return Snapshot{}, ErrNotPinned
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("read snapshot %s: %w", id, err)
+	}
+	defer zr.Close()
+	var snap Snapshot
+	decoder := json.NewDecoder(zr)
+	decoder.UseNumber()
+	if err := decoder.Decode(&snap); err != nil {
+		return Snapshot{}, fmt.Errorf("read snapshot %s: %w", id, err)
+	}
+	return snap, nil
+}
+
+func (s *Store) pinned() ([]Entry, error) {
+	if s.dir == "" {
+		return nil, nil
+	}
+	files, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || !validID(id) {
+			continue
+		}
+		e, err := s.readEntry(id)
+		if err != nil {
+			// A pin removed by another core between listing and reading.
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (s *Store) readEntry(id string) (Entry, error) {
+	if s.dir == "" || !validID(id) {
+		return Entry{}, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(id, ".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Entry{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Entry{}, fmt.Errorf("read history entry %s: %w", id, err)
+	}
+	return e, nil
+}
+
+func (s *Store) path(id, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// validID keeps ids from naming files outside the snapshot directory.
+func validID(id string) bool {
+	rest, ok := strings.CutPrefix(id, "h_")
+	if !ok || rest == "" {
+		return false
+	}
+	_, err := hex.DecodeString(rest)
+	return err == nil
+}
+
+// writeSnapshot writes snap compressed and returns the compressed size.
+func writeSnapshot(path string, snap Snapshot) (int64, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	zw := gzip.NewWriter(f)
+	err = json.NewEncoder(zw).Encode(snap)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmp, path)
+}
+
+// writeFile writes through a temporary file so that a crash never leaves a truncated file.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,115 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestPinSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	store := New(dir, 10)
+	ranAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	run := store.Record(Entry{SQL: "SELECT id, name FROM users", Driver: "sqlite", RanAt: ranAt, RowCount: 2})
+	set := resultset.Set{
+		Columns: []resultset.Column{{Name: "id"}, {Name: "name"}},
+		Rows:    [][]any{{int64(1), "ann"}, {int64(2), nil}},
+	}
+	pinned, err := store.Pin(run.ID, "before migration", set, ranAt.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned.PinnedAt == nil || pinned.Label != "before migration" || pinned.SnapshotRows != 2 || pinned.SnapshotBytes == 0 {
+		t.Fatalf("pinned = %+v", pinned)
+	}
+
+	restarted := New(dir, 10)
+	entries, err := restarted.List(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != run.ID || entries[0].SQL != run.SQL {
+		t.Fatalf("entries = %+v", entries)
+	}
+	snap, err := restarted.Snapshot(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Rows) != 2 || snap.Rows[0][0] != json.Number("1") || snap.Rows[0][1] != "ann" || snap.Rows[1][1] != nil {
+		t.Fatalf("rows = %#v", snap.Rows)
+	}
+
+	if err := restarted.Unpin(run.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := restarted.Snapshot(run.ID); !errors.Is(err, ErrNotPinned) {
+		t.Fatalf("expected the unpinned run to have no snapshot, got %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 || files[0].Name() != runsFile {
+		t.Fatalf("files left behind: %v", files)
+	}
+}
+
+func TestRecentRunsAreBounded(t *testing.T) {
+	store := New("", 2)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		ids = append(ids, store.Record(Entry{SQL: "SELECT 1", RanAt: start.Add(time.Duration(i) * time.Second)}).ID)
+	}
+	entries, err := store.List(0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != ids[2] || entries[1].ID != ids[1] {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if _, err := store.Get(ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the oldest run to be dropped, got %v", err)
+	}
+	if _, err := store.Pin(ids[2], "", resultset.Set{}, start); !errors.Is(err, ErrNoStorage) {
+		t.Fatalf("expected pinning to need a directory, got %v", err)
+	}
+	if _, err := store.Snapshot(ids[2]); !errors.Is(err, ErrNotPinned) {
+		t.Fatalf("expected no snapshot, got %v", err)
+	}
+}
+
+func TestIDsCannotEscapeTheDirectory(t *testing.T) {
+	store := New(t.TempDir(), 10)
+	for _, id := range []string{"../h_00", "h_../../etc", "h_", "x"} {
+		if _, err := store.Snapshot(id); err == nil {
+			t.Fatalf("%q: expected an error", id)
+		}
+		if _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%q: got %v", id, err)
+		}
+	}
+}
+
+func TestRunsAreReloadedAndTrimmed(t *testing.T) {
+	dir := t.TempDir()
+	store := New(dir, 2)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = append(ids, store.Record(Entry{SQL: "SELECT 1", Error: "boom"}).ID)
+	}
+	restarted := New(dir, 2)
+	runs := restarted.Runs()
+	if len(runs) != 2 || runs[0].ID != ids[3] || runs[1].ID != ids[4] || runs[1].Error != "boom" {
+		t.Fatalf("runs = %+v", runs)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, runsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines >= 4 {
+		t.Fatalf("expected the log to be trimmed, it has %d lines", lines)
+	}
+}
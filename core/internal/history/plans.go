@@ -0,0 +1,209 @@
+package history
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// plansDir is the directory of captured plans in the history directory.
+const plansDir = "plans"
+
+var (
+	// ErrNoPlan is returned when asking for the plan of a run that has none.
+	ErrNoPlan = errors.New("history entry has no plan")
+	// ErrPlanTooLarge is returned when a plan alone is larger than the plan budget.
+	ErrPlanTooLarge = errors.New("plan is larger than the plan budget")
+)
+
+// Plan is the execution plan of a run, captured with EXPLAIN without running the statement
+// again.
+type Plan struct {
+	HistoryID string `json:"historyId"`
+	// Hash identifies the shape of the plan: its nodes, relations and indexes without the
+	// cost and row estimates, which change with every statistics update. Runs of a
+	// statement whose hashes differ were planned differently.
+	Hash       string          `json:"hash"`
+	CapturedAt time.Time       `json:"capturedAt"`
+	Plan       json.RawMessage `json:"plan"`
+}
+
+type memoryPlan struct {
+	plan Plan
+	size int64
+}
+
+// KeepPlans sets the total size of the plans the store keeps. Saving a plan drops the
+// oldest ones beyond it. Zero, the default, keeps none.
+func (s *Store) KeepPlans(maxBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.planBytes = maxBytes
+}
+
+// SavePlan keeps plan, then drops the oldest plans until they fit the budget set with
+// KeepPlans. Plans are kept apart from the runs log, so a run may outlive its plan or
+// the other way round.
+func (s *Store) SavePlan(plan Plan) error {
+	if !validID(plan.HistoryID) {
+		return ErrNotFound
+	}
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if int64(len(data)) > s.planBytes {
+		return ErrPlanTooLarge
+	}
+	if s.dir == "" {
+		s.plans = append(s.plans, memoryPlan{plan: plan, size: int64(len(data))})
+		var total int64
+		for i := len(s.plans) - 1; i >= 0; i-- {
+			if total += s.plans[i].size; total > s.planBytes {
+				s.plans = append(s.plans[:0:0], s.plans[i+1:]...)
+				break
+			}
+		}
+		return nil
+	}
+	dir := filepath.Join(s.dir, plansDir)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, plan.HistoryID+".json"), data); err != nil {
+		return err
+	}
+	return s.trimPlans(dir)
+}
+
+// trimPlans deletes the oldest plan files until the rest fit the budget. It reads the
+// directory rather than keeping an index, so that it sees the plans of other cores
+// sharing it.
+func (s *Store) trimPlans(dir string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type planFile struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var (
+		plans []planFile
+		total int64
+	)
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			// A plan removed by another core between listing and reading.
+			continue
+		}
+		plans = append(plans, planFile{name: file.Name(), size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].modTime.Before(plans[j].modTime) })
+	for _, plan := range plans {
+		if total <= s.planBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, plan.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= plan.size
+	}
+	return nil
+}
+
+// Plan returns the plan captured for run id.
+func (s *Store) Plan(id string) (Plan, error) {
+	if !validID(id) {
+		return Plan{}, ErrNotFound
+	}
+	if s.dir == "" {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, kept := range s.plans {
+			if kept.plan.HistoryID == id {
+				return kept.plan, nil
+			}
+		}
+		return Plan{}, ErrNoPlan
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, plansDir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Plan{}, ErrNoPlan
+	}
+	if err != nil {
+		return Plan{}, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return Plan{}, fmt.Errorf("read plan %s: %w", id, err)
+	}
+	return plan, nil
+}
+
+// PlanHash returns the Hash of a plan in JSON form. It leaves out every number, and every
+// string that holds one, as MySQL gives its costs: what remains are the node types,
+// relations, indexes, join strategies and conditions.
+func PlanHash(plan json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(plan))
+	decoder.UseNumber()
+	var tree any
+	if err := decoder.Decode(&tree); err != nil {
+		return "", err
+	}
+	shape, err := json.Marshal(planShape(tree))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(shape)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// planShape returns tree without its numbers. Maps are encoded with sorted keys, so
+// the key order of the plan does not matter.
+func planShape(tree any) any {
+	switch v := tree.(type) {
+	case map[string]any:
+		shape := make(map[string]any, len(v))
+		for key, value := range v {
+			if value = planShape(value); value != nil {
+				shape[key] = value
+			}
+		}
+		return shape
+	case []any:
+		shape := make([]any, 0, len(v))
+		for _, value := range v {
+			if value = planShape(value); value != nil {
+				shape = append(shape, value)
+			}
+		}
+		return shape
+	case json.Number:
+		return nil
+	case string:
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return nil
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,68 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlanHashIgnoresEstimates(t *testing.T) {
+	hash := func(plan string) string {
+		t.Helper()
+		h, err := PlanHash(json.RawMessage(plan))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	seqScan := hash(`[{"Plan":{"Node Type":"Seq Scan","Relation Name":"orders","Total Cost":12.5,"Plan Rows":100}}]`)
+	if again := hash(`[{"Plan":{"Plan Rows":7,"Total Cost":3.1,"Relation Name":"orders","Node Type":"Seq Scan"}}]`); again != seqScan {
+		t.Fatal("estimates or key order changed the hash")
+	}
+	if indexScan := hash(`[{"Plan":{"Node Type":"Index Scan","Relation Name":"orders","Index Name":"orders_pkey","Total Cost":0.3}}]`); indexScan == seqScan {
+		t.Fatal("a different plan has the same hash")
+	}
+	mysql := `{"query_block":{"cost_info":{"query_cost":"%s"},"table":{"table_name":"orders","access_type":"ALL"}}}`
+	if hash(fmt.Sprintf(mysql, "1.25")) != hash(fmt.Sprintf(mysql, "900.00")) {
+		t.Fatal("MySQL costs changed the hash")
+	}
+}
+
+func TestPlansStayWithinTheirBudget(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		store := New(dir, 10)
+		plan := json.RawMessage(`[{"Plan":{"Node Type":"Seq Scan"}}]`)
+		size := func(id string) int64 {
+			data, _ := json.Marshal(Plan{HistoryID: id, Plan: plan, CapturedAt: time.Unix(0, 0).UTC()})
+			return int64(len(data))
+		}
+		first, second, third := store.Record(Entry{SQL: "SELECT 1"}), store.Record(Entry{SQL: "SELECT 2"}), store.Record(Entry{SQL: "SELECT 3"})
+		store.KeepPlans(2 * size(first.ID))
+		for i, run := range []Entry{first, second, third} {
+			if err := store.SavePlan(Plan{HistoryID: run.ID, Plan: plan, CapturedAt: time.Unix(0, 0).UTC()}); err != nil {
+				t.Fatal(err)
+			}
+			if dir != "" {
+				// Order the files by age as if the plans had been saved a second apart.
+				at := time.Now().Add(time.Duration(i-3) * time.Second)
+				_ = os.Chtimes(filepath.Join(dir, plansDir, run.ID+".json"), at, at)
+			}
+		}
+		if _, err := store.Plan(first.ID); !errors.Is(err, ErrNoPlan) {
+			t.Fatalf("dir %q: oldest plan kept: %v", dir, err)
+		}
+		for _, run := range []Entry{second, third} {
+			if got, err := store.Plan(run.ID); err != nil || got.HistoryID != run.ID {
+				t.Fatalf("dir %q: plan of %s = %+v, %v", dir, run.ID, got, err)
+			}
+		}
+		store.KeepPlans(10)
+		if err := store.SavePlan(Plan{HistoryID: first.ID, Plan: plan}); !errors.Is(err, ErrPlanTooLarge) {
+			t.Fatalf("dir %q: oversized plan: %v", dir, err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stats summarizes the recorded runs.
+type Stats struct {
+	Since     time.Time `json:"since"`
+	Runs      int       `json:"runs"`
+	Failed    int       `json:"failed"`
+	ErrorRate float64   `json:"errorRate"`
+	AvgMs     float64   `json:"avgMs"`
+	// Tables are the most used tables, by runs.
+	Tables []TableStats `json:"tables"`
+	// Connections are the servers run against, by runs, with their error rates.
+	Connections []ConnectionStats `json:"connections"`
+	// Days is the daily trend of runs and durations, oldest first, for days with runs.
+	Days []DayStats `json:"days"`
+	// Hours counts the runs started in each hour of the day; BusiestHour has the most.
+	Hours       [24]int `json:"hours"`
+	BusiestHour int     `json:"busiestHour"`
+	// Slowest are the statements with the highest average duration among those that
+	// succeeded, and Failing those that failed most often.
+	Slowest []QueryStats `json:"slowest"`
+	Failing []QueryStats `json:"failing"`
+}
+
+// TableStats counts the runs naming a table.
+type TableStats struct {
+	Table  string  `json:"table"`
+	Runs   int     `json:"runs"`
+	Failed int     `json:"failed"`
+	AvgMs  float64 `json:"avgMs"`
+}
+
+// ConnectionStats counts the runs against a server and database.
+type ConnectionStats struct {
+	Target    string  `json:"target"`
+	Driver    string  `json:"driver"`
+	Runs      int     `json:"runs"`
+	Failed    int     `json:"failed"`
+	ErrorRate float64 `json:"errorRate"`
+	AvgMs     float64 `json:"avgMs"`
+}
+
+// DayStats summarizes the runs of one day.
+type DayStats struct {
+	Date   string  `json:"date"`
+	Runs   int     `json:"runs"`
+	Failed int     `json:"failed"`
+	AvgMs  float64 `json:"avgMs"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// QueryStats summarizes the runs of one statement. Statements sharing a fingerprint count
+// as one; SQL is the latest of them. Runs recorded without a fingerprint are grouped by
+// their text, differences in whitespace aside.
+type QueryStats struct {
+	SQL         string  `json:"sql"`
+	Fingerprint string  `json:"fingerprint,omitempty"`
+	Runs        int     `json:"runs"`
+	Failed      int     `json:"failed"`
+	AvgMs       float64 `json:"avgMs"`
+	MaxMs       float64 `json:"maxMs"`
+	LastError   string  `json:"lastError,omitempty"`
+}
+
+// tally accumulates the durations of successful runs and counts failures.
+type tally struct {
+	runs, failed int
+	totalMs      float64
+	maxMs        float64
+}
+
+func (t *tally) add(e Entry) {
+	t.runs++
+	if e.Error != "" {
+		t.failed++
+		return
+	}
+	t.totalMs += e.ExecutionTimeMs
+	t.maxMs = max(t.maxMs, e.ExecutionTimeMs)
+}
+
+func (t *tally) avgMs() float64 {
+	if t.runs == t.failed {
+		return 0
+	}
+	return t.totalMs / float64(t.runs-t.failed)
+}
+
+func (t *tally) errorRate() float64 {
+	if t.runs == 0 {
+		return 0
+	}
+	return float64(t.failed) / float64(t.runs)
+}
+
+// Summarize computes the statistics of the runs started at or after since. Days and
+// hours are those of loc; top lists hold at most top items.
+func Summarize(runs []Entry, since time.Time, loc *time.Location, top int) Stats {
+	var (
+		all        tally
+		tables     = map[string]*tally{}
+		conns      = map[[2]string]*tally{}
+		days       = map[string]*tally{}
+		queries    = map[string]*tally{}
+		lastErrors = map[string]string{}
+		latest     = map[string]Entry{}
+		stats      = Stats{Since: since}
+	)
+	get := func(m map[string]*tally, key string) *tally {
+		t, ok := m[key]
+		if !ok {
+			t = &tally{}
+			m[key] = t
+		}
+		return t
+	}
+	for _, e := range runs {
+		if e.RanAt.Before(since) {
+			continue
+		}
+		all.add(e)
+		for _, table := range e.Tables {
+			get(tables, table).add(e)
+		}
+		key := [2]string{e.Target, e.Driver}
+		if conns[key] == nil {
+			conns[key] = &tally{}
+		}
+		conns[key].add(e)
+		local := e.RanAt.In(loc)
+		get(days, local.Format(time.DateOnly)).add(e)
+		stats.Hours[local.Hour()]++
+		query := e.Fingerprint
+		if query == "" {
+			query = strings.Join(strings.Fields(e.SQL), " ")
+		}
+		latest[query] = e
+		get(queries, query).add(e)
+		if e.Error != "" {
+			lastErrors[query] = e.Error
+		}
+	}
+	stats.Runs, stats.Failed = all.runs, all.failed
+	stats.ErrorRate, stats.AvgMs = all.errorRate(), all.avgMs()
+	for hour, n := range stats.Hours {
+		if n > stats.Hours[stats.BusiestHour] {
+			stats.BusiestHour = hour
+		}
+	}
+
+	stats.Tables = []TableStats{}
+	for table, t := range tables {
+		stats.Tables = append(stats.Tables, TableStats{Table: table, Runs: t.runs, Failed: t.failed, AvgMs: t.avgMs()})
+	}
+	sort.Slice(stats.Tables, func(i, j int) bool {
+		a, b := stats.Tables[i], stats.Tables[j]
+		return a.Runs > b.Runs || a.Runs == b.Runs && a.Table < b.Table
+	})
+	stats.Tables = stats.Tables[:min(top, len(stats.Tables))]
+
+	stats.Connections = []ConnectionStats{}
+	for key, t := range conns {
+		stats.Connections = append(stats.Connections, ConnectionStats{
+			Target:    key[0],
+			Driver:    key[1],
+			Runs:      t.runs,
+			Failed:    t.failed,
+			ErrorRate: t.errorRate(),
+			AvgMs:     t.avgMs(),
+		})
+	}
+	sort.Slice(stats.Connections, func(i, j int) bool {
+		a, b := stats.Connections[i], stats.Connections[j]
+		return a.Runs > b.Runs || a.Runs == b.Runs && a.Target < b.Target
+	})
+
+	stats.Days = []DayStats{}
+	for date, t := range days {
+		stats.Days = append(stats.Days, DayStats{Date: date, Runs: t.runs, Failed: t.failed, AvgMs: t.avgMs(), MaxMs: t.maxMs})
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Date < stats.Days[j].Date })
+
+	stats.Slowest, stats.Failing = []QueryStats{}, []QueryStats{}
+	for query, t := range queries {
+		q := QueryStats{
+			SQL:         strings.Join(strings.Fields(latest[query].SQL), " "),
+			Fingerprint: latest[query].Fingerprint,
+			Runs:        t.runs,
+			Failed:      t.failed,
+			AvgMs:       t.avgMs(),
+			MaxMs:       t.maxMs,
+			LastError:   lastErrors[query],
+		}
+		if t.runs > t.failed {
+			stats.Slowest = append(stats.Slowest, q)
+		}
+		if t.failed > 0 {
+			stats.Failing = append(stats.Failing, q)
+		}
+	}
+	sort.Slice(stats.Slowest, func(i, j int) bool {
+		a, b := stats.Slowest[i], stats.Slowest[j]
+		return a.AvgMs > b.AvgMs || a.AvgMs == b.AvgMs && a.SQL < b.SQL
+	})
+	stats.Slowest = stats.Slowest[:min(top, len(stats.Slowest))]
+	sort.Slice(stats.Failing, func(i, j int) bool {
+		a, b := stats.Failing[i], stats.Failing[j]
+		return a.Failed > b.Failed || a.Failed == b.Failed && a.SQL < b.SQL
+	})
+	stats.Failing = stats.Failing[:min(top, len(stats.Failing))]
+	return stats
+}
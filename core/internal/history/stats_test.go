@@ -0,0 +1,58 @@
+package history
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSummarizeFindsSlowAndFailingPatterns(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	runs := []Entry{
+		{SQL: "SELECT * FROM old", Target: "a", RanAt: day.AddDate(0, 0, -10), ExecutionTimeMs: 9000},
+		{SQL: "SELECT * FROM orders", Tables: []string{"orders"}, Target: "a", Driver: "postgres", RanAt: day.Add(9 * time.Hour), ExecutionTimeMs: 100},
+		{SQL: "SELECT *\n  FROM orders", Tables: []string{"orders"}, Target: "a", Driver: "postgres", RanAt: day.Add(9*time.Hour + time.Minute), ExecutionTimeMs: 300},
+		{SQL: "SELECT * FROM users JOIN orders", Tables: []string{"users", "orders"}, Target: "b", Driver: "mysql", RanAt: day.Add(33 * time.Hour), ExecutionTimeMs: 50},
+		{SQL: "SELECT * FROM missing", Tables: []string{"missing"}, Target: "b", Driver: "mysql", RanAt: day.Add(34 * time.Hour), Error: "no such table"},
+	}
+	stats := Summarize(runs, day, time.UTC, 2)
+	if stats.Runs != 4 || stats.Failed != 1 || stats.ErrorRate != 0.25 || stats.AvgMs != 150 {
+		t.Fatalf("totals = %+v", stats)
+	}
+	if len(stats.Tables) != 2 || stats.Tables[0] != (TableStats{Table: "orders", Runs: 3, AvgMs: 150}) || stats.Tables[1].Table != "missing" {
+		t.Fatalf("tables = %+v", stats.Tables)
+	}
+	if len(stats.Connections) != 2 || stats.Connections[1].Target != "b" || stats.Connections[1].ErrorRate != 0.5 {
+		t.Fatalf("connections = %+v", stats.Connections)
+	}
+	if len(stats.Days) != 2 || stats.Days[0] != (DayStats{Date: "2026-03-02", Runs: 2, AvgMs: 200, MaxMs: 300}) {
+		t.Fatalf("days = %+v", stats.Days)
+	}
+	if stats.BusiestHour != 9 || stats.Hours[9] != 3 || stats.Hours[10] != 1 {
+		t.Fatalf("hours = %v, busiest %d", stats.Hours, stats.BusiestHour)
+	}
+	if stats.Slowest[0].SQL != "SELECT * FROM orders" || stats.Slowest[0].Runs != 2 {
+		t.Fatalf("slowest = %+v", stats.Slowest)
+	}
+	if len(stats.Failing) != 1 || stats.Failing[0].LastError != "no such table" {
+		t.Fatalf("failing = %+v", stats.Failing)
+	}
+
+	tokyo := time.FixedZone("JST", 9*60*60)
+	if stats := Summarize(runs, day, tokyo, 2); stats.BusiestHour != 18 || len(stats.Days) != 2 || stats.Days[1].Date != "2026-03-03" {
+		t.Fatalf("in JST: busiest %d, days %+v", stats.BusiestHour, stats.Days)
+	}
+}
+
+func TestSummarizeGroupsRunsByFingerprint(t *testing.T) {
+	day := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	runs := []Entry{
+		{SQL: "SELECT * FROM orders WHERE id = 1", Fingerprint: "f1", RanAt: day, ExecutionTimeMs: 10},
+		{SQL: "SELECT * FROM orders WHERE id = 2", Fingerprint: "f1", RanAt: day.Add(time.Minute), ExecutionTimeMs: 30},
+		{SQL: "SELECT * FROM users", RanAt: day.Add(2 * time.Minute), ExecutionTimeMs: 5},
+	}
+	stats := Summarize(runs, day, time.UTC, 5)
+	want := QueryStats{SQL: "SELECT * FROM orders WHERE id = 2", Fingerprint: "f1", Runs: 2, AvgMs: 20, MaxMs: 30}
+	if len(stats.Slowest) != 2 || stats.Slowest[0] != want || stats.Slowest[1].Fingerprint != "" {
+		t.Fatalf("slowest = %+v", stats.Slowest)
+	}
+}
@@ -0,0 +1,452 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluxgrid/core/internal/logging"
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+// Job states.
+const (
+	StateQueued    = "queued"
+	StateRunning   = "running"
+	StateCompleted = "completed"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+	// StateInterrupted marks jobs that were still active when a previous process exited.
+	StateInterrupted = "interrupted"
+)
+
+const (
+	defaultMaxRunning       = 4
+	defaultMaxActive        = 64
+	defaultMaxFinished      = 64
+	defaultProgressInterval = 250 * time.Millisecond
+)
+
+// Notifier emits JSON-RPC notifications to the clients of one tenant; *rpc.Server
+// satisfies it.
+type Notifier interface {
+	NotifyTenant(tenant, method string, params interface{}) error
+}
+
+// Progress is reported by a running job. Total and EtaMs are zero when unknown.
+type Progress struct {
+	Phase string  `json:"phase,omitempty"`
+	Done  int64   `json:"done"`
+	Total int64   `json:"total,omitempty"`
+	Bytes int64   `json:"bytes,omitempty"`
+	EtaMs float64 `json:"etaMs,omitempty"`
+}
+
+// Reporter publishes progress for the job it was handed to.
+type Reporter func(Progress)
+
+// Kind plugs a subsystem into the manager.
+type Kind struct {
+	// Validate checks parameters before the job is queued and returns a short label for
+	// listings. It may be nil.
+	Validate func(params json.RawMessage) (string, *rpc.Error)
+	// Run performs the work. It must return promptly once ctx is cancelled.
+	Run func(ctx context.Context, params json.RawMessage, report Reporter) (any, *rpc.Error)
+}
+
+// Info is the externally visible state of a job. Parameters are deliberately not part of
+// it, so connection strings never reach listings or the state file.
+type Info struct {
+	ID   string `json:"jobId"`
+	Kind string `json:"kind"`
+	// Owner is the tenant that started the job, empty for the core's own clients.
+	Owner      string          `json:"owner,omitempty"`
+	Label      string          `json:"label,omitempty"`
+	State      string          `json:"state"`
+	Progress   Progress        `json:"progress"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      *rpc.Error      `json:"error,omitempty"`
+	CreatedAt  string          `json:"createdAt"`
+	StartedAt  string          `json:"startedAt,omitempty"`
+	FinishedAt string          `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job reached a terminal state.
+func (i Info) Finished() bool {
+	switch i.State {
+	case StateCompleted, StateFailed, StateCancelled, StateInterrupted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Options configures a Manager. Zero values select defaults.
+type Options struct {
+	// MaxRunning bounds concurrently running jobs; further jobs wait in the queued state.
+	MaxRunning int
+	// MaxActive bounds queued plus running jobs.
+	MaxActive int
+	// MaxFinished bounds how many finished jobs are retained for status and listing.
+	MaxFinished int
+	// ProgressInterval throttles job.progress notifications per job. Phase changes are
+	// always sent.
+	ProgressInterval time.Duration
+	// Store persists job metadata. Nil keeps jobs in memory only.
+	Store Store
+}
+
+type job struct {
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	info       Info
+	phaseStart time.Time
+	lastNotify time.Time
+}
+
+// Manager runs jobs of registered kinds with bounded concurrency and publishes
+// job.progress and job.finished notifications to the tenant that started each job.
+type Manager struct {
+	notify           Notifier
+	store            Store
+	maxActive        int
+	maxFinished      int
+	progressInterval time.Duration
+	slots            chan struct{}
+
+	persistMu sync.Mutex
+
+	mu     sync.Mutex
+	nextID int
+	kinds  map[string]Kind
+	jobs   map[string]*job
+}
+
+// NewManager constructs a manager and restores job metadata from the store, marking jobs
+// that were still active as interrupted.
+func NewManager(notify Notifier, opts Options) *Manager {
+	if opts.MaxRunning <= 0 {
+		opts.MaxRunning = defaultMaxRunning
+	}
+	if opts.MaxActive <= 0 {
+		opts.MaxActive = defaultMaxActive
+	}
+	if opts.MaxFinished <= 0 {
+		opts.MaxFinished = defaultMaxFinished
+	}
+	if opts.ProgressInterval == 0 {
+		opts.ProgressInterval = defaultProgressInterval
+	}
+
+	m := &Manager{
+		notify:           notify,
+		store:            opts.Store,
+		maxActive:        opts.MaxActive,
+		maxFinished:      opts.MaxFinished,
+		progressInterval: opts.ProgressInterval,
+		slots:            make(chan struct{}, opts.MaxRunning),
+		kinds:            make(map[string]Kind),
+		jobs:             make(map[string]*job),
+	}
+	m.restore()
+	return m
+}
+
+func (m *Manager) restore() {
+	if m.store == nil {
+		return
+	}
+	infos, err := m.store.Load()
+	if err != nil {
+		logger := logging.Logger()
+		logger.Warn().Err(err).Msg("failed to load job state")
+		return
+	}
+
+	interrupted := false
+	for _, info := range infos {
+		if !info.Finished() {
+			info.State = StateInterrupted
+			interrupted = true
+		}
+		m.jobs[info.ID] = &job{cancel: func() {}, info: info}
+		if n := ordinal(info.ID); n > m.nextID {
+			m.nextID = n
+		}
+	}
+	if interrupted {
+		m.persist()
+	}
+}
+
+// RegisterKind makes a job kind available to Start.
+func (m *Manager) RegisterKind(name string, kind Kind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.kinds[name] = kind
+}
+
+// Start validates the parameters and queues a job.
+func (m *Manager) Start(kind string, params json.RawMessage) (Info, *rpc.Error) {
+	return m.StartAs("", kind, params)
+}
+
+// StartAs queues a job like Start, recording owner as the tenant that started it.
+func (m *Manager) StartAs(owner, kind string, params json.RawMessage) (Info, *rpc.Error) {
+	m.mu.Lock()
+	k, ok := m.kinds[kind]
+	m.mu.Unlock()
+	if !ok {
+		return Info{}, &rpc.Error{
+			Code:    -32602,
+			Message: fmt.Sprintf("unknown job kind: %s", kind),
+		}
+	}
+
+	var label string
+	if k.Validate != nil {
+		var rpcErr *rpc.Error
+		if label, rpcErr = k.Validate(params); rpcErr != nil {
+			return Info{}, rpcErr
+		}
+	}
+
+	m.mu.Lock()
+	active := 0
+	for _, j := range m.jobs {
+		if !j.snapshot().Finished() {
+			active++
+		}
+	}
+	if active >= m.maxActive {
+		m.mu.Unlock()
+		return Info{}, &rpc.Error{
+			Code:    -32082,
+			Message: fmt.Sprintf("job limit reached (%d)", m.maxActive),
+		}
+	}
+	m.pruneLocked()
+
+	m.nextID++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{
+		cancel: cancel,
+		info: Info{
+			ID:        "job-" + strconv.Itoa(m.nextID),
+			Kind:      kind,
+			Owner:     owner,
+			Label:     label,
+			State:     StateQueued,
+			CreatedAt: timestamp(),
+		},
+	}
+	m.jobs[j.info.ID] = j
+	m.mu.Unlock()
+
+	m.persist()
+	go m.run(ctx, j, k, params)
+
+	return j.snapshot(), nil
+}
+
+// pruneLocked drops the oldest finished jobs so that a new one fits within maxFinished.
+func (m *Manager) pruneLocked() {
+	var finished []string
+	for id, j := range m.jobs {
+		if j.snapshot().Finished() {
+			finished = append(finished, id)
+		}
+	}
+	if len(finished) < m.maxFinished {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return ordinal(finished[i]) < ordinal(finished[j]) })
+	for _, id := range finished[:len(finished)-m.maxFinished+1] {
+		delete(m.jobs, id)
+	}
+}
+
+func (m *Manager) run(ctx context.Context, j *job, k Kind, params json.RawMessage) {
+	defer j.cancel()
+
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		m.finish(ctx, j, nil, &rpc.Error{Code: -32603, Message: "job cancelled before start"})
+		return
+	}
+	defer func() { <-m.slots }()
+
+	j.mu.Lock()
+	j.info.State = StateRunning
+	j.info.StartedAt = timestamp()
+	j.mu.Unlock()
+	m.persist()
+	m.publish(j, true)
+
+	result, rpcErr := k.Run(ctx, params, func(p Progress) { m.report(j, p) })
+	m.finish(ctx, j, result, rpcErr)
+}
+
+func (m *Manager) finish(ctx context.Context, j *job, result any, rpcErr *rpc.Error) {
+	var encoded json.RawMessage
+	if rpcErr == nil && result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			rpcErr = &rpc.Error{Code: -32603, Message: "failed to encode job result", Data: err.Error()}
+		} else {
+			encoded = data
+		}
+	}
+
+	j.mu.Lock()
+	j.info.FinishedAt = timestamp()
+	j.info.Progress.EtaMs = 0
+	switch {
+	case rpcErr == nil:
+		j.info.State = StateCompleted
+		j.info.Result = encoded
+	case ctx.Err() != nil:
+		j.info.State = StateCancelled
+	default:
+		j.info.State = StateFailed
+		j.info.Error = rpcErr
+	}
+	info := j.info
+	j.mu.Unlock()
+
+	if info.State != StateCompleted {
+		logger := logging.Logger()
+		logger.Warn().Str("job_id", info.ID).Str("kind", info.Kind).Str("state", info.State).Msg("job did not complete")
+	}
+	m.persist()
+	m.emit(info.Owner, "job.finished", info)
+}
+
+// report records progress, estimating the remaining time from the rate since the current
+// phase began.
+func (m *Manager) report(j *job, p Progress) {
+	j.mu.Lock()
+	now := time.Now()
+	phaseChanged := p.Phase != j.info.Progress.Phase || j.phaseStart.IsZero()
+	if phaseChanged {
+		j.phaseStart = now
+	}
+	if p.Total > 0 && p.Done > 0 && p.Done < p.Total {
+		perItem := float64(now.Sub(j.phaseStart)) / float64(p.Done)
+		p.EtaMs = time.Duration(perItem*float64(p.Total-p.Done)).Seconds() * 1000
+	}
+	j.info.Progress = p
+	j.mu.Unlock()
+
+	m.publish(j, phaseChanged)
+}
+
+// publish emits job.progress, at most once per progress interval unless forced.
+func (m *Manager) publish(j *job, force bool) {
+	j.mu.Lock()
+	now := time.Now()
+	if !force && now.Sub(j.lastNotify) < m.progressInterval {
+		j.mu.Unlock()
+		return
+	}
+	j.lastNotify = now
+	info := j.info
+	j.mu.Unlock()
+
+	m.emit(info.Owner, "job.progress", map[string]any{
+		"jobId":    info.ID,
+		"kind":     info.Kind,
+		"state":    info.State,
+		"progress": info.Progress,
+	})
+}
+
+// Status returns the job with the given ID.
+func (m *Manager) Status(id string) (Info, bool) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Info{}, false
+	}
+	return j.snapshot(), true
+}
+
+// Cancel requests cancellation and reports whether the job was still active.
+func (m *Manager) Cancel(id string) (Info, bool, bool) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return Info{}, false, false
+	}
+	info := j.snapshot()
+	if info.Finished() {
+		return info, false, true
+	}
+	j.cancel()
+	return info, true, true
+}
+
+// List returns jobs in creation order, optionally restricted to one kind.
+func (m *Manager) List(kind string) []Info {
+	m.mu.Lock()
+	infos := make([]Info, 0, len(m.jobs))
+	for _, j := range m.jobs {
+		if info := j.snapshot(); kind == "" || info.Kind == kind {
+			infos = append(infos, info)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return ordinal(infos[i].ID) < ordinal(infos[j].ID) })
+	return infos
+}
+
+// persist writes every job to the store. Saves are serialized so the file never regresses
+// to an older snapshot.
+func (m *Manager) persist() {
+	if m.store == nil {
+		return
+	}
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	if err := m.store.Save(m.List("")); err != nil {
+		logger := logging.Logger()
+		logger.Warn().Err(err).Msg("failed to save job state")
+	}
+}
+
+// emit sends a job event to the tenant that owns the job only.
+func (m *Manager) emit(owner, method string, payload any) {
+	if m.notify == nil {
+		return
+	}
+	if err := m.notify.NotifyTenant(owner, method, payload); err != nil {
+		logger := logging.Logger()
+		logger.Error().Err(err).Str("method", method).Msg("failed to send job notification")
+	}
+}
+
+func (j *job) snapshot() Info {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.info
+}
+
+func ordinal(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "job-"))
+	return n
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/rpc"
+)
+
+type recordingNotifier struct {
+	mu      sync.Mutex
+	methods []string
+	params  []any
+}
+
+func (n *recordingNotifier) NotifyTenant(_, method string, params interface{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.methods = append(n.methods, method)
+	n.params = append(n.params, params)
+	return nil
+}
+
+// blockingKind runs until released or cancelled and echoes its parameters.
+func blockingKind(release <-chan struct{}) Kind {
+	return Kind{
+		Validate: func(params json.RawMessage) (string, *rpc.Error) {
+			if string(params) == `"bad"` {
+				return "", &rpc.Error{Code: -32602, Message: "invalid parameters"}
+			}
+			return "label:" + string(params), nil
+		},
+		Run: func(ctx context.Context, params json.RawMessage, report Reporter) (any, *rpc.Error) {
+			report(Progress{Phase: "working", Total: 10})
+			select {
+			case <-release:
+				report(Progress{Phase: "working", Done: 10, Total: 10})
+				return map[string]string{"echo": string(params)}, nil
+			case <-ctx.Done():
+				return nil, &rpc.Error{Code: -32603, Message: "cancelled"}
+			}
+		},
+	}
+}
+
+func waitForState(t *testing.T, m *Manager, id, state string) Info {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, ok := m.Status(id)
+		if ok && info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not reach %s, last state %+v", id, state, info)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerBoundsConcurrency(t *testing.T) {
+	release := make(chan struct{})
+	m := NewManager(&recordingNotifier{}, Options{MaxRunning: 1})
+	m.RegisterKind("block", blockingKind(release))
+
+	a, rpcErr := m.Start("block", json.RawMessage(`1`))
+	if rpcErr != nil {
+		t.Fatalf("Start returned error: %v", rpcErr)
+	}
+	b, _ := m.Start("block", json.RawMessage(`2`))
+
+	// Either job may win the single slot; the other must wait.
+	var first, second Info
+	deadline := time.Now().Add(2 * time.Second)
+	for first.ID == "" {
+		if info, _ := m.Status(a.ID); info.State == StateRunning {
+			first, second = info, b
+		} else if info, _ := m.Status(b.ID); info.State == StateRunning {
+			first, second = info, a
+		} else if time.Now().After(deadline) {
+			t.Fatal("no job started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if info, _ := m.Status(second.ID); info.State != StateQueued {
+		t.Fatalf("expected second job to wait, got %s", info.State)
+	}
+
+	release <- struct{}{}
+	done := waitForState(t, m, first.ID, StateCompleted)
+	if string(done.Result) != `{"echo":"`+done.Label[len("label:"):]+`"}` {
+		t.Fatalf("unexpected finished job %+v", done)
+	}
+
+	waitForState(t, m, second.ID, StateRunning)
+	close(release)
+	waitForState(t, m, second.ID, StateCompleted)
+}
+
+func TestManagerCancel(t *testing.T) {
+	m := NewManager(&recordingNotifier{}, Options{MaxRunning: 1})
+	m.RegisterKind("block", blockingKind(make(chan struct{})))
+
+	running, _ := m.Start("block", nil)
+	waitForState(t, m, running.ID, StateRunning)
+	queued, _ := m.Start("block", nil)
+
+	if _, cancelled, ok := m.Cancel(queued.ID); !ok || !cancelled {
+		t.Fatalf("expected queued job to be cancelled")
+	}
+	waitForState(t, m, queued.ID, StateCancelled)
+
+	m.Cancel(running.ID)
+	waitForState(t, m, running.ID, StateCancelled)
+
+	if _, cancelled, _ := m.Cancel(running.ID); cancelled {
+		t.Fatal("expected finished job not to be cancelled again")
+	}
+	if _, _, ok := m.Cancel("job-99"); ok {
+		t.Fatal("expected unknown job")
+	}
+}
+
+func TestManagerValidatesKindAndParams(t *testing.T) {
+	m := NewManager(nil, Options{})
+	m.RegisterKind("block", blockingKind(nil))
+
+	if _, rpcErr := m.Start("missing", nil); rpcErr == nil || rpcErr.Code != -32602 {
+		t.Fatalf("expected unknown kind error, got %+v", rpcErr)
+	}
+	if _, rpcErr := m.Start("block", json.RawMessage(`"bad"`)); rpcErr == nil {
+		t.Fatal("expected validation error")
+	}
+	if jobs := m.List(""); len(jobs) != 0 {
+		t.Fatalf("expected no jobs, got %+v", jobs)
+	}
+}
+
+func TestManagerPersistsMetadata(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "state", "jobs.json"))
+	release := make(chan struct{})
+
+	m := NewManager(nil, Options{Store: store})
+	m.RegisterKind("block", blockingKind(release))
+	done, _ := m.Start("block", json.RawMessage(`1`))
+	release <- struct{}{}
+	waitForState(t, m, done.ID, StateCompleted)
+	active, _ := m.Start("block", json.RawMessage(`2`))
+	waitForState(t, m, active.ID, StateRunning)
+
+	restored := NewManager(nil, Options{Store: store})
+	infos := restored.List("")
+	if len(infos) != 2 || infos[0].State != StateCompleted || infos[1].State != StateInterrupted {
+		t.Fatalf("unexpected restored jobs %+v", infos)
+	}
+
+	restored.RegisterKind("block", blockingKind(release))
+	next, _ := restored.Start("block", nil)
+	if next.ID != "job-3" {
+		t.Fatalf("expected IDs to continue after restore, got %s", next.ID)
+	}
+	close(release)
+	waitForState(t, m, active.ID, StateCompleted)
+	waitForState(t, restored, next.ID, StateCompleted)
+}
+
+func TestManagerReportsProgress(t *testing.T) {
+	notify := &recordingNotifier{}
+	release := make(chan struct{})
+	m := NewManager(notify, Options{ProgressInterval: -1})
+	m.RegisterKind("block", blockingKind(release))
+
+	info, _ := m.Start("block", nil)
+	waitForState(t, m, info.ID, StateRunning)
+	close(release)
+	waitForState(t, m, info.ID, StateCompleted)
+
+	notify.mu.Lock()
+	defer notify.mu.Unlock()
+	last := len(notify.methods) - 1
+	if notify.methods[last] != "job.finished" {
+		t.Fatalf("expected job.finished last, got %v", notify.methods)
+	}
+	progress := notify.params[last-1].(map[string]any)["progress"].(Progress)
+	if progress.Done != 10 || progress.Total != 10 || progress.EtaMs != 0 {
+		t.Fatalf("unexpected final progress %+v", progress)
+	}
+}
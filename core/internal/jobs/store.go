@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Store persists job metadata between runs of the engine.
+type Store interface {
+	Load() ([]Info, error)
+	Save(infos []Info) error
+}
+
+// FileStore keeps job metadata in a single JSON file.
+type FileStore struct {
+	path string
+}
+
+// NewFileStore returns a store backed by the file at path. The directory is created on
+// first save.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the stored jobs; a missing file yields no jobs.
+func (s *FileStore) Load() ([]Info, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		Jobs []Info `json:"jobs"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state.Jobs, nil
+}
+
+// Save replaces the stored jobs, writing through a temporary file so a crash never leaves
+// a truncated state file behind.
+func (s *FileStore) Save(infos []Info) error {
+	data, err := json.MarshalIndent(map[string]any{"jobs": infos}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
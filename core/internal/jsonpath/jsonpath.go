@@ -0,0 +1,211 @@
+// Package jsonpath parses the small JSON path subset FluxGrid uses to reach into json and
+// jsonb cells: object keys and array indexes below the root, as in $.address.lines[0] or
+// $["key with spaces"]. Paths are evaluated over decoded cells, or rendered for the path
+// functions of each SQL dialect.
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment is one step of a path: an object key, or an array index when IsIndex is set.
+type Segment struct {
+	Key     string
+	Index   int
+	IsIndex bool
+}
+
+// Path is a parsed path. The empty path selects the whole document.
+type Path []Segment
+
+// Parse reads a path such as $.a.b[0] or $["a.b"]. The leading $ is optional.
+func Parse(s string) (Path, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "$")
+	var path Path
+	first := true
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+			fallthrough
+		case first && rest[0] != '[':
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: empty key", s)
+			}
+			path = append(path, Segment{Key: rest[:end]})
+			rest = rest[end:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if strings.HasPrefix(rest, `["`) {
+				key, n, err := quotedKey(rest[1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid JSON path %q: %w", s, err)
+				}
+				if !strings.HasPrefix(rest[1+n:], "]") {
+					return nil, fmt.Errorf("invalid JSON path %q: missing ]", s)
+				}
+				path = append(path, Segment{Key: key})
+				rest = rest[2+n:]
+				break
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: missing ]", s)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q: bad index %q", s, rest[1:end])
+			}
+			path = append(path, Segment{Index: index, IsIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid JSON path %q", s)
+		}
+		first = false
+	}
+	return path, nil
+}
+
+// quotedKey decodes the JSON string at the start of s and returns it with its length.
+func quotedKey(s string) (string, int, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	var key string
+	if err := dec.Decode(&key); err != nil {
+		return "", 0, errors.New("bad quoted key")
+	}
+	return key, int(dec.InputOffset()), nil
+}
+
+// String renders the path in the form Parse reads, quoting keys that need it.
+func (p Path) String() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range p {
+		switch {
+		case seg.IsIndex:
+			b.WriteString("[" + strconv.Itoa(seg.Index) + "]")
+		case plainKey(seg.Key):
+			b.WriteString("." + seg.Key)
+		default:
+			quoted, _ := json.Marshal(seg.Key)
+			b.WriteString("[" + string(quoted) + "]")
+		}
+	}
+	return b.String()
+}
+
+func plainKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Quoted renders the path in the MySQL and SQLite syntax with every key double-quoted, as
+// in $."a"[0], so that keys are never read as path syntax.
+func (p Path) Quoted() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, seg := range p {
+		if seg.IsIndex {
+			b.WriteString("[" + strconv.Itoa(seg.Index) + "]")
+			continue
+		}
+		quoted, _ := json.Marshal(seg.Key)
+		b.WriteString("." + string(quoted))
+	}
+	return b.String()
+}
+
+// Elements returns the path as the text array Postgres's #> and #>> operators take.
+func (p Path) Elements() []string {
+	elements := make([]string, len(p))
+	for i, seg := range p {
+		if seg.IsIndex {
+			elements[i] = strconv.Itoa(seg.Index)
+		} else {
+			elements[i] = seg.Key
+		}
+	}
+	return elements
+}
+
+// Decode parses a cell holding JSON. Cells that drivers already decoded, such as jsonb
+// maps from pgx, are returned as they are; strings and bytes are parsed. Numbers become
+// int64 when they are whole and fit, float64 otherwise.
+func Decode(cell any) (any, error) {
+	var raw []byte
+	switch v := cell.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return cell, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return numbers(doc), nil
+}
+
+func numbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, child := range v {
+			v[key] = numbers(child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = numbers(child)
+		}
+	}
+	return v
+}
+
+// Eval follows the path through a decoded document. It reports false when a key or index
+// is missing or the document has the wrong shape.
+func (p Path) Eval(doc any) (any, bool) {
+	for _, seg := range p {
+		if seg.IsIndex {
+			items, ok := doc.([]any)
+			if !ok || seg.Index >= len(items) {
+				return nil, false
+			}
+			doc = items[seg.Index]
+			continue
+		}
+		object, ok := doc.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if doc, ok = object[seg.Key]; !ok {
+			return nil, false
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,73 @@
+package jsonpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAndRender(t *testing.T) {
+	cases := map[string]struct {
+		path   Path
+		str    string
+		quoted string
+	}{
+		"$.address.lines[1]": {
+			path:   Path{{Key: "address"}, {Key: "lines"}, {Index: 1, IsIndex: true}},
+			str:    "$.address.lines[1]",
+			quoted: `$."address"."lines"[1]`,
+		},
+		`tags[0]["odd.key"]`: {
+			path:   Path{{Key: "tags"}, {Index: 0, IsIndex: true}, {Key: "odd.key"}},
+			str:    `$.tags[0]["odd.key"]`,
+			quoted: `$."tags"[0]."odd.key"`,
+		},
+		"$": {path: nil, str: "$", quoted: "$"},
+	}
+	for input, want := range cases {
+		path, err := Parse(input)
+		if err != nil {
+			t.Fatalf("%s: %v", input, err)
+		}
+		if !reflect.DeepEqual(path, want.path) {
+			t.Errorf("%s: parsed %#v", input, path)
+		}
+		if path.String() != want.str || path.Quoted() != want.quoted {
+			t.Errorf("%s: rendered %s and %s", input, path.String(), path.Quoted())
+		}
+	}
+	for _, bad := range []string{"$.", "$..a", "$[x]", "$[-1]", `$["a"`, "$[1"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestEvalOverDecodedCells(t *testing.T) {
+	doc, err := Decode(`{"user":{"name":"Ann","ids":[7,9007199254740993,1.5]}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]any{
+		"$.user.name":   "Ann",
+		"$.user.ids[1]": int64(9007199254740993),
+		"$.user.ids[2]": 1.5,
+	}
+	for input, want := range cases {
+		path, _ := Parse(input)
+		if got, ok := path.Eval(doc); !ok || got != want {
+			t.Errorf("%s = %#v (%v), want %#v", input, got, ok, want)
+		}
+	}
+	for _, missing := range []string{"$.user.email", "$.user.ids[3]", "$.user.name.first", "$[0]"} {
+		path, _ := Parse(missing)
+		if _, ok := path.Eval(doc); ok {
+			t.Errorf("%s: expected no value", missing)
+		}
+	}
+
+	// Cells a driver already decoded are used as they are.
+	decoded := map[string]any{"a": []any{true}}
+	if got, _ := Decode(decoded); !reflect.DeepEqual(got, decoded) {
+		t.Errorf("decoded cell changed to %#v", got)
+	}
+}
@@ -1,7 +1,6 @@
 package logging
 
 import (
-	"os"
 	"sync"
 
 	"github.com/rs/zerolog"
@@ -16,7 +15,7 @@ var (
 func Configure() zerolog.Logger {
 	initLogger.Do(func() {
 		zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
-		logger = zerolog.New(os.Stderr).
+		logger = zerolog.New(output).
 			With().
 			Timestamp().
 			Str("component", "core").
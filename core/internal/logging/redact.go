@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const redacted = "[redacted]"
+
+// redactingWriter replaces registered secrets in every log line before it reaches out.
+type redactingWriter struct {
+	out io.Writer
+
+	mu      sync.RWMutex
+	secrets map[string]int
+	// ordered lists the secrets longest first, so that a secret containing another one
+	// is replaced whole.
+	ordered [][]byte
+}
+
+var output = &redactingWriter{out: os.Stderr, secrets: make(map[string]int)}
+
+// Redact keeps secret out of the log output until the returned function is called. A
+// secret may be registered more than once; it stays redacted until every registration is
+// released.
+func Redact(secret string) (release func()) {
+	if secret == "" {
+		return func() {}
+	}
+	forms := []string{secret}
+	// Secrets logged as JSON string values appear escaped.
+	if quoted, err := json.Marshal(secret); err == nil {
+		if escaped := string(quoted[1 : len(quoted)-1]); escaped != secret {
+			forms = append(forms, escaped)
+		}
+	}
+
+	output.mu.Lock()
+	for _, form := range forms {
+		output.secrets[form]++
+	}
+	output.reorder()
+	output.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			output.mu.Lock()
+			defer output.mu.Unlock()
+			for _, form := range forms {
+				if output.secrets[form]--; output.secrets[form] <= 0 {
+					delete(output.secrets, form)
+				}
+			}
+			output.reorder()
+		})
+	}
+}
+
+func (w *redactingWriter) reorder() {
+	w.ordered = w.ordered[:0]
+	for secret := range w.secrets {
+		w.ordered = append(w.ordered, []byte(secret))
+	}
+	sort.Slice(w.ordered, func(i, j int) bool { return len(w.ordered[i]) > len(w.ordered[j]) })
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	line := p
+	for _, secret := range w.ordered {
+		if bytes.Contains(line, secret) {
+			line = bytes.ReplaceAll(line, secret, []byte(redacted))
+		}
+	}
+	w.mu.RUnlock()
+
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,31 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRedactReplacesSecretsUntilReleased(t *testing.T) {
+	var out bytes.Buffer
+	saved := output.out
+	output.out = &out
+	defer func() { output.out = saved }()
+
+	releaseDSN := Redact(`host=db password=s3cret"x`)
+	releasePassword := Redact(`s3cret"x`)
+	releaseAgain := Redact(`s3cret"x`)
+
+	_, _ = output.Write([]byte(`{"msg":"connect host=db password=s3cret\"x failed","pw":"s3cret\"x"}` + "\n"))
+	releaseDSN()
+	releasePassword()
+	_, _ = output.Write([]byte(`{"pw":"s3cret\"x"}` + "\n"))
+	releaseAgain()
+	_, _ = output.Write([]byte(`{"pw":"s3cret\"x"}` + "\n"))
+
+	want := `{"msg":"connect [redacted] failed","pw":"[redacted]"}` + "\n" +
+		`{"pw":"[redacted]"}` + "\n" +
+		`{"pw":"s3cret\"x"}` + "\n"
+	if out.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
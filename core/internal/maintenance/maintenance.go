@@ -0,0 +1,224 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Action is a maintenance command.
+type Action string
+
+const (
+	Vacuum        Action = "vacuum"
+	VacuumAnalyze Action = "vacuumAnalyze"
+	VacuumFull    Action = "vacuumFull"
+	Analyze       Action = "analyze"
+	Reindex       Action = "reindex"
+)
+
+// Conn is the subset of pgx.Conn used to run maintenance and watch its progress.
+type Conn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Target is a table to maintain.
+type Target struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+}
+
+func (t Target) String() string {
+	if t.Schema == "" {
+		return "public." + t.Table
+	}
+	return t.Schema + "." + t.Table
+}
+
+// Exclusive reports whether the action locks out readers and writers.
+func (a Action) Exclusive() bool {
+	return a == VacuumFull || a == Reindex
+}
+
+// Statement returns the command running action on target.
+func Statement(action Action, target Target) (string, error) {
+	if target.Table == "" {
+		return "", errors.New("table is required")
+	}
+	schema := target.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	name := pgx.Identifier{schema, target.Table}.Sanitize()
+	switch action {
+	case Vacuum:
+		return "VACUUM " + name, nil
+	case VacuumAnalyze:
+		return "VACUUM (ANALYZE) " + name, nil
+	case VacuumFull:
+		return "VACUUM (FULL) " + name, nil
+	case Analyze:
+		return "ANALYZE " + name, nil
+	case Reindex:
+		return "REINDEX TABLE " + name, nil
+	default:
+		return "", fmt.Errorf("unknown maintenance action %q", action)
+	}
+}
+
+// Progress is the state of the command running on one table.
+type Progress struct {
+	Target Target
+	// Index and Count place Target within the run.
+	Index int
+	Count int
+	// Phase is the server's name for the current phase, empty before it reports one.
+	Phase string
+	// Done and Total count blocks; Total is zero when unknown.
+	Done  int64
+	Total int64
+}
+
+// progressViews lists the pg_stat_progress_* views covering each action, as queries
+// returning the phase and the blocks processed and total for a backend pid. VACUUM FULL
+// reports through the CLUSTER view.
+var progressViews = map[Action][]string{
+	Vacuum:        {vacuumProgressSQL},
+	VacuumAnalyze: {vacuumProgressSQL, analyzeProgressSQL},
+	VacuumFull:    {clusterProgressSQL},
+	Analyze:       {analyzeProgressSQL},
+	Reindex:       {createIndexProgressSQL},
+}
+
+const (
+	vacuumProgressSQL      = `select phase, heap_blks_scanned, heap_blks_total from pg_stat_progress_vacuum where pid = $1`
+	analyzeProgressSQL     = `select phase, sample_blks_scanned, sample_blks_total from pg_stat_progress_analyze where pid = $1`
+	clusterProgressSQL     = `select phase, heap_blks_scanned, heap_blks_total from pg_stat_progress_cluster where pid = $1`
+	createIndexProgressSQL = `select phase, blocks_done, blocks_total from pg_stat_progress_create_index where pid = $1`
+)
+
+// Options tunes Run.
+type Options struct {
+	// LockTimeout bounds how long a command waits for its table lock, so that maintenance
+	// does not queue behind long transactions and block everyone queued after it.
+	LockTimeout time.Duration
+	// PollInterval is how often progress is read. Defaults to one second.
+	PollInterval time.Duration
+}
+
+// Run executes action on each target in turn on conn, reading progress through monitor,
+// a second connection, and passing it to report. It stops at the first failure and
+// returns how long each completed target took.
+func Run(ctx context.Context, conn, monitor Conn, action Action, targets []Target, opts Options, report func(Progress)) ([]time.Duration, error) {
+	statements := make([]string, len(targets))
+	for i, target := range targets {
+		statement, err := Statement(action, target)
+		if err != nil {
+			return nil, err
+		}
+		statements[i] = statement
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.LockTimeout > 0 {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET lock_timeout = %d", opts.LockTimeout.Milliseconds())); err != nil {
+			return nil, err
+		}
+	}
+
+	var pid int32
+	if err := scanOne(ctx, conn, "select pg_backend_pid()", nil, &pid); err != nil {
+		return nil, err
+	}
+
+	durations := make([]time.Duration, 0, len(targets))
+	for i, target := range targets {
+		progress := Progress{Target: target, Index: i, Count: len(targets)}
+		report(progress)
+
+		start := time.Now()
+		done := make(chan error, 1)
+		go func() {
+			_, err := conn.Exec(ctx, statements[i])
+			done <- err
+		}()
+		if err := watch(ctx, monitor, pid, progressViews[action], opts.PollInterval, done, func(phase string, blocks, total int64) {
+			progress.Phase, progress.Done, progress.Total = phase, blocks, total
+			report(progress)
+		}); err != nil {
+			return durations, fmt.Errorf("%s: %w", target, err)
+		}
+		durations = append(durations, time.Since(start))
+	}
+	return durations, nil
+}
+
+// watch polls the progress views for pid until done yields the command's result. Views
+// missing on older servers are skipped from then on.
+func watch(ctx context.Context, monitor Conn, pid int32, views []string, interval time.Duration, done <-chan error, update func(string, int64, int64)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	views = append([]string(nil), views...)
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+		}
+		for i := 0; i < len(views); i++ {
+			var (
+				phase         string
+				blocks, total int64
+			)
+			err := scanOne(ctx, monitor, views[i], []any{pid}, &phase, &blocks, &total)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				views = append(views[:i], views[i+1:]...)
+				i--
+				continue
+			}
+			update(phase, blocks, total)
+			break
+		}
+	}
+}
+
+func scanOne(ctx context.Context, conn Conn, query string, args []any, dest ...any) error {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// Describe formats progress for a job phase, such as "vacuum public.orders (2/3): scanning heap".
+func Describe(action Action, p Progress) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s (%d/%d)", action, p.Target, p.Index+1, p.Count)
+	if p.Phase != "" {
+		b.WriteString(": " + p.Phase)
+	}
+	return b.String()
+}
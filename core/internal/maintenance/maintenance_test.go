@@ -0,0 +1,155 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestStatementQuotesTargets(t *testing.T) {
+	got, err := Statement(VacuumAnalyze, Target{Table: `Order"s`})
+	if err != nil || got != `VACUUM (ANALYZE) "public"."Order""s"` {
+		t.Fatalf("unexpected statement %q, %v", got, err)
+	}
+	if got, _ := Statement(Reindex, Target{Schema: "sales", Table: "orders"}); got != `REINDEX TABLE "sales"."orders"` {
+		t.Fatalf("unexpected statement %q", got)
+	}
+	if _, err := Statement("truncate", Target{Table: "orders"}); err == nil {
+		t.Fatal("expected an unknown action to be refused")
+	}
+	if _, err := Statement(Analyze, Target{Schema: "sales"}); err == nil {
+		t.Fatal("expected a missing table to be refused")
+	}
+}
+
+// fakeConn answers pg_backend_pid() and the progress views, and blocks maintenance
+// statements until the test releases them.
+type fakeConn struct {
+	mu       sync.Mutex
+	execs    []string
+	polled   chan struct{}
+	release  chan struct{}
+	progress []any
+}
+
+func (c *fakeConn) Exec(ctx context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.mu.Lock()
+	c.execs = append(c.execs, sql)
+	c.mu.Unlock()
+	if strings.HasPrefix(sql, "VACUUM") {
+		select {
+		case <-c.release:
+		case <-ctx.Done():
+			return pgconn.CommandTag{}, ctx.Err()
+		}
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *fakeConn) Query(_ context.Context, sql string, _ ...any) (pgx.Rows, error) {
+	switch {
+	case strings.Contains(sql, "pg_backend_pid"):
+		return &fakeRows{values: [][]any{{int32(7)}}}, nil
+	case strings.Contains(sql, "pg_stat_progress_vacuum"):
+		select {
+		case c.polled <- struct{}{}:
+		default:
+		}
+		return &fakeRows{values: [][]any{c.progress}}, nil
+	default:
+		return nil, errors.New("relation does not exist")
+	}
+}
+
+type fakeRows struct {
+	pgx.Rows
+	values [][]any
+	row    []any
+}
+
+func (r *fakeRows) Close()     {}
+func (r *fakeRows) Err() error { return nil }
+
+func (r *fakeRows) Next() bool {
+	if len(r.values) == 0 {
+		return false
+	}
+	r.row, r.values = r.values[0], r.values[1:]
+	return true
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	for i, d := range dest {
+		switch d := d.(type) {
+		case *int32:
+			*d = r.row[i].(int32)
+		case *int64:
+			*d = r.row[i].(int64)
+		case *string:
+			*d = r.row[i].(string)
+		}
+	}
+	return nil
+}
+
+func TestRunReportsProgress(t *testing.T) {
+	conn := &fakeConn{release: make(chan struct{})}
+	monitor := &fakeConn{polled: make(chan struct{}, 1), progress: []any{"scanning heap", int64(40), int64(100)}}
+
+	var (
+		mu      sync.Mutex
+		reports []Progress
+	)
+	go func() {
+		<-monitor.polled
+		close(conn.release)
+	}()
+	targets := []Target{{Schema: "public", Table: "orders"}, {Schema: "public", Table: "items"}}
+	durations, err := Run(context.Background(), conn, monitor, Vacuum, targets,
+		Options{LockTimeout: 5 * time.Second, PollInterval: time.Millisecond},
+		func(p Progress) {
+			mu.Lock()
+			reports = append(reports, p)
+			mu.Unlock()
+		})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(durations) != 2 {
+		t.Fatalf("expected a duration per target, got %v", durations)
+	}
+	if conn.execs[0] != "SET lock_timeout = 5000" || conn.execs[1] != `VACUUM "public"."orders"` || conn.execs[2] != `VACUUM "public"."items"` {
+		t.Fatalf("unexpected statements %q", conn.execs)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var sawBlocks bool
+	for _, p := range reports {
+		if p.Phase == "scanning heap" && p.Done == 40 && p.Total == 100 {
+			sawBlocks = true
+			if got := Describe(Vacuum, p); !strings.HasPrefix(got, "vacuum public.") || !strings.HasSuffix(got, ": scanning heap") {
+				t.Fatalf("unexpected description %q", got)
+			}
+		}
+	}
+	if !sawBlocks || reports[0].Phase != "" || reports[0].Count != 2 {
+		t.Fatalf("unexpected progress %+v", reports)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	conn := &fakeConn{release: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	durations, err := Run(ctx, conn, &fakeConn{}, Vacuum, []Target{{Table: "orders"}}, Options{}, func(Progress) {})
+	if !errors.Is(err, context.Canceled) || len(durations) != 0 {
+		t.Fatalf("expected cancellation, got %v, %v", durations, err)
+	}
+}
@@ -0,0 +1,312 @@
+// Package masking redacts or hashes sensitive values in results read through restricted
+// connections, so that analysts can query tables holding personal data without seeing
+// it. Rules select columns by a schema.table.column pattern, or values by what they look
+// like (email addresses, US social security numbers, payment card and phone numbers)
+// whatever column they come from. NULLs are left as they are.
+//
+// Scan uses the same detectors to find the columns of a sample that likely hold personal
+// data, and suggests rules for them.
+package masking
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Actions a rule may take on a value.
+const (
+	// ActionRedact replaces the value with a fixed string.
+	ActionRedact = "redact"
+	// ActionHash replaces the value with a salted hash, so that equal values still
+	// compare equal for joins and grouping.
+	ActionHash = "hash"
+	// ActionPartial keeps the domain of email addresses and the last four characters of
+	// other values.
+	ActionPartial = "partial"
+)
+
+// Kinds of value a detect rule recognizes.
+const (
+	DetectEmail      = "email"
+	DetectSSN        = "ssn"
+	DetectCreditCard = "creditCard"
+	DetectPhone      = "phone"
+)
+
+// Redacted replaces values masked with ActionRedact.
+const Redacted = "****"
+
+// Rule masks the values of matching columns, or the values that look like Detect.
+type Rule struct {
+	// Column is a schema.table.column pattern whose parts may use path.Match wildcards.
+	// Shorter patterns match the trailing parts, so "email" matches every column named
+	// email. Columns whose table is unknown match with an empty schema and table.
+	Column string `json:"column,omitempty"`
+	// Detect is the kind of value masked in any column: email, ssn, creditCard or phone.
+	Detect string `json:"detect,omitempty"`
+	// Action is redact, hash or partial. It defaults to redact.
+	Action string `json:"action,omitempty"`
+}
+
+// Config is the JSON form of a policy.
+type Config struct {
+	Rules []Rule `json:"rules"`
+	// Salt is mixed into hashed values. Without one, hashes of short values such as social
+	// security numbers can be reversed by trying every value.
+	Salt string `json:"salt,omitempty"`
+}
+
+// Policy is a validated set of masking rules. A nil Policy masks nothing.
+type Policy struct {
+	columns []columnRule
+	detects []Rule
+	salt    string
+	// rules are the validated rules, for Config.
+	rules []Rule
+}
+
+type columnRule struct {
+	parts  [3]string
+	action string
+}
+
+var detectors = map[string]func(string) bool{
+	DetectEmail:      regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`).MatchString,
+	DetectSSN:        regexp.MustCompile(`^\d{3}-\d{2}-\d{4}$`).MatchString,
+	DetectCreditCard: isCardNumber,
+	DetectPhone:      isPhoneNumber,
+}
+
+// New validates cfg and returns its policy.
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{salt: cfg.Salt}
+	for i, rule := range cfg.Rules {
+		switch rule.Action {
+		case "":
+			rule.Action = ActionRedact
+		case ActionRedact, ActionHash, ActionPartial:
+		default:
+			return nil, fmt.Errorf("masking rule %d: unknown action %q", i+1, rule.Action)
+		}
+		switch {
+		case rule.Column != "" && rule.Detect != "":
+			return nil, fmt.Errorf("masking rule %d: set either column or detect", i+1)
+		case rule.Column != "":
+			parts := strings.Split(rule.Column, ".")
+			if len(parts) > 3 {
+				return nil, fmt.Errorf("masking rule %d: column pattern has more than three parts: %s", i+1, rule.Column)
+			}
+			c := columnRule{parts: [3]string{"*", "*", "*"}, action: rule.Action}
+			copy(c.parts[3-len(parts):], parts)
+			for _, part := range c.parts {
+				if _, err := path.Match(part, ""); err != nil {
+					return nil, fmt.Errorf("masking rule %d: %w", i+1, err)
+				}
+			}
+			p.columns = append(p.columns, c)
+		case rule.Detect != "":
+			if _, ok := detectors[rule.Detect]; !ok {
+				return nil, fmt.Errorf("masking rule %d: unknown detect kind %q", i+1, rule.Detect)
+			}
+			p.detects = append(p.detects, rule)
+		default:
+			return nil, fmt.Errorf("masking rule %d: column or detect is required", i+1)
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// Config returns the configuration of p, with default actions filled in.
+func (p *Policy) Config() Config {
+	if p == nil {
+		return Config{}
+	}
+	return Config{Rules: append([]Rule(nil), p.rules...), Salt: p.salt}
+}
+
+// Load reads a policy from a JSON file.
+func Load(filename string) (*Policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse masking policy %s: %w", filename, err)
+	}
+	return New(cfg)
+}
+
+// Column identifies a result column. Schema and Table are empty when the column's
+// table is unknown.
+type Column struct {
+	Name   string
+	Schema string
+	Table  string
+	Column string
+}
+
+// Plan masks the rows of one result.
+type Plan struct {
+	policy  *Policy
+	columns []string
+	actions []string
+	masked  []bool
+}
+
+// Plan prepares masking for a result with the given columns. It returns nil when the
+// policy is nil.
+func (p *Policy) Plan(columns []Column) *Plan {
+	if p == nil {
+		return nil
+	}
+	plan := &Plan{
+		policy:  p,
+		columns: make([]string, len(columns)),
+		actions: make([]string, len(columns)),
+		masked:  make([]bool, len(columns)),
+	}
+	for i, col := range columns {
+		plan.columns[i] = col.Name
+		name := col.Column
+		if name == "" {
+			name = col.Name
+		}
+		for _, rule := range p.columns {
+			if matchPart(rule.parts[0], col.Schema) && matchPart(rule.parts[1], col.Table) && matchPart(rule.parts[2], name) {
+				plan.actions[i] = rule.action
+				break
+			}
+		}
+	}
+	return plan
+}
+
+func matchPart(pattern, s string) bool {
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(s))
+	return ok
+}
+
+// Row masks the values of row in place.
+func (pl *Plan) Row(row []any) {
+	if pl == nil {
+		return
+	}
+	for i, value := range row {
+		if value == nil || i >= len(pl.actions) {
+			continue
+		}
+		action := pl.actions[i]
+		if action == "" {
+			s, ok := value.(string)
+			if !ok {
+				continue
+			}
+			for _, rule := range pl.policy.detects {
+				if detectors[rule.Detect](s) {
+					action = rule.Action
+					break
+				}
+			}
+			if action == "" {
+				continue
+			}
+		}
+		row[i] = pl.policy.mask(action, value)
+		pl.masked[i] = true
+	}
+}
+
+// Masked returns the names of the columns in which Row masked values.
+func (pl *Plan) Masked() []string {
+	if pl == nil {
+		return nil
+	}
+	var names []string
+	for i, masked := range pl.masked {
+		if masked {
+			names = append(names, pl.columns[i])
+		}
+	}
+	return names
+}
+
+func (p *Policy) mask(action string, value any) string {
+	s, ok := value.(string)
+	if !ok {
+		s = fmt.Sprint(value)
+	}
+	switch action {
+	case ActionHash:
+		sum := sha256.Sum256([]byte(p.salt + s))
+		return "hash:" + hex.EncodeToString(sum[:8])
+	case ActionPartial:
+		if at := strings.LastIndex(s, "@"); at > 0 {
+			return string([]rune(s)[:1]) + "***" + s[at:]
+		}
+		if runes := []rune(s); len(runes) > 4 {
+			return "***" + string(runes[len(runes)-4:])
+		}
+		return Redacted
+	default:
+		return Redacted
+	}
+}
+
+// isCardNumber reports whether s is 13 to 19 digits, optionally grouped by spaces or
+// hyphens, that pass the Luhn check.
+func isCardNumber(s string) bool {
+	var digits []int
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, int(r-'0'))
+		case r == ' ' || r == '-':
+		default:
+			return false
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+var notPhone = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}|\d{3}-\d{2}-\d{4}|\d+\.\d+)$`)
+
+// isPhoneNumber reports whether s is 7 to 15 digits written with a leading + or grouped
+// by spaces, hyphens, dots or parentheses. Dates, social security numbers and decimals
+// are not phone numbers.
+func isPhoneNumber(s string) bool {
+	digits, grouped := 0, false
+	for i, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+			grouped = true
+		case strings.ContainsRune(" -.()", r):
+			grouped = true
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15 && grouped && !notPhone.MatchString(s)
+}
@@ -0,0 +1,128 @@
+package masking
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanMasksMatchingColumns(t *testing.T) {
+	policy, err := New(Config{
+		Salt: "pepper",
+		Rules: []Rule{
+			{Column: "public.users.email", Action: ActionPartial},
+			{Column: "*.ssn"},
+			{Column: "api_*", Action: ActionHash},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := policy.Plan([]Column{
+		{Name: "id", Schema: "public", Table: "users", Column: "id"},
+		{Name: "contact", Schema: "public", Table: "users", Column: "email"},
+		{Name: "SSN"},
+		{Name: "api_key"},
+		{Name: "note", Schema: "audit", Table: "users", Column: "email"},
+	})
+	row := []any{int64(1), "jane@example.com", "123-45-6789", "secret", "kept"}
+	other := []any{int64(2), nil, nil, "secret", "kept"}
+	plan.Row(row)
+	plan.Row(other)
+
+	if row[0] != int64(1) || row[1] != "j***@example.com" || row[2] != Redacted || row[4] != "kept" {
+		t.Fatalf("row = %v", row)
+	}
+	if hash, ok := row[3].(string); !ok || !strings.HasPrefix(hash, "hash:") || hash != other[3] {
+		t.Fatalf("expected equal values to hash alike, got %v and %v", row[3], other[3])
+	}
+	if other[1] != nil {
+		t.Fatal("NULLs must stay NULL")
+	}
+	if got := plan.Masked(); !reflect.DeepEqual(got, []string{"contact", "SSN", "api_key"}) {
+		t.Fatalf("masked = %v", got)
+	}
+}
+
+func TestDetectRulesMaskValuesThatLookSensitive(t *testing.T) {
+	policy, err := New(Config{Rules: []Rule{
+		{Detect: DetectEmail, Action: ActionPartial},
+		{Detect: DetectSSN},
+		{Detect: DetectCreditCard, Action: ActionPartial},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := policy.Plan([]Column{{Name: "value"}})
+	cases := map[any]any{
+		"a.b@corp.io":         "a***@corp.io",
+		"078-05-1120":         Redacted,
+		"4111 1111 1111 1111": "***1111",
+		"4111 1111 1111 1112": "4111 1111 1111 1112",
+		"2024-01-31":          "2024-01-31",
+		int64(78051120):       int64(78051120),
+	}
+	for in, want := range cases {
+		row := []any{in}
+		plan.Row(row)
+		if row[0] != want {
+			t.Errorf("%v: got %v, want %v", in, row[0], want)
+		}
+	}
+}
+
+func TestNilPolicyMasksNothing(t *testing.T) {
+	var policy *Policy
+	plan := policy.Plan([]Column{{Name: "email"}})
+	row := []any{"jane@example.com"}
+	plan.Row(row)
+	if row[0] != "jane@example.com" || plan.Masked() != nil {
+		t.Fatal("a nil policy must not mask")
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []Rule{
+		{},
+		{Column: "email", Detect: DetectEmail},
+		{Column: "a.b.c.d"},
+		{Column: "[", Action: ActionHash},
+		{Detect: "iban"},
+		{Column: "email", Action: "shuffle"},
+	} {
+		if _, err := New(Config{Rules: []Rule{rule}}); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestScanReportsLikelyPersonalData(t *testing.T) {
+	findings := Scan("contactEmail", []any{"a@b.io", "c@d.org", nil, "not given", "e@f.net"})
+	if len(findings) != 1 || findings[0].Kind != DetectEmail || !findings[0].NameHint ||
+		findings[0].Matches != 3 || findings[0].Sampled != 4 || findings[0].Confidence != 0.79 {
+		t.Fatalf("findings = %+v", findings)
+	}
+	rule, ok := Suggest("public.users.contact_email", findings[0])
+	if !ok || rule != (Rule{Column: "public.users.contact_email", Action: ActionPartial}) {
+		t.Fatalf("suggested %+v, %v", rule, ok)
+	}
+
+	findings = Scan("ref", []any{"078-05-1120", "+1 (415) 555-0100", "4111-1111-1111-1111", "2024-01-31"})
+	kinds := make(map[string]int)
+	for _, f := range findings {
+		kinds[f.Kind] = f.Matches
+	}
+	if !reflect.DeepEqual(kinds, map[string]int{DetectSSN: 1, DetectPhone: 1, DetectCreditCard: 1}) {
+		t.Fatalf("findings = %+v", findings)
+	}
+
+	if findings := Scan("company", []any{"Acme", "Globex"}); len(findings) != 0 {
+		t.Fatalf("expected nothing in company names, got %+v", findings)
+	}
+	if findings := Scan("phone", []any{nil}); len(findings) != 1 || findings[0].Confidence != 0.3 {
+		t.Fatalf("an empty column named phone should be a weak finding, got %+v", findings)
+	}
+	if _, ok := Suggest("x", Finding{Kind: DetectPhone, Confidence: 0.3}); ok {
+		t.Fatal("weak findings must not suggest rules")
+	}
+}
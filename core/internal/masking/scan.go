@@ -0,0 +1,126 @@
+package masking
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// scanKinds are the kinds of personal data Scan looks for, in report order.
+var scanKinds = []string{DetectEmail, DetectPhone, DetectSSN, DetectCreditCard}
+
+// nameHints are column name words that suggest a kind of personal data.
+var nameHints = map[string][]string{
+	DetectEmail:      {"email", "e_mail", "mail"},
+	DetectPhone:      {"phone", "telephone", "mobile", "tel", "fax"},
+	DetectSSN:        {"ssn", "social_security", "national_id", "tax_id"},
+	DetectCreditCard: {"card", "credit_card", "cc", "pan"},
+}
+
+// suggestedActions are the actions Scan suggests per kind. Partial masking keeps enough of
+// an email address or number to tell values apart.
+var suggestedActions = map[string]string{
+	DetectEmail:      ActionPartial,
+	DetectPhone:      ActionPartial,
+	DetectSSN:        ActionRedact,
+	DetectCreditCard: ActionPartial,
+}
+
+// SuggestConfidence is the confidence from which Scan suggests a masking rule.
+const SuggestConfidence = 0.5
+
+// Finding reports that a column likely holds a kind of personal data.
+type Finding struct {
+	Kind string `json:"kind"`
+	// Confidence is between 0 and 1. It mostly follows the share of sampled values that
+	// look like Kind, raised when the column name suggests it.
+	Confidence float64 `json:"confidence"`
+	// Matches of the Sampled non-null values looked like Kind.
+	Matches int `json:"matches"`
+	Sampled int `json:"sampled"`
+	// NameHint is set when the column name suggests Kind.
+	NameHint bool `json:"nameHint,omitempty"`
+}
+
+// Scan inspects sample values of a column named name and returns the kinds of personal
+// data it likely holds, most likely first.
+func Scan(name string, values []any) []Finding {
+	counts := make(map[string]int)
+	sampled := 0
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		sampled++
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		s = strings.TrimSpace(s)
+		for _, kind := range scanKinds {
+			if detectors[kind](s) {
+				counts[kind]++
+				// A value is one kind of data; social security numbers also look like
+				// phone numbers to a lenient check.
+				break
+			}
+		}
+	}
+
+	var findings []Finding
+	for _, kind := range scanKinds {
+		f := Finding{Kind: kind, Matches: counts[kind], Sampled: sampled, NameHint: hinted(name, kind)}
+		switch {
+		case sampled > 0:
+			f.Confidence = 0.85 * float64(f.Matches) / float64(sampled)
+			if f.NameHint {
+				f.Confidence += 0.15
+			}
+		case f.NameHint:
+			f.Confidence = 0.3
+		}
+		if f.Matches == 0 && !f.NameHint {
+			continue
+		}
+		f.Confidence = math.Round(f.Confidence*100) / 100
+		findings = append(findings, f)
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Confidence > findings[j].Confidence })
+	return findings
+}
+
+// hinted reports whether the words of name, split at underscores, punctuation and
+// camelCase, include a hint for kind.
+func hinted(name, kind string) bool {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	words := "_" + b.String() + "_"
+	for _, hint := range nameHints[kind] {
+		if strings.Contains(words, "_"+hint+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggest returns a masking rule for the column pattern when finding is confident
+// enough, and false otherwise.
+func Suggest(pattern string, finding Finding) (Rule, bool) {
+	if finding.Confidence < SuggestConfidence {
+		return Rule{}, false
+	}
+	return Rule{Column: pattern, Action: suggestedActions[finding.Kind]}, true
+}
@@ -0,0 +1,126 @@
+package partfetch
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// compareValues orders decoded values the way Postgres orders them for ascending keys:
+// NULLs last and text by bytes, which the C collation requested for text keys matches.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	switch x := a.(type) {
+	case int64:
+		if y, ok := toInt(b); ok {
+			return cmp.Compare(x, y)
+		}
+	case int32:
+		if y, ok := toInt(b); ok {
+			return cmp.Compare(int64(x), y)
+		}
+	case int16:
+		if y, ok := toInt(b); ok {
+			return cmp.Compare(int64(x), y)
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmp.Compare(x, y)
+		}
+	case float32:
+		if y, ok := b.(float32); ok {
+			return cmp.Compare(x, y)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			default:
+				return 1
+			}
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y)
+		}
+	case pgtype.Numeric:
+		if y, ok := b.(pgtype.Numeric); ok {
+			return compareNumeric(x, y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// compareNumeric compares finite numerics exactly; NaN and infinities sort as Postgres
+// does, with NaN above everything.
+func compareNumeric(a, b pgtype.Numeric) int {
+	rank := func(n pgtype.Numeric) int {
+		switch {
+		case n.NaN:
+			return 2
+		case n.InfinityModifier == pgtype.Infinity:
+			return 1
+		case n.InfinityModifier == pgtype.NegativeInfinity:
+			return -1
+		}
+		return 0
+	}
+	if ra, rb := rank(a), rank(b); ra != 0 || rb != 0 {
+		return cmp.Compare(ra, rb)
+	}
+	return numericRat(a).Cmp(numericRat(b))
+}
+
+func numericRat(n pgtype.Numeric) *big.Rat {
+	if n.Int == nil {
+		return new(big.Rat)
+	}
+	r := new(big.Rat).SetInt(n.Int)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(n.Exp))), nil)
+	if n.Exp >= 0 {
+		return r.Mul(r, new(big.Rat).SetInt(scale))
+	}
+	return r.Quo(r, new(big.Rat).SetInt(scale))
+}
+
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,365 @@
+// Package partfetch reads a Postgres table with one query per leaf partition, run
+// concurrently over pooled connections, and merges the partitions' rows back into the
+// requested order.
+package partfetch
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/rowbuf"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Conn is the subset of a pooled pgx connection used to read partitions.
+type Conn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Acquirer hands out a connection and the function that returns it.
+type Acquirer func(ctx context.Context) (Conn, func(), error)
+
+// OrderKey sorts the merged rows by a column.
+type OrderKey struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc,omitempty"`
+}
+
+// Request describes the rows to read.
+type Request struct {
+	Schema string
+	Table  string
+	// Columns to select; empty selects every column.
+	Columns []string
+	// Where is an optional SQL predicate applied to every partition.
+	Where   string
+	OrderBy []OrderKey
+	// Limit caps the merged rows; zero reads everything.
+	Limit int
+	// Workers is how many partitions are read at once. With one worker the table is read
+	// with a single query.
+	Workers int
+}
+
+// Result holds the merged rows as decoded by pgx, not yet normalized for JSON.
+type Result struct {
+	Fields     []pgconn.FieldDescription
+	Rows       [][]any
+	Partitions int
+}
+
+// Fetch reads the table described by req.
+func Fetch(ctx context.Context, acquire Acquirer, req Request) (Result, error) {
+	if req.Table == "" {
+		return Result{}, errors.New("table is required")
+	}
+	if req.Schema == "" {
+		req.Schema = "public"
+	}
+	table := pgx.Identifier{req.Schema, req.Table}.Sanitize()
+
+	partitions := []string{table}
+	collatable := map[string]bool{}
+	if req.Workers > 1 || len(req.OrderBy) > 0 {
+		conn, release, err := acquire(ctx)
+		if err != nil {
+			return Result{}, err
+		}
+		if req.Workers > 1 {
+			partitions, err = leafPartitions(ctx, conn, table)
+		}
+		if err == nil && len(req.OrderBy) > 0 {
+			collatable, err = collatableColumns(ctx, conn, table, req.OrderBy)
+		}
+		release()
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	workers := req.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	parts := make([]partition, len(partitions))
+	var (
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, workers)
+		errs = make([]error, len(partitions))
+	)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i, name := range partitions {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			parts[i], errs[i] = readPartition(ctx, acquire, partitionSQL(name, req, collatable))
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, name)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return Result{}, fmt.Errorf("%s: %w", partitions[i], err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Fields: parts[0].fields, Partitions: len(partitions)}
+	keys, err := keyColumns(result.Fields, req.OrderBy)
+	if err != nil {
+		return Result{}, err
+	}
+	result.Rows = merge(parts, keys, req.Limit)
+	return result, nil
+}
+
+// leafPartitions lists the leaf partitions of table, or table itself when it is not
+// partitioned.
+func leafPartitions(ctx context.Context, conn Conn, table string) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+select format('%I.%I', n.nspname, c.relname)
+from pg_partition_tree($1::regclass) t
+join pg_class c on c.oid = t.relid
+join pg_namespace n on n.oid = c.relnamespace
+where t.isleaf and c.relkind <> 'p'
+order by c.oid`, table)
+	if err != nil {
+		return nil, err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return []string{table}, nil
+	}
+	return names, nil
+}
+
+// collatableColumns reports which order keys are text-like. They are sorted with the C
+// collation so that the byte order of the merge agrees with each partition's ORDER BY.
+func collatableColumns(ctx context.Context, conn Conn, table string, keys []OrderKey) (map[string]bool, error) {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Column
+	}
+	rows, err := conn.Query(ctx, `
+select attname::text from pg_attribute
+where attrelid = $1::regclass and attname = any($2) and attcollation <> 0`, table, names)
+	if err != nil {
+		return nil, err
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	collatable := make(map[string]bool, len(found))
+	for _, name := range found {
+		collatable[name] = true
+	}
+	return collatable, nil
+}
+
+func partitionSQL(table string, req Request, collatable map[string]bool) string {
+	var b strings.Builder
+	b.WriteString("SELECT ")
+	if len(req.Columns) == 0 {
+		b.WriteString("*")
+	}
+	for i, column := range req.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(pgx.Identifier{column}.Sanitize())
+	}
+	b.WriteString(" FROM " + table)
+	if req.Where != "" {
+		b.WriteString(" WHERE (" + req.Where + ")")
+	}
+	for i, key := range req.OrderBy {
+		if i == 0 {
+			b.WriteString(" ORDER BY ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(pgx.Identifier{key.Column}.Sanitize())
+		if collatable[key.Column] {
+			b.WriteString(` COLLATE "C"`)
+		}
+		if key.Desc {
+			b.WriteString(" DESC")
+		}
+	}
+	// Each partition can contribute at most the whole limit.
+	if req.Limit > 0 {
+		b.WriteString(" LIMIT " + strconv.Itoa(req.Limit))
+	}
+	return b.String()
+}
+
+type partition struct {
+	fields []pgconn.FieldDescription
+	rows   [][]any
+}
+
+func readPartition(ctx context.Context, acquire Acquirer, sql string) (partition, error) {
+	conn, release, err := acquire(ctx)
+	if err != nil {
+		return partition{}, err
+	}
+	defer release()
+
+	rows, err := conn.Query(ctx, sql)
+	if err != nil {
+		return partition{}, err
+	}
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	var typeMap *pgtype.Map
+	if c := rows.Conn(); c != nil {
+		typeMap = c.TypeMap()
+	} else {
+		typeMap = pgtype.NewMap()
+	}
+	decoder := rowbuf.NewDecoder(typeMap, fields, rowbuf.NewInterner(rowbuf.DefaultInternMaxLen, rowbuf.DefaultInternMaxEntries))
+	cells := rowbuf.NewBatch(len(fields), 256)
+	for rows.Next() {
+		row := cells.NewRow()
+		if err := decoder.Decode(rows.RawValues(), row); err != nil {
+			return partition{}, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return partition{}, err
+	}
+	return partition{fields: fields, rows: cells.Rows()}, nil
+}
+
+type sortKey struct {
+	index int
+	desc  bool
+}
+
+func keyColumns(fields []pgconn.FieldDescription, order []OrderKey) ([]sortKey, error) {
+	keys := make([]sortKey, len(order))
+	for i, key := range order {
+		keys[i].index, keys[i].desc = -1, key.Desc
+		for j, field := range fields {
+			if field.Name == key.Column {
+				keys[i].index = j
+				break
+			}
+		}
+		if keys[i].index < 0 {
+			return nil, fmt.Errorf("order column %q is not selected", key.Column)
+		}
+	}
+	return keys, nil
+}
+
+// merge concatenates the partitions in order, or interleaves their sorted rows when keys
+// are given.
+func merge(parts []partition, keys []sortKey, limit int) [][]any {
+	total := 0
+	for _, part := range parts {
+		total += len(part.rows)
+	}
+	if limit > 0 && total > limit {
+		total = limit
+	}
+	merged := make([][]any, 0, total)
+	if len(keys) == 0 {
+		for _, part := range parts {
+			for _, row := range part.rows {
+				if len(merged) == total {
+					return merged
+				}
+				merged = append(merged, row)
+			}
+		}
+		return merged
+	}
+
+	h := &mergeHeap{keys: keys}
+	for i, part := range parts {
+		if len(part.rows) > 0 {
+			h.cursors = append(h.cursors, cursor{part: i, rows: part.rows})
+		}
+	}
+	heap.Init(h)
+	for h.Len() > 0 && len(merged) < total {
+		c := &h.cursors[0]
+		merged = append(merged, c.rows[0])
+		c.rows = c.rows[1:]
+		if len(c.rows) == 0 {
+			heap.Pop(h)
+		} else {
+			heap.Fix(h, 0)
+		}
+	}
+	return merged
+}
+
+type cursor struct {
+	part int
+	rows [][]any
+}
+
+type mergeHeap struct {
+	keys    []sortKey
+	cursors []cursor
+}
+
+func (h *mergeHeap) Len() int { return len(h.cursors) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	if c := compareRows(a.rows[0], b.rows[0], h.keys); c != 0 {
+		return c < 0
+	}
+	// Equal keys keep partition order, so the merge is deterministic.
+	return a.part < b.part
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x any) { h.cursors = append(h.cursors, x.(cursor)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
+
+func compareRows(a, b []any, keys []sortKey) int {
+	for _, key := range keys {
+		c := compareValues(a[key.index], b[key.index])
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package partfetch
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestPartitionSQL(t *testing.T) {
+	req := Request{
+		Columns: []string{"id", `Name"x`},
+		Where:   "id > 10",
+		OrderBy: []OrderKey{{Column: "Name\"x"}, {Column: "id", Desc: true}},
+		Limit:   50,
+	}
+	got := partitionSQL(`"sales"."orders_2024"`, req, map[string]bool{`Name"x`: true})
+	want := `SELECT "id", "Name""x" FROM "sales"."orders_2024" WHERE (id > 10) ORDER BY "Name""x" COLLATE "C", "id" DESC LIMIT 50`
+	if got != want {
+		t.Fatalf("unexpected SQL\n got: %s\nwant: %s", got, want)
+	}
+	if got := partitionSQL(`"public"."t"`, Request{}, nil); got != `SELECT * FROM "public"."t"` {
+		t.Fatalf("unexpected SQL %s", got)
+	}
+}
+
+func TestMergeInterleavesSortedPartitions(t *testing.T) {
+	parts := []partition{
+		{rows: [][]any{{int64(1), "a"}, {int64(4), "a"}, {nil, "a"}}},
+		{rows: [][]any{{int64(2), "b"}, {int64(4), "b"}}},
+		{},
+		{rows: [][]any{{int64(3), "c"}}},
+	}
+	got := merge(parts, []sortKey{{index: 0}}, 0)
+	want := [][]any{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "c"}, {int64(4), "a"}, {int64(4), "b"}, {nil, "a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected merge %v", got)
+	}
+
+	got = merge(parts, []sortKey{{index: 0, desc: true}}, 2)
+	if len(got) != 2 {
+		t.Fatalf("expected the limit to apply, got %v", got)
+	}
+}
+
+func TestMergeConcatenatesWithoutKeys(t *testing.T) {
+	parts := []partition{
+		{rows: [][]any{{1}, {2}}},
+		{rows: [][]any{{3}}},
+	}
+	if got := merge(parts, nil, 0); !reflect.DeepEqual(got, [][]any{{1}, {2}, {3}}) {
+		t.Fatalf("unexpected merge %v", got)
+	}
+	if got := merge(parts, nil, 2); !reflect.DeepEqual(got, [][]any{{1}, {2}}) {
+		t.Fatalf("unexpected merge %v", got)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		a, b any
+		want int
+	}{
+		{int32(1), int64(2), -1},
+		{2.5, int64(2), 1},
+		{"b", "a", 1},
+		{[]byte("a"), []byte("a"), 0},
+		{false, true, -1},
+		{early, early.Add(time.Second), -1},
+		{pgtype.Numeric{Int: big.NewInt(15), Exp: -1, Valid: true}, pgtype.Numeric{Int: big.NewInt(2), Valid: true}, -1},
+		{nil, int64(1), 1},
+		{int64(1), nil, -1},
+		{nil, nil, 0},
+	}
+	for _, c := range cases {
+		if got := compareValues(c.a, c.b); got != c.want {
+			t.Errorf("compareValues(%v, %v) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
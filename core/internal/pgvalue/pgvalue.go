@@ -0,0 +1,160 @@
+// Package pgvalue gives Postgres types that have no natural JSON form a structured
+// encoding: intervals as ISO 8601 durations, ranges as their bounds, bit strings as
+// digits and money as a decimal number.
+package pgvalue
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MoneyOID is the type OID of money, which pgx has no codec for and returns as the
+// server's locale-formatted text.
+const MoneyOID = 790
+
+// Interval renders an interval as an ISO 8601 duration the way Postgres does with
+// intervalstyle iso_8601, for example P1Y2M3DT4H5M6.5S. Each field carries its own sign.
+func Interval(v pgtype.Interval) string {
+	var b strings.Builder
+	b.WriteString("P")
+	field := func(n int64, unit byte) {
+		if n != 0 {
+			b.WriteString(strconv.FormatInt(n, 10))
+			b.WriteByte(unit)
+		}
+	}
+	field(int64(v.Months/12), 'Y')
+	field(int64(v.Months%12), 'M')
+	field(int64(v.Days), 'D')
+
+	if us := v.Microseconds; us != 0 {
+		b.WriteString("T")
+		sign := int64(1)
+		if us < 0 {
+			sign, us = -1, -us
+		}
+		field(sign*(us/3_600_000_000), 'H')
+		field(sign*(us/60_000_000%60), 'M')
+		if seconds := us % 60_000_000; seconds != 0 {
+			if sign < 0 {
+				b.WriteString("-")
+			}
+			b.WriteString(strconv.FormatInt(seconds/1_000_000, 10))
+			if frac := seconds % 1_000_000; frac != 0 {
+				b.WriteString("." + strings.TrimRight(strconv.FormatInt(1_000_000+frac, 10)[1:], "0"))
+			}
+			b.WriteString("S")
+		}
+	}
+	if b.Len() == 1 {
+		return "PT0S"
+	}
+	return b.String()
+}
+
+// Bits renders a bit or bit varying value as its digits, such as "10110".
+func Bits(v pgtype.Bits) string {
+	digits := make([]byte, v.Len)
+	for i := range digits {
+		digits[i] = '0'
+		if v.Bytes[i/8]&(0x80>>(i%8)) != 0 {
+			digits[i] = '1'
+		}
+	}
+	return string(digits)
+}
+
+// Range is a range value. Unbounded ends are null, and Bounds spells which ends are
+// inclusive the way Postgres does, as in "[)".
+type Range struct {
+	Lower  any    `json:"lower"`
+	Upper  any    `json:"upper"`
+	Bounds string `json:"bounds"`
+	Empty  bool   `json:"empty,omitempty"`
+}
+
+// NewRange converts a decoded range, passing its bounds through normalize.
+func NewRange(v pgtype.Range[any], normalize func(any) any) Range {
+	if v.LowerType == pgtype.Empty {
+		return Range{Bounds: "()", Empty: true}
+	}
+	r := Range{Bounds: "()"}
+	if v.LowerType != pgtype.Unbounded {
+		r.Lower = normalize(v.Lower)
+	}
+	if v.UpperType != pgtype.Unbounded {
+		r.Upper = normalize(v.Upper)
+	}
+	if v.LowerType == pgtype.Inclusive {
+		r.Bounds = "[" + r.Bounds[1:]
+	}
+	if v.UpperType == pgtype.Inclusive {
+		r.Bounds = r.Bounds[:1] + "]"
+	}
+	return r
+}
+
+// NewMultirange converts a decoded multirange into its ranges.
+func NewMultirange(v pgtype.Multirange[pgtype.Range[any]], normalize func(any) any) []Range {
+	ranges := make([]Range, len(v))
+	for i, r := range v {
+		ranges[i] = NewRange(r, normalize)
+	}
+	return ranges
+}
+
+// Money parses the locale-formatted text of a money value, such as "$1,234.56",
+// "-1.234,56 €" or "($5.00)", into a plain decimal. The decimal separator is the last
+// '.' or ',' unless it appears more than once or is followed by exactly three digits,
+// which marks a group separator, as in "¥1,234".
+func Money(text string) (string, bool) {
+	s := strings.TrimSpace(text)
+	negative := strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+	var cleaned []byte
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case isDigit(c):
+			cleaned = append(cleaned, c)
+			digits++
+		case c == '.' || c == ',':
+			// Only separators between digits count, not the dot of "Fr." or "kr.".
+			if i > 0 && isDigit(s[i-1]) && i+1 < len(s) && isDigit(s[i+1]) {
+				cleaned = append(cleaned, c)
+			}
+		case c == '-':
+			negative = true
+		}
+	}
+	if digits == 0 {
+		return "", false
+	}
+
+	whole, frac := string(cleaned), ""
+	if last := strings.LastIndexAny(whole, ".,"); last >= 0 {
+		sep := whole[last]
+		tail := whole[last+1:]
+		mixed := strings.ContainsAny(whole[:last], ".,") && strings.IndexByte(whole[:last], sep) < 0
+		if mixed || (strings.Count(whole, string(sep)) == 1 && len(tail) != 3) {
+			whole, frac = whole[:last], tail
+		}
+	}
+	whole = strings.NewReplacer(".", "", ",", "").Replace(whole)
+	if whole == "" {
+		whole = "0"
+	}
+	value := whole
+	if frac != "" {
+		value += "." + frac
+	}
+	if negative {
+		value = "-" + value
+	}
+	return value, true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
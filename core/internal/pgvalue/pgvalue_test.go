@@ -0,0 +1,70 @@
+package pgvalue
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestIntervalMatchesPostgresISOStyle(t *testing.T) {
+	cases := []struct {
+		in   pgtype.Interval
+		want string
+	}{
+		{pgtype.Interval{}, "PT0S"},
+		{pgtype.Interval{Months: 14, Days: 3, Microseconds: 4*3_600_000_000 + 5*60_000_000 + 6_500_000}, "P1Y2M3DT4H5M6.5S"},
+		{pgtype.Interval{Months: -14, Days: 3, Microseconds: -(4*3_600_000_000 + 6_000_000)}, "P-1Y-2M3DT-4H-6S"},
+		{pgtype.Interval{Microseconds: 1}, "PT0.000001S"},
+		{pgtype.Interval{Days: 1}, "P1D"},
+	}
+	for _, tc := range cases {
+		if got := Interval(tc.in); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBits(t *testing.T) {
+	if got := Bits(pgtype.Bits{Bytes: []byte{0xb4, 0x80}, Len: 9, Valid: true}); got != "101101001" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestNewRange(t *testing.T) {
+	identity := func(v any) any { return v }
+	cases := []struct {
+		in   pgtype.Range[any]
+		want Range
+	}{
+		{pgtype.Range[any]{Lower: int32(1), Upper: int32(10), LowerType: pgtype.Inclusive, UpperType: pgtype.Exclusive}, Range{Lower: int32(1), Upper: int32(10), Bounds: "[)"}},
+		{pgtype.Range[any]{Upper: int32(5), LowerType: pgtype.Unbounded, UpperType: pgtype.Inclusive}, Range{Upper: int32(5), Bounds: "(]"}},
+		{pgtype.Range[any]{LowerType: pgtype.Empty, UpperType: pgtype.Empty}, Range{Bounds: "()", Empty: true}},
+	}
+	for _, tc := range cases {
+		if got := NewRange(tc.in, identity); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%+v: got %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestMoneyReadsLocaleFormats(t *testing.T) {
+	cases := map[string]string{
+		"$1,234.56":   "1234.56",
+		"-$1,234.56":  "-1234.56",
+		"($5.00)":     "-5.00",
+		"1.234,56 €":  "1234.56",
+		"¥1,234":      "1234",
+		"$1,000,000":  "1000000",
+		"Fr. 1'234.5": "1234.5",
+		"$0.07":       "0.07",
+	}
+	for in, want := range cases {
+		if got, ok := Money(in); !ok || got != want {
+			t.Errorf("%q: got %q, %v, want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := Money("n/a"); ok {
+		t.Error("expected text without digits to be refused")
+	}
+}
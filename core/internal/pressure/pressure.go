@@ -0,0 +1,254 @@
+package pressure
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Resources named in events and errors.
+const (
+	Memory  = "memory"
+	Streams = "streams"
+)
+
+// Levels reported in events.
+const (
+	LevelHigh   = "high"
+	LevelNormal = "normal"
+)
+
+// recoverRatio is the fraction of MaxRSS that memory must fall below before pressure is
+// reported as ended, so that a process hovering at the limit does not flap.
+const recoverRatio = 0.9
+
+// minReliefInterval spaces out cache relief, which forces a full garbage collection.
+const minReliefInterval = time.Second
+
+// Limits are the ceilings the process protects itself with. Zero disables a limit.
+type Limits struct {
+	// MaxRSS is the resident memory, in bytes, above which heavy requests are refused.
+	MaxRSS uint64
+	// MaxStreams caps the streaming queries running at once across all clients.
+	MaxStreams int
+}
+
+// Event describes a change of pressure on one resource.
+type Event struct {
+	Resource    string `json:"resource,omitempty"`
+	Level       string `json:"level"`
+	RSSBytes    uint64 `json:"rssBytes"`
+	MaxRSSBytes uint64 `json:"maxRssBytes,omitempty"`
+	Streams     int    `json:"streams"`
+	MaxStreams  int    `json:"maxStreams,omitempty"`
+	// FreedBytes is how much relief released, when it ran.
+	FreedBytes uint64 `json:"freedBytes,omitempty"`
+}
+
+// ExhaustedError is returned when a request would exceed a limit.
+type ExhaustedError struct {
+	Resource string
+	Current  uint64
+	Limit    uint64
+}
+
+func (e *ExhaustedError) Error() string {
+	if e.Resource == Memory {
+		return fmt.Sprintf("memory use of %d MiB is over the %d MiB limit", e.Current>>20, e.Limit>>20)
+	}
+	return fmt.Sprintf("%d of %d concurrent streams are running", e.Current, e.Limit)
+}
+
+// Guard enforces Limits. Heavy requests call Admit before they start and streams hold a
+// slot from AcquireStream while they run. When memory runs over, the guard first calls
+// the registered relief functions, typically cache clears, and only refuses requests if
+// that did not bring memory back under the limit.
+type Guard struct {
+	limits Limits
+	notify func(Event)
+	rss    func() (uint64, error)
+	now    func() time.Time
+
+	mu          sync.Mutex
+	relief      []func()
+	streams     int
+	memoryHigh  bool
+	streamsHigh bool
+	lastRelief  time.Time
+}
+
+// New constructs a guard that reports pressure changes to notify, which may be nil.
+func New(limits Limits, notify func(Event)) *Guard {
+	if notify == nil {
+		notify = func(Event) {}
+	}
+	return &Guard{limits: limits, notify: notify, rss: residentBytes, now: time.Now}
+}
+
+// OnPressure registers a function that releases memory, called when memory is over the
+// limit.
+func (g *Guard) OnPressure(relieve func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.relief = append(g.relief, relieve)
+}
+
+// Admit reports whether a heavy request may start, returning an *ExhaustedError if not.
+func (g *Guard) Admit() error {
+	if g.limits.MaxRSS == 0 {
+		return nil
+	}
+	if g.check() {
+		return nil
+	}
+	rss, _ := g.rss()
+	return &ExhaustedError{Resource: Memory, Current: rss, Limit: g.limits.MaxRSS}
+}
+
+// AcquireStream takes a stream slot. The returned function gives it back.
+func (g *Guard) AcquireStream() (release func(), err error) {
+	g.mu.Lock()
+	if g.limits.MaxStreams > 0 && g.streams >= g.limits.MaxStreams {
+		event, changed := g.streamsEventLocked(true)
+		current := g.streams
+		g.mu.Unlock()
+		if changed {
+			g.notify(event)
+		}
+		return nil, &ExhaustedError{Resource: Streams, Current: uint64(current), Limit: uint64(g.limits.MaxStreams)}
+	}
+	g.streams++
+	g.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			g.mu.Lock()
+			g.streams--
+			event, changed := g.streamsEventLocked(false)
+			g.mu.Unlock()
+			if changed {
+				g.notify(event)
+			}
+		})
+	}, nil
+}
+
+// Watch samples memory every interval until ctx is done, so that caches are released and
+// clients warned before a request is refused. It returns at once without a memory limit.
+func (g *Guard) Watch(ctx context.Context, interval time.Duration) {
+	if g.limits.MaxRSS == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.check()
+		}
+	}
+}
+
+// Stats returns the current use of each resource.
+func (g *Guard) Stats() Event {
+	rss, _ := g.rss()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	level := LevelNormal
+	if g.memoryHigh || g.streamsHigh {
+		level = LevelHigh
+	}
+	return Event{
+		Level:       level,
+		RSSBytes:    rss,
+		MaxRSSBytes: g.limits.MaxRSS,
+		Streams:     g.streams,
+		MaxStreams:  g.limits.MaxStreams,
+	}
+}
+
+// check samples memory, relieves it when over the limit and reports whether it is under.
+func (g *Guard) check() bool {
+	rss, err := g.rss()
+	if err != nil {
+		return true
+	}
+	if rss <= g.limits.MaxRSS {
+		g.setMemory(rss, false, 0)
+		return true
+	}
+
+	g.mu.Lock()
+	relief := append([]func(){}, g.relief...)
+	due := g.now().Sub(g.lastRelief) >= minReliefInterval
+	if due {
+		g.lastRelief = g.now()
+	}
+	g.mu.Unlock()
+
+	var freed uint64
+	if due {
+		for _, relieve := range relief {
+			relieve()
+		}
+		debug.FreeOSMemory()
+		if after, err := g.rss(); err == nil {
+			if after < rss {
+				freed = rss - after
+			}
+			rss = after
+		}
+	}
+	over := rss > g.limits.MaxRSS
+	g.setMemory(rss, over, freed)
+	return !over
+}
+
+// setMemory records the memory state and notifies on a change. Pressure ends once memory
+// is back under recoverRatio of the limit.
+func (g *Guard) setMemory(rss uint64, over bool, freed uint64) {
+	g.mu.Lock()
+	high := g.memoryHigh
+	switch {
+	case over:
+		high = true
+	case float64(rss) < float64(g.limits.MaxRSS)*recoverRatio:
+		high = false
+	}
+	changed := high != g.memoryHigh
+	g.memoryHigh = high
+	event := g.eventLocked(Memory, high, rss)
+	g.mu.Unlock()
+
+	event.FreedBytes = freed
+	if changed {
+		g.notify(event)
+	}
+}
+
+func (g *Guard) streamsEventLocked(high bool) (Event, bool) {
+	changed := high != g.streamsHigh
+	g.streamsHigh = high
+	rss, _ := g.rss()
+	return g.eventLocked(Streams, high, rss), changed
+}
+
+func (g *Guard) eventLocked(resource string, high bool, rss uint64) Event {
+	level := LevelNormal
+	if high {
+		level = LevelHigh
+	}
+	return Event{
+		Resource:    resource,
+		Level:       level,
+		RSSBytes:    rss,
+		MaxRSSBytes: g.limits.MaxRSS,
+		Streams:     g.streams,
+		MaxStreams:  g.limits.MaxStreams,
+	}
+}
@@ -0,0 +1,90 @@
+package pressure
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGuardRelievesMemoryBeforeRefusing(t *testing.T) {
+	var events []Event
+	g := New(Limits{MaxRSS: 100}, func(e Event) { events = append(events, e) })
+	rss := uint64(150)
+	g.rss = func() (uint64, error) { return rss, nil }
+	now := time.Unix(0, 0)
+	g.now = func() time.Time { return now }
+
+	// Relief brings memory back under the limit, so the request is admitted.
+	g.OnPressure(func() { rss = 95 })
+	if err := g.Admit(); err != nil {
+		t.Fatalf("expected relief to admit the request, got %v", err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no pressure event, got %+v", events)
+	}
+
+	// Relief that frees nothing leads to a refusal and a single event.
+	rss = 150
+	g.relief = []func(){func() {}}
+	now = now.Add(time.Minute)
+	err := g.Admit()
+	var exhausted *ExhaustedError
+	if !errors.As(err, &exhausted) || exhausted.Resource != Memory || exhausted.Limit != 100 {
+		t.Fatalf("expected a memory refusal, got %v", err)
+	}
+	if err := g.Admit(); err == nil {
+		t.Fatal("expected the refusal to persist")
+	}
+	if len(events) != 1 || events[0].Level != LevelHigh || events[0].Resource != Memory {
+		t.Fatalf("expected one high event, got %+v", events)
+	}
+
+	// Pressure ends only once memory is well under the limit.
+	rss = 95
+	if err := g.Admit(); err != nil {
+		t.Fatalf("expected admission under the limit, got %v", err)
+	}
+	rss = 80
+	g.Admit()
+	if len(events) != 2 || events[1].Level != LevelNormal {
+		t.Fatalf("expected a recovery event, got %+v", events)
+	}
+}
+
+func TestGuardLimitsStreams(t *testing.T) {
+	var events []Event
+	g := New(Limits{MaxStreams: 1}, func(e Event) { events = append(events, e) })
+	g.rss = func() (uint64, error) { return 0, nil }
+
+	release, err := g.AcquireStream()
+	if err != nil {
+		t.Fatalf("AcquireStream: %v", err)
+	}
+	if _, err := g.AcquireStream(); err == nil {
+		t.Fatal("expected the second stream to be refused")
+	}
+	if stats := g.Stats(); stats.Streams != 1 || stats.Level != LevelHigh {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	release()
+	release()
+	if _, err := g.AcquireStream(); err != nil {
+		t.Fatalf("expected the released slot to be available, got %v", err)
+	}
+	if len(events) != 2 || events[0].Level != LevelHigh || events[1].Level != LevelNormal || events[1].Resource != Streams {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestGuardWithoutLimits(t *testing.T) {
+	g := New(Limits{}, nil)
+	g.rss = func() (uint64, error) { return 1 << 40, nil }
+	if err := g.Admit(); err != nil {
+		t.Fatalf("expected no memory limit, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := g.AcquireStream(); err != nil {
+			t.Fatalf("expected no stream limit, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package pressure
+
+import (
+	"fmt"
+	"os"
+)
+
+// residentBytes reads the resident set size of the process from /proc.
+func residentBytes() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	var size, resident uint64
+	if _, err := fmt.Sscan(string(data), &size, &resident); err != nil {
+		return 0, fmt.Errorf("parse /proc/self/statm: %w", err)
+	}
+	return resident * uint64(os.Getpagesize()), nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package pressure
+
+import "runtime"
+
+// residentBytes approximates the resident set size by the memory the Go runtime obtained
+// from the system, which bounds it from above.
+func residentBytes() (uint64, error) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.Sys, nil
+}
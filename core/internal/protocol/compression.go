@@ -0,0 +1,132 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Chunk compression codecs negotiated through options.stream.compression.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// ValidCompression reports whether codec is a supported chunk compression.
+func ValidCompression(codec string) bool {
+	switch codec {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// RowEncoder compresses chunk rows. The JSON encoding of the rows is compressed and wrapped
+// in base64 so the result can travel inside a JSON-RPC notification.
+type RowEncoder struct {
+	codec string
+	zstd  *zstd.Encoder
+	buf   bytes.Buffer
+}
+
+// NewRowEncoder returns an encoder for the codec, which must not be CompressionNone.
+func NewRowEncoder(codec string) (*RowEncoder, error) {
+	e := &RowEncoder{codec: codec}
+	switch codec {
+	case CompressionGzip:
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return nil, err
+		}
+		e.zstd = encoder
+	default:
+		return nil, fmt.Errorf("unsupported chunk compression %q", codec)
+	}
+	return e, nil
+}
+
+// Codec returns the codec name.
+func (e *RowEncoder) Codec() string {
+	return e.codec
+}
+
+// Encode returns the compressed, base64-wrapped JSON encoding of rows.
+func (e *RowEncoder) Encode(rows [][]any) (string, error) {
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return "", err
+	}
+	return e.EncodeJSON(data)
+}
+
+// EncodeJSON compresses and base64-wraps rows that are already encoded as a JSON array.
+func (e *RowEncoder) EncodeJSON(data []byte) (string, error) {
+	var compressed []byte
+	switch e.codec {
+	case CompressionGzip:
+		e.buf.Reset()
+		zw := gzip.NewWriter(&e.buf)
+		if _, err := zw.Write(data); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+		compressed = e.buf.Bytes()
+	case CompressionZstd:
+		compressed = e.zstd.EncodeAll(data, nil)
+	}
+	return base64.StdEncoding.EncodeToString(compressed), nil
+}
+
+// Close releases codec resources.
+func (e *RowEncoder) Close() {
+	if e.zstd != nil {
+		e.zstd.Close()
+	}
+}
+
+// DecodeRows reverses RowEncoder.Encode.
+func DecodeRows(codec, payload string) ([][]any, error) {
+	compressed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	switch codec {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		if data, err = decoder.DecodeAll(compressed, nil); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported chunk compression %q", codec)
+	}
+
+	var rows [][]any
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,48 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRowEncoderRoundTrip(t *testing.T) {
+	rows := make([][]any, 200)
+	for i := range rows {
+		rows[i] = []any{float64(i), strings.Repeat("lorem ipsum ", 20), nil}
+	}
+	plain, _ := json.Marshal(rows)
+
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		encoder, err := NewRowEncoder(codec)
+		if err != nil {
+			t.Fatalf("%s: NewRowEncoder returned error: %v", codec, err)
+		}
+		data, err := encoder.Encode(rows)
+		encoder.Close()
+		if err != nil {
+			t.Fatalf("%s: Encode returned error: %v", codec, err)
+		}
+		if len(data) >= len(plain)/4 {
+			t.Fatalf("%s: expected text-heavy rows to shrink, got %d of %d bytes", codec, len(data), len(plain))
+		}
+
+		decoded, err := DecodeRows(codec, data)
+		if err != nil {
+			t.Fatalf("%s: DecodeRows returned error: %v", codec, err)
+		}
+		if !reflect.DeepEqual(decoded, rows) {
+			t.Fatalf("%s: rows changed in round trip", codec)
+		}
+	}
+}
+
+func TestRowEncoderRejectsUnknownCodec(t *testing.T) {
+	if ValidCompression("brotli") {
+		t.Fatal("expected brotli to be unsupported")
+	}
+	if _, err := NewRowEncoder("brotli"); err == nil {
+		t.Fatal("expected NewRowEncoder to fail")
+	}
+}
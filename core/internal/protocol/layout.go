@@ -0,0 +1,21 @@
+package protocol
+
+// Chunk layouts negotiated through options.stream.layout. Row chunks carry one array per
+// row. Columnar chunks carry one array per column, which repeats far less punctuation for
+// results thousands of columns wide and lets clients virtualize columns without
+// transposing the chunk first.
+const (
+	LayoutRows    = "rows"
+	LayoutColumns = "columns"
+)
+
+// ValidLayout reports whether layout is a supported chunk layout. The empty string is the
+// row layout.
+func ValidLayout(layout string) bool {
+	switch layout {
+	case "", LayoutRows, LayoutColumns:
+		return true
+	default:
+		return false
+	}
+}
@@ -7,7 +7,17 @@ type StreamChunk struct {
 	RequestID string
 	Seq       int
 	Rows      [][]any
-	HasMore   bool
+	// RowCount counts the rows of a chunk sent pre-encoded, with Rows left nil.
+	RowCount int
+	HasMore  bool
+}
+
+// Len returns the number of rows in the chunk.
+func (c StreamChunk) Len() int {
+	if c.Rows == nil {
+		return c.RowCount
+	}
+	return len(c.Rows)
 }
 
 // StreamAck is sent by the extension to signal that the core may continue streaming.
@@ -45,7 +55,7 @@ func (s *StreamSession) HandleChunk(ctx context.Context, chunk StreamChunk) erro
 		return nil
 	}
 
-	s.bufferedRows += len(chunk.Rows)
+	s.bufferedRows += chunk.Len()
 	if s.bufferedRows < s.highWaterMark && chunk.HasMore {
 		return nil
 	}
@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the protocol version spoken by the core. Clients declaring a different major
+// version are refused; minor versions are backwards compatible and negotiate down.
+const Version = "1.0"
+
+// FramingNDJSON is newline-delimited JSON, one message per line.
+const FramingNDJSON = "ndjson"
+
+// ErrIncompatibleVersion is returned when the client speaks another major version.
+var ErrIncompatibleVersion = errors.New("incompatible protocol version")
+
+// ErrNoCommonFraming is returned when none of the client framings is supported.
+var ErrNoCommonFraming = errors.New("no common message framing")
+
+// ClientHello is sent by the client in core.initialize.
+type ClientHello struct {
+	ProtocolVersion string             `json:"protocolVersion" jsonschema:"required"`
+	Client          Peer               `json:"client"`
+	Capabilities    ClientCapabilities `json:"capabilities"`
+	// User names the person using the client. The core includes it in the comment it
+	// prefixes executed statements with.
+	User string `json:"user,omitempty"`
+	// Workspace names the project the client works in. Workspaces keep separate run
+	// history and imported connection aliases; clients that send none share the default.
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// Peer identifies one side of the connection.
+type Peer struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ClientCapabilities lists what the client can handle. A list that is not sent means the
+// client accepts whatever the core offers; an empty list means none.
+type ClientCapabilities struct {
+	// StreamEncodings are the chunk compression codecs the client can decode.
+	StreamEncodings []string `json:"streamEncodings"`
+	// ChunkLayouts are the stream chunk layouts the client can read besides rows, which
+	// every client reads.
+	ChunkLayouts []string `json:"chunkLayouts"`
+	// Framing lists the message framings the client can read, in order of preference.
+	Framing []string `json:"framing"`
+	// Notifications are the core-to-client notifications the client handles.
+	Notifications []string `json:"notifications"`
+}
+
+// Offer describes what the core supports.
+type Offer struct {
+	StreamEncodings []string
+	ChunkLayouts    []string
+	Framing         []string
+	Notifications   []string
+}
+
+// Features is the negotiated feature set returned to the client.
+type Features struct {
+	ProtocolVersion string   `json:"protocolVersion"`
+	StreamEncodings []string `json:"streamEncodings"`
+	ChunkLayouts    []string `json:"chunkLayouts"`
+	Framing         string   `json:"framing"`
+	Notifications   []string `json:"notifications"`
+}
+
+// Negotiate intersects the client capabilities with the core offer. Lists keep the client's
+// order of preference.
+func Negotiate(hello ClientHello, offer Offer) (Features, error) {
+	coreMajor, coreMinor, _ := parseVersion(Version)
+	major, minor, err := parseVersion(hello.ProtocolVersion)
+	if err != nil {
+		return Features{}, err
+	}
+	if major != coreMajor {
+		return Features{}, fmt.Errorf("%w: client speaks %s, core speaks %s", ErrIncompatibleVersion, hello.ProtocolVersion, Version)
+	}
+
+	framing := intersect(hello.Capabilities.Framing, offer.Framing)
+	if len(framing) == 0 {
+		return Features{}, fmt.Errorf("%w: core supports %s", ErrNoCommonFraming, strings.Join(offer.Framing, ", "))
+	}
+
+	return Features{
+		ProtocolVersion: fmt.Sprintf("%d.%d", major, min(minor, coreMinor)),
+		StreamEncodings: intersect(hello.Capabilities.StreamEncodings, offer.StreamEncodings),
+		ChunkLayouts:    intersect(hello.Capabilities.ChunkLayouts, offer.ChunkLayouts),
+		Framing:         framing[0],
+		Notifications:   intersect(hello.Capabilities.Notifications, offer.Notifications),
+	}, nil
+}
+
+// Allows reports whether value was negotiated in list.
+func Allows(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func parseVersion(version string) (int, int, error) {
+	majorText, minorText, _ := strings.Cut(strings.TrimSpace(version), ".")
+	major, err := strconv.Atoi(majorText)
+	if err != nil || major < 0 {
+		return 0, 0, fmt.Errorf("%w: malformed version %q", ErrIncompatibleVersion, version)
+	}
+	minor := 0
+	if minorText != "" {
+		// Patch components are ignored.
+		minorText, _, _ = strings.Cut(minorText, ".")
+		if minor, err = strconv.Atoi(minorText); err != nil || minor < 0 {
+			return 0, 0, fmt.Errorf("%w: malformed version %q", ErrIncompatibleVersion, version)
+		}
+	}
+	return major, minor, nil
+}
+
+// intersect returns the entries of client also present in offer. A nil client list accepts
+// the whole offer.
+func intersect(client, offer []string) []string {
+	if client == nil {
+		return append([]string{}, offer...)
+	}
+	result := []string{}
+	for _, value := range client {
+		if Allows(offer, value) && !Allows(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
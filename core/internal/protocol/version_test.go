@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offer := Offer{
+		StreamEncodings: []string{CompressionGzip, CompressionZstd},
+		ChunkLayouts:    []string{LayoutColumns},
+		Framing:         []string{FramingNDJSON},
+		Notifications:   []string{"job.progress", "schema.changed"},
+	}
+
+	features, err := Negotiate(ClientHello{
+		ProtocolVersion: "1.7",
+		Capabilities: ClientCapabilities{
+			StreamEncodings: []string{"brotli", CompressionZstd},
+			Framing:         []string{"lsp", FramingNDJSON},
+			Notifications:   []string{"schema.changed", "unknown"},
+		},
+	}, offer)
+	if err != nil {
+		t.Fatalf("Negotiate returned error: %v", err)
+	}
+	want := Features{
+		ProtocolVersion: "1.0",
+		StreamEncodings: []string{CompressionZstd},
+		ChunkLayouts:    []string{LayoutColumns},
+		Framing:         FramingNDJSON,
+		Notifications:   []string{"schema.changed"},
+	}
+	if !reflect.DeepEqual(features, want) {
+		t.Fatalf("expected %+v, got %+v", want, features)
+	}
+
+	// Undeclared capabilities accept the whole offer; declared empty lists accept nothing.
+	features, err = Negotiate(ClientHello{
+		ProtocolVersion: "1",
+		Capabilities:    ClientCapabilities{Notifications: []string{}},
+	}, offer)
+	if err != nil {
+		t.Fatalf("Negotiate returned error: %v", err)
+	}
+	if len(features.StreamEncodings) != 2 || len(features.ChunkLayouts) != 1 || len(features.Notifications) != 0 || features.Framing != FramingNDJSON {
+		t.Fatalf("unexpected defaults %+v", features)
+	}
+}
+
+func TestNegotiateRefusesIncompatibleClients(t *testing.T) {
+	offer := Offer{Framing: []string{FramingNDJSON}}
+
+	for _, version := range []string{"2.0", "0.9", "", "one"} {
+		if _, err := Negotiate(ClientHello{ProtocolVersion: version}, offer); !errors.Is(err, ErrIncompatibleVersion) {
+			t.Fatalf("version %q: expected ErrIncompatibleVersion, got %v", version, err)
+		}
+	}
+
+	hello := ClientHello{ProtocolVersion: Version, Capabilities: ClientCapabilities{Framing: []string{"lsp"}}}
+	if _, err := Negotiate(hello, offer); !errors.Is(err, ErrNoCommonFraming) {
+		t.Fatalf("expected ErrNoCommonFraming, got %v", err)
+	}
+}
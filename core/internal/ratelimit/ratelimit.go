@@ -0,0 +1,154 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule is a token bucket: Rate tokens per second refill a bucket holding at most Burst.
+type Rule struct {
+	Rate  float64
+	Burst int
+}
+
+// ParseRule parses "RATE/UNIT[:BURST]", for example "10/s", "120/m:20" or "0.5/s:1". UNIT
+// is s, m or h. BURST defaults to the rate per second rounded up, and at least 1.
+func ParseRule(spec string) (Rule, error) {
+	rateSpec, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+	count, unit, ok := strings.Cut(rateSpec, "/")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate %q: expected RATE/UNIT", spec)
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return Rule{}, fmt.Errorf("rate %q: expected a positive number", spec)
+	}
+	var per time.Duration
+	switch unit {
+	case "s":
+		per = time.Second
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return Rule{}, fmt.Errorf("rate %q: unit must be s, m or h", spec)
+	}
+
+	rule := Rule{Rate: n / per.Seconds()}
+	rule.Burst = int(math.Max(1, math.Ceil(rule.Rate)))
+	if hasBurst {
+		burst, err := strconv.Atoi(burstSpec)
+		if err != nil || burst < 1 {
+			return Rule{}, fmt.Errorf("rate %q: burst must be a positive integer", spec)
+		}
+		rule.Burst = burst
+	}
+	return rule, nil
+}
+
+// ParseRules parses a comma-separated list of NAME=RULE pairs, such as
+// "query.execute=10/s:20,schema.list=30/m". An empty spec yields no rules.
+func ParseRules(spec string) (map[string]Rule, error) {
+	rules := make(map[string]Rule)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, ruleSpec, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%q: expected NAME=RATE/UNIT[:BURST]", item)
+		}
+		rule, err := ParseRule(ruleSpec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		rules[strings.TrimSpace(name)] = rule
+	}
+	return rules, nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one bucket per key. Buckets that have refilled completely are forgotten,
+// so the number of keys seen over time does not grow memory.
+type Limiter struct {
+	rule Rule
+	now  func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// New returns a limiter applying rule to every key.
+func New(rule Rule) *Limiter {
+	return &Limiter{rule: rule, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token from key's bucket. When the bucket is empty it reports how long until
+// a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%256 == 0 {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rule.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Refund returns a token taken by Allow, for callers that allowed a call but then refused
+// it for another reason.
+func (l *Limiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(float64(l.rule.Burst), b.tokens+1)
+	}
+}
+
+// Forget drops key's bucket, for keys that will not be seen again.
+func (l *Limiter) Forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(l.rule.Burst), b.tokens+elapsed*l.rule.Rate)
+		b.last = now
+	}
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.rule.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(" query.execute=10/s:20, schema.list=30/m ,x=0.5/s")
+	if err != nil {
+		t.Fatalf("ParseRules: %v", err)
+	}
+	want := map[string]Rule{
+		"query.execute": {Rate: 10, Burst: 20},
+		"schema.list":   {Rate: 0.5, Burst: 1},
+		"x":             {Rate: 0.5, Burst: 1},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("expected %d rules, got %v", len(want), rules)
+	}
+	for name, rule := range want {
+		if rules[name] != rule {
+			t.Errorf("%s: expected %+v, got %+v", name, rule, rules[name])
+		}
+	}
+
+	if rules, err := ParseRules(""); err != nil || len(rules) != 0 {
+		t.Fatalf("expected no rules for an empty spec, got %v, %v", rules, err)
+	}
+	for _, bad := range []string{"query.execute", "=1/s", "a=1", "a=0/s", "a=1/d", "a=1/s:0", "a=x/s"} {
+		if _, err := ParseRules(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestLimiterRefillsAndReportsWait(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := New(Rule{Rate: 2, Burst: 2})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("call %d: expected the burst to be allowed", i)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected a 500ms wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("expected keys to have separate buckets")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("expected a token after refilling")
+	}
+	l.Refund("a")
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("expected the refunded token to be available")
+	}
+
+	now = now.Add(time.Hour)
+	l.prune(now)
+	if len(l.buckets) != 0 {
+		t.Fatalf("expected full buckets to be pruned, got %d", len(l.buckets))
+	}
+}
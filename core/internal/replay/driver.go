@@ -0,0 +1,194 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DriverName is the database/sql name of the replay driver.
+const DriverName = "replay"
+
+func init() {
+	sql.Register(DriverName, Driver{})
+}
+
+// Driver replays the fixture named by the DSN: its path, optionally followed by
+// "?timing=off" to return rows without the recorded delays.
+type Driver struct{}
+
+// Open loads the fixture of dsn.
+func (Driver) Open(dsn string) (driver.Conn, error) {
+	path, query, _ := strings.Cut(dsn, "?")
+	options, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replay DSN %q: %w", dsn, err)
+	}
+	c := &conn{}
+	switch timing := options.Get("timing"); timing {
+	case "", "recorded":
+		c.timed = true
+	case "off":
+	default:
+		return nil, fmt.Errorf("invalid replay timing %q: want recorded or off", timing)
+	}
+	if c.fixture, err = Load(path); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+type conn struct {
+	fixture *Fixture
+	timed   bool
+}
+
+var (
+	_ driver.QueryerContext = (*conn)(nil)
+	_ driver.ExecerContext  = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("replay: transactions are not recorded")
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	interaction, ok := c.fixture.Lookup(query)
+	if !ok {
+		return nil, fmt.Errorf("replay: no interaction recorded for %q", Key(query))
+	}
+	if err := c.wait(ctx, interaction.FirstRowMs); err != nil {
+		return nil, err
+	}
+	if interaction.Error != "" {
+		return nil, errors.New(interaction.Error)
+	}
+	return &rows{ctx: ctx, conn: c, interaction: interaction}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return driver.RowsAffected(0), nil
+}
+
+// wait sleeps for ms of the recorded time unless timing is off, returning early with the
+// error of ctx when it ends.
+func (c *conn) wait(ctx context.Context, ms float64) error {
+	if !c.timed || ms <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(time.Duration(ms * float64(time.Millisecond)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+type rows struct {
+	ctx         context.Context
+	conn        *conn
+	interaction Interaction
+	next        int
+}
+
+var _ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.interaction.Columns))
+	for i, column := range r.interaction.Columns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.interaction.Columns[index].Type
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next > 0 {
+		if err := r.conn.wait(r.ctx, r.interaction.RowMs); err != nil {
+			return err
+		}
+	}
+	if r.next >= len(r.interaction.Rows) {
+		if r.interaction.RowError != "" {
+			return errors.New(r.interaction.RowError)
+		}
+		return io.EOF
+	}
+	row := r.interaction.Rows[r.next]
+	r.next++
+	for i := range dest {
+		dest[i] = nil
+		if i < len(row) {
+			dest[i] = value(row[i])
+		}
+	}
+	return nil
+}
+
+// value converts a decoded fixture value to a driver value. Objects and arrays replay as
+// their JSON text.
+func value(v any) driver.Value {
+	switch v := v.(type) {
+	case nil, string, bool:
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
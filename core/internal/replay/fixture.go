@@ -0,0 +1,152 @@
+// Package replay records what statements returned from real databases into fixture files
+// and plays them back through a database/sql driver named "replay", so that protocol
+// behavior such as stream backpressure, cancellation and error paths can be tested
+// deterministically without a live server.
+//
+// A fixture is a JSON file of interactions, one per statement: the columns and rows it
+// returned or the error it failed with, and how long the first and following rows took.
+// Statements are matched on their text with leading comments, such as query tags, and
+// runs of whitespace ignored. Bind arguments are not part of the match.
+package replay
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fixture is the content of a fixture file.
+type Fixture struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Column describes a result column.
+type Column struct {
+	Name string `json:"name"`
+	// Type is the database type name reported by the driver.
+	Type string `json:"type,omitempty"`
+}
+
+// Interaction is what one statement returned.
+type Interaction struct {
+	SQL     string   `json:"sql"`
+	Columns []Column `json:"columns,omitempty"`
+	Rows    [][]any  `json:"rows,omitempty"`
+	// Error fails the statement before it returns rows.
+	Error string `json:"error,omitempty"`
+	// RowError fails reading the rows after Rows were returned.
+	RowError string `json:"rowError,omitempty"`
+	// FirstRowMs is the time from sending the statement until its first row, or its
+	// error.
+	FirstRowMs float64 `json:"firstRowMs,omitempty"`
+	// RowMs is the time each following row took.
+	RowMs float64 `json:"rowMs,omitempty"`
+}
+
+// Load reads a fixture file.
+func Load(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fixture Fixture
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers keep their text so that integers replay as integers.
+	decoder.UseNumber()
+	if err := decoder.Decode(&fixture); err != nil {
+		return nil, fmt.Errorf("invalid replay fixture %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// Lookup returns the interaction recorded for sql.
+func (f *Fixture) Lookup(sql string) (Interaction, bool) {
+	key := Key(sql)
+	for _, interaction := range f.Interactions {
+		if Key(interaction.SQL) == key {
+			return interaction, true
+		}
+	}
+	return Interaction{}, false
+}
+
+// Key is the text statements are matched on: sql without leading comments, a trailing
+// semicolon or differences in whitespace.
+func Key(sql string) string {
+	sql = strings.TrimSpace(sql)
+	for {
+		switch {
+		case strings.HasPrefix(sql, "/*"):
+			end := strings.Index(sql, "*/")
+			if end < 0 {
+				return ""
+			}
+			sql = strings.TrimSpace(sql[end+2:])
+		case strings.HasPrefix(sql, "--"):
+			_, rest, _ := strings.Cut(sql, "\n")
+			sql = strings.TrimSpace(rest)
+		default:
+			return strings.Join(strings.Fields(strings.TrimSuffix(sql, ";")), " ")
+		}
+	}
+}
+
+// Recorder adds interactions to a fixture file. A nil Recorder records nothing.
+type Recorder struct {
+	mu      sync.Mutex
+	path    string
+	fixture Fixture
+}
+
+// NewRecorder records into the fixture at path, keeping the interactions it already
+// holds.
+func NewRecorder(path string) (*Recorder, error) {
+	r := &Recorder{path: path}
+	fixture, err := Load(path)
+	switch {
+	case err == nil:
+		r.fixture = *fixture
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	return r, nil
+}
+
+// Record saves interaction, replacing the one recorded earlier for the same statement.
+func (r *Recorder) Record(interaction Interaction) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := Key(interaction.SQL)
+	replaced := false
+	for i, recorded := range r.fixture.Interactions {
+		if Key(recorded.SQL) == key {
+			r.fixture.Interactions[i] = interaction
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		r.fixture.Interactions = append(r.fixture.Interactions, interaction)
+	}
+	data, err := json.MarshalIndent(r.fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	// Write through a temporary file so that a crash never leaves a truncated fixture.
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeyIgnoresCommentsAndWhitespace(t *testing.T) {
+	got := Key("/* FluxGrid user=ann */ -- note\n  SELECT  id\n\tFROM t ;")
+	if got != "SELECT id FROM t" {
+		t.Fatalf("key = %q", got)
+	}
+}
+
+func TestRecordedInteractionsReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures", "orders.json")
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, interaction := range []Interaction{
+		{SQL: "SELECT id, name FROM orders", Rows: [][]any{{int64(9), "old"}}},
+		{SQL: "SELECT * FROM missing", Error: `relation "missing" does not exist`},
+		{SQL: "SELECT id FROM broken", Columns: []Column{{Name: "id"}}, Rows: [][]any{{int64(1)}}, RowError: "connection reset"},
+		// Recording a statement again replaces it.
+		{
+			SQL:     "SELECT id, name\nFROM orders;",
+			Columns: []Column{{Name: "id", Type: "INT8"}, {Name: "name", Type: "TEXT"}},
+			Rows:    [][]any{{int64(1), "anchor"}, {int64(2), nil}, {2.5, map[string]any{"a": true}}},
+		},
+	} {
+		if err := recorder.Record(interaction); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fixture, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixture.Interactions) != 3 {
+		t.Fatalf("interactions = %+v", fixture.Interactions)
+	}
+
+	db, err := sql.Open(DriverName, path+"?timing=off")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("/* FluxGrid requestId=1 */ SELECT id, name FROM orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types, _ := rows.ColumnTypes()
+	if types[0].DatabaseTypeName() != "INT8" {
+		t.Fatalf("type = %q", types[0].DatabaseTypeName())
+	}
+	var got [][]any
+	for rows.Next() {
+		var id, name any
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, []any{id, name})
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]any{{int64(1), "anchor"}, {int64(2), nil}, {2.5, `{"a":true}`}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rows = %v", got)
+	}
+
+	if _, err := db.Query("SELECT * FROM missing"); err == nil || err.Error() != `relation "missing" does not exist` {
+		t.Fatalf("error = %v", err)
+	}
+	if _, err := db.Query("SELECT 1"); err == nil {
+		t.Fatal("an unrecorded statement replayed")
+	}
+	rows, err = db.Query("SELECT id FROM broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if n != 1 || rows.Err() == nil || rows.Err().Error() != "connection reset" {
+		t.Fatalf("read %d rows, error %v", n, rows.Err())
+	}
+}
+
+func TestReplayStopsWaitingWhenContextEnds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "slow.json")
+	recorder, _ := NewRecorder(path)
+	if err := recorder.Record(Interaction{
+		SQL:     "SELECT n FROM slow",
+		Columns: []Column{{Name: "n"}},
+		Rows:    [][]any{{int64(1)}, {int64(2)}},
+		RowMs:   time.Hour.Seconds() * 1000,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(DriverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, "SELECT n FROM slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	if rows.Next() {
+		t.Fatal("the second row did not wait")
+	}
+	if err := rows.Err(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v", err)
+	}
+}
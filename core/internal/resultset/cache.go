@@ -0,0 +1,126 @@
+package resultset
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Cache keeps recently produced result sets addressable by ID so follow-up operations
+// (pivot, search, copy) can run server-side without re-executing the query.
+// Entries are evicted least-recently-used once maxEntries is reached or after ttl of inactivity.
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	ttl        time.Duration
+	now        func() time.Time
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type cacheEntry struct {
+	id       string
+	set      Set
+	lastUsed time.Time
+}
+
+// NewCache constructs a cache. A ttl of zero disables time-based expiry.
+func NewCache(maxEntries int, ttl time.Duration) *Cache {
+	if maxEntries <= 0 {
+		maxEntries = 1
+	}
+	return &Cache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Put stores the set and returns its identifier. Identifiers are random, so that one
+// client cannot reach the results of another by counting.
+func (c *Cache) Put(set Set) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expireLocked()
+
+	var random [12]byte
+	_, _ = rand.Read(random[:])
+	id := "res-" + hex.EncodeToString(random[:])
+	c.entries[id] = c.lru.PushFront(&cacheEntry{id: id, set: set, lastUsed: c.now()})
+
+	for c.lru.Len() > c.maxEntries {
+		c.removeLocked(c.lru.Back())
+	}
+	return id
+}
+
+// Get returns the cached set and marks it as recently used.
+func (c *Cache) Get(id string) (Set, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expireLocked()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return Set{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	entry.lastUsed = c.now()
+	c.lru.MoveToFront(elem)
+	return entry.set, true
+}
+
+// Release drops the set. It reports whether the set was present.
+func (c *Cache) Release(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return false
+	}
+	c.removeLocked(elem)
+	return true
+}
+
+// Len returns the number of cached sets.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) expireLocked() {
+	if c.ttl <= 0 {
+		return
+	}
+	cutoff := c.now().Add(-c.ttl)
+	for elem := c.lru.Back(); elem != nil; elem = c.lru.Back() {
+		if elem.Value.(*cacheEntry).lastUsed.After(cutoff) {
+			return
+		}
+		c.removeLocked(elem)
+	}
+}
+
+func (c *Cache) removeLocked(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.id)
+}
+
+// Clear drops every cached set and returns how many there were.
+func (c *Cache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.lru.Len()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	return n
+}
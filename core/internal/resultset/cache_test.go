@@ -0,0 +1,51 @@
+package resultset
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(2, 0)
+
+	first := cache.Put(Set{Rows: [][]any{{1}}})
+	second := cache.Put(Set{Rows: [][]any{{2}}})
+	if _, ok := cache.Get(first); !ok {
+		t.Fatal("expected first set to be cached")
+	}
+	third := cache.Put(Set{Rows: [][]any{{3}}})
+
+	if _, ok := cache.Get(second); ok {
+		t.Fatal("expected least recently used set to be evicted")
+	}
+	if _, ok := cache.Get(first); !ok {
+		t.Fatal("expected recently used set to survive")
+	}
+	if set, ok := cache.Get(third); !ok || set.Rows[0][0] != 3 {
+		t.Fatalf("unexpected third set %+v", set)
+	}
+}
+
+func TestCacheExpiryAndRelease(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	expiring := cache.Put(Set{})
+	released := cache.Put(Set{})
+
+	if !cache.Release(released) {
+		t.Fatal("expected release to report success")
+	}
+	if cache.Release(released) {
+		t.Fatal("expected second release to report absence")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := cache.Get(expiring); ok {
+		t.Fatal("expected idle set to expire")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("expected empty cache, got %d entries", cache.Len())
+	}
+}
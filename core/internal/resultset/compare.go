@@ -0,0 +1,223 @@
+package resultset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompareOptions controls how two result sets are aligned and reported.
+type CompareOptions struct {
+	// Keys names the columns used to align rows. They must exist in both sets.
+	Keys []string
+	// MaxDiffs caps the number of added, removed, and changed rows reported in total.
+	// Zero means unlimited.
+	MaxDiffs int
+}
+
+// RowDiff reports a row present on only one side.
+type RowDiff struct {
+	Key []any `json:"key"`
+	Row []any `json:"row"`
+}
+
+// CellDiff reports a single differing cell.
+type CellDiff struct {
+	Column string `json:"column"`
+	Left   any    `json:"left"`
+	Right  any    `json:"right"`
+}
+
+// ChangedRow reports a row present on both sides with differing cells.
+type ChangedRow struct {
+	Key   []any      `json:"key"`
+	Cells []CellDiff `json:"cells"`
+}
+
+// CompareSummary aggregates diff counts. Counts are exact even when the detailed lists are truncated.
+type CompareSummary struct {
+	LeftRows  int `json:"leftRows"`
+	RightRows int `json:"rightRows"`
+	Added     int `json:"added"`
+	Removed   int `json:"removed"`
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Diff is the outcome of comparing a left (baseline) set against a right set.
+type Diff struct {
+	Columns          []string       `json:"columns"`
+	LeftOnlyColumns  []string       `json:"leftOnlyColumns"`
+	RightOnlyColumns []string       `json:"rightOnlyColumns"`
+	Added            []RowDiff      `json:"added"`
+	Removed          []RowDiff      `json:"removed"`
+	Changed          []ChangedRow   `json:"changed"`
+	Summary          CompareSummary `json:"summary"`
+	Truncated        bool           `json:"truncated"`
+}
+
+// DuplicateKeyError signals that a key appears more than once in one of the sets.
+type DuplicateKeyError struct {
+	Side string
+	Key  []any
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %v in %s result", e.Key, e.Side)
+}
+
+type keyedRow struct {
+	key []any
+	row []any
+}
+
+// Compare aligns left and right on the key columns and reports rows added in right, removed
+// from left, and rows whose non-key common columns differ.
+func Compare(left, right Set, opts CompareOptions) (Diff, error) {
+	if len(opts.Keys) == 0 {
+		return Diff{}, fmt.Errorf("at least one key column is required")
+	}
+
+	leftKeys, err := keyIndexes(left, opts.Keys, "left")
+	if err != nil {
+		return Diff{}, err
+	}
+	rightKeys, err := keyIndexes(right, opts.Keys, "right")
+	if err != nil {
+		return Diff{}, err
+	}
+
+	diff := Diff{
+		Columns:          []string{},
+		LeftOnlyColumns:  []string{},
+		RightOnlyColumns: []string{},
+		Added:            []RowDiff{},
+		Removed:          []RowDiff{},
+		Changed:          []ChangedRow{},
+	}
+
+	type pair struct{ left, right int }
+	var common []pair
+	for i, col := range left.Columns {
+		j := right.ColumnIndex(col.Name)
+		if j < 0 {
+			diff.LeftOnlyColumns = append(diff.LeftOnlyColumns, col.Name)
+			continue
+		}
+		diff.Columns = append(diff.Columns, col.Name)
+		if !containsString(opts.Keys, col.Name) {
+			common = append(common, pair{i, j})
+		}
+	}
+	for _, col := range right.Columns {
+		if left.ColumnIndex(col.Name) < 0 {
+			diff.RightOnlyColumns = append(diff.RightOnlyColumns, col.Name)
+		}
+	}
+
+	leftIndex, leftOrder, err := indexRows(left, leftKeys, "left")
+	if err != nil {
+		return Diff{}, err
+	}
+	rightIndex, rightOrder, err := indexRows(right, rightKeys, "right")
+	if err != nil {
+		return Diff{}, err
+	}
+
+	diff.Summary.LeftRows = len(left.Rows)
+	diff.Summary.RightRows = len(right.Rows)
+
+	reported := 0
+	report := func() bool {
+		if opts.MaxDiffs > 0 && reported >= opts.MaxDiffs {
+			diff.Truncated = true
+			return false
+		}
+		reported++
+		return true
+	}
+
+	for _, k := range leftOrder {
+		l := leftIndex[k]
+		r, ok := rightIndex[k]
+		if !ok {
+			diff.Summary.Removed++
+			if report() {
+				diff.Removed = append(diff.Removed, RowDiff{Key: l.key, Row: l.row})
+			}
+			continue
+		}
+
+		var cells []CellDiff
+		for _, p := range common {
+			if valueKey(l.row[p.left]) != valueKey(r.row[p.right]) {
+				cells = append(cells, CellDiff{
+					Column: left.Columns[p.left].Name,
+					Left:   l.row[p.left],
+					Right:  r.row[p.right],
+				})
+			}
+		}
+		if len(cells) == 0 {
+			diff.Summary.Unchanged++
+			continue
+		}
+		diff.Summary.Changed++
+		if report() {
+			diff.Changed = append(diff.Changed, ChangedRow{Key: l.key, Cells: cells})
+		}
+	}
+
+	for _, k := range rightOrder {
+		if _, ok := leftIndex[k]; ok {
+			continue
+		}
+		r := rightIndex[k]
+		diff.Summary.Added++
+		if report() {
+			diff.Added = append(diff.Added, RowDiff{Key: r.key, Row: r.row})
+		}
+	}
+
+	return diff, nil
+}
+
+func keyIndexes(set Set, keys []string, side string) ([]int, error) {
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		idx := set.ColumnIndex(key)
+		if idx < 0 {
+			return nil, fmt.Errorf("key column %q not found in %s result", key, side)
+		}
+		indexes[i] = idx
+	}
+	return indexes, nil
+}
+
+func indexRows(set Set, keyIdx []int, side string) (map[string]keyedRow, []string, error) {
+	index := make(map[string]keyedRow, len(set.Rows))
+	order := make([]string, 0, len(set.Rows))
+	parts := make([]string, len(keyIdx))
+	for _, row := range set.Rows {
+		key := make([]any, len(keyIdx))
+		for i, idx := range keyIdx {
+			key[i] = row[idx]
+			parts[i] = valueKey(row[idx])
+		}
+		k := strings.Join(parts, "\x1f")
+		if _, exists := index[k]; exists {
+			return nil, nil, &DuplicateKeyError{Side: side, Key: key}
+		}
+		index[k] = keyedRow{key: key, row: row}
+		order = append(order, k)
+	}
+	return index, order, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
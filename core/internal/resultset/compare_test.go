@@ -0,0 +1,83 @@
+package resultset
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompareReportsAddedRemovedChanged(t *testing.T) {
+	left := Set{
+		Columns: []Column{{Name: "id"}, {Name: "name"}, {Name: "legacy"}},
+		Rows: [][]any{
+			{int64(1), "Alice", "x"},
+			{int64(2), "Bob", "y"},
+			{int64(3), "Carol", "z"},
+		},
+	}
+	right := Set{
+		Columns: []Column{{Name: "id"}, {Name: "name"}, {Name: "email"}},
+		Rows: [][]any{
+			{"1", "Alice", "a@example.com"},
+			{"3", "Caroline", "c@example.com"},
+			{"4", "Dan", "d@example.com"},
+		},
+	}
+
+	diff, err := Compare(left, right, CompareOptions{Keys: []string{"id"}})
+	if err != nil {
+		t.Fatalf("Compare returned error: %v", err)
+	}
+
+	if diff.Summary.Added != 1 || diff.Summary.Removed != 1 || diff.Summary.Changed != 1 || diff.Summary.Unchanged != 1 {
+		t.Fatalf("unexpected summary %+v", diff.Summary)
+	}
+	if diff.Removed[0].Key[0] != int64(2) {
+		t.Fatalf("unexpected removed row %+v", diff.Removed[0])
+	}
+	if diff.Added[0].Key[0] != "4" {
+		t.Fatalf("unexpected added row %+v", diff.Added[0])
+	}
+	cells := diff.Changed[0].Cells
+	if len(cells) != 1 || cells[0].Column != "name" || cells[0].Left != "Carol" || cells[0].Right != "Caroline" {
+		t.Fatalf("unexpected changed cells %+v", cells)
+	}
+	if len(diff.LeftOnlyColumns) != 1 || diff.LeftOnlyColumns[0] != "legacy" {
+		t.Fatalf("unexpected left-only columns %v", diff.LeftOnlyColumns)
+	}
+	if len(diff.RightOnlyColumns) != 1 || diff.RightOnlyColumns[0] != "email" {
+		t.Fatalf("unexpected right-only columns %v", diff.RightOnlyColumns)
+	}
+}
+
+func TestCompareTruncatesDetailsButKeepsCounts(t *testing.T) {
+	left := Set{Columns: []Column{{Name: "id"}}}
+	right := Set{Columns: []Column{{Name: "id"}}}
+	for i := 0; i < 10; i++ {
+		right.Rows = append(right.Rows, []any{i})
+	}
+
+	diff, err := Compare(left, right, CompareOptions{Keys: []string{"id"}, MaxDiffs: 3})
+	if err != nil {
+		t.Fatalf("Compare returned error: %v", err)
+	}
+	if !diff.Truncated || len(diff.Added) != 3 || diff.Summary.Added != 10 {
+		t.Fatalf("unexpected truncation result: truncated=%v added=%d summary=%+v", diff.Truncated, len(diff.Added), diff.Summary)
+	}
+}
+
+func TestCompareErrors(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "id"}},
+		Rows:    [][]any{{1}, {1}},
+	}
+
+	_, err := Compare(set, Set{Columns: []Column{{Name: "id"}}}, CompareOptions{Keys: []string{"id"}})
+	var dupErr *DuplicateKeyError
+	if !errors.As(err, &dupErr) || dupErr.Side != "left" {
+		t.Fatalf("expected duplicate key error, got %v", err)
+	}
+
+	if _, err := Compare(set, set, CompareOptions{Keys: []string{"missing"}}); err == nil {
+		t.Fatal("expected error for missing key column")
+	}
+}
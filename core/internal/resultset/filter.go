@@ -0,0 +1,234 @@
+package resultset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Filter operators.
+const (
+	OpEq         = "eq"
+	OpNe         = "ne"
+	OpLt         = "lt"
+	OpLte        = "lte"
+	OpGt         = "gt"
+	OpGte        = "gte"
+	OpContains   = "contains"
+	OpStartsWith = "startsWith"
+	OpEndsWith   = "endsWith"
+	OpIn         = "in"
+	OpIsNull     = "isNull"
+	OpNotNull    = "notNull"
+)
+
+// maxFilterDepth bounds the nesting of groups.
+const maxFilterDepth = 32
+
+// Filter is a typed filter expression: either a comparison of one column with a value or
+// an AND/OR group of filters. The same expression is compiled to parameterized SQL for
+// table reads and evaluated by Where on cached results, so clients never build SQL text.
+//
+// Comparisons follow SQL: a NULL cell matches only isNull. contains, startsWith and
+// endsWith compare text case-insensitively.
+type Filter struct {
+	And    []Filter `json:"and,omitempty"`
+	Or     []Filter `json:"or,omitempty"`
+	Column string   `json:"column,omitempty"`
+	Op     string   `json:"op,omitempty" jsonschema:"enum=eq|ne|lt|lte|gt|gte|contains|startsWith|endsWith|in|isNull|notNull"`
+	// Value is a string, number or boolean; for in, an array of them.
+	Value any `json:"value"`
+}
+
+// IsGroup reports whether f combines other filters rather than comparing a column.
+func (f Filter) IsGroup() bool {
+	return f.And != nil || f.Or != nil
+}
+
+// Validate checks that the expression is well formed.
+func (f Filter) Validate() error {
+	return f.validate(0)
+}
+
+func (f Filter) validate(depth int) error {
+	if depth > maxFilterDepth {
+		return fmt.Errorf("filter is nested deeper than %d levels", maxFilterDepth)
+	}
+	if f.IsGroup() {
+		if f.And != nil && f.Or != nil || f.Column != "" || f.Op != "" {
+			return errors.New("a filter is either an and group, an or group or a comparison")
+		}
+		for _, child := range append(f.And, f.Or...) {
+			if err := child.validate(depth + 1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if f.Column == "" {
+		return errors.New("filter column is required")
+	}
+	switch f.Op {
+	case OpIsNull, OpNotNull:
+		if f.Value != nil {
+			return fmt.Errorf("%s takes no value", f.Op)
+		}
+	case OpEq, OpNe, OpLt, OpLte, OpGt, OpGte:
+		if !isScalar(f.Value) {
+			return fmt.Errorf("%s on %q needs a string, number or boolean value", f.Op, f.Column)
+		}
+	case OpContains, OpStartsWith, OpEndsWith:
+		if _, ok := f.Value.(string); !ok {
+			return fmt.Errorf("%s on %q needs a string value", f.Op, f.Column)
+		}
+	case OpIn:
+		values, ok := f.Value.([]any)
+		if !ok || len(values) == 0 {
+			return fmt.Errorf("in on %q needs a non-empty array value", f.Column)
+		}
+		for _, value := range values {
+			if !isScalar(value) {
+				return fmt.Errorf("in on %q needs string, number or boolean values", f.Column)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown filter operator %q", f.Op)
+	}
+	return nil
+}
+
+// isScalar accepts the values JSON decodes to, and the integers of cells read back from a
+// database, which the core filters on when following keys.
+func isScalar(value any) bool {
+	switch value.(type) {
+	case string, float64, bool, int64, int32, int:
+		return true
+	}
+	return false
+}
+
+// Where returns a copy of set holding the rows that match f, in their original order.
+func Where(set Set, f Filter) (Set, error) {
+	if err := f.Validate(); err != nil {
+		return Set{}, err
+	}
+	match, err := compileFilter(set, f)
+	if err != nil {
+		return Set{}, err
+	}
+	filtered := Set{Columns: set.Columns, Rows: [][]any{}}
+	for _, row := range set.Rows {
+		if match(row) {
+			filtered.Rows = append(filtered.Rows, row)
+		}
+	}
+	return filtered, nil
+}
+
+func compileFilter(set Set, f Filter) (func([]any) bool, error) {
+	if f.IsGroup() {
+		children := append(f.And, f.Or...)
+		matchers := make([]func([]any) bool, len(children))
+		for i, child := range children {
+			var err error
+			if matchers[i], err = compileFilter(set, child); err != nil {
+				return nil, err
+			}
+		}
+		// An or group stops at the first match, an and group at the first miss.
+		or := f.Or != nil
+		return func(row []any) bool {
+			for _, match := range matchers {
+				if match(row) == or {
+					return or
+				}
+			}
+			return !or
+		}, nil
+	}
+
+	idx := set.ColumnIndex(f.Column)
+	if idx < 0 {
+		return nil, fmt.Errorf("column %q not found", f.Column)
+	}
+	kind := columnKindOf(set.Columns[idx].DataType)
+	cell := func(row []any) any {
+		if idx < len(row) {
+			return row[idx]
+		}
+		return nil
+	}
+
+	switch f.Op {
+	case OpIsNull:
+		return func(row []any) bool { return cell(row) == nil }, nil
+	case OpNotNull:
+		return func(row []any) bool { return cell(row) != nil }, nil
+	case OpContains, OpStartsWith, OpEndsWith:
+		want := strings.ToLower(f.Value.(string))
+		test := map[string]func(string, string) bool{
+			OpContains:   strings.Contains,
+			OpStartsWith: strings.HasPrefix,
+			OpEndsWith:   strings.HasSuffix,
+		}[f.Op]
+		return func(row []any) bool {
+			value := cell(row)
+			if value == nil {
+				return false
+			}
+			return test(strings.ToLower(cellText(value)), want)
+		}, nil
+	}
+
+	values := []any{f.Value}
+	if f.Op == OpIn {
+		values = f.Value.([]any)
+	}
+	wants := make([]sortValue, len(values))
+	for i, value := range values {
+		wants[i] = newSortValue(value, kind, nil)
+	}
+	return func(row []any) bool {
+		value := cell(row)
+		if value == nil {
+			return false
+		}
+		got := newSortValue(value, kind, nil)
+		for _, want := range wants {
+			if compareMatches(f.Op, got, want) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// compareMatches applies a comparison operator. Values of different representations, such
+// as text compared with a number, are only ever unequal.
+func compareMatches(op string, got, want sortValue) bool {
+	if got.rank() != want.rank() {
+		return op == OpNe
+	}
+	c := compareNonNull(got, want)
+	switch op {
+	case OpEq, OpIn:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLte:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+func cellText(value any) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
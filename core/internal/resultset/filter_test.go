@@ -0,0 +1,52 @@
+package resultset
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWhereEvaluatesFilters(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "id", DataType: "23"}, {Name: "price", DataType: "DECIMAL"}, {Name: "name", DataType: "25"}},
+		Rows: [][]any{
+			{int64(1), "9.50", "Apple pie"},
+			{int64(2), "12.00", "Banana"},
+			{int64(3), nil, "apricot"},
+			{int64(4), "3", nil},
+		},
+	}
+	cases := map[string][]any{
+		`{"column":"price","op":"gt","value":9}`:                                                    {int64(1), int64(2)},
+		`{"column":"price","op":"eq","value":12}`:                                                   {int64(2)},
+		`{"column":"price","op":"ne","value":12}`:                                                   {int64(1), int64(4)},
+		`{"column":"name","op":"startsWith","value":"AP"}`:                                          {int64(1), int64(3)},
+		`{"column":"name","op":"endsWith","value":"NA"}`:                                            {int64(2)},
+		`{"column":"id","op":"in","value":[2,4,7]}`:                                                 {int64(2), int64(4)},
+		`{"column":"price","op":"isNull"}`:                                                          {int64(3)},
+		`{"or":[{"column":"name","op":"isNull"},{"column":"price","op":"lte","value":"9.5"}]}`:      {int64(1), int64(4)},
+		`{"and":[{"column":"name","op":"contains","value":"p"},{"column":"price","op":"notNull"}]}`: {int64(1)},
+		`{"and":[]}`: {int64(1), int64(2), int64(3), int64(4)},
+		`{"or":[]}`:  {},
+	}
+	for raw, want := range cases {
+		var f Filter
+		if err := json.Unmarshal([]byte(raw), &f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Where(set, f)
+		if err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if ids := column(got, 0); !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: got %v, want %v", raw, ids, want)
+		}
+	}
+}
+
+func TestWhereRejectsUnknownColumns(t *testing.T) {
+	set := Set{Columns: []Column{{Name: "id"}}}
+	if _, err := Where(set, Filter{Column: "missing", Op: OpIsNull}); err == nil {
+		t.Fatal("expected an error for an unknown column")
+	}
+}
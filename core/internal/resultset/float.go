@@ -0,0 +1,52 @@
+package resultset
+
+import "math"
+
+// Ways results represent floats JSON numbers cannot hold.
+const (
+	// SpecialFloatsTagged replaces them with a SpecialFloat. It is the default.
+	SpecialFloatsTagged = "tagged"
+	// SpecialFloatsNull replaces them with null.
+	SpecialFloatsNull = "null"
+)
+
+// ValidSpecialFloats reports whether mode is a known special float mode; empty selects the
+// default.
+func ValidSpecialFloats(mode string) bool {
+	return mode == "" || mode == SpecialFloatsTagged || mode == SpecialFloatsNull
+}
+
+// SpecialFloat stands in for a NaN or infinite value. It encodes as {"$float": "NaN"},
+// {"$float": "Infinity"} or {"$float": "-Infinity"}, spelled as Postgres prints them.
+type SpecialFloat struct {
+	Value string `json:"$float"`
+}
+
+// SpecialFloatOf returns the tag for a NaN or infinite float, and false for finite ones.
+func SpecialFloatOf(f float64) (SpecialFloat, bool) {
+	switch {
+	case math.IsNaN(f):
+		return SpecialFloat{Value: "NaN"}, true
+	case math.IsInf(f, 1):
+		return SpecialFloat{Value: "Infinity"}, true
+	case math.IsInf(f, -1):
+		return SpecialFloat{Value: "-Infinity"}, true
+	}
+	return SpecialFloat{}, false
+}
+
+// Float returns the value the tag stands for.
+func (s SpecialFloat) Float() float64 {
+	switch s.Value {
+	case "Infinity":
+		return math.Inf(1)
+	case "-Infinity":
+		return math.Inf(-1)
+	}
+	return math.NaN()
+}
+
+// String returns the Postgres spelling of the value.
+func (s SpecialFloat) String() string {
+	return s.Value
+}
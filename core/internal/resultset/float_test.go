@@ -0,0 +1,27 @@
+package resultset
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestSpecialFloatRoundTrips(t *testing.T) {
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		special, ok := SpecialFloatOf(f)
+		if !ok {
+			t.Fatalf("%v was not tagged", f)
+		}
+		back := special.Float()
+		if math.IsNaN(f) != math.IsNaN(back) || (!math.IsNaN(f) && back != f) {
+			t.Errorf("%v came back as %v", f, back)
+		}
+	}
+	if _, ok := SpecialFloatOf(1.5); ok {
+		t.Error("a finite float was tagged")
+	}
+	encoded, err := json.Marshal(SpecialFloat{Value: "Infinity"})
+	if err != nil || string(encoded) != `{"$float":"Infinity"}` {
+		t.Errorf("got %s, %v", encoded, err)
+	}
+}
@@ -0,0 +1,296 @@
+package resultset
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatRequest selects a rectangle of the set and the text format to render it as.
+type FormatRequest struct {
+	// Format is one of markdown, html, json, csv, tsv, insert.
+	Format string `json:"format"`
+	// Rows lists explicit row indexes. When empty, RowStart/RowEnd select a range.
+	Rows     []int `json:"rows"`
+	RowStart int   `json:"rowStart"`
+	// RowEnd is exclusive; zero selects through the last row.
+	RowEnd int `json:"rowEnd"`
+	// Columns restricts and orders the output columns by name. Empty keeps all columns.
+	Columns []string `json:"columns"`
+	// IncludeHeader controls the header line for csv and tsv output.
+	IncludeHeader *bool `json:"includeHeader"`
+	// TableName and Dialect configure insert output.
+	TableName string `json:"tableName"`
+	Dialect   string `json:"dialect"`
+}
+
+// Format renders the selected cells as text.
+func Format(set Set, req FormatRequest) (string, error) {
+	columns, err := selectColumns(set, req.Columns)
+	if err != nil {
+		return "", err
+	}
+	rows, err := selectRows(set, req)
+	if err != nil {
+		return "", err
+	}
+
+	names := make([]string, len(columns))
+	for i, idx := range columns {
+		names[i] = set.Columns[idx].Name
+	}
+
+	var buf bytes.Buffer
+	switch req.Format {
+	case "markdown":
+		writeMarkdown(&buf, names, columns, rows)
+	case "html":
+		writeHTML(&buf, names, columns, rows)
+	case "json":
+		if err := writeJSON(&buf, names, columns, rows); err != nil {
+			return "", err
+		}
+	case "csv", "tsv":
+		header := req.IncludeHeader == nil || *req.IncludeHeader
+		if err := writeDelimited(&buf, req.Format, header, names, columns, rows); err != nil {
+			return "", err
+		}
+	case "insert":
+		table := req.TableName
+		if table == "" {
+			table = "result"
+		}
+		writeInserts(&buf, req.Dialect, table, names, columns, rows)
+	default:
+		return "", fmt.Errorf("unsupported format %q", req.Format)
+	}
+	return buf.String(), nil
+}
+
+func selectColumns(set Set, names []string) ([]int, error) {
+	if len(names) == 0 {
+		columns := make([]int, len(set.Columns))
+		for i := range columns {
+			columns[i] = i
+		}
+		return columns, nil
+	}
+	columns := make([]int, len(names))
+	for i, name := range names {
+		idx := set.ColumnIndex(name)
+		if idx < 0 {
+			return nil, fmt.Errorf("column %q not found", name)
+		}
+		columns[i] = idx
+	}
+	return columns, nil
+}
+
+func selectRows(set Set, req FormatRequest) ([][]any, error) {
+	if len(req.Rows) > 0 {
+		rows := make([][]any, len(req.Rows))
+		for i, idx := range req.Rows {
+			if idx < 0 || idx >= len(set.Rows) {
+				return nil, fmt.Errorf("row %d out of range", idx)
+			}
+			rows[i] = set.Rows[idx]
+		}
+		return rows, nil
+	}
+
+	end := req.RowEnd
+	if end <= 0 || end > len(set.Rows) {
+		end = len(set.Rows)
+	}
+	if req.RowStart < 0 || req.RowStart > end {
+		return nil, fmt.Errorf("invalid row range %d-%d", req.RowStart, req.RowEnd)
+	}
+	return set.Rows[req.RowStart:end], nil
+}
+
+// CellText renders a cell for text-oriented formats; NULL becomes an empty string.
+func CellText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeMarkdown(buf *bytes.Buffer, names []string, columns []int, rows [][]any) {
+	escape := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+	buf.WriteString("|")
+	for _, name := range names {
+		buf.WriteString(" " + escape.Replace(name) + " |")
+	}
+	buf.WriteString("\n|")
+	for range names {
+		buf.WriteString(" --- |")
+	}
+	buf.WriteString("\n")
+	for _, row := range rows {
+		buf.WriteString("|")
+		for _, idx := range columns {
+			buf.WriteString(" " + escape.Replace(CellText(row[idx])) + " |")
+		}
+		buf.WriteString("\n")
+	}
+}
+
+func writeHTML(buf *bytes.Buffer, names []string, columns []int, rows [][]any) {
+	buf.WriteString("<table>\n<thead>\n<tr>")
+	for _, name := range names {
+		buf.WriteString("<th>" + html.EscapeString(name) + "</th>")
+	}
+	buf.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for _, row := range rows {
+		buf.WriteString("<tr>")
+		for _, idx := range columns {
+			buf.WriteString("<td>" + html.EscapeString(CellText(row[idx])) + "</td>")
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</tbody>\n</table>\n")
+}
+
+// writeJSON emits an array of objects, keeping keys in column order.
+func writeJSON(buf *bytes.Buffer, names []string, columns []int, rows [][]any) error {
+	keys := make([][]byte, len(names))
+	for i, name := range names {
+		encoded, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		keys[i] = encoded
+	}
+
+	buf.WriteString("[")
+	for r, row := range rows {
+		if r > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+		for i, idx := range columns {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.Write(keys[i])
+			buf.WriteString(": ")
+			value, err := json.Marshal(row[idx])
+			if err != nil {
+				value, _ = json.Marshal(CellText(row[idx]))
+			}
+			buf.Write(value)
+		}
+		buf.WriteString("}")
+	}
+	if len(rows) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+	return nil
+}
+
+func writeDelimited(buf *bytes.Buffer, format string, header bool, names []string, columns []int, rows [][]any) error {
+	w := csv.NewWriter(buf)
+	if format == "tsv" {
+		w.Comma = '\t'
+	}
+	if header {
+		if err := w.Write(names); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, idx := range columns {
+			record[i] = CellText(row[idx])
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeInserts(buf *bytes.Buffer, dialect, table string, names []string, columns []int, rows [][]any) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = QuoteIdentifier(dialect, name)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (", quoteQualified(dialect, table), strings.Join(quoted, ", "))
+
+	for _, row := range rows {
+		buf.WriteString(prefix)
+		for i, idx := range columns {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(SQLLiteral(dialect, row[idx]))
+		}
+		buf.WriteString(");\n")
+	}
+}
+
+// QuoteIdentifier quotes a single identifier for the dialect (backticks for mysql, double
+// quotes otherwise).
+func QuoteIdentifier(dialect, name string) string {
+	if dialect == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteQualified(dialect, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = QuoteIdentifier(dialect, part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// SQLLiteral renders a value as a SQL literal for the dialect.
+func SQLLiteral(dialect string, value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if dialect == "sqlite" {
+			if v {
+				return "1"
+			}
+			return "0"
+		}
+		return strings.ToUpper(strconv.FormatBool(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case json.Number:
+		return v.String()
+	default:
+		text := CellText(v)
+		if dialect == "mysql" {
+			text = strings.ReplaceAll(text, `\`, `\\`)
+		}
+		return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+	}
+}
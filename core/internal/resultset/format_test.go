@@ -0,0 +1,102 @@
+package resultset
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func formatSet() Set {
+	return Set{
+		Columns: []Column{{Name: "id"}, {Name: "name"}, {Name: "active"}, {Name: "seen_at"}},
+		Rows: [][]any{
+			{int64(1), "O'Brien | Co", true, time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+			{int64(2), "<b>Bob</b>", false, nil},
+			{int64(3), "Carol", nil, nil},
+		},
+	}
+}
+
+func TestFormatMarkdownEscapesPipes(t *testing.T) {
+	text, err := Format(formatSet(), FormatRequest{Format: "markdown", RowEnd: 1, Columns: []string{"id", "name"}})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	want := "| id | name |\n| --- | --- |\n| 1 | O'Brien \\| Co |\n"
+	if text != want {
+		t.Fatalf("unexpected markdown:\n%q\nwant\n%q", text, want)
+	}
+}
+
+func TestFormatHTMLEscapes(t *testing.T) {
+	text, err := Format(formatSet(), FormatRequest{Format: "html", Rows: []int{1}, Columns: []string{"name"}})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	if !strings.Contains(text, "<td>&lt;b&gt;Bob&lt;/b&gt;</td>") {
+		t.Fatalf("expected escaped cell, got %s", text)
+	}
+}
+
+func TestFormatJSONKeepsColumnOrder(t *testing.T) {
+	text, err := Format(formatSet(), FormatRequest{Format: "json", Rows: []int{2}, Columns: []string{"name", "id", "active"}})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	want := "[\n  {\"name\": \"Carol\", \"id\": 3, \"active\": null}\n]\n"
+	if text != want {
+		t.Fatalf("unexpected json:\n%q\nwant\n%q", text, want)
+	}
+}
+
+func TestFormatCSVAndTSV(t *testing.T) {
+	noHeader := false
+	text, err := Format(formatSet(), FormatRequest{Format: "tsv", RowStart: 1, RowEnd: 2, IncludeHeader: &noHeader})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	if text != "2\t<b>Bob</b>\tfalse\t\n" {
+		t.Fatalf("unexpected tsv %q", text)
+	}
+
+	text, err = Format(formatSet(), FormatRequest{Format: "csv", RowEnd: 1, Columns: []string{"name"}})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	if text != "name\nO'Brien | Co\n" {
+		t.Fatalf("unexpected csv %q", text)
+	}
+}
+
+func TestFormatInsertPerDialect(t *testing.T) {
+	text, err := Format(formatSet(), FormatRequest{Format: "insert", TableName: "public.people", RowEnd: 2})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	want := `INSERT INTO "public"."people" ("id", "name", "active", "seen_at") VALUES (1, 'O''Brien | Co', TRUE, '2024-05-01T08:00:00Z');`
+	if lines[0] != want {
+		t.Fatalf("unexpected insert:\n%s\nwant\n%s", lines[0], want)
+	}
+
+	text, err = Format(formatSet(), FormatRequest{Format: "insert", Dialect: "mysql", TableName: "people", Rows: []int{1}, Columns: []string{"active"}})
+	if err != nil {
+		t.Fatalf("Format returned error: %v", err)
+	}
+	if text != "INSERT INTO `people` (`active`) VALUES (FALSE);\n" {
+		t.Fatalf("unexpected mysql insert %q", text)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	cases := map[string]FormatRequest{
+		"unknown format": {Format: "yaml"},
+		"unknown column": {Format: "csv", Columns: []string{"missing"}},
+		"row range":      {Format: "csv", Rows: []int{10}},
+	}
+	for name, req := range cases {
+		if _, err := Format(formatSet(), req); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package resultset
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/fluxgrid/core/internal/jsonpath"
+)
+
+// maxExpandColumns caps the columns ExpandJSON discovers from object keys.
+const maxExpandColumns = 100
+
+// JSONColumn is one value to pull out of a JSON column.
+type JSONColumn struct {
+	// Path is a JSON path such as $.address.city or $.tags[0].
+	Path string `json:"path" jsonschema:"required"`
+	// As names the new column. It defaults to the source column followed by the path.
+	As string `json:"as,omitempty"`
+}
+
+// ExpandRequest configures ExpandJSON.
+type ExpandRequest struct {
+	Column string `json:"column" jsonschema:"required"`
+	// Paths lists the values to extract. Empty extracts every top-level key found in the
+	// column's objects, ordered by the first row that has each key and then by name.
+	Paths []JSONColumn `json:"paths"`
+}
+
+// ExpandJSON returns a copy of set with a column for each requested path, placed after the
+// JSON column. Cells may hold decoded documents or JSON text; a cell that is not JSON, or
+// lacks the path, yields NULL. Objects and arrays are kept as JSON values.
+func ExpandJSON(set Set, req ExpandRequest) (Set, error) {
+	src := set.ColumnIndex(req.Column)
+	if src < 0 {
+		return Set{}, fmt.Errorf("column %q not found", req.Column)
+	}
+
+	docs := make([]any, len(set.Rows))
+	for r, row := range set.Rows {
+		if src < len(row) {
+			// Cells that are not JSON are left NULL.
+			docs[r], _ = jsonpath.Decode(row[src])
+		}
+	}
+
+	paths := req.Paths
+	if len(paths) == 0 {
+		paths = topLevelKeys(docs)
+	}
+	parsed := make([]jsonpath.Path, len(paths))
+	for i, p := range paths {
+		var err error
+		if parsed[i], err = jsonpath.Parse(p.Path); err != nil {
+			return Set{}, err
+		}
+	}
+
+	taken := make(map[string]bool, len(set.Columns)+len(paths))
+	for _, col := range set.Columns {
+		taken[col.Name] = true
+	}
+	added := make([]Column, len(paths))
+	for i, p := range paths {
+		base := p.As
+		if base == "" {
+			base = req.Column + parsed[i].String()[1:]
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = base + "_" + strconv.Itoa(n)
+		}
+		taken[name] = true
+		added[i] = Column{Name: name}
+	}
+
+	expanded := Set{Columns: make([]Column, 0, len(set.Columns)+len(added))}
+	expanded.Columns = append(expanded.Columns, set.Columns[:src+1]...)
+	expanded.Columns = append(expanded.Columns, added...)
+	expanded.Columns = append(expanded.Columns, set.Columns[src+1:]...)
+
+	expanded.Rows = make([][]any, len(set.Rows))
+	for r, row := range set.Rows {
+		out := make([]any, 0, len(row)+len(added))
+		head := min(src+1, len(row))
+		out = append(out, row[:head]...)
+		for _, path := range parsed {
+			value, _ := path.Eval(docs[r])
+			out = append(out, value)
+		}
+		out = append(out, row[head:]...)
+		expanded.Rows[r] = out
+	}
+	return expanded, nil
+}
+
+// topLevelKeys lists the keys of the objects in docs, ordered by the first row that has each
+// key and then by name.
+func topLevelKeys(docs []any) []JSONColumn {
+	seen := map[string]bool{}
+	var columns []JSONColumn
+	for _, doc := range docs {
+		object, ok := doc.(map[string]any)
+		if !ok {
+			continue
+		}
+		var fresh []string
+		for key := range object {
+			if !seen[key] {
+				fresh = append(fresh, key)
+			}
+		}
+		sort.Strings(fresh)
+		for _, key := range fresh {
+			if len(columns) == maxExpandColumns {
+				return columns
+			}
+			seen[key] = true
+			columns = append(columns, JSONColumn{Path: jsonpath.Path{{Key: key}}.String()})
+		}
+	}
+	return columns
+}
@@ -0,0 +1,62 @@
+package resultset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandJSONAddsPathColumns(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "id", DataType: "23"}, {Name: "doc", DataType: "3802"}, {Name: "note", DataType: "25"}},
+		Rows: [][]any{
+			{int64(1), map[string]any{"user": map[string]any{"name": "Ann"}, "tags": []any{"a", "b"}}, "x"},
+			{int64(2), `{"user":{"name":"Bo"},"tags":[]}`, "y"},
+			{int64(3), "not json", "z"},
+			{int64(4), nil, "w"},
+		},
+	}
+	expanded, err := ExpandJSON(set, ExpandRequest{
+		Column: "doc",
+		Paths:  []JSONColumn{{Path: "$.user.name"}, {Path: "$.tags[0]", As: "note"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(expanded.Columns))
+	for i, col := range expanded.Columns {
+		names[i] = col.Name
+	}
+	if want := []string{"id", "doc", "doc.user.name", "note_2", "note"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("columns = %v, want %v", names, want)
+	}
+	if got, want := column(expanded, 2), []any{"Ann", "Bo", nil, nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	if got, want := column(expanded, 3), []any{"a", nil, nil, nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first tags = %v, want %v", got, want)
+	}
+	if got := column(expanded, 4); !reflect.DeepEqual(got, []any{"x", "y", "z", "w"}) {
+		t.Errorf("trailing column moved: %v", got)
+	}
+}
+
+func TestExpandJSONDiscoversTopLevelKeys(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "doc"}},
+		Rows:    [][]any{{`{"b":1,"a":2}`}, {`{"c":{"d":true},"a":3}`}, {`[1]`}},
+	}
+	expanded, err := ExpandJSON(set, ExpandRequest{Column: "doc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, col := range expanded.Columns[1:] {
+		names = append(names, col.Name)
+	}
+	if want := []string{"doc.a", "doc.b", "doc.c"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("columns = %v, want %v", names, want)
+	}
+	if got, want := expanded.Rows[1][1:], []any{int64(3), nil, map[string]any{"d": true}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second row = %v, want %v", got, want)
+	}
+}
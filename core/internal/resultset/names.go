@@ -0,0 +1,41 @@
+package resultset
+
+import "strconv"
+
+// DisambiguateNames returns a copy of columns in which every name is unique. A duplicated
+// name is qualified with its origin table when that makes it unique (users.id, orders.id);
+// otherwise later occurrences get a numeric suffix (id, id_2). Unique names are kept.
+func DisambiguateNames(columns []Column) []Column {
+	counts := make(map[string]int, len(columns))
+	for _, col := range columns {
+		counts[col.Name]++
+	}
+
+	out := make([]Column, len(columns))
+	copy(out, columns)
+
+	taken := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		if counts[col.Name] == 1 {
+			taken[col.Name] = true
+		}
+	}
+
+	for i, col := range out {
+		if counts[col.Name] == 1 {
+			continue
+		}
+		name := col.Name
+		if col.Origin != nil && col.Origin.Table != "" {
+			if qualified := col.Origin.Table + "." + col.Name; !taken[qualified] {
+				name = qualified
+			}
+		}
+		for n := 2; taken[name]; n++ {
+			name = col.Name + "_" + strconv.Itoa(n)
+		}
+		taken[name] = true
+		out[i].Name = name
+	}
+	return out
+}
@@ -0,0 +1,25 @@
+package resultset
+
+import "testing"
+
+func TestDisambiguateNames(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Origin: &ColumnOrigin{Table: "users", Column: "id"}},
+		{Name: "name"},
+		{Name: "id", Origin: &ColumnOrigin{Table: "orders", Column: "id"}},
+		{Name: "total"},
+		{Name: "total"},
+		{Name: "id", Origin: &ColumnOrigin{Table: "orders", Column: "id"}},
+	}
+
+	got := DisambiguateNames(columns)
+	want := []string{"users.id", "name", "orders.id", "total", "total_2", "id"}
+	for i, col := range got {
+		if col.Name != want[i] {
+			t.Fatalf("column %d: got %q, want %q (all %+v)", i, col.Name, want[i], got)
+		}
+	}
+	if columns[0].Name != "id" {
+		t.Fatal("expected input columns to be left untouched")
+	}
+}
@@ -0,0 +1,439 @@
+package resultset
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Aggregate describes one aggregation applied per group.
+type Aggregate struct {
+	// Func is one of count, countDistinct, sum, avg, min, max.
+	Func string `json:"fn"`
+	// Column is the aggregated column; it may be empty for count.
+	Column string `json:"column"`
+	// As overrides the generated series name.
+	As string `json:"as"`
+}
+
+// TimeBucket truncates a temporal column to the given unit before grouping.
+type TimeBucket struct {
+	Column string `json:"column"`
+	// Unit is one of minute, hour, day, week, month, year.
+	Unit string `json:"unit"`
+}
+
+// PivotRequest configures Pivot.
+type PivotRequest struct {
+	GroupBy    []string    `json:"groupBy"`
+	TimeBucket *TimeBucket `json:"timeBucket"`
+	// SeriesBy splits every aggregate into one series per distinct value of the column.
+	SeriesBy   string      `json:"seriesBy"`
+	Aggregates []Aggregate `json:"aggregates"`
+	// MaxCategories caps the number of groups returned. Zero means unlimited.
+	MaxCategories int `json:"maxCategories"`
+}
+
+// Series is one chartable line: values align index-for-index with PivotResult.Categories.
+type Series struct {
+	Name      string `json:"name"`
+	Aggregate string `json:"aggregate"`
+	Column    string `json:"column,omitempty"`
+	SeriesKey any    `json:"seriesKey,omitempty"`
+	Values    []any  `json:"values"`
+}
+
+// PivotResult is a compact, chart-friendly aggregation.
+type PivotResult struct {
+	Dimensions []string `json:"dimensions"`
+	Categories [][]any  `json:"categories"`
+	Series     []Series `json:"series"`
+	SourceRows int      `json:"sourceRows"`
+	Truncated  bool     `json:"truncated"`
+}
+
+type accumulator struct {
+	count    int
+	sum      float64
+	numeric  int
+	min, max any
+	distinct map[string]struct{}
+}
+
+// Pivot groups the set by the requested dimensions and computes aggregates per group
+// (and per seriesBy value when set). Categories are sorted ascending by their key.
+func Pivot(set Set, req PivotRequest) (PivotResult, error) {
+	if len(req.Aggregates) == 0 {
+		req.Aggregates = []Aggregate{{Func: "count"}}
+	}
+
+	type dimension struct {
+		name   string
+		index  int
+		bucket string
+	}
+
+	var dims []dimension
+	if req.TimeBucket != nil {
+		idx := set.ColumnIndex(req.TimeBucket.Column)
+		if idx < 0 {
+			return PivotResult{}, fmt.Errorf("time bucket column %q not found", req.TimeBucket.Column)
+		}
+		if !validBucketUnit(req.TimeBucket.Unit) {
+			return PivotResult{}, fmt.Errorf("unsupported time bucket unit %q", req.TimeBucket.Unit)
+		}
+		dims = append(dims, dimension{name: req.TimeBucket.Column, index: idx, bucket: req.TimeBucket.Unit})
+	}
+	for _, name := range req.GroupBy {
+		idx := set.ColumnIndex(name)
+		if idx < 0 {
+			return PivotResult{}, fmt.Errorf("group column %q not found", name)
+		}
+		dims = append(dims, dimension{name: name, index: idx})
+	}
+
+	seriesIdx := -1
+	if req.SeriesBy != "" {
+		if seriesIdx = set.ColumnIndex(req.SeriesBy); seriesIdx < 0 {
+			return PivotResult{}, fmt.Errorf("series column %q not found", req.SeriesBy)
+		}
+	}
+
+	aggIdx := make([]int, len(req.Aggregates))
+	for i, agg := range req.Aggregates {
+		if !validAggregate(agg.Func) {
+			return PivotResult{}, fmt.Errorf("unsupported aggregate %q", agg.Func)
+		}
+		aggIdx[i] = -1
+		if agg.Column == "" {
+			if agg.Func != "count" {
+				return PivotResult{}, fmt.Errorf("aggregate %s requires a column", agg.Func)
+			}
+			continue
+		}
+		if aggIdx[i] = set.ColumnIndex(agg.Column); aggIdx[i] < 0 {
+			return PivotResult{}, fmt.Errorf("aggregate column %q not found", agg.Column)
+		}
+	}
+
+	var (
+		categories   = map[string][]any{}
+		categoryKeys []string
+		seriesKeys   = map[string]any{}
+		seriesOrder  []string
+		accs         = map[string][]*accumulator{}
+	)
+
+	keyParts := make([]string, len(dims))
+	for _, row := range set.Rows {
+		category := make([]any, len(dims))
+		skip := false
+		for i, dim := range dims {
+			value := row[dim.index]
+			if dim.bucket != "" {
+				ts, ok := toTime(value)
+				if !ok {
+					skip = true
+					break
+				}
+				value = truncateTime(ts, dim.bucket).Format(time.RFC3339)
+			}
+			category[i] = value
+			keyParts[i] = valueKey(value)
+		}
+		if skip {
+			continue
+		}
+		catKey := strings.Join(keyParts, "\x1f")
+		if _, ok := categories[catKey]; !ok {
+			categories[catKey] = category
+			categoryKeys = append(categoryKeys, catKey)
+		}
+
+		seriesKey := ""
+		if seriesIdx >= 0 {
+			seriesKey = valueKey(row[seriesIdx])
+			if _, ok := seriesKeys[seriesKey]; !ok {
+				seriesKeys[seriesKey] = row[seriesIdx]
+				seriesOrder = append(seriesOrder, seriesKey)
+			}
+		}
+
+		cellKey := catKey + "\x1e" + seriesKey
+		group, ok := accs[cellKey]
+		if !ok {
+			group = make([]*accumulator, len(req.Aggregates))
+			for i := range group {
+				group[i] = &accumulator{}
+			}
+			accs[cellKey] = group
+		}
+		for i, agg := range req.Aggregates {
+			var value any
+			if aggIdx[i] >= 0 {
+				value = row[aggIdx[i]]
+			}
+			group[i].add(agg.Func, value, aggIdx[i] < 0)
+		}
+	}
+
+	sort.SliceStable(categoryKeys, func(i, j int) bool {
+		return compareCategory(categories[categoryKeys[i]], categories[categoryKeys[j]]) < 0
+	})
+	sort.SliceStable(seriesOrder, func(i, j int) bool {
+		return compareValues(seriesKeys[seriesOrder[i]], seriesKeys[seriesOrder[j]]) < 0
+	})
+
+	result := PivotResult{
+		Dimensions: make([]string, len(dims)),
+		SourceRows: len(set.Rows),
+	}
+	for i, dim := range dims {
+		result.Dimensions[i] = dim.name
+	}
+	if req.MaxCategories > 0 && len(categoryKeys) > req.MaxCategories {
+		categoryKeys = categoryKeys[:req.MaxCategories]
+		result.Truncated = true
+	}
+	result.Categories = make([][]any, len(categoryKeys))
+	for i, key := range categoryKeys {
+		result.Categories[i] = categories[key]
+	}
+
+	if seriesIdx < 0 {
+		seriesOrder = []string{""}
+	}
+	for i, agg := range req.Aggregates {
+		for _, sk := range seriesOrder {
+			series := Series{
+				Name:      seriesName(agg, seriesKeys[sk], seriesIdx >= 0),
+				Aggregate: agg.Func,
+				Column:    agg.Column,
+				Values:    make([]any, len(categoryKeys)),
+			}
+			if seriesIdx >= 0 {
+				series.SeriesKey = seriesKeys[sk]
+			}
+			for c, catKey := range categoryKeys {
+				if group, ok := accs[catKey+"\x1e"+sk]; ok {
+					series.Values[c] = group[i].result(agg.Func)
+				}
+			}
+			result.Series = append(result.Series, series)
+		}
+	}
+
+	return result, nil
+}
+
+func (a *accumulator) add(fn string, value any, countRows bool) {
+	if countRows {
+		a.count++
+		return
+	}
+	if value == nil {
+		return
+	}
+	a.count++
+	switch fn {
+	case "sum", "avg":
+		if f, ok := toFloat(value); ok {
+			a.sum += f
+			a.numeric++
+		}
+	case "min":
+		if a.min == nil || compareValues(value, a.min) < 0 {
+			a.min = value
+		}
+	case "max":
+		if a.max == nil || compareValues(value, a.max) > 0 {
+			a.max = value
+		}
+	case "countDistinct":
+		if a.distinct == nil {
+			a.distinct = make(map[string]struct{})
+		}
+		a.distinct[valueKey(value)] = struct{}{}
+	}
+}
+
+func (a *accumulator) result(fn string) any {
+	switch fn {
+	case "count":
+		return a.count
+	case "countDistinct":
+		return len(a.distinct)
+	case "sum":
+		if a.numeric == 0 {
+			return nil
+		}
+		return a.sum
+	case "avg":
+		if a.numeric == 0 {
+			return nil
+		}
+		return a.sum / float64(a.numeric)
+	case "min":
+		return a.min
+	case "max":
+		return a.max
+	default:
+		return nil
+	}
+}
+
+func seriesName(agg Aggregate, seriesKey any, split bool) string {
+	name := agg.As
+	if name == "" {
+		column := agg.Column
+		if column == "" {
+			column = "*"
+		}
+		name = fmt.Sprintf("%s(%s)", agg.Func, column)
+	}
+	if split {
+		name = fmt.Sprintf("%s [%v]", name, seriesKey)
+	}
+	return name
+}
+
+func validAggregate(fn string) bool {
+	switch fn {
+	case "count", "countDistinct", "sum", "avg", "min", "max":
+		return true
+	default:
+		return false
+	}
+}
+
+func validBucketUnit(unit string) bool {
+	switch unit {
+	case "minute", "hour", "day", "week", "month", "year":
+		return true
+	default:
+		return false
+	}
+}
+
+func truncateTime(ts time.Time, unit string) time.Time {
+	ts = ts.UTC()
+	switch unit {
+	case "minute":
+		return ts.Truncate(time.Minute)
+	case "hour":
+		return ts.Truncate(time.Hour)
+	case "day":
+		return time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC)
+	case "week":
+		day := time.Date(ts.Year(), ts.Month(), ts.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7 // ISO weeks start on Monday
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(ts.Year(), ts.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "year":
+		return time.Date(ts.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return ts
+	}
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func toTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range timeLayouts {
+			if ts, err := time.Parse(layout, v); err == nil {
+				return ts, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil && !math.IsNaN(f)
+	default:
+		return 0, false
+	}
+}
+
+// compareValues orders nulls first, then numbers numerically, then everything else by its
+// printed form.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareCategory(a, b []any) int {
+	for i := range a {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,96 @@
+package resultset
+
+import (
+	"testing"
+	"time"
+)
+
+func salesSet() Set {
+	return Set{
+		Columns: []Column{{Name: "sold_at"}, {Name: "region"}, {Name: "amount"}},
+		Rows: [][]any{
+			{"2024-01-01T10:00:00Z", "east", int64(10)},
+			{"2024-01-01T12:30:00Z", "west", "5.5"},
+			{time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC), "east", float64(4)},
+			{"2024-01-02 18:00:00", "east", nil},
+			{"not a date", "east", int64(100)},
+		},
+	}
+}
+
+func TestPivotTimeBucketWithSeries(t *testing.T) {
+	result, err := Pivot(salesSet(), PivotRequest{
+		TimeBucket: &TimeBucket{Column: "sold_at", Unit: "day"},
+		SeriesBy:   "region",
+		Aggregates: []Aggregate{{Func: "sum", Column: "amount"}},
+	})
+	if err != nil {
+		t.Fatalf("Pivot returned error: %v", err)
+	}
+
+	if len(result.Categories) != 2 {
+		t.Fatalf("expected 2 day buckets, got %v", result.Categories)
+	}
+	if result.Categories[0][0] != "2024-01-01T00:00:00Z" || result.Categories[1][0] != "2024-01-02T00:00:00Z" {
+		t.Fatalf("unexpected bucket labels %v", result.Categories)
+	}
+	if len(result.Series) != 2 {
+		t.Fatalf("expected one series per region, got %d", len(result.Series))
+	}
+
+	east, west := result.Series[0], result.Series[1]
+	if east.SeriesKey != "east" || east.Values[0] != float64(10) || east.Values[1] != float64(4) {
+		t.Fatalf("unexpected east series %+v", east)
+	}
+	if west.Values[0] != 5.5 || west.Values[1] != nil {
+		t.Fatalf("unexpected west series %+v", west)
+	}
+}
+
+func TestPivotGroupByMultipleAggregates(t *testing.T) {
+	result, err := Pivot(salesSet(), PivotRequest{
+		GroupBy: []string{"region"},
+		Aggregates: []Aggregate{
+			{Func: "count"},
+			{Func: "count", Column: "amount"},
+			{Func: "max", Column: "amount", As: "largest"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Pivot returned error: %v", err)
+	}
+
+	if len(result.Categories) != 2 || result.Categories[0][0] != "east" {
+		t.Fatalf("unexpected categories %v", result.Categories)
+	}
+	if got := result.Series[0].Values[0]; got != 4 {
+		t.Fatalf("expected 4 east rows, got %v", got)
+	}
+	if got := result.Series[1].Values[0]; got != 3 {
+		t.Fatalf("expected 3 non-null east amounts, got %v", got)
+	}
+	if result.Series[2].Name != "largest" || result.Series[2].Values[0] != int64(100) {
+		t.Fatalf("unexpected max series %+v", result.Series[2])
+	}
+}
+
+func TestPivotValidation(t *testing.T) {
+	cases := map[string]PivotRequest{
+		"unknown group":     {GroupBy: []string{"missing"}},
+		"unknown aggregate": {Aggregates: []Aggregate{{Func: "median", Column: "amount"}}},
+		"sum without col":   {Aggregates: []Aggregate{{Func: "sum"}}},
+		"bad bucket unit":   {TimeBucket: &TimeBucket{Column: "sold_at", Unit: "fortnight"}},
+	}
+	for name, req := range cases {
+		if _, err := Pivot(salesSet(), req); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestTruncateTimeWeekStartsMonday(t *testing.T) {
+	sunday := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+	if got := truncateTime(sunday, "week"); !got.Equal(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected week start %v", got)
+	}
+}
@@ -0,0 +1,44 @@
+package resultset
+
+import "fmt"
+
+// Column describes a result column.
+type Column struct {
+	Name     string        `json:"name"`
+	DataType string        `json:"dataType"`
+	Origin   *ColumnOrigin `json:"origin,omitempty"`
+}
+
+// ColumnOrigin identifies the table column a result column was read from. It is only known
+// for plain column references; expressions and aggregates have no origin.
+type ColumnOrigin struct {
+	TableOID uint32 `json:"tableOid,omitempty"`
+	Schema   string `json:"schema,omitempty"`
+	Table    string `json:"table,omitempty"`
+	Column   string `json:"column,omitempty"`
+}
+
+// Set is a materialized query result.
+type Set struct {
+	Columns []Column
+	Rows    [][]any
+}
+
+// ColumnIndex returns the position of the named column or -1 when it is absent.
+func (s Set) ColumnIndex(name string) int {
+	for i, col := range s.Columns {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// valueKey renders a cell in a driver-neutral form so values produced by different drivers
+// (for example int64 from pgx and string from MySQL) compare equal when they print equally.
+func valueKey(value any) string {
+	if value == nil {
+		return "\x00null"
+	}
+	return fmt.Sprint(value)
+}
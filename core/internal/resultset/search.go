@@ -0,0 +1,134 @@
+package resultset
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// SearchRequest configures Search.
+type SearchRequest struct {
+	Query         string `json:"query"`
+	Regex         bool   `json:"regex"`
+	CaseSensitive bool   `json:"caseSensitive"`
+	// Columns restricts the search to the named columns. Empty searches every column.
+	Columns []string `json:"columns"`
+	// StartRow skips rows before the given index so clients can page through matches.
+	StartRow int `json:"startRow"`
+	// MaxMatches caps the number of reported cell matches. Zero means unlimited.
+	MaxMatches int `json:"maxMatches"`
+}
+
+// CellMatch locates a match inside a cell. Start and End count UTF-16 code units of the
+// cell text, as JavaScript string indices do, so clients can highlight the match directly.
+type CellMatch struct {
+	Row    int    `json:"row"`
+	Column int    `json:"column"`
+	Name   string `json:"name"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+// SearchResult lists matching cells in row-major order.
+type SearchResult struct {
+	Matches []CellMatch `json:"matches"`
+	Rows    []int       `json:"rows"`
+	// NextRow is the row to resume from when Truncated is set.
+	NextRow   int  `json:"nextRow,omitempty"`
+	Truncated bool `json:"truncated"`
+}
+
+// Search scans every row of the set for the query and reports matching cells. Cells are
+// matched against their printed form; NULL cells never match.
+func Search(set Set, req SearchRequest) (SearchResult, error) {
+	if req.Query == "" {
+		return SearchResult{}, fmt.Errorf("query is required")
+	}
+
+	pattern := req.Query
+	if !req.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !req.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return SearchResult{}, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	columns := make([]int, 0, len(set.Columns))
+	if len(req.Columns) == 0 {
+		for i := range set.Columns {
+			columns = append(columns, i)
+		}
+	} else {
+		for _, name := range req.Columns {
+			idx := set.ColumnIndex(name)
+			if idx < 0 {
+				return SearchResult{}, fmt.Errorf("column %q not found", name)
+			}
+			columns = append(columns, idx)
+		}
+	}
+
+	start := req.StartRow
+	if start < 0 {
+		start = 0
+	}
+
+	result := SearchResult{Matches: []CellMatch{}, Rows: []int{}}
+	for r := start; r < len(set.Rows); r++ {
+		row := set.Rows[r]
+		var rowMatches []CellMatch
+		for _, c := range columns {
+			if c >= len(row) || row[c] == nil {
+				continue
+			}
+			text := fmt.Sprint(row[c])
+			// Byte offsets are converted as the matches advance through the text.
+			offset, units := 0, 0
+			for _, loc := range re.FindAllStringIndex(text, -1) {
+				if loc[0] == loc[1] {
+					continue
+				}
+				units += utf16Len(text[offset:loc[0]])
+				start := units
+				units += utf16Len(text[loc[0]:loc[1]])
+				offset = loc[1]
+				rowMatches = append(rowMatches, CellMatch{
+					Row:    r,
+					Column: c,
+					Name:   set.Columns[c].Name,
+					Start:  start,
+					End:    units,
+				})
+			}
+		}
+		if len(rowMatches) == 0 {
+			continue
+		}
+		// Rows are reported whole so a page never splits one row's matches.
+		if req.MaxMatches > 0 && len(result.Matches) > 0 && len(result.Matches)+len(rowMatches) > req.MaxMatches {
+			result.Truncated = true
+			result.NextRow = r
+			break
+		}
+		result.Matches = append(result.Matches, rowMatches...)
+		result.Rows = append(result.Rows, r)
+	}
+
+	return result, nil
+}
+
+// utf16Len returns the number of UTF-16 code units encoding s. Runes outside the Basic
+// Multilingual Plane, such as most emoji, take a surrogate pair.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n++
+		if r > 0xFFFF {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,87 @@
+package resultset
+
+import "testing"
+
+func peopleSet() Set {
+	return Set{
+		Columns: []Column{{Name: "id"}, {Name: "name"}, {Name: "email"}},
+		Rows: [][]any{
+			{int64(1), "Alice", "alice@example.com"},
+			{int64(2), "Bob", nil},
+			{int64(3), "Malice", "mal@example.org"},
+			{int64(4), "Carol", "carol@example.com"},
+		},
+	}
+}
+
+func TestSearchSubstringCaseInsensitive(t *testing.T) {
+	result, err := Search(peopleSet(), SearchRequest{Query: "ALICE"})
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+
+	if len(result.Rows) != 2 || result.Rows[0] != 0 || result.Rows[1] != 2 {
+		t.Fatalf("unexpected matching rows %v", result.Rows)
+	}
+	first := result.Matches[0]
+	if first.Name != "name" || first.Start != 0 || first.End != 5 {
+		t.Fatalf("unexpected first match %+v", first)
+	}
+	if len(result.Matches) != 3 {
+		t.Fatalf("expected 3 cell matches, got %+v", result.Matches)
+	}
+}
+
+func TestSearchReportsUTF16Offsets(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "note"}},
+		Rows:    [][]any{{"café 東京 🎉 café"}},
+	}
+	result, err := Search(set, SearchRequest{Query: "CAFÉ"})
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	// "café 東京 " is 8 code units and the emoji a surrogate pair, as in JavaScript.
+	if len(result.Matches) != 2 || result.Matches[0].Start != 0 || result.Matches[0].End != 4 ||
+		result.Matches[1].Start != 11 || result.Matches[1].End != 15 {
+		t.Fatalf("unexpected matches %+v", result.Matches)
+	}
+
+	result, _ = Search(set, SearchRequest{Query: "東京 🎉"})
+	if len(result.Matches) != 1 || result.Matches[0].Start != 5 || result.Matches[0].End != 10 {
+		t.Fatalf("unexpected match %+v", result.Matches)
+	}
+}
+
+func TestSearchRegexColumnsAndPaging(t *testing.T) {
+	req := SearchRequest{Query: `\.com$`, Regex: true, Columns: []string{"email"}, MaxMatches: 1}
+
+	page, err := Search(peopleSet(), req)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if !page.Truncated || page.NextRow != 3 || len(page.Rows) != 1 {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+
+	req.StartRow = page.NextRow
+	page, err = Search(peopleSet(), req)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if page.Truncated || len(page.Rows) != 1 || page.Rows[0] != 3 {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	if _, err := Search(peopleSet(), SearchRequest{}); err == nil {
+		t.Fatal("expected error for empty query")
+	}
+	if _, err := Search(peopleSet(), SearchRequest{Query: "(", Regex: true}); err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+	if _, err := Search(peopleSet(), SearchRequest{Query: "a", Columns: []string{"missing"}}); err == nil {
+		t.Fatal("expected error for unknown column")
+	}
+}
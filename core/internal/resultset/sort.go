@@ -0,0 +1,263 @@
+package resultset
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SortKey orders rows by one column.
+type SortKey struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc"`
+	// Nulls is "first" or "last". The default follows Postgres: last when ascending and
+	// first when descending.
+	Nulls string `json:"nulls,omitempty" jsonschema:"enum=first|last"`
+}
+
+// SortRequest configures Sort.
+type SortRequest struct {
+	Keys []SortKey `json:"keys"`
+	// Locale, a BCP 47 tag such as "de" or "sv-SE", orders text the way an ICU collation
+	// of that locale does. Empty compares bytes, like the C collation.
+	Locale string `json:"locale"`
+	// CaseInsensitive ignores case differences, which a locale otherwise orders lower
+	// case first.
+	CaseInsensitive bool `json:"caseInsensitive"`
+	// Numeric orders digit runs in text by their value, so "item10" follows "item9".
+	Numeric bool `json:"numeric"`
+}
+
+type columnKind uint8
+
+const (
+	kindText columnKind = iota
+	kindNumber
+	kindTime
+)
+
+// numericTypes and temporalTypes name column types by Postgres OID and by the type names
+// database/sql drivers report. Their cells are compared by value even when they were
+// cached as strings.
+var (
+	numericTypes = map[string]bool{
+		"20": true, "21": true, "23": true, "26": true, "700": true, "701": true, "1700": true,
+		"TINYINT": true, "SMALLINT": true, "MEDIUMINT": true, "INT": true, "INTEGER": true, "BIGINT": true,
+		"DECIMAL": true, "NUMERIC": true, "FLOAT": true, "DOUBLE": true, "REAL": true,
+		"UNSIGNED TINYINT": true, "UNSIGNED SMALLINT": true, "UNSIGNED MEDIUMINT": true,
+		"UNSIGNED INT": true, "UNSIGNED BIGINT": true,
+	}
+	temporalTypes = map[string]bool{
+		"1082": true, "1114": true, "1184": true,
+		"DATE": true, "DATETIME": true, "TIMESTAMP": true,
+	}
+)
+
+func columnKindOf(dataType string) columnKind {
+	dataType = strings.ToUpper(dataType)
+	switch {
+	case numericTypes[dataType]:
+		return kindNumber
+	case temporalTypes[dataType]:
+		return kindTime
+	}
+	return kindText
+}
+
+type sortColumn struct {
+	index      int
+	desc       bool
+	nullsFirst bool
+	kind       columnKind
+}
+
+// Sort returns a copy of set with its rows in the order of req. The sort is stable, so rows
+// with equal keys keep their order. Text is compared with the requested collation.
+func Sort(set Set, req SortRequest) (Set, error) {
+	if len(req.Keys) == 0 {
+		return Set{}, fmt.Errorf("at least one sort key is required")
+	}
+	var collator *collate.Collator
+	if req.Locale != "" || req.CaseInsensitive || req.Numeric {
+		tag := language.Und
+		if req.Locale != "" {
+			var err error
+			if tag, err = language.Parse(req.Locale); err != nil {
+				return Set{}, fmt.Errorf("invalid locale %q: %w", req.Locale, err)
+			}
+		}
+		var opts []collate.Option
+		if req.CaseInsensitive {
+			opts = append(opts, collate.IgnoreCase)
+		}
+		if req.Numeric {
+			opts = append(opts, collate.Numeric)
+		}
+		collator = collate.New(tag, opts...)
+	}
+
+	columns := make([]sortColumn, len(req.Keys))
+	for i, key := range req.Keys {
+		idx := set.ColumnIndex(key.Column)
+		if idx < 0 {
+			return Set{}, fmt.Errorf("column %q not found", key.Column)
+		}
+		columns[i] = sortColumn{index: idx, desc: key.Desc, nullsFirst: key.Desc}
+		switch key.Nulls {
+		case "":
+		case "first":
+			columns[i].nullsFirst = true
+		case "last":
+			columns[i].nullsFirst = false
+		default:
+			return Set{}, fmt.Errorf("nulls must be first or last, got %q", key.Nulls)
+		}
+		columns[i].kind = columnKindOf(set.Columns[idx].DataType)
+	}
+
+	// Keys are decoded once per row rather than once per comparison.
+	keys := make([][]sortValue, len(set.Rows))
+	for r, row := range set.Rows {
+		keys[r] = make([]sortValue, len(columns))
+		for i, col := range columns {
+			if col.index < len(row) {
+				keys[r][i] = newSortValue(row[col.index], col.kind, collator)
+			} else {
+				keys[r][i] = sortValue{null: true}
+			}
+		}
+	}
+	order := make([]int, len(set.Rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ka, kb := keys[order[a]], keys[order[b]]
+		for i, col := range columns {
+			if c := compareSortValues(ka[i], kb[i], col); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	sorted := Set{Columns: set.Columns, Rows: make([][]any, len(set.Rows))}
+	for i, r := range order {
+		sorted.Rows[i] = set.Rows[r]
+	}
+	return sorted, nil
+}
+
+// sortValue is a cell prepared for comparison. Exactly one representation is set.
+type sortValue struct {
+	null   bool
+	number *big.Rat
+	time   time.Time
+	isTime bool
+	bool   *bool
+	// text holds the collation key, or the text itself when comparing bytes.
+	text []byte
+}
+
+func newSortValue(value any, kind columnKind, collator *collate.Collator) sortValue {
+	switch v := value.(type) {
+	case nil:
+		return sortValue{null: true}
+	case bool:
+		return sortValue{bool: &v}
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		if r, ok := new(big.Rat).SetString(fmt.Sprint(v)); ok {
+			return sortValue{number: r}
+		}
+	case time.Time:
+		return sortValue{time: v, isTime: true}
+	}
+
+	text := fmt.Sprint(value)
+	if b, ok := value.([]byte); ok {
+		text = string(b)
+	}
+	switch kind {
+	case kindNumber:
+		if r, ok := new(big.Rat).SetString(strings.TrimSpace(text)); ok {
+			return sortValue{number: r}
+		}
+	case kindTime:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, text); err == nil {
+				return sortValue{time: t, isTime: true}
+			}
+		}
+	}
+	if collator != nil {
+		var buf collate.Buffer
+		return sortValue{text: append([]byte(nil), collator.KeyFromString(&buf, text)...)}
+	}
+	return sortValue{text: []byte(text)}
+}
+
+func compareSortValues(a, b sortValue, col sortColumn) int {
+	switch {
+	case a.null && b.null:
+		return 0
+	case a.null:
+		if col.nullsFirst {
+			return -1
+		}
+		return 1
+	case b.null:
+		if col.nullsFirst {
+			return 1
+		}
+		return -1
+	}
+	c := compareNonNull(a, b)
+	if col.desc {
+		c = -c
+	}
+	return c
+}
+
+// compareNonNull compares two values. When a column mixes representations, numbers sort
+// before times, booleans and text.
+func compareNonNull(a, b sortValue) int {
+	if ra, rb := a.rank(), b.rank(); ra != rb {
+		return ra - rb
+	}
+	switch {
+	case a.number != nil:
+		return a.number.Cmp(b.number)
+	case a.isTime:
+		return a.time.Compare(b.time)
+	case a.bool != nil:
+		switch {
+		case *a.bool == *b.bool:
+			return 0
+		case !*a.bool:
+			return -1
+		default:
+			return 1
+		}
+	default:
+		return bytes.Compare(a.text, b.text)
+	}
+}
+
+func (v sortValue) rank() int {
+	switch {
+	case v.number != nil:
+		return 0
+	case v.isTime:
+		return 1
+	case v.bool != nil:
+		return 2
+	default:
+		return 3
+	}
+}
@@ -0,0 +1,86 @@
+package resultset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func column(set Set, idx int) []any {
+	out := make([]any, len(set.Rows))
+	for i, row := range set.Rows {
+		out[i] = row[idx]
+	}
+	return out
+}
+
+func TestSortCollatesText(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "name", DataType: "25"}},
+		Rows:    [][]any{{"zebra"}, {"Äpfel"}, {"apple"}, {nil}, {"Zoo"}, {"ångström"}},
+	}
+
+	byBytes, err := Sort(set, SortRequest{Keys: []SortKey{{Column: "name"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := column(byBytes, 0); !reflect.DeepEqual(got, []any{"Zoo", "apple", "zebra", "Äpfel", "ångström", nil}) {
+		t.Fatalf("unexpected byte order %v", got)
+	}
+
+	german, err := Sort(set, SortRequest{Keys: []SortKey{{Column: "name"}}, Locale: "de"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := column(german, 0); !reflect.DeepEqual(got, []any{"ångström", "Äpfel", "apple", "zebra", "Zoo", nil}) {
+		t.Fatalf("unexpected German order %v", got)
+	}
+
+	// Swedish sorts å and ä after z.
+	swedish, err := Sort(set, SortRequest{Keys: []SortKey{{Column: "name", Desc: true}}, Locale: "sv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := column(swedish, 0); !reflect.DeepEqual(got, []any{nil, "Äpfel", "ångström", "Zoo", "zebra", "apple"}) {
+		t.Fatalf("unexpected Swedish order %v", got)
+	}
+}
+
+func TestSortComparesNumbersAndTimesByValue(t *testing.T) {
+	set := Set{
+		Columns: []Column{{Name: "amount", DataType: "1700"}, {Name: "at", DataType: "1184"}, {Name: "n", DataType: "23"}},
+		Rows: [][]any{
+			{"10.5", "2024-01-02T00:00:00Z", int64(2)},
+			{"9", "2024-01-01T12:00:00.5Z", int64(10)},
+			{"-1", "2024-01-01T12:00:00Z", nil},
+		},
+	}
+	sorted, err := Sort(set, SortRequest{Keys: []SortKey{{Column: "amount"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := column(sorted, 0); !reflect.DeepEqual(got, []any{"-1", "9", "10.5"}) {
+		t.Fatalf("unexpected numeric order %v", got)
+	}
+	sorted, _ = Sort(set, SortRequest{Keys: []SortKey{{Column: "at"}}})
+	if got := column(sorted, 1); !reflect.DeepEqual(got, []any{"2024-01-01T12:00:00Z", "2024-01-01T12:00:00.5Z", "2024-01-02T00:00:00Z"}) {
+		t.Fatalf("unexpected time order %v", got)
+	}
+	sorted, _ = Sort(set, SortRequest{Keys: []SortKey{{Column: "n", Nulls: "first"}}})
+	if got := column(sorted, 2); !reflect.DeepEqual(got, []any{nil, int64(2), int64(10)}) {
+		t.Fatalf("unexpected integer order %v", got)
+	}
+}
+
+func TestSortRejectsBadRequests(t *testing.T) {
+	set := Set{Columns: []Column{{Name: "a"}}}
+	for _, req := range []SortRequest{
+		{},
+		{Keys: []SortKey{{Column: "missing"}}},
+		{Keys: []SortKey{{Column: "a", Nulls: "middle"}}},
+		{Keys: []SortKey{{Column: "a"}}, Locale: "not a locale!"},
+	} {
+		if _, err := Sort(set, req); err == nil {
+			t.Fatalf("expected %+v to be refused", req)
+		}
+	}
+}
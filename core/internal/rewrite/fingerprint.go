@@ -0,0 +1,162 @@
+package rewrite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// operators are the operators written with several punctuation characters, so that they
+// are kept together whatever the spacing around them.
+var operators = map[string]bool{
+	"<=": true, ">=": true, "<>": true, "!=": true, "::": true, "||": true, "->": true,
+	"->>": true, "#>": true, "#>>": true, "@>": true, "<@": true, "!~": true, "~*": true,
+	"!~*": true, "~~": true, "!~~": true, ":=": true, "=>": true,
+}
+
+// callers are the keywords written with a space before an opening parenthesis; after any
+// other word the parenthesis opens a function call or a column list.
+var callers = map[string]bool{
+	"in": true, "values": true, "as": true, "and": true, "or": true, "not": true, "on": true,
+	"from": true, "join": true, "where": true, "exists": true, "select": true, "using": true,
+	"over": true, "any": true, "all": true, "some": true, "when": true, "then": true,
+	"else": true, "with": true, "union": true, "set": true, "into": true, "returning": true,
+}
+
+// piece is a token of a normalized statement.
+type piece struct {
+	text  string
+	ident bool
+}
+
+// Fingerprint identifies statements that differ only in their literals, bind parameters,
+// whitespace, comments and the case of unquoted words: the runs of one query with
+// different values share a fingerprint. It is 16 hexadecimal digits.
+func Fingerprint(sql string) string {
+	sum := sha256.Sum256([]byte(Normalize(sql)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Normalize returns sql with comments dropped, unquoted words in lower case, string and
+// numeric literals and bind parameters replaced with ?, and single spaces between tokens
+// where they read naturally. Lists of values after IN collapse to (...), so that lists of
+// any length match, and trailing semicolons are dropped.
+func Normalize(sql string) string {
+	var toks []token
+	for _, tok := range lex(sql) {
+		if tok.significant() {
+			toks = append(toks, tok)
+		}
+	}
+	adjacent := func(i int) bool {
+		return i+1 < len(toks) && toks[i].end == toks[i+1].start
+	}
+
+	var pieces []piece
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		switch {
+		case tok.kind == tokString:
+			// A prefix such as E'', B'' or N'' belongs to the literal.
+			if n := len(pieces); n > 0 && i > 0 && adjacent(i-1) && pieces[n-1].ident && len(toks[i-1].text) == 1 &&
+				strings.ContainsAny(toks[i-1].text, "eEbBxXnN") {
+				pieces = pieces[:n-1]
+			}
+			pieces = append(pieces, piece{text: "?"})
+		case tok.kind == tokQuoted:
+			pieces = append(pieces, piece{text: sql[tok.start:tok.end], ident: true})
+		case tok.kind == tokWord && startsWithDigit(tok.text):
+			// Decimals lex as a number, a dot and a number.
+			if adjacent(i) && toks[i+1].text == "." {
+				i++
+				if adjacent(i) && toks[i+1].kind == tokWord && startsWithDigit(toks[i+1].text) {
+					i++
+				}
+			}
+			pieces = append(pieces, piece{text: "?"})
+		case tok.kind == tokWord:
+			pieces = append(pieces, piece{text: strings.ToLower(tok.text), ident: true})
+		case tok.text == "$" && adjacent(i) && toks[i+1].kind == tokWord && startsWithDigit(toks[i+1].text):
+			i++
+			pieces = append(pieces, piece{text: "?"})
+		case tok.text == ":" && adjacent(i) && toks[i+1].kind == tokWord && !startsWithDigit(toks[i+1].text) &&
+			(i == 0 || !adjacent(i-1) || toks[i-1].text != ":"):
+			i++
+			pieces = append(pieces, piece{text: "?"})
+		default:
+			op := tok.text
+			for n := 3; n > 1; n-- {
+				if text, ok := punctRun(toks[i:], n); ok && operators[text] {
+					op = text
+					i += n - 1
+					break
+				}
+			}
+			pieces = append(pieces, piece{text: op})
+		}
+	}
+
+	var collapsed []piece
+	for i := 0; i < len(pieces); i++ {
+		collapsed = append(collapsed, pieces[i])
+		if pieces[i].text != "in" || i+1 >= len(pieces) || pieces[i+1].text != "(" {
+			continue
+		}
+		j := i + 2
+		for j+1 < len(pieces) && pieces[j].text == "?" && pieces[j+1].text == "," {
+			j += 2
+		}
+		if j+1 < len(pieces) && pieces[j].text == "?" && pieces[j+1].text == ")" {
+			collapsed = append(collapsed, piece{text: "(...)"})
+			i = j + 1
+		}
+	}
+	for len(collapsed) > 0 && collapsed[len(collapsed)-1].text == ";" {
+		collapsed = collapsed[:len(collapsed)-1]
+	}
+
+	var b strings.Builder
+	for i, p := range collapsed {
+		if i > 0 && spaced(collapsed[i-1], p) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.text)
+	}
+	return b.String()
+}
+
+// punctRun joins the first n tokens of toks when they are punctuation written without
+// space between them.
+func punctRun(toks []token, n int) (string, bool) {
+	if len(toks) < n {
+		return "", false
+	}
+	var b strings.Builder
+	for i, tok := range toks[:n] {
+		if tok.kind != tokPunct || i > 0 && toks[i-1].end != tok.start {
+			return "", false
+		}
+		b.WriteString(tok.text)
+	}
+	return b.String(), true
+}
+
+// spaced reports whether a space separates two pieces of a normalized statement.
+func spaced(prev, p piece) bool {
+	switch prev.text {
+	case "(", ".", "::", "[":
+		return false
+	}
+	switch p.text {
+	case ",", ")", ".", "::", ";", "[", "]":
+		return false
+	case "(", "(...)":
+		return !prev.ident || callers[prev.text]
+	}
+	return true
+}
+
+func startsWithDigit(text string) bool {
+	return text != "" && unicode.IsDigit(rune(text[0]))
+}
@@ -0,0 +1,45 @@
+package rewrite
+
+import "testing"
+
+func TestNormalizeStripsLiteralsAndLayout(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM users WHERE id = 42":                                 "select * from users where id = ?",
+		"select *\n  from Users -- by id\n where ID=7;":                     "select * from users where id = ?",
+		"SELECT count(*) FROM t WHERE price >= 1.5 AND name <> E'it''s'":    "select count(*) from t where price >= ? and name <> ?",
+		`SELECT "Name", t.x::text FROM "My Table" t WHERE x IN (1, 2, 3)`:   `select "Name", t.x::text from "My Table" t where x in (...)`,
+		"SELECT a FROM t WHERE b = $1 AND c = ? AND d = :name AND e in (?)": "select a from t where b = ? and c = ? and d = ? and e in (...)",
+		"INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y')":                    "insert into t(a, b) values (?, ?), (?, ?)",
+		"SELECT data->>'key' FROM t WHERE x IN (SELECT 1)":                  "select data ->> ? from t where x in (select ?)",
+		"SELECT ((a)) /* hint */ FROM t":                                    "select ((a)) from t",
+	}
+	for in, want := range cases {
+		if got := Normalize(in); got != want {
+			t.Errorf("%q:\n got %q\nwant %q", in, got, want)
+		}
+	}
+}
+
+func TestFingerprintGroupsRunsOfOneQuery(t *testing.T) {
+	same := []string{
+		"SELECT * FROM orders WHERE status = 'open' AND id IN (1, 2)",
+		"select * from orders\nwhere status='closed' and id in (3)",
+		"SELECT * FROM orders WHERE status = $1 AND id IN ($2, $3, $4);",
+	}
+	for _, sql := range same[1:] {
+		if Fingerprint(sql) != Fingerprint(same[0]) {
+			t.Errorf("%q and %q have different fingerprints", sql, same[0])
+		}
+	}
+	for _, sql := range []string{
+		"SELECT * FROM orders WHERE status = 'open' OR id IN (1, 2)",
+		`SELECT * FROM "Orders" WHERE status = 'open' AND id IN (1, 2)`,
+	} {
+		if Fingerprint(sql) == Fingerprint(same[0]) {
+			t.Errorf("%q shares the fingerprint of %q", sql, same[0])
+		}
+	}
+	if fp := Fingerprint(same[0]); len(fp) != 16 {
+		t.Errorf("fingerprint = %q", fp)
+	}
+}
@@ -0,0 +1,184 @@
+package rewrite
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokQuoted
+	tokString
+	tokPunct
+	tokSpace
+	tokComment
+)
+
+// token is a piece of SQL with its byte offsets, so that rules can splice the text.
+type token struct {
+	kind       tokenKind
+	start, end int
+	// text is the identifier of a word or quoted token, unquoted.
+	text string
+}
+
+func (t token) is(keyword string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t token) isAny(keywords ...string) bool {
+	for _, keyword := range keywords {
+		if t.is(keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t token) ident() bool {
+	return t.kind == tokWord || t.kind == tokQuoted
+}
+
+func (t token) significant() bool {
+	return t.kind != tokSpace && t.kind != tokComment
+}
+
+// lex splits sql into tokens covering all of it. An unterminated string, identifier or
+// comment runs to the end.
+func lex(sql string) []token {
+	var toks []token
+	for i := 0; i < len(sql); {
+		start := i
+		c := sql[i]
+		kind := tokPunct
+		text := ""
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			kind = tokSpace
+			for i < len(sql) && strings.IndexByte(" \t\n\r\f", sql[i]) >= 0 {
+				i++
+			}
+		case strings.HasPrefix(sql[i:], "--"):
+			kind = tokComment
+			i = endOf(sql, i, "\n")
+		case strings.HasPrefix(sql[i:], "/*"):
+			kind = tokComment
+			i = endOf(sql, i+2, "*/")
+		case c == '\'':
+			kind = tokString
+			i = endQuoted(sql, i, '\'')
+		case c == '"' || c == '`':
+			kind = tokQuoted
+			i = endQuoted(sql, i, c)
+			inner := sql[start+1 : max(i-1, start+1)]
+			text = strings.ReplaceAll(inner, string([]byte{c, c}), string(c))
+		case c == '$' && dollarTag(sql[i:]) != "":
+			kind = tokString
+			tag := dollarTag(sql[i:])
+			i = endOf(sql, i+len(tag), tag)
+		case c == '_' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			kind = tokWord
+			for i < len(sql) && (sql[i] == '_' || sql[i] == '$' || sql[i] >= 0x80 ||
+				unicode.IsLetter(rune(sql[i])) || unicode.IsDigit(rune(sql[i]))) {
+				i++
+			}
+			text = sql[start:i]
+		default:
+			i++
+			text = sql[start:i]
+		}
+		toks = append(toks, token{kind: kind, start: start, end: i, text: text})
+	}
+	return toks
+}
+
+// endOf returns the offset just past the next terminator at or after from, or the end.
+func endOf(sql string, from int, terminator string) int {
+	if n := strings.Index(sql[from:], terminator); n >= 0 {
+		return from + n + len(terminator)
+	}
+	return len(sql)
+}
+
+// endQuoted returns the offset just past the quote closing the one at start. Doubled
+// quotes are part of the text.
+func endQuoted(sql string, start int, quote byte) int {
+	for i := start + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(sql)
+}
+
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if c == '$' {
+			return s[:i+1]
+		}
+		if c != '_' && !unicode.IsLetter(rune(c)) && !(i > 1 && unicode.IsDigit(rune(c))) {
+			return ""
+		}
+	}
+	return ""
+}
+
+// statement is a range of tokens between top-level semicolons.
+type statement struct {
+	toks []token
+}
+
+func splitStatements(toks []token) []statement {
+	var (
+		statements []statement
+		from       int
+	)
+	for i, tok := range toks {
+		if tok.kind == tokPunct && tok.text == ";" {
+			statements = append(statements, statement{toks: toks[from:i]})
+			from = i + 1
+		}
+	}
+	return append(statements, statement{toks: toks[from:]})
+}
+
+// first returns the first significant token of the statement.
+func (s statement) first() (token, bool) {
+	for _, tok := range s.toks {
+		if tok.significant() {
+			return tok, true
+		}
+	}
+	return token{}, false
+}
+
+// significant returns the significant tokens of the statement with their nesting depth.
+func (s statement) significant() ([]token, []int) {
+	var (
+		toks   []token
+		depths []int
+		depth  int
+	)
+	for _, tok := range s.toks {
+		if !tok.significant() {
+			continue
+		}
+		if tok.kind == tokPunct && tok.text == ")" {
+			depth--
+		}
+		toks = append(toks, tok)
+		depths = append(depths, depth)
+		if tok.kind == tokPunct && tok.text == "(" {
+			depth++
+		}
+	}
+	return toks, depths
+}
@@ -0,0 +1,395 @@
+// Package rewrite applies configured rules to the statements clients send before they
+// run: appending a row limit to unbounded SELECTs, restricting reads of shared tables to
+// one tenant, mapping legacy table names, or arbitrary regular expression rewrites.
+// Results report the rules that changed a statement.
+//
+// Rules other than regex work on tokens, so that text in string literals, quoted
+// identifiers and comments is left alone. Like the ddl package they do not parse SQL
+// fully; they only touch tables named directly after FROM, JOIN, UPDATE, INTO or TABLE,
+// and comma-separated FROM lists.
+package rewrite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/tablequery"
+)
+
+// Rule kinds.
+const (
+	// KindRegex replaces matches of Pattern with Replacement in the whole statement text.
+	KindRegex = "regex"
+	// KindLimit appends LIMIT Limit to SELECT statements that have no limit of their own.
+	KindLimit = "limit"
+	// KindRenameTable replaces references to Table with To.
+	KindRenameTable = "renameTable"
+	// KindTenantFilter reads Table in SELECT statements through a subquery keeping only
+	// the rows whose Column equals Value.
+	KindTenantFilter = "tenantFilter"
+)
+
+// Rule is one configured rewrite.
+type Rule struct {
+	// Name identifies the rule in results. It defaults to the kind and position.
+	Name string `json:"name,omitempty"`
+	Kind string `json:"kind"`
+	// Drivers limits the rule to connections of these drivers. Empty applies it to all.
+	Drivers []string `json:"drivers,omitempty"`
+	// Pattern and Replacement are the regular expression of a regex rule and its
+	// replacement, which may refer to groups as $1 or ${name}.
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	// Limit is the row limit of a limit rule.
+	Limit int `json:"limit,omitempty"`
+	// Table is the table of a renameTable or tenantFilter rule, optionally qualified as
+	// schema.table. An unqualified name matches the table in any schema.
+	Table string `json:"table,omitempty"`
+	// To replaces the part of a reference Table matched, written as SQL.
+	To string `json:"to,omitempty"`
+	// Column and Value select the rows of a tenantFilter rule.
+	Column string `json:"column,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+// Applied reports a rule that changed a statement.
+type Applied struct {
+	Rule string `json:"rule"`
+	Kind string `json:"kind"`
+}
+
+// Rewriter applies rules in order, each to the output of the previous one. A nil
+// Rewriter changes nothing.
+type Rewriter struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	Rule
+	re            *regexp.Regexp
+	schema, table string
+}
+
+// New validates rules and returns a Rewriter for them.
+func New(rules []Rule) (*Rewriter, error) {
+	r := &Rewriter{}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = rule.Kind + "#" + strconv.Itoa(i+1)
+		}
+		c := compiledRule{Rule: rule}
+		for _, driver := range rule.Drivers {
+			if _, err := tablequery.ParseDialect(driver); err != nil {
+				return nil, fmt.Errorf("rewrite rule %s: %w", rule.Name, err)
+			}
+		}
+		switch rule.Kind {
+		case KindRegex:
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rewrite rule %s: %w", rule.Name, err)
+			}
+			c.re = re
+		case KindLimit:
+			if rule.Limit <= 0 {
+				return nil, fmt.Errorf("rewrite rule %s: limit must be positive", rule.Name)
+			}
+		case KindRenameTable, KindTenantFilter:
+			if rule.Table == "" {
+				return nil, fmt.Errorf("rewrite rule %s: table is required", rule.Name)
+			}
+			c.schema, c.table = "", rule.Table
+			if dot := strings.LastIndex(rule.Table, "."); dot >= 0 {
+				c.schema, c.table = rule.Table[:dot], rule.Table[dot+1:]
+			}
+			if rule.Kind == KindRenameTable && rule.To == "" {
+				return nil, fmt.Errorf("rewrite rule %s: to is required", rule.Name)
+			}
+			if rule.Kind == KindTenantFilter && rule.Column == "" {
+				return nil, fmt.Errorf("rewrite rule %s: column is required", rule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rewrite rule %s: unknown kind %q", rule.Name, rule.Kind)
+		}
+		r.rules = append(r.rules, c)
+	}
+	return r, nil
+}
+
+// Rules returns the rules of r, with their default names filled in.
+func (r *Rewriter) Rules() []Rule {
+	if r == nil {
+		return nil
+	}
+	rules := make([]Rule, len(r.rules))
+	for i, c := range r.rules {
+		rules[i] = c.Rule
+	}
+	return rules
+}
+
+// Load reads a JSON array of rules from path and returns a Rewriter for them.
+func Load(path string) (*Rewriter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("parse rewrite rules %s: %w", path, err)
+	}
+	return New(rules)
+}
+
+// Apply rewrites sql for a connection of driver and reports the rules that changed it.
+func (r *Rewriter) Apply(driver, sql string) (string, []Applied) {
+	if r == nil {
+		return sql, nil
+	}
+	dialect, err := tablequery.ParseDialect(driver)
+	if err != nil {
+		return sql, nil
+	}
+	var applied []Applied
+	for _, rule := range r.rules {
+		if len(rule.Drivers) > 0 && !slices.Contains(rule.Drivers, driver) {
+			continue
+		}
+		var out string
+		switch rule.Kind {
+		case KindRegex:
+			out = rule.re.ReplaceAllString(sql, rule.Replacement)
+		case KindLimit:
+			out = appendLimit(sql, rule.Limit, dialect)
+		case KindRenameTable:
+			out = renameTable(sql, rule)
+		case KindTenantFilter:
+			out = filterTenant(sql, rule, dialect)
+		}
+		if out != sql {
+			sql = out
+			applied = append(applied, Applied{Rule: rule.Name, Kind: rule.Kind})
+		}
+	}
+	return sql, applied
+}
+
+// edit replaces the bytes from start to end of the original text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+func splice(sql string, edits []edit) string {
+	if len(edits) == 0 {
+		return sql
+	}
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(sql[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.WriteString(sql[last:])
+	return b.String()
+}
+
+// limitBlockers are top-level keywords after which a LIMIT cannot simply be appended,
+// or which already bound the rows.
+var limitBlockers = []string{
+	"limit", "fetch", "offset", "for", "into",
+	"insert", "update", "delete", "merge",
+}
+
+func appendLimit(sql string, limit int, dialect tablequery.Dialect) string {
+	var edits []edit
+	for _, stmt := range splitStatements(lex(sql)) {
+		toks, depths := stmt.significant()
+		if len(toks) == 0 || !toks[0].isAny("select", "with") {
+			continue
+		}
+		bounded := false
+		for i, tok := range toks {
+			if depths[i] == 0 && tok.isAny(limitBlockers...) {
+				bounded = true
+				break
+			}
+		}
+		if !bounded {
+			end := toks[len(toks)-1].end
+			edits = append(edits, edit{start: end, end: end, text: dialect.Paginate(limit, 0)})
+		}
+	}
+	return splice(sql, edits)
+}
+
+func renameTable(sql string, rule compiledRule) string {
+	var edits []edit
+	for _, stmt := range splitStatements(lex(sql)) {
+		toks, depths := stmt.significant()
+		reading := len(toks) > 0 && toks[0].isAny("select", "with")
+		for _, ref := range tableRefs(toks, depths) {
+			if !ref.matches(rule.schema, rule.table) {
+				continue
+			}
+			first := ref.first
+			if rule.schema == "" {
+				first = ref.last
+			}
+			text := rule.To
+			// Keep the old name as the alias, so that columns qualified with it still resolve.
+			if reading && (ref.clause == "from" || ref.clause == "join") && !ref.aliased {
+				text += " AS " + toksText(sql, toks[ref.last])
+			}
+			edits = append(edits, edit{start: toks[first].start, end: toks[ref.last].end, text: text})
+		}
+	}
+	return splice(sql, edits)
+}
+
+func filterTenant(sql string, rule compiledRule, dialect tablequery.Dialect) string {
+	var edits []edit
+	for _, stmt := range splitStatements(lex(sql)) {
+		toks, depths := stmt.significant()
+		if len(toks) == 0 || !toks[0].isAny("select", "with") {
+			continue
+		}
+		for _, ref := range tableRefs(toks, depths) {
+			if !ref.matches(rule.schema, rule.table) || (ref.clause != "from" && ref.clause != "join") {
+				continue
+			}
+			start, end := toks[ref.first].start, toks[ref.last].end
+			text := "(SELECT * FROM " + sql[start:end] + " WHERE " + dialect.Quote(rule.Column) +
+				" = " + dialect.Literal(rule.Value) + ")"
+			if !ref.aliased {
+				text += " AS " + toksText(sql, toks[ref.last])
+			}
+			edits = append(edits, edit{start: start, end: end, text: text})
+		}
+	}
+	return splice(sql, edits)
+}
+
+func toksText(sql string, tok token) string {
+	return sql[tok.start:tok.end]
+}
+
+// tableRef is a table named in a statement, as indexes into its significant tokens.
+type tableRef struct {
+	first, last int
+	schema      string
+	name        string
+	// quoted is set when the name was a quoted identifier, which matches case-sensitively.
+	quoted bool
+	// clause is the keyword the reference follows, in lower case.
+	clause  string
+	aliased bool
+}
+
+func (r tableRef) matches(schema, table string) bool {
+	if schema != "" && !strings.EqualFold(r.schema, schema) {
+		return false
+	}
+	if r.quoted {
+		return r.name == table
+	}
+	return strings.EqualFold(r.name, table)
+}
+
+// tableClauses are the keywords a table reference follows.
+var tableClauses = []string{"from", "join", "update", "into", "table"}
+
+// argumentFrom are functions whose arguments use FROM without naming a table.
+var argumentFrom = []string{"extract", "substring", "trim", "overlay", "position"}
+
+// notAlias are keywords that may follow a table reference in place of an alias.
+var notAlias = []string{
+	"where", "join", "on", "using", "group", "order", "limit", "offset", "fetch", "having",
+	"window", "union", "except", "intersect", "left", "right", "inner", "outer", "full",
+	"cross", "natural", "straight_join", "for", "returning", "set", "values", "select",
+	"default", "partition", "tablesample", "lock", "into",
+}
+
+func tableRefs(toks []token, depths []int) []tableRef {
+	var (
+		refs []tableRef
+		// callers holds, for each open parenthesis, the token before it.
+		callers []token
+	)
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.kind == tokPunct && tok.text == "(" {
+			var caller token
+			if i > 0 {
+				caller = toks[i-1]
+			}
+			callers = append(callers, caller)
+			continue
+		}
+		if tok.kind == tokPunct && tok.text == ")" && len(callers) > 0 {
+			callers = callers[:len(callers)-1]
+			continue
+		}
+		if !tok.isAny(tableClauses...) {
+			continue
+		}
+		if tok.is("from") && len(callers) > 0 && callers[len(callers)-1].isAny(argumentFrom...) {
+			continue
+		}
+		clause := strings.ToLower(tok.text)
+		j := i + 1
+		if j < len(toks) && toks[j].isAny("only", "ignore") {
+			j++
+		}
+		for {
+			ref, next, ok := parseRef(toks, j, clause)
+			if !ok {
+				break
+			}
+			ref.clause = clause
+			if next < len(toks) && toks[next].is("as") {
+				ref.aliased = true
+				next += 2
+			} else if next < len(toks) && toks[next].ident() && !toks[next].isAny(notAlias...) {
+				ref.aliased = true
+				next++
+			}
+			refs = append(refs, ref)
+			if clause != "from" || next >= len(toks) || depths[next] != depths[j] ||
+				toks[next].kind != tokPunct || toks[next].text != "," {
+				break
+			}
+			j = next + 1
+		}
+	}
+	return refs
+}
+
+// parseRef reads a possibly qualified table name at toks[i]. After FROM or JOIN a name
+// followed by a parenthesis is a function rather than a table.
+func parseRef(toks []token, i int, clause string) (tableRef, int, bool) {
+	if i >= len(toks) || !toks[i].ident() || toks[i].isAny("select", "lateral") {
+		return tableRef{}, i, false
+	}
+	parts := []token{toks[i]}
+	j := i + 1
+	for j+1 < len(toks) && toks[j].kind == tokPunct && toks[j].text == "." && toks[j+1].ident() {
+		parts = append(parts, toks[j+1])
+		j += 2
+	}
+	if j < len(toks) && toks[j].kind == tokPunct && toks[j].text == "(" && (clause == "from" || clause == "join") {
+		return tableRef{}, i, false
+	}
+	name := parts[len(parts)-1]
+	ref := tableRef{first: i, last: j - 1, name: name.text, quoted: name.kind == tokQuoted}
+	if len(parts) > 1 {
+		ref.schema = parts[len(parts)-2].text
+	}
+	return ref, j, true
+}
@@ -0,0 +1,134 @@
+package rewrite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustNew(t *testing.T, rules ...Rule) *Rewriter {
+	t.Helper()
+	r, err := New(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLimitIsAppendedToUnboundedSelects(t *testing.T) {
+	r := mustNew(t, Rule{Name: "cap", Kind: KindLimit, Limit: 1000})
+	cases := map[string]string{
+		"SELECT * FROM users":                                "SELECT * FROM users LIMIT 1000",
+		"SELECT * FROM users; -- all of them\n":              "SELECT * FROM users LIMIT 1000; -- all of them\n",
+		"SELECT * FROM users LIMIT 5":                        "SELECT * FROM users LIMIT 5",
+		"SELECT * FROM (SELECT id FROM users LIMIT 5) u":     "SELECT * FROM (SELECT id FROM users LIMIT 5) u LIMIT 1000",
+		"WITH u AS (SELECT 1) SELECT * FROM u":               "WITH u AS (SELECT 1) SELECT * FROM u LIMIT 1000",
+		"WITH u AS (SELECT 1) DELETE FROM t":                 "WITH u AS (SELECT 1) DELETE FROM t",
+		"SELECT * FROM users FOR UPDATE":                     "SELECT * FROM users FOR UPDATE",
+		"UPDATE users SET name = 'x'":                        "UPDATE users SET name = 'x'",
+		"SELECT 'no limit here; LIMIT 1' AS note FROM users": "SELECT 'no limit here; LIMIT 1' AS note FROM users LIMIT 1000",
+	}
+	for in, want := range cases {
+		got, applied := r.Apply("postgres", in)
+		if got != want {
+			t.Errorf("%q:\n got %q\nwant %q", in, got, want)
+		}
+		if changed := len(applied) > 0; changed != (got != in) {
+			t.Errorf("%q: applied %v", in, applied)
+		}
+	}
+}
+
+func TestRenameTableMapsLegacyNames(t *testing.T) {
+	r := mustNew(t, Rule{Kind: KindRenameTable, Table: "legacy_users", To: "crm.customers"})
+	cases := map[string]string{
+		"SELECT legacy_users.id FROM legacy_users":           "SELECT legacy_users.id FROM crm.customers AS legacy_users",
+		"SELECT u.id FROM legacy_users u JOIN orders o ON 1": "SELECT u.id FROM crm.customers u JOIN orders o ON 1",
+		"SELECT * FROM orders, LEGACY_USERS AS u":            "SELECT * FROM orders, crm.customers AS u",
+		"UPDATE legacy_users SET name = 'legacy_users'":      "UPDATE crm.customers SET name = 'legacy_users'",
+		`SELECT * FROM "Legacy_Users"`:                       `SELECT * FROM "Legacy_Users"`,
+		"SELECT legacy_users FROM t":                         "SELECT legacy_users FROM t",
+	}
+	for in, want := range cases {
+		if got, _ := r.Apply("postgres", in); got != want {
+			t.Errorf("%q:\n got %q\nwant %q", in, got, want)
+		}
+	}
+}
+
+func TestTenantFilterRestrictsReads(t *testing.T) {
+	r := mustNew(t, Rule{Name: "tenant", Kind: KindTenantFilter, Table: "public.invoices", Column: "tenant_id", Value: "o'brien"})
+	got, applied := r.Apply("mysql", "SELECT i.total FROM public.invoices i WHERE EXTRACT(YEAR FROM i.issued) = 2024")
+	want := "SELECT i.total FROM (SELECT * FROM public.invoices WHERE `tenant_id` = 'o''brien') i WHERE EXTRACT(YEAR FROM i.issued) = 2024"
+	if got != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+	if !reflect.DeepEqual(applied, []Applied{{Rule: "tenant", Kind: KindTenantFilter}}) {
+		t.Fatalf("applied = %v", applied)
+	}
+
+	got, _ = r.Apply("postgres", "SELECT invoices.total FROM public.invoices")
+	if !strings.HasSuffix(got, `WHERE "tenant_id" = 'o''brien') AS invoices`) {
+		t.Fatalf("expected the subquery to keep the table name as alias: %s", got)
+	}
+	for _, untouched := range []string{
+		"DELETE FROM public.invoices",
+		"SELECT * FROM other.invoices",
+		"SELECT * FROM generate_series(1, 3) invoices",
+	} {
+		if got, _ := r.Apply("postgres", untouched); got != untouched {
+			t.Errorf("%q was rewritten to %q", untouched, got)
+		}
+	}
+}
+
+func TestRulesApplyInOrderPerDriver(t *testing.T) {
+	r := mustNew(t,
+		Rule{Kind: KindRegex, Pattern: `(?i)\bNOW\(\)`, Replacement: "CURRENT_TIMESTAMP", Drivers: []string{"sqlite"}},
+		Rule{Kind: KindLimit, Limit: 10},
+	)
+	got, applied := r.Apply("sqlite", "SELECT now()")
+	if got != "SELECT CURRENT_TIMESTAMP LIMIT 10" {
+		t.Fatalf("got %s", got)
+	}
+	if !reflect.DeepEqual(applied, []Applied{{Rule: "regex#1", Kind: KindRegex}, {Rule: "limit#2", Kind: KindLimit}}) {
+		t.Fatalf("applied = %v", applied)
+	}
+	if got, _ := r.Apply("postgres", "SELECT now()"); got != "SELECT now() LIMIT 10" {
+		t.Fatalf("the regex rule is limited to sqlite: %s", got)
+	}
+	var none *Rewriter
+	if got, applied := none.Apply("postgres", "SELECT 1"); got != "SELECT 1" || applied != nil {
+		t.Fatal("a nil rewriter must not change statements")
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []Rule{
+		{Kind: "drop"},
+		{Kind: KindRegex, Pattern: "("},
+		{Kind: KindLimit},
+		{Kind: KindRenameTable, Table: "a"},
+		{Kind: KindTenantFilter, Table: "a"},
+		{Kind: KindLimit, Limit: 1, Drivers: []string{"oracle"}},
+	} {
+		if _, err := New([]Rule{rule}); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestTablesListsNamedTables(t *testing.T) {
+	cases := map[string][]string{
+		"SELECT * FROM Users u JOIN public.Orders o ON o.user_id = u.id":        {"users", "public.orders"},
+		`SELECT * FROM "Audit" a, users`:                                        {"Audit", "users"},
+		"WITH recent AS (SELECT * FROM orders) SELECT * FROM recent JOIN users": {"orders", "users"},
+		"INSERT INTO logs SELECT * FROM staging; UPDATE users SET n = 1":        {"logs", "staging", "users"},
+		"SELECT extract(year FROM now())":                                       nil,
+	}
+	for in, want := range cases {
+		if got := Tables(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %v, want %v", in, got, want)
+		}
+	}
+}
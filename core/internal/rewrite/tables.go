@@ -0,0 +1,39 @@
+package rewrite
+
+import "strings"
+
+// Tables returns the tables the statements of sql name directly, in the order they are
+// first named, as table or schema.table. Unquoted names are folded to lower case so that
+// references spelled differently count as one. Names defined by WITH are left out.
+func Tables(sql string) []string {
+	var (
+		tables []string
+		seen   = map[string]bool{}
+	)
+	for _, stmt := range splitStatements(lex(sql)) {
+		toks, depths := stmt.significant()
+		ctes := map[string]bool{}
+		for i := 0; i+2 < len(toks); i++ {
+			if toks[i].ident() && toks[i+1].is("as") && toks[i+2].kind == tokPunct && toks[i+2].text == "(" {
+				ctes[strings.ToLower(toks[i].text)] = true
+			}
+		}
+		for _, ref := range tableRefs(toks, depths) {
+			name := ref.name
+			if !ref.quoted {
+				name = strings.ToLower(name)
+			}
+			if ref.schema == "" && ctes[strings.ToLower(name)] {
+				continue
+			}
+			if ref.schema != "" {
+				name = strings.ToLower(ref.schema) + "." + name
+			}
+			if !seen[name] {
+				seen[name] = true
+				tables = append(tables, name)
+			}
+		}
+	}
+	return tables
+}
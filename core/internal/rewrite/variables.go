@@ -0,0 +1,87 @@
+package rewrite
+
+import (
+	"slices"
+	"strconv"
+)
+
+// variable is a {{name}} template variable of a statement.
+type variable struct {
+	name       string
+	start, end int
+}
+
+// variables returns the template variables of sql outside string literals, quoted
+// identifiers and comments. Spaces may surround the name: {{ tenant_id }}.
+func variables(sql string) []variable {
+	var (
+		toks []token
+		vars []variable
+	)
+	for _, tok := range lex(sql) {
+		if tok.kind != tokSpace {
+			toks = append(toks, tok)
+		}
+	}
+	punct := func(i int, text string) bool {
+		return i < len(toks) && toks[i].kind == tokPunct && toks[i].text == text
+	}
+	for i := 0; i+4 < len(toks); i++ {
+		if punct(i, "{") && punct(i+1, "{") && toks[i].end == toks[i+1].start && toks[i+2].kind == tokWord &&
+			punct(i+3, "}") && punct(i+4, "}") && toks[i+3].end == toks[i+4].start {
+			vars = append(vars, variable{name: toks[i+2].text, start: toks[i].start, end: toks[i+4].end})
+			i += 4
+		}
+	}
+	return vars
+}
+
+// Variables returns the names of the template variables of sql in order of first use.
+func Variables(sql string) []string {
+	var names []string
+	for _, v := range variables(sql) {
+		if !slices.Contains(names, v.name) {
+			names = append(names, v.name)
+		}
+	}
+	return names
+}
+
+// BindVariables replaces the template variables of sql with bind parameters in the style
+// of driver, and returns the arguments to bind after the existing arguments the statement
+// already has. Postgres parameters are numbered and each variable is bound once; MySQL
+// and SQLite get a ? and an argument per use. Variables values has no value for are
+// returned as missing, in order of first use, with sql unchanged.
+func BindVariables(driver, sql string, existing int, values map[string]any) (string, []any, []string) {
+	vars := variables(sql)
+	var missing []string
+	for _, name := range Variables(sql) {
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(vars) == 0 || len(missing) > 0 {
+		return sql, nil, missing
+	}
+	var (
+		args     []any
+		edits    []edit
+		numbered = map[string]int{}
+	)
+	for _, v := range vars {
+		placeholder := "?"
+		if driver == "postgres" {
+			n, ok := numbered[v.name]
+			if !ok {
+				args = append(args, values[v.name])
+				n = existing + len(args)
+				numbered[v.name] = n
+			}
+			placeholder = "$" + strconv.Itoa(n)
+		} else {
+			args = append(args, values[v.name])
+		}
+		edits = append(edits, edit{start: v.start, end: v.end, text: placeholder})
+	}
+	return splice(sql, edits), args, nil
+}
@@ -0,0 +1,35 @@
+package rewrite
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBindVariablesUsesBindParameters(t *testing.T) {
+	sql := "SELECT * FROM orders WHERE tenant_id = {{tenant_id}} AND status = {{ status }} AND note <> '{{tenant_id}}' -- {{skip}}\n" +
+		"AND owner = {{tenant_id}}"
+	values := map[string]any{"tenant_id": int64(42), "status": "open"}
+
+	got, args, missing := BindVariables("postgres", sql, 1, values)
+	want := "SELECT * FROM orders WHERE tenant_id = $2 AND status = $3 AND note <> '{{tenant_id}}' -- {{skip}}\nAND owner = $2"
+	if got != want || !reflect.DeepEqual(args, []any{int64(42), "open"}) || missing != nil {
+		t.Fatalf("postgres: %q %v %v", got, args, missing)
+	}
+
+	got, args, _ = BindVariables("sqlite", sql, 0, values)
+	want = "SELECT * FROM orders WHERE tenant_id = ? AND status = ? AND note <> '{{tenant_id}}' -- {{skip}}\nAND owner = ?"
+	if got != want || !reflect.DeepEqual(args, []any{int64(42), "open", int64(42)}) {
+		t.Fatalf("sqlite: %q %v", got, args)
+	}
+}
+
+func TestBindVariablesReportsMissingValues(t *testing.T) {
+	sql := "SELECT {{b}}, {{a}}, {{b}}, {{c}}"
+	got, args, missing := BindVariables("mysql", sql, 0, map[string]any{"a": 1})
+	if got != sql || args != nil || !reflect.DeepEqual(missing, []string{"b", "c"}) {
+		t.Fatalf("got %q %v %v", got, args, missing)
+	}
+	if names := Variables("SELECT '{{a}}', {b}, {{ c }"); names != nil {
+		t.Fatalf("variables = %v", names)
+	}
+}
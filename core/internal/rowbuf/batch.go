@@ -0,0 +1,87 @@
+package rowbuf
+
+import "sync"
+
+// Batch hands out row slices carved from large blocks of cells, so that reading rows
+// allocates once per block rather than once per row. Rows stay valid until Reset.
+type Batch struct {
+	width     int
+	blockRows int
+	blocks    [][]any
+	free      []any
+	rows      [][]any
+}
+
+// NewBatch returns a batch for rows of width cells, allocating blockRows rows at a time.
+func NewBatch(width, blockRows int) *Batch {
+	if blockRows <= 0 {
+		blockRows = 1
+	}
+	return &Batch{width: width, blockRows: blockRows}
+}
+
+var batches = sync.Pool{New: func() any { return &Batch{} }}
+
+// GetBatch returns a pooled batch. Rows handed out by it must not be used after Release,
+// so it suits rows that are serialized before the batch is reset, such as the chunks of
+// streams that still materialize their rows.
+func GetBatch(width, blockRows int) *Batch {
+	b := batches.Get().(*Batch)
+	if blockRows <= 0 {
+		blockRows = 1
+	}
+	if b.width != width || b.blockRows < blockRows {
+		b.blocks, b.free = nil, nil
+	}
+	b.width, b.blockRows = width, blockRows
+	b.Reset()
+	return b
+}
+
+// Release resets the batch and returns it to the pool.
+func (b *Batch) Release() {
+	b.Reset()
+	batches.Put(b)
+}
+
+// NewRow returns the next row. Its cells are nil.
+func (b *Batch) NewRow() []any {
+	if b.width == 0 {
+		row := []any{}
+		b.rows = append(b.rows, row)
+		return row
+	}
+	if len(b.free) < b.width {
+		block := make([]any, b.width*b.blockRows)
+		b.blocks = append(b.blocks, block)
+		b.free = block
+	}
+	row := b.free[:b.width:b.width]
+	b.free = b.free[b.width:]
+	b.rows = append(b.rows, row)
+	return row
+}
+
+// Rows returns the rows handed out since the last Reset.
+func (b *Batch) Rows() [][]any {
+	return b.rows
+}
+
+// Len returns the number of rows handed out since the last Reset.
+func (b *Batch) Len() int {
+	return len(b.rows)
+}
+
+// Reset invalidates the rows handed out so far and keeps the first block for reuse.
+// Cells are cleared so that they do not keep values alive.
+func (b *Batch) Reset() {
+	for _, block := range b.blocks {
+		clear(block)
+	}
+	clear(b.rows)
+	b.rows = b.rows[:0]
+	if len(b.blocks) > 0 {
+		b.blocks = b.blocks[:1]
+		b.free = b.blocks[0]
+	}
+}
@@ -0,0 +1,109 @@
+package rowbuf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fluxgrid/core/internal/pgvalue"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// internProbe is how many values of a text column are interned before deciding whether
+// the column repeats enough to keep interning it.
+const internProbe = 256
+
+// Decoder turns the raw values of a pgx row into Go values like pgx.Rows.Values does, but
+// into a caller-supplied slice and with repetitive text columns interned.
+type Decoder struct {
+	typeMap *pgtype.Map
+	fields  []pgconn.FieldDescription
+	types   []*pgtype.Type
+	text    []bool
+	money   []bool
+	intern  *Interner
+	columns []internStats
+}
+
+// internStats tracks how often interning pays off for one column. Columns of mostly
+// distinct values, such as keys and free text, stop being interned after the probe.
+type internStats struct {
+	seen, hits int
+	off        bool
+}
+
+// NewDecoder prepares a decoder for the columns of one result.
+func NewDecoder(typeMap *pgtype.Map, fields []pgconn.FieldDescription, intern *Interner) *Decoder {
+	d := &Decoder{
+		typeMap: typeMap,
+		fields:  fields,
+		types:   make([]*pgtype.Type, len(fields)),
+		text:    make([]bool, len(fields)),
+		money:   make([]bool, len(fields)),
+		intern:  intern,
+		columns: make([]internStats, len(fields)),
+	}
+	for i, field := range fields {
+		switch field.DataTypeOID {
+		case pgtype.TextOID, pgtype.VarcharOID, pgtype.BPCharOID, pgtype.NameOID:
+			// Text is sent as its UTF-8 bytes in both formats.
+			d.text[i] = true
+		case pgvalue.MoneyOID:
+			d.money[i] = field.Format == pgx.TextFormatCode
+		default:
+			if dt, ok := typeMap.TypeForOID(field.DataTypeOID); ok {
+				d.types[i] = dt
+			}
+		}
+	}
+	return d
+}
+
+// Decode fills dst, which must have one cell per column, from raw.
+func (d *Decoder) Decode(raw [][]byte, dst []any) error {
+	for i, buf := range raw {
+		if buf == nil {
+			dst[i] = nil
+			continue
+		}
+		field := &d.fields[i]
+		switch {
+		case d.money[i]:
+			// Money arrives formatted for the server's locale; the text is kept when it
+			// cannot be read as a number.
+			if amount, ok := pgvalue.Money(string(buf)); ok {
+				dst[i] = json.Number(amount)
+			} else {
+				dst[i] = string(buf)
+			}
+		case d.text[i], d.types[i] == nil && field.Format == pgx.TextFormatCode:
+			dst[i] = d.decodeText(i, buf)
+		case d.types[i] != nil:
+			value, err := d.types[i].Codec.DecodeValue(d.typeMap, field.DataTypeOID, field.Format, buf)
+			if err != nil {
+				return fmt.Errorf("decode column %s: %w", field.Name, err)
+			}
+			dst[i] = value
+		default:
+			dst[i] = append([]byte(nil), buf...)
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) decodeText(i int, buf []byte) string {
+	stats := &d.columns[i]
+	if stats.off || d.intern == nil {
+		return string(buf)
+	}
+	s, hit := d.intern.intern(buf)
+	stats.seen++
+	if hit {
+		stats.hits++
+	}
+	if stats.seen == internProbe && stats.hits < internProbe/2 {
+		stats.off = true
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package rowbuf
+
+// Interner deduplicates short strings, such as status codes and enum labels, that repeat
+// across the rows of one result. It is not safe for concurrent use.
+type Interner struct {
+	maxLen     int
+	maxEntries int
+	strings    map[string]string
+}
+
+// Defaults for NewInterner.
+const (
+	DefaultInternMaxLen     = 32
+	DefaultInternMaxEntries = 1024
+)
+
+// NewInterner interns strings of at most maxLen bytes, remembering at most maxEntries of
+// them. Longer strings and strings seen once the table is full are copied as usual.
+func NewInterner(maxLen, maxEntries int) *Interner {
+	return &Interner{maxLen: maxLen, maxEntries: maxEntries, strings: make(map[string]string)}
+}
+
+// String returns b as a string, sharing the allocation with earlier equal strings.
+func (in *Interner) String(b []byte) string {
+	s, _ := in.intern(b)
+	return s
+}
+
+// intern is String that also reports whether b was already interned.
+func (in *Interner) intern(b []byte) (string, bool) {
+	if len(b) == 0 {
+		return "", true
+	}
+	if len(b) > in.maxLen {
+		return string(b), false
+	}
+	// The compiler does not allocate for a []byte key conversion in a map lookup.
+	if s, ok := in.strings[string(b)]; ok {
+		return s, true
+	}
+	s := string(b)
+	if len(in.strings) < in.maxEntries {
+		in.strings[s] = s
+	}
+	return s, false
+}
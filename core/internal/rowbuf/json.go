@@ -0,0 +1,264 @@
+package rowbuf
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/fluxgrid/core/internal/pgvalue"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+type jsonKind uint8
+
+const (
+	// jsonGeneric decodes the value with its codec and marshals the normalized result.
+	jsonGeneric jsonKind = iota
+	// jsonText quotes the raw bytes, which are the value's UTF-8 text.
+	jsonText
+	jsonInt
+	jsonBool
+	// jsonMoney writes the locale-formatted text of money as a decimal number.
+	jsonMoney
+)
+
+// RowJSON writes pgx rows as JSON arrays straight from their raw values, so that chunks
+// are encoded without first building [][]any. Integers, booleans and text are written
+// from the wire bytes; other types are decoded with their pgtype codec, passed through
+// normalize and marshalled, matching what encoding the decoded row would produce.
+type RowJSON struct {
+	typeMap   *pgtype.Map
+	fields    []pgconn.FieldDescription
+	kinds     []jsonKind
+	types     []*pgtype.Type
+	normalize func(any) any
+}
+
+// NewRowJSON prepares an encoder for the columns of one result.
+func NewRowJSON(typeMap *pgtype.Map, fields []pgconn.FieldDescription, normalize func(any) any) *RowJSON {
+	w := &RowJSON{
+		typeMap:   typeMap,
+		fields:    fields,
+		kinds:     make([]jsonKind, len(fields)),
+		types:     make([]*pgtype.Type, len(fields)),
+		normalize: normalize,
+	}
+	for i, field := range fields {
+		switch field.DataTypeOID {
+		case pgtype.TextOID, pgtype.VarcharOID, pgtype.BPCharOID, pgtype.NameOID:
+			w.kinds[i] = jsonText
+		case pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID:
+			w.kinds[i] = jsonInt
+		case pgtype.BoolOID:
+			w.kinds[i] = jsonBool
+		case pgvalue.MoneyOID:
+			w.kinds[i] = jsonMoney
+		default:
+			dt, ok := typeMap.TypeForOID(field.DataTypeOID)
+			if !ok {
+				// Unknown types decode to a string or []byte, both normalized to a string.
+				w.kinds[i] = jsonText
+				continue
+			}
+			w.types[i] = dt
+		}
+	}
+	return w
+}
+
+// AppendRow appends raw as a JSON array to dst.
+func (w *RowJSON) AppendRow(dst []byte, raw [][]byte) ([]byte, error) {
+	dst = append(dst, '[')
+	for i, buf := range raw {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		var err error
+		if dst, err = w.appendCell(dst, i, buf); err != nil {
+			return dst, err
+		}
+	}
+	return append(dst, ']'), nil
+}
+
+func (w *RowJSON) appendCell(dst []byte, i int, buf []byte) ([]byte, error) {
+	if buf == nil {
+		return append(dst, "null"...), nil
+	}
+	field := &w.fields[i]
+	var err error
+	switch w.kinds[i] {
+	case jsonText:
+		dst = appendString(dst, buf)
+	case jsonInt:
+		dst, err = appendInt(dst, field.Format, buf)
+	case jsonBool:
+		dst, err = appendBool(dst, field.Format, buf)
+	case jsonMoney:
+		if amount, ok := pgvalue.Money(string(buf)); ok && field.Format == pgx.TextFormatCode {
+			dst = append(dst, amount...)
+		} else {
+			dst = appendString(dst, buf)
+		}
+	default:
+		dst, err = w.appendGeneric(dst, field, w.types[i], buf)
+	}
+	if err != nil {
+		return dst, fmt.Errorf("encode column %s: %w", field.Name, err)
+	}
+	return dst, nil
+}
+
+// ColumnJSON gathers rows into one JSON array per column, the columnar chunk layout. Each
+// column's values are encoded as they arrive, exactly as RowJSON encodes them in rows.
+type ColumnJSON struct {
+	w       *RowJSON
+	columns [][]byte
+	rows    int
+}
+
+// Columns returns an empty columnar batch for the encoder's columns.
+func (w *RowJSON) Columns() *ColumnJSON {
+	c := &ColumnJSON{w: w, columns: make([][]byte, len(w.fields))}
+	for i := range c.columns {
+		c.columns[i] = []byte{'['}
+	}
+	return c
+}
+
+// AppendRow adds raw to the batch.
+func (c *ColumnJSON) AppendRow(raw [][]byte) error {
+	for i, buf := range raw {
+		col := c.columns[i]
+		if c.rows > 0 {
+			col = append(col, ',')
+		}
+		var err error
+		col, err = c.w.appendCell(col, i, buf)
+		c.columns[i] = col
+		if err != nil {
+			return err
+		}
+	}
+	c.rows++
+	return nil
+}
+
+// Rows is the number of rows in the batch.
+func (c *ColumnJSON) Rows() int {
+	return c.rows
+}
+
+// AppendTo appends the batch to dst as an array of column arrays and empties it.
+func (c *ColumnJSON) AppendTo(dst []byte) []byte {
+	dst = append(dst, '[')
+	for i, col := range c.columns {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = append(append(dst, col...), ']')
+		c.columns[i] = col[:1]
+	}
+	c.rows = 0
+	return append(dst, ']')
+}
+
+func (w *RowJSON) appendGeneric(dst []byte, field *pgconn.FieldDescription, dt *pgtype.Type, buf []byte) ([]byte, error) {
+	value, err := dt.Codec.DecodeValue(w.typeMap, field.DataTypeOID, field.Format, buf)
+	if err != nil {
+		return dst, err
+	}
+	encoded, err := json.Marshal(w.normalize(value))
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, encoded...), nil
+}
+
+func appendInt(dst []byte, format int16, buf []byte) ([]byte, error) {
+	if format == pgx.TextFormatCode {
+		// The server's text form of an integer is already its JSON form.
+		return append(dst, buf...), nil
+	}
+	var n int64
+	switch len(buf) {
+	case 2:
+		n = int64(int16(binary.BigEndian.Uint16(buf)))
+	case 4:
+		n = int64(int32(binary.BigEndian.Uint32(buf)))
+	case 8:
+		n = int64(binary.BigEndian.Uint64(buf))
+	default:
+		return dst, fmt.Errorf("invalid integer length %d", len(buf))
+	}
+	return strconv.AppendInt(dst, n, 10), nil
+}
+
+func appendBool(dst []byte, format int16, buf []byte) ([]byte, error) {
+	if len(buf) != 1 {
+		return dst, fmt.Errorf("invalid boolean length %d", len(buf))
+	}
+	if format == pgx.TextFormatCode {
+		return strconv.AppendBool(dst, buf[0] == 't'), nil
+	}
+	return strconv.AppendBool(dst, buf[0] != 0), nil
+}
+
+const hex = "0123456789abcdef"
+
+// appendString quotes s the way encoding/json does by default, including its escaping of
+// HTML characters, U+2028 and U+2029, and its replacement of invalid UTF-8.
+func appendString(dst []byte, s []byte) []byte {
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' && b != '<' && b != '>' && b != '&' {
+				i++
+				continue
+			}
+			dst = append(dst, s[start:i]...)
+			switch b {
+			case '"', '\\':
+				dst = append(dst, '\\', b)
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRune(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
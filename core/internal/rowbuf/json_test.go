@@ -0,0 +1,181 @@
+package rowbuf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/pgvalue"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// normalizeForTest stands in for the handlers' normalization of decoded values.
+func normalizeForTest(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	case json.Number:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+// decodeRow is the materializing path RowJSON replaces: decoding the row followed by
+// normalization.
+func decodeRow(t testing.TB, typeMap *pgtype.Map, fields []pgconn.FieldDescription, raw [][]byte) []any {
+	row := make([]any, len(raw))
+	if err := NewDecoder(typeMap, fields, nil).Decode(raw, row); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	for i, value := range row {
+		row[i] = normalizeForTest(value)
+	}
+	return row
+}
+
+func TestRowJSONMatchesMarshalledValues(t *testing.T) {
+	typeMap := pgtype.NewMap()
+	encode := func(oid uint32, format int16, value any) []byte {
+		buf, err := typeMap.Encode(oid, format, value, nil)
+		if err != nil {
+			t.Fatalf("encode %v: %v", value, err)
+		}
+		return buf
+	}
+	fields := []pgconn.FieldDescription{
+		{Name: "i2", DataTypeOID: pgtype.Int2OID, Format: pgx.BinaryFormatCode},
+		{Name: "i4", DataTypeOID: pgtype.Int4OID, Format: pgx.BinaryFormatCode},
+		{Name: "i8", DataTypeOID: pgtype.Int8OID, Format: pgx.BinaryFormatCode},
+		{Name: "i8text", DataTypeOID: pgtype.Int8OID, Format: pgx.TextFormatCode},
+		{Name: "flag", DataTypeOID: pgtype.BoolOID, Format: pgx.BinaryFormatCode},
+		{Name: "flagtext", DataTypeOID: pgtype.BoolOID, Format: pgx.TextFormatCode},
+		{Name: "name", DataTypeOID: pgtype.TextOID, Format: pgx.BinaryFormatCode},
+		{Name: "f8", DataTypeOID: pgtype.Float8OID, Format: pgx.BinaryFormatCode},
+		{Name: "ts", DataTypeOID: pgtype.TimestamptzOID, Format: pgx.BinaryFormatCode},
+		{Name: "doc", DataTypeOID: pgtype.JSONBOID, Format: pgx.TextFormatCode},
+		{Name: "custom", DataTypeOID: 999999, Format: pgx.TextFormatCode},
+		{Name: "price", DataTypeOID: pgvalue.MoneyOID, Format: pgx.TextFormatCode},
+		{Name: "missing", DataTypeOID: pgtype.TextOID, Format: pgx.BinaryFormatCode},
+	}
+	raw := [][]byte{
+		encode(pgtype.Int2OID, pgx.BinaryFormatCode, int16(-7)),
+		encode(pgtype.Int4OID, pgx.BinaryFormatCode, int32(1<<30)),
+		encode(pgtype.Int8OID, pgx.BinaryFormatCode, int64(-1<<62)),
+		[]byte("9007199254740993"),
+		{1},
+		[]byte("f"),
+		[]byte("a \"quoted\" <b>&\\ line\n\ttab\x01   caf\xc3\xa9 bad\xff"),
+		encode(pgtype.Float8OID, pgx.BinaryFormatCode, 1.5e-7),
+		encode(pgtype.TimestamptzOID, pgx.BinaryFormatCode, time.Date(2024, 5, 1, 12, 30, 0, 123000, time.UTC)),
+		[]byte(`{"a": [1, 2]}`),
+		[]byte("opaque"),
+		[]byte("-$1,234.56"),
+		nil,
+	}
+
+	w := NewRowJSON(typeMap, fields, normalizeForTest)
+	got, err := w.AppendRow(nil, raw)
+	if err != nil {
+		t.Fatalf("AppendRow: %v", err)
+	}
+	want, err := json.Marshal(decodeRow(t, typeMap, fields, raw))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("encoded row differs\n got: %s\nwant: %s", got, want)
+	}
+	if !strings.Contains(string(got), `,-1234.56,`) {
+		t.Fatalf("money was not written as a number: %s", got)
+	}
+
+	if _, err := w.AppendRow(nil, [][]byte{{1, 2, 3}, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil}); err == nil {
+		t.Fatal("expected a malformed integer to fail")
+	}
+}
+
+// BenchmarkEncodeChunk compares materializing a chunk as [][]any and marshalling it with
+// encoding it from raw values, for chunks of 256 rows.
+func BenchmarkEncodeChunk(b *testing.B) {
+	typeMap := pgtype.NewMap()
+	fields := []pgconn.FieldDescription{
+		{Name: "id", DataTypeOID: pgtype.Int8OID, Format: pgx.BinaryFormatCode},
+		{Name: "active", DataTypeOID: pgtype.BoolOID, Format: pgx.BinaryFormatCode},
+		{Name: "status", DataTypeOID: pgtype.TextOID, Format: pgx.BinaryFormatCode},
+		{Name: "note", DataTypeOID: pgtype.TextOID, Format: pgx.BinaryFormatCode},
+	}
+	input := make([][][]byte, 256)
+	for i := range input {
+		id, _ := typeMap.Encode(pgtype.Int8OID, pgx.BinaryFormatCode, int64(i), nil)
+		input[i] = [][]byte{id, {1}, []byte("active"), []byte("a longer free-text value " + strconv.Itoa(i))}
+	}
+
+	b.Run("materialized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows := make([][]any, 0, len(input))
+			for _, raw := range input {
+				rows = append(rows, decodeRow(b, typeMap, fields, raw))
+			}
+			if _, err := json.Marshal(rows); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("direct", func(b *testing.B) {
+		b.ReportAllocs()
+		w := NewRowJSON(typeMap, fields, normalizeForTest)
+		var buf []byte
+		for i := 0; i < b.N; i++ {
+			buf = append(buf[:0], '[')
+			for j, raw := range input {
+				if j > 0 {
+					buf = append(buf, ',')
+				}
+				var err error
+				if buf, err = w.AppendRow(buf, raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+			buf = append(buf, ']')
+		}
+	})
+}
+
+func TestColumnJSONTransposesRows(t *testing.T) {
+	fields := []pgconn.FieldDescription{
+		{Name: "id", DataTypeOID: pgtype.Int4OID, Format: pgx.TextFormatCode},
+		{Name: "name", DataTypeOID: pgtype.TextOID, Format: pgx.TextFormatCode},
+	}
+	w := NewRowJSON(pgtype.NewMap(), fields, normalizeForTest)
+	columns := w.Columns()
+	for _, raw := range [][][]byte{{[]byte("1"), []byte("a")}, {[]byte("2"), nil}} {
+		if err := columns.AppendRow(raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if columns.Rows() != 2 {
+		t.Fatalf("expected 2 rows, got %d", columns.Rows())
+	}
+	if got := string(columns.AppendTo(nil)); got != `[[1,2],["a",null]]` {
+		t.Fatalf("unexpected columns %s", got)
+	}
+
+	// The batch starts over once appended.
+	if err := columns.AppendRow([][]byte{[]byte("3"), []byte("c")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(columns.AppendTo(nil)); got != `[[3],["c"]]` {
+		t.Fatalf("unexpected second batch %s", got)
+	}
+}
@@ -0,0 +1,177 @@
+package rowbuf
+
+import (
+	"strconv"
+	"testing"
+	"unsafe"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestBatchCarvesRowsAndResets(t *testing.T) {
+	b := NewBatch(2, 2)
+	for i := 0; i < 5; i++ {
+		row := b.NewRow()
+		if len(row) != 2 || cap(row) != 2 {
+			t.Fatalf("row %d: unexpected shape len=%d cap=%d", i, len(row), cap(row))
+		}
+		row[0], row[1] = i, "x"
+	}
+	rows := b.Rows()
+	if b.Len() != 5 || rows[4][0] != 4 || rows[0][0] != 0 {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if len(b.blocks) != 3 {
+		t.Fatalf("expected 3 blocks for 5 rows of 2, got %d", len(b.blocks))
+	}
+
+	b.Reset()
+	if b.Len() != 0 || len(b.blocks) != 1 {
+		t.Fatalf("expected reset to keep one block, got %d rows and %d blocks", b.Len(), len(b.blocks))
+	}
+	if row := b.NewRow(); row[0] != nil || row[1] != nil {
+		t.Fatalf("expected cleared cells, got %v", row)
+	}
+
+	empty := NewBatch(0, 4)
+	if row := empty.NewRow(); row == nil || len(row) != 0 {
+		t.Fatalf("expected an empty non-nil row, got %#v", row)
+	}
+}
+
+func TestGetBatchAdaptsPooledBatches(t *testing.T) {
+	b := GetBatch(3, 4)
+	b.NewRow()[2] = "kept"
+	b.Release()
+
+	b = GetBatch(5, 4)
+	defer b.Release()
+	if row := b.NewRow(); len(row) != 5 || row[2] != nil {
+		t.Fatalf("unexpected row from a pooled batch %v", row)
+	}
+}
+
+func TestInterner(t *testing.T) {
+	in := NewInterner(4, 2)
+	a := in.String([]byte("ok"))
+	b := in.String([]byte("ok"))
+	if a != "ok" || unsafe.StringData(a) != unsafe.StringData(b) {
+		t.Fatal("expected equal short strings to share storage")
+	}
+	if long := in.String([]byte("longer")); long != "longer" || len(in.strings) != 1 {
+		t.Fatalf("expected long strings to bypass the table, got %d entries", len(in.strings))
+	}
+	in.String([]byte("b"))
+	in.String([]byte("c"))
+	if len(in.strings) != 2 {
+		t.Fatalf("expected the table to stop at 2 entries, got %d", len(in.strings))
+	}
+	if in.String(nil) != "" {
+		t.Fatal("expected an empty string for no bytes")
+	}
+}
+
+func TestDecoderMatchesPgxValues(t *testing.T) {
+	typeMap := pgtype.NewMap()
+	fields := []pgconn.FieldDescription{
+		{Name: "id", DataTypeOID: pgtype.Int8OID, Format: pgx.BinaryFormatCode},
+		{Name: "status", DataTypeOID: pgtype.TextOID, Format: pgx.BinaryFormatCode},
+		{Name: "note", DataTypeOID: pgtype.VarcharOID, Format: pgx.TextFormatCode},
+		{Name: "custom", DataTypeOID: 999999, Format: pgx.TextFormatCode},
+		{Name: "blob", DataTypeOID: 999998, Format: pgx.BinaryFormatCode},
+	}
+	id, err := typeMap.Encode(pgtype.Int8OID, pgx.BinaryFormatCode, int64(42), nil)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	raw := [][]byte{id, []byte("open"), nil, []byte("v"), {1, 2}}
+
+	d := NewDecoder(typeMap, fields, NewInterner(DefaultInternMaxLen, DefaultInternMaxEntries))
+	dst := make([]any, len(fields))
+	if err := d.Decode(raw, dst); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if dst[0] != int64(42) || dst[1] != "open" || dst[2] != nil || dst[3] != "v" {
+		t.Fatalf("unexpected values %#v", dst)
+	}
+	if blob, ok := dst[4].([]byte); !ok || len(blob) != 2 || &blob[0] == &raw[4][0] {
+		t.Fatalf("expected a copy of unknown binary values, got %#v", dst[4])
+	}
+
+	if err := d.Decode([][]byte{{1}, nil, nil, nil, nil}, dst); err == nil {
+		t.Fatal("expected a malformed int8 to fail")
+	}
+}
+
+// benchmarkRows simulates a result whose text columns repeat a few values, as status and
+// category columns do.
+func benchmarkRows(n int) [][][]byte {
+	rows := make([][][]byte, n)
+	for i := range rows {
+		rows[i] = [][]byte{
+			[]byte(strconv.Itoa(i)),
+			[]byte([]string{"active", "pending", "closed"}[i%3]),
+			[]byte("region-" + strconv.Itoa(i%8)),
+			[]byte("a longer free-text value that differs per row " + strconv.Itoa(i)),
+		}
+	}
+	return rows
+}
+
+var benchmarkFields = []pgconn.FieldDescription{
+	{Name: "id", DataTypeOID: pgtype.TextOID},
+	{Name: "status", DataTypeOID: pgtype.TextOID},
+	{Name: "region", DataTypeOID: pgtype.TextOID},
+	{Name: "note", DataTypeOID: pgtype.TextOID},
+}
+
+// BenchmarkStreamRows compares reading stream chunks into a fresh row per row with pooled
+// batches and interning, in chunks of 256 rows. Streams that materialize their rows still
+// take the pooled path; pgx streams encode chunks from raw values, see BenchmarkEncodeChunk.
+func BenchmarkStreamRows(b *testing.B) {
+	const chunk = 256
+	input := benchmarkRows(4096)
+	typeMap := pgtype.NewMap()
+
+	b.Run("perRow", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			batch := make([][]any, 0, chunk)
+			for _, raw := range input {
+				row := make([]any, 0, len(raw))
+				for j, buf := range raw {
+					field := &benchmarkFields[j]
+					dt, _ := typeMap.TypeForOID(field.DataTypeOID)
+					value, err := dt.Codec.DecodeValue(typeMap, field.DataTypeOID, field.Format, buf)
+					if err != nil {
+						b.Fatal(err)
+					}
+					row = append(row, value)
+				}
+				batch = append(batch, row)
+				if len(batch) == chunk {
+					batch = make([][]any, 0, chunk)
+				}
+			}
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			batch := GetBatch(len(benchmarkFields), chunk)
+			d := NewDecoder(typeMap, benchmarkFields, NewInterner(DefaultInternMaxLen, DefaultInternMaxEntries))
+			for _, raw := range input {
+				if err := d.Decode(raw, batch.NewRow()); err != nil {
+					b.Fatal(err)
+				}
+				if batch.Len() == chunk {
+					batch.Reset()
+				}
+			}
+			batch.Release()
+		}
+	})
+}
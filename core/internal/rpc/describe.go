@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+)
+
+// MethodDoc documents a method or notification for rpc.describe. Params and Result are
+// sample values (usually zero values of the request and response types) whose Go types are
+// turned into JSON Schemas.
+type MethodDoc struct {
+	Summary string
+	Params  any
+	Result  any
+}
+
+// Document attaches documentation to a request method or to a notification handled by the
+// server. When Params is set, incoming parameters are validated against its schema before
+// the handler runs.
+func (s *Server) Document(method string, doc MethodDoc) {
+	s.docs[method] = doc
+	if doc.Params != nil {
+		s.paramSchemas[method] = SchemaOf(doc.Params)
+	} else {
+		delete(s.paramSchemas, method)
+	}
+}
+
+// validated wraps handler with parameter validation when the method has a params schema.
+func (s *Server) validated(method string, handler HandlerFunc) HandlerFunc {
+	schema, ok := s.paramSchemas[method]
+	if !ok {
+		return handler
+	}
+	return func(ctx context.Context, params json.RawMessage) (any, *Error) {
+		if rpcErr := schema.Validate(params); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return handler(ctx, params)
+	}
+}
+
+// DocumentOutbound documents a notification that the server sends to the client.
+func (s *Server) DocumentOutbound(method string, doc MethodDoc) {
+	s.outbound[method] = doc
+}
+
+type methodDescription struct {
+	Name    string  `json:"name"`
+	Summary string  `json:"summary,omitempty"`
+	Params  *Schema `json:"params,omitempty"`
+	Result  *Schema `json:"result,omitempty"`
+}
+
+type notificationDescription struct {
+	Name string `json:"name"`
+	// Direction is "in" for notifications the server handles and "out" for ones it sends.
+	Direction string  `json:"direction"`
+	Summary   string  `json:"summary,omitempty"`
+	Params    *Schema `json:"params,omitempty"`
+}
+
+type describeResult struct {
+	Methods       []methodDescription       `json:"methods"`
+	Notifications []notificationDescription `json:"notifications"`
+}
+
+func docSchema(sample any) *Schema {
+	if sample == nil {
+		return nil
+	}
+	return SchemaOf(sample)
+}
+
+// describeHandler implements rpc.describe, listing every registered method and notification.
+// Undocumented methods are listed by name only.
+func (s *Server) describeHandler(_ context.Context, _ json.RawMessage) (any, *Error) {
+	var result describeResult
+	for name := range s.handlers {
+		doc := s.docs[name]
+		result.Methods = append(result.Methods, methodDescription{
+			Name:    name,
+			Summary: doc.Summary,
+			Params:  s.paramSchemas[name],
+			Result:  docSchema(doc.Result),
+		})
+	}
+	for name := range s.notifications {
+		doc := s.docs[name]
+		result.Notifications = append(result.Notifications, notificationDescription{
+			Name:      name,
+			Direction: "in",
+			Summary:   doc.Summary,
+			Params:    s.paramSchemas[name],
+		})
+	}
+	for name, doc := range s.outbound {
+		result.Notifications = append(result.Notifications, notificationDescription{
+			Name:      name,
+			Direction: "out",
+			Summary:   doc.Summary,
+			Params:    docSchema(doc.Params),
+		})
+	}
+
+	sort.Slice(result.Methods, func(i, j int) bool { return result.Methods[i].Name < result.Methods[j].Name })
+	sort.Slice(result.Notifications, func(i, j int) bool {
+		a, b := result.Notifications[i], result.Notifications[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Direction < b.Direction
+	})
+	return result, nil
+}
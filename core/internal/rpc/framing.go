@@ -0,0 +1,105 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// DefaultMaxMessageSize bounds a single incoming message unless SetMaxMessageSize says
+// otherwise.
+const DefaultMaxMessageSize = 16 << 20
+
+// errMessageTooLarge reports a message that was discarded for exceeding the size limit.
+var errMessageTooLarge = errors.New("message too large")
+
+// nullID is the id of responses to requests whose id could not be read.
+var nullID = json.RawMessage("null")
+
+// readMessage returns the next newline-delimited message. A message longer than limit is
+// skipped up to its newline and reported as errMessageTooLarge, so one oversized message
+// neither exhausts memory nor desynchronises the stream.
+func readMessage(r *bufio.Reader, limit int) ([]byte, error) {
+	var (
+		msg      []byte
+		tooLarge bool
+	)
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLarge {
+			// The limit applies to the message without its line terminator.
+			if len(msg)+len(bytes.TrimRight(chunk, "\r\n")) > limit {
+				tooLarge = true
+				msg = nil
+			} else {
+				msg = append(msg, chunk...)
+			}
+		}
+
+		switch {
+		case err == nil:
+			if tooLarge {
+				return nil, errMessageTooLarge
+			}
+			return msg, nil
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			if tooLarge {
+				return nil, errMessageTooLarge
+			}
+			if len(msg) > 0 {
+				return msg, nil
+			}
+			return nil, io.EOF
+		default:
+			return nil, err
+		}
+	}
+}
+
+// decodeRequest parses one message. When the message is not a valid request it returns
+// the error to send back; the returned request still carries the id when one was readable.
+func decodeRequest(data []byte) (Request, *Error) {
+	var req Request
+
+	if !json.Valid(data) {
+		return req, &Error{Code: -32700, Message: "parse error"}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			return req, &Error{Code: -32600, Message: "invalid request", Data: "batch requests are not supported"}
+		}
+		return req, &Error{Code: -32600, Message: "invalid request", Data: "request must be an object"}
+	}
+
+	if raw, ok := fields["id"]; ok && !bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		switch bytes.TrimSpace(raw)[0] {
+		case '"', '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			id := json.RawMessage(bytes.TrimSpace(raw))
+			req.ID = &id
+			// The empty id would share the outbound lane of unrelated messages; see sequencer.
+			if key, _ := canonicalID(req.ID); key == "" {
+				return req, &Error{Code: -32600, Message: "invalid request", Data: "id must not be empty"}
+			}
+		default:
+			return req, &Error{Code: -32600, Message: "invalid request", Data: "id must be a string or a number"}
+		}
+	}
+
+	if err := json.Unmarshal(fields["method"], &req.Method); err != nil || req.Method == "" {
+		return req, &Error{Code: -32600, Message: "invalid request", Data: "method must be a non-empty string"}
+	}
+	if raw, ok := fields["jsonrpc"]; ok {
+		if err := json.Unmarshal(raw, &req.JSONRPC); err != nil || req.JSONRPC != "2.0" {
+			return req, &Error{Code: -32600, Message: "invalid request", Data: `jsonrpc must be "2.0"`}
+		}
+	}
+	// Params are left to the method schema and the handler.
+	req.Params = fields["params"]
+	return req, nil
+}
@@ -0,0 +1,142 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func echoServer() *Server {
+	server := NewServer(zerolog.Nop())
+	server.Register("echo", func(_ context.Context, params json.RawMessage) (any, *Error) {
+		return params, nil
+	})
+	return server
+}
+
+type wireResponse struct {
+	ID    string
+	Error *Error
+}
+
+// decodeResponses checks that every line the server wrote is a well-formed response.
+func decodeResponses(t testing.TB, out string) []wireResponse {
+	t.Helper()
+	var responses []wireResponse
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("server wrote invalid JSON %q: %v", line, err)
+		}
+		id, hasID := fields["id"]
+		_, hasResult := fields["result"]
+		_, hasError := fields["error"]
+		if string(fields["jsonrpc"]) != `"2.0"` || !hasID || hasResult == hasError {
+			t.Fatalf("server wrote malformed response %q", line)
+		}
+		response := wireResponse{ID: string(id)}
+		if hasError {
+			if err := json.Unmarshal(fields["error"], &response.Error); err != nil || response.Error == nil {
+				t.Fatalf("server wrote malformed error %q", line)
+			}
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestServeAnswersMalformedMessages(t *testing.T) {
+	server := echoServer()
+	server.SetMaxMessageSize(64)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{"a":1}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"echo"`,
+		`[{"jsonrpc":"2.0","id":3,"method":"echo"}]`,
+		`{"jsonrpc":"2.0","id":{"x":1},"method":"echo"}`,
+		`{"jsonrpc":"2.0","id":5,"method":7}`,
+		`{"jsonrpc":"1.0","id":6,"method":"echo"}`,
+		`{"jsonrpc":"2.0","id":7,"method":"echo","params":"` + strings.Repeat("x", 100) + `"}`,
+		``,
+		`{"jsonrpc":"2.0","id":8,"method":"echo","params":[1]}`,
+	}, "\n")
+	var out strings.Builder
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	// Errors are answered at once and requests once they ran, so the order is not fixed.
+	var got []string
+	for _, response := range decodeResponses(t, out.String()) {
+		code := 0
+		if response.Error != nil {
+			code = response.Error.Code
+		}
+		got = append(got, fmt.Sprintf("%s %d", response.ID, code))
+	}
+	want := []string{"1 0", "5 -32600", "6 -32600", "8 0", "null -32600", "null -32600", "null -32600", "null -32700"}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("responses = %q, want %q", got, want)
+	}
+}
+
+func FuzzDecodeRequest(f *testing.F) {
+	for _, seed := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":{}}`,
+		`{"id":"a","method":"m"}`,
+		`{"method":"notify"}`,
+		`[]`, `null`, `"x"`, `{"id":[],"method":"m"}`, `{"id":1e999,"method":"m"}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, rpcErr := decodeRequest(data)
+		if rpcErr == nil && req.Method == "" {
+			t.Fatalf("accepted a request without a method: %q", data)
+		}
+		if req.ID != nil && !json.Valid(*req.ID) {
+			t.Fatalf("decoded an invalid id %q", *req.ID)
+		}
+	})
+}
+
+func FuzzCanonicalID(f *testing.F) {
+	for _, seed := range []string{`1`, `"abc"`, `-0.5`, `1e400`, `null`, `{"a":1}`, `"\u0000"`, `garbage`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		raw := json.RawMessage(data)
+		first, ok := canonicalID(&raw)
+		second, _ := canonicalID(&raw)
+		if !ok || first != second {
+			t.Fatalf("canonicalID(%q) is not stable: %q vs %q", data, first, second)
+		}
+	})
+}
+
+func FuzzServe(f *testing.F) {
+	f.Add([]byte(`{"jsonrpc":"2.0","id":1,"method":"echo","params":{}}` + "\n"))
+	f.Add([]byte("{\"id\":1,\"method\":\"echo\"}\r\n\n{\"id\":2"))
+	f.Add([]byte("\x00\xff{[\n\"\\"))
+	f.Add([]byte(`{"id":1,"method":"missing"}` + "\n" + `{"method":"echo"}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		server := echoServer()
+		server.SetMaxMessageSize(256)
+		var out bytes.Buffer
+		if err := server.Serve(bytes.NewReader(data), &out); err != nil {
+			t.Fatalf("Serve returned error for %q: %v", data, err)
+		}
+		decodeResponses(t, out.String())
+	})
+}
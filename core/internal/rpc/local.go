@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// errClosed ends the input of a session that was closed explicitly, which cancels the
+// requests it still runs.
+var errClosed = errors.New("rpc: session closed")
+
+// Authenticator checks the credential a client presented to a transport, such as a bearer
+// token, and returns the tenant its sessions run as.
+type Authenticator func(credential string) (tenant string, ok bool)
+
+// TokenAuthenticator accepts token, and nothing when it is empty, for sessions of the
+// core's own tenant.
+func TokenAuthenticator(token string) Authenticator {
+	return func(credential string) (string, bool) {
+		return "", token != "" && subtle.ConstantTimeCompare([]byte(credential), []byte(token)) == 1
+	}
+}
+
+// Local is an in-process connection to the server, for transports that do not carry
+// line-delimited JSON-RPC themselves, such as HTTP and gRPC. It runs one session, so the
+// handlers see it like any other client.
+type Local struct {
+	input  *io.PipeWriter
+	reader *io.PipeReader
+	output *json.Decoder
+	served chan error
+}
+
+// Connect opens a local connection.
+func (s *Server) Connect() *Local {
+	return s.ConnectAs("")
+}
+
+// ConnectAs opens a local connection whose session runs as tenant.
+func (s *Server) ConnectAs(tenant string) *Local {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	l := &Local{input: inW, reader: outR, output: json.NewDecoder(outR), served: make(chan error, 1)}
+	go func() {
+		err := s.ServeAs(tenant, inR, outW)
+		outW.Close()
+		l.served <- err
+	}()
+	return l
+}
+
+// Send writes one message, a request or a notification, to the session.
+func (l *Local) Send(message any) error {
+	encoded, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = l.input.Write(append(encoded, '\n'))
+	return err
+}
+
+// Receive returns the next message the session wrote, a response or a notification. It
+// returns io.EOF once the session has ended. The session waits for messages to be
+// received, so they must be read until the expected response arrives.
+func (l *Local) Receive() (json.RawMessage, error) {
+	var message json.RawMessage
+	if err := l.output.Decode(&message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Close ends the session, discarding what it still writes, and waits for it to finish.
+// Requests the session still runs are cancelled.
+func (l *Local) Close() error {
+	l.input.CloseWithError(errClosed)
+	_, _ = io.Copy(io.Discard, l.reader)
+	return <-l.served
+}
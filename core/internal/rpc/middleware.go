@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Middleware wraps the handler of a method. Middleware can inspect or rewrite parameters,
+// short-circuit with an error, or observe the result.
+type Middleware func(method string, next HandlerFunc) HandlerFunc
+
+// Call describes a request as seen by hooks.
+type Call struct {
+	Method    string
+	RequestID string
+	// ParamsSize is the length of the raw parameters in bytes; hooks receive sizes rather
+	// than parameters so that credentials are not copied into audit or metrics sinks.
+	ParamsSize int
+	Started    time.Time
+	// Duration and Error are set for After hooks only.
+	Duration time.Duration
+	Error    *Error
+}
+
+// Hooks builds a Middleware from plain before/after callbacks.
+type Hooks struct {
+	// Before runs ahead of the handler. Returning an error rejects the request without
+	// calling the handler; After still runs.
+	Before func(ctx context.Context, call Call) *Error
+	// After runs once the handler (or Before) has produced a response.
+	After func(ctx context.Context, call Call, result any)
+}
+
+// Middleware returns the hooks as a Middleware.
+func (h Hooks) Middleware() Middleware {
+	return func(method string, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, params json.RawMessage) (any, *Error) {
+			call := Call{Method: method, ParamsSize: len(params), Started: time.Now()}
+			call.RequestID, _ = RequestIDFromContext(ctx)
+
+			var (
+				result any
+				rpcErr *Error
+			)
+			if h.Before != nil {
+				rpcErr = h.Before(ctx, call)
+			}
+			if rpcErr == nil {
+				result, rpcErr = next(ctx, params)
+			}
+
+			if h.After != nil {
+				call.Duration = time.Since(call.Started)
+				call.Error = rpcErr
+				h.After(ctx, call, result)
+			}
+			return result, rpcErr
+		}
+	}
+}
+
+// chain wraps handler with the registered middleware, outermost first.
+func (s *Server) chain(method string, handler HandlerFunc) HandlerFunc {
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		handler = s.middleware[i](method, handler)
+	}
+	return handler
+}
@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServerRunsMiddlewareInOrder(t *testing.T) {
+	server := newSerialServer(zerolog.Nop())
+	server.Register("echo", func(_ context.Context, params json.RawMessage) (any, *Error) {
+		return string(params), nil
+	})
+
+	var order []string
+	var calls []Call
+	server.Use(
+		func(method string, next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, params json.RawMessage) (any, *Error) {
+				order = append(order, "outer:"+method)
+				return next(ctx, params)
+			}
+		},
+		Hooks{
+			Before: func(_ context.Context, call Call) *Error {
+				order = append(order, "before")
+				if call.ParamsSize > 10 {
+					return &Error{Code: -32602, Message: "too large"}
+				}
+				return nil
+			},
+			After: func(_ context.Context, call Call, _ any) {
+				calls = append(calls, call)
+			},
+		}.Middleware(),
+	)
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":"hi"}`,
+		`{"jsonrpc":"2.0","id":"b","method":"echo","params":"far too long"}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	if got := strings.Join(order, ","); got != "outer:echo,before,outer:echo,before" {
+		t.Fatalf("unexpected middleware order %s", got)
+	}
+	if len(calls) != 2 || calls[0].RequestID != "1" || calls[0].Error != nil {
+		t.Fatalf("unexpected first call %+v", calls)
+	}
+	if calls[1].Error == nil || calls[1].Error.Code != -32602 || calls[1].Method != "echo" {
+		t.Fatalf("expected rejected second call, got %+v", calls[1])
+	}
+	if !strings.Contains(out.String(), `"too large"`) {
+		t.Fatalf("expected rejection in response, got %s", out.String())
+	}
+}
@@ -0,0 +1,68 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicData is the data of the internal error returned when a handler panics. The incident
+// id lets a user's report be matched with the logged stack without exposing the stack,
+// which can contain parameters or credentials, to the client.
+type PanicData struct {
+	Incident string `json:"incident"`
+}
+
+// recovered turns a panic in handler into an internal error so that one faulty method does
+// not take down the process and every other in-flight request with it.
+func (s *Server) recovered(method string, handler HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, params json.RawMessage) (result any, rpcErr *Error) {
+		defer func() {
+			if value := recover(); value != nil {
+				incident := s.logPanic(ctx, method, value)
+				result, rpcErr = nil, &Error{
+					Code:    -32603,
+					Message: "internal error",
+					Data:    PanicData{Incident: incident},
+				}
+			}
+		}()
+		return handler(ctx, params)
+	}
+}
+
+// runNotification runs a notification handler, logging rather than propagating a panic.
+func (s *Server) runNotification(ctx context.Context, method string, handler NotificationFunc, params json.RawMessage) {
+	defer func() {
+		if value := recover(); value != nil {
+			s.logPanic(ctx, method, value)
+		}
+	}()
+	handler(ctx, params)
+}
+
+// logPanic records the panic value and full stack and returns the incident id.
+func (s *Server) logPanic(ctx context.Context, method string, value any) string {
+	incident := newIncidentID()
+	event := s.logger.Error().
+		Str("method", method).
+		Str("incident", incident).
+		Str("panic", fmt.Sprint(value)).
+		Str("stack", string(debug.Stack()))
+	if requestID, ok := RequestIDFromContext(ctx); ok {
+		event = event.Str("request_id", requestID)
+	}
+	event.Msg("handler panicked")
+	return incident
+}
+
+func newIncidentID() string {
+	var b [6]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServerRecoversFromHandlerPanics(t *testing.T) {
+	logs := &syncBuffer{}
+	server := newSerialServer(zerolog.New(logs))
+	server.Register("boom", func(context.Context, json.RawMessage) (any, *Error) {
+		panic("secret=hunter2")
+	})
+	server.Register("echo", func(_ context.Context, params json.RawMessage) (any, *Error) {
+		return params, nil
+	})
+	server.RegisterNotification("explode", func(context.Context, json.RawMessage) {
+		panic("in notification")
+	})
+	var observed *Error
+	server.Use(Hooks{After: func(_ context.Context, call Call, _ any) {
+		if call.Method == "boom" {
+			observed = call.Error
+		}
+	}}.Middleware())
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"boom"}`,
+		`{"jsonrpc":"2.0","method":"explode"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"echo","params":"still serving"}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected two responses, got %q", out.String())
+	}
+	var resp struct {
+		Error struct {
+			Code    int       `json:"code"`
+			Message string    `json:"message"`
+			Data    PanicData `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Error.Code != -32603 || resp.Error.Data.Incident == "" {
+		t.Fatalf("expected internal error with incident id, got %s", lines[0])
+	}
+	if strings.Contains(lines[0], "hunter2") || strings.Contains(lines[0], "goroutine") {
+		t.Fatalf("panic details leaked to the client: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"still serving"`) {
+		t.Fatalf("expected the server to keep serving, got %s", lines[1])
+	}
+	if observed == nil || observed.Code != -32603 {
+		t.Fatalf("expected middleware to observe the internal error, got %+v", observed)
+	}
+
+	// The notification runs on its own goroutine; wait for its panic to be logged.
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logs.String(), "in notification") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	logged := logs.String()
+	for _, want := range []string{resp.Error.Data.Incident, "secret=hunter2", "recover_test.go", "in notification"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("expected log to contain %q, got %s", want, logged)
+		}
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
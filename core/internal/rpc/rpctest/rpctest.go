@@ -0,0 +1,15 @@
+// Package rpctest holds helpers for tests that serve scripts of JSON-RPC messages.
+package rpctest
+
+import (
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+// NewSerialServer returns a server that runs one request of a client at a time, so that
+// tests feeding a script of requests can check the responses in the order of the requests.
+func NewSerialServer(logger zerolog.Logger) *rpc.Server {
+	server := rpc.NewServer(logger)
+	server.SetMaxConcurrency(1)
+	return server
+}
@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type schemaInner struct {
+	Seq int `json:"seq"`
+}
+
+type schemaSample struct {
+	Name    string            `json:"name" jsonschema:"required"`
+	Format  string            `json:"format,omitempty" jsonschema:"enum=csv|json"`
+	Limit   *int              `json:"limit"`
+	Tags    []string          `json:"tags"`
+	Labels  map[string]string `json:"labels"`
+	Raw     json.RawMessage   `json:"raw"`
+	Skipped string            `json:"-"`
+	hidden  string
+	schemaInner
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaOf(schemaSample{})
+
+	if s.Type != "object" || len(s.Required) != 1 || s.Required[0] != "name" {
+		t.Fatalf("unexpected object schema %+v", s)
+	}
+	if len(s.Properties) != 7 {
+		t.Fatalf("expected 7 properties, got %d: %+v", len(s.Properties), s.Properties)
+	}
+	if p := s.Properties["format"]; p.Type != "string" || len(p.Enum) != 2 {
+		t.Fatalf("unexpected format schema %+v", p)
+	}
+	if p := s.Properties["limit"]; p.Type != "integer" || !p.Nullable {
+		t.Fatalf("unexpected limit schema %+v", p)
+	}
+	if p := s.Properties["tags"]; p.Type != "array" || p.Items.Type != "string" {
+		t.Fatalf("unexpected tags schema %+v", p)
+	}
+	if p := s.Properties["labels"]; p.AdditionalProperties == nil || p.AdditionalProperties.Type != "string" {
+		t.Fatalf("unexpected labels schema %+v", p)
+	}
+	if p := s.Properties["raw"]; p.Type != "" {
+		t.Fatalf("expected raw to accept anything, got %+v", p)
+	}
+	if p := s.Properties["seq"]; p == nil || p.Type != "integer" {
+		t.Fatalf("expected embedded field to be flattened, got %+v", s.Properties)
+	}
+}
@@ -0,0 +1,264 @@
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultOutboundCapacity bounds the messages waiting to be written unless
+// SetOutboundCapacity says otherwise.
+const DefaultOutboundCapacity = 1024
+
+// NotifyPolicy decides what happens to a notification when the outbound queue is full.
+type NotifyPolicy int
+
+const (
+	// NotifyPark blocks the sender until the queue has room. It is the default, because
+	// most notifications (stream chunks, final job states) must not be lost.
+	NotifyPark NotifyPolicy = iota
+	// NotifyDrop discards the notification. It suits notifications that a later one
+	// supersedes, such as progress reports.
+	NotifyDrop
+)
+
+// OutboundStats describes the outbound queue.
+type OutboundStats struct {
+	Capacity  int `json:"capacity"`
+	Queued    int `json:"queued"`
+	HighWater int `json:"highWater"`
+	// Saturations counts the times the queue filled up.
+	Saturations  uint64  `json:"saturations"`
+	Written      uint64  `json:"written"`
+	Dropped      uint64  `json:"dropped"`
+	Parked       uint64  `json:"parked"`
+	ParkedTimeMs float64 `json:"parkedTimeMs"`
+}
+
+// lane holds the queued notifications of one request. Responses and notifications that
+// belong to no request share the lane with the empty id, which keeps responses in the
+// order the requests were answered.
+type lane struct {
+	id       string
+	messages []outbound
+	// held is set until the request's response is written; its notifications wait for it.
+	held  bool
+	ready bool
+}
+
+type outbound struct {
+	msg any
+	// release is the lane held back behind this response.
+	release *lane
+}
+
+// sequencer is the outbound queue. Senders enqueue and return while a single writer
+// goroutine encodes, so a slow client stalls senders only once the queue is full.
+//
+// Ordering: responses are written in the order they are queued, a request's response is
+// written before the notifications belonging to it, and messages of one lane keep their
+// order. Lanes are drained round-robin, so one busy stream cannot starve responses or the
+// notifications of other requests.
+type sequencer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	encoder *json.Encoder
+	onError func(msg any, err error)
+
+	capacity int
+	lanes    map[string]*lane
+	ready    []*lane
+	writing  bool
+	closed   bool
+	stats    OutboundStats
+	parked   time.Duration
+}
+
+func newSequencer(onError func(msg any, err error)) *sequencer {
+	q := &sequencer{
+		onError:  onError,
+		capacity: DefaultOutboundCapacity,
+		lanes:    make(map[string]*lane),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// reset writes to encoder from now on, once the messages queued so far are written.
+func (q *sequencer) reset(encoder *json.Encoder) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waitIdle()
+	q.encoder = encoder
+}
+
+func (q *sequencer) setCapacity(capacity int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.capacity = capacity
+}
+
+// open starts holding back notifications for requestID until respond is called.
+func (q *sequencer) open(requestID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.lane(requestID).held = true
+}
+
+// respond queues the response of requestID; the notifications held back for it follow once
+// it is written. Responses are never parked: the request loop must keep going for held
+// lanes to drain.
+func (q *sequencer) respond(requestID string, response any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	item := outbound{msg: response}
+	if l, ok := q.lanes[requestID]; ok && l.held {
+		item.release = l
+	}
+	q.enqueue(q.lane(""), item)
+}
+
+// notify queues msg, or applies policy while the queue is full. An empty requestID marks
+// a notification that is not tied to a request. Notifications sent after close are dropped.
+func (q *sequencer) notify(requestID string, msg any, policy NotifyPolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stats.Queued >= q.capacity && !q.closed {
+		if policy == NotifyDrop {
+			q.stats.Dropped++
+			return
+		}
+		q.stats.Parked++
+		began := time.Now()
+		for q.stats.Queued >= q.capacity && !q.closed {
+			q.cond.Wait()
+		}
+		q.parked += time.Since(began)
+	}
+	if q.closed {
+		q.stats.Dropped++
+		return
+	}
+	q.enqueue(q.lane(requestID), outbound{msg: msg})
+}
+
+// write queues msg outside any request, bypassing the capacity.
+func (q *sequencer) write(msg any) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.enqueue(q.lane(""), outbound{msg: msg})
+}
+
+// flush waits until every message that is not held back has been written.
+func (q *sequencer) flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waitIdle()
+}
+
+// close writes what is queued and drops everything sent afterwards, releasing parked
+// senders. Notifications still held back for unanswered requests are discarded.
+func (q *sequencer) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.waitIdle()
+	q.closed = true
+	q.lanes = make(map[string]*lane)
+	q.stats.Queued = 0
+	q.cond.Broadcast()
+}
+
+func (q *sequencer) snapshot() OutboundStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Capacity = q.capacity
+	stats.ParkedTimeMs = float64(q.parked.Microseconds()) / 1000
+	return stats
+}
+
+func (q *sequencer) waitIdle() {
+	for q.writing {
+		q.cond.Wait()
+	}
+}
+
+func (q *sequencer) lane(id string) *lane {
+	l, ok := q.lanes[id]
+	if !ok {
+		l = &lane{id: id}
+		q.lanes[id] = l
+	}
+	return l
+}
+
+func (q *sequencer) enqueue(l *lane, item outbound) {
+	if q.closed {
+		return
+	}
+	l.messages = append(l.messages, item)
+	q.stats.Queued++
+	if q.stats.Queued > q.stats.HighWater {
+		q.stats.HighWater = q.stats.Queued
+	}
+	if q.stats.Queued == q.capacity {
+		q.stats.Saturations++
+	}
+	q.schedule(l)
+}
+
+// schedule queues l for writing unless it is held back, already scheduled or empty.
+func (q *sequencer) schedule(l *lane) {
+	if l.held || l.ready {
+		return
+	}
+	if len(l.messages) == 0 {
+		delete(q.lanes, l.id)
+		return
+	}
+	l.ready = true
+	q.ready = append(q.ready, l)
+	if !q.writing {
+		q.writing = true
+		go q.drain()
+	}
+}
+
+// drain writes queued messages until none are ready. It runs on its own goroutine, started
+// on demand, so an idle server holds no writer.
+func (q *sequencer) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.ready) > 0 {
+		l := q.ready[0]
+		q.ready = q.ready[1:]
+		item := l.messages[0]
+		l.messages = l.messages[1:]
+		l.ready = false
+		q.schedule(l)
+		encoder := q.encoder
+
+		q.mu.Unlock()
+		err := fmt.Errorf("json encoder not initialized")
+		if encoder != nil {
+			err = encoder.Encode(item.msg)
+		}
+		if err != nil && q.onError != nil {
+			q.onError(item.msg, err)
+		}
+		q.mu.Lock()
+
+		q.stats.Queued--
+		if err == nil {
+			q.stats.Written++
+		}
+		if item.release != nil {
+			item.release.held = false
+			q.schedule(item.release)
+		}
+		q.cond.Broadcast()
+	}
+	q.writing = false
+	q.cond.Broadcast()
+}
@@ -0,0 +1,228 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// slowWriter delays every write to widen the window in which messages could interleave.
+type slowWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(200 * time.Microsecond)
+	return w.buf.Write(p)
+}
+
+func TestServerWritesResponseBeforeRequestNotifications(t *testing.T) {
+	server := NewServer(zerolog.Nop())
+
+	const chunks = 20
+	var handled, background sync.WaitGroup
+	handled.Add(2)
+	server.Register("stream", func(ctx context.Context, _ json.RawMessage) (any, *Error) {
+		defer handled.Done()
+		requestID, _ := RequestIDFromContext(ctx)
+		session, _ := SessionFromContext(ctx)
+		started := make(chan struct{})
+		background.Add(2)
+		go func() {
+			defer background.Done()
+			close(started)
+			_ = session.NotifyRequest(requestID, "stream.start", map[string]any{"requestId": requestID})
+			for seq := 1; seq <= chunks; seq++ {
+				_ = session.NotifyRequest(requestID, "stream.chunk", map[string]any{"requestId": requestID, "seq": seq})
+			}
+			_ = session.NotifyRequest(requestID, "stream.complete", map[string]any{"requestId": requestID})
+		}()
+		go func() {
+			defer background.Done()
+			for i := 0; i < chunks; i++ {
+				_ = session.Notify("unrelated", nil)
+			}
+		}()
+		<-started
+		// Let the background work get ahead of the response.
+		time.Sleep(2 * time.Millisecond)
+		return "streaming", nil
+	})
+
+	// Keep the connection open until the background work is done; notifications sent after
+	// the session closes are dropped.
+	in, input := io.Pipe()
+	out := &slowWriter{}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(in, out) }()
+	_, _ = io.WriteString(input, `{"jsonrpc":"2.0","id":"a","method":"stream"}`+"\n"+`{"jsonrpc":"2.0","id":"b","method":"stream"}`+"\n")
+	handled.Wait()
+	background.Wait()
+	input.Close()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	answered := map[string]bool{}
+	nextSeq := map[string]int{}
+	completed := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(out.buf.String()), "\n") {
+		var msg struct {
+			ID     string `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				RequestID string `json:"requestId"`
+				Seq       int    `json:"seq"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("invalid message %q: %v", line, err)
+		}
+		id := msg.Params.RequestID
+		switch msg.Method {
+		case "":
+			answered[msg.ID] = true
+		case "unrelated":
+		case "stream.start", "stream.chunk", "stream.complete":
+			if !answered[id] {
+				t.Fatalf("%s for %s written before its response", msg.Method, id)
+			}
+			if completed[id] {
+				t.Fatalf("%s for %s written after stream.complete", msg.Method, id)
+			}
+			switch msg.Method {
+			case "stream.start":
+				nextSeq[id] = 1
+			case "stream.chunk":
+				if msg.Params.Seq != nextSeq[id] {
+					t.Fatalf("chunk %d for %s out of order, expected %d", msg.Params.Seq, id, nextSeq[id])
+				}
+				nextSeq[id]++
+			case "stream.complete":
+				completed[id] = true
+			}
+		default:
+			t.Fatalf("unexpected message %q", line)
+		}
+	}
+	for _, id := range []string{"a", "b"} {
+		if !completed[id] || nextSeq[id] != chunks+1 {
+			t.Errorf("stream %s incomplete: next seq %d, completed %v", id, nextSeq[id], completed[id])
+		}
+	}
+}
+
+// gateWriter blocks its first write until release is closed, so that messages pile up in
+// the queue behind it.
+type gateWriter struct {
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+	buf     bytes.Buffer
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() {
+		close(w.entered)
+		<-w.release
+	})
+	return w.buf.Write(p)
+}
+
+func lines(values ...string) string {
+	var b strings.Builder
+	for _, v := range values {
+		fmt.Fprintf(&b, "%q\n", v)
+	}
+	return b.String()
+}
+
+func TestSequencerHoldsNotificationsUntilResponse(t *testing.T) {
+	var out bytes.Buffer
+	q := newSequencer(nil)
+	q.reset(json.NewEncoder(&out))
+
+	q.open("1")
+	q.notify("1", "held", NotifyPark)
+	q.notify("2", "direct", NotifyPark)
+	q.flush()
+	if out.String() != lines("direct") {
+		t.Fatalf("expected only the unrelated notification, got:\n%s", out.String())
+	}
+
+	q.respond("1", "response")
+	q.notify("1", "after", NotifyPark)
+	q.flush()
+	if out.String() != lines("direct", "response", "held", "after") {
+		t.Fatalf("unexpected order:\n%s", out.String())
+	}
+}
+
+func TestSequencerDrainsLanesRoundRobin(t *testing.T) {
+	out := newGateWriter()
+	q := newSequencer(nil)
+	q.reset(json.NewEncoder(out))
+
+	q.write("first")
+	<-out.entered
+	for _, msg := range []string{"a1", "a2", "a3"} {
+		q.notify("a", msg, NotifyPark)
+	}
+	for _, msg := range []string{"b1", "b2"} {
+		q.notify("b", msg, NotifyPark)
+	}
+	close(out.release)
+	q.flush()
+
+	if got := out.buf.String(); got != lines("first", "a1", "b1", "a2", "b2", "a3") {
+		t.Fatalf("expected lanes to alternate, got:\n%s", got)
+	}
+}
+
+func TestSequencerParksOrDropsWhenFull(t *testing.T) {
+	out := newGateWriter()
+	q := newSequencer(nil)
+	q.setCapacity(2)
+	q.reset(json.NewEncoder(out))
+
+	q.write("first")
+	<-out.entered
+	q.notify("", "fills", NotifyPark)
+	q.notify("", "dropped", NotifyDrop)
+
+	parked := make(chan struct{})
+	go func() {
+		defer close(parked)
+		q.notify("", "parked", NotifyPark)
+	}()
+	select {
+	case <-parked:
+		t.Fatal("expected the sender to park while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(out.release)
+	<-parked
+	q.flush()
+
+	if got := out.buf.String(); got != lines("first", "fills", "parked") {
+		t.Fatalf("unexpected output:\n%s", got)
+	}
+	stats := q.snapshot()
+	if stats.Dropped != 1 || stats.Parked != 1 || stats.Saturations != 1 || stats.HighWater != 2 ||
+		stats.Written != 3 || stats.Queued != 0 || stats.Capacity != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -3,10 +3,10 @@ package rpc
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"github.com/rs/zerolog"
 )
@@ -47,18 +47,39 @@ type Server struct {
 	logger        zerolog.Logger
 	handlers      map[string]HandlerFunc
 	notifications map[string]NotificationFunc
-	inflight      sync.Map
-	writeMu       sync.Mutex
-	encoder       *json.Encoder
+	middleware    []Middleware
+	docs          map[string]MethodDoc
+	paramSchemas  map[string]*Schema
+	outbound      map[string]MethodDoc
+	sessions      sync.Map
+	nextSession   atomic.Uint64
+	maxMessage    int
+	queueCapacity int
+	concurrency   int
+	notifyPolicy  map[string]NotifyPolicy
 }
 
-// NewServer constructs a server instance.
+// NewServer constructs a server instance. The rpc.describe introspection method is
+// registered automatically.
 func NewServer(logger zerolog.Logger) *Server {
-	return &Server{
+	s := &Server{
 		logger:        logger,
 		handlers:      make(map[string]HandlerFunc),
 		notifications: make(map[string]NotificationFunc),
+		docs:          make(map[string]MethodDoc),
+		paramSchemas:  make(map[string]*Schema),
+		outbound:      make(map[string]MethodDoc),
+		maxMessage:    DefaultMaxMessageSize,
+		queueCapacity: DefaultOutboundCapacity,
+		concurrency:   DefaultMaxConcurrency,
+		notifyPolicy:  make(map[string]NotifyPolicy),
 	}
+	s.Register("rpc.describe", s.describeHandler)
+	s.Document("rpc.describe", MethodDoc{
+		Summary: "List registered methods and notifications with their parameter and result schemas",
+		Result:  describeResult{},
+	})
+	return s
 }
 
 // Register registers an RPC handler.
@@ -66,94 +87,85 @@ func (s *Server) Register(method string, handler HandlerFunc) {
 	s.handlers[method] = handler
 }
 
-// RegisterNotification registers a notification handler.
-func (s *Server) RegisterNotification(method string, handler NotificationFunc) {
-	s.notifications[method] = handler
+// SetMaxMessageSize bounds incoming messages; larger ones are answered with an invalid
+// request error and skipped. It must be called before Serve.
+func (s *Server) SetMaxMessageSize(limit int) {
+	if limit > 0 {
+		s.maxMessage = limit
+	}
 }
 
-// Cancel cancels an in-flight request, if present.
-func (s *Server) Cancel(requestID string) bool {
-	if value, ok := s.inflight.Load(requestID); ok {
-		if cancel, ok := value.(context.CancelFunc); ok {
-			cancel()
-			s.inflight.Delete(requestID)
-			return true
-		}
+// SetOutboundCapacity bounds the messages waiting to be written to each client. It must be
+// called before Serve.
+func (s *Server) SetOutboundCapacity(capacity int) {
+	if capacity > 0 {
+		s.queueCapacity = capacity
 	}
-	return false
 }
 
-// Serve starts processing incoming JSON-RPC messages.
-func (s *Server) Serve(reader io.Reader, writer io.Writer) error {
-	decoder := json.NewDecoder(reader)
-	encoder := json.NewEncoder(writer)
-	s.encoder = encoder
-
-	for {
-		var req Request
-		if err := decoder.Decode(&req); err != nil {
-			if errors.Is(err, io.EOF) {
-				return nil
-			}
-			s.logger.Error().Err(err).Msg("failed to decode JSON")
-			return err
-		}
-
-		if req.ID == nil {
-			if handler, ok := s.notifications[req.Method]; ok {
-				go handler(context.Background(), req.Params)
-			} else {
-				s.logger.Warn().Str("method", req.Method).Msg("notification handler not found")
-			}
-			continue
-		}
+// SetMaxConcurrency bounds the requests of each client that run at once; the others wait
+// their turn in the order they arrived. A limit of 1 runs a client's requests one after
+// another. It must be called before Serve.
+func (s *Server) SetMaxConcurrency(limit int) {
+	if limit > 0 {
+		s.concurrency = limit
+	}
+}
 
-		handler, ok := s.handlers[req.Method]
-		if !ok {
-			resp := Response{
-				JSONRPC: "2.0",
-				ID:      req.ID,
-				Error: &Error{
-					Code:    -32601,
-					Message: "method not found",
-				},
-			}
-			if err := s.writeJSON(resp); err != nil {
-				s.logger.Error().Err(err).Msg("failed to encode response")
-			}
-			continue
-		}
+// SetNotifyPolicy decides what happens to notifications of method while the outbound
+// queue is full. Notifications park their sender by default. It must be called before
+// Serve.
+func (s *Server) SetNotifyPolicy(method string, policy NotifyPolicy) {
+	s.notifyPolicy[method] = policy
+}
 
-		ctx, cancel := context.WithCancel(context.Background())
-		var inflightKey string
-		if key, ok := canonicalID(req.ID); ok {
-			inflightKey = key
-			s.inflight.Store(key, cancel)
-			ctx = context.WithValue(ctx, ctxRequestIDKey{}, key)
-		}
+// Flush waits until the queued responses and notifications of every session are written,
+// except the notifications held back behind a response that is still pending.
+func (s *Server) Flush() {
+	s.sessions.Range(func(_, value any) bool {
+		value.(*Session).outbox.flush()
+		return true
+	})
+}
 
-		result, rpcErr := handler(ctx, req.Params)
+// Use appends middleware to the chain wrapped around every request handler. The first
+// middleware added is the outermost. It must be called before Serve.
+func (s *Server) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+}
 
-		cancel()
-		if inflightKey != "" {
-			s.inflight.Delete(inflightKey)
-		}
+// RegisterNotification registers a notification handler.
+func (s *Server) RegisterNotification(method string, handler NotificationFunc) {
+	s.notifications[method] = handler
+}
 
-		resp := Response{
-			JSONRPC: "2.0",
-			ID:      req.ID,
-		}
+// Serve serves one client connection: it reads JSON-RPC messages, one per line, from reader
+// and writes responses and notifications to writer. Each request runs on its own goroutine,
+// up to SetMaxConcurrency at a time, so responses may come back in a different order than
+// the requests. Malformed or oversized messages and unknown methods are answered at once
+// with error objects; only read failures stop it, and cancel the requests still running or
+// waiting. Serve may run concurrently for several connections, each in its own Session, and
+// returns once the requests read have been answered, the session is closed and its queued
+// messages are written.
+func (s *Server) Serve(reader io.Reader, writer io.Writer) error {
+	return s.ServeAs("", reader, writer)
+}
 
-		if rpcErr != nil {
-			resp.Error = rpcErr
-		} else {
-			resp.Result = result
-		}
+// ServeAs serves one client connection like Serve, in a session that runs as tenant, the
+// client a transport authenticated. The empty tenant is the core's own.
+func (s *Server) ServeAs(tenant string, reader io.Reader, writer io.Writer) error {
+	session := s.newSession(writer)
+	session.tenant = tenant
+	defer session.close()
+	return session.serve(reader)
+}
 
-		if err := s.writeJSON(resp); err != nil {
-			s.logger.Error().Err(err).Msg("failed to encode response")
-		}
+func (s *Server) logOutboundError(msg any, err error) {
+	event := s.logger.Error().Err(err)
+	if resp, ok := msg.(Response); ok && resp.ID != nil {
+		event = event.RawJSON("id", *resp.ID)
 	}
+	event.Msg("failed to encode outbound message")
 }
 
 func canonicalID(raw *json.RawMessage) (string, bool) {
@@ -191,24 +203,25 @@ func RequestIDFromContext(ctx context.Context) (string, bool) {
 	return "", false
 }
 
-func (s *Server) writeJSON(v interface{}) error {
-	s.writeMu.Lock()
-	defer s.writeMu.Unlock()
-	if s.encoder == nil {
-		return fmt.Errorf("json encoder not initialized")
-	}
-	return s.encoder.Encode(v)
-}
-
-// Notify emits a JSON-RPC notification to the connected client.
+// Notify emits a JSON-RPC notification to every connected client, subject to each
+// session's notification filter. Notifications for one client go through its Session.
 func (s *Server) Notify(method string, params interface{}) error {
-	payload := map[string]interface{}{
-		"jsonrpc": "2.0",
-		"method":  method,
-	}
-	if params != nil {
-		payload["params"] = params
-	}
-	return s.writeJSON(payload)
+	s.sessions.Range(func(_, value any) bool {
+		_ = value.(*Session).Notify(method, params)
+		return true
+	})
+	return nil
 }
 
+// NotifyTenant emits a JSON-RPC notification to the clients running as tenant, the empty
+// tenant being the core's own. Events about a tenant's work go through it so that other
+// tenants never see them.
+func (s *Server) NotifyTenant(tenant, method string, params interface{}) error {
+	s.sessions.Range(func(_, value any) bool {
+		if session := value.(*Session); session.tenant == tenant {
+			_ = session.Notify(method, params)
+		}
+		return true
+	})
+	return nil
+}
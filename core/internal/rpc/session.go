@@ -0,0 +1,331 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Session is the server side of one client connection. It owns everything that must not
+// leak between clients: in-flight requests, the outbound queue, the notification filter
+// and the per-connection state of handlers. One client can therefore only cancel or ack
+// its own requests. Closing the session, which Serve does when the connection ends,
+// cancels its requests and runs the cleanups registered with OnClose.
+type Session struct {
+	server       *Server
+	id           string
+	tenant       string
+	ctx          context.Context
+	cancel       context.CancelFunc
+	outbox       *sequencer
+	inflight     sync.Map
+	notifyFilter atomic.Pointer[func(method string) bool]
+
+	valuesMu sync.Mutex
+	values   map[any]any
+
+	mu      sync.Mutex
+	cleanup []func()
+	closed  bool
+}
+
+type ctxSessionKey struct{}
+
+// SessionFromContext returns the session serving the request or notification that ctx was
+// passed to.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	session, ok := ctx.Value(ctxSessionKey{}).(*Session)
+	return session, ok
+}
+
+func (s *Server) newSession(writer io.Writer) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	session := &Session{
+		server: s,
+		id:     "s-" + strconv.FormatUint(s.nextSession.Add(1), 10),
+		cancel: cancel,
+		outbox: newSequencer(s.logOutboundError),
+		values: make(map[any]any),
+	}
+	session.ctx = context.WithValue(ctx, ctxSessionKey{}, session)
+	session.outbox.setCapacity(s.queueCapacity)
+	session.outbox.reset(json.NewEncoder(writer))
+	s.sessions.Store(session.id, session)
+	return session
+}
+
+// ID identifies the session in logs.
+func (c *Session) ID() string {
+	return c.id
+}
+
+// Tenant is the client the transport authenticated the session as, or "" for a session of
+// the core's own, such as the editor on stdio.
+func (c *Session) Tenant() string {
+	return c.tenant
+}
+
+// Context is cancelled when the session closes. Work that outlives a request but belongs to
+// the client, such as a running stream, should derive from it.
+func (c *Session) Context() context.Context {
+	return c.ctx
+}
+
+// Value returns the session's state for key, calling create to make it on first use. It
+// lets handlers keep per-connection state without a registry of their own; create may
+// register the state's cleanup with OnClose.
+func (c *Session) Value(key any, create func() any) any {
+	c.valuesMu.Lock()
+	defer c.valuesMu.Unlock()
+	value, ok := c.values[key]
+	if !ok {
+		value = create()
+		c.values[key] = value
+	}
+	return value
+}
+
+// OnClose registers fn to run when the session closes. On a closed session fn runs at once.
+func (c *Session) OnClose(fn func()) {
+	c.mu.Lock()
+	if !c.closed {
+		c.cleanup = append(c.cleanup, fn)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	fn()
+}
+
+// Cancel cancels one of the session's in-flight requests, if present.
+func (c *Session) Cancel(requestID string) bool {
+	if value, ok := c.inflight.LoadAndDelete(requestID); ok {
+		value.(context.CancelFunc)()
+		return true
+	}
+	return false
+}
+
+// FilterNotifications installs a predicate consulted before every outbound notification;
+// notifications it rejects are dropped silently. A nil filter lets everything through.
+func (c *Session) FilterNotifications(filter func(method string) bool) {
+	if filter == nil {
+		c.notifyFilter.Store(nil)
+		return
+	}
+	c.notifyFilter.Store(&filter)
+}
+
+// Notify emits a notification to this client only.
+func (c *Session) Notify(method string, params interface{}) error {
+	return c.NotifyRequest("", method, params)
+}
+
+// NotifyRequest emits a notification that belongs to the request with the given canonical
+// id, as returned by RequestIDFromContext. While that request has not been answered the
+// notification is held back and written right after the response, so clients always see
+// a request's response before the notifications it started. Notifications for one request
+// sent from one goroutine keep their order.
+//
+// Notifications are queued rather than written; while the queue is full the method's
+// NotifyPolicy either parks the caller or drops the notification.
+func (c *Session) NotifyRequest(requestID, method string, params interface{}) error {
+	if filter := c.notifyFilter.Load(); filter != nil && !(*filter)(method) {
+		return nil
+	}
+	payload := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+	}
+	if params != nil {
+		payload["params"] = params
+	}
+	c.outbox.notify(requestID, payload, c.server.notifyPolicy[method])
+	return nil
+}
+
+// OutboundStats reports the state of the session's outbound queue.
+func (c *Session) OutboundStats() OutboundStats {
+	return c.outbox.snapshot()
+}
+
+// close cancels the session's requests, runs its cleanups and writes what is still queued.
+// Notifications sent to a closed session are dropped.
+func (c *Session) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	cleanup := c.cleanup
+	c.cleanup = nil
+	c.mu.Unlock()
+
+	c.server.sessions.Delete(c.id)
+	c.cancel()
+	c.inflight.Range(func(key, value any) bool {
+		value.(context.CancelFunc)()
+		c.inflight.Delete(key)
+		return true
+	})
+	for i := len(cleanup) - 1; i >= 0; i-- {
+		cleanup[i]()
+	}
+	c.outbox.close()
+}
+
+// serve processes incoming JSON-RPC messages, one per line, until reader ends. Each request
+// runs on its own goroutine once it has a turn; see requestSlots.
+func (c *Session) serve(reader io.Reader) error {
+	s := c.server
+	buffered := bufio.NewReader(reader)
+	slots := newRequestSlots(s.concurrency)
+	// Requests still running or waiting when the input ends are answered before the session
+	// closes: a client may close its side once it has sent everything and still read the
+	// responses. They are only cancelled at once when the session is closed explicitly or
+	// reading fails.
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	// answer queues the response returned by respond once the message has a turn. Turns
+	// are taken in the order messages arrive and a response is queued before its turn is
+	// given up, so with a limit of 1 responses keep the order of the messages.
+	answer := func(ctx context.Context, requestID string, id *json.RawMessage, respond func() Response) {
+		turn := slots.enter()
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			select {
+			case <-turn:
+			case <-ctx.Done():
+			}
+			// A request cancelled while it waited does not run, even if its turn came.
+			resp := errorResponse(id, &Error{
+				Code:    -32800,
+				Message: "request cancelled",
+			})
+			if ctx.Err() == nil {
+				resp = respond()
+			}
+			c.outbox.respond(requestID, resp)
+			slots.leave(turn)
+		}()
+	}
+	// Messages that cannot run are answered at once, without waiting for a turn.
+	answerError := func(id *json.RawMessage, rpcErr *Error) {
+		c.outbox.respond("", errorResponse(id, rpcErr))
+	}
+
+	for {
+		line, err := readMessage(buffered, s.maxMessage)
+		if errors.Is(err, errMessageTooLarge) {
+			s.logger.Warn().Str("session", c.id).Int("limit", s.maxMessage).Msg("discarding oversized message")
+			answerError(nil, &Error{
+				Code:    -32600,
+				Message: "invalid request",
+				Data:    fmt.Sprintf("message exceeds %d bytes", s.maxMessage),
+			})
+			continue
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			c.cancel()
+			if errors.Is(err, errClosed) {
+				return nil
+			}
+			s.logger.Error().Err(err).Str("session", c.id).Msg("failed to read message")
+			return err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		req, rpcErr := decodeRequest(line)
+		if rpcErr != nil {
+			s.logger.Warn().Str("session", c.id).Str("error", rpcErr.Message).Msg("rejecting malformed message")
+			answerError(req.ID, rpcErr)
+			continue
+		}
+
+		if req.ID == nil {
+			if handler, ok := s.notifications[req.Method]; ok {
+				if schema, ok := s.paramSchemas[req.Method]; ok {
+					if rpcErr := schema.Validate(req.Params); rpcErr != nil {
+						s.logger.Warn().Str("method", req.Method).Str("error", rpcErr.Message).Msg("dropping invalid notification")
+						continue
+					}
+				}
+				go s.runNotification(c.ctx, req.Method, handler, req.Params)
+			} else {
+				s.logger.Warn().Str("method", req.Method).Msg("notification handler not found")
+			}
+			continue
+		}
+
+		handler, ok := s.handlers[req.Method]
+		if !ok {
+			answerError(req.ID, &Error{
+				Code:    -32601,
+				Message: "method not found",
+			})
+			continue
+		}
+
+		// The request is in flight, and can be cancelled, while it waits for its turn.
+		ctx, cancel := context.WithCancel(c.ctx)
+		var inflightKey string
+		if key, ok := canonicalID(req.ID); ok {
+			inflightKey = key
+			c.inflight.Store(key, cancel)
+			c.outbox.open(key)
+			ctx = context.WithValue(ctx, ctxRequestIDKey{}, key)
+		}
+
+		answer(ctx, inflightKey, req.ID, func() Response {
+			result, rpcErr := s.chain(req.Method, s.validated(req.Method, s.recovered(req.Method, handler)))(ctx, req.Params)
+
+			cancel()
+			if inflightKey != "" {
+				c.inflight.Delete(inflightKey)
+			}
+
+			resp := Response{
+				JSONRPC: "2.0",
+				ID:      req.ID,
+			}
+
+			if rpcErr != nil {
+				resp.Error = rpcErr
+			} else {
+				resp.Result = result
+			}
+			return resp
+		})
+	}
+}
+
+// errorResponse is an error response. Errors for messages without a readable id carry a
+// null id, as JSON-RPC requires.
+func errorResponse(id *json.RawMessage, rpcErr *Error) Response {
+	if id == nil {
+		id = &nullID
+	}
+	return Response{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   rpcErr,
+	}
+}
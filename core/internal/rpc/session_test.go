@@ -0,0 +1,299 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// testConn is one client connection to a server under test.
+type testConn struct {
+	t      *testing.T
+	input  *io.PipeWriter
+	output *bufio.Scanner
+	served chan error
+}
+
+func connect(t *testing.T, server *Server) *testConn {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testConn{t: t, input: inW, output: bufio.NewScanner(outR), served: make(chan error, 1)}
+	go func() {
+		err := server.Serve(inR, outW)
+		outW.Close()
+		c.served <- err
+	}()
+	return c
+}
+
+func (c *testConn) send(line string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.input, line+"\n"); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+func (c *testConn) receive() string {
+	c.t.Helper()
+	if !c.output.Scan() {
+		c.t.Fatalf("connection closed: %v", c.output.Err())
+	}
+	return c.output.Text()
+}
+
+// newSerialServer returns a server that runs one request of a client at a time, for tests
+// that check the responses in the order of the requests.
+func newSerialServer(logger zerolog.Logger) *Server {
+	server := NewServer(logger)
+	server.SetMaxConcurrency(1)
+	return server
+}
+
+func (c *testConn) close() {
+	c.t.Helper()
+	c.input.Close()
+	for c.output.Scan() {
+	}
+	if err := <-c.served; err != nil {
+		c.t.Fatalf("Serve returned error: %v", err)
+	}
+}
+
+func TestSessionsAreIsolated(t *testing.T) {
+	server := newSerialServer(zerolog.Nop())
+	waiting := make(chan *Session, 1)
+	server.Register("wait", func(ctx context.Context, _ json.RawMessage) (any, *Error) {
+		session, _ := SessionFromContext(ctx)
+		waiting <- session
+		<-ctx.Done()
+		return "cancelled", nil
+	})
+	cancelled := make(chan bool, 1)
+	server.RegisterNotification("cancel", func(ctx context.Context, params json.RawMessage) {
+		var id string
+		_ = json.Unmarshal(params, &id)
+		session, _ := SessionFromContext(ctx)
+		cancelled <- session.Cancel(id)
+	})
+	type counter struct{ n int }
+	closed := make(chan string, 2)
+	server.Register("count", func(ctx context.Context, _ json.RawMessage) (any, *Error) {
+		session, _ := SessionFromContext(ctx)
+		c := session.Value("counter", func() any {
+			session.OnClose(func() { closed <- session.ID() })
+			return &counter{}
+		}).(*counter)
+		c.n++
+		return c.n, nil
+	})
+	server.Register("broadcast", func(_ context.Context, _ json.RawMessage) (any, *Error) {
+		_ = server.Notify("hello", nil)
+		return "sent", nil
+	})
+
+	a, b := connect(t, server), connect(t, server)
+
+	a.send(`{"jsonrpc":"2.0","id":1,"method":"count"}`)
+	a.send(`{"jsonrpc":"2.0","id":2,"method":"count"}`)
+	b.send(`{"jsonrpc":"2.0","id":1,"method":"count"}`)
+	for _, want := range []string{`"result":1`, `"result":2`} {
+		if got := a.receive(); !strings.Contains(got, want) {
+			t.Fatalf("expected %s on a, got %s", want, got)
+		}
+	}
+	if got := b.receive(); !strings.Contains(got, `"result":1`) {
+		t.Fatalf("expected b to have its own state, got %s", got)
+	}
+
+	// b blocks in wait; a cancelling the same id must not reach it.
+	b.send(`{"jsonrpc":"2.0","id":"w","method":"wait"}`)
+	sessionB := <-waiting
+	a.send(`{"jsonrpc":"2.0","method":"cancel","params":"w"}`)
+	if <-cancelled {
+		t.Fatal("expected a to be unable to cancel b's request")
+	}
+
+	a.send(`{"jsonrpc":"2.0","id":3,"method":"broadcast"}`)
+	if got := a.receive(); !strings.Contains(got, `"hello"`) {
+		t.Fatalf("expected broadcast on a, got %s", got)
+	}
+	if got := a.receive(); !strings.Contains(got, `"sent"`) {
+		t.Fatalf("expected broadcast response on a, got %s", got)
+	}
+	if got := b.receive(); !strings.Contains(got, `"hello"`) {
+		t.Fatalf("expected broadcast on b while its request is still running, got %s", got)
+	}
+
+	if !sessionB.Cancel("w") {
+		t.Fatal("expected b's request to be in flight")
+	}
+	if got := b.receive(); !strings.Contains(got, `"cancelled"`) {
+		t.Fatalf("expected b's request to end, got %s", got)
+	}
+
+	a.close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected session state to be cleaned up on disconnect")
+	}
+	b.close()
+	<-closed
+}
+
+// blockingServer answers "wait" once release is closed and "echo" at once. "cancel"
+// notifications cancel the request whose id they carry.
+func blockingServer(release chan struct{}) *Server {
+	server := NewServer(zerolog.Nop())
+	server.Register("wait", func(ctx context.Context, _ json.RawMessage) (any, *Error) {
+		select {
+		case <-release:
+			return "released", nil
+		case <-ctx.Done():
+			return nil, &Error{Code: -32800, Message: "request cancelled"}
+		}
+	})
+	server.Register("echo", func(_ context.Context, params json.RawMessage) (any, *Error) {
+		return params, nil
+	})
+	server.RegisterNotification("cancel", func(ctx context.Context, params json.RawMessage) {
+		session, _ := SessionFromContext(ctx)
+		var id string
+		_ = json.Unmarshal(params, &id)
+		session.Cancel(id)
+	})
+	return server
+}
+
+func TestServeRunsRequestsConcurrently(t *testing.T) {
+	release := make(chan struct{})
+	c := connect(t, blockingServer(release))
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"wait"}`)
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"echo","params":"quick"}`)
+	if got := c.receive(); got != `{"jsonrpc":"2.0","result":"quick","id":2}` {
+		t.Fatalf("first response = %s", got)
+	}
+	close(release)
+	if got := c.receive(); got != `{"jsonrpc":"2.0","result":"released","id":1}` {
+		t.Fatalf("second response = %s", got)
+	}
+	c.close()
+}
+
+func TestServeQueuesRequestsOverTheLimit(t *testing.T) {
+	release := make(chan struct{})
+	server := blockingServer(release)
+	server.SetMaxConcurrency(1)
+	c := connect(t, server)
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"wait"}`)
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"echo","params":"queued"}`)
+	c.send(`{"jsonrpc":"2.0","id":3,"method":"echo","params":"cancelled"}`)
+	// The waiting request 3 is cancelled without running; request 2 keeps its turn.
+	c.send(`{"jsonrpc":"2.0","method":"cancel","params":"3"}`)
+	if got := c.receive(); got != `{"jsonrpc":"2.0","error":{"code":-32800,"message":"request cancelled"},"id":3}` {
+		t.Fatalf("first response = %s", got)
+	}
+	close(release)
+	for _, want := range []string{
+		`{"jsonrpc":"2.0","result":"released","id":1}`,
+		`{"jsonrpc":"2.0","result":"queued","id":2}`,
+	} {
+		if got := c.receive(); got != want {
+			t.Fatalf("response = %s, want %s", got, want)
+		}
+	}
+	c.close()
+}
+
+func TestServeAnswersRunningRequestsBeforeReturning(t *testing.T) {
+	release := make(chan struct{})
+	server := blockingServer(release)
+	server.SetMaxConcurrency(1)
+	input := `{"jsonrpc":"2.0","id":1,"method":"wait"}` + "\n" + `{"jsonrpc":"2.0","id":2,"method":"echo","params":"queued"}` + "\n"
+	var out strings.Builder
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(strings.NewReader(input), &out) }()
+	select {
+	case <-served:
+		t.Fatal("Serve returned while a request was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// The end of the input cancels neither the running nor the waiting request.
+	close(release)
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != `{"jsonrpc":"2.0","result":"released","id":1}`+"\n"+`{"jsonrpc":"2.0","result":"queued","id":2}`+"\n" {
+		t.Fatalf("output = %s", got)
+	}
+}
+
+func TestLocalCloseCancelsRequests(t *testing.T) {
+	server := blockingServer(make(chan struct{}))
+	started := make(chan struct{})
+	server.Use(func(method string, next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, params json.RawMessage) (any, *Error) {
+			close(started)
+			return next(ctx, params)
+		}
+	})
+	conn := server.Connect()
+	if err := conn.Send(map[string]any{"jsonrpc": "2.0", "id": 1, "method": "wait"}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	closed := make(chan error, 1)
+	go func() { closed <- conn.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for a running request")
+	}
+}
+
+func TestServeAnswersUnrunnableMessagesWithoutATurn(t *testing.T) {
+	release := make(chan struct{})
+	server := blockingServer(release)
+	server.SetMaxConcurrency(1)
+	c := connect(t, server)
+	c.send(`{"jsonrpc":"2.0","id":1,"method":"wait"}`)
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"missing"}`)
+	c.send(`{"jsonrpc":"2.0","id":3,`)
+	for _, want := range []string{
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"method not found"},"id":2}`,
+		`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse error"},"id":null}`,
+	} {
+		if got := c.receive(); got != want {
+			t.Fatalf("response = %s, want %s", got, want)
+		}
+	}
+	close(release)
+	if got := c.receive(); got != `{"jsonrpc":"2.0","result":"released","id":1}` {
+		t.Fatalf("response = %s", got)
+	}
+	c.close()
+}
+
+func TestServeRejectsEmptyRequestIDs(t *testing.T) {
+	c := connect(t, blockingServer(nil))
+	c.send(`{"jsonrpc":"2.0","id":"","method":"echo","params":"empty"}`)
+	if got := c.receive(); got != `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request","data":"id must not be empty"},"id":""}` {
+		t.Fatalf("response = %s", got)
+	}
+	// Later messages of the session still get through.
+	c.send(`{"jsonrpc":"2.0","id":2,"method":"echo","params":"next"}`)
+	if got := c.receive(); got != `{"jsonrpc":"2.0","result":"next","id":2}` {
+		t.Fatalf("response = %s", got)
+	}
+	c.close()
+}
@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"slices"
+	"sync"
+)
+
+// DefaultMaxConcurrency bounds the requests of one session that run at once unless
+// SetMaxConcurrency says otherwise.
+const DefaultMaxConcurrency = 16
+
+// requestSlots admits the requests of a session in the order they arrived, at most a
+// fixed number at a time. Requests over the limit wait for a turn without holding up
+// the reading of later messages, so cancellations and acks still get through.
+type requestSlots struct {
+	mu      sync.Mutex
+	free    int
+	waiting []chan struct{}
+}
+
+func newRequestSlots(limit int) *requestSlots {
+	return &requestSlots{free: limit}
+}
+
+// enter queues a request and returns its turn, a channel closed once the request may run.
+func (r *requestSlots) enter() chan struct{} {
+	turn := make(chan struct{})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.free > 0 {
+		r.free--
+		close(turn)
+		return turn
+	}
+	r.waiting = append(r.waiting, turn)
+	return turn
+}
+
+// leave gives up the slot of turn, or its place in the queue when it never ran.
+func (r *requestSlots) leave(turn chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.Index(r.waiting, turn); i >= 0 {
+		r.waiting = slices.Delete(r.waiting, i, i+1)
+		return
+	}
+	if len(r.waiting) > 0 {
+		next := r.waiting[0]
+		r.waiting = r.waiting[1:]
+		close(next)
+		return
+	}
+	r.free++
+}
@@ -0,0 +1,187 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// FieldError describes the first parameter that did not match the method schema. It is
+// carried in Error.Data of -32602 responses.
+type FieldError struct {
+	// Field is the dotted path of the offending value, for example options.maxRows or
+	// keys[2]; it is empty for the params object itself.
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Got      string `json:"got"`
+}
+
+// Validate checks raw parameters against the schema. Absent or null parameters are treated
+// as an empty object. Unknown properties are allowed, null is accepted wherever a value is
+// optional, and a required string must be non-empty.
+func (s *Schema) Validate(raw json.RawMessage) *Error {
+	var value any = map[string]any{}
+	if trimmed := bytes.TrimSpace(raw); len(trimmed) > 0 && !bytes.Equal(trimmed, []byte("null")) {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return &Error{
+				Code:    -32602,
+				Message: "invalid parameters",
+				Data:    err.Error(),
+			}
+		}
+	}
+
+	fieldErr := s.check("", value)
+	if fieldErr == nil {
+		return nil
+	}
+
+	name := fieldErr.Field
+	if name == "" {
+		name = "params"
+	}
+	message := fmt.Sprintf("invalid parameter %s: expected %s, got %s", name, fieldErr.Expected, fieldErr.Got)
+	if fieldErr.Got == "missing" {
+		message = fmt.Sprintf("parameter %s is required", name)
+	}
+	return &Error{Code: -32602, Message: message, Data: fieldErr}
+}
+
+func (s *Schema) check(path string, value any) *FieldError {
+	if value == nil || s.Type == "" {
+		return nil
+	}
+
+	mismatch := func() *FieldError {
+		return &FieldError{Field: path, Expected: s.Type, Got: jsonKind(value)}
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return mismatch()
+		}
+		for _, name := range s.Required {
+			if missing(object[name]) {
+				return &FieldError{Field: join(path, name), Expected: s.Properties[name].describe(), Got: "missing"}
+			}
+		}
+		// Walk properties in name order so the reported field is deterministic.
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				prop = s.AdditionalProperties
+			}
+			if prop == nil {
+				continue
+			}
+			if err := prop.check(join(path, name), object[name]); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return mismatch()
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.check(path+"["+strconv.Itoa(i)+"]", item); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return mismatch()
+		}
+		if len(s.Enum) > 0 && str != "" && !contains(s.Enum, str) {
+			return &FieldError{Field: path, Expected: s.describe(), Got: strconv.Quote(str)}
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		if _, err := strconv.ParseInt(number.String(), 10, 64); err != nil {
+			if _, err := strconv.ParseUint(number.String(), 10, 64); err != nil {
+				return &FieldError{Field: path, Expected: "integer", Got: "number " + number.String()}
+			}
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return mismatch()
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch()
+		}
+	}
+	return nil
+}
+
+// describe renders the expected type for error messages.
+func (s *Schema) describe() string {
+	if s == nil || s.Type == "" {
+		return "a value"
+	}
+	if len(s.Enum) > 0 {
+		return fmt.Sprintf("one of %q", s.Enum)
+	}
+	return s.Type
+}
+
+func missing(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	default:
+		return false
+	}
+}
+
+func jsonKind(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+type validateParams struct {
+	Connection struct {
+		Driver string `json:"driver" jsonschema:"required,enum=postgres|mysql"`
+		DSN    string `json:"dsn" jsonschema:"required"`
+	} `json:"connection" jsonschema:"required"`
+	Keys    []string `json:"keys"`
+	Options struct {
+		MaxRows int     `json:"maxRows"`
+		Ratio   float64 `json:"ratio"`
+		Cache   bool    `json:"cache"`
+	} `json:"options"`
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := SchemaOf(validateParams{})
+	valid := `{"connection":{"driver":"postgres","dsn":"x"}`
+
+	cases := []struct {
+		name    string
+		params  string
+		field   string
+		message string
+	}{
+		{name: "valid", params: valid + `,"options":{"maxRows":5,"ratio":0.5},"extra":1}`},
+		{name: "null optional", params: valid + `,"keys":null}`},
+		{name: "absent", params: ``, field: "connection", message: "parameter connection is required"},
+		{name: "missing nested", params: `{"connection":{"driver":"postgres"}}`, field: "connection.dsn", message: "parameter connection.dsn is required"},
+		{name: "empty string", params: `{"connection":{"driver":"postgres","dsn":""}}`, field: "connection.dsn"},
+		{name: "enum", params: `{"connection":{"driver":"oracle","dsn":"x"}}`, field: "connection.driver", message: `invalid parameter connection.driver: expected one of ["postgres" "mysql"], got "oracle"`},
+		{name: "wrong type", params: valid + `,"options":{"maxRows":"10"}}`, field: "options.maxRows", message: "invalid parameter options.maxRows: expected integer, got string"},
+		{name: "fraction", params: valid + `,"options":{"maxRows":1.5}}`, field: "options.maxRows"},
+		{name: "array item", params: valid + `,"keys":["id",2]}`, field: "keys[1]"},
+		{name: "not an object", params: `[1]`, field: "", message: "invalid parameter params: expected object, got array"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rpcErr := schema.Validate(json.RawMessage(tc.params))
+			if tc.field == "" && tc.message == "" {
+				if rpcErr != nil {
+					t.Fatalf("unexpected error %+v", rpcErr)
+				}
+				return
+			}
+			if rpcErr == nil || rpcErr.Code != -32602 {
+				t.Fatalf("expected -32602, got %+v", rpcErr)
+			}
+			fieldErr, ok := rpcErr.Data.(*FieldError)
+			if !ok || fieldErr.Field != tc.field {
+				t.Fatalf("expected field %q, got %+v", tc.field, rpcErr.Data)
+			}
+			if tc.message != "" && rpcErr.Message != tc.message {
+				t.Fatalf("expected message %q, got %q", tc.message, rpcErr.Message)
+			}
+		})
+	}
+}
+
+func TestServerValidatesDocumentedParams(t *testing.T) {
+	server := newSerialServer(zerolog.Nop())
+	called := 0
+	server.Register("connect", func(_ context.Context, _ json.RawMessage) (any, *Error) {
+		called++
+		return "ok", nil
+	})
+	server.Document("connect", MethodDoc{Summary: "connect", Params: validateParams{}})
+
+	var calls []Call
+	server.Use(Hooks{After: func(_ context.Context, call Call, _ any) { calls = append(calls, call) }}.Middleware())
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"connect","params":{"connection":{"driver":"mysql"}}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"connect","params":{"connection":{"driver":"mysql","dsn":"x"}}}`,
+	}, "\n")
+	var out bytes.Buffer
+	if err := server.Serve(strings.NewReader(input), &out); err != nil {
+		t.Fatalf("Serve returned error: %v", err)
+	}
+
+	if called != 1 {
+		t.Fatalf("expected the handler to run once, ran %d times", called)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"field":"connection.dsn"`) || !strings.Contains(lines[1], `"result":"ok"`) {
+		t.Fatalf("unexpected output %s", out.String())
+	}
+	if len(calls) != 2 || calls[0].Error == nil || calls[0].Error.Code != -32602 {
+		t.Fatalf("expected hooks to observe the rejected call, got %+v", calls)
+	}
+}
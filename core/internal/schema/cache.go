@@ -0,0 +1,85 @@
+package schema
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Cache keeps schema listings per connection and search term so repeated tree refreshes do
+// not hit the catalog. Connections are keyed by a hash of the DSN, never the DSN itself.
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	response ListResponse
+	stored   time.Time
+}
+
+// NewCache constructs a cache. A ttl of zero keeps entries until they are invalidated.
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]map[string]cacheEntry),
+	}
+}
+
+// ConnectionKey derives the cache key for a DSN.
+func ConnectionKey(dsn string) string {
+	sum := sha256.Sum256([]byte(dsn))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Get returns the cached listing for the connection and search term.
+func (c *Cache) Get(conn, search string) (ListResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[conn][search]
+	if !ok {
+		return ListResponse{}, false
+	}
+	if c.ttl > 0 && c.now().Sub(entry.stored) > c.ttl {
+		delete(c.entries[conn], search)
+		return ListResponse{}, false
+	}
+	return entry.response, true
+}
+
+// Put stores a listing.
+func (c *Cache) Put(conn, search string, response ListResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries[conn] == nil {
+		c.entries[conn] = make(map[string]cacheEntry)
+	}
+	c.entries[conn][search] = cacheEntry{response: response, stored: c.now()}
+}
+
+// Invalidate drops every listing of the connection and reports whether any was cached.
+// Listings are filtered by search term, so a new object may belong to any of them.
+func (c *Cache) Invalidate(conn string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.entries[conn]
+	delete(c.entries, conn)
+	return ok
+}
+
+// Clear drops every listing and returns how many connections had one.
+func (c *Cache) Clear() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.entries)
+	c.entries = make(map[string]map[string]cacheEntry)
+	return n
+}
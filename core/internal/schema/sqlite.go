@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// ListSQLite lists the tables and views of every database attached to a SQLite
+// connection, the main database first. Each attached database is reported as a schema
+// under the name it was attached as.
+func ListSQLite(ctx context.Context, db *sql.DB, req ListRequest) (ListResponse, error) {
+	// One connection, so that databases attached by the connection's DSN are all seen.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return ListResponse{}, err
+	}
+	defer conn.Close()
+
+	databases, err := sqliteDatabases(ctx, conn)
+	if err != nil {
+		return ListResponse{}, err
+	}
+	search := strings.ToLower(strings.TrimSpace(req.Search))
+	response := ListResponse{Schemas: []Schema{}}
+	for _, database := range databases {
+		tables, err := sqliteTables(ctx, conn, database)
+		if err != nil {
+			return ListResponse{}, err
+		}
+		schemaMatches := search == "" || strings.Contains(strings.ToLower(database), search)
+		var kept []Table
+		for _, table := range tables {
+			columns, err := sqliteColumns(ctx, conn, database, table.Name)
+			if err != nil {
+				return ListResponse{}, err
+			}
+			table.Columns = columns
+			if schemaMatches || strings.Contains(strings.ToLower(table.Name), search) || columnMatches(columns, search) {
+				kept = append(kept, table)
+			}
+		}
+		if len(kept) > 0 || (search == "" && database != "temp") {
+			response.Schemas = append(response.Schemas, Schema{Name: database, Tables: kept})
+		}
+	}
+	return response, nil
+}
+
+func columnMatches(columns []Column, search string) bool {
+	for _, column := range columns {
+		if strings.Contains(strings.ToLower(column.Name), search) {
+			return true
+		}
+	}
+	return false
+}
+
+func sqliteDatabases(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, "PRAGMA database_list")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var (
+			seq        int
+			name, file string
+		)
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func sqliteTables(ctx context.Context, conn *sql.Conn, database string) ([]Table, error) {
+	rows, err := conn.QueryContext(ctx,
+		`SELECT name, type FROM `+quoteSQLite(database)+`.sqlite_master
+		 WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+		 ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []Table
+	for rows.Next() {
+		var table Table
+		if err := rows.Scan(&table.Name, &table.Type); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func sqliteColumns(ctx context.Context, conn *sql.Conn, database, table string) ([]Column, error) {
+	rows, err := conn.QueryContext(ctx, "PRAGMA "+quoteSQLite(database)+".table_info("+quoteSQLite(table)+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []Column
+	for rows.Next() {
+		var (
+			cid          int
+			column       Column
+			defaultValue sql.NullString
+			primaryKey   int
+		)
+		if err := rows.Scan(&cid, &column.Name, &column.DataType, &column.NotNull, &defaultValue, &primaryKey); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+func quoteSQLite(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
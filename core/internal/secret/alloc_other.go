@@ -0,0 +1,7 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package secret
+
+func alloc(n int) (data []byte, locked bool, free func()) {
+	return heapAlloc(n)
+}
@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package secret
+
+import (
+	"os"
+	"syscall"
+)
+
+// alloc maps fresh pages for n bytes, so that locking and unlocking them cannot affect
+// other data, and locks them when the memory lock limit allows it.
+func alloc(n int) (data []byte, locked bool, free func()) {
+	page := os.Getpagesize()
+	size := (n + page) / page * page
+	data, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return heapAlloc(n)
+	}
+	locked = syscall.Mlock(data) == nil
+	return data, locked, func() {
+		clear(data)
+		if locked {
+			_ = syscall.Munlock(data)
+		}
+		_ = syscall.Munmap(data)
+	}
+}
@@ -0,0 +1,88 @@
+package secret
+
+import (
+	"fmt"
+	"sync"
+)
+
+const redacted = "[redacted]"
+
+// Secret holds a credential such as a DSN outside the garbage-collected heap where the
+// platform allows it, locked into RAM so that it is not swapped out. It prints and marshals
+// as "[redacted]", so that it cannot leak through logging or error data, and Release wipes
+// it. Copies of a Secret share the same buffer; the zero value is empty.
+type Secret struct {
+	buf *buffer
+}
+
+type buffer struct {
+	mu     sync.Mutex
+	data   []byte
+	locked bool
+	free   func()
+}
+
+// New copies value into a new secret. The caller should drop its own references to value;
+// Go strings cannot be wiped.
+func New(value string) Secret {
+	data, locked, free := alloc(len(value))
+	copy(data, value)
+	return Secret{buf: &buffer{data: data[:len(value)], locked: locked, free: free}}
+}
+
+// Reveal returns a copy of the value for handing to a driver, or "" once released.
+func (s Secret) Reveal() string {
+	if s.buf == nil {
+		return ""
+	}
+	s.buf.mu.Lock()
+	defer s.buf.mu.Unlock()
+	return string(s.buf.data)
+}
+
+// Locked reports whether the value is held in memory that cannot be swapped out.
+func (s Secret) Locked() bool {
+	if s.buf == nil {
+		return false
+	}
+	s.buf.mu.Lock()
+	defer s.buf.mu.Unlock()
+	return s.buf.locked
+}
+
+// Release zeroes and frees the value. It is safe to call more than once.
+func (s Secret) Release() {
+	if s.buf == nil {
+		return
+	}
+	s.buf.mu.Lock()
+	defer s.buf.mu.Unlock()
+	if s.buf.free == nil {
+		return
+	}
+	clear(s.buf.data)
+	s.buf.free()
+	s.buf.data, s.buf.locked, s.buf.free = nil, false, nil
+}
+
+// String implements fmt.Stringer.
+func (Secret) String() string { return redacted }
+
+// GoString implements fmt.GoStringer.
+func (Secret) GoString() string { return redacted }
+
+// Format implements fmt.Formatter, so that no verb prints the value.
+func (Secret) Format(f fmt.State, _ rune) { _, _ = f.Write([]byte(redacted)) }
+
+// MarshalJSON implements json.Marshaler.
+func (Secret) MarshalJSON() ([]byte, error) { return []byte(`"` + redacted + `"`), nil }
+
+// MarshalText implements encoding.TextMarshaler.
+func (Secret) MarshalText() ([]byte, error) { return []byte(redacted), nil }
+
+// heapAlloc is the fallback where pages cannot be mapped; the value is still wiped on
+// release, but the runtime may have copied it while it was live.
+func heapAlloc(n int) ([]byte, bool, func()) {
+	data := make([]byte, n)
+	return data, false, func() { clear(data) }
+}
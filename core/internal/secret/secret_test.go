@@ -0,0 +1,50 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecretIsRedactedAndReleased(t *testing.T) {
+	s := New("postgres://app:s3cret@db/app")
+	if got := s.Reveal(); got != "postgres://app:s3cret@db/app" {
+		t.Fatalf("unexpected value %q", got)
+	}
+
+	wrapped := struct {
+		DSN Secret `json:"dsn"`
+	}{s}
+	encoded, err := json.Marshal(wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed := fmt.Sprintf("%v %+v %#v %s %q %x", s, wrapped, wrapped, s, s, s)
+	for _, out := range []string{string(encoded), printed, fmt.Sprint(&s)} {
+		if strings.Contains(out, "s3cret") {
+			t.Fatalf("secret leaked in %s", out)
+		}
+	}
+
+	s.Release()
+	s.Release()
+	if s.Reveal() != "" || s.Locked() || s.buf.data != nil {
+		t.Fatal("expected a released secret to be empty")
+	}
+
+	var empty Secret
+	empty.Release()
+	if empty.Reveal() != "" {
+		t.Fatal("expected the zero secret to be empty")
+	}
+}
+
+func TestHeapAllocWipesOnFree(t *testing.T) {
+	data, locked, free := heapAlloc(4)
+	copy(data, "abcd")
+	free()
+	if locked || string(data) != "\x00\x00\x00\x00" {
+		t.Fatalf("expected the buffer to be wiped, got %q", data)
+	}
+}
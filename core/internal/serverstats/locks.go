@@ -0,0 +1,290 @@
+package serverstats
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LockSession is a session that waits for a lock or holds one that others wait for.
+type LockSession struct {
+	PID         int64  `json:"pid"`
+	User        string `json:"user,omitempty"`
+	Database    string `json:"database,omitempty"`
+	Application string `json:"application,omitempty"`
+	State       string `json:"state,omitempty"`
+	// TransactionMs is the age of the session's open transaction.
+	TransactionMs float64 `json:"transactionMs"`
+	Query         string  `json:"query"`
+	// BlockedBy lists the sessions this one waits for; empty for sessions that only block.
+	BlockedBy []int64 `json:"blockedBy"`
+	// WaitingFor is the lock the session waits for.
+	WaitingFor *LockTarget `json:"waitingFor,omitempty"`
+}
+
+// LockTarget describes a lock being waited for.
+type LockTarget struct {
+	LockType string `json:"lockType"`
+	Mode     string `json:"mode"`
+	Relation string `json:"relation,omitempty"`
+}
+
+// LockReport lists the sessions involved in lock waits.
+type LockReport struct {
+	Sessions []LockSession `json:"sessions"`
+	// RootBlockers are the sessions at the head of blocking chains: they block others
+	// without waiting themselves, so terminating them releases the chain.
+	RootBlockers []int64 `json:"rootBlockers"`
+	// BlockersKnown is false when the server only reported the waiting sessions.
+	BlockersKnown bool `json:"blockersKnown"`
+}
+
+const postgresLocksSQL = `with waiting as (
+  select pid, pg_blocking_pids(pid) as blocked_by
+  from pg_stat_activity
+  where cardinality(pg_blocking_pids(pid)) > 0
+), involved as (
+  select pid from waiting
+  union
+  select unnest(blocked_by) from waiting
+)
+select a.pid, coalesce(a.usename, ''), coalesce(a.datname, ''), coalesce(a.application_name, ''),
+  coalesce(a.state, ''), coalesce(extract(epoch from clock_timestamp() - a.xact_start) * 1000, 0)::float8,
+  coalesce(a.query, ''), coalesce(w.blocked_by, '{}'),
+  coalesce(l.locktype, ''), coalesce(l.mode, ''), coalesce(l.relation::regclass::text, '')
+from involved i
+join pg_stat_activity a on a.pid = i.pid
+left join waiting w on w.pid = a.pid
+left join lateral (
+  select locktype, mode, relation from pg_locks where pid = a.pid and not granted limit 1
+) l on true
+order by a.pid`
+
+// LocksPostgres reads lock waits from pg_stat_activity, pg_blocking_pids and pg_locks.
+func LocksPostgres(ctx context.Context, conn Conn) (LockReport, error) {
+	rows, err := conn.Query(ctx, postgresLocksSQL)
+	if err != nil {
+		return LockReport{}, err
+	}
+	defer rows.Close()
+
+	report := LockReport{BlockersKnown: true}
+	for rows.Next() {
+		var (
+			s                      LockSession
+			pid                    int32
+			blockedBy              []int32
+			lockType, mode, target string
+		)
+		if err := rows.Scan(&pid, &s.User, &s.Database, &s.Application, &s.State, &s.TransactionMs,
+			&s.Query, &blockedBy, &lockType, &mode, &target); err != nil {
+			return LockReport{}, err
+		}
+		s.PID = int64(pid)
+		s.Query = normalizeSpace(s.Query)
+		s.BlockedBy = make([]int64, len(blockedBy))
+		for i, blocker := range blockedBy {
+			s.BlockedBy[i] = int64(blocker)
+		}
+		if lockType != "" {
+			s.WaitingFor = &LockTarget{LockType: lockType, Mode: mode, Relation: target}
+		}
+		report.Sessions = append(report.Sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return LockReport{}, err
+	}
+	report.finish()
+	return report, nil
+}
+
+const mysqlLockWaitsSQL = `select waiting_pid, coalesce(waiting_query, ''), coalesce(waiting_lock_type, ''),
+  coalesce(waiting_lock_mode, ''), coalesce(locked_table, ''), coalesce(wait_age_secs, 0),
+  blocking_pid, coalesce(blocking_query, '')
+from sys.innodb_lock_waits`
+
+// LocksMySQL reads lock waits from sys.innodb_lock_waits. Where the sys schema is missing
+// it falls back to the waiting transactions listed by SHOW ENGINE INNODB STATUS, which does
+// not name their blockers.
+func LocksMySQL(ctx context.Context, db *sql.DB) (LockReport, error) {
+	rows, err := db.QueryContext(ctx, mysqlLockWaitsSQL)
+	if err != nil {
+		var typ, name, status string
+		if serr := db.QueryRowContext(ctx, "SHOW ENGINE INNODB STATUS").Scan(&typ, &name, &status); serr != nil {
+			return LockReport{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		report := LockReport{Sessions: parseInnoDBLockWaits(status)}
+		report.finish()
+		return report, nil
+	}
+	defer rows.Close()
+
+	byPID := make(map[int64]*LockSession)
+	session := func(pid int64) *LockSession {
+		s, ok := byPID[pid]
+		if !ok {
+			s = &LockSession{PID: pid, BlockedBy: []int64{}}
+			byPID[pid] = s
+		}
+		return s
+	}
+	for rows.Next() {
+		var (
+			waitingPID, blockingPID     int64
+			waitingQuery, blockingQuery string
+			lockType, mode, table       string
+			waitSeconds                 float64
+		)
+		if err := rows.Scan(&waitingPID, &waitingQuery, &lockType, &mode, &table, &waitSeconds,
+			&blockingPID, &blockingQuery); err != nil {
+			return LockReport{}, err
+		}
+		waiter := session(waitingPID)
+		waiter.Query = normalizeSpace(waitingQuery)
+		waiter.State = "waiting"
+		waiter.TransactionMs = max(waiter.TransactionMs, waitSeconds*1000)
+		waiter.BlockedBy = append(waiter.BlockedBy, blockingPID)
+		waiter.WaitingFor = &LockTarget{LockType: lockType, Mode: mode, Relation: table}
+		if blocker := session(blockingPID); blocker.Query == "" {
+			blocker.Query = normalizeSpace(blockingQuery)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return LockReport{}, err
+	}
+
+	report := LockReport{BlockersKnown: true}
+	for _, s := range byPID {
+		report.Sessions = append(report.Sessions, *s)
+	}
+	sort.Slice(report.Sessions, func(i, j int) bool { return report.Sessions[i].PID < report.Sessions[j].PID })
+	report.finish()
+	return report, nil
+}
+
+var (
+	innodbTransaction = regexp.MustCompile(`^---TRANSACTION \S+, ACTIVE (\d+) sec`)
+	innodbThread      = regexp.MustCompile(`^MySQL thread id (\d+),`)
+	innodbWaiting     = regexp.MustCompile(`^------- TRX HAS BEEN WAITING`)
+	innodbRecordLock  = regexp.MustCompile("^RECORD LOCKS .* of table (`[^`]+`\\.`[^`]+`) .*lock_mode (\\S+)")
+	innodbTableLock   = regexp.MustCompile("^TABLE LOCK table (`[^`]+`\\.`[^`]+`) .*lock mode (\\S+)")
+)
+
+// parseInnoDBLockWaits extracts the transactions waiting for a lock from the TRANSACTIONS
+// section of SHOW ENGINE INNODB STATUS.
+func parseInnoDBLockWaits(status string) []LockSession {
+	var (
+		sessions []LockSession
+		current  *LockSession
+		active   float64
+		// inQuery is set between the thread line and the next section marker, where
+		// InnoDB prints the statement text.
+		inQuery bool
+		waiting bool
+	)
+	flush := func() {
+		if current != nil && current.WaitingFor != nil {
+			current.Query = normalizeSpace(current.Query)
+			sessions = append(sessions, *current)
+		}
+		current, inQuery, waiting = nil, false, false
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " ")
+		switch {
+		case strings.HasPrefix(line, "---TRANSACTION "):
+			flush()
+			if m := innodbTransaction.FindStringSubmatch(line); m != nil {
+				seconds, _ := strconv.ParseFloat(m[1], 64)
+				active = seconds
+			} else {
+				active = 0
+			}
+		case strings.HasPrefix(line, "MySQL thread id "):
+			m := innodbThread.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			pid, _ := strconv.ParseInt(m[1], 10, 64)
+			current = &LockSession{PID: pid, TransactionMs: active * 1000, State: "waiting", BlockedBy: []int64{}}
+			inQuery = true
+		case current == nil:
+		case innodbWaiting.MatchString(line):
+			inQuery, waiting = false, true
+		case waiting:
+			if m := innodbRecordLock.FindStringSubmatch(line); m != nil {
+				current.WaitingFor = &LockTarget{LockType: "RECORD", Mode: m[2], Relation: m[1]}
+			} else if m := innodbTableLock.FindStringSubmatch(line); m != nil {
+				current.WaitingFor = &LockTarget{LockType: "TABLE", Mode: m[2], Relation: m[1]}
+			}
+			waiting = false
+		case inQuery && (strings.HasPrefix(line, "---") || strings.HasPrefix(line, "Trx ") || line == ""):
+			inQuery = false
+		case inQuery:
+			current.Query += " " + line
+		}
+	}
+	flush()
+	return sessions
+}
+
+// finish computes the root blockers and normalizes empty lists for JSON.
+func (r *LockReport) finish() {
+	if r.Sessions == nil {
+		r.Sessions = []LockSession{}
+	}
+	waiting := make(map[int64]bool)
+	for _, s := range r.Sessions {
+		if len(s.BlockedBy) > 0 {
+			waiting[s.PID] = true
+		}
+	}
+	roots := make(map[int64]bool)
+	for _, s := range r.Sessions {
+		for _, blocker := range s.BlockedBy {
+			if !waiting[blocker] {
+				roots[blocker] = true
+			}
+		}
+	}
+	r.RootBlockers = make([]int64, 0, len(roots))
+	for pid := range roots {
+		r.RootBlockers = append(r.RootBlockers, pid)
+	}
+	sort.Slice(r.RootBlockers, func(i, j int) bool { return r.RootBlockers[i] < r.RootBlockers[j] })
+}
+
+// TerminatePostgres ends the backend pid, or only its running statement when cancelOnly is
+// set. It reports whether the backend was signalled.
+func TerminatePostgres(ctx context.Context, conn Conn, pid int64, cancelOnly bool) (bool, error) {
+	fn := "pg_terminate_backend"
+	if cancelOnly {
+		fn = "pg_cancel_backend"
+	}
+	var signalled bool
+	if err := queryRow(ctx, conn, "select "+fn+"($1::int)", []any{pid}, &signalled); err != nil {
+		return false, err
+	}
+	return signalled, nil
+}
+
+// TerminateMySQL kills the connection with the given thread id, or only its running
+// statement when cancelOnly is set.
+func TerminateMySQL(ctx context.Context, db *sql.DB, pid int64, cancelOnly bool) (bool, error) {
+	statement := "KILL CONNECTION "
+	if cancelOnly {
+		statement = "KILL QUERY "
+	}
+	if _, err := db.ExecContext(ctx, statement+strconv.FormatInt(pid, 10)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
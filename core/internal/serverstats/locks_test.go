@@ -0,0 +1,116 @@
+package serverstats
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const innodbStatus = `
+------------
+TRANSACTIONS
+------------
+Trx id counter 1290
+History list length 4
+LIST OF TRANSACTIONS FOR EACH SESSION:
+---TRANSACTION 1289, ACTIVE 12 sec starting index read
+mysql tables in use 1, locked 1
+LOCK WAIT 2 lock struct(s), heap size 1128, 1 row lock(s)
+MySQL thread id 14, OS thread handle 1401, query id 88 localhost app updating
+update orders
+   set status = 'paid' where id = 7
+------- TRX HAS BEEN WAITING 12 SEC FOR THIS LOCK TO BE GRANTED:
+RECORD LOCKS space id 3 page no 4 n bits 72 index PRIMARY of table ` + "`shop`.`orders`" + ` trx id 1289 lock_mode X locks rec but not gap waiting
+------------------
+---TRANSACTION 1288, ACTIVE 40 sec
+2 lock struct(s), heap size 1128, 1 row lock(s)
+MySQL thread id 13, OS thread handle 1400, query id 80 localhost app
+Trx read view will not see trx with id >= 1288
+--------
+FILE I/O
+--------
+`
+
+func TestParseInnoDBLockWaits(t *testing.T) {
+	sessions := parseInnoDBLockWaits(innodbStatus)
+	want := []LockSession{{
+		PID:           14,
+		State:         "waiting",
+		TransactionMs: 12000,
+		Query:         "update orders set status = 'paid' where id = 7",
+		BlockedBy:     []int64{},
+		WaitingFor:    &LockTarget{LockType: "RECORD", Mode: "X", Relation: "`shop`.`orders`"},
+	}}
+	if !reflect.DeepEqual(sessions, want) {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+}
+
+func TestLocksMySQLBuildsBlockingChains(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	columns := []string{"waiting_pid", "waiting_query", "type", "mode", "table", "age", "blocking_pid", "blocking_query"}
+	mock.ExpectQuery("from sys.innodb_lock_waits").WillReturnRows(sqlmock.NewRows(columns).
+		AddRow(14, "update orders set status = ?", "RECORD", "X", "`shop`.`orders`", 12, 13, "update orders set note = ?").
+		AddRow(15, "delete from orders", "RECORD", "X", "`shop`.`orders`", 3, 14, "update orders set status = ?"))
+
+	report, err := LocksMySQL(context.Background(), db)
+	if err != nil {
+		t.Fatalf("LocksMySQL: %v", err)
+	}
+	if len(report.Sessions) != 3 || !report.BlockersKnown {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if !reflect.DeepEqual(report.RootBlockers, []int64{13}) {
+		t.Fatalf("expected 13 to head the chain, got %v", report.RootBlockers)
+	}
+	if blocker := report.Sessions[0]; blocker.PID != 13 || len(blocker.BlockedBy) != 0 || blocker.Query != "update orders set note = ?" {
+		t.Fatalf("unexpected blocker %+v", blocker)
+	}
+}
+
+func TestLocksMySQLFallsBackToInnoDBStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("from sys.innodb_lock_waits").WillReturnError(errors.New("Unknown database 'sys'"))
+	mock.ExpectQuery("SHOW ENGINE INNODB STATUS").
+		WillReturnRows(sqlmock.NewRows([]string{"Type", "Name", "Status"}).AddRow("InnoDB", "", innodbStatus))
+
+	report, err := LocksMySQL(context.Background(), db)
+	if err != nil {
+		t.Fatalf("LocksMySQL: %v", err)
+	}
+	if report.BlockersKnown || len(report.Sessions) != 1 || len(report.RootBlockers) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestTerminateMySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("KILL QUERY 13").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("KILL CONNECTION 13").WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, cancelOnly := range []bool{true, false} {
+		if ok, err := TerminateMySQL(context.Background(), db, 13, cancelOnly); !ok || err != nil {
+			t.Fatalf("TerminateMySQL(%v): %v", cancelOnly, err)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package serverstats
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrUnavailable is returned when the server does not collect the requested statistics,
+// for example when pg_stat_statements is not installed.
+var ErrUnavailable = errors.New("statistics are not available on this server")
+
+// Conn is the subset of pgx.Conn used to read Postgres statistics.
+type Conn interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// Order names the measure statements are ranked by.
+type Order string
+
+const (
+	OrderTotalTime Order = "totalTime"
+	OrderMeanTime  Order = "meanTime"
+	OrderCalls     Order = "calls"
+	OrderRows      Order = "rows"
+)
+
+// TopRequest selects the statements returned by TopQueries.
+type TopRequest struct {
+	// OrderBy defaults to OrderTotalTime.
+	OrderBy Order
+	// Limit defaults to 20.
+	Limit int
+	// AllDatabases includes statements run against other databases of the server.
+	AllDatabases bool
+}
+
+// Statement is one normalized statement with its accumulated execution statistics.
+type Statement struct {
+	// ID is the server's fingerprint of the normalized statement.
+	ID          string  `json:"id,omitempty"`
+	Query       string  `json:"query"`
+	Database    string  `json:"database,omitempty"`
+	Calls       int64   `json:"calls"`
+	TotalTimeMs float64 `json:"totalTimeMs"`
+	MeanTimeMs  float64 `json:"meanTimeMs"`
+	Rows        int64   `json:"rows"`
+}
+
+const defaultTopLimit = 20
+
+func (r TopRequest) normalized() (TopRequest, error) {
+	if r.OrderBy == "" {
+		r.OrderBy = OrderTotalTime
+	}
+	switch r.OrderBy {
+	case OrderTotalTime, OrderMeanTime, OrderCalls, OrderRows:
+	default:
+		return r, fmt.Errorf("unknown order %q", r.OrderBy)
+	}
+	if r.Limit <= 0 {
+		r.Limit = defaultTopLimit
+	}
+	return r, nil
+}
+
+// TopQueriesPostgres reads pg_stat_statements.
+func TopQueriesPostgres(ctx context.Context, conn Conn, req TopRequest) ([]Statement, error) {
+	req, err := req.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		installed  bool
+		versionNum string
+	)
+	if err := queryRow(ctx, conn, `select exists(select 1 from pg_extension where extname = 'pg_stat_statements'), current_setting('server_version_num')`, nil, &installed, &versionNum); err != nil {
+		return nil, err
+	}
+	if !installed {
+		return nil, fmt.Errorf("%w: the pg_stat_statements extension is not installed in this database", ErrUnavailable)
+	}
+	version, _ := strconv.Atoi(versionNum)
+
+	rows, err := conn.Query(ctx, postgresTopQueriesSQL(version, req), req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []Statement
+	for rows.Next() {
+		var s Statement
+		if err := rows.Scan(&s.ID, &s.Query, &s.Database, &s.Calls, &s.TotalTimeMs, &s.MeanTimeMs, &s.Rows); err != nil {
+			return nil, err
+		}
+		s.Query = normalizeSpace(s.Query)
+		statements = append(statements, s)
+	}
+	return statements, rows.Err()
+}
+
+// postgresTopQueriesSQL builds the pg_stat_statements query for a server version; the
+// timing columns were renamed in Postgres 13.
+func postgresTopQueriesSQL(version int, req TopRequest) string {
+	total, mean := "total_exec_time", "mean_exec_time"
+	if version > 0 && version < 130000 {
+		total, mean = "total_time", "mean_time"
+	}
+	order := map[Order]string{
+		OrderTotalTime: total,
+		OrderMeanTime:  mean,
+		OrderCalls:     "calls",
+		OrderRows:      "rows",
+	}[req.OrderBy]
+
+	where := "where d.datname = current_database()"
+	if req.AllDatabases {
+		where = ""
+	}
+	return fmt.Sprintf(`select coalesce(s.queryid::text, ''), s.query, coalesce(d.datname, ''), s.calls, s.%[1]s, s.%[2]s, s.rows
+from pg_stat_statements s
+left join pg_database d on d.oid = s.dbid
+%[3]s
+order by s.%[4]s desc
+limit $1`, total, mean, where, order)
+}
+
+// TopQueriesMySQL reads the statement digest summary of performance_schema.
+func TopQueriesMySQL(ctx context.Context, db *sql.DB, req TopRequest) ([]Statement, error) {
+	req, err := req.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var enabled int
+	if err := db.QueryRowContext(ctx, "select @@performance_schema").Scan(&enabled); err != nil {
+		return nil, err
+	}
+	if enabled == 0 {
+		return nil, fmt.Errorf("%w: performance_schema is disabled", ErrUnavailable)
+	}
+
+	rows, err := db.QueryContext(ctx, mysqlTopQueriesSQL(req), req.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statements []Statement
+	for rows.Next() {
+		var s Statement
+		if err := rows.Scan(&s.ID, &s.Query, &s.Database, &s.Calls, &s.TotalTimeMs, &s.MeanTimeMs, &s.Rows); err != nil {
+			return nil, err
+		}
+		s.Query = normalizeSpace(s.Query)
+		statements = append(statements, s)
+	}
+	return statements, rows.Err()
+}
+
+// mysqlTopQueriesSQL builds the digest summary query. Timers are in picoseconds.
+func mysqlTopQueriesSQL(req TopRequest) string {
+	order := map[Order]string{
+		OrderTotalTime: "SUM_TIMER_WAIT",
+		OrderMeanTime:  "AVG_TIMER_WAIT",
+		OrderCalls:     "COUNT_STAR",
+		OrderRows:      "SUM_ROWS_SENT + SUM_ROWS_AFFECTED",
+	}[req.OrderBy]
+
+	where := "where DIGEST_TEXT is not null and SCHEMA_NAME = database()"
+	if req.AllDatabases {
+		where = "where DIGEST_TEXT is not null"
+	}
+	return fmt.Sprintf(`select coalesce(DIGEST, ''), DIGEST_TEXT, coalesce(SCHEMA_NAME, ''), COUNT_STAR,
+  SUM_TIMER_WAIT / 1e9, AVG_TIMER_WAIT / 1e9, SUM_ROWS_SENT + SUM_ROWS_AFFECTED
+from performance_schema.events_statements_summary_by_digest
+%s
+order by %s desc
+limit ?`, where, order)
+}
+
+func queryRow(ctx context.Context, conn Conn, query string, args []any, dest ...any) error {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return pgx.ErrNoRows
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// normalizeSpace collapses runs of whitespace, so that statements read on one line.
+func normalizeSpace(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
@@ -0,0 +1,69 @@
+package serverstats
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgresTopQueriesSQLFollowsServerVersion(t *testing.T) {
+	current := postgresTopQueriesSQL(160002, TopRequest{OrderBy: OrderMeanTime})
+	if !strings.Contains(current, "s.total_exec_time, s.mean_exec_time") ||
+		!strings.Contains(current, "order by s.mean_exec_time desc") ||
+		!strings.Contains(current, "current_database()") {
+		t.Fatalf("unexpected query for Postgres 16:\n%s", current)
+	}
+
+	legacy := postgresTopQueriesSQL(120010, TopRequest{OrderBy: OrderTotalTime, AllDatabases: true})
+	if !strings.Contains(legacy, "order by s.total_time desc") || strings.Contains(legacy, "current_database()") {
+		t.Fatalf("unexpected query for Postgres 12:\n%s", legacy)
+	}
+}
+
+func TestTopQueriesMySQL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("select @@performance_schema").
+		WillReturnRows(sqlmock.NewRows([]string{"@@performance_schema"}).AddRow(1))
+	mock.ExpectQuery("order by COUNT_STAR desc").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"digest", "text", "schema", "calls", "total", "mean", "rows"}).
+			AddRow("ab12", "SELECT * FROM `orders`\n  WHERE `id` = ?", "shop", 42, 12.5, 0.3, 42))
+
+	statements, err := TopQueriesMySQL(context.Background(), db, TopRequest{OrderBy: OrderCalls, Limit: 5})
+	if err != nil {
+		t.Fatalf("TopQueriesMySQL: %v", err)
+	}
+	want := Statement{ID: "ab12", Query: "SELECT * FROM `orders` WHERE `id` = ?", Database: "shop", Calls: 42, TotalTimeMs: 12.5, MeanTimeMs: 0.3, Rows: 42}
+	if len(statements) != 1 || statements[0] != want {
+		t.Fatalf("unexpected statements %+v", statements)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("expectations not met: %v", err)
+	}
+}
+
+func TestTopQueriesMySQLReportsDisabledStatistics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("select @@performance_schema").
+		WillReturnRows(sqlmock.NewRows([]string{"@@performance_schema"}).AddRow(0))
+
+	if _, err := TopQueriesMySQL(context.Background(), db, TopRequest{}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+	if _, err := TopQueriesMySQL(context.Background(), db, TopRequest{OrderBy: "latency"}); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected an unknown order to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+// Package sshtrust verifies SSH host keys against a known_hosts file kept in the engine's
+// state directory, so that tunnels can be checked without turning host verification off.
+package sshtrust
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Mode decides what happens to a host whose key is not in the store yet.
+type Mode string
+
+const (
+	// Strict refuses hosts that are not in the store.
+	Strict Mode = "strict"
+	// TOFU records the key of a host seen for the first time and accepts it.
+	TOFU Mode = "tofu"
+	// Prompt asks the user about unknown hosts. Without a prompt function the connection
+	// fails with an *UnknownHostError, which carries what ssh.trustHost needs to record
+	// the key before retrying.
+	Prompt Mode = "prompt"
+)
+
+// ParseMode validates a mode name. The empty name selects Prompt.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case "":
+		return Prompt, nil
+	case Strict, TOFU, Prompt:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown host key mode %q", name)
+	}
+}
+
+// HostKey describes the key a host presented.
+type HostKey struct {
+	Host        string `json:"host"`
+	KeyType     string `json:"keyType"`
+	Fingerprint string `json:"fingerprint"`
+	// Key is the key in authorized_keys format, as ssh.trustHost accepts it.
+	Key string `json:"key"`
+}
+
+// Describe returns the HostKey for key presented by address.
+func Describe(address string, key ssh.PublicKey) HostKey {
+	return HostKey{
+		Host:        knownhosts.Normalize(address),
+		KeyType:     key.Type(),
+		Fingerprint: ssh.FingerprintSHA256(key),
+		Key:         strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))),
+	}
+}
+
+// UnknownHostError reports a host that is not in the store.
+type UnknownHostError struct {
+	HostKey
+}
+
+func (e *UnknownHostError) Error() string {
+	return fmt.Sprintf("host %s is not trusted yet; its %s key is %s", e.Host, e.KeyType, e.Fingerprint)
+}
+
+// ChangedHostError reports a host that presented a different key from the one recorded.
+// It is never accepted automatically, since it is what an impersonated host looks like.
+type ChangedHostError struct {
+	HostKey
+	// Known lists the fingerprints recorded for the host.
+	Known []string `json:"known"`
+}
+
+func (e *ChangedHostError) Error() string {
+	return fmt.Sprintf("host key of %s has changed to %s; it was %s", e.Host, e.Fingerprint, strings.Join(e.Known, ", "))
+}
+
+// PromptFunc asks the user whether to trust an unknown host.
+type PromptFunc func(key HostKey) (bool, error)
+
+// Store is a known_hosts file. Keys it records are written in OpenSSH's format, and
+// entries added by hand, including hashed hostnames, are honoured.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore returns the store kept at path. The file is created on the first Trust.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// HostKeyCallback verifies hosts for an ssh.ClientConfig in the given mode. prompt is
+// only used in Prompt mode and may be nil.
+func (s *Store) HostKeyCallback(mode Mode, prompt PromptFunc) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := s.check(hostname, remote, key)
+		var unknown *UnknownHostError
+		if !errors.As(err, &unknown) {
+			return err
+		}
+		switch mode {
+		case TOFU:
+			return s.Trust(hostname, key)
+		case Prompt:
+			if prompt == nil {
+				return err
+			}
+			ok, perr := prompt(unknown.HostKey)
+			if perr != nil {
+				return perr
+			}
+			if !ok {
+				return err
+			}
+			return s.Trust(hostname, key)
+		default:
+			return err
+		}
+	}
+}
+
+func (s *Store) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.path); errors.Is(err, fs.ErrNotExist) {
+		return &UnknownHostError{Describe(hostname, key)}
+	}
+	callback, err := knownhosts.New(s.path)
+	if err != nil {
+		return err
+	}
+	err = callback(hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+	if len(keyErr.Want) == 0 {
+		return &UnknownHostError{Describe(hostname, key)}
+	}
+	changed := &ChangedHostError{HostKey: Describe(hostname, key)}
+	for _, want := range keyErr.Want {
+		changed.Known = append(changed.Known, ssh.FingerprintSHA256(want.Key))
+	}
+	return changed
+}
+
+// Trust records key as the key of address, replacing any recorded before.
+func (s *Store) Trust(address string, key ssh.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host := knownhosts.Normalize(address)
+	existing, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line, named := withoutHost(scanner.Text(), host)
+		if named && line == "" {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	out.WriteString(knownhosts.Line([]string{host}, key) + "\n")
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, out.Bytes(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Lines returns the entries of the file, without comments and blank lines.
+func (s *Store) Lines() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// Add appends the entries of lines the file does not hold yet and returns how many it
+// added. Lines that are not known_hosts entries are rejected before anything is written.
+func (s *Store) Add(lines []string) (int, error) {
+	for _, line := range lines {
+		if _, _, _, _, _, err := ssh.ParseKnownHosts([]byte(line)); err != nil {
+			return 0, fmt.Errorf("invalid known_hosts entry %q: %w", line, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, err
+	}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(existing), "\n") {
+		seen[strings.TrimSpace(line)] = true
+	}
+	var out bytes.Buffer
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		out.WriteString("\n")
+	}
+	added := 0
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if seen[line] {
+			continue
+		}
+		seen[line] = true
+		out.WriteString(line + "\n")
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Write(out.Bytes())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return added, err
+}
+
+// withoutHost removes host from the hosts of a known_hosts line that is an unmarked entry
+// for it, keeping the key for the other hosts listed, and reports whether it did. The line
+// is empty when host was its only one. Wildcard patterns, negations and @-markers are left
+// alone.
+func withoutHost(line, host string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+		return line, false
+	}
+	patterns := strings.Split(fields[0], ",")
+	kept := slices.DeleteFunc(slices.Clone(patterns), func(pattern string) bool {
+		return pattern == host || hashedMatch(pattern, host)
+	})
+	if len(kept) == len(patterns) {
+		return line, false
+	}
+	if len(kept) == 0 {
+		return "", true
+	}
+	_, rest, _ := strings.Cut(strings.TrimSpace(line), fields[0])
+	return strings.Join(kept, ",") + rest, true
+}
+
+// hashedMatch checks host against a hashed hostname of the form |1|salt|hash.
+func hashedMatch(pattern, host string) bool {
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != "1" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return hmac.Equal(mac.Sum(nil), want)
+}
@@ -0,0 +1,180 @@
+package sshtrust
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func newKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var remote = &net.TCPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 22}
+
+func TestStrictRefusesUnknownHosts(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	key := newKey(t)
+	check := store.HostKeyCallback(Strict, nil)
+
+	var unknown *UnknownHostError
+	if err := check("db.internal:22", remote, key); !errors.As(err, &unknown) {
+		t.Fatalf("expected an unknown host error, got %v", err)
+	}
+	if unknown.Host != "db.internal" || unknown.Fingerprint != ssh.FingerprintSHA256(key) {
+		t.Fatalf("unexpected host key %+v", unknown.HostKey)
+	}
+
+	if err := store.Trust("db.internal:22", key); err != nil {
+		t.Fatalf("trust: %v", err)
+	}
+	if err := check("db.internal:22", remote, key); err != nil {
+		t.Fatalf("expected the trusted host to pass, got %v", err)
+	}
+}
+
+func TestTOFURecordsFirstKeyAndRefusesChanges(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	first, second := newKey(t), newKey(t)
+	check := store.HostKeyCallback(TOFU, nil)
+
+	if err := check("db.internal:2222", remote, first); err != nil {
+		t.Fatalf("expected the first key to be trusted, got %v", err)
+	}
+	var changed *ChangedHostError
+	if err := check("db.internal:2222", remote, second); !errors.As(err, &changed) {
+		t.Fatalf("expected a changed host error, got %v", err)
+	}
+	if changed.Host != "[db.internal]:2222" || len(changed.Known) != 1 || changed.Known[0] != ssh.FingerprintSHA256(first) {
+		t.Fatalf("unexpected changed host %+v", changed)
+	}
+}
+
+func TestPromptAsksAboutUnknownHosts(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	key := newKey(t)
+
+	var asked HostKey
+	refuse := store.HostKeyCallback(Prompt, func(k HostKey) (bool, error) { asked = k; return false, nil })
+	if err := refuse("db.internal:22", remote, key); err == nil || asked.Key == "" {
+		t.Fatalf("expected a refused prompt to fail, got %v after %+v", err, asked)
+	}
+	accept := store.HostKeyCallback(Prompt, func(HostKey) (bool, error) { return true, nil })
+	if err := accept("db.internal:22", remote, key); err != nil {
+		t.Fatalf("expected an accepted prompt to trust the host, got %v", err)
+	}
+	if err := store.HostKeyCallback(Strict, nil)("db.internal:22", remote, key); err != nil {
+		t.Fatalf("expected the accepted key to be recorded, got %v", err)
+	}
+}
+
+func TestTrustReplacesPlainAndHashedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	old, other, replacement := newKey(t), newKey(t), newKey(t)
+	seed := "# managed by hand\n" +
+		knownhosts.Line([]string{"db.internal"}, old) + "\n" +
+		knownhosts.HashHostname("db.internal") + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(old))) + "\n" +
+		knownhosts.Line([]string{"other.internal"}, other) + "\n"
+	if err := os.WriteFile(path, []byte(seed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(path)
+	if err := store.Trust("db.internal", replacement); err != nil {
+		t.Fatalf("trust: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 {
+		t.Fatalf("expected both old entries to be replaced, got\n%s", data)
+	}
+	check := store.HostKeyCallback(Strict, nil)
+	if err := check("db.internal:22", remote, replacement); err != nil {
+		t.Fatalf("expected the replacement key to pass, got %v", err)
+	}
+	if err := check("other.internal:22", remote, other); err != nil {
+		t.Fatalf("expected other hosts to be kept, got %v", err)
+	}
+}
+
+func TestTrustKeepsOtherHostsOfALine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	old, replacement := newKey(t), newKey(t)
+	seed := knownhosts.Line([]string{"db.internal", "10.0.0.5"}, old) + "\n"
+	if err := os.WriteFile(path, []byte(seed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewStore(path)
+	if err := store.Trust("db.internal", replacement); err != nil {
+		t.Fatalf("trust: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	want := knownhosts.Line([]string{"10.0.0.5"}, old) + "\n" + knownhosts.Line([]string{"db.internal"}, replacement) + "\n"
+	if string(data) != want {
+		t.Fatalf("known_hosts =\n%s\nwant\n%s", data, want)
+	}
+	check := store.HostKeyCallback(Strict, nil)
+	if err := check("db.internal:22", remote, old); err == nil {
+		t.Fatal("expected the old key to be refused for the trusted host")
+	}
+	if err := check("10.0.0.5:22", remote, old); err != nil {
+		t.Fatalf("expected the other host of the line to keep its key, got %v", err)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if mode, err := ParseMode(""); err != nil || mode != Prompt {
+		t.Fatalf("expected the default to prompt, got %q, %v", mode, err)
+	}
+	if _, err := ParseMode("off"); err == nil {
+		t.Fatal("expected an unknown mode to be refused")
+	}
+}
+
+func TestAddCopiesEntriesBetweenStores(t *testing.T) {
+	from := NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	key := newKey(t)
+	if err := from.Trust("db.internal:22", key); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := from.Lines()
+	if err != nil || len(lines) != 1 {
+		t.Fatalf("lines = %v, %v", lines, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte("# by hand\nother.internal "+strings.TrimSpace(string(ssh.MarshalAuthorizedKey(newKey(t))))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	to := NewStore(path)
+	for _, want := range []int{1, 0} {
+		if added, err := to.Add(lines); err != nil || added != want {
+			t.Fatalf("added %d, %v; want %d", added, err, want)
+		}
+	}
+	if err := to.HostKeyCallback(Strict, nil)("db.internal:22", remote, key); err != nil {
+		t.Fatalf("expected the copied host to pass, got %v", err)
+	}
+	if got, _ := to.Lines(); len(got) != 2 {
+		t.Fatalf("lines = %v", got)
+	}
+	if _, err := to.Add([]string{"not a key"}); err == nil {
+		t.Fatal("expected an invalid entry to be refused")
+	}
+}
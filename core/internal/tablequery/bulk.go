@@ -0,0 +1,50 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// BulkEdit is an update or delete of every row matching a filter.
+type BulkEdit struct {
+	Op string `json:"op" jsonschema:"required,enum=update,enum=delete"`
+	// Filter selects the rows. It is required, so that a whole table is never changed by
+	// leaving it out.
+	Filter *resultset.Filter `json:"filter" jsonschema:"required"`
+	// Values are the new column values of an update.
+	Values map[string]any `json:"values,omitempty"`
+}
+
+// BuildBulkEdit returns the statement applying edit to a table, and the COUNT query
+// reporting how many rows it would affect.
+func BuildBulkEdit(d Dialect, schema, table string, edit BulkEdit) (stmt, count Statement, err error) {
+	if table == "" {
+		return Statement{}, Statement{}, errors.New("table is required")
+	}
+	if edit.Filter == nil {
+		return Statement{}, Statement{}, errors.New("a filter is required")
+	}
+	if err := edit.Filter.Validate(); err != nil {
+		return Statement{}, Statement{}, err
+	}
+	p := &params{dialect: d}
+	var sql string
+	switch edit.Op {
+	case EditUpdate:
+		set, err := d.assignments(edit.Values, p)
+		if err != nil {
+			return Statement{}, Statement{}, err
+		}
+		sql = "UPDATE " + d.Table(schema, table) + " SET " + set
+	case EditDelete:
+		sql = "DELETE FROM " + d.Table(schema, table)
+	default:
+		return Statement{}, Statement{}, fmt.Errorf("unknown edit operation %q", edit.Op)
+	}
+	stmt = Statement{SQL: sql + " WHERE " + d.predicate(*edit.Filter, p), Args: p.args}
+
+	count.SQL, count.Args, err = BuildCount(d, Request{Schema: schema, Table: table, Filter: edit.Filter})
+	return stmt, count, err
+}
@@ -0,0 +1,43 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestBuildBulkEditSharesTheFilter(t *testing.T) {
+	filter := &resultset.Filter{Column: "status", Op: resultset.OpEq, Value: "stale"}
+	stmt, count, err := BuildBulkEdit(Postgres, "public", "jobs", BulkEdit{
+		Op: EditUpdate, Filter: filter, Values: map[string]any{"status": "done", "attempts": 0.0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `UPDATE "public"."jobs" SET "attempts" = $1, "status" = $2 WHERE "status" = $3`; stmt.SQL != want {
+		t.Errorf("got %s", stmt.SQL)
+	}
+	if !reflect.DeepEqual(stmt.Args, []any{int64(0), "done", "stale"}) {
+		t.Errorf("args = %#v", stmt.Args)
+	}
+	if want := `SELECT COUNT(*) FROM "public"."jobs" WHERE "status" = $1`; count.SQL != want || !reflect.DeepEqual(count.Args, []any{"stale"}) {
+		t.Errorf("got %s %v", count.SQL, count.Args)
+	}
+
+	stmt, _, err = BuildBulkEdit(MySQL, "", "jobs", BulkEdit{Op: EditDelete, Filter: filter})
+	if err != nil || stmt.SQL != "DELETE FROM `jobs` WHERE `status` = ?" {
+		t.Errorf("got %q, %v", stmt.SQL, err)
+	}
+
+	for i, edit := range []BulkEdit{
+		{Op: EditDelete},
+		{Op: EditUpdate, Filter: filter},
+		{Op: "truncate", Filter: filter},
+		{Op: EditDelete, Filter: &resultset.Filter{Column: "status", Op: "like"}},
+	} {
+		if _, _, err := BuildBulkEdit(SQLite, "", "jobs", edit); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Edit operations.
+const (
+	EditUpdate = "update"
+	EditDelete = "delete"
+)
+
+// Edit changes or removes one row, found by its identity.
+type Edit struct {
+	Op string `json:"op" jsonschema:"required,enum=update|delete"`
+	// Key holds the values of the identity columns for the row.
+	Key map[string]any `json:"key" jsonschema:"required"`
+	// Values are the new column values of an update.
+	Values map[string]any `json:"values,omitempty"`
+	// Original holds column values as they were read. The edit only applies while the row
+	// still holds them, so that a concurrent change is reported rather than overwritten.
+	Original map[string]any `json:"original,omitempty"`
+}
+
+// Statement is a statement built by the core with its bind arguments.
+type Statement struct {
+	SQL  string `json:"sql"`
+	Args []any  `json:"args"`
+}
+
+// BuildEdit returns the UPDATE or DELETE for one edit. It refuses tables without a safe
+// row identity.
+func BuildEdit(d Dialect, schema, table string, identity RowIdentity, edit Edit) (Statement, error) {
+	if table == "" {
+		return Statement{}, errors.New("table is required")
+	}
+	p := &params{dialect: d}
+	var b strings.Builder
+	switch edit.Op {
+	case EditUpdate:
+		set, err := d.assignments(edit.Values, p)
+		if err != nil {
+			return Statement{}, err
+		}
+		b.WriteString("UPDATE " + d.Table(schema, table) + " SET " + set)
+	case EditDelete:
+		b.WriteString("DELETE FROM " + d.Table(schema, table))
+	default:
+		return Statement{}, fmt.Errorf("unknown edit operation %q", edit.Op)
+	}
+	where, err := d.identityPredicate(identity, edit.Key, p)
+	if err != nil {
+		return Statement{}, err
+	}
+	b.WriteString(" WHERE " + where)
+	originals := make([]string, 0, len(edit.Original))
+	for column := range edit.Original {
+		if column != RowIDColumn {
+			originals = append(originals, column)
+		}
+	}
+	sort.Strings(originals)
+	for _, column := range originals {
+		b.WriteString(" AND " + d.Quote(column) + " " + d.nullSafeEqual() + " " + p.add(edit.Original[column]))
+	}
+	return Statement{SQL: b.String(), Args: p.args}, nil
+}
+
+// assignments renders the SET list of an update, in column order.
+func (d Dialect) assignments(values map[string]any, p *params) (string, error) {
+	if len(values) == 0 {
+		return "", errors.New("an update needs at least one value")
+	}
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		if column == RowIDColumn {
+			return "", fmt.Errorf("%s cannot be updated", RowIDColumn)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = d.Quote(column) + " = " + p.add(values[column])
+	}
+	return strings.Join(assignments, ", "), nil
+}
+
+// nullSafeEqual is the operator comparing values so that NULL equals NULL.
+func (d Dialect) nullSafeEqual() string {
+	switch d {
+	case Postgres:
+		return "IS NOT DISTINCT FROM"
+	case MySQL:
+		return "<=>"
+	default:
+		return "IS"
+	}
+}
+
+// BuildLookup returns the statement reading the row with the given identity key, with its
+// ctid or rowid when the identity is one.
+func BuildLookup(d Dialect, schema, table string, identity RowIdentity, key map[string]any) (Statement, error) {
+	p := &params{dialect: d}
+	where, err := d.identityPredicate(identity, key, p)
+	if err != nil {
+		return Statement{}, err
+	}
+	selected := "*"
+	if identity.Strategy == IdentityCTID || identity.Strategy == IdentityRowID {
+		selected += ", " + d.pseudoColumn() + " AS " + d.Quote(RowIDColumn)
+	}
+	return Statement{SQL: "SELECT " + selected + " FROM " + d.Table(schema, table) + " WHERE " + where, Args: p.args}, nil
+}
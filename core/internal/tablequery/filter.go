@@ -0,0 +1,110 @@
+package tablequery
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// params collects bind arguments and renders their placeholders.
+type params struct {
+	dialect Dialect
+	args    []any
+}
+
+func (p *params) add(value any) string {
+	// JSON numbers arrive as float64; whole ones bind as integers so that drivers compare
+	// them with integer columns without a cast.
+	if f, ok := value.(float64); ok && f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		value = int64(f)
+	}
+	p.args = append(p.args, value)
+	if p.dialect == Postgres {
+		return "$" + strconv.Itoa(len(p.args))
+	}
+	return "?"
+}
+
+var comparisonOps = map[string]string{
+	resultset.OpEq:  "=",
+	resultset.OpNe:  "<>",
+	resultset.OpLt:  "<",
+	resultset.OpLte: "<=",
+	resultset.OpGt:  ">",
+	resultset.OpGte: ">=",
+}
+
+// Where renders f as a predicate whose values are bind arguments, never SQL text.
+func (d Dialect) Where(f resultset.Filter) (string, []any, error) {
+	if err := f.Validate(); err != nil {
+		return "", nil, err
+	}
+	p := &params{dialect: d}
+	return d.predicate(f, p), p.args, nil
+}
+
+func (d Dialect) predicate(f resultset.Filter, p *params) string {
+	if f.IsGroup() {
+		children, join := f.And, " AND "
+		if f.Or != nil {
+			children, join = f.Or, " OR "
+		}
+		if len(children) == 0 {
+			// An empty and group matches everything, an empty or group nothing.
+			if f.Or != nil {
+				return "1 = 0"
+			}
+			return "1 = 1"
+		}
+		terms := make([]string, len(children))
+		for i, child := range children {
+			terms[i] = d.predicate(child, p)
+		}
+		return "(" + strings.Join(terms, join) + ")"
+	}
+
+	column := d.Quote(f.Column)
+	switch f.Op {
+	case resultset.OpIsNull:
+		return column + " IS NULL"
+	case resultset.OpNotNull:
+		return column + " IS NOT NULL"
+	case resultset.OpIn:
+		values := f.Value.([]any)
+		placeholders := make([]string, len(values))
+		for i, value := range values {
+			placeholders[i] = p.add(value)
+		}
+		return column + " IN (" + strings.Join(placeholders, ", ") + ")"
+	case resultset.OpContains, resultset.OpStartsWith, resultset.OpEndsWith:
+		pattern := escapeLike(f.Value.(string))
+		switch f.Op {
+		case resultset.OpContains:
+			pattern = "%" + pattern + "%"
+		case resultset.OpStartsWith:
+			pattern += "%"
+		default:
+			pattern = "%" + pattern
+		}
+		return d.like(column, pattern, p)
+	default:
+		return column + " " + comparisonOps[f.Op] + " " + p.add(f.Value)
+	}
+}
+
+// like matches text case-insensitively. Postgres casts the column so that numbers and
+// dates can be searched too; MySQL and SQLite convert implicitly. The escape character is
+// "!" rather than a backslash, which MySQL would read as an escape in the literal itself.
+func (d Dialect) like(column, pattern string, p *params) string {
+	if d == Postgres {
+		return fmt.Sprintf(`CAST(%s AS text) ILIKE %s ESCAPE '!'`, column, p.add(pattern))
+	}
+	return fmt.Sprintf(`LOWER(%s) LIKE %s ESCAPE '!'`, column, p.add(strings.ToLower(pattern)))
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
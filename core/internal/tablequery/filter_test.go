@@ -0,0 +1,78 @@
+package tablequery
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func parseFilter(t *testing.T, raw string) resultset.Filter {
+	t.Helper()
+	var f resultset.Filter
+	if err := json.Unmarshal([]byte(raw), &f); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestWhereBindsValues(t *testing.T) {
+	f := parseFilter(t, `{"and":[
+		{"column":"age","op":"gte","value":18},
+		{"or":[
+			{"column":"name","op":"contains","value":"50%_O'Neil"},
+			{"column":"team","op":"in","value":["a","b"]},
+			{"column":"deleted_at","op":"isNull"}
+		]}
+	]}`)
+	cases := map[Dialect]string{
+		Postgres: `("age" >= $1 AND (CAST("name" AS text) ILIKE $2 ESCAPE '!' OR "team" IN ($3, $4) OR "deleted_at" IS NULL))`,
+		MySQL:    "(`age` >= ? AND (LOWER(`name`) LIKE ? ESCAPE '!' OR `team` IN (?, ?) OR `deleted_at` IS NULL))",
+	}
+	for dialect, want := range cases {
+		sql, args, err := dialect.Where(f)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if sql != want {
+			t.Errorf("%s:\n got %s\nwant %s", dialect, sql, want)
+		}
+		pattern := "%50!%!_O'Neil%"
+		if dialect != Postgres {
+			pattern = "%50!%!_o'neil%"
+		}
+		if wantArgs := []any{int64(18), pattern, "a", "b"}; !reflect.DeepEqual(args, wantArgs) {
+			t.Errorf("%s: args = %#v, want %#v", dialect, args, wantArgs)
+		}
+	}
+}
+
+func TestBuildPlacesWhereBeforeOrderBy(t *testing.T) {
+	f := parseFilter(t, `{"column":"score","op":"lt","value":2.5}`)
+	sql, args, err := Build(Postgres, Request{Table: "t", Filter: &f, Sort: []resultset.SortKey{{Column: "score"}}, Limit: 10}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT * FROM "t" WHERE "score" < $1 ORDER BY "score" ASC NULLS LAST LIMIT 10`; sql != want {
+		t.Errorf("got %s, want %s", sql, want)
+	}
+	if !reflect.DeepEqual(args, []any{2.5}) {
+		t.Errorf("args = %#v", args)
+	}
+}
+
+func TestWhereRejectsMalformedFilters(t *testing.T) {
+	for _, raw := range []string{
+		`{"column":"a","op":"like","value":"x"}`,
+		`{"column":"a","op":"eq"}`,
+		`{"column":"a","op":"in","value":[]}`,
+		`{"column":"a","op":"contains","value":3}`,
+		`{"and":[],"column":"a","op":"isNull"}`,
+		`{"op":"isNull"}`,
+	} {
+		if _, _, err := Postgres.Where(parseFilter(t, raw)); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Row identity strategies, from the safest to none at all.
+const (
+	IdentityPrimaryKey  = "primaryKey"
+	IdentityUniqueIndex = "uniqueIndex"
+	IdentityCTID        = "ctid"
+	IdentityRowID       = "rowid"
+	IdentityNone        = "none"
+)
+
+// RowIDColumn names the column that carries a ctid or rowid in table reads.
+const RowIDColumn = "__rowid"
+
+// RowIdentity is how rows of a table are told apart when editing them.
+type RowIdentity struct {
+	Strategy string `json:"strategy"`
+	// Columns are the key columns, or RowIDColumn for the ctid and rowid strategies.
+	Columns []string `json:"columns"`
+	// Index names the unique index used by the uniqueIndex strategy.
+	Index string `json:"index,omitempty"`
+	// Stable is false when the identity changes as rows are updated or moved, as a ctid
+	// does, so it must be read again after every edit.
+	Stable bool `json:"stable"`
+}
+
+// Editable reports whether rows can be safely identified.
+func (r RowIdentity) Editable() bool {
+	return r.Strategy != IdentityNone
+}
+
+// UniqueKeysSQL returns a query listing, one row per column, the primary key and unique
+// indexes of a table: index name, column, whether the column is NOT NULL and whether the
+// index is the primary key. Partial and expression indexes are left out.
+func UniqueKeysSQL(d Dialect, schema, table string) string {
+	switch d {
+	case Postgres:
+		return `SELECT i.relname::text, a.attname::text, a.attnotnull, x.indisprimary ` +
+			`FROM pg_index x JOIN pg_class i ON i.oid = x.indexrelid ` +
+			`CROSS JOIN LATERAL unnest(x.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord) ` +
+			`JOIN pg_attribute a ON a.attrelid = x.indrelid AND a.attnum = k.attnum ` +
+			`WHERE x.indrelid = to_regclass(` + d.Literal(d.Table(schema, table)) + `) ` +
+			`AND x.indisunique AND x.indpred IS NULL AND x.indexprs IS NULL ` +
+			`ORDER BY i.relname, k.ord`
+	case MySQL:
+		return `SELECT INDEX_NAME, COLUMN_NAME, NULLABLE <> 'YES', INDEX_NAME = 'PRIMARY' ` +
+			`FROM information_schema.STATISTICS WHERE NON_UNIQUE = 0 ` +
+			`AND TABLE_SCHEMA = ` + mysqlSchema(d, schema) + ` AND TABLE_NAME = ` + d.Literal(table) + ` ` +
+			`ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+	default:
+		// An INTEGER PRIMARY KEY aliases the rowid and has no index, so the primary key is
+		// read from the table info instead of its automatic index.
+		info := pragmaTableInfo(d, schema, table)
+		indexList := "pragma_index_list(" + d.Literal(table) + ")"
+		indexInfo := "pragma_index_info(l.name)"
+		if schema != "" {
+			indexList = "pragma_index_list(" + d.Literal(table) + ", " + d.Literal(schema) + ")"
+			indexInfo = "pragma_index_info(l.name, " + d.Literal(schema) + ")"
+		}
+		return `SELECT 'PRIMARY', name, 1, 1 FROM ` + info + ` WHERE pk > 0 ` +
+			`UNION ALL SELECT l.name, c.name, coalesce(t."notnull", 0), 0 FROM ` + indexList + ` l ` +
+			`JOIN ` + indexInfo + ` c LEFT JOIN ` + info + ` t ON t.name = c.name ` +
+			`WHERE l."unique" = 1 AND l.partial = 0 AND l.origin <> 'pk'`
+	}
+}
+
+// PseudoIdentitySQL returns a query whose single row reports whether the table has a usable
+// ctid or rowid, or "" when the dialect has none. Only plain Postgres tables have a ctid
+// that identifies a row, and SQLite tables declared WITHOUT ROWID have no rowid.
+func PseudoIdentitySQL(d Dialect, schema, table string) string {
+	switch d {
+	case Postgres:
+		return `SELECT relkind = 'r' FROM pg_class WHERE oid = to_regclass(` + d.Literal(d.Table(schema, table)) + `)`
+	case SQLite:
+		master := "sqlite_master"
+		if schema != "" {
+			master = d.Quote(schema) + ".sqlite_master"
+		}
+		return `SELECT upper(sql) NOT LIKE '%WITHOUT ROWID%' FROM ` + master +
+			` WHERE type = 'table' AND lower(name) = ` + d.Literal(strings.ToLower(table))
+	default:
+		return ""
+	}
+}
+
+// ChooseIdentity picks the identity of a table from the rows of UniqueKeysSQL and whether
+// PseudoIdentitySQL allowed a pseudo column: the primary key, else the narrowest unique
+// index over NOT NULL columns, else the ctid or rowid.
+func ChooseIdentity(d Dialect, uniqueRows [][]any, pseudo bool) RowIdentity {
+	type index struct {
+		name    string
+		columns []string
+		notNull bool
+		primary bool
+	}
+	var indexes []*index
+	byName := map[string]*index{}
+	for _, row := range uniqueRows {
+		if len(row) < 4 {
+			continue
+		}
+		name := fmt.Sprint(row[0])
+		idx, ok := byName[name]
+		if !ok {
+			idx = &index{name: name, notNull: true, primary: truthy(row[3])}
+			byName[name] = idx
+			indexes = append(indexes, idx)
+		}
+		idx.columns = append(idx.columns, fmt.Sprint(row[1]))
+		idx.notNull = idx.notNull && truthy(row[2])
+	}
+
+	for _, idx := range indexes {
+		if idx.primary {
+			return RowIdentity{Strategy: IdentityPrimaryKey, Columns: idx.columns, Stable: true}
+		}
+	}
+	// NULLs are never equal to each other, so a unique index over nullable columns can
+	// hold several rows with the same key.
+	var candidates []*index
+	for _, idx := range indexes {
+		if idx.notNull {
+			candidates = append(candidates, idx)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return len(candidates[i].columns) < len(candidates[j].columns) })
+	if len(candidates) > 0 {
+		return RowIdentity{Strategy: IdentityUniqueIndex, Columns: candidates[0].columns, Index: candidates[0].name, Stable: true}
+	}
+
+	switch {
+	case pseudo && d == Postgres:
+		return RowIdentity{Strategy: IdentityCTID, Columns: []string{RowIDColumn}}
+	case pseudo && d == SQLite:
+		// A rowid without an INTEGER PRIMARY KEY alias may be renumbered by VACUUM, but it
+		// does not change when the row is updated.
+		return RowIdentity{Strategy: IdentityRowID, Columns: []string{RowIDColumn}, Stable: true}
+	}
+	return RowIdentity{Strategy: IdentityNone, Columns: []string{}}
+}
+
+// ParsePseudoIdentity reads the rows of the PseudoIdentitySQL query.
+func ParsePseudoIdentity(rows [][]any) bool {
+	return len(rows) == 1 && len(rows[0]) > 0 && truthy(rows[0][0])
+}
+
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case int32:
+		return v != 0
+	case int:
+		return v != 0
+	case string:
+		return v == "1" || strings.EqualFold(v, "t") || strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// pseudoColumn is the expression selecting a row's ctid or rowid.
+func (d Dialect) pseudoColumn() string {
+	if d == Postgres {
+		return "CAST(ctid AS text)"
+	}
+	return "rowid"
+}
+
+// pseudoMatch compares the pseudo column with a bound value.
+func (d Dialect) pseudoMatch(p *params, value any) string {
+	if d == Postgres {
+		return "ctid = CAST(" + p.add(value) + " AS tid)"
+	}
+	return "rowid = " + p.add(value)
+}
+
+// identityPredicate matches the row whose identity columns hold key.
+func (d Dialect) identityPredicate(identity RowIdentity, key map[string]any, p *params) (string, error) {
+	if !identity.Editable() {
+		return "", errors.New("the table has no primary key, unique index over NOT NULL columns or row id to identify rows by")
+	}
+	if len(key) != len(identity.Columns) {
+		return "", fmt.Errorf("row key must hold exactly the identity columns %v", identity.Columns)
+	}
+	terms := make([]string, len(identity.Columns))
+	for i, column := range identity.Columns {
+		value, ok := key[column]
+		if !ok {
+			return "", fmt.Errorf("row key must hold exactly the identity columns %v", identity.Columns)
+		}
+		if value == nil {
+			return "", fmt.Errorf("row key column %q is null", column)
+		}
+		if identity.Strategy == IdentityCTID || identity.Strategy == IdentityRowID {
+			terms[i] = d.pseudoMatch(p, value)
+			continue
+		}
+		terms[i] = d.Quote(column) + " = " + p.add(value)
+	}
+	return strings.Join(terms, " AND "), nil
+}
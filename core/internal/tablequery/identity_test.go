@@ -0,0 +1,130 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChooseIdentityPrefersSafeKeys(t *testing.T) {
+	cases := []struct {
+		name    string
+		dialect Dialect
+		rows    [][]any
+		pseudo  bool
+		want    RowIdentity
+	}{
+		{
+			name:    "primary key",
+			dialect: Postgres,
+			rows:    [][]any{{"users_email", "email", true, false}, {"users_pkey", "id", true, true}},
+			pseudo:  true,
+			want:    RowIdentity{Strategy: IdentityPrimaryKey, Columns: []string{"id"}, Stable: true},
+		},
+		{
+			name:    "narrowest NOT NULL unique index",
+			dialect: MySQL,
+			rows: [][]any{
+				{"uq_nullable", "code", int64(0), int64(0)},
+				{"uq_pair", "org", int64(1), int64(0)}, {"uq_pair", "slug", int64(1), int64(0)},
+				{"uq_email", "email", int64(1), int64(0)},
+			},
+			want: RowIdentity{Strategy: IdentityUniqueIndex, Columns: []string{"email"}, Index: "uq_email", Stable: true},
+		},
+		{
+			name:    "ctid",
+			dialect: Postgres,
+			rows:    [][]any{{"uq_nullable", "code", false, false}},
+			pseudo:  true,
+			want:    RowIdentity{Strategy: IdentityCTID, Columns: []string{RowIDColumn}},
+		},
+		{
+			name:    "rowid",
+			dialect: SQLite,
+			pseudo:  true,
+			want:    RowIdentity{Strategy: IdentityRowID, Columns: []string{RowIDColumn}, Stable: true},
+		},
+		{
+			name:    "none",
+			dialect: MySQL,
+			pseudo:  true,
+			want:    RowIdentity{Strategy: IdentityNone, Columns: []string{}},
+		},
+	}
+	for _, tc := range cases {
+		if got := ChooseIdentity(tc.dialect, tc.rows, tc.pseudo); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBuildEditMatchesIdentity(t *testing.T) {
+	pk := RowIdentity{Strategy: IdentityPrimaryKey, Columns: []string{"id"}, Stable: true}
+	stmt, err := BuildEdit(Postgres, "public", "users", pk, Edit{
+		Op: EditUpdate, Key: map[string]any{"id": 7.0}, Values: map[string]any{"name": "Ann", "age": nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `UPDATE "public"."users" SET "age" = $1, "name" = $2 WHERE "id" = $3`; stmt.SQL != want {
+		t.Errorf("got %s", stmt.SQL)
+	}
+	if !reflect.DeepEqual(stmt.Args, []any{nil, "Ann", int64(7)}) {
+		t.Errorf("args = %#v", stmt.Args)
+	}
+
+	ctid := RowIdentity{Strategy: IdentityCTID, Columns: []string{RowIDColumn}}
+	stmt, err = BuildEdit(Postgres, "", "logs", ctid, Edit{Op: EditDelete, Key: map[string]any{RowIDColumn: "(0,3)"}})
+	if err != nil || stmt.SQL != `DELETE FROM "logs" WHERE ctid = CAST($1 AS tid)` {
+		t.Errorf("got %q, %v", stmt.SQL, err)
+	}
+
+	refused := []struct {
+		identity RowIdentity
+		edit     Edit
+	}{
+		{RowIdentity{Strategy: IdentityNone}, Edit{Op: EditDelete, Key: map[string]any{"id": 1.0}}},
+		{pk, Edit{Op: EditDelete, Key: map[string]any{"name": "x"}}},
+		{pk, Edit{Op: EditDelete, Key: map[string]any{"id": nil}}},
+		{pk, Edit{Op: EditUpdate, Key: map[string]any{"id": 1.0}}},
+		{pk, Edit{Op: "upsert", Key: map[string]any{"id": 1.0}}},
+		{ctid, Edit{Op: EditUpdate, Key: map[string]any{RowIDColumn: "(0,1)"}, Values: map[string]any{RowIDColumn: "(0,2)"}}},
+	}
+	for i, tc := range refused {
+		if _, err := BuildEdit(MySQL, "", "t", tc.identity, tc.edit); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
+
+func TestBuildEditChecksOriginalValues(t *testing.T) {
+	pk := RowIdentity{Strategy: IdentityPrimaryKey, Columns: []string{"id"}}
+	edit := Edit{
+		Op:       EditUpdate,
+		Key:      map[string]any{"id": 7.0},
+		Values:   map[string]any{"name": "b"},
+		Original: map[string]any{"name": "a", "note": nil},
+	}
+	want := map[Dialect]string{
+		Postgres: `UPDATE "users" SET "name" = $1 WHERE "id" = $2 AND "name" IS NOT DISTINCT FROM $3 AND "note" IS NOT DISTINCT FROM $4`,
+		MySQL:    "UPDATE `users` SET `name` = ? WHERE `id` = ? AND `name` <=> ? AND `note` <=> ?",
+		SQLite:   `UPDATE "users" SET "name" = ? WHERE "id" = ? AND "name" IS ? AND "note" IS ?`,
+	}
+	for d, sql := range want {
+		stmt, err := BuildEdit(d, "", "users", pk, edit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stmt.SQL != sql || !reflect.DeepEqual(stmt.Args, []any{"b", int64(7), "a", nil}) {
+			t.Errorf("%v: got %s %v", d, stmt.SQL, stmt.Args)
+		}
+	}
+
+	ctid := RowIdentity{Strategy: IdentityCTID, Columns: []string{RowIDColumn}}
+	stmt, err := BuildLookup(Postgres, "", "logs", ctid, map[string]any{RowIDColumn: "(0,3)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT *, CAST(ctid AS text) AS "__rowid" FROM "logs" WHERE ctid = CAST($1 AS tid)`; stmt.SQL != want {
+		t.Errorf("got %s", stmt.SQL)
+	}
+}
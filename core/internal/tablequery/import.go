@@ -0,0 +1,82 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxImportArgs keeps the bind arguments of one INSERT under the smallest limit of the
+// supported databases, SQLite's 32766.
+const maxImportArgs = 30000
+
+// Column types created for imported data, by column kind and dialect.
+var importTypes = map[string]map[Dialect]string{
+	"boolean": {Postgres: "BOOLEAN", MySQL: "BOOLEAN", SQLite: "BOOLEAN"},
+	"integer": {Postgres: "BIGINT", MySQL: "BIGINT", SQLite: "INTEGER"},
+	"real":    {Postgres: "DOUBLE PRECISION", MySQL: "DOUBLE", SQLite: "REAL"},
+	"text":    {Postgres: "TEXT", MySQL: "TEXT", SQLite: "TEXT"},
+}
+
+// Import describes rows to add to a table.
+type Import struct {
+	Columns []string
+	// Kinds are the kinds of the columns (boolean, integer, real or text), used when the
+	// table is created.
+	Kinds []string
+	Rows  [][]any
+	// Create creates the table first.
+	Create bool
+}
+
+// BuildImport returns the statements that add the rows of imp to a table: a CREATE
+// TABLE when asked for, then INSERTs of as many rows as fit the bind argument limit.
+func BuildImport(d Dialect, schema, table string, imp Import) ([]Statement, error) {
+	if table == "" {
+		return nil, errors.New("table is required")
+	}
+	if len(imp.Columns) == 0 {
+		return nil, errors.New("there are no columns to import")
+	}
+	var statements []Statement
+	if imp.Create {
+		if len(imp.Kinds) != len(imp.Columns) {
+			return nil, errors.New("every column needs a kind")
+		}
+		definitions := make([]string, len(imp.Columns))
+		for i, column := range imp.Columns {
+			sqlType, ok := importTypes[imp.Kinds[i]][d]
+			if !ok {
+				return nil, fmt.Errorf("unknown column kind %q", imp.Kinds[i])
+			}
+			definitions[i] = d.Quote(column) + " " + sqlType
+		}
+		statements = append(statements, Statement{
+			SQL: "CREATE TABLE " + d.Table(schema, table) + " (" + strings.Join(definitions, ", ") + ")",
+		})
+	}
+
+	quoted := make([]string, len(imp.Columns))
+	for i, column := range imp.Columns {
+		quoted[i] = d.Quote(column)
+	}
+	prefix := "INSERT INTO " + d.Table(schema, table) + " (" + strings.Join(quoted, ", ") + ") VALUES "
+	batch := max(1, maxImportArgs/len(imp.Columns))
+	for start := 0; start < len(imp.Rows); start += batch {
+		rows := imp.Rows[start:min(start+batch, len(imp.Rows))]
+		p := &params{dialect: d}
+		tuples := make([]string, len(rows))
+		for i, row := range rows {
+			if len(row) != len(imp.Columns) {
+				return nil, fmt.Errorf("row %d has %d values, expected %d", start+i+1, len(row), len(imp.Columns))
+			}
+			placeholders := make([]string, len(row))
+			for j, value := range row {
+				placeholders[j] = p.add(value)
+			}
+			tuples[i] = "(" + strings.Join(placeholders, ", ") + ")"
+		}
+		statements = append(statements, Statement{SQL: prefix + strings.Join(tuples, ", "), Args: p.args})
+	}
+	return statements, nil
+}
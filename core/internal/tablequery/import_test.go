@@ -0,0 +1,53 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildImportCreatesAndBatches(t *testing.T) {
+	rows := make([][]any, maxImportArgs/2+1)
+	for i := range rows {
+		rows[i] = []any{int64(i), "x"}
+	}
+	statements, err := BuildImport(Postgres, "public", "people", Import{
+		Columns: []string{"id", "name"},
+		Kinds:   []string{"integer", "text"},
+		Rows:    rows,
+		Create:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 3 {
+		t.Fatalf("got %d statements", len(statements))
+	}
+	if want := `CREATE TABLE "public"."people" ("id" BIGINT, "name" TEXT)`; statements[0].SQL != want {
+		t.Errorf("got %s", statements[0].SQL)
+	}
+	if len(statements[1].Args) != maxImportArgs || len(statements[2].Args) != 2 {
+		t.Errorf("batches hold %d and %d args", len(statements[1].Args), len(statements[2].Args))
+	}
+	if want := `INSERT INTO "public"."people" ("id", "name") VALUES ($1, $2)`; statements[2].SQL != want {
+		t.Errorf("got %s", statements[2].SQL)
+	}
+
+	statements, err = BuildImport(MySQL, "", "t", Import{Columns: []string{"a"}, Rows: [][]any{{1.5}, {nil}}})
+	if err != nil || len(statements) != 1 || statements[0].SQL != "INSERT INTO `t` (`a`) VALUES (?), (?)" {
+		t.Fatalf("got %+v, %v", statements, err)
+	}
+	if !reflect.DeepEqual(statements[0].Args, []any{1.5, nil}) {
+		t.Errorf("args = %#v", statements[0].Args)
+	}
+
+	for i, imp := range []Import{
+		{},
+		{Columns: []string{"a"}, Create: true},
+		{Columns: []string{"a"}, Kinds: []string{"date"}, Create: true},
+		{Columns: []string{"a"}, Rows: [][]any{{1, 2}}},
+	} {
+		if _, err := BuildImport(SQLite, "", "t", imp); err == nil {
+			t.Errorf("case %d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fluxgrid/core/internal/jsonpath"
+)
+
+// JSONProjection selects the value at a path inside a json or jsonb column, as text the way
+// ->> returns it. Objects and arrays come back as JSON text.
+type JSONProjection struct {
+	Column string `json:"column" jsonschema:"required"`
+	// Path is a JSON path such as $.address.city or $.tags[0].
+	Path string `json:"path" jsonschema:"required"`
+	// As names the result column. It defaults to the column followed by the path, as in
+	// payload.address.city.
+	As string `json:"as,omitempty"`
+}
+
+// Name returns the result column name of the projection.
+func (j JSONProjection) Name(path jsonpath.Path) string {
+	if j.As != "" {
+		return j.As
+	}
+	return j.Column + path.String()[1:]
+}
+
+// project renders a projection. The path is a bind argument: a text array for Postgres's
+// #>> and a quoted path string for JSON_EXTRACT and json_extract.
+func (d Dialect) project(j JSONProjection, p *params) (string, error) {
+	if j.Column == "" {
+		return "", errors.New("JSON path column is required")
+	}
+	path, err := jsonpath.Parse(j.Path)
+	if err != nil {
+		return "", err
+	}
+	column, alias := d.Quote(j.Column), d.Quote(j.Name(path))
+	switch d {
+	case Postgres:
+		return fmt.Sprintf("CAST(%s AS jsonb) #>> %s AS %s", column, p.add(path.Elements()), alias), nil
+	case MySQL:
+		return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, %s)) AS %s", column, p.add(path.Quoted()), alias), nil
+	default:
+		return fmt.Sprintf("json_extract(%s, %s) AS %s", column, p.add(path.Quoted()), alias), nil
+	}
+}
@@ -0,0 +1,52 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildProjectsJSONPaths(t *testing.T) {
+	f := parseFilter(t, `{"column":"id","op":"gt","value":10}`)
+	req := Request{
+		Table:   "events",
+		Columns: []string{"id"},
+		JSONPaths: []JSONProjection{
+			{Column: "payload", Path: "$.user.name"},
+			{Column: "payload", Path: `tags[0]`, As: "first_tag"},
+		},
+		Filter: &f,
+	}
+	cases := map[Dialect]struct {
+		sql  string
+		args []any
+	}{
+		Postgres: {
+			sql:  `SELECT "id", CAST("payload" AS jsonb) #>> $1 AS "payload.user.name", CAST("payload" AS jsonb) #>> $2 AS "first_tag" FROM "events" WHERE "id" > $3`,
+			args: []any{[]string{"user", "name"}, []string{"tags", "0"}, int64(10)},
+		},
+		MySQL: {
+			sql:  "SELECT `id`, JSON_UNQUOTE(JSON_EXTRACT(`payload`, ?)) AS `payload.user.name`, JSON_UNQUOTE(JSON_EXTRACT(`payload`, ?)) AS `first_tag` FROM `events` WHERE `id` > ?",
+			args: []any{`$."user"."name"`, `$."tags"[0]`, int64(10)},
+		},
+		SQLite: {
+			sql:  `SELECT "id", json_extract("payload", ?) AS "payload.user.name", json_extract("payload", ?) AS "first_tag" FROM "events" WHERE "id" > ?`,
+			args: []any{`$."user"."name"`, `$."tags"[0]`, int64(10)},
+		},
+	}
+	for dialect, want := range cases {
+		sql, args, err := Build(dialect, req, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if sql != want.sql {
+			t.Errorf("%s:\n got %s\nwant %s", dialect, sql, want.sql)
+		}
+		if !reflect.DeepEqual(args, want.args) {
+			t.Errorf("%s: args = %#v", dialect, args)
+		}
+	}
+
+	if _, _, err := Build(Postgres, Request{Table: "t", JSONPaths: []JSONProjection{{Column: "doc", Path: "$[x]"}}}, nil); err == nil {
+		t.Error("expected an invalid path to be refused")
+	}
+}
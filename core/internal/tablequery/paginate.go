@@ -0,0 +1,29 @@
+package tablequery
+
+import "strconv"
+
+// Paginate returns the clause that skips offset rows and keeps at most limit of the rest,
+// with a leading space, or "" when neither bounds the rows. A limit that is not positive
+// means no limit. Statements built by this package and limits appended to statements
+// clients send all page through it, so that a dialect's syntax lives in one place.
+func (d Dialect) Paginate(limit, offset int) string {
+	var clause string
+	if limit > 0 {
+		clause = " LIMIT " + strconv.Itoa(limit)
+	}
+	if offset > 0 {
+		if limit <= 0 && d != Postgres {
+			// MySQL and SQLite only accept OFFSET after a LIMIT.
+			clause = " LIMIT " + noLimit(d)
+		}
+		clause += " OFFSET " + strconv.Itoa(offset)
+	}
+	return clause
+}
+
+func noLimit(d Dialect) string {
+	if d == MySQL {
+		return "18446744073709551615"
+	}
+	return "-1"
+}
@@ -0,0 +1,34 @@
+package tablequery
+
+import "testing"
+
+func TestPaginatePerDialect(t *testing.T) {
+	type page struct{ limit, offset int }
+	cases := map[Dialect]map[page]string{
+		Postgres: {
+			{50, 0}:   " LIMIT 50",
+			{50, 100}: " LIMIT 50 OFFSET 100",
+			{0, 100}:  " OFFSET 100",
+			{0, 0}:    "",
+		},
+		MySQL: {
+			{50, 0}:   " LIMIT 50",
+			{50, 100}: " LIMIT 50 OFFSET 100",
+			{0, 100}:  " LIMIT 18446744073709551615 OFFSET 100",
+			{-1, 0}:   "",
+		},
+		SQLite: {
+			{50, 0}:   " LIMIT 50",
+			{50, 100}: " LIMIT 50 OFFSET 100",
+			{0, 100}:  " LIMIT -1 OFFSET 100",
+			{0, -5}:   "",
+		},
+	}
+	for dialect, pages := range cases {
+		for p, want := range pages {
+			if got := dialect.Paginate(p.limit, p.offset); got != want {
+				t.Errorf("%s limit %d offset %d: got %q, want %q", dialect, p.limit, p.offset, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// ForeignKey is a foreign key constraint: Columns of Table reference RefColumns of RefTable.
+type ForeignKey struct {
+	Name       string   `json:"name"`
+	Schema     string   `json:"schema,omitempty"`
+	Table      string   `json:"table"`
+	Columns    []string `json:"columns"`
+	RefSchema  string   `json:"refSchema,omitempty"`
+	RefTable   string   `json:"refTable"`
+	RefColumns []string `json:"refColumns"`
+}
+
+// ForeignKeysSQL returns a query listing, one row per column pair, the foreign keys that
+// reference a table or that the table declares. ParseForeignKeys reads its rows.
+func ForeignKeysSQL(d Dialect, schema, table string) string {
+	switch d {
+	case Postgres:
+		rel := `to_regclass(` + d.Literal(d.Table(schema, table)) + `)`
+		return `SELECT c.conname::text, cn.nspname::text, cc.relname::text, ca.attname::text, ` +
+			`pn.nspname::text, pc.relname::text, pa.attname::text ` +
+			`FROM pg_constraint c ` +
+			`CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(child, parent, ord) ` +
+			`JOIN pg_class cc ON cc.oid = c.conrelid JOIN pg_namespace cn ON cn.oid = cc.relnamespace ` +
+			`JOIN pg_attribute ca ON ca.attrelid = c.conrelid AND ca.attnum = k.child ` +
+			`JOIN pg_class pc ON pc.oid = c.confrelid JOIN pg_namespace pn ON pn.oid = pc.relnamespace ` +
+			`JOIN pg_attribute pa ON pa.attrelid = c.confrelid AND pa.attnum = k.parent ` +
+			`WHERE c.contype = 'f' AND (c.conrelid = ` + rel + ` OR c.confrelid = ` + rel + `) ` +
+			`ORDER BY c.conname, cn.nspname, cc.relname, k.ord`
+	case MySQL:
+		db, name := mysqlSchema(d, schema), d.Literal(table)
+		return `SELECT CONSTRAINT_NAME, TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME, ` +
+			`REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME ` +
+			`FROM information_schema.KEY_COLUMN_USAGE WHERE REFERENCED_TABLE_NAME IS NOT NULL ` +
+			`AND ((TABLE_SCHEMA = ` + db + ` AND TABLE_NAME = ` + name + `) ` +
+			`OR (REFERENCED_TABLE_SCHEMA = ` + db + ` AND REFERENCED_TABLE_NAME = ` + name + `)) ` +
+			`ORDER BY CONSTRAINT_NAME, TABLE_SCHEMA, TABLE_NAME, ORDINAL_POSITION`
+	default:
+		// SQLite constraints are unnamed, so each is named after its table and id. A NULL
+		// "to" column references the parent's primary key.
+		master := "sqlite_master"
+		if schema != "" {
+			master = d.Quote(schema) + ".sqlite_master"
+		}
+		name := d.Literal(strings.ToLower(table))
+		return `SELECT m.name || '.fk' || f.id, '', m.name, f."from", '', f."table", coalesce(f."to", '') ` +
+			`FROM ` + master + ` m, pragma_foreign_key_list(m.name) f ` +
+			`WHERE m.type = 'table' AND (lower(m.name) = ` + name + ` OR lower(f."table") = ` + name + `) ` +
+			`ORDER BY m.name, f.id, f.seq`
+	}
+}
+
+// ParseForeignKeys groups the rows of the ForeignKeysSQL query into constraints.
+func ParseForeignKeys(rows [][]any) ([]ForeignKey, error) {
+	var keys []ForeignKey
+	for _, row := range rows {
+		if len(row) < 7 {
+			return nil, fmt.Errorf("foreign key row has %d columns, want 7", len(row))
+		}
+		cells := make([]string, 7)
+		for i := range cells {
+			if row[i] != nil {
+				cells[i] = fmt.Sprint(row[i])
+			}
+		}
+		n := len(keys) - 1
+		if n < 0 || keys[n].Name != cells[0] || keys[n].Schema != cells[1] || keys[n].Table != cells[2] {
+			keys = append(keys, ForeignKey{Name: cells[0], Schema: cells[1], Table: cells[2], RefSchema: cells[4], RefTable: cells[5]})
+			n++
+		}
+		keys[n].Columns = append(keys[n].Columns, cells[3])
+		keys[n].RefColumns = append(keys[n].RefColumns, cells[6])
+	}
+	return keys, nil
+}
+
+// References reports whether the key points at the named table.
+func (k ForeignKey) References(d Dialect, schema, table string) bool {
+	return sameTable(d, k.RefSchema, k.RefTable, schema, table)
+}
+
+// DeclaredOn reports whether the key belongs to the named table.
+func (k ForeignKey) DeclaredOn(d Dialect, schema, table string) bool {
+	return sameTable(d, k.Schema, k.Table, schema, table)
+}
+
+func sameTable(d Dialect, schema, table, wantSchema, wantTable string) bool {
+	if d == SQLite {
+		return strings.EqualFold(table, wantTable)
+	}
+	// An unqualified name matches the table in any schema the catalog query returned.
+	return table == wantTable && (wantSchema == "" || schema == wantSchema)
+}
+
+// KeyFilter matches rows whose columns equal values. It reports false when a value is
+// NULL, since a NULL foreign key references nothing.
+func KeyFilter(columns []string, values []any) (resultset.Filter, bool) {
+	f := resultset.Filter{And: make([]resultset.Filter, len(columns))}
+	for i, column := range columns {
+		if values[i] == nil {
+			return resultset.Filter{}, false
+		}
+		f.And[i] = resultset.Filter{Column: column, Op: resultset.OpEq, Value: values[i]}
+	}
+	return f, true
+}
+
+// BuildCount returns a statement counting the rows of a table that match req's filter.
+func BuildCount(d Dialect, req Request) (string, []any, error) {
+	if req.Table == "" {
+		return "", nil, errors.New("table is required")
+	}
+	sql := "SELECT COUNT(*) FROM " + d.Table(req.Schema, req.Table)
+	if req.Filter == nil {
+		return sql, nil, nil
+	}
+	if err := req.Filter.Validate(); err != nil {
+		return "", nil, err
+	}
+	p := &params{dialect: d}
+	return sql + " WHERE " + d.predicate(*req.Filter, p), p.args, nil
+}
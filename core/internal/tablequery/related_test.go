@@ -0,0 +1,52 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseForeignKeysGroupsColumns(t *testing.T) {
+	keys, err := ParseForeignKeys([][]any{
+		{"fk_line", "public", "lines", "order_id", "public", "orders", "id"},
+		{"fk_line", "public", "lines", "order_rev", "public", "orders", "rev"},
+		{"fk_line", "audit", "lines", "order_id", "public", "orders", "id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ForeignKey{
+		{Name: "fk_line", Schema: "public", Table: "lines", Columns: []string{"order_id", "order_rev"},
+			RefSchema: "public", RefTable: "orders", RefColumns: []string{"id", "rev"}},
+		{Name: "fk_line", Schema: "audit", Table: "lines", Columns: []string{"order_id"},
+			RefSchema: "public", RefTable: "orders", RefColumns: []string{"id"}},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("keys = %+v", keys)
+	}
+	if !keys[1].References(Postgres, "", "orders") || keys[1].DeclaredOn(Postgres, "public", "lines") {
+		t.Error("schema matching is wrong")
+	}
+	if !keys[0].DeclaredOn(SQLite, "", "LINES") {
+		t.Error("SQLite table names match case-insensitively")
+	}
+}
+
+func TestBuildCountBindsKey(t *testing.T) {
+	f, ok := KeyFilter([]string{"a", "b"}, []any{int64(1), "x"})
+	if !ok {
+		t.Fatal("expected a filter")
+	}
+	sql, args, err := BuildCount(Postgres, Request{Table: "t", Filter: &f, Limit: 5, Offset: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT COUNT(*) FROM "t" WHERE ("a" = $1 AND "b" = $2)`; sql != want {
+		t.Errorf("got %s", sql)
+	}
+	if !reflect.DeepEqual(args, []any{int64(1), "x"}) {
+		t.Errorf("args = %#v", args)
+	}
+	if _, ok := KeyFilter([]string{"a"}, []any{nil}); ok {
+		t.Error("a NULL key value matches nothing")
+	}
+}
@@ -0,0 +1,186 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// Search modes, reported so that clients can explain why a row matched.
+const (
+	SearchLike     = "like"
+	SearchFullText = "fulltext"
+	SearchFTS5     = "fts5"
+)
+
+// SearchRequest describes a search for a term across the text columns of a table.
+type SearchRequest struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table" jsonschema:"required"`
+	Term   string `json:"term" jsonschema:"required"`
+	// Columns restricts the search; empty searches every text column.
+	Columns []string `json:"columns"`
+	Limit   int      `json:"limit"`
+}
+
+// SearchIndex is a full-text index the search can use instead of LIKE.
+type SearchIndex struct {
+	// Columns of the widest MySQL FULLTEXT index.
+	Columns []string
+	// FTS5 is set when the table is an SQLite FTS5 virtual table.
+	FTS5 bool
+}
+
+// TextColumnsSQL returns a query listing the text columns of a table in table order.
+func TextColumnsSQL(d Dialect, schema, table string) string {
+	switch d {
+	case Postgres:
+		return `SELECT a.attname::text FROM pg_attribute a JOIN pg_type t ON t.oid = a.atttypid ` +
+			`WHERE a.attrelid = to_regclass(` + d.Literal(d.Table(schema, table)) + `) ` +
+			`AND a.attnum > 0 AND NOT a.attisdropped AND t.typcategory = 'S' ORDER BY a.attnum`
+	case MySQL:
+		return `SELECT COLUMN_NAME FROM information_schema.COLUMNS ` +
+			`WHERE TABLE_SCHEMA = ` + mysqlSchema(d, schema) + ` AND TABLE_NAME = ` + d.Literal(table) + ` ` +
+			`AND DATA_TYPE IN ('char', 'varchar', 'tinytext', 'text', 'mediumtext', 'longtext', 'enum', 'set') ` +
+			`ORDER BY ORDINAL_POSITION`
+	default:
+		// Columns of an FTS5 table, and columns declared without a type, have no declared
+		// type but hold text.
+		return `SELECT name FROM ` + pragmaTableInfo(d, schema, table) + ` ` +
+			`WHERE type = '' OR upper(type) LIKE '%CHAR%' OR upper(type) LIKE '%CLOB%' OR upper(type) LIKE '%TEXT%' ` +
+			`ORDER BY cid`
+	}
+}
+
+// SearchIndexSQL returns a query whose rows ParseSearchIndex reads, or "" when the dialect
+// has no index the search uses.
+func SearchIndexSQL(d Dialect, schema, table string) string {
+	switch d {
+	case MySQL:
+		return `SELECT INDEX_NAME, COLUMN_NAME FROM information_schema.STATISTICS ` +
+			`WHERE TABLE_SCHEMA = ` + mysqlSchema(d, schema) + ` AND TABLE_NAME = ` + d.Literal(table) + ` ` +
+			`AND INDEX_TYPE = 'FULLTEXT' ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+	case SQLite:
+		master := "sqlite_master"
+		if schema != "" {
+			master = d.Quote(schema) + ".sqlite_master"
+		}
+		return `SELECT sql FROM ` + master + ` WHERE type = 'table' AND name = ` + d.Literal(table)
+	default:
+		return ""
+	}
+}
+
+// ParseSearchIndex reads the rows of the SearchIndexSQL query.
+func ParseSearchIndex(d Dialect, rows [][]any) SearchIndex {
+	var index SearchIndex
+	switch d {
+	case MySQL:
+		byName := map[string][]string{}
+		for _, row := range rows {
+			name, column := fmt.Sprint(row[0]), fmt.Sprint(row[1])
+			byName[name] = append(byName[name], column)
+			if len(byName[name]) > len(index.Columns) {
+				index.Columns = byName[name]
+			}
+		}
+	case SQLite:
+		for _, row := range rows {
+			if sql, ok := row[0].(string); ok {
+				sql = strings.ToLower(sql)
+				index.FTS5 = strings.HasPrefix(sql, "create virtual table") && strings.Contains(sql, "using fts5")
+			}
+		}
+	}
+	return index
+}
+
+func mysqlSchema(d Dialect, schema string) string {
+	if schema == "" {
+		return "DATABASE()"
+	}
+	return d.Literal(schema)
+}
+
+func pragmaTableInfo(d Dialect, schema, table string) string {
+	if schema == "" {
+		return "pragma_table_info(" + d.Literal(table) + ")"
+	}
+	return "pragma_table_info(" + d.Literal(table) + ", " + d.Literal(schema) + ")"
+}
+
+// BuildSearch returns the statement finding rows in which any of columns contains the term,
+// and the search mode it uses. A MySQL FULLTEXT index is matched with MATCH ... AGAINST,
+// with LIKE for the columns it does not cover; an SQLite FTS5 table is matched with MATCH;
+// everything else uses case-insensitive LIKE, as the contains filter does.
+func BuildSearch(d Dialect, req SearchRequest, columns []string, index SearchIndex) (string, []any, string, error) {
+	if req.Table == "" {
+		return "", nil, "", errors.New("table is required")
+	}
+	if strings.TrimSpace(req.Term) == "" {
+		return "", nil, "", errors.New("term is required")
+	}
+	table := d.Table(req.Schema, req.Table)
+	p := &params{dialect: d}
+	mode := SearchLike
+	var terms []string
+
+	switch {
+	case d == SQLite && index.FTS5:
+		mode = SearchFTS5
+		// A quoted FTS5 string is a phrase, so the term's own syntax is not interpreted.
+		phrase := `"` + strings.ReplaceAll(req.Term, `"`, `""`) + `"`
+		terms = append(terms, d.Quote(req.Table)+" MATCH "+p.add(phrase))
+		columns = nil
+	case d == MySQL && len(index.Columns) > 0 && covers(columns, index.Columns):
+		mode = SearchFullText
+		quoted := make([]string, len(index.Columns))
+		for i, column := range index.Columns {
+			quoted[i] = d.Quote(column)
+		}
+		phrase := `"` + strings.ReplaceAll(req.Term, `"`, " ") + `"`
+		terms = append(terms, "MATCH ("+strings.Join(quoted, ", ")+") AGAINST ("+p.add(phrase)+" IN BOOLEAN MODE)")
+		columns = without(columns, index.Columns)
+	}
+	if mode == SearchLike && len(columns) == 0 {
+		return "", nil, "", errors.New("the table has no text columns to search")
+	}
+	for _, column := range columns {
+		terms = append(terms, d.predicate(resultset.Filter{Column: column, Op: resultset.OpContains, Value: req.Term}, p))
+	}
+
+	sql := "SELECT * FROM " + table + " WHERE " + strings.Join(terms, " OR ")
+	sql += d.Paginate(req.Limit, 0)
+	return sql, p.args, mode, nil
+}
+
+// covers reports whether every index column is among the searched columns, so that using
+// the index does not widen the search.
+func covers(columns, index []string) bool {
+	searched := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		searched[column] = true
+	}
+	for _, column := range index {
+		if !searched[column] {
+			return false
+		}
+	}
+	return true
+}
+
+func without(columns, remove []string) []string {
+	removed := make(map[string]bool, len(remove))
+	for _, column := range remove {
+		removed[column] = true
+	}
+	var out []string
+	for _, column := range columns {
+		if !removed[column] {
+			out = append(out, column)
+		}
+	}
+	return out
+}
@@ -0,0 +1,83 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSearchPicksModePerDialect(t *testing.T) {
+	req := SearchRequest{Table: "posts", Term: `say "hi"`, Limit: 20}
+	cases := []struct {
+		dialect Dialect
+		columns []string
+		index   SearchIndex
+		sql     string
+		args    []any
+		mode    string
+	}{
+		{
+			dialect: Postgres,
+			columns: []string{"title", "body"},
+			sql:     `SELECT * FROM "posts" WHERE CAST("title" AS text) ILIKE $1 ESCAPE '!' OR CAST("body" AS text) ILIKE $2 ESCAPE '!' LIMIT 20`,
+			args:    []any{`%say "hi"%`, `%say "hi"%`},
+			mode:    SearchLike,
+		},
+		{
+			dialect: MySQL,
+			columns: []string{"title", "body", "slug"},
+			index:   SearchIndex{Columns: []string{"title", "body"}},
+			sql:     "SELECT * FROM `posts` WHERE MATCH (`title`, `body`) AGAINST (? IN BOOLEAN MODE) OR LOWER(`slug`) LIKE ? ESCAPE '!' LIMIT 20",
+			args:    []any{`"say  hi "`, `%say "hi"%`},
+			mode:    SearchFullText,
+		},
+		{
+			// An index over a column outside the search would widen it, so LIKE is used.
+			dialect: MySQL,
+			columns: []string{"title"},
+			index:   SearchIndex{Columns: []string{"title", "body"}},
+			sql:     "SELECT * FROM `posts` WHERE LOWER(`title`) LIKE ? ESCAPE '!' LIMIT 20",
+			args:    []any{`%say "hi"%`},
+			mode:    SearchLike,
+		},
+		{
+			dialect: SQLite,
+			columns: []string{"title", "body"},
+			index:   SearchIndex{FTS5: true},
+			sql:     `SELECT * FROM "posts" WHERE "posts" MATCH ? LIMIT 20`,
+			args:    []any{`"say ""hi"""`},
+			mode:    SearchFTS5,
+		},
+	}
+	for _, tc := range cases {
+		sql, args, mode, err := BuildSearch(tc.dialect, req, tc.columns, tc.index)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.dialect, err)
+		}
+		if sql != tc.sql || mode != tc.mode {
+			t.Errorf("%s:\n got %s (%s)\nwant %s (%s)", tc.dialect, sql, mode, tc.sql, tc.mode)
+		}
+		if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: args = %#v", tc.dialect, args)
+		}
+	}
+
+	if _, _, _, err := BuildSearch(Postgres, req, nil, SearchIndex{}); err == nil {
+		t.Error("expected a table without text columns to be refused")
+	}
+	if _, _, _, err := BuildSearch(Postgres, SearchRequest{Table: "posts", Term: " "}, []string{"title"}, SearchIndex{}); err == nil {
+		t.Error("expected a blank term to be refused")
+	}
+}
+
+func TestParseSearchIndex(t *testing.T) {
+	mysql := ParseSearchIndex(MySQL, [][]any{{"ft_a", "title"}, {"ft_b", "title"}, {"ft_b", "body"}})
+	if !reflect.DeepEqual(mysql.Columns, []string{"title", "body"}) {
+		t.Errorf("MySQL index columns = %v", mysql.Columns)
+	}
+	if !ParseSearchIndex(SQLite, [][]any{{"CREATE VIRTUAL TABLE posts USING fts5(title, body)"}}).FTS5 {
+		t.Error("expected an FTS5 table to be recognized")
+	}
+	if ParseSearchIndex(SQLite, [][]any{{"CREATE TABLE posts (title TEXT)"}}).FTS5 {
+		t.Error("a plain table is not FTS5")
+	}
+}
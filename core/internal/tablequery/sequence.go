@@ -0,0 +1,162 @@
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Sequence is a Postgres sequence, a MySQL AUTO_INCREMENT counter or an SQLite
+// AUTOINCREMENT counter. MySQL and SQLite counters are named after their table.
+type Sequence struct {
+	Schema string `json:"schema,omitempty"`
+	Name   string `json:"name"`
+	// Table and Column are the column the sequence feeds, when it is owned by one.
+	Table  string `json:"table,omitempty"`
+	Column string `json:"column,omitempty"`
+	// LastValue is the value last handed out, unknown for MySQL and unused sequences.
+	LastValue *int64 `json:"lastValue"`
+	NextValue *int64 `json:"nextValue"`
+}
+
+// SequenceTableSQL returns a query reporting whether the SQLite database has any
+// AUTOINCREMENT counters, whose table SequencesSQL reads. It is empty for other dialects.
+func SequenceTableSQL(d Dialect, schema string) string {
+	if d != SQLite {
+		return ""
+	}
+	master := "sqlite_master"
+	if schema != "" {
+		master = d.Quote(schema) + ".sqlite_master"
+	}
+	return `SELECT count(*) FROM ` + master + ` WHERE name = 'sqlite_sequence'`
+}
+
+// SequencesSQL returns a query listing the sequences of a schema, or only those feeding a
+// table. ParseSequences reads its rows.
+func SequencesSQL(d Dialect, schema, table string) string {
+	switch d {
+	case Postgres:
+		where := `s.schemaname = current_schema()`
+		if schema != "" {
+			where = `s.schemaname = ` + d.Literal(schema)
+		}
+		if table != "" {
+			where += ` AND d.refobjid = to_regclass(` + d.Literal(d.Table(schema, table)) + `)`
+		}
+		return `SELECT s.schemaname::text, s.sequencename::text, t.relname::text, a.attname::text, s.last_value, ` +
+			`CASE WHEN s.last_value IS NULL THEN s.start_value ELSE s.last_value + s.increment_by END ` +
+			`FROM pg_sequences s ` +
+			`LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass ` +
+			`AND d.objid = format('%I.%I', s.schemaname, s.sequencename)::regclass AND d.deptype IN ('a', 'i') ` +
+			`LEFT JOIN pg_class t ON t.oid = d.refobjid ` +
+			`LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid ` +
+			`WHERE ` + where + ` ORDER BY 2`
+	case MySQL:
+		where := `c.TABLE_SCHEMA = ` + mysqlSchema(d, schema)
+		if table != "" {
+			where += ` AND c.TABLE_NAME = ` + d.Literal(table)
+		}
+		return `SELECT c.TABLE_SCHEMA, c.TABLE_NAME, c.TABLE_NAME, c.COLUMN_NAME, NULL, t.AUTO_INCREMENT ` +
+			`FROM information_schema.COLUMNS c JOIN information_schema.TABLES t ` +
+			`ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME ` +
+			`WHERE c.EXTRA LIKE '%auto_increment%' AND ` + where + ` ORDER BY 2`
+	default:
+		// The counter feeds the table's INTEGER PRIMARY KEY, the only AUTOINCREMENT column.
+		sequence := "sqlite_sequence"
+		if schema != "" {
+			sequence = d.Quote(schema) + ".sqlite_sequence"
+		}
+		where := ""
+		if table != "" {
+			where = ` WHERE lower(s.name) = lower(` + d.Literal(table) + `)`
+		}
+		return `SELECT '', s.name, s.name, p.name, s.seq, s.seq + 1 FROM ` + sequence + ` s ` +
+			`LEFT JOIN pragma_table_info(s.name) p ON p.pk = 1` + where + ` ORDER BY 2`
+	}
+}
+
+// ParseSequences reads the rows of the SequencesSQL query.
+func ParseSequences(rows [][]any) ([]Sequence, error) {
+	sequences := make([]Sequence, 0, len(rows))
+	for _, row := range rows {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("sequence row has %d columns, want 6", len(row))
+		}
+		names := make([]string, 4)
+		for i := range names {
+			if row[i] != nil {
+				names[i] = fmt.Sprint(row[i])
+			}
+		}
+		sequences = append(sequences, Sequence{
+			Schema:    names[0],
+			Name:      names[1],
+			Table:     names[2],
+			Column:    names[3],
+			LastValue: int64Value(row[4]),
+			NextValue: int64Value(row[5]),
+		})
+	}
+	return sequences, nil
+}
+
+func int64Value(value any) *int64 {
+	var n int64
+	switch v := value.(type) {
+	case int64:
+		n = v
+	case int32:
+		n = int64(v)
+	case int:
+		n = int64(v)
+	case uint64:
+		n = int64(v)
+	case float64:
+		n = int64(v)
+	case string:
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil
+		}
+		n = parsed
+	default:
+		return nil
+	}
+	return &n
+}
+
+// SequenceMaxSQL returns a query reading the largest value of the column a sequence feeds.
+func SequenceMaxSQL(d Dialect, seq Sequence) (string, error) {
+	if seq.Table == "" || seq.Column == "" {
+		return "", fmt.Errorf("sequence %s does not feed a column", seq.Name)
+	}
+	return `SELECT MAX(` + d.Quote(seq.Column) + `) FROM ` + d.Table(seq.Schema, seq.Table), nil
+}
+
+// BuildSequenceReset returns the statement making next the value a sequence hands out next.
+func BuildSequenceReset(d Dialect, seq Sequence, next int64) (Statement, error) {
+	if seq.Name == "" {
+		return Statement{}, errors.New("sequence is required")
+	}
+	if next < 1 {
+		return Statement{}, errors.New("the restart value must be positive")
+	}
+	value := strconv.FormatInt(next, 10)
+	switch d {
+	case Postgres:
+		return Statement{SQL: `ALTER SEQUENCE ` + d.Table(seq.Schema, seq.Name) + ` RESTART WITH ` + value}, nil
+	case MySQL:
+		return Statement{SQL: `ALTER TABLE ` + d.Table(seq.Schema, seq.Name) + ` AUTO_INCREMENT = ` + value}, nil
+	default:
+		sequence := "sqlite_sequence"
+		if seq.Schema != "" {
+			sequence = d.Quote(seq.Schema) + ".sqlite_sequence"
+		}
+		// The table stores the last value handed out.
+		return Statement{
+			SQL:  `UPDATE ` + sequence + ` SET seq = ? WHERE name = ?`,
+			Args: []any{next - 1, seq.Name},
+		}, nil
+	}
+}
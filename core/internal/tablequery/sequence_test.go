@@ -0,0 +1,48 @@
+package tablequery
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSequenceResetPerDialect(t *testing.T) {
+	seq := Sequence{Schema: "app", Name: "orders_id_seq", Table: "orders", Column: "id"}
+	want := map[Dialect]string{
+		Postgres: `ALTER SEQUENCE "app"."orders_id_seq" RESTART WITH 41`,
+		MySQL:    "ALTER TABLE `app`.`orders_id_seq` AUTO_INCREMENT = 41",
+		SQLite:   `UPDATE "app".sqlite_sequence SET seq = ? WHERE name = ?`,
+	}
+	for d, sql := range want {
+		stmt, err := BuildSequenceReset(d, seq, 41)
+		if err != nil || stmt.SQL != sql {
+			t.Errorf("%v: got %q, %v", d, stmt.SQL, err)
+		}
+	}
+	if _, err := BuildSequenceReset(Postgres, seq, 0); err == nil {
+		t.Error("expected a non-positive restart to be refused")
+	}
+	if sql, err := SequenceMaxSQL(Postgres, seq); err != nil || sql != `SELECT MAX("id") FROM "app"."orders"` {
+		t.Errorf("got %q, %v", sql, err)
+	}
+	if _, err := SequenceMaxSQL(Postgres, Sequence{Name: "free"}); err == nil {
+		t.Error("expected an unowned sequence to have no column")
+	}
+}
+
+func TestParseSequences(t *testing.T) {
+	got, err := ParseSequences([][]any{
+		{"public", "orders_id_seq", "orders", "id", int64(40), int64(41)},
+		{"public", "free", nil, nil, nil, "1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forty, fortyOne, one := int64(40), int64(41), int64(1)
+	want := []Sequence{
+		{Schema: "public", Name: "orders_id_seq", Table: "orders", Column: "id", LastValue: &forty, NextValue: &fortyOne},
+		{Schema: "public", Name: "free", NextValue: &one},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v", got)
+	}
+}
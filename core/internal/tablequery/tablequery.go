@@ -0,0 +1,196 @@
+// Package tablequery builds the SELECT statements that browse a table, such as table.peek,
+// from structured requests. Identifiers are quoted per dialect, so clients never send SQL
+// fragments.
+package tablequery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+// Dialect is the SQL flavour of a driver.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+)
+
+// ParseDialect returns the dialect of a connection driver.
+func ParseDialect(driver string) (Dialect, error) {
+	switch d := Dialect(driver); d {
+	case Postgres, MySQL, SQLite:
+		return d, nil
+	default:
+		return "", fmt.Errorf("driver not supported: %s", driver)
+	}
+}
+
+// Quote quotes an identifier.
+func (d Dialect) Quote(ident string) string {
+	if d == MySQL {
+		return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+// Literal quotes a string constant. MySQL also treats backslashes as escapes.
+func (d Dialect) Literal(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if d == MySQL {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
+
+// Table quotes a table name, qualified by schema when one is given.
+func (d Dialect) Table(schema, table string) string {
+	if schema == "" {
+		return d.Quote(table)
+	}
+	return d.Quote(schema) + "." + d.Quote(table)
+}
+
+// Request describes the rows to read from one table.
+type Request struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table" jsonschema:"required"`
+	// Columns to select; empty selects every column.
+	Columns []string `json:"columns"`
+	// JSONPaths adds a column for each value projected out of a json or jsonb column.
+	JSONPaths []JSONProjection `json:"jsonPaths,omitempty"`
+	// Filter restricts the rows. Its values are sent as bind arguments.
+	Filter *resultset.Filter `json:"filter,omitempty"`
+	// Sort orders the rows. NULLs follow the Postgres defaults on every driver unless a key
+	// says otherwise, so that sorting a grid column gives the same order everywhere.
+	Sort   []resultset.SortKey `json:"sort"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+	// RowID adds the ctid or rowid as RowIDColumn, for tables identified by one.
+	RowID bool `json:"-"`
+}
+
+// Build returns the SELECT statement for req and its bind arguments. Tiebreak columns,
+// typically the primary key, are appended to the sort so that rows with equal keys keep a
+// stable order across pages.
+func Build(d Dialect, req Request, tiebreak []string) (string, []any, error) {
+	if req.Table == "" {
+		return "", nil, errors.New("table is required")
+	}
+	// Placeholders are numbered in statement order: projections, then the filter.
+	p := &params{dialect: d}
+	selected := make([]string, 0, len(req.Columns)+len(req.JSONPaths)+1)
+	if len(req.Columns) == 0 {
+		selected = append(selected, "*")
+	}
+	for _, column := range req.Columns {
+		selected = append(selected, d.Quote(column))
+	}
+	if req.RowID {
+		selected = append(selected, d.pseudoColumn()+" AS "+d.Quote(RowIDColumn))
+	}
+	for _, projection := range req.JSONPaths {
+		expr, err := d.project(projection, p)
+		if err != nil {
+			return "", nil, err
+		}
+		selected = append(selected, expr)
+	}
+	var b strings.Builder
+	b.WriteString("SELECT " + strings.Join(selected, ", "))
+	b.WriteString(" FROM " + d.Table(req.Schema, req.Table))
+
+	if req.Filter != nil {
+		if err := req.Filter.Validate(); err != nil {
+			return "", nil, err
+		}
+		b.WriteString(" WHERE " + d.predicate(*req.Filter, p))
+	}
+
+	orderBy, err := d.OrderBy(withTiebreak(req.Sort, tiebreak))
+	if err != nil {
+		return "", nil, err
+	}
+	if orderBy != "" {
+		b.WriteString(" ORDER BY " + orderBy)
+	}
+	b.WriteString(d.Paginate(req.Limit, req.Offset))
+	return b.String(), p.args, nil
+}
+
+func withTiebreak(keys []resultset.SortKey, tiebreak []string) []resultset.SortKey {
+	if len(keys) == 0 || len(tiebreak) == 0 {
+		return keys
+	}
+	sorted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		sorted[key.Column] = true
+	}
+	out := append([]resultset.SortKey(nil), keys...)
+	for _, column := range tiebreak {
+		if !sorted[column] {
+			out = append(out, resultset.SortKey{Column: column})
+		}
+	}
+	return out
+}
+
+// OrderBy renders sort keys. MySQL has no NULLS FIRST/LAST, so it sorts on IS NULL first.
+func (d Dialect) OrderBy(keys []resultset.SortKey) (string, error) {
+	terms := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.Column == "" {
+			return "", errors.New("sort column is required")
+		}
+		nullsFirst := key.Desc
+		switch key.Nulls {
+		case "":
+		case "first":
+			nullsFirst = true
+		case "last":
+			nullsFirst = false
+		default:
+			return "", fmt.Errorf("nulls must be first or last, got %q", key.Nulls)
+		}
+		column := d.Quote(key.Column)
+		direction := " ASC"
+		if key.Desc {
+			direction = " DESC"
+		}
+		if d == MySQL {
+			nulls := column + " IS NULL"
+			if nullsFirst {
+				nulls += " DESC"
+			}
+			terms = append(terms, nulls, column+direction)
+			continue
+		}
+		nulls := " NULLS LAST"
+		if nullsFirst {
+			nulls = " NULLS FIRST"
+		}
+		terms = append(terms, column+direction+nulls)
+	}
+	return strings.Join(terms, ", "), nil
+}
+
+// PrimaryKeySQL returns a query listing the primary key columns of a table in key order.
+func PrimaryKeySQL(d Dialect, schema, table string) string {
+	switch d {
+	case Postgres:
+		return `SELECT a.attname::text FROM pg_index i ` +
+			`JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey) ` +
+			`WHERE i.indrelid = to_regclass(` + d.Literal(d.Table(schema, table)) + `) AND i.indisprimary ` +
+			`ORDER BY array_position(i.indkey, a.attnum)`
+	case MySQL:
+		return `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE ` +
+			`WHERE TABLE_SCHEMA = ` + mysqlSchema(d, schema) + ` AND TABLE_NAME = ` + d.Literal(table) + ` AND CONSTRAINT_NAME = 'PRIMARY' ` +
+			`ORDER BY ORDINAL_POSITION`
+	default:
+		return `SELECT name FROM ` + pragmaTableInfo(d, schema, table) + ` WHERE pk > 0 ORDER BY pk`
+	}
+}
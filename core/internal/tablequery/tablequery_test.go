@@ -0,0 +1,66 @@
+package tablequery
+
+import (
+	"testing"
+
+	"github.com/fluxgrid/core/internal/resultset"
+)
+
+func TestBuildOrdersNullsPerDialect(t *testing.T) {
+	req := Request{
+		Schema:  "public",
+		Table:   "users",
+		Columns: []string{"name", "age"},
+		Sort: []resultset.SortKey{
+			{Column: "age", Desc: true},
+			{Column: "name", Nulls: "first"},
+		},
+		Limit:  50,
+		Offset: 100,
+	}
+	cases := map[Dialect]string{
+		Postgres: `SELECT "name", "age" FROM "public"."users" ORDER BY "age" DESC NULLS FIRST, "name" ASC NULLS FIRST, "id" ASC NULLS LAST LIMIT 50 OFFSET 100`,
+		SQLite:   `SELECT "name", "age" FROM "public"."users" ORDER BY "age" DESC NULLS FIRST, "name" ASC NULLS FIRST, "id" ASC NULLS LAST LIMIT 50 OFFSET 100`,
+		MySQL:    "SELECT `name`, `age` FROM `public`.`users` ORDER BY `age` IS NULL DESC, `age` DESC, `name` IS NULL DESC, `name` ASC, `id` IS NULL, `id` ASC LIMIT 50 OFFSET 100",
+	}
+	for dialect, want := range cases {
+		got, _, err := Build(dialect, req, []string{"id", "name"})
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if got != want {
+			t.Errorf("%s:\n got %s\nwant %s", dialect, got, want)
+		}
+	}
+}
+
+func TestBuildWithoutSortSkipsTiebreak(t *testing.T) {
+	got, _, err := Build(SQLite, Request{Table: `odd"name`, Offset: 10}, []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT * FROM "odd""name" LIMIT -1 OFFSET 10`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestBuildRejectsInvalidRequests(t *testing.T) {
+	for name, req := range map[string]Request{
+		"no table":  {},
+		"no column": {Table: "t", Sort: []resultset.SortKey{{}}},
+		"bad nulls": {Table: "t", Sort: []resultset.SortKey{{Column: "a", Nulls: "middle"}}},
+	} {
+		if _, _, err := Build(Postgres, req, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLiteralEscapesMySQLBackslashes(t *testing.T) {
+	if got := MySQL.Literal(`it's\`); got != `'it''s\\'` {
+		t.Errorf("MySQL literal = %s", got)
+	}
+	if got := Postgres.Literal(`it's\`); got != `'it''s\'` {
+		t.Errorf("Postgres literal = %s", got)
+	}
+}
@@ -0,0 +1,235 @@
+package tempstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionPrefix     = "session-"
+	defaultStaleAfter = 24 * time.Hour
+)
+
+// ErrQuotaExceeded is returned by writes that would push the store past its quota.
+var ErrQuotaExceeded = errors.New("temp storage quota exceeded")
+
+// Options configures a Store. Zero values select defaults.
+type Options struct {
+	// Dir is the root directory; it defaults to <os.TempDir()>/fluxgrid.
+	Dir string
+	// MaxBytes bounds the bytes held by all live temp files. Zero means unlimited.
+	MaxBytes int64
+	// StaleAfter is how long a session directory left behind by another process must be
+	// untouched before startup cleanup removes it.
+	StaleAfter time.Duration
+}
+
+// Usage reports the current state of the store.
+type Usage struct {
+	Dir      string `json:"dir"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"maxBytes,omitempty"`
+}
+
+// Store hands out temp files inside a per-process session directory and accounts their size
+// against a quota. Sessions of other processes are left alone until they go stale, so several
+// engines can share one root.
+type Store struct {
+	dir      string
+	maxBytes int64
+
+	mu     sync.Mutex
+	used   int64
+	files  map[*File]struct{}
+	closed bool
+}
+
+// Open prepares the session directory and removes stale sessions left by earlier runs.
+func Open(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		opts.Dir = filepath.Join(os.TempDir(), "fluxgrid")
+	}
+	if opts.StaleAfter <= 0 {
+		opts.StaleAfter = defaultStaleAfter
+	}
+	if opts.MaxBytes < 0 {
+		return nil, fmt.Errorf("temp storage quota must not be negative")
+	}
+
+	root, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	removeStaleSessions(root, opts.StaleAfter)
+
+	name := sessionPrefix + strconv.Itoa(os.Getpid()) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	dir := filepath.Join(root, name)
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir:      dir,
+		maxBytes: opts.MaxBytes,
+		files:    make(map[*File]struct{}),
+	}, nil
+}
+
+func removeStaleSessions(root string, staleAfter time.Duration) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-staleAfter)
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), sessionPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.RemoveAll(filepath.Join(root, entry.Name()))
+	}
+}
+
+// Dir returns the session directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Create opens a new empty temp file whose name starts with pattern (see os.CreateTemp).
+func (s *Store) Create(pattern string) (*File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, os.ErrClosed
+	}
+
+	// The session directory doubles as a liveness marker for other processes' cleanup.
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(s.dir, now, now)
+
+	file, err := os.CreateTemp(s.dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{file: file, store: s}
+	s.files[f] = struct{}{}
+	return f, nil
+}
+
+// reserve accounts n more bytes against the quota.
+func (s *Store) reserve(n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxBytes > 0 && s.used+n > s.maxBytes {
+		return ErrQuotaExceeded
+	}
+	s.used += n
+	return nil
+}
+
+// settle returns the unwritten part of a reservation and records the bytes written to f.
+func (s *Store) settle(f *File, reserved, written int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used -= reserved - written
+	f.size += written
+}
+
+func (s *Store) release(f *File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[f]; !ok {
+		return
+	}
+	delete(s.files, f)
+	s.used -= f.size
+}
+
+// Usage returns the number of live files and their accounted size.
+func (s *Store) Usage() Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Usage{
+		Dir:      s.dir,
+		Files:    len(s.files),
+		Bytes:    s.used,
+		MaxBytes: s.maxBytes,
+	}
+}
+
+// Close removes every temp file and the session directory. Files created afterwards fail.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	files := make([]*File, 0, len(s.files))
+	for f := range s.files {
+		files = append(files, f)
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	for _, f := range files {
+		f.Remove()
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// File is a temp file whose writes count against the store quota. It deliberately does
+// not embed *os.File so that io.Copy cannot bypass the quota through ReadFrom.
+type File struct {
+	file  *os.File
+	store *Store
+	size  int64
+}
+
+// Name returns the path of the file.
+func (f *File) Name() string {
+	return f.file.Name()
+}
+
+// Write reserves quota before writing; a write that does not fit fails with
+// ErrQuotaExceeded and writes nothing.
+func (f *File) Write(p []byte) (int, error) {
+	if err := f.store.reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := f.file.Write(p)
+	f.store.settle(f, int64(len(p)), int64(n))
+	return n, err
+}
+
+// Read reads from the file, typically after seeking back to the start.
+func (f *File) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+// Seek sets the offset for the next Read or Write.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+// Remove closes and deletes the file and returns its bytes to the quota.
+func (f *File) Remove() error {
+	f.file.Close()
+	err := os.Remove(f.file.Name())
+	f.store.release(f)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,77 @@
+package tempstore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoreEnforcesQuota(t *testing.T) {
+	store, err := Open(Options{Dir: t.TempDir(), MaxBytes: 10})
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer store.Close()
+
+	a, _ := store.Create("spill-*")
+	if _, err := a.Write([]byte("123456")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	b, _ := store.Create("spill-*")
+	if _, err := io.Copy(b, strings.NewReader("abcdef")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if usage := store.Usage(); usage.Files != 2 || usage.Bytes != 6 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+
+	if err := a.Remove(); err != nil {
+		t.Fatalf("Remove returned error: %v", err)
+	}
+	if _, err := b.Write([]byte("abcdef")); err != nil {
+		t.Fatalf("expected write to fit after remove, got %v", err)
+	}
+	if _, err := os.Stat(a.Name()); !os.IsNotExist(err) {
+		t.Fatalf("expected removed file to be gone, got %v", err)
+	}
+}
+
+func TestStoreCleansUp(t *testing.T) {
+	root := t.TempDir()
+	stale := filepath.Join(root, sessionPrefix+"1-old")
+	live := filepath.Join(root, sessionPrefix+"2-live")
+	for _, dir := range []string{stale, live} {
+		if err := os.Mkdir(dir, 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(stale, old, old)
+
+	store, err := Open(Options{Dir: root})
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("expected stale session to be removed, got %v", err)
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Fatalf("expected recent session to be kept, got %v", err)
+	}
+
+	f, _ := store.Create("export-*")
+	f.Write([]byte("data"))
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if _, err := os.Stat(store.Dir()); !os.IsNotExist(err) {
+		t.Fatalf("expected session directory to be removed, got %v", err)
+	}
+	if _, err := store.Create("late-*"); err == nil {
+		t.Fatal("expected Create to fail after Close")
+	}
+}
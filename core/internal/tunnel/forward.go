@@ -0,0 +1,331 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fluxgrid/core/internal/sshtrust"
+)
+
+// Kinds of forward.
+const (
+	KindSSH        = "ssh"
+	KindKubernetes = "kubernetes"
+)
+
+// Spec describes a port forward from a local port to a database, either behind SSH hops
+// or inside a Kubernetes cluster.
+type Spec struct {
+	Hops []Hop `json:"hops,omitempty"`
+	// RemoteHost and RemotePort are the database address as seen from the last hop.
+	RemoteHost string `json:"remoteHost,omitempty"`
+	RemotePort int    `json:"remotePort,omitempty"`
+	// Kubernetes forwards to a pod or service instead of going through SSH.
+	Kubernetes *KubeTarget `json:"kubernetes,omitempty"`
+	// LocalPort to listen on; zero picks a free port.
+	LocalPort int `json:"localPort,omitempty"`
+}
+
+// Validate checks that spec names exactly one way to reach the database.
+func (spec Spec) Validate() error {
+	if spec.Kubernetes != nil {
+		if len(spec.Hops) > 0 {
+			return errors.New("a tunnel goes through either SSH hops or Kubernetes, not both")
+		}
+		return spec.Kubernetes.validate()
+	}
+	if len(spec.Hops) == 0 {
+		return errors.New("at least one SSH hop or a Kubernetes target is required")
+	}
+	if spec.RemoteHost == "" || spec.RemotePort <= 0 {
+		return errors.New("remote host and port are required")
+	}
+	return nil
+}
+
+// Info describes an open forward. Connections point their DSN at LocalAddress.
+type Info struct {
+	ID           string    `json:"id"`
+	Kind         string    `json:"kind"`
+	LocalAddress string    `json:"localAddress"`
+	LocalPort    int       `json:"localPort"`
+	Remote       string    `json:"remote"`
+	Hops         []string  `json:"hops,omitempty"`
+	OpenedAt     time.Time `json:"openedAt"`
+	// ActiveConnections are being forwarded now; Connections counts all accepted.
+	ActiveConnections int64 `json:"activeConnections"`
+	Connections       int64 `json:"connections"`
+	// BytesSent travel from local clients to the database, BytesReceived back.
+	BytesSent     int64 `json:"bytesSent"`
+	BytesReceived int64 `json:"bytesReceived"`
+}
+
+// backend carries forwarded connections to the database.
+type backend interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+	// Wait blocks until the backend stops on its own and returns why.
+	Wait() error
+	Close() error
+}
+
+// Forward listens on a local port and carries each accepted connection to the database
+// through its backend, counting the traffic.
+type Forward struct {
+	info     Info
+	backend  backend
+	listener net.Listener
+
+	active, total, sent, received atomic.Int64
+
+	closeOnce sync.Once
+	done      chan struct{}
+	conns     sync.WaitGroup
+}
+
+// OpenForward connects the hops or starts the Kubernetes port-forward, then listens on
+// the loopback interface.
+func OpenForward(ctx context.Context, spec Spec, opts Options) (*Forward, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	info := Info{Kind: KindSSH, Remote: net.JoinHostPort(spec.RemoteHost, strconv.Itoa(spec.RemotePort))}
+	var (
+		b   backend
+		err error
+	)
+	if spec.Kubernetes != nil {
+		var kube *kubeForward
+		kube, err = startKubeForward(ctx, *spec.Kubernetes)
+		b = kube
+		if err == nil {
+			info.Kind, info.Remote = KindKubernetes, spec.Kubernetes.String()
+		}
+	} else {
+		b, err = Connect(ctx, spec.Hops, opts)
+		for _, hop := range spec.Hops {
+			info.Hops = append(info.Hops, hop.User+"@"+hop.Address())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(spec.LocalPort)))
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		listener.Close()
+		b.Close()
+		return nil, err
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	info.ID = "tun_" + hex.EncodeToString(id[:])
+	info.LocalAddress = addr.String()
+	info.LocalPort = addr.Port
+	info.OpenedAt = time.Now().UTC()
+	f := &Forward{
+		info:     info,
+		backend:  b,
+		listener: listener,
+		done:     make(chan struct{}),
+	}
+	go f.accept()
+	return f, nil
+}
+
+// Info returns the forward's addresses and traffic counters.
+func (f *Forward) Info() Info {
+	info := f.info
+	info.Hops = append([]string(nil), f.info.Hops...)
+	info.ActiveConnections = f.active.Load()
+	info.Connections = f.total.Load()
+	info.BytesSent = f.sent.Load()
+	info.BytesReceived = f.received.Load()
+	return info
+}
+
+// Done is closed once the forward has stopped, whether closed or because a hop dropped.
+func (f *Forward) Done() <-chan struct{} { return f.done }
+
+// Wait blocks until the outermost hop disconnects, or kubectl exits, and returns why.
+func (f *Forward) Wait() error { return f.backend.Wait() }
+
+// Close stops listening, drops forwarded connections and closes the backend.
+func (f *Forward) Close() error {
+	var err error
+	f.closeOnce.Do(func() {
+		f.listener.Close()
+		err = f.backend.Close()
+		f.conns.Wait()
+		close(f.done)
+	})
+	return err
+}
+
+func (f *Forward) accept() {
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		f.conns.Add(1)
+		go f.carry(local)
+	}
+}
+
+func (f *Forward) carry(local net.Conn) {
+	defer f.conns.Done()
+	defer local.Close()
+	remote, err := f.backend.DialContext(context.Background(), "tcp", f.info.Remote)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+	f.total.Add(1)
+	f.active.Add(1)
+	defer f.active.Add(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		copyCounted(remote, local, &f.sent)
+		// Pass the client's end of stream on while the reply may still be arriving.
+		if cw, ok := remote.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			remote.Close()
+		}
+	}()
+	copyCounted(local, remote, &f.received)
+	local.Close()
+	wg.Wait()
+}
+
+func copyCounted(dst io.Writer, src io.Reader, counter *atomic.Int64) {
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+			counter.Add(int64(n))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Manager owns the forwards opened by one client, so that connections can share a tunnel
+// and it outlives any single query.
+type Manager struct {
+	opts Options
+	// onLost is told about forwards that stopped because a hop disconnected.
+	onLost func(Info, error)
+
+	mu       sync.Mutex
+	forwards map[string]*Forward
+}
+
+// NewManager verifies hosts with opts. onLost may be nil.
+func NewManager(opts Options, onLost func(Info, error)) *Manager {
+	if onLost == nil {
+		onLost = func(Info, error) {}
+	}
+	return &Manager{opts: opts, onLost: onLost, forwards: make(map[string]*Forward)}
+}
+
+// Open starts a forward, verifying its hops in mode, and returns its description.
+func (m *Manager) Open(ctx context.Context, spec Spec, mode sshtrust.Mode) (Info, error) {
+	opts := m.opts
+	opts.Mode = mode
+	f, err := OpenForward(ctx, spec, opts)
+	if err != nil {
+		return Info{}, err
+	}
+	m.mu.Lock()
+	m.forwards[f.info.ID] = f
+	m.mu.Unlock()
+
+	go func() {
+		err := f.Wait()
+		select {
+		case <-f.Done():
+			// Closed on purpose.
+			return
+		default:
+		}
+		if m.remove(f.info.ID) != nil {
+			f.Close()
+			if err == nil {
+				err = errors.New("connection closed by the server")
+			}
+			if f.info.Kind == KindSSH {
+				err = fmt.Errorf("ssh hop %s: %w", f.info.Hops[0], err)
+			}
+			m.onLost(f.Info(), err)
+		}
+	}()
+	return f.Info(), nil
+}
+
+// List returns the open forwards, oldest first.
+func (m *Manager) List() []Info {
+	m.mu.Lock()
+	infos := make([]Info, 0, len(m.forwards))
+	for _, f := range m.forwards {
+		infos = append(infos, f.Info())
+	}
+	m.mu.Unlock()
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].OpenedAt.Equal(infos[j].OpenedAt) {
+			return infos[i].OpenedAt.Before(infos[j].OpenedAt)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Close closes the forward with the given ID and reports whether it was open.
+func (m *Manager) Close(id string) bool {
+	f := m.remove(id)
+	if f == nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// CloseAll closes every forward.
+func (m *Manager) CloseAll() {
+	m.mu.Lock()
+	forwards := m.forwards
+	m.forwards = make(map[string]*Forward)
+	m.mu.Unlock()
+	for _, f := range forwards {
+		f.Close()
+	}
+}
+
+func (m *Manager) remove(id string) *Forward {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.forwards[id]
+	delete(m.forwards, id)
+	return f
+}
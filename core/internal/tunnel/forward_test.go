@@ -0,0 +1,99 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/sshtrust"
+)
+
+func TestManagerForwardsAndCountsTraffic(t *testing.T) {
+	bastion := startServer(t, "secret")
+	echoHost, echoPort, _ := net.SplitHostPort(startEcho(t))
+	port, _ := strconv.Atoi(echoPort)
+	store := sshtrust.NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	manager := NewManager(Options{HostKeys: store}, nil)
+	defer manager.CloseAll()
+
+	info, err := manager.Open(context.Background(), Spec{
+		Hops:       []Hop{hopTo(t, bastion, "secret")},
+		RemoteHost: echoHost,
+		RemotePort: port,
+	}, sshtrust.TOFU)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if info.LocalPort == 0 || len(info.Hops) != 1 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	// Two connections share the tunnel.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", info.LocalAddress)
+		if err != nil {
+			t.Fatalf("dial local port: %v", err)
+		}
+		io.WriteString(conn, "hello")
+		reply := make([]byte, 5)
+		if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "hello" {
+			t.Fatalf("unexpected echo %q, %v", reply, err)
+		}
+		conn.Close()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	var listed Info
+	for time.Now().Before(deadline) {
+		if list := manager.List(); len(list) == 1 {
+			listed = list[0]
+			if listed.ActiveConnections == 0 && listed.Connections == 2 {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if listed.Connections != 2 || listed.BytesSent != 10 || listed.BytesReceived != 10 {
+		t.Fatalf("unexpected counters %+v", listed)
+	}
+
+	if !manager.Close(info.ID) || manager.Close(info.ID) {
+		t.Fatal("expected the tunnel to close exactly once")
+	}
+	if _, err := net.Dial("tcp", info.LocalAddress); err == nil {
+		t.Fatal("expected the local port to stop listening")
+	}
+}
+
+func TestManagerReportsLostTunnels(t *testing.T) {
+	bastion := startServer(t, "secret")
+	store := sshtrust.NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	lost := make(chan Info, 1)
+	manager := NewManager(Options{HostKeys: store}, func(info Info, _ error) { lost <- info })
+
+	info, err := manager.Open(context.Background(), Spec{
+		Hops:       []Hop{hopTo(t, bastion, "secret")},
+		RemoteHost: "127.0.0.1",
+		RemotePort: 5432,
+	}, sshtrust.TOFU)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	bastion.drop()
+
+	select {
+	case got := <-lost:
+		if got.ID != info.ID {
+			t.Fatalf("unexpected lost tunnel %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the lost tunnel to be reported")
+	}
+	if len(manager.List()) != 0 {
+		t.Fatal("expected the lost tunnel to be removed")
+	}
+}
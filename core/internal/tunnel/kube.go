@@ -0,0 +1,193 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// kubectlPath is the kubectl binary that Kubernetes forwards run. Tests replace it.
+var kubectlPath = "kubectl"
+
+// maxKubeStderr bounds the kubectl output kept to explain a failure.
+const maxKubeStderr = 4 << 10
+
+var forwardingLine = regexp.MustCompile(`Forwarding from 127\.0\.0\.1:(\d+) ->`)
+
+// KubeTarget is a pod or service port in a cluster, reached the way kubectl port-forward
+// reaches it and with the credentials of a kubeconfig context.
+type KubeTarget struct {
+	// Kubeconfig and Context default to kubectl's own defaults.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	// Resource is a pod or service such as "svc/postgres" or "pod/db-0". A bare name is a
+	// pod.
+	Resource string `json:"resource"`
+	Port     int    `json:"port"`
+}
+
+func (t KubeTarget) validate() error {
+	if t.Resource == "" || t.Port <= 0 {
+		return errors.New("a Kubernetes resource and port are required")
+	}
+	if strings.HasPrefix(t.Resource, "-") || strings.ContainsAny(t.Resource, " \t") {
+		return fmt.Errorf("invalid Kubernetes resource %q", t.Resource)
+	}
+	return nil
+}
+
+// String names the target as context/namespace/resource:port.
+func (t KubeTarget) String() string {
+	var b strings.Builder
+	if t.Context != "" {
+		b.WriteString(t.Context + "/")
+	}
+	if t.Namespace != "" {
+		b.WriteString(t.Namespace + "/")
+	}
+	b.WriteString(t.Resource + ":" + strconv.Itoa(t.Port))
+	return b.String()
+}
+
+func (t KubeTarget) args() []string {
+	var args []string
+	if t.Kubeconfig != "" {
+		args = append(args, "--kubeconfig", t.Kubeconfig)
+	}
+	if t.Context != "" {
+		args = append(args, "--context", t.Context)
+	}
+	if t.Namespace != "" {
+		args = append(args, "--namespace", t.Namespace)
+	}
+	// An empty local port lets kubectl pick one, which it then reports.
+	return append(args, "port-forward", "--address", "127.0.0.1", t.Resource, ":"+strconv.Itoa(t.Port))
+}
+
+// kubeForward is a running kubectl port-forward. The Forward in front of it listens on the
+// port clients use and counts their traffic; kubectl's own port is an implementation
+// detail.
+type kubeForward struct {
+	cmd    *exec.Cmd
+	addr   string
+	stderr *tailBuffer
+
+	exited chan struct{}
+	err    error
+}
+
+func startKubeForward(ctx context.Context, target KubeTarget) (*kubeForward, error) {
+	// The forward outlives the request that opened it, so ctx only bounds the start.
+	cmd := exec.Command(kubectlPath, target.args()...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	k := &kubeForward{cmd: cmd, stderr: &tailBuffer{}, exited: make(chan struct{})}
+	cmd.Stderr = k.stderr
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("kubectl is required for Kubernetes tunnels: %w", err)
+		}
+		return nil, err
+	}
+
+	ports := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if m := forwardingLine.FindStringSubmatch(scanner.Text()); m != nil {
+				select {
+				case ports <- m[1]:
+				default:
+				}
+			}
+		}
+		// Keep draining so that kubectl never blocks on a full pipe.
+		_, _ = io.Copy(io.Discard, stdout)
+	}()
+	go func() {
+		k.err = cmd.Wait()
+		close(k.exited)
+	}()
+
+	select {
+	case port := <-ports:
+		k.addr = net.JoinHostPort("127.0.0.1", port)
+		return k, nil
+	case <-k.exited:
+		return nil, k.exitError()
+	case <-ctx.Done():
+		k.Close()
+		return nil, ctx.Err()
+	}
+}
+
+func (k *kubeForward) exitError() error {
+	msg := strings.TrimSpace(k.stderr.String())
+	if msg == "" {
+		msg = "kubectl port-forward exited"
+	}
+	if k.err != nil {
+		return fmt.Errorf("%s (%w)", msg, k.err)
+	}
+	return errors.New(msg)
+}
+
+// DialContext connects to kubectl's port; the address is always the target's.
+func (k *kubeForward) DialContext(ctx context.Context, network, _ string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, k.addr)
+}
+
+// Wait blocks until kubectl exits, for instance when the pod goes away.
+func (k *kubeForward) Wait() error {
+	<-k.exited
+	return k.exitError()
+}
+
+// Close stops kubectl.
+func (k *kubeForward) Close() error {
+	select {
+	case <-k.exited:
+		return nil
+	default:
+	}
+	if err := k.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-k.exited
+	return nil
+}
+
+// tailBuffer keeps the last maxKubeStderr bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - maxKubeStderr; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeKubectl installs a kubectl that records its arguments and runs script.
+func fakeKubectl(t *testing.T, script string) (argsFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	path := filepath.Join(dir, "kubectl")
+	body := "#!/bin/sh\necho \"$@\" > " + argsFile + "\n" + script + "\n"
+	if err := os.WriteFile(path, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	previous := kubectlPath
+	kubectlPath = path
+	t.Cleanup(func() { kubectlPath = previous })
+	return argsFile
+}
+
+func TestKubernetesForwardRunsKubectl(t *testing.T) {
+	_, echoPort, _ := net.SplitHostPort(startEcho(t))
+	argsFile := fakeKubectl(t, "echo 'Forwarding from 127.0.0.1:"+echoPort+" -> 5432'\nexec sleep 60")
+	manager := NewManager(Options{}, nil)
+	defer manager.CloseAll()
+
+	info, err := manager.Open(context.Background(), Spec{Kubernetes: &KubeTarget{
+		Context: "staging", Namespace: "data", Resource: "svc/postgres", Port: 5432,
+	}}, "")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if info.Kind != KindKubernetes || info.Remote != "staging/data/svc/postgres:5432" {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	args, _ := os.ReadFile(argsFile)
+	if got := strings.TrimSpace(string(args)); got != "--context staging --namespace data port-forward --address 127.0.0.1 svc/postgres :5432" {
+		t.Fatalf("unexpected kubectl arguments %q", got)
+	}
+
+	conn, err := net.Dial("tcp", info.LocalAddress)
+	if err != nil {
+		t.Fatalf("dial local port: %v", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "ping")
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("unexpected echo %q, %v", reply, err)
+	}
+}
+
+func TestKubernetesForwardReportsKubectlErrors(t *testing.T) {
+	fakeKubectl(t, `echo 'error: services "postgres" not found' >&2; exit 1`)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := OpenForward(ctx, Spec{Kubernetes: &KubeTarget{Resource: "svc/postgres", Port: 5432}}, Options{})
+	if err == nil || !strings.Contains(err.Error(), `services "postgres" not found`) {
+		t.Fatalf("expected kubectl's error, got %v", err)
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	for _, spec := range []Spec{
+		{},
+		{Hops: []Hop{{Host: "b", User: "u"}}},
+		{Kubernetes: &KubeTarget{Resource: "--all", Port: 5432}},
+		{Kubernetes: &KubeTarget{Resource: "db"}, Hops: []Hop{{Host: "b", User: "u"}}},
+	} {
+		if spec.Validate() == nil {
+			t.Fatalf("expected %+v to be invalid", spec)
+		}
+	}
+}
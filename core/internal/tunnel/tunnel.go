@@ -0,0 +1,173 @@
+// Package tunnel reaches databases through SSH, including through an ordered chain of
+// bastions as OpenSSH's ProxyJump does, each hop with its own credentials.
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"golang.org/x/crypto/ssh"
+)
+
+const defaultHandshakeTimeout = 15 * time.Second
+
+// Auth holds the credentials for one hop. A private key takes precedence; the password is
+// also offered when both are set.
+type Auth struct {
+	Password string `json:"password,omitempty"`
+	// PrivateKey is a PEM encoded key, optionally protected by Passphrase.
+	PrivateKey string `json:"privateKey,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// Hop is one SSH server on the way to the database.
+type Hop struct {
+	Host string `json:"host"`
+	Port int    `json:"port,omitempty"`
+	User string `json:"user"`
+	Auth Auth   `json:"auth"`
+}
+
+// Address returns host:port, defaulting to port 22.
+func (h Hop) Address() string {
+	port := h.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(h.Host, strconv.Itoa(port))
+}
+
+func (h Hop) clientConfig(hostKeys ssh.HostKeyCallback) (*ssh.ClientConfig, error) {
+	if h.Host == "" || h.User == "" {
+		return nil, errors.New("host and user are required")
+	}
+	var methods []ssh.AuthMethod
+	if h.Auth.PrivateKey != "" {
+		var (
+			signer ssh.Signer
+			err    error
+		)
+		if h.Auth.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(h.Auth.PrivateKey), []byte(h.Auth.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey([]byte(h.Auth.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("private key: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if h.Auth.Password != "" {
+		methods = append(methods, ssh.Password(h.Auth.Password))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("a password or private key is required")
+	}
+	return &ssh.ClientConfig{
+		User:            h.User,
+		Auth:            methods,
+		HostKeyCallback: hostKeys,
+		Timeout:         defaultHandshakeTimeout,
+	}, nil
+}
+
+// Options control how hops are verified.
+type Options struct {
+	// HostKeys verifies every hop. It is required: host checking cannot be turned off.
+	HostKeys *sshtrust.Store
+	Mode     sshtrust.Mode
+	Prompt   sshtrust.PromptFunc
+}
+
+// Chain is an established path through one or more hops. Connections dialled through it
+// leave from the last hop.
+type Chain struct {
+	clients []*ssh.Client
+}
+
+// Connect opens each hop in turn, tunnelling every hop after the first through the one
+// before it. Errors name the hop that failed.
+func Connect(ctx context.Context, hops []Hop, opts Options) (*Chain, error) {
+	if len(hops) == 0 {
+		return nil, errors.New("at least one SSH hop is required")
+	}
+	if opts.HostKeys == nil {
+		return nil, errors.New("a host key store is required")
+	}
+	callback := opts.HostKeys.HostKeyCallback(opts.Mode, opts.Prompt)
+
+	chain := &Chain{}
+	for i, hop := range hops {
+		client, err := chain.connectHop(ctx, hop, callback)
+		if err != nil {
+			chain.Close()
+			return nil, fmt.Errorf("ssh hop %d (%s): %w", i+1, hop.Address(), err)
+		}
+		chain.clients = append(chain.clients, client)
+	}
+	return chain, nil
+}
+
+func (c *Chain) connectHop(ctx context.Context, hop Hop, callback ssh.HostKeyCallback) (*ssh.Client, error) {
+	cfg, err := hop.clientConfig(callback)
+	if err != nil {
+		return nil, err
+	}
+	addr := hop.Address()
+	conn, err := c.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// The handshake has no context of its own, so cancellation closes the connection.
+	deadline := time.Now().Add(cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	stop()
+	if err != nil {
+		conn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return ssh.NewClient(sshConn, chans, reqs), nil
+}
+
+// DialContext connects to addr from the last hop, or directly before any hop is open.
+func (c *Chain) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if len(c.clients) == 0 {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return c.clients[len(c.clients)-1].DialContext(ctx, network, addr)
+}
+
+// Close closes the hops, innermost first. Closing twice is harmless.
+func (c *Chain) Close() error {
+	var errs []error
+	for i := len(c.clients) - 1; i >= 0; i-- {
+		if err := c.clients[i].Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Wait blocks until the outermost hop disconnects.
+func (c *Chain) Wait() error {
+	if len(c.clients) == 0 {
+		return nil
+	}
+	return c.clients[0].Wait()
+}
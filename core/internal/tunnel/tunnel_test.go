@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fluxgrid/core/internal/sshtrust"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer is an SSH server accepting one password that forwards direct-tcpip
+// channels, standing in for a bastion.
+type testServer struct {
+	addr     string
+	forwards atomic.Int32
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+// drop disconnects every client, as a bastion restart would.
+func (s *testServer) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func startServer(t *testing.T, password string) *testServer {
+	t.Helper()
+	_, priv, _ := ed25519.GenerateKey(nil)
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, given []byte) (*ssh.Permissions, error) {
+			if string(given) != password {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	server := &testServer{addr: listener.Addr().String()}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, cfg)
+		}
+	}()
+	return server
+}
+
+func (s *testServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	s.mu.Lock()
+	s.conns = append(s.conns, conn)
+	s.mu.Unlock()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		var target struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+		if newChannel.ChannelType() != "direct-tcpip" || ssh.Unmarshal(newChannel.ExtraData(), &target) != nil {
+			newChannel.Reject(ssh.UnknownChannelType, "only direct-tcpip is supported")
+			continue
+		}
+		upstream, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			upstream.Close()
+			continue
+		}
+		s.forwards.Add(1)
+		go ssh.DiscardRequests(requests)
+		go func() {
+			defer channel.Close()
+			defer upstream.Close()
+			go func() {
+				io.Copy(upstream, channel)
+				upstream.(*net.TCPConn).CloseWrite()
+			}()
+			io.Copy(channel, upstream)
+		}()
+	}
+}
+
+func hopTo(t *testing.T, server *testServer, password string) Hop {
+	host, port, _ := net.SplitHostPort(server.addr)
+	p, _ := strconv.Atoi(port)
+	return Hop{Host: host, Port: p, User: "fluxgrid", Auth: Auth{Password: password}}
+}
+
+func startEcho(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestConnectThroughBastionChain(t *testing.T) {
+	outer, inner := startServer(t, "outer-secret"), startServer(t, "inner-secret")
+	echo := startEcho(t)
+	store := sshtrust.NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+
+	chain, err := Connect(context.Background(), []Hop{hopTo(t, outer, "outer-secret"), hopTo(t, inner, "inner-secret")},
+		Options{HostKeys: store, Mode: sshtrust.TOFU})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer chain.Close()
+
+	conn, err := chain.DialContext(context.Background(), "tcp", echo)
+	if err != nil {
+		t.Fatalf("dial through chain: %v", err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "ping"); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "ping" {
+		t.Fatalf("unexpected echo %q, %v", reply, err)
+	}
+	// The outer bastion carries the inner hop; the inner one carries the database.
+	if outer.forwards.Load() != 1 || inner.forwards.Load() != 1 {
+		t.Fatalf("expected one forward per hop, got %d and %d", outer.forwards.Load(), inner.forwards.Load())
+	}
+}
+
+func TestConnectNamesTheFailingHop(t *testing.T) {
+	outer, inner := startServer(t, "outer-secret"), startServer(t, "inner-secret")
+	store := sshtrust.NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+
+	_, err := Connect(context.Background(), []Hop{hopTo(t, outer, "outer-secret"), hopTo(t, inner, "wrong")},
+		Options{HostKeys: store, Mode: sshtrust.TOFU})
+	if err == nil || !strings.Contains(err.Error(), "ssh hop 2") {
+		t.Fatalf("expected the second hop to fail, got %v", err)
+	}
+
+	_, err = Connect(context.Background(), []Hop{hopTo(t, outer, "outer-secret")}, Options{HostKeys: store, Mode: sshtrust.Strict})
+	if err != nil {
+		t.Fatalf("expected the host trusted on first use to pass strict checking, got %v", err)
+	}
+	fresh := sshtrust.NewStore(filepath.Join(t.TempDir(), "known_hosts"))
+	var unknown *sshtrust.UnknownHostError
+	if _, err := Connect(context.Background(), []Hop{hopTo(t, outer, "outer-secret")}, Options{HostKeys: fresh, Mode: sshtrust.Strict}); !errors.As(err, &unknown) {
+		t.Fatalf("expected an unknown host error, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package txjournal
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processAlive reports whether a process with the pid exists. A process of another user
+// refuses the signal but is alive all the same.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,236 @@
+// Package txjournal records the transactions a core process holds open, so that when the
+// process dies without committing or rolling them back, a later one can report them. The
+// server may still hold such a transaction, with its locks, until it notices the client
+// is gone; the record says where to look for it.
+//
+// Each process keeps its own file in the journal directory, named after its pid, so that
+// several cores can share a state directory. Files of processes that are no longer
+// running describe orphaned transactions.
+package txjournal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxStatementLen bounds the statement text kept for each transaction.
+const maxStatementLen = 2000
+
+// Entry describes an open transaction.
+type Entry struct {
+	ID     string `json:"id"`
+	Driver string `json:"driver"`
+	// Target names the server and database without credentials, for example
+	// alice@db.internal:5432/app.
+	Target string `json:"target"`
+	// Fingerprint identifies the connection target, so that entries for the same
+	// database can be matched up.
+	Fingerprint string `json:"fingerprint"`
+	// BackendPID is the server's id for the session holding the transaction: the
+	// Postgres backend pid or the MySQL connection id.
+	BackendPID      int64      `json:"backendPid,omitempty"`
+	StartedAt       time.Time  `json:"startedAt"`
+	Statements      int        `json:"statements"`
+	LastStatement   string     `json:"lastStatement,omitempty"`
+	LastStatementAt *time.Time `json:"lastStatementAt,omitempty"`
+}
+
+// Orphan is a transaction left open by a process that is no longer running.
+type Orphan struct {
+	Entry
+	// PID is the process that held the transaction.
+	PID int `json:"pid"`
+}
+
+// Journal records the open transactions of this process. A nil Journal records nothing.
+type Journal struct {
+	dir  string
+	path string
+
+	mu   sync.Mutex
+	open map[string]Entry
+}
+
+// Open returns the journal of this process in dir. Nothing is written until a
+// transaction begins.
+func Open(dir string) *Journal {
+	name := strconv.Itoa(os.Getpid()) + "-" + strconv.FormatInt(time.Now().UnixNano(), 36) + ".json"
+	return &Journal{dir: dir, path: filepath.Join(dir, name), open: make(map[string]Entry)}
+}
+
+// Begin records a transaction that was opened.
+func (j *Journal) Begin(e Entry) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.open[e.ID] = e
+	return j.saveLocked()
+}
+
+// Statement records a statement run in transaction id.
+func (j *Journal) Statement(id, statement string, at time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.open[id]
+	if !ok {
+		return nil
+	}
+	if len(statement) > maxStatementLen {
+		statement = strings.ToValidUTF8(statement[:maxStatementLen], "")
+	}
+	e.Statements++
+	e.LastStatement = statement
+	e.LastStatementAt = &at
+	j.open[id] = e
+	return j.saveLocked()
+}
+
+// End forgets a transaction that was committed or rolled back.
+func (j *Journal) End(id string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.open[id]; !ok {
+		return nil
+	}
+	delete(j.open, id)
+	return j.saveLocked()
+}
+
+// saveLocked writes the open transactions, or removes the file when there are none.
+func (j *Journal) saveLocked() error {
+	if len(j.open) == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(map[string]any{"transactions": sortedEntries(j.open)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(j.dir, 0o700); err != nil {
+		return err
+	}
+	// Write through a temporary file so that a crash never leaves a truncated journal.
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// Orphans lists the transactions recorded by processes that are no longer running.
+func (j *Journal) Orphans() ([]Orphan, error) {
+	if j == nil {
+		return nil, nil
+	}
+	orphans := []Orphan{}
+	err := j.eachOrphanFile(func(path string, pid int, entries []Entry) error {
+		for _, e := range entries {
+			orphans = append(orphans, Orphan{Entry: e, PID: pid})
+		}
+		return nil
+	})
+	sort.Slice(orphans, func(a, b int) bool { return orphans[a].StartedAt.Before(orphans[b].StartedAt) })
+	return orphans, err
+}
+
+// Dismiss removes the named orphans once the user has dealt with them, returning how
+// many were removed.
+func (j *Journal) Dismiss(ids []string) (int, error) {
+	if j == nil || len(ids) == 0 {
+		return 0, nil
+	}
+	dismiss := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		dismiss[id] = true
+	}
+	removed := 0
+	err := j.eachOrphanFile(func(path string, _ int, entries []Entry) error {
+		kept := entries[:0]
+		for _, e := range entries {
+			if dismiss[e.ID] {
+				removed++
+			} else {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == len(entries) {
+			return nil
+		}
+		if len(kept) == 0 {
+			return os.Remove(path)
+		}
+		data, err := json.MarshalIndent(map[string]any{"transactions": kept}, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, data, 0o600)
+	})
+	return removed, err
+}
+
+// eachOrphanFile calls fn for the journal files of processes that are not running.
+func (j *Journal) eachOrphanFile(fn func(path string, pid int, entries []Entry) error) error {
+	files, err := os.ReadDir(j.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	self := os.Getpid()
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		path := filepath.Join(j.dir, name)
+		pidText, _, _ := strings.Cut(name, "-")
+		pid, err := strconv.Atoi(pidText)
+		// A file of this process's pid other than its own was left by an earlier
+		// process the pid was reused from.
+		if err != nil || path == j.path || (pid != self && processAlive(pid)) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var state struct {
+			Transactions []Entry `json:"transactions"`
+		}
+		if err := json.Unmarshal(data, &state); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := fn(path, pid, state.Transactions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedEntries(open map[string]Entry) []Entry {
+	entries := make([]Entry, 0, len(open))
+	for _, e := range open {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].StartedAt.Before(entries[b].StartedAt) })
+	return entries
+}
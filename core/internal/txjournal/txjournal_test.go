@@ -0,0 +1,84 @@
+package txjournal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// deadPID is a pid no process has, standing in for a core that crashed.
+const deadPID = "2147483646"
+
+func TestJournalReportsTransactionsOfDeadProcesses(t *testing.T) {
+	dir := t.TempDir()
+	crashed := Open(dir)
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []string{"tx_a", "tx_b"} {
+		if err := crashed.Begin(Entry{ID: id, Driver: "postgres", Target: "app@db:5432/app", StartedAt: started}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := crashed.Statement("tx_a", "UPDATE t SET x = 1", started.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A running process's own transactions are never orphans.
+	if orphans, err := crashed.Orphans(); err != nil || len(orphans) != 0 {
+		t.Fatalf("expected no orphans while the process runs, got %+v %v", orphans, err)
+	}
+
+	if err := os.Rename(crashed.path, filepath.Join(dir, deadPID+"-x.json")); err != nil {
+		t.Fatal(err)
+	}
+	next := Open(dir)
+	orphans, err := next.Orphans()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 2 || orphans[0].PID != 2147483646 {
+		t.Fatalf("unexpected orphans %+v", orphans)
+	}
+	for _, o := range orphans {
+		if o.ID == "tx_a" && (o.LastStatement != "UPDATE t SET x = 1" || o.Statements != 1) {
+			t.Fatalf("last statement was not recorded: %+v", o)
+		}
+	}
+
+	if n, err := next.Dismiss([]string{"tx_a", "tx_unknown"}); err != nil || n != 1 {
+		t.Fatalf("expected one dismissal, got %d %v", n, err)
+	}
+	if orphans, _ := next.Orphans(); len(orphans) != 1 || orphans[0].ID != "tx_b" {
+		t.Fatalf("unexpected orphans after dismissal %+v", orphans)
+	}
+	if n, _ := next.Dismiss([]string{"tx_b"}); n != 1 {
+		t.Fatalf("expected the last orphan to be dismissed")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the journal directory to be empty, got %d files", len(files))
+	}
+}
+
+func TestJournalRemovesItsFileWhenIdle(t *testing.T) {
+	j := Open(t.TempDir())
+	if err := j.Begin(Entry{ID: "tx", StartedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(j.path); err != nil {
+		t.Fatalf("expected a journal file: %v", err)
+	}
+	if err := j.End("tx"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(j.path); !os.IsNotExist(err) {
+		t.Fatalf("expected the journal file to be removed, got %v", err)
+	}
+
+	var none *Journal
+	if err := none.Begin(Entry{ID: "tx"}); err != nil {
+		t.Fatal(err)
+	}
+	if orphans, err := none.Orphans(); err != nil || orphans != nil {
+		t.Fatalf("a nil journal should report nothing")
+	}
+}
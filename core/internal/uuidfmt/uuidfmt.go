@@ -0,0 +1,76 @@
+// Package uuidfmt renders UUIDs in the one form results use, whichever driver read them:
+// pgx decodes uuid columns to 16 bytes, MySQL stores them as BINARY(16) or text, and
+// SQLite holds whatever was written.
+package uuidfmt
+
+import (
+	"encoding/hex"
+	"strings"
+)
+
+// Formats a UUID can be rendered in.
+const (
+	// Lower is the canonical 8-4-4-4-12 form in lowercase, the default.
+	Lower = "lower"
+	// Upper is the canonical form in uppercase.
+	Upper = "upper"
+	// Bytes is the 16 bytes as \x-prefixed hex, the way binary values are shown.
+	Bytes = "bytes"
+)
+
+// Valid reports whether format is a known format. The empty string selects Lower.
+func Valid(format string) bool {
+	switch format {
+	case "", Lower, Upper, Bytes:
+		return true
+	default:
+		return false
+	}
+}
+
+// Format renders u in format.
+func Format(u [16]byte, format string) string {
+	if format == Bytes {
+		return `\x` + hex.EncodeToString(u[:])
+	}
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	if format == Upper {
+		return strings.ToUpper(string(buf[:]))
+	}
+	return string(buf[:])
+}
+
+// Parse reads a UUID written in the canonical form in either case, without hyphens,
+// wrapped in braces or as a urn:uuid: URN.
+func Parse(s string) ([16]byte, bool) {
+	var u [16]byte
+	switch {
+	case len(s) == 38 && s[0] == '{' && s[37] == '}':
+		s = s[1:37]
+	case len(s) == 45 && strings.EqualFold(s[:9], "urn:uuid:"):
+		s = s[9:]
+	}
+	switch len(s) {
+	case 36:
+		if s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+			return u, false
+		}
+		s = s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	case 32:
+	default:
+		return u, false
+	}
+	if _, err := hex.Decode(u[:], []byte(s)); err != nil {
+		return u, false
+	}
+	return u, true
+}
@@ -0,0 +1,55 @@
+package uuidfmt
+
+import "testing"
+
+var sample = [16]byte{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4, 0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00}
+
+func TestFormat(t *testing.T) {
+	cases := map[string]string{
+		"":    "550e8400-e29b-41d4-a716-446655440000",
+		Lower: "550e8400-e29b-41d4-a716-446655440000",
+		Upper: "550E8400-E29B-41D4-A716-446655440000",
+		Bytes: `\x550e8400e29b41d4a716446655440000`,
+	}
+	for format, want := range cases {
+		if got := Format(sample, format); got != want {
+			t.Errorf("%q: got %s, want %s", format, got, want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, in := range []string{
+		"550e8400-e29b-41d4-a716-446655440000",
+		"550E8400-E29B-41D4-A716-446655440000",
+		"550e8400e29b41d4a716446655440000",
+		"{550e8400-e29b-41d4-a716-446655440000}",
+		"urn:uuid:550e8400-e29b-41d4-a716-446655440000",
+	} {
+		if got, ok := Parse(in); !ok || got != sample {
+			t.Errorf("%s: got %x ok=%v", in, got, ok)
+		}
+	}
+	for _, in := range []string{
+		"",
+		"550e8400-e29b-41d4-a716-44665544000",
+		"550e8400e-29b-41d4-a716-446655440000",
+		"550e8400-e29b-41d4-a716-44665544000g",
+		"{550e8400-e29b-41d4-a716-446655440000",
+	} {
+		if _, ok := Parse(in); ok {
+			t.Errorf("%s: parsed", in)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, format := range []string{"", Lower, Upper, Bytes} {
+		if !Valid(format) {
+			t.Errorf("%q should be valid", format)
+		}
+	}
+	if Valid("hex") {
+		t.Error("hex should not be valid")
+	}
+}
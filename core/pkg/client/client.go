@@ -0,0 +1,299 @@
+// Package client drives the FluxGrid core over its JSON-RPC protocol. It spawns the core
+// binary (or wraps any connected stream), correlates requests with responses, consumes
+// streamed results with automatic acknowledgements and cancels requests when their context
+// ends.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrClosed is returned for calls made after the connection to the core ended.
+var ErrClosed = errors.New("client: connection closed")
+
+// Error is a JSON-RPC error returned by the core.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("core error %d: %s (%s)", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("core error %d: %s", e.Code, e.Message)
+}
+
+// NotificationHandler receives the params of a notification sent by the core. Handlers run
+// on the read loop, so they must not block or wait for another call on the same client.
+type NotificationHandler func(params json.RawMessage)
+
+// Client is a connection to a running core. It is safe for concurrent use.
+type Client struct {
+	writeMu sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+	cmd     *exec.Cmd
+	nextID  atomic.Int64
+
+	mu       sync.Mutex
+	pending  map[string]chan message
+	handlers map[string]NotificationHandler
+	streams  map[string]*Stream
+	err      error
+	done     chan struct{}
+}
+
+type message struct {
+	ID     *json.RawMessage `json:"id,omitempty"`
+	Method string           `json:"method,omitempty"`
+	Params json.RawMessage  `json:"params,omitempty"`
+	Result json.RawMessage  `json:"result,omitempty"`
+	Error  *Error           `json:"error,omitempty"`
+}
+
+// New wraps an established connection: reader carries messages from the core and writer
+// carries messages to it. closer, when not nil, is closed by Close.
+func New(reader io.Reader, writer io.Writer, closer io.Closer) *Client {
+	c := &Client{
+		encoder:  json.NewEncoder(writer),
+		closer:   closer,
+		pending:  make(map[string]chan message),
+		handlers: make(map[string]NotificationHandler),
+		streams:  make(map[string]*Stream),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop(reader)
+	return c
+}
+
+// Spawn starts the core binary described by cmd in stdio mode and connects to it. The
+// command's Stdin and Stdout must be unset; set Stderr to capture the core's logs.
+func Spawn(cmd *exec.Cmd) (*Client, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := New(stdout, stdin, stdin)
+	c.cmd = cmd
+	return c, nil
+}
+
+// Dial connects to a core serving JSON-RPC on a socket.
+func Dial(ctx context.Context, network, address string) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn, conn, conn), nil
+}
+
+// OnNotification registers the handler for a notification method, replacing any previous
+// one. Stream notifications are consumed through Stream and never reach handlers.
+func (c *Client) OnNotification(method string, handler NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if handler == nil {
+		delete(c.handlers, method)
+		return
+	}
+	c.handlers[method] = handler
+}
+
+// Call sends a request and decodes its result into result, which may be nil. When ctx ends
+// before the core answers, Call asks the core to cancel the request and returns ctx.Err().
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	id := c.newID()
+	responses, err := c.send(id, method, params)
+	if err != nil {
+		return err
+	}
+	return c.wait(ctx, id, responses, result)
+}
+
+func (c *Client) newID() string {
+	return "c-" + strconv.FormatInt(c.nextID.Add(1), 10)
+}
+
+func (c *Client) send(id, method string, params any) (chan message, error) {
+	responses := make(chan message, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending[id] = responses
+	c.mu.Unlock()
+
+	if err := c.write(envelope(id, method, params)); err != nil {
+		c.forget(id)
+		return nil, err
+	}
+	return responses, nil
+}
+
+func (c *Client) wait(ctx context.Context, id string, responses chan message, result any) error {
+	select {
+	case msg, ok := <-responses:
+		if !ok {
+			return c.closedErr()
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || len(msg.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	case <-ctx.Done():
+		c.forget(id)
+		// The core may not read while it runs the request; do not block the caller on it.
+		go func() { _ = c.Cancel(id) }()
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification to the core.
+func (c *Client) Notify(method string, params any) error {
+	return c.write(envelope("", method, params))
+}
+
+func envelope(id, method string, params any) map[string]any {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if id != "" {
+		msg["id"] = id
+	}
+	if params != nil {
+		msg["params"] = params
+	}
+	return msg
+}
+
+// Cancel asks the core to cancel an in-flight request.
+func (c *Client) Cancel(requestID string) error {
+	return c.Notify("query.cancel", map[string]string{"requestId": requestID})
+}
+
+// Done is closed when the connection to the core ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection and, for spawned cores, waits for the process to exit.
+func (c *Client) Close() error {
+	var err error
+	if c.closer != nil {
+		err = c.closer.Close()
+	}
+	if c.cmd != nil {
+		// The core exits when its stdin closes.
+		if waitErr := c.cmd.Wait(); err == nil {
+			err = waitErr
+		}
+	}
+	return err
+}
+
+func (c *Client) write(v any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.done:
+		return c.closedErr()
+	default:
+	}
+	return c.encoder.Encode(v)
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+func (c *Client) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return ErrClosed
+}
+
+func (c *Client) readLoop(reader io.Reader) {
+	decoder := json.NewDecoder(reader)
+	var err error
+	for {
+		var msg message
+		if err = decoder.Decode(&msg); err != nil {
+			break
+		}
+		if msg.ID == nil {
+			c.dispatch(msg)
+			continue
+		}
+
+		var id string
+		if json.Unmarshal(*msg.ID, &id) != nil {
+			id = string(*msg.ID)
+		}
+		c.mu.Lock()
+		responses, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			responses <- msg
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		err = ErrClosed
+	} else {
+		err = fmt.Errorf("%w: %v", ErrClosed, err)
+	}
+	c.mu.Lock()
+	c.err = err
+	for id, responses := range c.pending {
+		close(responses)
+		delete(c.pending, id)
+	}
+	streams := c.streams
+	c.streams = make(map[string]*Stream)
+	c.mu.Unlock()
+	for _, stream := range streams {
+		stream.push(streamEvent{err: err})
+	}
+	close(c.done)
+}
+
+func (c *Client) dispatch(msg message) {
+	if stream := c.streamFor(msg); stream != nil {
+		stream.handle(msg)
+		return
+	}
+	c.mu.Lock()
+	handler := c.handlers[msg.Method]
+	c.mu.Unlock()
+	if handler != nil {
+		handler(msg.Params)
+	}
+}
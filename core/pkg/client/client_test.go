@@ -0,0 +1,156 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/fluxgrid/core/internal/protocol"
+	"github.com/fluxgrid/core/internal/rpc"
+	"github.com/rs/zerolog"
+)
+
+// connect serves server over in-memory pipes and returns a client talking to it.
+func connect(t *testing.T, server *rpc.Server) *Client {
+	t.Helper()
+	toServer, fromClient := io.Pipe()
+	toClient, fromServer := io.Pipe()
+	go func() {
+		_ = server.Serve(toServer, fromServer)
+		fromServer.Close()
+	}()
+	c := New(toClient, fromClient, fromClient)
+	t.Cleanup(func() {
+		c.Close()
+		<-c.Done()
+	})
+	return c
+}
+
+func TestCallDecodesResultsAndErrors(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("core.ping", func(context.Context, json.RawMessage) (any, *rpc.Error) {
+		return map[string]string{"status": "ok", "version": "test"}, nil
+	})
+	server.Register("query.execute", func(context.Context, json.RawMessage) (any, *rpc.Error) {
+		return nil, &rpc.Error{Code: -32011, Message: "query execution failed", Data: "syntax error"}
+	})
+	c := connect(t, server)
+
+	ping, err := c.Ping(context.Background())
+	if err != nil || ping.Status != "ok" || ping.Version != "test" {
+		t.Fatalf("unexpected ping %+v, %v", ping, err)
+	}
+
+	_, err = c.Execute(context.Background(), ExecuteParams{SQL: "selec"})
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != -32011 || string(rpcErr.Data) != `"syntax error"` {
+		t.Fatalf("expected core error, got %v", err)
+	}
+}
+
+func TestCallReturnsWhenContextEnds(t *testing.T) {
+	release := make(chan struct{})
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("slow", func(context.Context, json.RawMessage) (any, *rpc.Error) {
+		<-release
+		return "late", nil
+	})
+	c := connect(t, server)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "slow", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+}
+
+func TestStreamDecodesAndAcknowledgesChunks(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	acks := make(chan int, 4)
+	server.RegisterNotification("query.stream.ack", func(_ context.Context, raw json.RawMessage) {
+		var ack struct {
+			Seq int `json:"seq"`
+		}
+		_ = json.Unmarshal(raw, &ack)
+		acks <- ack.Seq
+	})
+	server.Register("query.execute", func(ctx context.Context, raw json.RawMessage) (any, *rpc.Error) {
+		requestID, _ := rpc.RequestIDFromContext(ctx)
+		go func() {
+			_ = server.Notify("query.stream.start", map[string]any{
+				"requestId":   requestID,
+				"columns":     []Column{{Name: "id", DataType: "20"}},
+				"compression": "gzip",
+			})
+			encoder, _ := protocol.NewRowEncoder(protocol.CompressionGzip)
+			defer encoder.Close()
+			for seq := 1; seq <= 2; seq++ {
+				data, _ := encoder.Encode([][]any{{float64(seq)}})
+				_ = server.Notify("query.stream.chunk", map[string]any{
+					"requestId": requestID, "seq": seq, "hasMore": seq < 2,
+					"compression": "gzip", "data": data, "rowCount": 1,
+				})
+				if <-acks != seq {
+					return
+				}
+			}
+			_ = server.Notify("query.stream.complete", map[string]any{
+				"requestId":  requestID,
+				"statistics": map[string]any{"totalRows": 2},
+			})
+		}()
+		return map[string]any{"mode": "stream", "requestId": requestID}, nil
+	})
+	c := connect(t, server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := c.Stream(ctx, ExecuteParams{SQL: "select 1"})
+	if err != nil {
+		t.Fatalf("Stream returned error: %v", err)
+	}
+	if len(stream.Columns) != 1 || stream.Compression != "gzip" {
+		t.Fatalf("unexpected stream metadata %+v", stream)
+	}
+
+	var rows [][]any
+	for {
+		chunk, err := stream.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next returned error: %v", err)
+		}
+		rows = append(rows, chunk.Rows...)
+	}
+	if len(rows) != 2 || rows[1][0] != float64(2) {
+		t.Fatalf("unexpected rows %v", rows)
+	}
+	if stats := stream.Stats(); stats == nil || stats.TotalRows != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestStreamReportsStreamErrors(t *testing.T) {
+	server := rpc.NewServer(zerolog.Nop())
+	server.Register("query.execute", func(ctx context.Context, _ json.RawMessage) (any, *rpc.Error) {
+		requestID, _ := rpc.RequestIDFromContext(ctx)
+		_ = server.Notify("query.stream.error", map[string]any{
+			"requestId": requestID, "code": "CONNECTION_ERROR", "message": "refused", "fatal": true,
+		})
+		return map[string]any{"mode": "stream", "requestId": requestID}, nil
+	})
+	c := connect(t, server)
+
+	_, err := c.Stream(context.Background(), ExecuteParams{SQL: "select 1"})
+	var streamErr *StreamError
+	if !errors.As(err, &streamErr) || streamErr.Code != "CONNECTION_ERROR" || !streamErr.Fatal {
+		t.Fatalf("expected stream error, got %v", err)
+	}
+}
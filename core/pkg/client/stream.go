@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/fluxgrid/core/internal/protocol"
+)
+
+// StreamError is the query.stream.error notification that ended a stream.
+type StreamError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Fatal   bool   `json:"fatal"`
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream %s: %s", e.Code, e.Message)
+}
+
+// Chunk is a batch of streamed rows, already decompressed.
+type Chunk struct {
+	Seq     int
+	Rows    [][]any
+	HasMore bool
+}
+
+// StreamStats are the statistics reported by query.stream.complete.
+type StreamStats struct {
+	ExecutionTimeMs float64 `json:"executionTimeMs"`
+	TotalRows       int     `json:"totalRows"`
+}
+
+// Stream consumes a streaming query.execute. Chunks are acknowledged as Next returns them,
+// so the core's backpressure follows the consumer.
+type Stream struct {
+	RequestID   string
+	Columns     []Column
+	Compression string
+
+	client *Client
+	mu     sync.Mutex
+	queue  []streamEvent
+	ready  chan struct{}
+	stats  *StreamStats
+	done   bool
+}
+
+type streamEvent struct {
+	method string
+	params json.RawMessage
+	err    error
+}
+
+// Stream starts params in streaming mode and waits for the stream to announce its columns.
+func (c *Client) Stream(ctx context.Context, params ExecuteParams) (*Stream, error) {
+	params.Options.Mode = "stream"
+
+	id := c.newID()
+	stream := &Stream{RequestID: id, client: c, ready: make(chan struct{}, 1)}
+	c.mu.Lock()
+	c.streams[id] = stream
+	c.mu.Unlock()
+
+	responses, err := c.send(id, "query.execute", params)
+	if err == nil {
+		err = c.wait(ctx, id, responses, nil)
+	}
+	if err != nil {
+		c.removeStream(id)
+		return nil, err
+	}
+
+	event, err := stream.next(ctx)
+	if err != nil {
+		_ = stream.Close()
+		return nil, err
+	}
+	switch event.method {
+	case "query.stream.start":
+		var start struct {
+			Columns     []Column `json:"columns"`
+			Compression string   `json:"compression"`
+		}
+		if err := json.Unmarshal(event.params, &start); err != nil {
+			_ = stream.Close()
+			return nil, err
+		}
+		stream.Columns = start.Columns
+		stream.Compression = start.Compression
+		return stream, nil
+	case "query.stream.error":
+		stream.finish()
+		return nil, decodeStreamError(event.params)
+	default:
+		_ = stream.Close()
+		return nil, fmt.Errorf("client: unexpected %s before query.stream.start", event.method)
+	}
+}
+
+// Next returns the next chunk and acknowledges it. It returns io.EOF once the stream
+// completed and a *StreamError when the core aborted or cancelled it.
+func (s *Stream) Next(ctx context.Context) (*Chunk, error) {
+	for {
+		if s.isDone() {
+			return nil, io.EOF
+		}
+		event, err := s.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		switch event.method {
+		case "query.stream.chunk":
+			var payload struct {
+				Seq         int     `json:"seq"`
+				Rows        [][]any `json:"rows"`
+				HasMore     bool    `json:"hasMore"`
+				Compression string  `json:"compression"`
+				Data        string  `json:"data"`
+			}
+			if err := json.Unmarshal(event.params, &payload); err != nil {
+				return nil, err
+			}
+			if payload.Compression != "" {
+				if payload.Rows, err = protocol.DecodeRows(payload.Compression, payload.Data); err != nil {
+					return nil, err
+				}
+			}
+			if err := s.client.Notify("query.stream.ack", map[string]any{"requestId": s.RequestID, "seq": payload.Seq}); err != nil {
+				return nil, err
+			}
+			return &Chunk{Seq: payload.Seq, Rows: payload.Rows, HasMore: payload.HasMore}, nil
+		case "query.stream.complete":
+			var payload struct {
+				Statistics StreamStats `json:"statistics"`
+			}
+			if err := json.Unmarshal(event.params, &payload); err != nil {
+				return nil, err
+			}
+			s.mu.Lock()
+			s.stats = &payload.Statistics
+			s.mu.Unlock()
+			s.finish()
+			return nil, io.EOF
+		case "query.stream.error":
+			s.finish()
+			return nil, decodeStreamError(event.params)
+		}
+	}
+}
+
+// Stats returns the completion statistics, or nil while the stream is running.
+func (s *Stream) Stats() *StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// Cancel asks the core to stop the stream. Next then reports a CANCELLED StreamError.
+func (s *Stream) Cancel() error {
+	return s.client.Notify("query.stream.cancel", map[string]string{"requestId": s.RequestID})
+}
+
+// Close cancels the stream if it is still running and stops receiving its notifications.
+func (s *Stream) Close() error {
+	if s.isDone() {
+		return nil
+	}
+	err := s.Cancel()
+	s.finish()
+	return err
+}
+
+func (s *Stream) next(ctx context.Context) (streamEvent, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			event := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return event, event.err
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return streamEvent{}, ctx.Err()
+		}
+	}
+}
+
+// push queues an event without blocking the client's read loop.
+func (s *Stream) push(event streamEvent) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Stream) handle(msg message) {
+	s.push(streamEvent{method: msg.Method, params: msg.Params})
+}
+
+func (s *Stream) finish() {
+	s.mu.Lock()
+	s.done = true
+	s.queue = nil
+	s.mu.Unlock()
+	s.client.removeStream(s.RequestID)
+}
+
+func (s *Stream) isDone() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+func (c *Client) removeStream(id string) {
+	c.mu.Lock()
+	delete(c.streams, id)
+	c.mu.Unlock()
+}
+
+// streamFor returns the stream a query.stream.* notification belongs to.
+func (c *Client) streamFor(msg message) *Stream {
+	if !strings.HasPrefix(msg.Method, "query.stream.") {
+		return nil
+	}
+	var payload struct {
+		RequestID string `json:"requestId"`
+	}
+	if json.Unmarshal(msg.Params, &payload) != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streams[payload.RequestID]
+}
+
+func decodeStreamError(params json.RawMessage) error {
+	var streamErr StreamError
+	if err := json.Unmarshal(params, &streamErr); err != nil {
+		return err
+	}
+	return &streamErr
+}
@@ -0,0 +1,204 @@
+package client
+
+import "context"
+
+// ProtocolVersion is the protocol version this package speaks.
+const ProtocolVersion = "1.0"
+
+// Connection identifies the database a request runs against, either by driver and DSN or
+// by a handle from OpenConnection.
+type Connection struct {
+	Driver string `json:"driver,omitempty"`
+	DSN    string `json:"dsn,omitempty"`
+	Handle string `json:"handle,omitempty"`
+}
+
+// ExecuteParams are the parameters of query.execute.
+type ExecuteParams struct {
+	Connection Connection     `json:"connection"`
+	SQL        string         `json:"sql"`
+	Options    ExecuteOptions `json:"options"`
+}
+
+// ExecuteOptions tune query.execute. Zero values select the core defaults.
+type ExecuteOptions struct {
+	TimeoutSeconds int           `json:"timeoutSeconds,omitempty"`
+	MaxRows        int           `json:"maxRows,omitempty"`
+	Mode           string        `json:"mode,omitempty"`
+	Cache          bool          `json:"cache,omitempty"`
+	CacheMaxRows   int           `json:"cacheMaxRows,omitempty"`
+	Stream         StreamOptions `json:"stream,omitempty"`
+}
+
+// StreamOptions tune streaming mode.
+type StreamOptions struct {
+	HighWaterMark int    `json:"highWaterMark,omitempty"`
+	FetchSize     int    `json:"fetchSize,omitempty"`
+	Compression   string `json:"compression,omitempty"`
+}
+
+// Column describes a result column.
+type Column struct {
+	Name     string        `json:"name"`
+	DataType string        `json:"dataType"`
+	Origin   *ColumnOrigin `json:"origin,omitempty"`
+}
+
+// ColumnOrigin is the table column a result column was read from.
+type ColumnOrigin struct {
+	TableOID uint32 `json:"tableOid,omitempty"`
+	Schema   string `json:"schema,omitempty"`
+	Table    string `json:"table,omitempty"`
+	Column   string `json:"column,omitempty"`
+}
+
+// AffectedObject is a database object changed by a DDL statement.
+type AffectedObject struct {
+	Action  string `json:"action"`
+	Kind    string `json:"kind"`
+	Schema  string `json:"schema,omitempty"`
+	Name    string `json:"name"`
+	NewName string `json:"newName,omitempty"`
+	Table   string `json:"table,omitempty"`
+}
+
+// ExecuteResult is the result of a classic or cached query.execute.
+type ExecuteResult struct {
+	Columns         []Column         `json:"columns"`
+	Rows            [][]any          `json:"rows"`
+	ExecutionTimeMs float64          `json:"executionTimeMs"`
+	ResultID        string           `json:"resultId,omitempty"`
+	CachedRows      int              `json:"cachedRows,omitempty"`
+	Affected        []AffectedObject `json:"affected,omitempty"`
+}
+
+// Capabilities are the features declared by the client in Initialize. Nil lists accept
+// whatever the core offers.
+type Capabilities struct {
+	StreamEncodings []string `json:"streamEncodings,omitempty"`
+	Framing         []string `json:"framing,omitempty"`
+	Notifications   []string `json:"notifications,omitempty"`
+}
+
+// Peer identifies one side of the connection.
+type Peer struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// InitializeResult is the feature set negotiated by core.initialize.
+type InitializeResult struct {
+	ProtocolVersion string   `json:"protocolVersion"`
+	StreamEncodings []string `json:"streamEncodings"`
+	Framing         string   `json:"framing"`
+	Notifications   []string `json:"notifications"`
+	Server          Peer     `json:"server"`
+}
+
+// PingResult is the result of core.ping.
+type PingResult struct {
+	Status  string `json:"status"`
+	Version string `json:"version"`
+	Time    string `json:"time"`
+}
+
+// ConnectTestResult is the result of connect.test.
+type ConnectTestResult struct {
+	LatencyMs      float64           `json:"latencyMs"`
+	ServerVersion  string            `json:"serverVersion"`
+	ConnectionInfo map[string]string `json:"connectionInfo,omitempty"`
+}
+
+// Schema is a schema listed by schema.list.
+type Schema struct {
+	Name   string  `json:"name"`
+	Tables []Table `json:"tables"`
+}
+
+// Table is a table or view listed by schema.list.
+type Table struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	Columns []TableColumn `json:"columns"`
+}
+
+// TableColumn is a column of a listed table.
+type TableColumn struct {
+	Name     string `json:"name"`
+	DataType string `json:"dataType"`
+	NotNull  bool   `json:"notNull"`
+}
+
+// Initialize negotiates the protocol version and capabilities with the core.
+func (c *Client) Initialize(ctx context.Context, self Peer, capabilities Capabilities) (*InitializeResult, error) {
+	var result InitializeResult
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"client":          self,
+		"capabilities":    capabilities,
+	}
+	if err := c.Call(ctx, "core.initialize", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Ping checks that the core is responsive.
+func (c *Client) Ping(ctx context.Context) (*PingResult, error) {
+	var result PingResult
+	if err := c.Call(ctx, "core.ping", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Execute runs a statement in classic or cached mode. Use Stream for streaming mode.
+func (c *Client) Execute(ctx context.Context, params ExecuteParams) (*ExecuteResult, error) {
+	var result ExecuteResult
+	if err := c.Call(ctx, "query.execute", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TestConnection checks that the core can open the connection.
+func (c *Client) TestConnection(ctx context.Context, conn Connection) (*ConnectTestResult, error) {
+	var result ConnectTestResult
+	if err := c.Call(ctx, "connect.test", conn, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// OpenConnection registers conn with the core and returns a Connection that refers to it
+// by handle, so that later requests do not carry the DSN. The handle is valid until
+// CloseConnection or until the client disconnects.
+func (c *Client) OpenConnection(ctx context.Context, conn Connection) (Connection, error) {
+	var result struct {
+		Handle string `json:"handle"`
+	}
+	if err := c.Call(ctx, "connection.open", conn, &result); err != nil {
+		return Connection{}, err
+	}
+	return Connection{Handle: result.Handle}, nil
+}
+
+// CloseConnection releases a handle returned by OpenConnection.
+func (c *Client) CloseConnection(ctx context.Context, conn Connection) error {
+	return c.Call(ctx, "connection.close", map[string]string{"handle": conn.Handle}, nil)
+}
+
+// ListSchemas lists schemas, tables and columns whose names match search (all when empty).
+func (c *Client) ListSchemas(ctx context.Context, conn Connection, search string) ([]Schema, error) {
+	var result struct {
+		Schemas []Schema `json:"schemas"`
+	}
+	params := map[string]any{
+		"connection": conn,
+		"options":    map[string]any{"search": search},
+	}
+	if err := c.Call(ctx, "schema.list", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Schemas, nil
+}